@@ -9,6 +9,7 @@ import (
 	"net/http"
 	_ "net/http/pprof" // подключаем пакет pprof
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
@@ -18,6 +19,7 @@ import (
 	loggerBuilder "github.com/Melikhov-p/url-minimise/internal/logger"
 	"github.com/Melikhov-p/url-minimise/internal/middlewares"
 	"github.com/Melikhov-p/url-minimise/internal/repository"
+	"github.com/Melikhov-p/url-minimise/internal/service"
 	"github.com/Melikhov-p/url-minimise/internal/worker"
 	"github.com/Melikhov-p/url-minimise/protos/gen/proto"
 	"go.uber.org/zap"
@@ -35,7 +37,13 @@ var (
 	buildCommit  = "N/A"
 )
 
-const delWorkerPingInterval = 4 * time.Second
+const (
+	delWorkerPingInterval    = 4 * time.Second
+	purgeWorkerPingInterval  = time.Hour
+	policyWorkerPingInterval = 10 * time.Second
+	healthWorkerPingInterval = time.Minute
+	keyWorkerPingInterval    = time.Minute
+)
 const (
 	timeoutServerShutdown = time.Second * 5
 	timeoutShutdown       = time.Second * 10
@@ -79,14 +87,19 @@ func Run() (err error) {
 	if err != nil {
 		logger.Fatal("error getting new storage", zap.Error(err))
 	}
+	// Хранилище закрывается последним: сначала останавливаются серверы, чтобы запросы в обработке
+	// дописали данные, затем воркеры, чтобы воркер переходов сохранил накопленные события.
+	var servers, workers sync.WaitGroup
 	eg.Go(func() error {
 		defer logger.Debug("DB closed")
 
 		<-ctx.Done()
+		servers.Wait()
+		workers.Wait()
 
-		err = store.Close()
-
-		logger.Error("error closing storage", zap.Error(err))
+		if err := store.Close(); err != nil {
+			logger.Error("error closing storage", zap.Error(err))
+		}
 		return nil
 	})
 
@@ -127,13 +140,17 @@ func Run() (err error) {
 		logger.Error("error running gRPC listnere", zap.Error(err))
 		<-ctx.Done()
 	}
+	interceptor := middlewares.NewUnaryInterceptor(logger, cfg, store)
 	serverRPC := grpc.NewServer(
-		grpc.UnaryInterceptor(
-			middlewares.NewUnaryInterceptor(
-				logger,
-				cfg,
-				store,
-			).UnaryAuthInterceptor,
+		grpc.ChainUnaryInterceptor(
+			interceptor.UnaryMetricsInterceptor,
+			interceptor.UnaryTracingInterceptor,
+			interceptor.UnaryAuthInterceptor,
+		),
+		grpc.ChainStreamInterceptor(
+			interceptor.StreamMetricsInterceptor,
+			interceptor.StreamTracingInterceptor,
+			interceptor.StreamAuthInterceptor,
 		),
 	)
 	proto.RegisterShortenerServer(serverRPC, grpc2.NewShortenerService(logger, cfg, store))
@@ -148,19 +165,26 @@ func Run() (err error) {
 		return nil
 	})
 
+	servers.Add(1)
 	eg.Go(func() error {
+		defer servers.Done()
 		defer logger.Debug("gRPC server has been stopped.")
 		<-ctx.Done()
 
+		// Потоки живых переходов сами не завершаются, без закрытия подписок остановка ждала бы клиентов.
+		cfg.ClickHub.Close()
 		serverRPC.GracefulStop()
 
 		return nil
 	})
 
+	servers.Add(1)
 	eg.Go(func() error {
+		defer servers.Done()
 		defer logger.Debug("server has been shutdown")
 		<-ctx.Done()
 
+		cfg.ClickHub.Close()
 		shutdownTimeoutCtx, cancelShutdownTimeoutCtx := context.WithTimeout(context.Background(), timeoutServerShutdown)
 		defer cancelShutdownTimeoutCtx()
 		if err = server.Shutdown(shutdownTimeoutCtx); err != nil {
@@ -170,8 +194,11 @@ func Run() (err error) {
 	})
 
 	delWorker := worker.NewDelWorker(delWorkerPingInterval, logger, store)
+	delWorker.Metrics = cfg.Metrics
 
+	workers.Add(1)
 	eg.Go(func() error {
+		defer workers.Done()
 		delWorker.LookUp()
 		return nil
 	})
@@ -183,6 +210,94 @@ func Run() (err error) {
 		return nil
 	})
 
+	purgeWorker := worker.NewPurgeWorker(purgeWorkerPingInterval, cfg.URLRetention, logger, store)
+
+	workers.Add(1)
+	eg.Go(func() error {
+		defer workers.Done()
+		purgeWorker.LookUp()
+		return nil
+	})
+
+	eg.Go(func() error {
+		<-ctx.Done()
+
+		purgeWorker.Stop()
+		return nil
+	})
+
+	policyWorker := worker.NewPolicyWorker(policyWorkerPingInterval, cfg, logger, store)
+
+	workers.Add(1)
+	eg.Go(func() error {
+		defer workers.Done()
+		policyWorker.LookUp()
+		return nil
+	})
+
+	eg.Go(func() error {
+		<-ctx.Done()
+
+		policyWorker.Stop()
+		return nil
+	})
+
+	healthWorker := worker.NewHealthWorker(
+		healthWorkerPingInterval,
+		cfg.HealthCheckInterval,
+		service.NewHealthChecker(cfg),
+		logger,
+		store,
+	)
+
+	workers.Add(1)
+	eg.Go(func() error {
+		defer workers.Done()
+		healthWorker.LookUp()
+		return nil
+	})
+
+	eg.Go(func() error {
+		<-ctx.Done()
+
+		healthWorker.Stop()
+		return nil
+	})
+
+	keyWorker := worker.NewKeyWorker(keyWorkerPingInterval, cfg, logger, store)
+
+	workers.Add(1)
+	eg.Go(func() error {
+		defer workers.Done()
+		keyWorker.LookUp()
+		return nil
+	})
+
+	eg.Go(func() error {
+		<-ctx.Done()
+
+		keyWorker.Stop()
+		return nil
+	})
+
+	clickWorker := worker.NewClickWorker(cfg.ClickFlushInterval, cfg.ClickBatchSize, cfg.Clicks, logger, store)
+
+	workers.Add(1)
+	eg.Go(func() error {
+		defer workers.Done()
+		clickWorker.LookUp()
+		return nil
+	})
+
+	eg.Go(func() error {
+		<-ctx.Done()
+
+		// Переходы записываются в буфер обработчиками, поэтому воркер останавливается после серверов.
+		servers.Wait()
+		clickWorker.Stop()
+		return nil
+	})
+
 	if err = eg.Wait(); err != nil {
 		return fmt.Errorf("errgroup error: %w", err)
 	}
@@ -6,7 +6,9 @@ import (
 	"github.com/Melikhov-p/url-minimise/internal/config"
 	"github.com/Melikhov-p/url-minimise/internal/handlers"
 	"github.com/Melikhov-p/url-minimise/internal/middlewares"
+	"github.com/Melikhov-p/url-minimise/internal/models"
 	"github.com/Melikhov-p/url-minimise/internal/repository"
+	"github.com/Melikhov-p/url-minimise/internal/tracing"
 	"github.com/go-chi/chi/v5"
 	chiMiddleware "github.com/go-chi/chi/v5/middleware"
 	"go.uber.org/zap"
@@ -21,31 +23,82 @@ func CreateRouter(cfg *config.Config, storage repository.Storage, logger *zap.Lo
 		Cfg:     cfg,
 	}
 	router.Use(
-		middleware.WithAuth,
+		middleware.WithTracing,
 		middleware.WithLogging,
 		middleware.GzipMiddleware,
+		middleware.WithCSRF,
 	)
 
-	// Маршруты pprof
-	router.Mount("/debug", chiMiddleware.Profiler())
+	// Обновление и завершение сессии принимают истёкший токен доступа, поэтому идут без аутентификации.
+	router.Post("/api/user/refresh", wrapper(handlers.APIRefresh, cfg, storage, logger))
+	router.Post("/api/user/logout", wrapper(handlers.APILogout, cfg, storage, logger))
+	// Открытые ключи подписи нужны другим сервисам для проверки токенов и не требуют аутентификации.
+	router.Get("/.well-known/jwks.json", wrapper(handlers.GetJWKS, cfg, storage, logger))
+	// Переход по короткой ссылке публичный: истёкший или отозванный токен в cookie не должен его ломать.
+	router.Get("/{id}", wrapper(handlers.GetFullURL, cfg, storage, logger))
+	router.Head("/{id}", wrapper(handlers.GetFullURL, cfg, storage, logger))
 
-	router.Get("/ping", wrapper(handlers.PingDatabase, cfg, storage, logger))
+	router.Group(func(r chi.Router) {
+		r.Use(middleware.WithAuth)
 
-	router.Post("/", wrapper(handlers.CreateShortURL, cfg, storage, logger))
+		// Маршруты pprof
+		r.Mount("/debug", chiMiddleware.Profiler())
 
-	router.Get("/{id}", wrapper(handlers.GetFullURL, cfg, storage, logger))
+		// Права ключей API: запросы с токеном сессии проходят без проверки.
+		create := middlewares.RequireScope(models.ScopeCreate)
+		read := middlewares.RequireScope(models.ScopeRead)
+		remove := middlewares.RequireScope(models.ScopeDelete)
+		stats := middlewares.RequireScope(models.ScopeStats)
 
-	router.Route("/api", func(r chi.Router) {
-		r.Route("/shorten", func(r chi.Router) {
-			r.Post("/", wrapper(handlers.APICreateShortURL, cfg, storage, logger))
-			r.Post("/batch", wrapper(handlers.APICreateBatchURLs, cfg, storage, logger))
-		})
-		r.Route("/user", func(r chi.Router) {
-			r.Get("/urls", wrapper(handlers.GetUserURLs, cfg, storage, logger))
-			r.Delete("/urls", wrapper(handlers.APIMarkAsDeletedURLs, cfg, storage, logger))
-		})
-		r.Route("/internal", func(r chi.Router) {
-			r.Get("/stats", wrapper(handlers.GetServiceStats, cfg, storage, logger))
+		r.Get("/ping", wrapper(handlers.PingDatabase, cfg, storage, logger))
+		r.Get("/metrics", wrapper(handlers.Metrics, cfg, storage, logger))
+
+		r.With(create).Post("/", wrapper(handlers.CreateShortURL, cfg, storage, logger))
+
+
+		r.Route("/api", func(r chi.Router) {
+			r.Route("/shorten", func(r chi.Router) {
+				r.Use(create)
+				r.Post("/", wrapper(handlers.APICreateShortURL, cfg, storage, logger))
+				r.Post("/batch", wrapper(handlers.APICreateBatchURLs, cfg, storage, logger))
+				r.Post("/batch/stream", wrapper(handlers.APICreateBatchURLsStream, cfg, storage, logger))
+			})
+			r.Route("/user", func(r chi.Router) {
+				r.Group(func(r chi.Router) {
+					r.Use(middlewares.RequireSession)
+					r.Post("/register", wrapper(handlers.APIRegister, cfg, storage, logger))
+					r.Post("/login", wrapper(handlers.APILogin, cfg, storage, logger))
+					r.Get("/oidc/login", wrapper(handlers.APIOIDCLogin, cfg, storage, logger))
+					r.Get("/oidc/callback", wrapper(handlers.APIOIDCCallback, cfg, storage, logger))
+					r.Get("/keys", wrapper(handlers.APIGetAPIKeys, cfg, storage, logger))
+					r.Post("/keys", wrapper(handlers.APICreateAPIKey, cfg, storage, logger))
+					r.Delete("/keys/{id}", wrapper(handlers.APIRevokeAPIKey, cfg, storage, logger))
+				})
+				r.With(read).Get("/urls", wrapper(handlers.GetUserURLs, cfg, storage, logger))
+				r.With(remove).Delete("/urls", wrapper(handlers.APIMarkAsDeletedURLs, cfg, storage, logger))
+				r.With(remove).Post("/urls/restore", wrapper(handlers.APIRestoreDeletedURLs, cfg, storage, logger))
+				r.With(read).Get("/urls/broken", wrapper(handlers.APIGetBrokenURLs, cfg, storage, logger))
+				r.With(create).Post("/urls/import", wrapper(handlers.APIImportURLs, cfg, storage, logger))
+				r.With(read).Get("/urls/export", wrapper(handlers.APIExportURLs, cfg, storage, logger))
+				r.With(create).Patch("/urls/{id}", wrapper(handlers.APIUpdateURLSettings, cfg, storage, logger))
+				r.With(read).Get("/urls/{id}/rules", wrapper(handlers.APIGetRedirectRules, cfg, storage, logger))
+				r.With(create).Put("/urls/{id}/rules", wrapper(handlers.APISetRedirectRules, cfg, storage, logger))
+				r.With(read).Get("/urls/{id}/variants", wrapper(handlers.APIGetVariants, cfg, storage, logger))
+				r.With(create).Put("/urls/{id}/variants", wrapper(handlers.APISetVariants, cfg, storage, logger))
+				r.With(stats).Get("/urls/{id}/stats", wrapper(handlers.APIGetLinkStats, cfg, storage, logger))
+				r.With(stats).Get("/urls/{id}/live", wrapper(handlers.APILiveClicks, cfg, storage, logger))
+				r.With(read).Get("/domains", wrapper(handlers.APIGetUserDomains, cfg, storage, logger))
+				r.With(create).Post("/domains", wrapper(handlers.APIRegisterDomain, cfg, storage, logger))
+			})
+			r.Route("/internal", func(r chi.Router) {
+				r.With(stats).Get("/stats", wrapper(handlers.GetServiceStats, cfg, storage, logger))
+				r.Group(func(r chi.Router) {
+					r.Use(middlewares.RequireSession)
+					r.Get("/keys", wrapper(handlers.APIGetSigningKeys, cfg, storage, logger))
+					r.Post("/keys/rotate", wrapper(handlers.APIRotateSigningKey, cfg, storage, logger))
+					r.Delete("/keys/{kid}", wrapper(handlers.APIRetireSigningKey, cfg, storage, logger))
+				})
+			})
 		})
 	})
 
@@ -63,6 +116,6 @@ func wrapper(
 	logger *zap.Logger,
 ) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		wrappedFunc(w, r, cfg, storage, logger)
+		wrappedFunc(w, r, cfg, storage, tracing.Logger(r.Context(), logger))
 	}
 }
@@ -1,22 +1,68 @@
 package app
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/Melikhov-p/url-minimise/internal/auth"
 	"github.com/Melikhov-p/url-minimise/internal/config"
 	"github.com/Melikhov-p/url-minimise/internal/logger"
+	"github.com/Melikhov-p/url-minimise/internal/models"
 	"github.com/Melikhov-p/url-minimise/internal/repository"
+	"github.com/Melikhov-p/url-minimise/internal/service"
 	"github.com/go-chi/chi/v5"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestCreateRouter(t *testing.T) {
 	log, err := logger.BuildLogger("DEBUG")
 	assert.NoError(t, err)
 	cfg := config.NewConfig(log, true)
+	cfg.Storage.FileStorage.FilePath = filepath.Join(t.TempDir(), "storage.txt")
 	store, err := repository.NewStorage(cfg, log)
 	assert.NoError(t, err)
 
 	r := CreateRouter(cfg, store, log)
 	assert.IsType(t, chi.NewRouter(), r)
 }
+
+func TestCreateRouter_RedirectWithRevokedToken(t *testing.T) {
+	log, err := logger.BuildLogger("ERROR")
+	require.NoError(t, err)
+	cfg := config.NewConfig(log, true)
+	cfg.Storage.FileStorage.FilePath = filepath.Join(t.TempDir(), "storage.txt")
+	store, err := repository.NewStorage(cfg, log)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	_, err = store.AddURL(ctx, &models.StorageURL{ShortURL: "promo", OriginalURL: "https://example.com/promo", UserID: 7})
+	require.NoError(t, err)
+	revoked, err := auth.BuildJWTString(7, cfg.SigningKeys, time.Hour)
+	require.NoError(t, err)
+	require.NoError(t, service.Logout(ctx, store, cfg, revoked, ""))
+	expired, err := auth.BuildJWTString(7, cfg.SigningKeys, -time.Minute)
+	require.NoError(t, err)
+
+	r := CreateRouter(cfg, store, log)
+
+	// Переход по ссылке не требует аутентификации, поэтому устаревшая cookie не даёт 401.
+	for name, token := range map[string]string{"revoked": revoked, "expired": expired, "invalid": "token"} {
+		for _, method := range []string{http.MethodGet, http.MethodHead} {
+			t.Run(name+" "+method, func(t *testing.T) {
+				req := httptest.NewRequest(method, "/promo", http.NoBody)
+				req.AddCookie(&http.Cookie{Name: "Token", Value: token})
+				w := httptest.NewRecorder()
+
+				r.ServeHTTP(w, req)
+
+				assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+				assert.Equal(t, "https://example.com/promo", w.Header().Get("Location"))
+			})
+		}
+	}
+}
@@ -2,29 +2,68 @@ package auth
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
 )
 
+// ErrTokenExpired срок действия токена истёк. Токен доступа можно обновить токеном обновления.
+var ErrTokenExpired = errors.New("token expired")
+
+// ErrInvalidToken токен повреждён или подписан другим ключом.
+var ErrInvalidToken = errors.New("invalid token")
+
 type claims struct {
 	jwt.RegisteredClaims
+	Email  string `json:",omitempty"`
+	UserID int
+}
+
+// Identity данные пользователя из токена доступа.
+type Identity struct {
+	ExpiresAt time.Time
+	// ID идентификатор токена (jti), по нему токен отзывается.
+	ID     string
+	Email  string
 	UserID int
 }
 
 // BuildJWTString строит JWT токен (string, error).
-func BuildJWTString(userID int, secretKey string, tokenLifeTime time.Duration) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims{
+func BuildJWTString(userID int, keys *Keyring, tokenLifeTime time.Duration) (string, error) {
+	return BuildAccountJWTString(userID, "", keys, tokenLifeTime)
+}
+
+// BuildAccountJWTString строит JWT токен пользователя, вошедшего в аккаунт с почтой email.
+// Пустая почта — анонимный пользователь. Каждый токен получает свой идентификатор jti
+// и подписывается самым новым ключом из keys, идентификатор ключа пишется в заголовок kid.
+func BuildAccountJWTString(userID int, email string, keys *Keyring, tokenLifeTime time.Duration) (string, error) {
+	key, err := keys.signingEntry()
+	if err != nil {
+		return "", err
+	}
+
+	jti, err := randomHex(tokenIDBytes)
+	if err != nil {
+		return "", fmt.Errorf("error generating token id %w", err)
+	}
+
+	token := jwt.NewWithClaims(key.method, claims{
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(tokenLifeTime)),
+			ID:        jti,
 		},
+		Email:  email,
 		UserID: userID,
 	})
+	token.Header["kid"] = key.key.ID
 
-	tokenString, err := token.SignedString([]byte(secretKey))
+	tokenString, err := token.SignedString(key.sign)
 	if err != nil {
 		return "", fmt.Errorf("error creating signed JWT %w", err)
 	}
@@ -32,27 +71,58 @@ func BuildJWTString(userID int, secretKey string, tokenLifeTime time.Duration) (
 	return tokenString, nil
 }
 
-// GetUserID получает ID пользователя из токена.
-func GetUserID(tokenString string, secretKey string) (int, error) {
+// GetUserID получает ID пользователя из токена. Токен проверяется ключом из keys по его kid.
+func GetUserID(tokenString string, keys *Keyring) (int, error) {
+	userID, _, err := GetIdentity(tokenString, keys)
+	return userID, err
+}
+
+// GetIdentity получает из токена ID пользователя и почту аккаунта, для анонимного пользователя почта пустая.
+func GetIdentity(tokenString string, keys *Keyring) (int, string, error) {
+	identity, err := ParseToken(tokenString, keys)
+	if err != nil {
+		return -1, "", err
+	}
+	return identity.UserID, identity.Email, nil
+}
+
+// ParseToken проверяет токен доступа ключом из keys с идентификатором kid из заголовка токена
+// и возвращает его данные. Истёкший токен отличается от повреждённого ошибкой ErrTokenExpired,
+// токен неизвестного или выведенного из оборота ключа считается недействительным, как и токен,
+// алгоритм которого не совпадает с алгоритмом ключа.
+func ParseToken(tokenString string, keys *Keyring) (*Identity, error) {
 	claims := &claims{}
 
 	token, err := jwt.ParseWithClaims(tokenString, claims,
 		func(t *jwt.Token) (interface{}, error) {
-			if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			kid, _ := t.Header["kid"].(string)
+			key, ok := keys.entry(kid)
+			if !ok {
+				return nil, fmt.Errorf("unknown signing key %q", kid)
+			}
+			// Алгоритм задаёт ключ, а не заголовок токена, иначе открытый ключ можно выдать за секрет HMAC.
+			if t.Method.Alg() != key.method.Alg() {
 				return nil, fmt.Errorf("unexpected singing method %v", t.Header["alg"])
 			}
-			return []byte(secretKey), nil
+			return key.verify, nil
 		})
 
 	if err != nil {
-		return -1, fmt.Errorf("error parsing tokenString %w", err)
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return nil, fmt.Errorf("error parsing tokenString %w", ErrTokenExpired)
+		}
+		return nil, fmt.Errorf("error parsing tokenString %w %w", ErrInvalidToken, err)
 	}
 
 	if !token.Valid {
-		return -1, errors.New("token invalid")
+		return nil, ErrInvalidToken
 	}
 
-	return claims.UserID, nil
+	identity := &Identity{ID: claims.ID, Email: claims.Email, UserID: claims.UserID}
+	if claims.ExpiresAt != nil {
+		identity.ExpiresAt = claims.ExpiresAt.Time
+	}
+	return identity, nil
 }
 
 // GenerateAuthKey генерирует ключ аутентификации.
@@ -65,3 +135,83 @@ func GenerateAuthKey() (string, error) {
 
 	return hex.EncodeToString(b), nil
 }
+
+// APIKeyPrefix начало каждого ключа API, по нему ключ отличается от токена сессии.
+const APIKeyPrefix = "shk_"
+
+// RefreshTokenPrefix начало каждого токена обновления.
+const RefreshTokenPrefix = "shr_"
+
+const (
+	tokenIDBytes  = 16
+	secretIDBytes = 8
+	secretBytes   = 32
+)
+
+// GenerateAPIKey создаёт ключ API вида shk_<id>_<secret>. Возвращает идентификатор ключа,
+// сам ключ, который отдаётся пользователю один раз, и хеш секретной части для хранения.
+func GenerateAPIKey() (id string, key string, hash string, err error) {
+	return generateSecret(APIKeyPrefix)
+}
+
+// ParseAPIKey разбирает ключ API на идентификатор и секретную часть.
+func ParseAPIKey(key string) (id string, secret string, ok bool) {
+	return parseSecret(APIKeyPrefix, key)
+}
+
+// GenerateRefreshToken создаёт токен обновления вида shr_<id>_<secret>. Возвращает идентификатор,
+// сам токен и хеш секретной части для хранения.
+func GenerateRefreshToken() (id string, token string, hash string, err error) {
+	return generateSecret(RefreshTokenPrefix)
+}
+
+// ParseRefreshToken разбирает токен обновления на идентификатор и секретную часть.
+func ParseRefreshToken(token string) (id string, secret string, ok bool) {
+	return parseSecret(RefreshTokenPrefix, token)
+}
+
+// generateSecret создаёт строку вида <prefix><id>_<secret> и хеш её секретной части.
+func generateSecret(prefix string) (id string, value string, hash string, err error) {
+	raw := make([]byte, secretIDBytes+secretBytes)
+	if _, err = rand.Read(raw); err != nil {
+		return "", "", "", fmt.Errorf("error generating secret %w", err)
+	}
+
+	id = hex.EncodeToString(raw[:secretIDBytes])
+	secret := hex.EncodeToString(raw[secretIDBytes:])
+	return id, prefix + id + "_" + secret, HashSecret(secret), nil
+}
+
+// parseSecret разбирает строку вида <prefix><id>_<secret>.
+func parseSecret(prefix string, value string) (id string, secret string, ok bool) {
+	rest, found := strings.CutPrefix(value, prefix)
+	if !found {
+		return "", "", false
+	}
+	id, secret, found = strings.Cut(rest, "_")
+	if !found || len(id) != 2*secretIDBytes || len(secret) != 2*secretBytes {
+		return "", "", false
+	}
+	return id, secret, true
+}
+
+// HashSecret хеш секретной части ключа API или токена обновления. Секрет случайный и длинный,
+// поэтому медленный хеш паролей не нужен.
+func HashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// CheckSecret сравнивает секрет с сохранённым хешем за постоянное время.
+func CheckSecret(secret string, hash string) bool {
+	return subtle.ConstantTimeCompare([]byte(HashSecret(secret)), []byte(hash)) == 1
+}
+
+// randomHex случайная строка из n байт в шестнадцатеричном виде.
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error getting rand.Read(): %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -1,48 +1,352 @@
 package auth
 
 import (
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/Melikhov-p/url-minimise/internal/models"
+	"github.com/golang-jwt/jwt/v4"
 	"github.com/stretchr/testify/assert"
 )
 
+// testKeyring набор из одного ключа test с секретом secret.
+func testKeyring(secret string) *Keyring {
+	return NewKeyring(&models.SigningKey{CreatedAt: time.Now(), ID: "test", Secret: secret})
+}
+
 func TestBuildJWTString(t *testing.T) {
 	userID := 123
-	secretKey := "mysecretkey"
+	keys := testKeyring("mysecretkey")
 	tokenLifeTime := time.Hour
 
-	tokenString, err := BuildJWTString(userID, secretKey, tokenLifeTime)
+	tokenString, err := BuildJWTString(userID, keys, tokenLifeTime)
 
 	assert.NoError(t, err, "Expected no error when building JWT string")
 	assert.NotEmpty(t, tokenString, "Expected non-empty token string")
 
 	// Проверяем, что токен можно распарсить и получить из него userID
-	parsedUserID, err := GetUserID(tokenString, secretKey)
+	parsedUserID, err := GetUserID(tokenString, keys)
 	assert.NoError(t, err, "Expected no error when parsing JWT string")
 	assert.Equal(t, userID, parsedUserID, "Expected user ID to match")
 }
 
 func TestGetUserID(t *testing.T) {
 	userID := 456
-	secretKey := "mysecretkey"
+	keys := testKeyring("mysecretkey")
 	tokenLifeTime := time.Hour
 
-	tokenString, err := BuildJWTString(userID, secretKey, tokenLifeTime)
+	tokenString, err := BuildJWTString(userID, keys, tokenLifeTime)
 	assert.NoError(t, err, "Expected no error when building JWT string")
 
-	parsedUserID, err := GetUserID(tokenString, secretKey)
+	parsedUserID, err := GetUserID(tokenString, keys)
 	assert.NoError(t, err, "Expected no error when parsing JWT string")
 	assert.Equal(t, userID, parsedUserID, "Expected user ID to match")
 
 	// Проверка с неверным ключом
-	_, err = GetUserID(tokenString, "wrongkey")
+	_, err = GetUserID(tokenString, testKeyring("wrongkey"))
 	assert.Error(t, err, "Expected error when parsing JWT string with wrong key")
 }
 
+func TestGetIdentity(t *testing.T) {
+	keys := testKeyring("mysecretkey")
+
+	tokenString, err := BuildAccountJWTString(7, "user@example.com", keys, time.Hour)
+	assert.NoError(t, err)
+
+	userID, email, err := GetIdentity(tokenString, keys)
+	assert.NoError(t, err)
+	assert.Equal(t, 7, userID)
+	assert.Equal(t, "user@example.com", email)
+
+	// Анонимный токен не содержит почты
+	tokenString, err = BuildJWTString(8, keys, time.Hour)
+	assert.NoError(t, err)
+	userID, email, err = GetIdentity(tokenString, keys)
+	assert.NoError(t, err)
+	assert.Equal(t, 8, userID)
+	assert.Empty(t, email)
+}
+
+func TestParseToken(t *testing.T) {
+	keys := testKeyring("mysecretkey")
+
+	first, err := BuildJWTString(7, keys, time.Hour)
+	assert.NoError(t, err)
+	second, err := BuildJWTString(7, keys, time.Hour)
+	assert.NoError(t, err)
+
+	identity, err := ParseToken(first, keys)
+	assert.NoError(t, err)
+	assert.Equal(t, 7, identity.UserID)
+	assert.Len(t, identity.ID, 2*tokenIDBytes)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), identity.ExpiresAt, time.Minute)
+
+	// У каждого токена свой jti, чтобы отзывать токены по отдельности.
+	other, err := ParseToken(second, keys)
+	assert.NoError(t, err)
+	assert.NotEqual(t, identity.ID, other.ID)
+
+	expired, err := BuildJWTString(7, keys, -time.Minute)
+	assert.NoError(t, err)
+	_, err = ParseToken(expired, keys)
+	assert.ErrorIs(t, err, ErrTokenExpired)
+	assert.NotErrorIs(t, err, ErrInvalidToken)
+
+	for _, invalid := range []string{"", "token", first + "x"} {
+		_, err = ParseToken(invalid, keys)
+		assert.ErrorIs(t, err, ErrInvalidToken, invalid)
+	}
+	_, err = ParseToken(first, testKeyring("wrongkey"))
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestGenerateAPIKey(t *testing.T) {
+	id, key, hash, err := GenerateAPIKey()
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(key, APIKeyPrefix+id+"_"))
+
+	parsedID, secret, ok := ParseAPIKey(key)
+	assert.True(t, ok)
+	assert.Equal(t, id, parsedID)
+	assert.True(t, CheckSecret(secret, hash))
+	assert.False(t, CheckSecret(secret+"0", hash))
+
+	invalidKeys := []string{"", "token", APIKeyPrefix + id, APIKeyPrefix + id + "_short", strings.TrimPrefix(key, "shk_")}
+	for _, invalid := range invalidKeys {
+		_, _, ok = ParseAPIKey(invalid)
+		assert.False(t, ok, invalid)
+	}
+}
+
 func TestGenerateAuthKey(t *testing.T) {
 	key, err := GenerateAuthKey()
 
 	assert.NoError(t, err, "Expected no error when generating auth key")
 	assert.Len(t, key, 32, "Expected auth key to be 32 characters long")
 }
+
+func TestGenerateRefreshToken(t *testing.T) {
+	id, token, hash, err := GenerateRefreshToken()
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(token, RefreshTokenPrefix))
+
+	parsedID, secret, ok := ParseRefreshToken(token)
+	assert.True(t, ok)
+	assert.Equal(t, id, parsedID)
+	assert.True(t, CheckSecret(secret, hash))
+
+	// Ключ API не принимается за токен обновления.
+	_, apiKey, _, err := GenerateAPIKey()
+	assert.NoError(t, err)
+	_, _, ok = ParseRefreshToken(apiKey)
+	assert.False(t, ok)
+}
+
+func TestCookieOptions(t *testing.T) {
+	sameSite, err := ParseSameSite("Strict")
+	assert.NoError(t, err)
+	assert.Equal(t, http.SameSiteStrictMode, sameSite)
+	_, err = ParseSameSite("always")
+	assert.ErrorIs(t, err, ErrUnknownSameSite)
+
+	options := DefaultCookieOptions()
+	cookie := options.Cookie(AccessCookie, "token", time.Minute)
+	assert.Equal(t, "/", cookie.Path)
+	assert.True(t, cookie.HttpOnly)
+	assert.False(t, cookie.Secure)
+	assert.Equal(t, 60, cookie.MaxAge)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), cookie.Expires, time.Second)
+
+	// Браузер не примет cookie с SameSite=None без Secure.
+	options.SameSite = http.SameSiteNoneMode
+	cookie = options.WithPath("/api/user").Expired(RefreshCookie)
+	assert.True(t, cookie.Secure)
+	assert.Equal(t, "/api/user", cookie.Path)
+	assert.Equal(t, -1, cookie.MaxAge)
+}
+
+func TestAccessToken(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	assert.Empty(t, AccessToken(req))
+
+	req.AddCookie(&http.Cookie{Name: AccessCookie, Value: "cookie"})
+	assert.Equal(t, "cookie", AccessToken(req))
+
+	req.Header.Set("Authorization", "Bearer header")
+	assert.Equal(t, "header", AccessToken(req))
+
+	req.Header.Set("Authorization", "Basic header")
+	_, found, ok := BearerToken(req)
+	assert.True(t, found)
+	assert.False(t, ok)
+
+	assert.True(t, CheckCSRFToken("csrf", "csrf"))
+	assert.False(t, CheckCSRFToken("", ""))
+	assert.False(t, CheckCSRFToken("other", "csrf"))
+}
+
+func TestKeyring(t *testing.T) {
+	now := time.Now()
+	legacy := &models.SigningKey{CreatedAt: now.Add(-2 * time.Hour), ID: LegacyKeyID, Secret: "legacy"}
+	old, err := NewSigningKey(AlgHS256)
+	assert.NoError(t, err)
+	old.CreatedAt = now.Add(-time.Hour)
+	keys := NewKeyring(legacy, old)
+
+	signing, err := keys.Signing()
+	assert.NoError(t, err)
+	assert.Equal(t, old.ID, signing.ID)
+
+	oldToken, err := BuildJWTString(7, keys, time.Hour)
+	assert.NoError(t, err)
+
+	// Токен без kid, выпущенный до ротации ключей, проверяется ключом legacy.
+	legacyToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims{UserID: 8}).SignedString([]byte("legacy"))
+	assert.NoError(t, err)
+	userID, err := GetUserID(legacyToken, keys)
+	assert.NoError(t, err)
+	assert.Equal(t, 8, userID)
+
+	// После ротации новый ключ подписывает, а токены прежнего ключа по-прежнему принимаются.
+	next, err := NewSigningKey(AlgHS256)
+	assert.NoError(t, err)
+	assert.NoError(t, keys.Set([]*models.SigningKey{legacy, old, next}))
+	newToken, err := BuildJWTString(9, keys, time.Hour)
+	assert.NoError(t, err)
+
+	token, _, err := jwt.NewParser().ParseUnverified(newToken, &claims{})
+	assert.NoError(t, err)
+	assert.Equal(t, next.ID, token.Header["kid"])
+	userID, err = GetUserID(oldToken, keys)
+	assert.NoError(t, err)
+	assert.Equal(t, 7, userID)
+
+	// Токены выведенного из оборота ключа не принимаются.
+	retiredAt := now
+	retired := *old
+	retired.RetiredAt = &retiredAt
+	assert.NoError(t, keys.Set([]*models.SigningKey{legacy, &retired, next}))
+	_, err = GetUserID(oldToken, keys)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	userID, err = GetUserID(newToken, keys)
+	assert.NoError(t, err)
+	assert.Equal(t, 9, userID)
+
+	assert.NoError(t, keys.Set(nil))
+	_, err = BuildJWTString(9, keys, time.Hour)
+	assert.ErrorIs(t, err, ErrNoSigningKey)
+}
+
+func TestKeyring_ReloadUnknownKey(t *testing.T) {
+	first, err := NewSigningKey(AlgHS256)
+	assert.NoError(t, err)
+	keys := NewKeyring(first)
+
+	// Другой инстанс выпустил ключ и подписал им токен, а этот ещё не перечитал ключи.
+	second, err := NewSigningKey(AlgHS256)
+	assert.NoError(t, err)
+	second.CreatedAt = first.CreatedAt.Add(time.Minute)
+	token, err := BuildJWTString(5, NewKeyring(second), time.Hour)
+	assert.NoError(t, err)
+
+	var loads int
+	keys.SetLoader(func() ([]*models.SigningKey, error) {
+		loads++
+		return []*models.SigningKey{first, second}, nil
+	})
+
+	userID, err := GetUserID(token, keys)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, userID)
+	assert.Equal(t, 1, loads)
+
+	// Токены с выдуманным kid перечитывают ключи не чаще раза в keyringReloadInterval.
+	forged, err := BuildJWTString(6, NewKeyring(&models.SigningKey{ID: "forged", Secret: "forged"}), time.Hour)
+	assert.NoError(t, err)
+	for range 3 {
+		_, err = GetUserID(forged, keys)
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	}
+	assert.Equal(t, 1, loads)
+
+	keys.loadedAt = time.Now().Add(-keyringReloadInterval)
+	_, err = GetUserID(forged, keys)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	assert.Equal(t, 2, loads)
+}
+
+func TestKeyring_Asymmetric(t *testing.T) {
+	for _, alg := range []string{AlgRS256, AlgEdDSA} {
+		t.Run(alg, func(t *testing.T) {
+			key, err := NewSigningKey(alg)
+			assert.NoError(t, err)
+			hmacKey, err := NewSigningKey(AlgHS256)
+			assert.NoError(t, err)
+			hmacKey.CreatedAt = key.CreatedAt.Add(-time.Hour)
+			keys := NewKeyring(hmacKey, key)
+
+			tokenString, err := BuildJWTString(5, keys, time.Hour)
+			assert.NoError(t, err)
+			userID, err := GetUserID(tokenString, keys)
+			assert.NoError(t, err)
+			assert.Equal(t, 5, userID)
+
+			// Открытый ключ из JWKS проверяет токен без общего секрета, ключ HS256 не публикуется.
+			set := keys.JWKS()
+			assert.Len(t, set.Keys, 1)
+			jwk, ok := set.Key(key.ID)
+			assert.True(t, ok)
+			assert.Equal(t, alg, jwk.Algorithm)
+			public, err := jwk.PublicKey()
+			assert.NoError(t, err)
+			token, err := jwt.ParseWithClaims(tokenString, &claims{}, func(*jwt.Token) (any, error) {
+				return public, nil
+			}, jwt.WithValidMethods([]string{alg}))
+			assert.NoError(t, err)
+			assert.Equal(t, 5, token.Claims.(*claims).UserID)
+
+			// Открытый ключ нельзя подсунуть как секрет HS256 под тем же kid.
+			forged := jwt.NewWithClaims(jwt.SigningMethodHS256, claims{UserID: 6})
+			forged.Header["kid"] = key.ID
+			forgedString, err := forged.SignedString([]byte(jwk.N + jwk.X))
+			assert.NoError(t, err)
+			_, err = GetUserID(forgedString, keys)
+			assert.ErrorIs(t, err, ErrInvalidToken)
+		})
+	}
+}
+
+func TestSigningKeyFromPEM(t *testing.T) {
+	for _, alg := range []string{AlgRS256, AlgEdDSA} {
+		t.Run(alg, func(t *testing.T) {
+			generated, err := NewSigningKey(alg)
+			assert.NoError(t, err)
+
+			key, err := SigningKeyFromPEM([]byte(generated.Secret))
+			assert.NoError(t, err)
+			assert.Equal(t, alg, key.Algorithm)
+			assert.Len(t, key.ID, 2*keyIDBytes)
+
+			// Идентификатор — отпечаток открытого ключа, поэтому тот же файл даёт тот же kid.
+			again, err := SigningKeyFromPEM([]byte(generated.Secret))
+			assert.NoError(t, err)
+			assert.Equal(t, key.ID, again.ID)
+
+			jwk, ok := NewKeyring(key).JWKS().Key(key.ID)
+			assert.True(t, ok)
+			thumbprint, err := jwk.Thumbprint()
+			assert.NoError(t, err)
+			assert.Equal(t, key.ID, hex.EncodeToString(thumbprint[:keyIDBytes]))
+		})
+	}
+
+	_, err := SigningKeyFromPEM([]byte("not a key"))
+	assert.Error(t, err)
+
+	_, err = ParseAlgorithm("none")
+	assert.ErrorIs(t, err, ErrUnknownAlgorithm)
+}
@@ -0,0 +1,126 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// AccessCookie cookie с токеном доступа.
+	AccessCookie = "Token"
+	// RefreshCookie cookie с токеном обновления.
+	RefreshCookie = "RefreshToken"
+	// CSRFCookie cookie с токеном CSRF. Скрипты страницы читают его и повторяют в заголовке CSRFHeader.
+	CSRFCookie = "CSRFToken"
+	// CSRFHeader заголовок, в котором клиент подтверждает запрос, изменяющий данные.
+	CSRFHeader = "X-CSRF-Token"
+)
+
+// csrfTokenBytes длина случайной части токена CSRF.
+const csrfTokenBytes = 32
+
+// ErrUnknownSameSite неизвестный режим SameSite.
+var ErrUnknownSameSite = errors.New("unknown samesite mode")
+
+// CookieOptions атрибуты cookie, в которых сервер отдаёт токены.
+type CookieOptions struct {
+	Domain   string
+	Path     string
+	SameSite http.SameSite
+	Secure   bool
+	HTTPOnly bool
+}
+
+// DefaultCookieOptions атрибуты по умолчанию: cookie на весь сайт, недоступна скриптам
+// и не уходит с запросами, изменяющими данные, с чужих сайтов.
+func DefaultCookieOptions() CookieOptions {
+	return CookieOptions{Path: "/", SameSite: http.SameSiteLaxMode, HTTPOnly: true}
+}
+
+// ParseSameSite разбирает режим SameSite: lax, strict или none.
+func ParseSameSite(mode string) (http.SameSite, error) {
+	switch strings.ToLower(strings.TrimSpace(mode)) {
+	case "lax":
+		return http.SameSiteLaxMode, nil
+	case "strict":
+		return http.SameSiteStrictMode, nil
+	case "none":
+		return http.SameSiteNoneMode, nil
+	default:
+		return http.SameSiteDefaultMode, fmt.Errorf("%w %q", ErrUnknownSameSite, mode)
+	}
+}
+
+// Cookie cookie name со значением value, которая истекает через lifetime вместе с токеном.
+// Срок задаётся и Max-Age, и Expires для браузеров, которые не знают Max-Age.
+func (o CookieOptions) Cookie(name string, value string, lifetime time.Duration) *http.Cookie {
+	cookie := o.base(name)
+	cookie.Value = value
+	cookie.MaxAge = int(lifetime.Seconds())
+	cookie.Expires = time.Now().Add(lifetime).UTC()
+	return cookie
+}
+
+// Expired cookie, которая удаляет у клиента cookie name.
+func (o CookieOptions) Expired(name string) *http.Cookie {
+	cookie := o.base(name)
+	cookie.MaxAge = -1
+	cookie.Expires = time.Unix(0, 0).UTC()
+	return cookie
+}
+
+// WithPath те же атрибуты с другим путём, например для cookie, нужной только части обработчиков.
+func (o CookieOptions) WithPath(path string) CookieOptions {
+	o.Path = path
+	return o
+}
+
+// base cookie name с атрибутами без значения и срока.
+func (o CookieOptions) base(name string) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Domain:   o.Domain,
+		Path:     o.Path,
+		SameSite: o.SameSite,
+		// Браузеры отбрасывают cookie с SameSite=None без Secure.
+		Secure:   o.Secure || o.SameSite == http.SameSiteNoneMode,
+		HttpOnly: o.HTTPOnly,
+	}
+}
+
+// BearerToken токен из заголовка Authorization. found false, если заголовка нет;
+// ok false, если заголовок есть, но схема не Bearer или токен пустой.
+func BearerToken(r *http.Request) (token string, found bool, ok bool) {
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		return "", false, false
+	}
+	token, ok = strings.CutPrefix(header, "Bearer ")
+	token = strings.TrimSpace(token)
+	return token, true, ok && token != ""
+}
+
+// AccessToken токен доступа запроса: из заголовка Authorization: Bearer, а без заголовка — из cookie.
+func AccessToken(r *http.Request) string {
+	if token, found, _ := BearerToken(r); found {
+		return token
+	}
+	if cookie, err := r.Cookie(AccessCookie); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
+
+// GenerateCSRFToken создаёт случайный токен CSRF.
+func GenerateCSRFToken() (string, error) {
+	return randomHex(csrfTokenBytes)
+}
+
+// CheckCSRFToken сравнивает токен CSRF из заголовка с токеном из cookie за постоянное время.
+func CheckCSRFToken(header string, cookie string) bool {
+	return cookie != "" && subtle.ConstantTimeCompare([]byte(header), []byte(cookie)) == 1
+}
@@ -0,0 +1,256 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/Melikhov-p/url-minimise/internal/models"
+)
+
+// Алгоритмы подписи токенов доступа.
+const (
+	// AlgHS256 HMAC с общим секретом, токен может проверить только сам сервис.
+	AlgHS256 = "HS256"
+	// AlgRS256 RSA, открытый ключ публикуется в JWKS.
+	AlgRS256 = "RS256"
+	// AlgEdDSA Ed25519, открытый ключ публикуется в JWKS.
+	AlgEdDSA = "EdDSA"
+)
+
+// ErrUnknownAlgorithm алгоритм подписи не поддерживается.
+var ErrUnknownAlgorithm = errors.New("unknown signing algorithm")
+
+const rsaKeyBits = 2048
+
+// ParseAlgorithm проверяет название алгоритма подписи.
+func ParseAlgorithm(alg string) (string, error) {
+	switch alg {
+	case AlgHS256, AlgRS256, AlgEdDSA:
+		return alg, nil
+	}
+	return "", fmt.Errorf("%w %q", ErrUnknownAlgorithm, alg)
+}
+
+// SigningKeyFromPEM ключ подписи из закрытого ключа RSA или Ed25519 в PEM. Алгоритм определяется
+// по типу ключа, а идентификатор — по отпечатку открытого ключа (RFC 7638), поэтому один и тот же
+// файл всегда даёт один и тот же kid.
+func SigningKeyFromPEM(data []byte) (*models.SigningKey, error) {
+	private, alg, err := ParsePrivateKeyPEM(data)
+	if err != nil {
+		return nil, err
+	}
+
+	jwk, ok := publicJWK(private.Public(), alg)
+	if !ok {
+		return nil, fmt.Errorf("%w for %T", ErrUnknownAlgorithm, private)
+	}
+	thumbprint, err := jwk.Thumbprint()
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.SigningKey{
+		CreatedAt: time.Now(),
+		ID:        hex.EncodeToString(thumbprint[:keyIDBytes]),
+		Algorithm: alg,
+		Secret:    string(data),
+	}, nil
+}
+
+// ParsePrivateKeyPEM разбирает закрытый ключ RSA (PKCS #1 или PKCS #8) или Ed25519 (PKCS #8)
+// и возвращает его вместе с алгоритмом подписи.
+func ParsePrivateKeyPEM(data []byte) (crypto.Signer, string, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, "", errors.New("no PEM block found")
+	}
+
+	var (
+		key any
+		err error
+	)
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, "", fmt.Errorf("unexpected PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("error parsing private key %w", err)
+	}
+
+	switch private := key.(type) {
+	case *rsa.PrivateKey:
+		return private, AlgRS256, nil
+	case ed25519.PrivateKey:
+		return private, AlgEdDSA, nil
+	}
+	return nil, "", fmt.Errorf("%w for %T", ErrUnknownAlgorithm, key)
+}
+
+// generatePrivateKeyPEM создаёт закрытый ключ алгоритма alg в PEM (PKCS #8).
+func generatePrivateKeyPEM(alg string) (string, error) {
+	var (
+		key any
+		err error
+	)
+	switch alg {
+	case AlgRS256:
+		key, err = rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	case AlgEdDSA:
+		_, key, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return "", fmt.Errorf("%w %q", ErrUnknownAlgorithm, alg)
+	}
+	if err != nil {
+		return "", fmt.Errorf("error generating private key %w", err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return "", fmt.Errorf("error marshaling private key %w", err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})), nil
+}
+
+// JWKS набор открытых ключей (RFC 7517), которым другие сервисы проверяют токены.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// Key открытый ключ с идентификатором kid.
+func (s JWKS) Key(kid string) (JWK, bool) {
+	for _, key := range s.Keys {
+		if key.ID == kid {
+			return key, true
+		}
+	}
+	return JWK{}, false
+}
+
+// JWK открытый ключ RSA (kty RSA) или Ed25519 (kty OKP).
+type JWK struct {
+	Type      string `json:"kty"`
+	ID        string `json:"kid"`
+	Use       string `json:"use,omitempty"`
+	Algorithm string `json:"alg,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+}
+
+// PublicKey открытый ключ: *rsa.PublicKey или ed25519.PublicKey.
+func (k JWK) PublicKey() (crypto.PublicKey, error) {
+	switch k.Type {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding jwk modulus %w", err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding jwk exponent %w", err)
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() > 1<<31-1 {
+			return nil, errors.New("jwk exponent is too large")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+	case "OKP":
+		if k.Curve != "Ed25519" {
+			return nil, fmt.Errorf("%w curve %q", ErrUnknownAlgorithm, k.Curve)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding jwk key %w", err)
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("jwk key has wrong size")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("%w key type %q", ErrUnknownAlgorithm, k.Type)
+}
+
+// Thumbprint отпечаток открытого ключа по RFC 7638: SHA-256 от обязательных полей ключа.
+func (k JWK) Thumbprint() ([sha256.Size]byte, error) {
+	var fields any
+	switch k.Type {
+	case "RSA":
+		fields = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{E: k.E, Kty: k.Type, N: k.N}
+	case "OKP":
+		fields = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{Crv: k.Curve, Kty: k.Type, X: k.X}
+	default:
+		return [sha256.Size]byte{}, fmt.Errorf("%w key type %q", ErrUnknownAlgorithm, k.Type)
+	}
+
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return [sha256.Size]byte{}, fmt.Errorf("error marshaling jwk thumbprint %w", err)
+	}
+	return sha256.Sum256(data), nil
+}
+
+// newJWK открытый ключ действующего ключа подписи. У ключей HS256 открытого ключа нет.
+func newJWK(entry *keyringEntry) (JWK, bool) {
+	jwk, ok := publicJWK(entry.verify, entry.method.Alg())
+	if !ok {
+		return JWK{}, false
+	}
+	jwk.ID = entry.key.ID
+	return jwk, true
+}
+
+// publicJWK открытый ключ RSA или Ed25519 в виде JWK без идентификатора.
+func publicJWK(public any, alg string) (JWK, bool) {
+	switch key := public.(type) {
+	case *rsa.PublicKey:
+		return JWK{
+			Type:      "RSA",
+			Use:       "sig",
+			Algorithm: alg,
+			N:         base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:         base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}, true
+	case ed25519.PublicKey:
+		return JWK{
+			Type:      "OKP",
+			Use:       "sig",
+			Algorithm: alg,
+			Curve:     "Ed25519",
+			X:         base64.RawURLEncoding.EncodeToString(key),
+		}, true
+	}
+	return JWK{}, false
+}
+
+// sortJWKs упорядочивает ключи по идентификатору, чтобы ответ не зависел от порядка обхода.
+func sortJWKs(keys []JWK) {
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].ID < keys[j].ID
+	})
+}
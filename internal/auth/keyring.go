@@ -0,0 +1,225 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Melikhov-p/url-minimise/internal/models"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// ErrNoSigningKey нет действующего ключа, которым можно подписать токен.
+var ErrNoSigningKey = errors.New("no signing key")
+
+// LegacyKeyID идентификатор ключа, которым проверяются токены без kid,
+// выпущенные до появления нескольких ключей подписи.
+const LegacyKeyID = "legacy"
+
+const (
+	keyIDBytes      = 8
+	signingKeyBytes = 32
+)
+
+// keyringReloadInterval как часто токен с неизвестным kid может перечитать ключи из хранилища.
+// Без ограничения поток токенов с выдуманным kid превратился бы в поток запросов к хранилищу.
+const keyringReloadInterval = 10 * time.Second
+
+// NewSigningKey создаёт новый ключ подписи алгоритма alg со случайным идентификатором.
+// Для HS256 секретом ключа служит случайная строка, для RS256 и EdDSA — закрытый ключ в PEM.
+func NewSigningKey(alg string) (*models.SigningKey, error) {
+	kid, err := randomHex(keyIDBytes)
+	if err != nil {
+		return nil, fmt.Errorf("error generating signing key id %w", err)
+	}
+
+	var secret string
+	if alg == AlgHS256 {
+		secret, err = randomHex(signingKeyBytes)
+	} else {
+		secret, err = generatePrivateKeyPEM(alg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error generating signing key %w", err)
+	}
+
+	return &models.SigningKey{CreatedAt: time.Now(), ID: kid, Algorithm: alg, Secret: secret}, nil
+}
+
+// KeyLoader читает ключи подписи из хранилища.
+type KeyLoader func() ([]*models.SigningKey, error)
+
+// Keyring действующие ключи подписи токенов. Ключи меняются на ходу при ротации,
+// поэтому доступ к ним защищён мьютексом. Выведенные из оборота ключи в набор не попадают.
+type Keyring struct {
+	loadedAt time.Time
+	keys     map[string]*keyringEntry
+	signing  *keyringEntry
+	load     KeyLoader
+	mu       sync.RWMutex
+	loadMu   sync.Mutex // не даёт нескольким токенам с неизвестным kid перечитывать ключи одновременно
+}
+
+// keyringEntry ключ подписи с разобранными ключами алгоритма, чтобы не разбирать PEM на каждый токен.
+type keyringEntry struct {
+	key    *models.SigningKey
+	method jwt.SigningMethod
+	sign   any
+	verify any
+}
+
+// NewKeyring возвращает набор ключей keys. Ключи, которые не удалось разобрать, пропускаются.
+func NewKeyring(keys ...*models.SigningKey) *Keyring {
+	k := &Keyring{}
+	_ = k.Set(keys)
+	return k
+}
+
+// Set заменить набор ключей. Подписывать токены будет самый новый действующий ключ.
+// Если какой-то ключ не удалось разобрать, он пропускается, а ошибка возвращается.
+func (k *Keyring) Set(keys []*models.SigningKey) error {
+	active := make(map[string]*keyringEntry, len(keys))
+	var (
+		signing *keyringEntry
+		errs    []error
+	)
+	for _, key := range keys {
+		if key.Retired() {
+			continue
+		}
+		entry, err := newKeyringEntry(key)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("signing key %s %w", key.ID, err))
+			continue
+		}
+		active[key.ID] = entry
+		if signing == nil || key.CreatedAt.After(signing.key.CreatedAt) {
+			signing = entry
+		}
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.keys = active
+	k.signing = signing
+	return errors.Join(errs...)
+}
+
+// SetLoader задать, откуда перечитывать ключи, когда пришёл токен с неизвестным kid: другой инстанс
+// мог выпустить ключ после последней загрузки. Перечитывание не чаще раза в keyringReloadInterval.
+func (k *Keyring) SetLoader(load KeyLoader) {
+	k.loadMu.Lock()
+	defer k.loadMu.Unlock()
+	k.load = load
+}
+
+// Signing ключ, которым подписываются новые токены.
+func (k *Keyring) Signing() (*models.SigningKey, error) {
+	entry, err := k.signingEntry()
+	if err != nil {
+		return nil, err
+	}
+	return entry.key, nil
+}
+
+// Verifying действующий ключ с идентификатором kid, пустой kid — ключ LegacyKeyID.
+func (k *Keyring) Verifying(kid string) (*models.SigningKey, bool) {
+	entry, ok := k.entry(kid)
+	if !ok {
+		return nil, false
+	}
+	return entry.key, true
+}
+
+// JWKS открытые ключи действующих ключей RS256 и EdDSA. Ключи HS256 секретны и не публикуются.
+func (k *Keyring) JWKS() JWKS {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	set := JWKS{Keys: make([]JWK, 0, len(k.keys))}
+	for _, entry := range k.keys {
+		if jwk, ok := newJWK(entry); ok {
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+	sortJWKs(set.Keys)
+	return set
+}
+
+// signingEntry ключ, которым подписываются новые токены, вместе с разобранным ключом алгоритма.
+func (k *Keyring) signingEntry() (*keyringEntry, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	if k.signing == nil {
+		return nil, ErrNoSigningKey
+	}
+	return k.signing, nil
+}
+
+// entry действующий ключ с идентификатором kid вместе с разобранным ключом алгоритма.
+// Если ключа нет, набор перечитывается через загрузчик, но не чаще раза в keyringReloadInterval.
+func (k *Keyring) entry(kid string) (*keyringEntry, bool) {
+	if kid == "" {
+		kid = LegacyKeyID
+	}
+
+	if entry, ok := k.lookup(kid); ok {
+		return entry, true
+	}
+
+	k.loadMu.Lock()
+	defer k.loadMu.Unlock()
+
+	// Пока ждали, ключи мог перечитать другой запрос.
+	if entry, ok := k.lookup(kid); ok {
+		return entry, true
+	}
+	if k.load == nil || time.Since(k.loadedAt) < keyringReloadInterval {
+		return nil, false
+	}
+	k.loadedAt = time.Now()
+
+	keys, err := k.load()
+	if err != nil {
+		return nil, false
+	}
+	// Ключи, которые не удалось разобрать, пропускаются, остальные применяются.
+	_ = k.Set(keys)
+	return k.lookup(kid)
+}
+
+// lookup действующий ключ с идентификатором kid из текущего набора.
+func (k *Keyring) lookup(kid string) (*keyringEntry, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	entry, ok := k.keys[kid]
+	return entry, ok
+}
+
+// newKeyringEntry разбирает ключ подписи по его алгоритму. Ключ без алгоритма — HS256.
+func newKeyringEntry(key *models.SigningKey) (*keyringEntry, error) {
+	switch key.Algorithm {
+	case "", AlgHS256:
+		secret := []byte(key.Secret)
+		return &keyringEntry{key: key, method: jwt.SigningMethodHS256, sign: secret, verify: secret}, nil
+	case AlgRS256, AlgEdDSA:
+		private, alg, err := ParsePrivateKeyPEM([]byte(key.Secret))
+		if err != nil {
+			return nil, err
+		}
+		if alg != key.Algorithm {
+			return nil, fmt.Errorf("private key is %s, not %s", alg, key.Algorithm)
+		}
+		return &keyringEntry{
+			key:    key,
+			method: jwt.GetSigningMethod(alg),
+			sign:   private,
+			verify: private.Public(),
+		}, nil
+	}
+
+	return nil, fmt.Errorf("%w %q", ErrUnknownAlgorithm, key.Algorithm)
+}
@@ -0,0 +1,330 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// ErrOIDCRejected провайдер OpenID Connect не подтвердил вход: код авторизации не принят
+// или ID-токен не прошёл проверку.
+var ErrOIDCRejected = errors.New("oidc login rejected")
+
+// ErrOIDCUnavailable провайдер OpenID Connect недоступен или ответил не по протоколу.
+var ErrOIDCUnavailable = errors.New("oidc provider unavailable")
+
+const (
+	// OIDCScope права, которые запрашиваются у провайдера: ID-токен и почта пользователя.
+	OIDCScope = "openid email"
+
+	oidcTimeout = 10 * time.Second
+	// oidcKeysRefresh как часто можно перечитывать JWKS провайдера, встретив незнакомый kid.
+	oidcKeysRefresh = time.Minute
+	// oidcMaxResponse ограничение размера ответа провайдера.
+	oidcMaxResponse  = 1 << 20
+	oidcLoginBytes   = 32
+	oidcLoginParts   = 3
+	oidcDiscoveryURI = "/.well-known/openid-configuration"
+)
+
+// OIDCProvider вход через провайдера OpenID Connect по коду авторизации с PKCE (RFC 7636).
+// Настройки провайдера (discovery) и его открытые ключи читаются при первом входе и кешируются.
+type OIDCProvider struct {
+	Client       *http.Client
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	discovery    *oidcDiscovery
+	keysAt       time.Time
+	keys         JWKS
+	mu           sync.Mutex
+}
+
+// oidcDiscovery поля документа discovery провайдера, которые нужны для входа.
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// OIDCClaims данные пользователя из проверенного ID-токена.
+type OIDCClaims struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+}
+
+// idTokenClaims поля ID-токена, которые проверяются при входе.
+type idTokenClaims struct {
+	jwt.RegisteredClaims
+	Nonce           string `json:"nonce"`
+	AuthorizedParty string `json:"azp,omitempty"`
+	Email           string `json:"email"`
+	EmailVerified   bool   `json:"email_verified"`
+}
+
+// NewOIDCProvider клиент провайдера issuer для приложения clientID. clientSecret нужен только
+// конфиденциальным клиентам, публичные клиенты защищены одним PKCE.
+func NewOIDCProvider(issuer, clientID, clientSecret, redirectURL string) *OIDCProvider {
+	return &OIDCProvider{
+		Client:       &http.Client{Timeout: oidcTimeout},
+		Issuer:       issuer,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURL,
+	}
+}
+
+// OIDCLogin одноразовые значения одного входа: state защищает обратный вызов от подделки запроса,
+// nonce связывает ID-токен с этим входом, verifier — секрет PKCE, хеш которого уходит провайдеру.
+type OIDCLogin struct {
+	State    string
+	Nonce    string
+	Verifier string
+}
+
+// NewOIDCLogin создаёт случайные значения для нового входа.
+func NewOIDCLogin() (*OIDCLogin, error) {
+	values := make([]string, oidcLoginParts)
+	for i := range values {
+		b := make([]byte, oidcLoginBytes)
+		if _, err := rand.Read(b); err != nil {
+			return nil, fmt.Errorf("error generating oidc login %w", err)
+		}
+		values[i] = base64.RawURLEncoding.EncodeToString(b)
+	}
+	return &OIDCLogin{State: values[0], Nonce: values[1], Verifier: values[2]}, nil
+}
+
+// ParseOIDCLogin разбирает значения входа, сохранённые методом String.
+func ParseOIDCLogin(value string) (*OIDCLogin, bool) {
+	parts := strings.Split(value, ".")
+	if len(parts) != oidcLoginParts || slices.Contains(parts, "") {
+		return nil, false
+	}
+	return &OIDCLogin{State: parts[0], Nonce: parts[1], Verifier: parts[2]}, true
+}
+
+// String значения входа одной строкой, например, для cookie.
+func (l *OIDCLogin) String() string {
+	return l.State + "." + l.Nonce + "." + l.Verifier
+}
+
+// Challenge хеш verifier для провайдера, метод S256.
+func (l *OIDCLogin) Challenge() string {
+	sum := sha256.Sum256([]byte(l.Verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// CheckState сравнивает state из обратного вызова со state входа за постоянное время.
+func (l *OIDCLogin) CheckState(state string) bool {
+	return subtle.ConstantTimeCompare([]byte(l.State), []byte(state)) == 1
+}
+
+// AuthCodeURL адрес страницы входа провайдера, куда перенаправляется пользователь.
+func (p *OIDCProvider) AuthCodeURL(ctx context.Context, login *OIDCLogin) (string, error) {
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.ClientID},
+		"redirect_uri":          {p.RedirectURL},
+		"scope":                 {OIDCScope},
+		"state":                 {login.State},
+		"nonce":                 {login.Nonce},
+		"code_challenge":        {login.Challenge()},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return discovery.AuthorizationEndpoint + sep + query.Encode(), nil
+}
+
+// Exchange обменивает код авторизации на ID-токен и возвращает данные пользователя из проверенного токена.
+func (p *OIDCProvider) Exchange(ctx context.Context, code string, login *OIDCLogin) (*OIDCClaims, error) {
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.RedirectURL},
+		"client_id":     {p.ClientID},
+		"code_verifier": {login.Verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, discovery.TokenEndpoint,
+		strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("error building token request %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.ClientID), url.QueryEscape(p.ClientSecret))
+	}
+
+	var res struct {
+		IDToken string `json:"id_token"`
+	}
+	if err = p.do(req, &res, ErrOIDCRejected); err != nil {
+		return nil, err
+	}
+	if res.IDToken == "" {
+		return nil, fmt.Errorf("%w no id_token in token response", ErrOIDCUnavailable)
+	}
+
+	return p.VerifyIDToken(ctx, res.IDToken, login.Nonce)
+}
+
+// VerifyIDToken проверяет подпись ID-токена ключом из JWKS провайдера, издателя, получателя,
+// срок действия и nonce входа.
+func (p *OIDCProvider) VerifyIDToken(ctx context.Context, raw string, nonce string) (*OIDCClaims, error) {
+	claims := &idTokenClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		key, err := p.publicKey(ctx, kid)
+		if err != nil {
+			return nil, err
+		}
+		if key.Algorithm != "" && key.Algorithm != t.Method.Alg() {
+			return nil, fmt.Errorf("key %q is for %s, not %s", kid, key.Algorithm, t.Method.Alg())
+		}
+		return key.PublicKey()
+	}, jwt.WithValidMethods([]string{AlgRS256, AlgEdDSA}))
+	if err != nil {
+		if errors.Is(err, ErrOIDCUnavailable) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w %w", ErrOIDCRejected, err)
+	}
+
+	switch {
+	case claims.Issuer != p.Issuer:
+		return nil, fmt.Errorf("%w unexpected issuer %q", ErrOIDCRejected, claims.Issuer)
+	case !claims.VerifyAudience(p.ClientID, true):
+		return nil, fmt.Errorf("%w token is not for client %q", ErrOIDCRejected, p.ClientID)
+	case len(claims.Audience) > 1 && claims.AuthorizedParty != p.ClientID:
+		return nil, fmt.Errorf("%w unexpected authorized party %q", ErrOIDCRejected, claims.AuthorizedParty)
+	case claims.ExpiresAt == nil:
+		return nil, fmt.Errorf("%w token has no expiry", ErrOIDCRejected)
+	case claims.Subject == "":
+		return nil, fmt.Errorf("%w token has no subject", ErrOIDCRejected)
+	case subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1:
+		return nil, fmt.Errorf("%w nonce mismatch", ErrOIDCRejected)
+	}
+
+	return &OIDCClaims{Subject: claims.Subject, Email: claims.Email, EmailVerified: claims.EmailVerified}, nil
+}
+
+// discover читает документ discovery провайдера. Успешный ответ кешируется.
+func (p *OIDCProvider) discover(ctx context.Context) (*oidcDiscovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	var discovery oidcDiscovery
+	if err := p.getJSON(ctx, strings.TrimSuffix(p.Issuer, "/")+oidcDiscoveryURI, &discovery); err != nil {
+		return nil, err
+	}
+	if discovery.Issuer != p.Issuer {
+		return nil, fmt.Errorf("%w discovery issuer %q does not match %q", ErrOIDCUnavailable, discovery.Issuer, p.Issuer)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, fmt.Errorf("%w discovery document is incomplete", ErrOIDCUnavailable)
+	}
+
+	p.discovery = &discovery
+	return p.discovery, nil
+}
+
+// publicKey открытый ключ провайдера с идентификатором kid. Незнакомый kid значит, что провайдер
+// сменил ключи, поэтому JWKS перечитывается, но не чаще раза в oidcKeysRefresh.
+func (p *OIDCProvider) publicKey(ctx context.Context, kid string) (JWK, error) {
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return JWK{}, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.keys.Key(kid); ok {
+		return key, nil
+	}
+	if time.Since(p.keysAt) < oidcKeysRefresh {
+		return JWK{}, fmt.Errorf("unknown provider key %q", kid)
+	}
+
+	var keys JWKS
+	if err = p.getJSON(ctx, discovery.JWKSURI, &keys); err != nil {
+		return JWK{}, err
+	}
+	p.keys = keys
+	p.keysAt = time.Now()
+
+	if key, ok := p.keys.Key(kid); ok {
+		return key, nil
+	}
+	return JWK{}, fmt.Errorf("unknown provider key %q", kid)
+}
+
+// getJSON читает ответ провайдера на запрос GET.
+func (p *OIDCProvider) getJSON(ctx context.Context, target string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, http.NoBody)
+	if err != nil {
+		return fmt.Errorf("error building provider request %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	return p.do(req, v, ErrOIDCUnavailable)
+}
+
+// do выполняет запрос к провайдеру. Ответ 4xx оборачивается в clientErr: на обмен кода он значит,
+// что провайдер отказал во входе, а на чтение настроек и ключей — что провайдер настроен неверно.
+func (p *OIDCProvider) do(req *http.Request, v any, clientErr error) error {
+	res, err := p.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w %w", ErrOIDCUnavailable, err)
+	}
+	defer func() {
+		_ = res.Body.Close()
+	}()
+
+	body := io.LimitReader(res.Body, oidcMaxResponse)
+	if res.StatusCode >= http.StatusBadRequest && res.StatusCode < http.StatusInternalServerError {
+		data, _ := io.ReadAll(body)
+		return fmt.Errorf("%w %s %s", clientErr, res.Status, strings.TrimSpace(string(data)))
+	}
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w %s from %s", ErrOIDCUnavailable, res.Status, req.URL.Path)
+	}
+	if err = json.NewDecoder(body).Decode(v); err != nil {
+		return fmt.Errorf("%w error decoding response %w", ErrOIDCUnavailable, err)
+	}
+	return nil
+}
@@ -0,0 +1,255 @@
+// Package oidctest провайдер OpenID Connect для тестов входа через SSO. Провайдер работает
+// в процессе на httptest и сразу выдаёт код авторизации заданному пользователю, без формы входа.
+package oidctest
+
+import (
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Melikhov-p/url-minimise/internal/auth"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// ClientID приложение, для которого провайдер выдаёт ID-токены.
+const ClientID = "shortener"
+
+// User пользователь, который входит у провайдера.
+type User struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+}
+
+// IdP провайдер OpenID Connect: discovery, JWKS, страница входа и обмен кода на ID-токен с проверкой PKCE.
+type IdP struct {
+	Server *httptest.Server
+	signer crypto.Signer
+	codes  map[string]*grant
+	keyID  string
+	alg    string
+	user   User
+	mu     sync.Mutex
+	jwks   auth.JWKS
+	issued int
+}
+
+// grant код авторизации, выданный на странице входа.
+type grant struct {
+	clientID    string
+	redirectURI string
+	challenge   string
+	nonce       string
+	user        User
+}
+
+// NewIdP запускает провайдер, который подписывает ID-токены ключом RS256. Провайдер
+// нужно остановить методом Close.
+func NewIdP() (*IdP, error) {
+	key, err := auth.NewSigningKey(auth.AlgRS256)
+	if err != nil {
+		return nil, fmt.Errorf("error generating idp key %w", err)
+	}
+	signer, alg, err := auth.ParsePrivateKeyPEM([]byte(key.Secret))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing idp key %w", err)
+	}
+
+	idp := &IdP{
+		signer: signer,
+		codes:  make(map[string]*grant),
+		keyID:  key.ID,
+		alg:    alg,
+		jwks:   auth.NewKeyring(key).JWKS(),
+		user:   User{Subject: "user-1", Email: "user@example.com", EmailVerified: true},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", idp.discovery)
+	mux.HandleFunc("/jwks", idp.keys)
+	mux.HandleFunc("/authorize", idp.authorize)
+	mux.HandleFunc("/token", idp.token)
+	idp.Server = httptest.NewServer(mux)
+	return idp, nil
+}
+
+// Issuer идентификатор провайдера.
+func (p *IdP) Issuer() string {
+	return p.Server.URL
+}
+
+// Close останавливает провайдер.
+func (p *IdP) Close() {
+	p.Server.Close()
+}
+
+// Login задаёт пользователя, который войдёт на следующей странице входа.
+func (p *IdP) Login(user User) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.user = user
+}
+
+// Authorize проходит страницу входа провайдера так же, как браузер пользователя, и возвращает
+// код авторизации, выданный для входа login.
+func (p *IdP) Authorize(ctx context.Context, provider *auth.OIDCProvider, login *auth.OIDCLogin) (string, error) {
+	target, err := provider.AuthCodeURL(ctx, login)
+	if err != nil {
+		return "", fmt.Errorf("error building authorization url %w", err)
+	}
+	return p.Follow(ctx, target, login.State)
+}
+
+// Follow открывает страницу входа target и возвращает код из перенаправления обратно в приложение.
+func (p *IdP) Follow(ctx context.Context, target string, state string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, http.NoBody)
+	if err != nil {
+		return "", fmt.Errorf("error building authorization request %w", err)
+	}
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	res, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error opening authorization page %w", err)
+	}
+	_ = res.Body.Close()
+	if res.StatusCode != http.StatusFound {
+		return "", fmt.Errorf("authorization page returned %s", res.Status)
+	}
+
+	location, err := url.Parse(res.Header.Get("Location"))
+	if err != nil {
+		return "", fmt.Errorf("error parsing redirect %w", err)
+	}
+	if location.Query().Get("state") != state {
+		return "", fmt.Errorf("redirect has state %q", location.Query().Get("state"))
+	}
+	return location.Query().Get("code"), nil
+}
+
+// Sign подписывает claims ключом провайдера, например, чтобы проверить отказ на подделанном ID-токене.
+func (p *IdP) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(p.alg), claims)
+	token.Header["kid"] = p.keyID
+	signed, err := token.SignedString(p.signer)
+	if err != nil {
+		return "", fmt.Errorf("error signing id token %w", err)
+	}
+	return signed, nil
+}
+
+// IDTokenClaims поля ID-токена, который провайдер выдаёт пользователю user.
+func (p *IdP) IDTokenClaims(user User, nonce string) jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":            p.Issuer(),
+		"aud":            ClientID,
+		"sub":            user.Subject,
+		"email":          user.Email,
+		"email_verified": user.EmailVerified,
+		"nonce":          nonce,
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Hour).Unix(),
+	}
+}
+
+// discovery отдаёт документ discovery.
+func (p *IdP) discovery(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"issuer":                                p.Issuer(),
+		"authorization_endpoint":                p.Issuer() + "/authorize",
+		"token_endpoint":                        p.Issuer() + "/token",
+		"jwks_uri":                              p.Issuer() + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"id_token_signing_alg_values_supported": []string{p.alg},
+	})
+}
+
+// keys отдаёт открытый ключ провайдера.
+func (p *IdP) keys(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, p.jwks)
+}
+
+// authorize сразу выдаёт код текущему пользователю и перенаправляет на redirect_uri.
+func (p *IdP) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("response_type") != "code" || query.Get("client_id") != ClientID ||
+		query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		http.Error(w, "invalid authorization request", http.StatusBadRequest)
+		return
+	}
+	redirect, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil || redirect.Scheme == "" {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	p.mu.Lock()
+	p.issued++
+	code := "code-" + strconv.Itoa(p.issued)
+	p.codes[code] = &grant{
+		clientID:    ClientID,
+		redirectURI: redirect.String(),
+		challenge:   query.Get("code_challenge"),
+		nonce:       query.Get("nonce"),
+		user:        p.user,
+	}
+	p.mu.Unlock()
+
+	params := redirect.Query()
+	params.Set("code", code)
+	params.Set("state", query.Get("state"))
+	redirect.RawQuery = params.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+// token обменивает код на ID-токен. Код одноразовый и принимается только с verifier,
+// хеш которого передан на странице входа.
+func (p *IdP) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.ParseForm() != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	p.mu.Lock()
+	g, ok := p.codes[r.PostForm.Get("code")]
+	delete(p.codes, r.PostForm.Get("code"))
+	p.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || g.clientID != r.PostForm.Get("client_id") || g.redirectURI != r.PostForm.Get("redirect_uri") ||
+		g.challenge != base64.RawURLEncoding.EncodeToString(sum[:]) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	idToken, err := p.Sign(p.IDTokenClaims(g.user, g.nonce))
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": "access-" + r.PostForm.Get("code"),
+		"token_type":   "Bearer",
+		"id_token":     idToken,
+		"expires_in":   int(time.Hour.Seconds()),
+	})
+}
+
+// writeJSON отдаёт ответ в JSON.
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,133 @@
+package oidctest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Melikhov-p/url-minimise/internal/auth"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const redirectURL = "http://localhost:8080/api/user/oidc/callback"
+
+func TestOIDCProvider_Exchange(t *testing.T) {
+	idp, err := NewIdP()
+	require.NoError(t, err)
+	defer idp.Close()
+	idp.Login(User{Subject: "42", Email: "Alice@Example.com", EmailVerified: true})
+
+	provider := auth.NewOIDCProvider(idp.Issuer(), ClientID, "", redirectURL)
+	login, err := auth.NewOIDCLogin()
+	require.NoError(t, err)
+
+	code, err := idp.Authorize(context.Background(), provider, login)
+	require.NoError(t, err)
+	claims, err := provider.Exchange(context.Background(), code, login)
+	require.NoError(t, err)
+	assert.Equal(t, &auth.OIDCClaims{Subject: "42", Email: "Alice@Example.com", EmailVerified: true}, claims)
+
+	// Код одноразовый.
+	_, err = provider.Exchange(context.Background(), code, login)
+	assert.ErrorIs(t, err, auth.ErrOIDCRejected)
+
+	// Перехваченный код без verifier этого входа не обменять.
+	code, err = idp.Authorize(context.Background(), provider, login)
+	require.NoError(t, err)
+	other, err := auth.NewOIDCLogin()
+	require.NoError(t, err)
+	other.Nonce = login.Nonce
+	_, err = provider.Exchange(context.Background(), code, other)
+	assert.ErrorIs(t, err, auth.ErrOIDCRejected)
+
+	saved, ok := auth.ParseOIDCLogin(login.String())
+	require.True(t, ok)
+	assert.Equal(t, login, saved)
+	assert.True(t, saved.CheckState(login.State))
+	assert.False(t, saved.CheckState(other.State))
+	_, ok = auth.ParseOIDCLogin("state.nonce")
+	assert.False(t, ok)
+}
+
+func TestOIDCProvider_VerifyIDToken(t *testing.T) {
+	idp, err := NewIdP()
+	require.NoError(t, err)
+	defer idp.Close()
+	user := User{Subject: "42", Email: "alice@example.com"}
+
+	stranger, err := NewIdP()
+	require.NoError(t, err)
+	defer stranger.Close()
+
+	tests := []struct {
+		name   string
+		sign   func(claims jwt.Claims) (string, error)
+		modify func(claims jwt.MapClaims)
+		wantOK bool
+	}{
+		{name: "valid", sign: idp.Sign, modify: func(jwt.MapClaims) {}, wantOK: true},
+		{name: "wrong nonce", sign: idp.Sign, modify: func(c jwt.MapClaims) { c["nonce"] = "other" }},
+		{name: "wrong audience", sign: idp.Sign, modify: func(c jwt.MapClaims) { c["aud"] = "other" }},
+		{name: "wrong issuer", sign: idp.Sign, modify: func(c jwt.MapClaims) { c["iss"] = stranger.Issuer() }},
+		{name: "expired", sign: idp.Sign, modify: func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Minute).Unix() }},
+		{name: "no expiry", sign: idp.Sign, modify: func(c jwt.MapClaims) { delete(c, "exp") }},
+		{name: "no subject", sign: idp.Sign, modify: func(c jwt.MapClaims) { delete(c, "sub") }},
+		{
+			name:   "several audiences without azp",
+			sign:   idp.Sign,
+			modify: func(c jwt.MapClaims) { c["aud"] = []string{ClientID, "other"} },
+		},
+		{
+			name:   "several audiences with azp",
+			sign:   idp.Sign,
+			modify: func(c jwt.MapClaims) { c["aud"] = []string{ClientID, "other"}; c["azp"] = ClientID },
+			wantOK: true,
+		},
+		{name: "foreign key", sign: stranger.Sign, modify: func(jwt.MapClaims) {}},
+		{
+			name: "hmac with public key",
+			sign: func(claims jwt.Claims) (string, error) {
+				token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+				token.Header["kid"] = idp.keyID
+				return token.SignedString([]byte(idp.jwks.Keys[0].N))
+			},
+			modify: func(jwt.MapClaims) {},
+		},
+	}
+
+	provider := auth.NewOIDCProvider(idp.Issuer(), ClientID, "", redirectURL)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			claims := idp.IDTokenClaims(user, "nonce")
+			test.modify(claims)
+			raw, err := test.sign(claims)
+			require.NoError(t, err)
+
+			got, err := provider.VerifyIDToken(context.Background(), raw, "nonce")
+			if !test.wantOK {
+				assert.ErrorIs(t, err, auth.ErrOIDCRejected)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "42", got.Subject)
+		})
+	}
+}
+
+func TestOIDCProvider_Discovery(t *testing.T) {
+	idp, err := NewIdP()
+	require.NoError(t, err)
+	defer idp.Close()
+
+	// Издатель в настройках должен совпадать с издателем в документе discovery.
+	provider := auth.NewOIDCProvider(idp.Issuer()+"/", ClientID, "", redirectURL)
+	_, err = provider.AuthCodeURL(context.Background(), &auth.OIDCLogin{})
+	assert.ErrorIs(t, err, auth.ErrOIDCUnavailable)
+
+	provider = auth.NewOIDCProvider(idp.Issuer(), ClientID, "", redirectURL)
+	idp.Close()
+	_, err = provider.AuthCodeURL(context.Background(), &auth.OIDCLogin{})
+	assert.ErrorIs(t, err, auth.ErrOIDCUnavailable)
+}
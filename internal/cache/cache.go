@@ -0,0 +1,56 @@
+// Package cache кеширует дорогие в вычислении значения на заданное время.
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Value значение, которое пересчитывается не чаще раза в TTL. Одновременные запросы
+// устаревшего значения дожидаются одного пересчёта. Нулевой указатель не кеширует.
+type Value[T any] struct {
+	loadedAt time.Time
+	value    T
+	ttl      time.Duration
+	mu       sync.Mutex
+	loaded   bool
+}
+
+// NewValue возвращает пустой кеш значения со временем жизни ttl.
+func NewValue[T any](ttl time.Duration) *Value[T] {
+	return &Value[T]{ttl: ttl}
+}
+
+// Get вернуть закешированное значение или вычислить его функцией load.
+// Ошибка вычисления не кешируется.
+func (v *Value[T]) Get(ctx context.Context, load func(ctx context.Context) (T, error)) (T, error) {
+	if v == nil {
+		return load(ctx)
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.loaded && time.Since(v.loadedAt) < v.ttl {
+		return v.value, nil
+	}
+
+	value, err := load(ctx)
+	if err != nil {
+		return value, err
+	}
+	v.value, v.loadedAt, v.loaded = value, time.Now(), true
+	return value, nil
+}
+
+// Invalidate сбросить закешированное значение.
+func (v *Value[T]) Invalidate() {
+	if v == nil {
+		return
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.loaded = false
+}
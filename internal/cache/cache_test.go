@@ -0,0 +1,72 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValue_Get(t *testing.T) {
+	var loads atomic.Int32
+	load := func(context.Context) (int32, error) {
+		time.Sleep(10 * time.Millisecond)
+		return loads.Add(1), nil
+	}
+
+	value := NewValue[int32](time.Hour)
+
+	// Одновременные запросы вычисляют значение один раз.
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got, err := value.Get(context.Background(), load)
+			assert.NoError(t, err)
+			assert.Equal(t, int32(1), got)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), loads.Load())
+
+	value.Invalidate()
+	got, err := value.Get(context.Background(), load)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), got)
+
+	// Ошибка не кешируется.
+	value.Invalidate()
+	_, err = value.Get(context.Background(), func(context.Context) (int32, error) {
+		return 0, errors.New("storage is down")
+	})
+	assert.Error(t, err)
+	got, err = value.Get(context.Background(), load)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(3), got)
+
+	var noCache *Value[int32]
+	got, err = noCache.Get(context.Background(), load)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(4), got)
+}
+
+func TestValue_Expiry(t *testing.T) {
+	var loads int
+	load := func(context.Context) (int, error) {
+		loads++
+		return loads, nil
+	}
+
+	value := NewValue[int](time.Millisecond)
+	_, err := value.Get(context.Background(), load)
+	assert.NoError(t, err)
+	time.Sleep(2 * time.Millisecond)
+	got, err := value.Get(context.Background(), load)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, got)
+}
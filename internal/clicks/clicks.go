@@ -0,0 +1,102 @@
+// Package clicks буферизует события переходов по коротким ссылкам.
+//
+// Обработчик редиректа кладёт событие в ограниченный буфер без ожидания: если буфер заполнен,
+// событие отбрасывается и учитывается в счётчике потерь, поэтому запись переходов не влияет
+// на задержку редиректа. События из буфера пачками сохраняет отдельный воркер.
+package clicks
+
+import (
+	"net"
+	"sync/atomic"
+
+	"github.com/Melikhov-p/url-minimise/internal/hll"
+	"github.com/Melikhov-p/url-minimise/internal/models"
+)
+
+// Маски обезличивания IP: у IPv4 обнуляется последний октет, у IPv6 остаётся префикс /48.
+var (
+	ipv4Mask = net.CIDRMask(24, 32)
+	ipv6Mask = net.CIDRMask(48, 128)
+)
+
+// Buffer ограниченный буфер событий переходов. Нулевой указатель отбрасывает события без учёта.
+type Buffer struct {
+	events   chan *models.ClickEvent
+	recorded atomic.Int64
+	dropped  atomic.Int64
+}
+
+// NewBuffer возвращает буфер на size событий.
+func NewBuffer(size int) *Buffer {
+	return &Buffer{events: make(chan *models.ClickEvent, max(size, 1))}
+}
+
+// Record положить событие в буфер без ожидания. Возвращает false, если буфер заполнен и событие отброшено.
+func (b *Buffer) Record(event *models.ClickEvent) bool {
+	if b == nil {
+		return false
+	}
+
+	select {
+	case b.events <- event:
+		b.recorded.Add(1)
+		return true
+	default:
+		b.dropped.Add(1)
+		return false
+	}
+}
+
+// Events канал событий для воркера сохранения.
+func (b *Buffer) Events() <-chan *models.ClickEvent {
+	return b.events
+}
+
+// Len количество событий, ожидающих сохранения.
+func (b *Buffer) Len() int {
+	if b == nil {
+		return 0
+	}
+	return len(b.events)
+}
+
+// Recorded количество событий, принятых в буфер с момента запуска.
+func (b *Buffer) Recorded() int64 {
+	if b == nil {
+		return 0
+	}
+	return b.recorded.Load()
+}
+
+// Dropped количество событий, отброшенных из-за переполнения буфера с момента запуска.
+func (b *Buffer) Dropped() int64 {
+	if b == nil {
+		return 0
+	}
+	return b.dropped.Load()
+}
+
+// AnonymizeIP обезличить адрес посетителя. Строка, не являющаяся IP, отбрасывается.
+func AnonymizeIP(raw string) string {
+	if host, _, err := net.SplitHostPort(raw); err == nil {
+		raw = host
+	}
+
+	ip := net.ParseIP(raw)
+	if ip == nil {
+		return ""
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.Mask(ipv4Mask).String()
+	}
+	return ip.Mask(ipv6Mask).String()
+}
+
+// VisitorHash хеш посетителя для подсчёта уникальных посетителей: полный IP без порта и User-Agent
+// с секретом сервиса, чтобы по хешу нельзя было перебором восстановить адрес.
+func VisitorHash(secret, ip, userAgent string) uint64 {
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+	return hll.Hash(secret, ip, userAgent)
+}
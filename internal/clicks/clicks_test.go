@@ -0,0 +1,58 @@
+package clicks
+
+import (
+	"testing"
+
+	"github.com/Melikhov-p/url-minimise/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuffer_Record(t *testing.T) {
+	buffer := NewBuffer(2)
+
+	assert.True(t, buffer.Record(&models.ClickEvent{ShortURL: "a"}))
+	assert.True(t, buffer.Record(&models.ClickEvent{ShortURL: "b"}))
+	assert.False(t, buffer.Record(&models.ClickEvent{ShortURL: "c"}))
+
+	assert.Equal(t, 2, buffer.Len())
+	assert.Equal(t, int64(2), buffer.Recorded())
+	assert.Equal(t, int64(1), buffer.Dropped())
+	assert.Equal(t, "a", (<-buffer.Events()).ShortURL)
+
+	// После освобождения места события снова принимаются.
+	assert.True(t, buffer.Record(&models.ClickEvent{ShortURL: "d"}))
+
+	var empty *Buffer
+	assert.False(t, empty.Record(&models.ClickEvent{ShortURL: "a"}))
+	assert.Zero(t, empty.Dropped())
+	assert.Zero(t, empty.Len())
+}
+
+func TestAnonymizeIP(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want string
+	}{
+		{name: "ipv4", raw: "203.0.113.54", want: "203.0.113.0"},
+		{name: "ipv4 with port", raw: "203.0.113.54:51234", want: "203.0.113.0"},
+		{name: "ipv6", raw: "2001:db8:85a3:8d3:1319:8a2e:370:7348", want: "2001:db8:85a3::"},
+		{name: "ipv6 with port", raw: "[2001:db8:85a3::1]:443", want: "2001:db8:85a3::"},
+		{name: "ipv4 mapped ipv6", raw: "::ffff:198.51.100.7", want: "198.51.100.0"},
+		{name: "not an ip", raw: "localhost", want: ""},
+		{name: "empty", raw: "", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, AnonymizeIP(tt.raw))
+		})
+	}
+}
+
+func TestVisitorHash(t *testing.T) {
+	hash := VisitorHash("secret", "203.0.113.7:5000", "curl")
+	assert.Equal(t, hash, VisitorHash("secret", "203.0.113.7:6000", "curl"))
+	assert.NotEqual(t, hash, VisitorHash("secret", "203.0.113.8:5000", "curl"))
+	assert.NotEqual(t, hash, VisitorHash("secret", "203.0.113.7:5000", "wget"))
+	assert.NotEqual(t, hash, VisitorHash("other", "203.0.113.7:5000", "curl"))
+}
@@ -0,0 +1,150 @@
+package clicks
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"github.com/Melikhov-p/url-minimise/internal/models"
+)
+
+// ErrTooManySubscribers достигнут предел одновременных подписок на переходы.
+var ErrTooManySubscribers = errors.New("too many click subscribers")
+
+// Hub рассылает переходы подписчикам ссылок в реальном времени.
+//
+// Публикация не ждёт подписчиков: у каждой подписки свой ограниченный буфер, и если подписчик
+// не успевает читать, новые события для него отбрасываются и учитываются в его счётчике потерь.
+// Поэтому медленный подписчик не влияет ни на редирект, ни на других подписчиков.
+// Нулевой указатель не принимает подписок и ничего не рассылает.
+type Hub struct {
+	subs       map[string]map[*Subscription]struct{}
+	limit      int
+	bufferSize int
+	count      int
+	mu         sync.RWMutex
+	closed     bool
+}
+
+// NewHub возвращает рассыльщик не более чем на limit одновременных подписок
+// с буфером на bufferSize событий у каждой.
+func NewHub(limit, bufferSize int) *Hub {
+	return &Hub{
+		subs:       make(map[string]map[*Subscription]struct{}),
+		limit:      max(limit, 1),
+		bufferSize: max(bufferSize, 1),
+	}
+}
+
+// Subscription подписка на переходы по одной ссылке.
+type Subscription struct {
+	hub      *Hub
+	events   chan *models.ClickEvent
+	shortURL string
+	dropped  atomic.Int64
+	once     sync.Once
+}
+
+// Subscribe подписаться на переходы по ссылке с ключом shortURL. Подписку нужно закрыть методом Close.
+func (h *Hub) Subscribe(shortURL string) (*Subscription, error) {
+	if h == nil {
+		return nil, ErrTooManySubscribers
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed || h.count >= h.limit {
+		return nil, ErrTooManySubscribers
+	}
+
+	sub := &Subscription{
+		hub:      h,
+		events:   make(chan *models.ClickEvent, h.bufferSize),
+		shortURL: shortURL,
+	}
+	if h.subs[shortURL] == nil {
+		h.subs[shortURL] = make(map[*Subscription]struct{})
+	}
+	h.subs[shortURL][sub] = struct{}{}
+	h.count++
+
+	return sub, nil
+}
+
+// Publish разослать переход подписчикам его ссылки без ожидания.
+func (h *Hub) Publish(event *models.ClickEvent) {
+	if h == nil {
+		return
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for sub := range h.subs[event.ShortURL] {
+		select {
+		case sub.events <- event:
+		default:
+			sub.dropped.Add(1)
+		}
+	}
+}
+
+// Subscribers количество открытых подписок.
+func (h *Hub) Subscribers() int {
+	if h == nil {
+		return 0
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.count
+}
+
+// Close закрыть все подписки и не принимать новые, например, при остановке сервера.
+func (h *Hub) Close() {
+	if h == nil {
+		return
+	}
+
+	h.mu.Lock()
+	h.closed = true
+	var subs []*Subscription
+	for _, linkSubs := range h.subs {
+		for sub := range linkSubs {
+			subs = append(subs, sub)
+		}
+	}
+	h.mu.Unlock()
+
+	for _, sub := range subs {
+		sub.Close()
+	}
+}
+
+// Events канал переходов по ссылке. Канал закрывается, когда подписка закрыта.
+func (s *Subscription) Events() <-chan *models.ClickEvent {
+	return s.events
+}
+
+// Dropped количество переходов, отброшенных из-за того, что подписчик не успевал их читать.
+func (s *Subscription) Dropped() int64 {
+	return s.dropped.Load()
+}
+
+// Close отписаться. Повторные вызовы ничего не делают.
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		h := s.hub
+
+		h.mu.Lock()
+		defer h.mu.Unlock()
+
+		delete(h.subs[s.shortURL], s)
+		if len(h.subs[s.shortURL]) == 0 {
+			delete(h.subs, s.shortURL)
+		}
+		h.count--
+		close(s.events)
+	})
+}
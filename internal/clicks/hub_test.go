@@ -0,0 +1,55 @@
+package clicks
+
+import (
+	"testing"
+
+	"github.com/Melikhov-p/url-minimise/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHub(t *testing.T) {
+	hub := NewHub(2, 1)
+
+	first, err := hub.Subscribe("a")
+	require.NoError(t, err)
+	second, err := hub.Subscribe("b")
+	require.NoError(t, err)
+	_, err = hub.Subscribe("c")
+	assert.ErrorIs(t, err, ErrTooManySubscribers)
+	assert.Equal(t, 2, hub.Subscribers())
+
+	// Переход получает только подписчик его ссылки, при полном буфере событие отбрасывается.
+	hub.Publish(&models.ClickEvent{ShortURL: "a", Referrer: "one"})
+	hub.Publish(&models.ClickEvent{ShortURL: "a", Referrer: "two"})
+	assert.Equal(t, "one", (<-first.Events()).Referrer)
+	assert.Equal(t, int64(1), first.Dropped())
+	assert.Empty(t, second.Events())
+	assert.Zero(t, second.Dropped())
+
+	// Закрытая подписка освобождает место.
+	first.Close()
+	first.Close()
+	_, open := <-first.Events()
+	assert.False(t, open)
+	assert.Equal(t, 1, hub.Subscribers())
+	third, err := hub.Subscribe("a")
+	require.NoError(t, err)
+
+	hub.Close()
+	_, open = <-second.Events()
+	assert.False(t, open)
+	_, open = <-third.Events()
+	assert.False(t, open)
+	assert.Zero(t, hub.Subscribers())
+	_, err = hub.Subscribe("a")
+	assert.ErrorIs(t, err, ErrTooManySubscribers)
+
+	var empty *Hub
+	_, err = empty.Subscribe("a")
+	assert.ErrorIs(t, err, ErrTooManySubscribers)
+	assert.NotPanics(t, func() {
+		empty.Publish(&models.ClickEvent{ShortURL: "a"})
+		empty.Close()
+	})
+}
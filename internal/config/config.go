@@ -1,19 +1,32 @@
 package config
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"net"
+	"net/http"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/Melikhov-p/url-minimise/internal/auth"
+	"github.com/Melikhov-p/url-minimise/internal/cache"
+	"github.com/Melikhov-p/url-minimise/internal/clicks"
+	"github.com/Melikhov-p/url-minimise/internal/metrics"
+	"github.com/Melikhov-p/url-minimise/internal/models"
+	"github.com/Melikhov-p/url-minimise/internal/policy"
 	storageConfig "github.com/Melikhov-p/url-minimise/internal/repository/config"
 	databaseConfig "github.com/Melikhov-p/url-minimise/internal/repository/database/config"
 	fileConfig "github.com/Melikhov-p/url-minimise/internal/repository/file/config"
 	memoryConfig "github.com/Melikhov-p/url-minimise/internal/repository/memory/config"
 	"github.com/Melikhov-p/url-minimise/internal/storage"
+	"github.com/Melikhov-p/url-minimise/internal/tracing"
 	_ "github.com/jackc/pgx/v5" // PostgreSQL driver.
 	"go.uber.org/zap"
 )
@@ -23,48 +36,176 @@ var (
 )
 
 const (
-	defaultSrvAddr         = "localhost:8080"
-	defaultResAddr         = "http://localhost:8080"
-	defaultFileStoragePath = "storage.txt"
-	defaultMigrationsPath  = "./internal/storage/migrations"
-	defaultShortURLSize    = 10
-	defaultTLS             = false
-	defaultStorageMode     = storage.StorageFromFile
-	defaultTrustedSubNet   = "192.168.1.0/24"
+	defaultSrvAddr          = "localhost:8080"
+	defaultResAddr          = "http://localhost:8080"
+	defaultFileStoragePath  = "storage.txt"
+	defaultMigrationsPath   = "./internal/storage/migrations"
+	defaultShortURLSize     = 10
+	defaultTLS              = false
+	defaultStorageMode      = storage.StorageFromFile
+	defaultTrustedSubNet    = "192.168.1.0/24"
+	defaultURLRetention     = 30 * 24 * time.Hour
+	defaultPermanentMaxAge  = 24 * time.Hour
+	defaultTemporaryMaxAge  = time.Minute
+	defaultNotYetActiveCode = http.StatusNotFound
+	defaultNotYetActiveBody = "link is not yet available"
+	defaultURLPolicyMode    = policy.ModeBlock
+	defaultHealthInterval   = time.Hour
+	defaultHealthTimeout    = 10 * time.Second
+	defaultHealthHostRate   = time.Second
+	defaultHealthWorkers    = 8
+	defaultHealthBrokenAt   = 3
+	defaultClickBufferSize  = 10000
+	defaultClickBatchSize   = 500
+	defaultClickFlush       = time.Second
+	defaultStatsCacheTTL    = 10 * time.Second
+	defaultStatsTopLinks    = 10
+	defaultDomainCacheTTL   = 30 * time.Second
+	defaultLiveSubscribers  = 100
+	defaultLiveBufferSize   = 64
+	defaultAccessTokenTTL   = 15 * time.Minute
+	defaultRefreshTokenTTL  = 30 * 24 * time.Hour
+	defaultKeyRotation      = 30 * 24 * time.Hour
+	defaultSigningAlgorithm = auth.AlgHS256
 )
 
+// Resolver DNS-резолвер, по записям которого подтверждается владение дополнительным доменом.
+type Resolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+	LookupCNAME(ctx context.Context, host string) (string, error)
+}
+
 // cfgFromFile structure for fields from config file.
 type cfgFromFile struct {
-	ServerAddress   string `json:"server_address"`
-	BaseURL         string `json:"base_url"`
-	FileStoragePath string `json:"file_storage_path"`
-	DatabaseDsn     string `json:"database_dsn"`
-	TrustedSubNet   string `json:"trusted_subnet"`
-	EnableHTTPS     bool   `json:"enable_https"`
+	ServerAddress    string   `json:"server_address"`
+	BaseURL          string   `json:"base_url"`
+	FileStoragePath  string   `json:"file_storage_path"`
+	DatabaseDsn      string   `json:"database_dsn"`
+	TrustedSubNet    string   `json:"trusted_subnet"`
+	URLRetention     string   `json:"url_retention"`
+	PermanentMaxAge  string   `json:"permanent_redirect_max_age"`
+	TemporaryMaxAge  string   `json:"temporary_redirect_max_age"`
+	NotYetActiveBody string   `json:"not_yet_active_body"`
+	NotYetActiveCode int      `json:"not_yet_active_code"`
+	URLPolicyFile    string   `json:"url_policy_file"`
+	URLPolicyMode    string   `json:"url_policy_mode"`
+	HealthInterval   string   `json:"health_check_interval"`
+	HealthTimeout    string   `json:"health_check_timeout"`
+	HealthHostRate   string   `json:"health_check_host_interval"`
+	HealthWorkers    int      `json:"health_check_concurrency"`
+	HealthBrokenAt   int      `json:"health_broken_after"`
+	HealthPrivate    bool     `json:"health_check_allow_private"`
+	ClickFlush       string   `json:"click_flush_interval"`
+	ClickBufferSize  int      `json:"click_buffer_size"`
+	ClickBatchSize   int      `json:"click_batch_size"`
+	StatsCacheTTL    string   `json:"stats_cache_ttl"`
+	StatsTopLinks    int      `json:"stats_top_links"`
+	TraceExporter    string   `json:"trace_exporter"`
+	LiveSubscribers  int      `json:"live_max_subscribers"`
+	LiveBufferSize   int      `json:"live_buffer_size"`
+	AccessTokenTTL   string   `json:"access_token_ttl"`
+	RefreshTokenTTL  string   `json:"refresh_token_ttl"`
+	KeyRotation      string   `json:"signing_key_rotation"`
+	SigningAlgorithm string   `json:"token_signing_alg"`
+	SigningKeyFile   string   `json:"signing_key_file"`
+	OIDCIssuer       string   `json:"oidc_issuer"`
+	OIDCClientID     string   `json:"oidc_client_id"`
+	OIDCClientSecret string   `json:"oidc_client_secret"`
+	OIDCRedirectURL  string   `json:"oidc_redirect_url"`
+	CookieDomain     string   `json:"cookie_domain"`
+	CookiePath       string   `json:"cookie_path"`
+	CookieSameSite   string   `json:"cookie_samesite"`
+	CookieSecure     bool     `json:"cookie_secure"`
+	ShortDomains     []string `json:"short_domains"`
+	EnableHTTPS      bool     `json:"enable_https"`
 }
 
 // Config структура конфига.
 type Config struct {
-	StorageMode      storage.StorageType
-	Storage          storageConfig.Config
-	JWTTokenLifeTime time.Duration
-	TLS              bool
-	ShortURLSize     int
-	TrustedSubNet    string
-	ServerAddr       string
-	ResultAddr       string
-	SecretKey        string
-	ConfigPath       string
+	StorageMode             storage.StorageType
+	Storage                 storageConfig.Config
+	JWTTokenLifeTime        time.Duration
+	RefreshTokenLifeTime    time.Duration
+	SigningKeyRotation      time.Duration
+	SigningKeys             *auth.Keyring
+	SigningAlgorithm        string
+	SigningKeyFile          string
+	OIDC                    *auth.OIDCProvider
+	OIDCIssuer              string
+	OIDCClientID            string
+	OIDCClientSecret        string
+	OIDCRedirectURL         string
+	Cookie                  auth.CookieOptions
+	URLRetention            time.Duration
+	PermanentRedirectMaxAge time.Duration
+	TemporaryRedirectMaxAge time.Duration
+	HealthCheckInterval     time.Duration
+	HealthCheckTimeout      time.Duration
+	HealthCheckHostInterval time.Duration
+	HealthCheckConcurrency  int
+	HealthBrokenAfter       int
+	HealthCheckAllowPrivate bool
+	ClickFlushInterval      time.Duration
+	ClickBufferSize         int
+	ClickBatchSize          int
+	Clicks                  *clicks.Buffer
+	ClickHub                *clicks.Hub
+	LiveMaxSubscribers      int
+	LiveBufferSize          int
+	StatsCacheTTL           time.Duration
+	StatsTopLinks           int
+	StatsCache              *cache.Value[*models.StatsResponse]
+	Metrics                 *metrics.Metrics
+	Tracer                  *tracing.Tracer
+	TraceExporter           string
+	TLS                     bool
+	ShortURLSize            int
+	NotYetActiveCode        int
+	NotYetActiveBody        string
+	ShortDomains            []string
+	Domains                 *cache.Value[map[string]int]
+	Resolver                Resolver
+	URLPolicy               *policy.Policy
+	URLPolicyMode           policy.Mode
+	URLPolicyFile           string
+	TrustedSubNet           string
+	ServerAddr              string
+	ResultAddr              string
+	SecretKey               string
+	ConfigPath              string
 }
 
 // NewConfig Возвращает указатель на конфиг, withoutFlags нужен для тестов, чтобы не читать флаги постоянно.
 func NewConfig(logger *zap.Logger, withoutFlags bool) *Config {
 	cfg := &Config{
-		ServerAddr:       defaultSrvAddr,
-		ResultAddr:       defaultResAddr,
-		StorageMode:      defaultStorageMode,
-		JWTTokenLifeTime: 24 * time.Hour,
-		TLS:              false,
+		ServerAddr:              defaultSrvAddr,
+		ResultAddr:              defaultResAddr,
+		StorageMode:             defaultStorageMode,
+		JWTTokenLifeTime:        defaultAccessTokenTTL,
+		RefreshTokenLifeTime:    defaultRefreshTokenTTL,
+		SigningKeyRotation:      defaultKeyRotation,
+		SigningAlgorithm:        defaultSigningAlgorithm,
+		SigningKeys:             auth.NewKeyring(),
+		Cookie:                  auth.DefaultCookieOptions(),
+		URLRetention:            defaultURLRetention,
+		PermanentRedirectMaxAge: defaultPermanentMaxAge,
+		TemporaryRedirectMaxAge: defaultTemporaryMaxAge,
+		NotYetActiveCode:        defaultNotYetActiveCode,
+		NotYetActiveBody:        defaultNotYetActiveBody,
+		URLPolicyMode:           defaultURLPolicyMode,
+		HealthCheckInterval:     defaultHealthInterval,
+		HealthCheckTimeout:      defaultHealthTimeout,
+		HealthCheckHostInterval: defaultHealthHostRate,
+		HealthCheckConcurrency:  defaultHealthWorkers,
+		HealthBrokenAfter:       defaultHealthBrokenAt,
+		ClickFlushInterval:      defaultClickFlush,
+		ClickBufferSize:         defaultClickBufferSize,
+		ClickBatchSize:          defaultClickBatchSize,
+		StatsCacheTTL:           defaultStatsCacheTTL,
+		StatsTopLinks:           defaultStatsTopLinks,
+		LiveMaxSubscribers:      defaultLiveSubscribers,
+		LiveBufferSize:          defaultLiveBufferSize,
+		TLS:                     false,
 		Storage: storageConfig.Config{
 			InMemory: &memoryConfig.Config{},
 			FileStorage: &fileConfig.Config{
@@ -79,16 +220,70 @@ func NewConfig(logger *zap.Logger, withoutFlags bool) *Config {
 		TrustedSubNet: defaultTrustedSubNet,
 		SecretKey:     "",
 		ConfigPath:    "",
+		Domains:       cache.NewValue[map[string]int](defaultDomainCacheTTL),
+		Resolver:      net.DefaultResolver,
 	}
 	if withoutFlags {
+		cfg.URLPolicy = policy.New("", cfg.URLPolicyMode)
+		cfg.Clicks = clicks.NewBuffer(cfg.ClickBufferSize)
+		cfg.ClickHub = clicks.NewHub(cfg.LiveMaxSubscribers, cfg.LiveBufferSize)
+		cfg.StatsCache = cache.NewValue[*models.StatsResponse](cfg.StatsCacheTTL)
+		cfg.Metrics = metrics.New()
+		cfg.Tracer = tracing.NewTracer(nil)
 		return cfg
 	}
 
 	cfg.build(logger)
-	logger.Debug("config", zap.Any("", cfg))
+	cfg.Clicks = clicks.NewBuffer(cfg.ClickBufferSize)
+	cfg.ClickHub = clicks.NewHub(cfg.LiveMaxSubscribers, cfg.LiveBufferSize)
+	cfg.StatsCache = cache.NewValue[*models.StatsResponse](cfg.StatsCacheTTL)
+	cfg.Metrics = metrics.New()
+	tracer, err := tracing.NewTracerFor(cfg.TraceExporter)
+	if err != nil {
+		logger.Error("error creating tracer, spans are not exported", zap.Error(err))
+		tracer = tracing.NewTracer(nil)
+	}
+	cfg.Tracer = tracer
+	cfg.OIDC = cfg.newOIDCProvider(logger)
+	cfg.URLPolicy = policy.New(cfg.URLPolicyFile, cfg.URLPolicyMode)
+	if _, err := cfg.URLPolicy.Reload(); err != nil {
+		logger.Error("error loading url policy", zap.String("file", cfg.URLPolicyFile), zap.Error(err))
+	}
+	logger.Debug("config", zap.Any("", cfg.redacted()))
 	return cfg
 }
 
+// redactedValue заменяет секрет в журнале.
+const redactedValue = "[redacted]"
+
+// redacted копия конфига для журнала: секреты заменены, пароль в DSN скрыт, клиент провайдера
+// и ключи подписи не выводятся.
+func (c *Config) redacted() *Config {
+	r := *c
+	if r.SecretKey != "" {
+		r.SecretKey = redactedValue
+	}
+	if r.OIDCClientSecret != "" {
+		r.OIDCClientSecret = redactedValue
+	}
+	r.OIDC = nil
+	r.SigningKeys = nil
+
+	if c.Storage.Database != nil {
+		database := *c.Storage.Database
+		if database.DSN != "" {
+			// DSN вида key=value не разбирается как URL и скрывается целиком.
+			if dsn, err := url.Parse(database.DSN); err == nil && dsn.Scheme != "" {
+				database.DSN = dsn.Redacted()
+			} else {
+				database.DSN = redactedValue
+			}
+		}
+		r.Storage.Database = &database
+	}
+	return &r
+}
+
 // getConfigFromFile get config params from file with provided path.
 func (c *Config) getConfigFromFile(filePath string, log *zap.Logger) error {
 	if c.ConfigPath == "" {
@@ -108,12 +303,47 @@ func (c *Config) getConfigFromFile(filePath string, log *zap.Logger) error {
 	log = log.With(zap.String("config_file", f.Name()))
 	log.Debug("config file opened")
 	cfgF := cfgFromFile{
-		ServerAddress:   "",
-		BaseURL:         "",
-		FileStoragePath: "",
-		DatabaseDsn:     "",
-		TrustedSubNet:   "",
-		EnableHTTPS:     false,
+		ServerAddress:    "",
+		BaseURL:          "",
+		FileStoragePath:  "",
+		DatabaseDsn:      "",
+		TrustedSubNet:    "",
+		URLRetention:     "",
+		PermanentMaxAge:  "",
+		TemporaryMaxAge:  "",
+		NotYetActiveBody: "",
+		NotYetActiveCode: 0,
+		URLPolicyFile:    "",
+		URLPolicyMode:    "",
+		HealthInterval:   "",
+		HealthTimeout:    "",
+		HealthHostRate:   "",
+		HealthWorkers:    0,
+		HealthBrokenAt:   0,
+		HealthPrivate:    false,
+		ClickFlush:       "",
+		ClickBufferSize:  0,
+		ClickBatchSize:   0,
+		StatsCacheTTL:    "",
+		StatsTopLinks:    0,
+		TraceExporter:    "",
+		LiveSubscribers:  0,
+		LiveBufferSize:   0,
+		AccessTokenTTL:   "",
+		RefreshTokenTTL:  "",
+		KeyRotation:      "",
+		SigningAlgorithm: "",
+		SigningKeyFile:   "",
+		OIDCIssuer:       "",
+		OIDCClientID:     "",
+		OIDCClientSecret: "",
+		OIDCRedirectURL:  "",
+		CookieDomain:     "",
+		CookiePath:       "",
+		CookieSameSite:   "",
+		CookieSecure:     false,
+		ShortDomains:     nil,
+		EnableHTTPS:      false,
 	}
 
 	data, err := io.ReadAll(f)
@@ -146,6 +376,148 @@ func (c *Config) getConfigFromFile(filePath string, log *zap.Logger) error {
 	if cfgF.TrustedSubNet != "" && c.TrustedSubNet == defaultTrustedSubNet {
 		c.TrustedSubNet = cfgF.TrustedSubNet
 	}
+	if cfgF.URLRetention != "" && c.URLRetention == defaultURLRetention {
+		c.URLRetention, err = time.ParseDuration(cfgF.URLRetention)
+		if err != nil {
+			return fmt.Errorf("error parsing url retention %w", err)
+		}
+	}
+	if cfgF.PermanentMaxAge != "" {
+		c.PermanentRedirectMaxAge, err = time.ParseDuration(cfgF.PermanentMaxAge)
+		if err != nil {
+			return fmt.Errorf("error parsing permanent redirect max age %w", err)
+		}
+	}
+	if cfgF.TemporaryMaxAge != "" {
+		c.TemporaryRedirectMaxAge, err = time.ParseDuration(cfgF.TemporaryMaxAge)
+		if err != nil {
+			return fmt.Errorf("error parsing temporary redirect max age %w", err)
+		}
+	}
+	if cfgF.NotYetActiveCode != 0 {
+		if !isErrorStatus(cfgF.NotYetActiveCode) {
+			return fmt.Errorf("not yet active code must be 4xx or 5xx, got %d", cfgF.NotYetActiveCode)
+		}
+		c.NotYetActiveCode = cfgF.NotYetActiveCode
+	}
+	if cfgF.NotYetActiveBody != "" {
+		c.NotYetActiveBody = cfgF.NotYetActiveBody
+	}
+	if len(cfgF.ShortDomains) > 0 && len(c.ShortDomains) == 0 {
+		c.ShortDomains = cfgF.ShortDomains
+	}
+	if cfgF.URLPolicyFile != "" && c.URLPolicyFile == "" {
+		c.URLPolicyFile = cfgF.URLPolicyFile
+	}
+	if cfgF.URLPolicyMode != "" && c.URLPolicyMode == defaultURLPolicyMode {
+		if c.URLPolicyMode, err = policy.ParseMode(cfgF.URLPolicyMode); err != nil {
+			c.URLPolicyMode = defaultURLPolicyMode
+			return fmt.Errorf("error parsing url policy mode %w", err)
+		}
+	}
+	if cfgF.HealthInterval != "" {
+		if c.HealthCheckInterval, err = time.ParseDuration(cfgF.HealthInterval); err != nil {
+			return fmt.Errorf("error parsing health check interval %w", err)
+		}
+	}
+	if cfgF.HealthTimeout != "" {
+		if c.HealthCheckTimeout, err = time.ParseDuration(cfgF.HealthTimeout); err != nil {
+			return fmt.Errorf("error parsing health check timeout %w", err)
+		}
+	}
+	if cfgF.HealthHostRate != "" {
+		if c.HealthCheckHostInterval, err = time.ParseDuration(cfgF.HealthHostRate); err != nil {
+			return fmt.Errorf("error parsing health check host interval %w", err)
+		}
+	}
+	if cfgF.HealthWorkers > 0 {
+		c.HealthCheckConcurrency = cfgF.HealthWorkers
+	}
+	if cfgF.HealthBrokenAt > 0 {
+		c.HealthBrokenAfter = cfgF.HealthBrokenAt
+	}
+	if cfgF.HealthPrivate {
+		c.HealthCheckAllowPrivate = true
+	}
+	if cfgF.ClickFlush != "" {
+		if c.ClickFlushInterval, err = time.ParseDuration(cfgF.ClickFlush); err != nil {
+			return fmt.Errorf("error parsing click flush interval %w", err)
+		}
+	}
+	if cfgF.ClickBufferSize > 0 {
+		c.ClickBufferSize = cfgF.ClickBufferSize
+	}
+	if cfgF.ClickBatchSize > 0 {
+		c.ClickBatchSize = cfgF.ClickBatchSize
+	}
+	if cfgF.StatsCacheTTL != "" {
+		if c.StatsCacheTTL, err = time.ParseDuration(cfgF.StatsCacheTTL); err != nil {
+			return fmt.Errorf("error parsing stats cache ttl %w", err)
+		}
+	}
+	if cfgF.StatsTopLinks > 0 {
+		c.StatsTopLinks = cfgF.StatsTopLinks
+	}
+	if cfgF.TraceExporter != "" {
+		c.TraceExporter = cfgF.TraceExporter
+	}
+	if cfgF.LiveSubscribers > 0 {
+		c.LiveMaxSubscribers = cfgF.LiveSubscribers
+	}
+	if cfgF.LiveBufferSize > 0 {
+		c.LiveBufferSize = cfgF.LiveBufferSize
+	}
+	if cfgF.AccessTokenTTL != "" {
+		if c.JWTTokenLifeTime, err = time.ParseDuration(cfgF.AccessTokenTTL); err != nil {
+			return fmt.Errorf("error parsing access token ttl %w", err)
+		}
+	}
+	if cfgF.RefreshTokenTTL != "" {
+		if c.RefreshTokenLifeTime, err = time.ParseDuration(cfgF.RefreshTokenTTL); err != nil {
+			return fmt.Errorf("error parsing refresh token ttl %w", err)
+		}
+	}
+	if cfgF.KeyRotation != "" {
+		if c.SigningKeyRotation, err = time.ParseDuration(cfgF.KeyRotation); err != nil {
+			return fmt.Errorf("error parsing signing key rotation %w", err)
+		}
+	}
+	if cfgF.SigningAlgorithm != "" {
+		if c.SigningAlgorithm, err = auth.ParseAlgorithm(cfgF.SigningAlgorithm); err != nil {
+			c.SigningAlgorithm = defaultSigningAlgorithm
+			return fmt.Errorf("error parsing token signing algorithm %w", err)
+		}
+	}
+	if cfgF.SigningKeyFile != "" {
+		c.SigningKeyFile = cfgF.SigningKeyFile
+	}
+	if cfgF.OIDCIssuer != "" {
+		c.OIDCIssuer = cfgF.OIDCIssuer
+	}
+	if cfgF.OIDCClientID != "" {
+		c.OIDCClientID = cfgF.OIDCClientID
+	}
+	if cfgF.OIDCClientSecret != "" {
+		c.OIDCClientSecret = cfgF.OIDCClientSecret
+	}
+	if cfgF.OIDCRedirectURL != "" {
+		c.OIDCRedirectURL = cfgF.OIDCRedirectURL
+	}
+	if cfgF.CookieDomain != "" {
+		c.Cookie.Domain = cfgF.CookieDomain
+	}
+	if cfgF.CookiePath != "" {
+		c.Cookie.Path = cfgF.CookiePath
+	}
+	if cfgF.CookieSameSite != "" {
+		if c.Cookie.SameSite, err = auth.ParseSameSite(cfgF.CookieSameSite); err != nil {
+			c.Cookie.SameSite = http.SameSiteLaxMode
+			return fmt.Errorf("error parsing cookie samesite %w", err)
+		}
+	}
+	if cfgF.CookieSecure {
+		c.Cookie.Secure = true
+	}
 
 	return nil
 }
@@ -157,6 +529,20 @@ func (c *Config) build(logger *zap.Logger) {
 	flag.StringVar(&c.Storage.Database.DSN, "d", "", "StorageInDatabase DSN")
 	flag.StringVar(&c.TrustedSubNet, "t", defaultTrustedSubNet, "trusted subnet")
 	flag.BoolVar(&c.TLS, "s", defaultTLS, "TLS server mode")
+	flag.DurationVar(&c.URLRetention, "r", defaultURLRetention, "Retention period for deleted URLs")
+	flag.Func("domains", "Comma separated additional short domains", func(value string) error {
+		c.ShortDomains = splitList(value)
+		return nil
+	})
+	flag.StringVar(&c.URLPolicyFile, "policy", "", "Domain blocklist or allowlist file")
+	flag.Func("policy-mode", "Domain list mode: block or allow", func(value string) error {
+		mode, err := policy.ParseMode(value)
+		if err != nil {
+			return fmt.Errorf("error parsing url policy mode %w", err)
+		}
+		c.URLPolicyMode = mode
+		return nil
+	})
 
 	flag.StringVar(&c.ConfigPath, "c", "", "Config file path")
 	flag.StringVar(&c.ConfigPath, "config", "", "Config file path")
@@ -203,9 +589,157 @@ func (c *Config) build(logger *zap.Logger) {
 	if trustedSubNetEnv, ok = os.LookupEnv("TRUSTED_SUBNET"); ok {
 		c.TrustedSubNet = trustedSubNetEnv
 	}
+	lookupDurationEnv("URL_RETENTION", &c.URLRetention, logger)
+	lookupDurationEnv("PERMANENT_REDIRECT_MAX_AGE", &c.PermanentRedirectMaxAge, logger)
+	lookupDurationEnv("TEMPORARY_REDIRECT_MAX_AGE", &c.TemporaryRedirectMaxAge, logger)
+	if notYetActiveCodeEnv, ok := os.LookupEnv("NOT_YET_ACTIVE_CODE"); ok {
+		code, err := strconv.Atoi(notYetActiveCodeEnv)
+		if err != nil || !isErrorStatus(code) {
+			logger.Error("not yet active code must be 4xx or 5xx", zap.String("env", notYetActiveCodeEnv))
+		} else {
+			c.NotYetActiveCode = code
+		}
+	}
+	if notYetActiveBodyEnv, ok := os.LookupEnv("NOT_YET_ACTIVE_BODY"); ok {
+		c.NotYetActiveBody = notYetActiveBodyEnv
+	}
+	if shortDomainsEnv, ok := os.LookupEnv("SHORT_DOMAINS"); ok {
+		c.ShortDomains = splitList(shortDomainsEnv)
+	}
+	if policyFileEnv, ok := os.LookupEnv("URL_POLICY_FILE"); ok {
+		c.URLPolicyFile = policyFileEnv
+	}
+	lookupDurationEnv("HEALTH_CHECK_INTERVAL", &c.HealthCheckInterval, logger)
+	lookupDurationEnv("HEALTH_CHECK_TIMEOUT", &c.HealthCheckTimeout, logger)
+	lookupDurationEnv("HEALTH_CHECK_HOST_INTERVAL", &c.HealthCheckHostInterval, logger)
+	lookupPositiveIntEnv("HEALTH_CHECK_CONCURRENCY", &c.HealthCheckConcurrency, logger)
+	lookupPositiveIntEnv("HEALTH_BROKEN_AFTER", &c.HealthBrokenAfter, logger)
+	if _, ok = os.LookupEnv("HEALTH_CHECK_ALLOW_PRIVATE"); ok {
+		c.HealthCheckAllowPrivate = true
+	}
+	lookupDurationEnv("CLICK_FLUSH_INTERVAL", &c.ClickFlushInterval, logger)
+	lookupPositiveIntEnv("CLICK_BUFFER_SIZE", &c.ClickBufferSize, logger)
+	lookupPositiveIntEnv("CLICK_BATCH_SIZE", &c.ClickBatchSize, logger)
+	lookupDurationEnv("STATS_CACHE_TTL", &c.StatsCacheTTL, logger)
+	lookupPositiveIntEnv("STATS_TOP_LINKS", &c.StatsTopLinks, logger)
+	lookupPositiveIntEnv("LIVE_MAX_SUBSCRIBERS", &c.LiveMaxSubscribers, logger)
+	lookupPositiveIntEnv("LIVE_BUFFER_SIZE", &c.LiveBufferSize, logger)
+	lookupDurationEnv("ACCESS_TOKEN_TTL", &c.JWTTokenLifeTime, logger)
+	lookupDurationEnv("REFRESH_TOKEN_TTL", &c.RefreshTokenLifeTime, logger)
+	lookupDurationEnv("SIGNING_KEY_ROTATION", &c.SigningKeyRotation, logger)
+	if signingAlgorithmEnv, ok := os.LookupEnv("TOKEN_SIGNING_ALG"); ok {
+		alg, err := auth.ParseAlgorithm(signingAlgorithmEnv)
+		if err != nil {
+			logger.Error("error parsing token signing algorithm from env", zap.Error(err))
+		} else {
+			c.SigningAlgorithm = alg
+		}
+	}
+	if signingKeyFileEnv, ok := os.LookupEnv("SIGNING_KEY_FILE"); ok {
+		c.SigningKeyFile = signingKeyFileEnv
+	}
+	lookupStringEnv("OIDC_ISSUER", &c.OIDCIssuer)
+	lookupStringEnv("OIDC_CLIENT_ID", &c.OIDCClientID)
+	lookupStringEnv("OIDC_CLIENT_SECRET", &c.OIDCClientSecret)
+	lookupStringEnv("OIDC_REDIRECT_URL", &c.OIDCRedirectURL)
+	lookupStringEnv("COOKIE_DOMAIN", &c.Cookie.Domain)
+	lookupStringEnv("COOKIE_PATH", &c.Cookie.Path)
+	if sameSiteEnv, ok := os.LookupEnv("COOKIE_SAMESITE"); ok {
+		sameSite, err := auth.ParseSameSite(sameSiteEnv)
+		if err != nil {
+			logger.Error("error parsing cookie samesite from env", zap.Error(err))
+		} else {
+			c.Cookie.SameSite = sameSite
+		}
+	}
+	if _, ok = os.LookupEnv("COOKIE_SECURE"); ok {
+		c.Cookie.Secure = true
+	}
+	if traceExporterEnv, ok := os.LookupEnv("TRACE_EXPORTER"); ok {
+		c.TraceExporter = traceExporterEnv
+	}
+	if policyModeEnv, ok := os.LookupEnv("URL_POLICY_MODE"); ok {
+		mode, err := policy.ParseMode(policyModeEnv)
+		if err != nil {
+			logger.Error("error parsing url policy mode from env", zap.Error(err))
+		} else {
+			c.URLPolicyMode = mode
+		}
+	}
+
+	// Сервер под HTTPS всегда отдаёт cookie с токенами только по HTTPS.
+	if c.TLS {
+		c.Cookie.Secure = true
+	}
 
 	if c.Storage.Database.DSN != "" {
 		c.StorageMode = storage.StorageInDatabase
 		logger.Debug("Database mode ON")
 	}
 }
+
+// lookupStringEnv записывает в dst значение переменной окружения, если она задана.
+func lookupStringEnv(name string, dst *string) {
+	if value, ok := os.LookupEnv(name); ok {
+		*dst = value
+	}
+}
+
+// newOIDCProvider клиент провайдера OpenID Connect или nil, если вход через SSO не настроен.
+func (c *Config) newOIDCProvider(logger *zap.Logger) *auth.OIDCProvider {
+	if c.OIDCIssuer == "" {
+		return nil
+	}
+	if c.OIDCClientID == "" || c.OIDCRedirectURL == "" {
+		logger.Error("oidc login is disabled: oidc_client_id and oidc_redirect_url are required",
+			zap.String("issuer", c.OIDCIssuer))
+		return nil
+	}
+	return auth.NewOIDCProvider(c.OIDCIssuer, c.OIDCClientID, c.OIDCClientSecret, c.OIDCRedirectURL)
+}
+
+// lookupDurationEnv записывает в dst длительность из переменной окружения, если она задана и корректна.
+func lookupDurationEnv(name string, dst *time.Duration, logger *zap.Logger) {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		logger.Error("error parsing duration from env", zap.String("env", name), zap.Error(err))
+		return
+	}
+	*dst = d
+}
+
+// lookupPositiveIntEnv записывает в dst положительное число из переменной окружения, если оно задано и корректно.
+func lookupPositiveIntEnv(name string, dst *int, logger *zap.Logger) {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		logger.Error("env must be a positive integer", zap.String("env", name), zap.String("value", value))
+		return
+	}
+	*dst = n
+}
+
+// isErrorStatus код ответа клиентской или серверной ошибки.
+func isErrorStatus(code int) bool {
+	return code >= http.StatusBadRequest && code < 600
+}
+
+// splitList разбирает список значений через запятую, пропуская пустые.
+func splitList(value string) []string {
+	items := make([]string, 0)
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -3,21 +3,30 @@ package grpc
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/Melikhov-p/url-minimise/internal/clicks"
 	"github.com/Melikhov-p/url-minimise/internal/config"
 	"github.com/Melikhov-p/url-minimise/internal/contextkeys"
+	"github.com/Melikhov-p/url-minimise/internal/metrics"
 	"github.com/Melikhov-p/url-minimise/internal/models"
 	"github.com/Melikhov-p/url-minimise/internal/repository"
 	"github.com/Melikhov-p/url-minimise/internal/service"
 	storagePkg "github.com/Melikhov-p/url-minimise/internal/storage"
+	"github.com/Melikhov-p/url-minimise/internal/tracing"
 	"github.com/Melikhov-p/url-minimise/protos/gen/proto"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 // Shortener gRPC сервис shortener'а.
@@ -37,6 +46,11 @@ func NewShortenerService(log *zap.Logger, cfg *config.Config, store repository.S
 	}
 }
 
+// logger возвращает логгер с идентификаторами трассировки вызова.
+func (s *Shortener) logger(ctx context.Context) *zap.Logger {
+	return tracing.Logger(ctx, s.log)
+}
+
 // CreateURL создает новый короткий URL.
 func (s *Shortener) CreateURL(ctx context.Context, in *proto.CreateURLRequest) (*proto.CreateURLResponse, error) {
 	var (
@@ -53,31 +67,34 @@ func (s *Shortener) CreateURL(ctx context.Context, in *proto.CreateURLRequest) (
 	if !user.Service.IsAuthenticated {
 		user, err = service.AddNewUser(ctx, s.store, s.cfg)
 		if err != nil {
-			s.log.Error("error adding new user", zap.Error(err))
+			s.logger(ctx).Error("error adding new user", zap.Error(err))
 			return nil, status.Error(codes.Internal, "error adding new user.")
 		}
 	}
 
-	err = grpc.SendHeader(ctx, metadata.New(map[string]string{
-		"authorization": user.Service.Token,
-	}))
+	err = grpc.SendHeader(ctx, sessionMetadata(user))
 	if err != nil {
-		s.log.Error("error adding auth metadata in grpc response", zap.Error(err))
+		s.logger(ctx).Error("error adding auth metadata in grpc response", zap.Error(err))
 		return nil, status.Error(codes.Unauthenticated, "error returning token")
 	}
 
-	newURL, err := service.AddURL(ctx, s.store, s.log, in.GetOriginalUrl(), s.cfg, user.ID)
+	newURL, err := service.AddURLOnDomain(ctx, s.store, s.log, in.GetOriginalUrl(), in.GetDomain(), s.cfg, user.ID)
 	if err != nil {
-		if errors.Is(err, storagePkg.ErrOriginalURLExist) {
+		switch {
+		case errors.Is(err, storagePkg.ErrOriginalURLExist):
 			return nil, status.Error(codes.AlreadyExists, "original URL already exist.")
-		} else {
+		case errors.Is(err, service.ErrInvalidDomain):
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		case errors.Is(err, service.ErrDomainNotAllowed), errors.Is(err, service.ErrURLBlocked):
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		default:
 			return nil, status.Error(codes.Internal, "")
 		}
 	}
 
 	if saver, ok := s.store.(repository.StorageSaver); ok {
 		if err = saver.Save(newURL); err != nil {
-			s.log.Error("error saving new url", zap.Error(err), zap.String("original_url", in.GetOriginalUrl()))
+			s.logger(ctx).Error("error saving new url", zap.Error(err), zap.String("original_url", in.GetOriginalUrl()))
 			return nil, status.Error(codes.Internal, "")
 		}
 	}
@@ -94,17 +111,73 @@ func (s *Shortener) GetFullURL(ctx context.Context, in *proto.GetFullURLRequest)
 		err      error
 	)
 
+	result := metrics.RedirectMiss
+	defer func() {
+		s.cfg.Metrics.CountRedirect(result)
+	}()
+
 	matchURL, err = s.store.GetURL(ctx, in.GetShortUrl())
 	if err != nil {
-		s.log.Error("error finding original URL", zap.String("short", in.GetShortUrl()))
+		s.logger(ctx).Error("error finding original URL", zap.String("short", in.GetShortUrl()))
 		return nil, status.Error(codes.NotFound, "original url not found.")
 	}
 
-	res.OriginalUrl = matchURL.OriginalURL
+	switch err = service.CheckActiveWindow(matchURL, time.Now()); {
+	case errors.Is(err, service.ErrLinkNotYetActive):
+		return nil, status.Error(codes.FailedPrecondition, s.cfg.NotYetActiveBody)
+	case errors.Is(err, service.ErrLinkExpired):
+		return nil, status.Error(codes.NotFound, "link is no longer available.")
+	}
+
+	visit := s.visitFromContext(ctx)
+	visit.Query = in.GetQuery()
+
+	redirect := service.ResolveRedirect(matchURL, visit, s.cfg)
+	if service.IsQuarantined(s.cfg, matchURL, redirect.Location) {
+		return nil, status.Error(codes.PermissionDenied, "link is quarantined by url policy.")
+	}
+	res.OriginalUrl = redirect.Location
+	res.RedirectCode = int32(redirect.Code)
+	res.Variant = redirect.Variant
+
+	service.RecordClick(s.cfg, in.GetShortUrl(), visit, redirect.Variant)
+	result = metrics.RedirectHit
 
 	return &res, nil
 }
 
+// visitFromContext собирает данные посетителя из метаданных запроса.
+func (s *Shortener) visitFromContext(ctx context.Context) *models.Visit {
+	visit := &models.Visit{Time: time.Now()}
+
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return visit
+	}
+	if values := md.Get("user-agent"); len(values) > 0 {
+		visit.UserAgent = values[0]
+	}
+	if values := md.Get("accept-language"); len(values) > 0 {
+		visit.AcceptLanguage = values[0]
+	}
+	if values := md.Get("variant"); len(values) > 0 {
+		visit.Variant = values[0]
+	}
+	if values := md.Get("referer"); len(values) > 0 {
+		visit.Referrer = values[0]
+	}
+	var remoteAddr, realIP string
+	if p, ok := peer.FromContext(ctx); ok {
+		remoteAddr = p.Addr.String()
+	}
+	if values := md.Get("x-real-ip"); len(values) > 0 {
+		realIP = values[0]
+	}
+	visit.IP = service.VisitorIP(s.cfg, remoteAddr, realIP)
+
+	return visit
+}
+
 // CreateBatchURLs создает пачку новых URL.
 func (s *Shortener) CreateBatchURLs(
 	ctx context.Context,
@@ -122,16 +195,14 @@ func (s *Shortener) CreateBatchURLs(
 	if !user.Service.IsAuthenticated {
 		user, err = service.AddNewUser(ctx, s.store, s.cfg)
 		if err != nil {
-			s.log.Error("error adding new user", zap.Error(err))
+			s.logger(ctx).Error("error adding new user", zap.Error(err))
 			return nil, status.Error(codes.Internal, "error adding new user.")
 		}
 	}
 
-	err = grpc.SendHeader(ctx, metadata.New(map[string]string{
-		"authorization": user.Service.Token,
-	}))
+	err = grpc.SendHeader(ctx, sessionMetadata(user))
 	if err != nil {
-		s.log.Error("error adding auth metadata in grpc response", zap.Error(err))
+		s.logger(ctx).Error("error adding auth metadata in grpc response", zap.Error(err))
 		return nil, status.Error(codes.Unauthenticated, "error returning token")
 	}
 
@@ -140,20 +211,18 @@ func (s *Shortener) CreateBatchURLs(
 		originalURLs = append(originalURLs, url.GetOriginalUrl())
 	}
 
-	newURLs, err := repository.NewStorageMultiURL(ctx, originalURLs, s.store, s.cfg, user.ID)
+	newURLs, err := service.AddURLs(ctx, s.store, originalURLs, s.cfg, user.ID)
 	if err != nil {
-		s.log.Error("error getting new storage for multi urls", zap.Error(err))
-		return nil, status.Error(codes.Internal, "")
-	}
-
-	if err = s.store.AddURLs(ctx, newURLs); err != nil {
-		s.log.Error("error adding new urls to database", zap.Error(err))
+		if errors.Is(err, service.ErrURLBlocked) {
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+		s.logger(ctx).Error("error adding new urls", zap.Error(err))
 		return nil, status.Error(codes.Internal, "")
 	}
 
 	for i, url := range newURLs {
 		res.BatchUrls = append(res.BatchUrls, &proto.BatchResponseURL{
-			ShortUrl:      s.cfg.ResultAddr + "/" + url.ShortURL,
+			ShortUrl:      service.BuildShortURL(s.cfg, url.ShortURL),
 			CorrelationId: in.GetBatchUrls()[i].GetCorrelationId(),
 		})
 	}
@@ -161,11 +230,98 @@ func (s *Shortener) CreateBatchURLs(
 	return &res, nil
 }
 
+// batchStreamMaxErrors максимальное количество строк с ошибкой в ответе потокового создания пачки.
+const batchStreamMaxErrors = 100
+
+// CreateBatchURLStream создает пачку новых URL из потока клиента. URL сохраняются частями,
+// в ответе возвращаются счётчики и первые строки с ошибкой. При прерывании потока номер последней
+// сохранённой строки передаётся в trailer "batch-processed", клиент может продолжить со следующей строки.
+func (s *Shortener) CreateBatchURLStream(
+	stream grpc.ClientStreamingServer[proto.BatchURL, proto.CreateBatchURLStreamResponse],
+) error {
+	var err error
+	ctx := stream.Context()
+
+	user, ok := ctx.Value(contextkeys.ContextUserKey).(*models.User)
+	if !ok {
+		return status.Error(codes.Internal, "error getting user.")
+	}
+	if !user.Service.IsAuthenticated {
+		user, err = service.AddNewUser(ctx, s.store, s.cfg)
+		if err != nil {
+			s.logger(ctx).Error("error adding new user", zap.Error(err))
+			return status.Error(codes.Internal, "error adding new user.")
+		}
+	}
+
+	err = stream.SendHeader(sessionMetadata(user))
+	if err != nil {
+		s.logger(ctx).Error("error adding auth metadata in grpc response", zap.Error(err))
+		return status.Error(codes.Unauthenticated, "error returning token")
+	}
+
+	var (
+		res   proto.CreateBatchURLStreamResponse
+		index int
+	)
+	next := func() (*models.ImportResult, error) {
+		in, err := stream.Recv()
+		if err != nil {
+			return nil, fmt.Errorf("error receiving batch url %w", err)
+		}
+		index++
+		return &models.ImportResult{
+			Line:          index,
+			CorrelationID: in.GetCorrelationId(),
+			OriginalURL:   in.GetOriginalUrl(),
+		}, nil
+	}
+	emit := func(rows []*models.ImportResult) error {
+		for _, row := range rows {
+			switch {
+			case row.Error == "":
+				res.Created++
+				continue
+			case row.ShortURL != "":
+				res.Existing++
+			default:
+				res.Failed++
+			}
+			if len(res.Errors) < batchStreamMaxErrors {
+				res.Errors = append(res.Errors, &proto.BatchURLError{
+					Index:         int64(row.Line),
+					CorrelationId: row.CorrelationID,
+					OriginalUrl:   row.OriginalURL,
+					ShortUrl:      row.ShortURL,
+					Error:         row.Error,
+				})
+			}
+		}
+		return nil
+	}
+
+	processed, err := service.ImportStream(ctx, s.store, s.cfg, user.ID, next, emit)
+	res.Processed = int64(processed)
+	if err != nil {
+		s.logger(ctx).Info("batch stream interrupted", zap.Int("processed", processed), zap.Error(err))
+		stream.SetTrailer(metadata.Pairs("batch-processed", strconv.Itoa(processed)))
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return status.FromContextError(ctxErr).Err()
+		}
+		return status.Error(codes.Internal, "")
+	}
+
+	if err = stream.SendAndClose(&res); err != nil {
+		return fmt.Errorf("error sending batch stream response %w", err)
+	}
+	return nil
+}
+
 // MarkAsDelete помечает URL на удаление.
 func (s *Shortener) MarkAsDelete(ctx context.Context, in *proto.MarkDeletedURLs) (*emptypb.Empty, error) {
 	user, ok := ctx.Value(contextkeys.ContextUserKey).(*models.User)
 	if !ok {
-		s.log.Error("error getting user from context")
+		s.logger(ctx).Error("error getting user from context")
 		return nil, status.Error(codes.Internal, "")
 	}
 	if !user.Service.IsAuthenticated {
@@ -175,13 +331,702 @@ func (s *Shortener) MarkAsDelete(ctx context.Context, in *proto.MarkDeletedURLs)
 	go func() {
 		err := s.store.AddDeleteTask(in.GetShortUrls(), user.ID)
 		if err != nil {
-			s.log.Error("error adding new delete task in storage", zap.Error(err))
+			s.logger(ctx).Error("error adding new delete task in storage", zap.Error(err))
 		}
 	}()
 
 	return nil, status.Error(codes.OK, "")
 }
 
+// RestoreURLs восстанавливает удалённые URL пользователя в пределах срока хранения.
+func (s *Shortener) RestoreURLs(ctx context.Context, in *proto.RestoreURLsRequest) (*proto.RestoreURLsResponse, error) {
+	user, ok := ctx.Value(contextkeys.ContextUserKey).(*models.User)
+	if !ok {
+		s.logger(ctx).Error("error getting user from context")
+		return nil, status.Error(codes.Internal, "")
+	}
+
+	if !user.Service.IsAuthenticated {
+		return nil, status.Error(codes.Unauthenticated, "")
+	}
+
+	restored, err := service.RestoreURLs(ctx, in.GetShortUrls(), user.ID, s.store, s.cfg)
+	if err != nil {
+		s.logger(ctx).Error("error restoring user URLs", zap.Error(err))
+		return nil, status.Error(codes.Internal, "")
+	}
+
+	if len(restored) == 0 {
+		return nil, status.Error(codes.NotFound, "no URLs to restore")
+	}
+
+	return &proto.RestoreURLsResponse{ShortUrls: restored}, nil
+}
+
+// UpdateURLSettings изменяет настройки URL владельцем.
+func (s *Shortener) UpdateURLSettings(
+	ctx context.Context,
+	in *proto.UpdateURLSettingsRequest,
+) (*proto.URLSettings, error) {
+	user, ok := ctx.Value(contextkeys.ContextUserKey).(*models.User)
+	if !ok {
+		s.logger(ctx).Error("error getting user from context")
+		return nil, status.Error(codes.Internal, "")
+	}
+
+	if !user.Service.IsAuthenticated {
+		return nil, status.Error(codes.Unauthenticated, "")
+	}
+
+	var settings models.URLSettingsRequest
+	if in.RedirectCode != nil {
+		code := int(in.GetRedirectCode())
+		settings.RedirectCode = &code
+	}
+	if in.NoCache != nil {
+		noCache := in.GetNoCache()
+		settings.NoCache = &noCache
+	}
+	if in.QueryPassthrough != nil {
+		passthrough := in.GetQueryPassthrough()
+		settings.QueryPassthrough = &passthrough
+	}
+	if in.ActiveWindow != nil {
+		settings.ActiveFrom = nullableTime(in.GetActiveWindow().GetActiveFrom())
+		settings.ActiveUntil = nullableTime(in.GetActiveWindow().GetActiveUntil())
+	}
+	if in.Utm != nil {
+		settings.UTM = in.GetUtm().GetParams()
+		if settings.UTM == nil {
+			settings.UTM = map[string]string{}
+		}
+	}
+
+	updated, err := service.UpdateURLSettings(ctx, s.store, in.GetShortUrl(), user.ID, &settings)
+	if err != nil {
+		return nil, s.ownerError(ctx, err, "error updating url settings")
+	}
+
+	if saver, ok := s.store.(repository.StorageSaver); ok {
+		if err = saver.Save(updated); err != nil {
+			s.logger(ctx).Error("error saving updated url", zap.Error(err))
+			return nil, status.Error(codes.Internal, "")
+		}
+	}
+
+	res := &proto.URLSettings{
+		ShortUrl:         updated.ShortURL,
+		OriginalUrl:      updated.OriginalURL,
+		RedirectCode:     int32(service.RedirectCode(updated)),
+		NoCache:          updated.NoCache,
+		QueryPassthrough: updated.QueryPassthrough,
+		Utm:              updated.UTM,
+		Quarantined:      updated.Quarantined,
+	}
+	if updated.ActiveFrom != nil {
+		res.ActiveFrom = timestamppb.New(*updated.ActiveFrom)
+	}
+	if updated.ActiveUntil != nil {
+		res.ActiveUntil = timestamppb.New(*updated.ActiveUntil)
+	}
+
+	return res, nil
+}
+
+// nullableTime переводит необязательную отметку времени gRPC в поле запроса изменения настроек.
+func nullableTime(ts *timestamppb.Timestamp) models.NullableTime {
+	if ts == nil {
+		return models.NullableTime{Set: true}
+	}
+
+	t := ts.AsTime()
+	return models.NullableTime{Time: &t, Set: true}
+}
+
+// SetRedirectRules заменяет правила условного редиректа URL владельцем.
+func (s *Shortener) SetRedirectRules(ctx context.Context, in *proto.SetRedirectRulesRequest) (*emptypb.Empty, error) {
+	user, ok := ctx.Value(contextkeys.ContextUserKey).(*models.User)
+	if !ok {
+		s.logger(ctx).Error("error getting user from context")
+		return nil, status.Error(codes.Internal, "")
+	}
+
+	if !user.Service.IsAuthenticated {
+		return nil, status.Error(codes.Unauthenticated, "")
+	}
+
+	rules := make([]models.RedirectRule, 0, len(in.GetRules()))
+	for _, rule := range in.GetRules() {
+		rules = append(rules, ruleFromProto(rule))
+	}
+
+	err := service.SetRedirectRules(ctx, s.store, s.cfg, in.GetShortUrl(), user.ID, rules)
+	if err != nil {
+		return nil, s.ownerError(ctx, err, "error setting redirect rules")
+	}
+
+	if saver, ok := s.store.(repository.StorageSaver); ok {
+		updated, err := s.store.GetURL(ctx, in.GetShortUrl())
+		if err == nil {
+			err = saver.Save(updated)
+		}
+		if err != nil {
+			s.logger(ctx).Error("error saving url with redirect rules", zap.Error(err))
+			return nil, status.Error(codes.Internal, "")
+		}
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+// GetRedirectRules возвращает правила условного редиректа URL владельцу.
+func (s *Shortener) GetRedirectRules(
+	ctx context.Context,
+	in *proto.GetRedirectRulesRequest,
+) (*proto.RedirectRules, error) {
+	user, ok := ctx.Value(contextkeys.ContextUserKey).(*models.User)
+	if !ok {
+		s.logger(ctx).Error("error getting user from context")
+		return nil, status.Error(codes.Internal, "")
+	}
+
+	if !user.Service.IsAuthenticated {
+		return nil, status.Error(codes.Unauthenticated, "")
+	}
+
+	rules, err := service.GetRedirectRules(ctx, s.store, in.GetShortUrl(), user.ID)
+	if err != nil {
+		return nil, s.ownerError(ctx, err, "error getting redirect rules")
+	}
+
+	res := &proto.RedirectRules{Rules: make([]*proto.RedirectRule, 0, len(rules))}
+	for _, rule := range rules {
+		res.Rules = append(res.Rules, ruleToProto(rule))
+	}
+
+	return res, nil
+}
+
+// SetVariants заменяет варианты адреса назначения URL владельцем.
+func (s *Shortener) SetVariants(ctx context.Context, in *proto.SetVariantsRequest) (*emptypb.Empty, error) {
+	user, ok := ctx.Value(contextkeys.ContextUserKey).(*models.User)
+	if !ok {
+		s.logger(ctx).Error("error getting user from context")
+		return nil, status.Error(codes.Internal, "")
+	}
+
+	if !user.Service.IsAuthenticated {
+		return nil, status.Error(codes.Unauthenticated, "")
+	}
+
+	variants := make([]models.Variant, 0, len(in.GetVariants()))
+	for _, variant := range in.GetVariants() {
+		variants = append(variants, models.Variant{
+			Name:        variant.GetName(),
+			Destination: variant.GetDestination(),
+			Weight:      int(variant.GetWeight()),
+		})
+	}
+
+	err := service.SetVariants(ctx, s.store, s.cfg, in.GetShortUrl(), user.ID, variants)
+	if err != nil {
+		return nil, s.ownerError(ctx, err, "error setting variants")
+	}
+
+	if saver, ok := s.store.(repository.StorageSaver); ok {
+		updated, err := s.store.GetURL(ctx, in.GetShortUrl())
+		if err == nil {
+			err = saver.Save(updated)
+		}
+		if err != nil {
+			s.logger(ctx).Error("error saving url with variants", zap.Error(err))
+			return nil, status.Error(codes.Internal, "")
+		}
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+// GetVariants возвращает варианты адреса назначения URL со счётчиками показов владельцу.
+func (s *Shortener) GetVariants(ctx context.Context, in *proto.GetVariantsRequest) (*proto.Variants, error) {
+	user, ok := ctx.Value(contextkeys.ContextUserKey).(*models.User)
+	if !ok {
+		s.logger(ctx).Error("error getting user from context")
+		return nil, status.Error(codes.Internal, "")
+	}
+
+	if !user.Service.IsAuthenticated {
+		return nil, status.Error(codes.Unauthenticated, "")
+	}
+
+	variants, err := service.GetVariants(ctx, s.store, in.GetShortUrl(), user.ID)
+	if err != nil {
+		return nil, s.ownerError(ctx, err, "error getting variants")
+	}
+
+	res := &proto.Variants{Variants: make([]*proto.Variant, 0, len(variants))}
+	for _, variant := range variants {
+		res.Variants = append(res.Variants, &proto.Variant{
+			Name:        variant.Name,
+			Destination: variant.Destination,
+			Weight:      int32(variant.Weight),
+			Hits:        variant.Hits,
+		})
+	}
+
+	return res, nil
+}
+
+// RegisterDomain регистрирует дополнительный короткий домен за пользователем.
+func (s *Shortener) RegisterDomain(
+	ctx context.Context,
+	in *proto.RegisterDomainRequest,
+) (*proto.RegisterDomainResponse, error) {
+	user, ok := ctx.Value(contextkeys.ContextUserKey).(*models.User)
+	if !ok {
+		s.logger(ctx).Error("error getting user from context")
+		return nil, status.Error(codes.Internal, "")
+	}
+
+	if !user.Service.IsAuthenticated {
+		return nil, status.Error(codes.Unauthenticated, "")
+	}
+
+	domain, err := service.RegisterDomain(ctx, s.store, s.cfg, in.GetDomain(), user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidDomain):
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		case errors.Is(err, storagePkg.ErrDomainExist):
+			return nil, status.Error(codes.AlreadyExists, "domain already registered.")
+		case errors.Is(err, service.ErrDomainNotVerified):
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		default:
+			s.logger(ctx).Error("error registering domain", zap.Error(err))
+			return nil, status.Error(codes.Internal, "")
+		}
+	}
+
+	return &proto.RegisterDomainResponse{Domain: domain}, nil
+}
+
+// GetUserDomains возвращает домены, на которых пользователь может создавать ссылки.
+func (s *Shortener) GetUserDomains(ctx context.Context, _ *emptypb.Empty) (*proto.UserDomains, error) {
+	user, ok := ctx.Value(contextkeys.ContextUserKey).(*models.User)
+	if !ok {
+		s.logger(ctx).Error("error getting user from context")
+		return nil, status.Error(codes.Internal, "")
+	}
+
+	if !user.Service.IsAuthenticated {
+		return nil, status.Error(codes.Unauthenticated, "")
+	}
+
+	domains, err := service.GetUserDomains(ctx, s.store, s.cfg, user.ID)
+	if err != nil {
+		s.logger(ctx).Error("error getting user domains", zap.Error(err))
+		return nil, status.Error(codes.Internal, "")
+	}
+
+	return &proto.UserDomains{
+		Primary:    domains.Primary,
+		Shared:     domains.Shared,
+		Registered: domains.Registered,
+	}, nil
+}
+
+// GetBrokenURLs возвращает ссылки пользователя, адрес назначения которых не отвечает.
+func (s *Shortener) GetBrokenURLs(ctx context.Context, _ *emptypb.Empty) (*proto.BrokenURLs, error) {
+	user, ok := ctx.Value(contextkeys.ContextUserKey).(*models.User)
+	if !ok {
+		s.logger(ctx).Error("error getting user from context")
+		return nil, status.Error(codes.Internal, "")
+	}
+
+	if !user.Service.IsAuthenticated {
+		return nil, status.Error(codes.Unauthenticated, "")
+	}
+
+	broken, err := service.GetBrokenURLs(ctx, s.store, s.cfg, user.ID)
+	if err != nil {
+		s.logger(ctx).Error("error getting broken urls", zap.Error(err))
+		return nil, status.Error(codes.Internal, "")
+	}
+
+	var res proto.BrokenURLs
+	for _, url := range broken {
+		res.BrokenUrls = append(res.BrokenUrls, &proto.BrokenURL{
+			ShortUrl:    url.ShortURL,
+			OriginalUrl: url.OriginalURL,
+			StatusCode:  int32(url.StatusCode),
+			Error:       url.Error,
+			LatencyMs:   url.LatencyMs,
+			Failures:    int32(url.Failures),
+			CheckedAt:   timestamppb.New(url.CheckedAt),
+		})
+	}
+
+	return &res, nil
+}
+
+// GetLinkStats получить статистику переходов по URL владельцем.
+func (s *Shortener) GetLinkStats(ctx context.Context, in *proto.GetLinkStatsRequest) (*proto.LinkStats, error) {
+	user, ok := ctx.Value(contextkeys.ContextUserKey).(*models.User)
+	if !ok {
+		s.logger(ctx).Error("error getting user from context")
+		return nil, status.Error(codes.Internal, "")
+	}
+
+	if !user.Service.IsAuthenticated {
+		return nil, status.Error(codes.Unauthenticated, "")
+	}
+
+	if in.GetTop() < 0 {
+		return nil, status.Error(codes.InvalidArgument, "top must be positive.")
+	}
+	query := models.ClickStatsQuery{
+		Bucket: models.StatsBucket(in.GetBucket()),
+		Top:    int(in.GetTop()),
+	}
+	if in.From != nil {
+		query.From = in.GetFrom().AsTime()
+	}
+	if in.To != nil {
+		query.To = in.GetTo().AsTime()
+	}
+
+	stats, err := service.GetLinkStats(ctx, s.store, in.GetShortUrl(), user.ID, query)
+	if err != nil {
+		return nil, s.ownerError(ctx, err, "error getting link stats")
+	}
+
+	res := proto.LinkStats{
+		ShortUrl:       stats.ShortURL,
+		From:           timestamppb.New(stats.From),
+		To:             timestamppb.New(stats.To),
+		Bucket:         string(stats.Bucket),
+		TopReferrers:   clickCountsToProto(stats.TopReferrers),
+		TopUserAgents:  clickCountsToProto(stats.TopUserAgents),
+		Languages:      clickCountsToProto(stats.Languages),
+		TotalClicks:    stats.TotalClicks,
+		RangeClicks:    stats.RangeClicks,
+		UniqueVisitors: stats.UniqueVisitors,
+	}
+	for _, point := range stats.Series {
+		res.Series = append(res.Series, &proto.StatsPoint{Time: timestamppb.New(point.Time), Clicks: point.Clicks})
+	}
+
+	return &res, nil
+}
+
+func clickCountsToProto(counts []models.ClickCount) []*proto.ClickCount {
+	res := make([]*proto.ClickCount, 0, len(counts))
+	for _, count := range counts {
+		res = append(res, &proto.ClickCount{Value: count.Value, Clicks: count.Clicks})
+	}
+	return res
+}
+
+// WatchClicks отдавать владельцу переходы по ссылке в реальном времени, пока клиент не закроет поток.
+// Если клиент не успевает читать, часть переходов отбрасывается, а поле dropped следующего
+// перехода содержит общее число потерянных.
+func (s *Shortener) WatchClicks(
+	in *proto.WatchClicksRequest,
+	stream grpc.ServerStreamingServer[proto.LiveClick],
+) error {
+	ctx := stream.Context()
+
+	user, ok := ctx.Value(contextkeys.ContextUserKey).(*models.User)
+	if !ok {
+		s.logger(ctx).Error("error getting user from context")
+		return status.Error(codes.Internal, "")
+	}
+	if !user.Service.IsAuthenticated {
+		return status.Error(codes.Unauthenticated, "")
+	}
+
+	sub, err := service.SubscribeClicks(ctx, s.cfg, s.store, in.GetShortUrl(), user.ID)
+	if errors.Is(err, clicks.ErrTooManySubscribers) {
+		return status.Error(codes.ResourceExhausted, "too many live click subscribers.")
+	}
+	if err != nil {
+		return s.ownerError(ctx, err, "error subscribing to live clicks")
+	}
+	defer sub.Close()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		case event, open := <-sub.Events():
+			if !open {
+				return status.Error(codes.Unavailable, "server is shutting down.")
+			}
+			click := service.LiveClickFromEvent(event)
+			err = stream.Send(&proto.LiveClick{
+				Time:      timestamppb.New(click.Time),
+				ShortUrl:  click.ShortURL,
+				Referrer:  click.Referrer,
+				UserAgent: click.UserAgent,
+				Language:  click.Language,
+				Dropped:   sub.Dropped(),
+			})
+			if err != nil {
+				return fmt.Errorf("error sending live click %w", err)
+			}
+		}
+	}
+}
+
+// Register регистрирует аккаунт. Ссылки анонимной сессии переходят в аккаунт,
+// токен аккаунта возвращается в ответе и в заголовке authorization.
+func (s *Shortener) Register(ctx context.Context, in *proto.AccountRequest) (*proto.AccountResponse, error) {
+	return s.signIn(ctx, in, service.Register)
+}
+
+// Login выполняет вход в аккаунт. Ссылки анонимной сессии переходят в аккаунт,
+// токен аккаунта возвращается в ответе и в заголовке authorization.
+func (s *Shortener) Login(ctx context.Context, in *proto.AccountRequest) (*proto.AccountResponse, error) {
+	return s.signIn(ctx, in, service.Login)
+}
+
+// signIn выполняет регистрацию или вход и переводит ошибки в коды gRPC.
+func (s *Shortener) signIn(
+	ctx context.Context,
+	in *proto.AccountRequest,
+	action service.SignInFunc,
+) (*proto.AccountResponse, error) {
+	current, ok := ctx.Value(contextkeys.ContextUserKey).(*models.User)
+	if !ok {
+		s.logger(ctx).Error("error getting user from context")
+		return nil, status.Error(codes.Internal, "")
+	}
+
+	user, merged, err := action(ctx, s.store, s.cfg, current, in.GetEmail(), in.GetPassword())
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidEmail), errors.Is(err, service.ErrWeakPassword):
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		case errors.Is(err, service.ErrInvalidCredentials):
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		case errors.Is(err, storagePkg.ErrAccountExist):
+			return nil, status.Error(codes.AlreadyExists, "account already registered.")
+		default:
+			s.logger(ctx).Error("error signing in to account", zap.Error(err))
+			return nil, status.Error(codes.Internal, "")
+		}
+	}
+
+	err = grpc.SendHeader(ctx, sessionMetadata(user))
+	if err != nil {
+		s.logger(ctx).Error("error adding auth metadata in grpc response", zap.Error(err))
+	}
+
+	return &proto.AccountResponse{
+		UserId:       int64(user.ID),
+		Email:        user.Email,
+		Token:        user.Service.Token,
+		MergedUrls:   int64(merged),
+		RefreshToken: user.Service.RefreshToken,
+	}, nil
+}
+
+// Refresh обменивает токен обновления на новую пару токенов. Предъявленный токен больше не действует,
+// новые токены возвращаются в ответе и в заголовках authorization и refresh-token.
+func (s *Shortener) Refresh(ctx context.Context, in *proto.RefreshRequest) (*proto.Tokens, error) {
+	user, err := service.RefreshTokens(ctx, s.store, s.cfg, s.logger(ctx), in.GetRefreshToken())
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidRefreshToken) {
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		}
+		s.logger(ctx).Error("error refreshing tokens", zap.Error(err))
+		return nil, status.Error(codes.Internal, "")
+	}
+
+	if err = grpc.SendHeader(ctx, sessionMetadata(user)); err != nil {
+		s.logger(ctx).Error("error adding auth metadata in grpc response", zap.Error(err))
+	}
+
+	return &proto.Tokens{
+		AccessToken:  user.Service.Token,
+		RefreshToken: user.Service.RefreshToken,
+		ExpiresIn:    int64(s.cfg.JWTTokenLifeTime.Seconds()),
+	}, nil
+}
+
+// Logout завершает сессию: отзывает токен доступа из заголовка authorization и токены обновления сессии.
+func (s *Shortener) Logout(ctx context.Context, in *proto.RefreshRequest) (*emptypb.Empty, error) {
+	var accessToken string
+	if md, ok := metadata.FromIncomingContext(ctx); ok && len(md.Get("authorization")) > 0 {
+		accessToken = strings.TrimPrefix(md.Get("authorization")[0], "Bearer ")
+	}
+
+	if err := service.Logout(ctx, s.store, s.cfg, accessToken, in.GetRefreshToken()); err != nil {
+		s.logger(ctx).Error("error logging out", zap.Error(err))
+		return nil, status.Error(codes.Internal, "")
+	}
+	return &emptypb.Empty{}, nil
+}
+
+// sessionMetadata заголовки ответа с токенами сессии. Токен обновления передаётся,
+// только если выдана новая сессия.
+func sessionMetadata(user *models.User) metadata.MD {
+	md := metadata.Pairs("authorization", user.Service.Token)
+	if user.Service.RefreshToken != "" {
+		md.Set("refresh-token", user.Service.RefreshToken)
+	}
+	return md
+}
+
+// CreateAPIKey создаёт ключ API пользователя. Сам ключ возвращается в поле key один раз.
+func (s *Shortener) CreateAPIKey(ctx context.Context, in *proto.CreateAPIKeyRequest) (*proto.APIKey, error) {
+	user, ok := ctx.Value(contextkeys.ContextUserKey).(*models.User)
+	if !ok {
+		s.logger(ctx).Error("error getting user from context")
+		return nil, status.Error(codes.Internal, "")
+	}
+	if !user.Service.IsAuthenticated {
+		return nil, status.Error(codes.Unauthenticated, "")
+	}
+
+	req := models.APIKeyRequest{Name: in.GetName()}
+	for _, scope := range in.GetScopes() {
+		req.Scopes = append(req.Scopes, models.APIScope(scope))
+	}
+	if in.GetExpiresAt() != nil {
+		expiresAt := in.GetExpiresAt().AsTime()
+		req.ExpiresAt = &expiresAt
+	}
+
+	key, rawKey, err := service.CreateAPIKey(ctx, s.store, user.ID, req)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidScope) || errors.Is(err, service.ErrInvalidAPIKeyRequest) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		s.logger(ctx).Error("error creating api key", zap.Error(err))
+		return nil, status.Error(codes.Internal, "")
+	}
+
+	res := apiKeyToProto(key)
+	res.Key = rawKey
+	return res, nil
+}
+
+// ListAPIKeys возвращает ключи API пользователя без самих ключей.
+func (s *Shortener) ListAPIKeys(ctx context.Context, _ *emptypb.Empty) (*proto.APIKeys, error) {
+	user, ok := ctx.Value(contextkeys.ContextUserKey).(*models.User)
+	if !ok {
+		s.logger(ctx).Error("error getting user from context")
+		return nil, status.Error(codes.Internal, "")
+	}
+	if !user.Service.IsAuthenticated {
+		return nil, status.Error(codes.Unauthenticated, "")
+	}
+
+	keys, err := service.GetUserAPIKeys(ctx, s.store, user.ID)
+	if err != nil {
+		s.logger(ctx).Error("error getting user api keys", zap.Error(err))
+		return nil, status.Error(codes.Internal, "")
+	}
+
+	res := &proto.APIKeys{Keys: make([]*proto.APIKey, 0, len(keys))}
+	for _, key := range keys {
+		res.Keys = append(res.Keys, apiKeyToProto(key))
+	}
+	return res, nil
+}
+
+// RevokeAPIKey отзывает ключ API пользователя.
+func (s *Shortener) RevokeAPIKey(ctx context.Context, in *proto.RevokeAPIKeyRequest) (*emptypb.Empty, error) {
+	user, ok := ctx.Value(contextkeys.ContextUserKey).(*models.User)
+	if !ok {
+		s.logger(ctx).Error("error getting user from context")
+		return nil, status.Error(codes.Internal, "")
+	}
+	if !user.Service.IsAuthenticated {
+		return nil, status.Error(codes.Unauthenticated, "")
+	}
+
+	if err := service.RevokeAPIKey(ctx, s.store, user.ID, in.GetId()); err != nil {
+		if errors.Is(err, storagePkg.ErrNotFound) {
+			return nil, status.Error(codes.NotFound, "api key not found.")
+		}
+		s.logger(ctx).Error("error revoking api key", zap.Error(err))
+		return nil, status.Error(codes.Internal, "")
+	}
+	return &emptypb.Empty{}, nil
+}
+
+// apiKeyToProto переводит ключ API в сообщение без хеша.
+func apiKeyToProto(key *models.APIKey) *proto.APIKey {
+	res := &proto.APIKey{
+		Id:        key.ID,
+		Name:      key.Name,
+		CreatedAt: timestamppb.New(key.CreatedAt),
+	}
+	for _, scope := range key.Scopes {
+		res.Scopes = append(res.Scopes, string(scope))
+	}
+	if key.ExpiresAt != nil {
+		res.ExpiresAt = timestamppb.New(*key.ExpiresAt)
+	}
+	return res
+}
+
+// ownerError переводит ошибку операции владельца над своим URL в статус gRPC.
+func (s *Shortener) ownerError(ctx context.Context, err error, msg string) error {
+	switch {
+	case errors.Is(err, storagePkg.ErrNotFound), errors.Is(err, service.ErrNotURLOwner):
+		return status.Error(codes.NotFound, "url not found.")
+	case errors.Is(err, service.ErrInvalidRedirectCode),
+		errors.Is(err, service.ErrInvalidRedirectRule),
+		errors.Is(err, service.ErrInvalidVariant),
+		errors.Is(err, service.ErrInvalidUTMTemplate),
+		errors.Is(err, service.ErrInvalidActiveWindow),
+		errors.Is(err, service.ErrInvalidStatsQuery):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, service.ErrURLBlocked):
+		return status.Error(codes.PermissionDenied, err.Error())
+	default:
+		s.logger(ctx).Error(msg, zap.Error(err))
+		return status.Error(codes.Internal, "")
+	}
+}
+
+func ruleFromProto(in *proto.RedirectRule) models.RedirectRule {
+	rule := models.RedirectRule{
+		Device:      models.DeviceClass(in.GetDevice()),
+		Language:    in.GetLanguage(),
+		Destination: in.GetDestination(),
+	}
+	if in.NotBefore != nil {
+		notBefore := in.GetNotBefore().AsTime()
+		rule.NotBefore = &notBefore
+	}
+	if in.NotAfter != nil {
+		notAfter := in.GetNotAfter().AsTime()
+		rule.NotAfter = &notAfter
+	}
+
+	return rule
+}
+
+func ruleToProto(rule models.RedirectRule) *proto.RedirectRule {
+	res := &proto.RedirectRule{
+		Device:      string(rule.Device),
+		Language:    rule.Language,
+		Destination: rule.Destination,
+	}
+	if rule.NotBefore != nil {
+		res.NotBefore = timestamppb.New(*rule.NotBefore)
+	}
+	if rule.NotAfter != nil {
+		res.NotAfter = timestamppb.New(*rule.NotAfter)
+	}
+
+	return res
+}
+
 // GetServiceStats возвращает статистику сервиса.
 func (s *Shortener) GetServiceStats(ctx context.Context, _ *emptypb.Empty) (*proto.GetServiceStatsResponse, error) {
 	var (
@@ -190,24 +1035,22 @@ func (s *Shortener) GetServiceStats(ctx context.Context, _ *emptypb.Empty) (*pro
 		usrIP       net.IP
 		trustedNet  *net.IPNet
 		err         error
-		usersCount  int
-		urlsCount   int
 	)
 
 	if usrIPHeader, _ = ctx.Value("X-Real-IP").(string); usrIPHeader == "" {
-		s.log.Error("empty X-Real-IP header in stats request")
+		s.logger(ctx).Error("empty X-Real-IP header in stats request")
 		return nil, status.Error(codes.PermissionDenied, "forbidden")
 	}
 
 	usrIP = net.ParseIP(usrIPHeader)
 	if usrIP == nil {
-		s.log.Error("error parsing IP from header", zap.String("IP header", usrIPHeader))
+		s.logger(ctx).Error("error parsing IP from header", zap.String("IP header", usrIPHeader))
 		return nil, status.Error(codes.PermissionDenied, "forbidden")
 	}
 
 	_, trustedNet, err = net.ParseCIDR(s.cfg.TrustedSubNet)
 	if err != nil {
-		s.log.Error("error parsing CIDR from config", zap.Error(err))
+		s.logger(ctx).Error("error parsing CIDR from config", zap.Error(err))
 		return nil, status.Error(codes.Internal, "")
 	}
 
@@ -215,19 +1058,27 @@ func (s *Shortener) GetServiceStats(ctx context.Context, _ *emptypb.Empty) (*pro
 		return nil, status.Error(codes.PermissionDenied, "forbidden")
 	}
 
-	usersCount, err = s.store.GetUsersCount(ctx)
-	if err != nil {
-		s.log.Error("error getting users count", zap.Error(err))
-		return nil, status.Error(codes.Internal, "")
-	}
-	urlsCount, err = s.store.GetURLsCount(ctx)
+	stats, err := service.GetServiceStats(ctx, s.cfg, s.store)
 	if err != nil {
-		s.log.Error("error getting urls count", zap.Error(err))
+		s.logger(ctx).Error("error getting service stats", zap.Error(err))
 		return nil, status.Error(codes.Internal, "")
 	}
 
-	res.Users = int32(usersCount)
-	res.Urls = int32(urlsCount)
+	res.Users = int32(stats.Users)
+	res.Urls = int32(stats.URLs)
+	res.PurgedUrls = int32(stats.PurgedURLs)
+	res.DroppedClicks = stats.DroppedClicks
+	res.UniqueVisitors = stats.UniqueVisitors
+	res.DeletedUrls = int32(stats.DeletedURLs)
+	res.CreatedLastHour = int32(stats.CreatedLastHour)
+	res.CreatedLastDay = int32(stats.CreatedLastDay)
+	res.CreatedLastWeek = int32(stats.CreatedLastWeek)
+	res.PendingDeleteTasks = int32(stats.PendingDeleteTasks)
+	res.TotalClicks = stats.TotalClicks
+	res.GeneratedAt = timestamppb.New(stats.GeneratedAt)
+	for _, link := range stats.TopLinks {
+		res.TopLinks = append(res.TopLinks, &proto.LinkClicks{ShortUrl: link.ShortURL, Clicks: link.Clicks})
+	}
 
 	return &res, nil
 }
@@ -242,7 +1093,7 @@ func (s *Shortener) GetUserURLs(ctx context.Context, _ *emptypb.Empty) (*proto.G
 
 	user, ok := ctx.Value(contextkeys.ContextUserKey).(*models.User)
 	if !ok {
-		s.log.Error("error getting user from context")
+		s.logger(ctx).Error("error getting user from context")
 		return nil, status.Error(codes.Internal, "")
 	}
 	if !user.Service.IsAuthenticated {
@@ -252,17 +1103,15 @@ func (s *Shortener) GetUserURLs(ctx context.Context, _ *emptypb.Empty) (*proto.G
 		}
 	}
 
-	err = grpc.SendHeader(ctx, metadata.New(map[string]string{
-		"authorization": user.Service.Token,
-	}))
+	err = grpc.SendHeader(ctx, sessionMetadata(user))
 	if err != nil {
-		s.log.Error("error adding auth metadata in grpc response", zap.Error(err))
+		s.logger(ctx).Error("error adding auth metadata in grpc response", zap.Error(err))
 		return nil, status.Error(codes.Unauthenticated, "error returning token")
 	}
 
 	urls, err := s.store.GetURLsByUserID(ctx, user.ID)
 	if err != nil {
-		s.log.Error("error getting user URLs", zap.Error(err))
+		s.logger(ctx).Error("error getting user URLs", zap.Error(err))
 		return nil, status.Error(codes.Internal, "error collecting URLs")
 	}
 
@@ -274,6 +1123,7 @@ func (s *Shortener) GetUserURLs(ctx context.Context, _ *emptypb.Empty) (*proto.G
 		res.UserUrls = append(res.UserUrls, &proto.UserURL{
 			ShortUrl:    url.ShortURL,
 			OriginalUrl: url.OriginalURL,
+			Quarantined: url.Quarantined,
 		})
 	}
 
@@ -283,7 +1133,7 @@ func (s *Shortener) GetUserURLs(ctx context.Context, _ *emptypb.Empty) (*proto.G
 // Ping пингует базу данных.
 func (s *Shortener) Ping(ctx context.Context, _ *emptypb.Empty) (*emptypb.Empty, error) {
 	if err := s.store.Ping(ctx); err != nil {
-		s.log.Error("database is unavailable from ping method", zap.Error(err))
+		s.logger(ctx).Error("database is unavailable from ping method", zap.Error(err))
 		return nil, status.Error(codes.Internal, "can not ping database")
 	}
 
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/Melikhov-p/url-minimise/internal/config"
+	"github.com/Melikhov-p/url-minimise/internal/contextkeys"
+	"github.com/Melikhov-p/url-minimise/internal/models"
+	"github.com/Melikhov-p/url-minimise/internal/repository"
+	"github.com/Melikhov-p/url-minimise/internal/service"
+	storagePkg "github.com/Melikhov-p/url-minimise/internal/storage"
+	"go.uber.org/zap"
+)
+
+// APIRegister зарегистрировать аккаунт по почте и паролю. Ссылки анонимной сессии переходят в аккаунт.
+func APIRegister(
+	w http.ResponseWriter,
+	r *http.Request,
+	cfg *config.Config,
+	storage repository.Storage,
+	logger *zap.Logger,
+) {
+	handleAccount(w, r, cfg, storage, logger, service.Register, http.StatusCreated)
+}
+
+// APILogin войти в аккаунт по почте и паролю. Ссылки анонимной сессии переходят в аккаунт.
+func APILogin(
+	w http.ResponseWriter,
+	r *http.Request,
+	cfg *config.Config,
+	storage repository.Storage,
+	logger *zap.Logger,
+) {
+	handleAccount(w, r, cfg, storage, logger, service.Login, http.StatusOK)
+}
+
+// handleAccount выполняет регистрацию или вход и выдаёт токен аккаунта в cookie.
+func handleAccount(
+	w http.ResponseWriter,
+	r *http.Request,
+	cfg *config.Config,
+	storage repository.Storage,
+	logger *zap.Logger,
+	action service.SignInFunc,
+	successCode int,
+) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx := r.Context()
+	current, ok := ctx.Value(contextkeys.ContextUserKey).(*models.User)
+	if !ok {
+		logger.Error(errGetContextUser.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	var req models.AccountRequest
+	dec := json.NewDecoder(r.Body)
+	if err := dec.Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		logger.Debug("error decoding account request", zap.Error(err))
+		return
+	}
+
+	user, merged, err := action(ctx, storage, cfg, current, req.Email, req.Password)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidEmail), errors.Is(err, service.ErrWeakPassword):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, service.ErrInvalidCredentials):
+			w.WriteHeader(http.StatusUnauthorized)
+		case errors.Is(err, storagePkg.ErrAccountExist):
+			w.WriteHeader(http.StatusConflict)
+		default:
+			logger.Error("error signing in to account", zap.Error(err))
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	setSessionCookies(w, r, cfg, logger, user)
+
+	enc := json.NewEncoder(w)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(successCode)
+
+	if err = enc.Encode(models.AccountResponse{Email: user.Email, UserID: user.ID, MergedURLs: merged}); err != nil {
+		logger.Error("error encoding account response", zap.Error(err))
+	}
+}
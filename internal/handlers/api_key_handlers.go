@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/Melikhov-p/url-minimise/internal/config"
+	"github.com/Melikhov-p/url-minimise/internal/contextkeys"
+	"github.com/Melikhov-p/url-minimise/internal/models"
+	"github.com/Melikhov-p/url-minimise/internal/repository"
+	"github.com/Melikhov-p/url-minimise/internal/service"
+	storagePkg "github.com/Melikhov-p/url-minimise/internal/storage"
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+// APICreateAPIKey создать ключ API пользователя. Сам ключ отдаётся в ответе один раз.
+func APICreateAPIKey(
+	w http.ResponseWriter,
+	r *http.Request,
+	_ *config.Config,
+	storage repository.Storage,
+	logger *zap.Logger,
+) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx := r.Context()
+	user, ok := ctx.Value(contextkeys.ContextUserKey).(*models.User)
+	if !ok {
+		logger.Error(errGetContextUser.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !user.Service.IsAuthenticated {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var req models.APIKeyRequest
+	dec := json.NewDecoder(r.Body)
+	if err := dec.Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		logger.Debug("error decoding api key request", zap.Error(err))
+		return
+	}
+
+	key, rawKey, err := service.CreateAPIKey(ctx, storage, user.ID, req)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidScope) || errors.Is(err, service.ErrInvalidAPIKeyRequest) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		logger.Error("error creating api key", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	res := service.APIKeyResponse(key)
+	res.Key = rawKey
+
+	enc := json.NewEncoder(w)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+
+	if err = enc.Encode(res); err != nil {
+		logger.Error("error encoding api key response", zap.Error(err))
+	}
+}
+
+// APIGetAPIKeys получить ключи API пользователя без самих ключей.
+func APIGetAPIKeys(
+	w http.ResponseWriter,
+	r *http.Request,
+	_ *config.Config,
+	storage repository.Storage,
+	logger *zap.Logger,
+) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx := r.Context()
+	user, ok := ctx.Value(contextkeys.ContextUserKey).(*models.User)
+	if !ok {
+		logger.Error(errGetContextUser.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !user.Service.IsAuthenticated {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	keys, err := service.GetUserAPIKeys(ctx, storage, user.ID)
+	if err != nil {
+		logger.Error("error getting user api keys", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	res := make([]models.APIKeyResponse, 0, len(keys))
+	for _, key := range keys {
+		res = append(res, service.APIKeyResponse(key))
+	}
+
+	enc := json.NewEncoder(w)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	if err = enc.Encode(res); err != nil {
+		logger.Error("error encoding api keys response", zap.Error(err))
+	}
+}
+
+// APIRevokeAPIKey отозвать ключ API пользователя.
+func APIRevokeAPIKey(
+	w http.ResponseWriter,
+	r *http.Request,
+	_ *config.Config,
+	storage repository.Storage,
+	logger *zap.Logger,
+) {
+	if r.Method != http.MethodDelete {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx := r.Context()
+	user, ok := ctx.Value(contextkeys.ContextUserKey).(*models.User)
+	if !ok {
+		logger.Error(errGetContextUser.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !user.Service.IsAuthenticated {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	err := service.RevokeAPIKey(ctx, storage, user.ID, chi.URLParam(r, "id"))
+	if err != nil {
+		if errors.Is(err, storagePkg.ErrNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		logger.Error("error revoking api key", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/Melikhov-p/url-minimise/internal/config"
+	"github.com/Melikhov-p/url-minimise/internal/contextkeys"
+	"github.com/Melikhov-p/url-minimise/internal/models"
+	"github.com/Melikhov-p/url-minimise/internal/repository"
+	"github.com/Melikhov-p/url-minimise/internal/service"
+	storagePkg "github.com/Melikhov-p/url-minimise/internal/storage"
+	"go.uber.org/zap"
+)
+
+// APIRegisterDomain зарегистрировать дополнительный короткий домен за пользователем.
+func APIRegisterDomain(
+	w http.ResponseWriter,
+	r *http.Request,
+	cfg *config.Config,
+	storage repository.Storage,
+	logger *zap.Logger,
+) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx := r.Context()
+	user, ok := ctx.Value(contextkeys.ContextUserKey).(*models.User)
+	if !ok {
+		logger.Error(errGetContextUser.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !user.Service.IsAuthenticated {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var req models.DomainRequest
+	dec := json.NewDecoder(r.Body)
+	if err := dec.Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		logger.Error("error decoding domain request", zap.Error(err))
+		return
+	}
+
+	domain, err := service.RegisterDomain(ctx, storage, cfg, req.Domain, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidDomain):
+			w.WriteHeader(http.StatusBadRequest)
+		case errors.Is(err, storagePkg.ErrDomainExist):
+			w.WriteHeader(http.StatusConflict)
+		case errors.Is(err, service.ErrDomainNotVerified):
+			writeDomainVerification(w, cfg, req.Domain, user.ID, logger)
+		default:
+			logger.Error("error registering domain", zap.Error(err))
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	enc := json.NewEncoder(w)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+
+	if err = enc.Encode(models.DomainRequest{Domain: domain}); err != nil {
+		logger.Error("error encoding domain response", zap.Error(err))
+	}
+}
+
+// writeDomainVerification отвечает 403 с записями DNS, которыми пользователь подтверждает владение доменом.
+func writeDomainVerification(w http.ResponseWriter, cfg *config.Config, domain string, userID int, logger *zap.Logger) {
+	verification, err := service.DomainVerification(cfg, domain, userID)
+	if err != nil {
+		logger.Error("error building domain verification", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	enc := json.NewEncoder(w)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusForbidden)
+
+	if err = enc.Encode(verification); err != nil {
+		logger.Error("error encoding domain verification response", zap.Error(err))
+	}
+}
+
+// APIGetUserDomains получить домены, на которых пользователь может создавать ссылки.
+func APIGetUserDomains(
+	w http.ResponseWriter,
+	r *http.Request,
+	cfg *config.Config,
+	storage repository.Storage,
+	logger *zap.Logger,
+) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx := r.Context()
+	user, ok := ctx.Value(contextkeys.ContextUserKey).(*models.User)
+	if !ok {
+		logger.Error(errGetContextUser.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !user.Service.IsAuthenticated {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	domains, err := service.GetUserDomains(ctx, storage, cfg, user.ID)
+	if err != nil {
+		logger.Error("error getting user domains", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	enc := json.NewEncoder(w)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	if err = enc.Encode(domains); err != nil {
+		logger.Error("error encoding user domains response", zap.Error(err))
+	}
+}
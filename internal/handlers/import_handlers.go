@@ -0,0 +1,352 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Melikhov-p/url-minimise/internal/config"
+	"github.com/Melikhov-p/url-minimise/internal/contextkeys"
+	"github.com/Melikhov-p/url-minimise/internal/models"
+	"github.com/Melikhov-p/url-minimise/internal/repository"
+	"github.com/Melikhov-p/url-minimise/internal/service"
+	"go.uber.org/zap"
+)
+
+const (
+	// importMaxLineSize максимальная длина строки NDJSON.
+	importMaxLineSize = 1 << 20
+
+	formatCSV    = "csv"
+	formatNDJSON = "ndjson"
+)
+
+// csvExportHeader заголовок CSV выгрузки, файл выгрузки можно загрузить обратно импортом.
+var csvExportHeader = []string{"short_url", "original_url", "is_deleted", "deleted_at", "created_at"}
+
+// importRow строка файла импорта.
+type importRow struct {
+	CorrelationID string `json:"correlation_id"`
+	OriginalURL   string `json:"original_url"`
+}
+
+// importReader читает строки файла импорта. Ошибка разбора одной строки возвращается в результате строки,
+// ошибка чтения файла прекращает импорт.
+type importReader interface {
+	Next() (*models.ImportResult, error)
+}
+
+// ndjsonImportReader читает строки NDJSON, пустые строки пропускаются.
+// Первые skip строк пропускаются, чтобы продолжить прерванный поток с точки продолжения.
+type ndjsonImportReader struct {
+	scanner *bufio.Scanner
+	line    int
+	skip    int
+}
+
+func newNDJSONImportReader(r io.Reader, skip int) *ndjsonImportReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), importMaxLineSize)
+	return &ndjsonImportReader{scanner: scanner, skip: skip}
+}
+
+// Next прочитать следующую строку.
+func (nr *ndjsonImportReader) Next() (*models.ImportResult, error) {
+	for nr.scanner.Scan() {
+		nr.line++
+		line := strings.TrimSpace(nr.scanner.Text())
+		if line == "" || nr.line <= nr.skip {
+			continue
+		}
+
+		res := &models.ImportResult{Line: nr.line}
+		var row importRow
+		if err := json.Unmarshal([]byte(line), &row); err != nil {
+			res.Error = "invalid json: " + err.Error()
+			return res, nil
+		}
+		res.CorrelationID = row.CorrelationID
+		res.OriginalURL = row.OriginalURL
+		return res, nil
+	}
+	if err := nr.scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading ndjson line %d %w", nr.line+1, err)
+	}
+	return nil, io.EOF
+}
+
+// csvImportReader читает строки CSV с заголовком. Обязательна колонка original_url,
+// колонка correlation_id необязательна, остальные колонки игнорируются.
+type csvImportReader struct {
+	reader        *csv.Reader
+	originalIdx   int
+	correlationID int
+	header        int
+}
+
+func newCSVImportReader(r io.Reader) (*csvImportReader, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("error reading csv header %w", err)
+	}
+
+	cr := &csvImportReader{reader: reader, originalIdx: -1, correlationID: -1, header: len(header)}
+	for i, column := range header {
+		switch strings.ToLower(strings.TrimSpace(strings.TrimPrefix(column, "\ufeff"))) {
+		case "original_url":
+			cr.originalIdx = i
+		case "correlation_id":
+			cr.correlationID = i
+		}
+	}
+	if cr.originalIdx < 0 {
+		return nil, errors.New("csv header has no original_url column")
+	}
+	// Количество колонок проверяется при разборе строки, чтобы сообщить об ошибке в результате строки.
+	reader.FieldsPerRecord = -1
+
+	return cr, nil
+}
+
+// Next прочитать следующую строку.
+func (cr *csvImportReader) Next() (*models.ImportResult, error) {
+	record, err := cr.reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("error reading csv %w", err)
+	}
+
+	line, _ := cr.reader.FieldPos(0)
+	res := &models.ImportResult{Line: line}
+	if len(record) != cr.header {
+		res.Error = fmt.Sprintf("wrong number of fields: want %d, got %d", cr.header, len(record))
+		return res, nil
+	}
+
+	res.OriginalURL = strings.TrimSpace(record[cr.originalIdx])
+	if cr.correlationID >= 0 {
+		res.CorrelationID = record[cr.correlationID]
+	}
+	return res, nil
+}
+
+// APIImportURLs импорт ссылок пользователя из CSV или NDJSON. Результат каждой строки
+// отдаётся потоком NDJSON в порядке строк файла.
+func APIImportURLs(
+	w http.ResponseWriter,
+	r *http.Request,
+	cfg *config.Config,
+	storage repository.Storage,
+	logger *zap.Logger,
+) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx := r.Context()
+	user, ok := ctx.Value(contextkeys.ContextUserKey).(*models.User)
+	if !ok {
+		logger.Error(errGetContextUser.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !user.Service.IsAuthenticated {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var reader importReader
+	switch importFormat(r.Header.Get("Content-Type")) {
+	case formatCSV:
+		csvReader, err := newCSVImportReader(r.Body)
+		if err != nil {
+			logger.Info("error reading import csv header", zap.Error(err))
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		reader = csvReader
+	case formatNDJSON:
+		reader = newNDJSONImportReader(r.Body, 0)
+	default:
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		return
+	}
+
+	writeImportStream(w, r, cfg, storage, logger, user.ID, reader)
+}
+
+// writeImportStream создать ссылки из строк reader и отдать результаты потоком NDJSON.
+// Результаты части строк отдаются после её сохранения. Если поток прерван ошибкой,
+// последней строкой отдается ошибка и номер последней сохранённой строки.
+func writeImportStream(
+	w http.ResponseWriter,
+	r *http.Request,
+	cfg *config.Config,
+	storage repository.Storage,
+	logger *zap.Logger,
+	userID int,
+	reader importReader,
+) {
+	// Результаты отдаются до окончания чтения тела запроса.
+	rc := http.NewResponseController(w)
+	if err := rc.EnableFullDuplex(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		logger.Debug("error enabling full duplex", zap.Error(err))
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+
+	enc := json.NewEncoder(w)
+
+	checkpoint, err := service.ImportStream(r.Context(), storage, cfg, userID, reader.Next,
+		func(rows []*models.ImportResult) error {
+			for _, row := range rows {
+				if err := enc.Encode(row); err != nil {
+					return fmt.Errorf("error encoding import result %w", err)
+				}
+			}
+			if err := rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+				return fmt.Errorf("error flushing import results %w", err)
+			}
+			return nil
+		})
+	if err != nil {
+		logger.Info("import stream interrupted", zap.Int("checkpoint", checkpoint), zap.Error(err))
+		if err = enc.Encode(&models.ImportResult{Line: checkpoint, Error: err.Error()}); err != nil {
+			logger.Error("error encoding import result", zap.Error(err))
+		}
+	}
+}
+
+// APIExportURLs выгрузка всех ссылок пользователя, включая удалённые, в CSV или NDJSON.
+// Формат задаётся параметром format, иначе заголовком Accept, по умолчанию NDJSON.
+func APIExportURLs(
+	w http.ResponseWriter,
+	r *http.Request,
+	cfg *config.Config,
+	storage repository.Storage,
+	logger *zap.Logger,
+) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx := r.Context()
+	user, ok := ctx.Value(contextkeys.ContextUserKey).(*models.User)
+	if !ok {
+		logger.Error(errGetContextUser.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !user.Service.IsAuthenticated {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	format := strings.ToLower(r.URL.Query().Get("format"))
+	switch format {
+	case formatCSV, formatNDJSON:
+	case "":
+		format = importFormat(r.Header.Get("Accept"))
+		if format == "" {
+			format = formatNDJSON
+		}
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	urls, err := service.ExportURLs(ctx, storage, cfg, user.ID)
+	if err != nil {
+		logger.Error("error exporting user urls", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if format == formatCSV {
+		w.Header().Set("Content-Type", "text/csv")
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	}
+	w.Header().Set("Content-Disposition", `attachment; filename="urls.`+format+`"`)
+	w.WriteHeader(http.StatusOK)
+
+	if format == formatCSV {
+		err = writeExportCSV(w, urls)
+	} else {
+		enc := json.NewEncoder(w)
+		for i := range urls {
+			if err = enc.Encode(&urls[i]); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		logger.Error("error writing export", zap.Error(err))
+	}
+}
+
+// writeExportCSV записать выгрузку в CSV, даты в формате RFC 3339.
+func writeExportCSV(w io.Writer, urls []models.ExportURL) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(csvExportHeader); err != nil {
+		return fmt.Errorf("error writing csv header %w", err)
+	}
+
+	formatTime := func(t *time.Time) string {
+		if t == nil {
+			return ""
+		}
+		return t.UTC().Format(time.RFC3339)
+	}
+	for _, url := range urls {
+		record := []string{
+			url.ShortURL,
+			url.OriginalURL,
+			strconv.FormatBool(url.DeletedFlag),
+			formatTime(url.DeletedAt),
+			formatTime(url.CreatedAt),
+		}
+		if err := writer.Write(record); err != nil {
+			return fmt.Errorf("error writing csv record %w", err)
+		}
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("error flushing csv %w", err)
+	}
+	return nil
+}
+
+// importFormat определить формат файла по типу содержимого.
+func importFormat(contentType string) string {
+	for _, part := range strings.Split(contentType, ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		switch mediaType {
+		case "text/csv", "application/csv":
+			return formatCSV
+		case "application/x-ndjson", "application/ndjson", "application/jsonl", "application/x-jsonlines":
+			return formatNDJSON
+		}
+	}
+	return ""
+}
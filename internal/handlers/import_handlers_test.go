@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Melikhov-p/url-minimise/internal/auth"
+	"github.com/Melikhov-p/url-minimise/internal/middlewares"
+	"github.com/Melikhov-p/url-minimise/internal/models"
+	"github.com/Melikhov-p/url-minimise/internal/repository"
+	"github.com/Melikhov-p/url-minimise/internal/service"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-resty/resty/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func decodeImportResults(t *testing.T, body string) []models.ImportResult {
+	t.Helper()
+
+	var results []models.ImportResult
+	scanner := bufio.NewScanner(strings.NewReader(body))
+	for scanner.Scan() {
+		var res models.ImportResult
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &res))
+		results = append(results, res)
+	}
+	return results
+}
+
+func TestAPIImportExportURLs(t *testing.T) {
+	router := chi.NewRouter()
+
+	cfg, log := setupTest(t)
+	storage, err := repository.NewStorage(cfg, log)
+	require.NoError(t, err)
+	middleware := middlewares.Middleware{
+		Logger:  log,
+		Storage: storage,
+		Cfg:     cfg,
+	}
+	router.Use(middleware.WithAuth)
+	router.Post("/api/user/urls/import", func(w http.ResponseWriter, r *http.Request) {
+		APIImportURLs(w, r, cfg, storage, log)
+	})
+	router.Get("/api/user/urls/export", func(w http.ResponseWriter, r *http.Request) {
+		APIExportURLs(w, r, cfg, storage, log)
+	})
+
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	userID := int(time.Now().UnixNano() % 1_000_000)
+	token, err := auth.BuildJWTString(userID, cfg.SigningKeys, time.Hour)
+	require.NoError(t, err)
+	request := func() *resty.Request {
+		return resty.New().R().SetCookie(&http.Cookie{Name: "Token", Value: token})
+	}
+
+	resp, err := resty.New().R().
+		SetHeader("Content-Type", "text/csv").
+		SetBody("original_url\n").
+		Post(srv.URL + "/api/user/urls/import")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode())
+
+	resp, err = request().
+		SetHeader("Content-Type", "application/json").
+		SetBody("{}").
+		Post(srv.URL + "/api/user/urls/import")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnsupportedMediaType, resp.StatusCode())
+
+	resp, err = request().
+		SetHeader("Content-Type", "text/csv").
+		SetBody("url\nhttps://example.com\n").
+		Post(srv.URL + "/api/user/urls/import")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode())
+
+	first, second := createRandomURL(), createRandomURL()
+
+	resp, err = request().
+		SetHeader("Content-Type", "text/csv").
+		SetBody("correlation_id,original_url\n" +
+			"1," + first + "\n" +
+			"2,\n" +
+			"3," + first + ",extra\n" +
+			"4," + first + "\n").
+		Post(srv.URL + "/api/user/urls/import")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode())
+	assert.Equal(t, "application/x-ndjson", resp.Header().Get("Content-Type"))
+
+	results := decodeImportResults(t, resp.String())
+	require.Len(t, results, 4)
+	assert.Equal(t, "1", results[0].CorrelationID)
+	assert.Equal(t, 2, results[0].Line)
+	assert.Empty(t, results[0].Error)
+	assert.NotEmpty(t, results[0].ShortURL)
+	assert.Equal(t, service.ErrImportEmptyURL.Error(), results[1].Error)
+	assert.Contains(t, results[2].Error, "wrong number of fields")
+	assert.Equal(t, service.ErrImportURLExist.Error(), results[3].Error)
+	assert.Equal(t, results[0].ShortURL, results[3].ShortURL)
+
+	resp, err = request().
+		SetHeader("Content-Type", "application/x-ndjson").
+		SetBody(`{"correlation_id":"a","original_url":"` + second + `"}` + "\n\n" +
+			"not json\n" +
+			`{"correlation_id":"b","original_url":"` + first + `"}` + "\n").
+		Post(srv.URL + "/api/user/urls/import")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode())
+
+	results = decodeImportResults(t, resp.String())
+	require.Len(t, results, 3)
+	assert.Equal(t, "a", results[0].CorrelationID)
+	assert.Empty(t, results[0].Error)
+	assert.Equal(t, 3, results[1].Line)
+	assert.Contains(t, results[1].Error, "invalid json")
+	assert.Equal(t, "b", results[2].CorrelationID)
+	assert.Equal(t, service.ErrImportURLExist.Error(), results[2].Error)
+
+	secondShort := strings.TrimPrefix(results[0].ShortURL, cfg.ResultAddr+"/")
+	err = storage.MarkAsDeletedURL(context.Background(), []*models.DelTask{{URL: secondShort, UserID: userID}})
+	require.NoError(t, err)
+
+	resp, err = request().Get(srv.URL + "/api/user/urls/export")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode())
+	assert.Equal(t, "application/x-ndjson", resp.Header().Get("Content-Type"))
+	assert.Contains(t, resp.Header().Get("Content-Disposition"), "attachment")
+
+	var exported []models.ExportURL
+	scanner := bufio.NewScanner(strings.NewReader(resp.String()))
+	for scanner.Scan() {
+		var url models.ExportURL
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &url))
+		exported = append(exported, url)
+	}
+	require.Len(t, exported, 2)
+	deleted := map[string]bool{}
+	for _, url := range exported {
+		assert.NotNil(t, url.CreatedAt)
+		deleted[url.OriginalURL] = url.DeletedFlag
+	}
+	assert.Equal(t, map[string]bool{first: false, second: true}, deleted)
+
+	resp, err = request().Get(srv.URL + "/api/user/urls/export?format=csv")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode())
+	assert.Equal(t, "text/csv", resp.Header().Get("Content-Type"))
+
+	records, err := csv.NewReader(strings.NewReader(resp.String())).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	assert.Equal(t, csvExportHeader, records[0])
+
+	// Выгрузку в CSV можно загрузить обратно: все адреса уже существуют.
+	resp, err = request().
+		SetHeader("Content-Type", "text/csv").
+		SetBody(resp.String()).
+		Post(srv.URL + "/api/user/urls/import")
+	require.NoError(t, err)
+	results = decodeImportResults(t, resp.String())
+	require.Len(t, results, 2)
+	for _, res := range results {
+		assert.Equal(t, service.ErrImportURLExist.Error(), res.Error)
+	}
+
+	resp, err = request().Get(srv.URL + "/api/user/urls/export?format=xml")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode())
+}
+
+func TestAPICreateBatchURLsStream(t *testing.T) {
+	router := chi.NewRouter()
+
+	cfg, log := setupTest(t)
+	storage, err := repository.NewStorage(cfg, log)
+	require.NoError(t, err)
+	middleware := middlewares.Middleware{
+		Logger:  log,
+		Storage: storage,
+		Cfg:     cfg,
+	}
+	router.Use(middleware.WithAuth, middleware.WithLogging)
+	router.Post("/api/shorten/batch/stream", func(w http.ResponseWriter, r *http.Request) {
+		APICreateBatchURLsStream(w, r, cfg, storage, log)
+	})
+
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	const total = service.ImportChunkSize + 20
+	var body strings.Builder
+	originals := make([]string, 0, total)
+	for i := range total {
+		original := "https://" + randomString(10) + ".example.com/" + strconv.Itoa(i)
+		originals = append(originals, original)
+		body.WriteString(`{"correlation_id":"` + strconv.Itoa(i+1) + `","original_url":"` + original + `"}` + "\n")
+	}
+
+	resp, err := resty.New().R().
+		SetHeader("Content-Type", "application/json").
+		SetBody(body.String()).
+		Post(srv.URL + "/api/shorten/batch/stream")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnsupportedMediaType, resp.StatusCode())
+
+	resp, err = resty.New().R().
+		SetHeader("Content-Type", "application/x-ndjson").
+		SetBody(body.String()).
+		Post(srv.URL + "/api/shorten/batch/stream?skip=-1")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode())
+
+	// Продолжение загрузки: первые 10 строк уже были загружены ранее.
+	resp, err = resty.New().R().
+		SetHeader("Content-Type", "application/x-ndjson").
+		SetBody(body.String()).
+		Post(srv.URL + "/api/shorten/batch/stream?skip=10")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode())
+
+	var token string
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == "Token" {
+			token = cookie.Value
+		}
+	}
+	assert.NotEmpty(t, token)
+
+	results := decodeImportResults(t, resp.String())
+	require.Len(t, results, total-10)
+	for i, res := range results {
+		assert.Equal(t, i+11, res.Line)
+		assert.Equal(t, strconv.Itoa(i+11), res.CorrelationID)
+		assert.Equal(t, originals[i+10], res.OriginalURL)
+		assert.Empty(t, res.Error)
+		assert.NotEmpty(t, res.ShortURL)
+	}
+
+	resp, err = resty.New().R().
+		SetCookie(&http.Cookie{Name: "Token", Value: token}).
+		SetHeader("Content-Type", "application/x-ndjson").
+		SetBody(body.String()).
+		Post(srv.URL + "/api/shorten/batch/stream")
+	require.NoError(t, err)
+	results = decodeImportResults(t, resp.String())
+	require.Len(t, results, total)
+	assert.Empty(t, results[0].Error)
+	assert.Equal(t, service.ErrImportURLExist.Error(), results[10].Error)
+}
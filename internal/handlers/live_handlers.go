@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/Melikhov-p/url-minimise/internal/clicks"
+	"github.com/Melikhov-p/url-minimise/internal/config"
+	"github.com/Melikhov-p/url-minimise/internal/contextkeys"
+	"github.com/Melikhov-p/url-minimise/internal/models"
+	"github.com/Melikhov-p/url-minimise/internal/repository"
+	"github.com/Melikhov-p/url-minimise/internal/service"
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+// liveKeepAlive интервал комментариев SSE, которые не дают прокси закрыть простаивающее соединение.
+const liveKeepAlive = 15 * time.Second
+
+// APILiveClicks отдавать владельцу переходы по ссылке в реальном времени как Server-Sent Events.
+// Каждый переход — событие click с JSON. Если владелец не успевает читать, часть переходов
+// отбрасывается, и перед следующим переходом приходит событие dropped с общим числом потерянных.
+func APILiveClicks(
+	w http.ResponseWriter,
+	r *http.Request,
+	cfg *config.Config,
+	storage repository.Storage,
+	logger *zap.Logger,
+) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx := r.Context()
+	user, ok := ctx.Value(contextkeys.ContextUserKey).(*models.User)
+	if !ok {
+		logger.Error(errGetContextUser.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !user.Service.IsAuthenticated {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	sub, err := service.SubscribeClicks(ctx, cfg, storage, chi.URLParam(r, "id"), user.ID)
+	if err != nil {
+		code := ownerErrorStatus(err)
+		if errors.Is(err, clicks.ErrTooManySubscribers) {
+			code = http.StatusTooManyRequests
+		}
+		if code == http.StatusInternalServerError {
+			logger.Error("error subscribing to live clicks", zap.Error(err))
+		}
+		w.WriteHeader(code)
+		return
+	}
+	defer sub.Close()
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if err = rc.Flush(); err != nil {
+		logger.Error("error flushing live clicks stream", zap.Error(err))
+		return
+	}
+
+	keepAlive := time.NewTicker(liveKeepAlive)
+	defer keepAlive.Stop()
+
+	var reported int64
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-keepAlive.C:
+			_, err = io.WriteString(w, ": keep-alive\n\n")
+		case event, open := <-sub.Events():
+			if !open {
+				return
+			}
+			if dropped := sub.Dropped(); dropped > reported {
+				reported = dropped
+				err = writeSSE(w, "dropped", map[string]int64{"dropped": dropped})
+			}
+			if err == nil {
+				err = writeSSE(w, "click", service.LiveClickFromEvent(event))
+			}
+		}
+		if err == nil {
+			err = rc.Flush()
+		}
+		if err != nil {
+			logger.Debug("live clicks stream closed", zap.Error(err))
+			return
+		}
+	}
+}
+
+// writeSSE пишет событие SSE с именем name и данными data в JSON.
+func writeSSE(w io.Writer, name string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("error marshaling sse event %w", err)
+	}
+	if _, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, payload); err != nil {
+		return fmt.Errorf("error writing sse event %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Melikhov-p/url-minimise/internal/auth"
+	"github.com/Melikhov-p/url-minimise/internal/config"
+	"github.com/Melikhov-p/url-minimise/internal/contextkeys"
+	"github.com/Melikhov-p/url-minimise/internal/models"
+	"github.com/Melikhov-p/url-minimise/internal/repository"
+	"github.com/Melikhov-p/url-minimise/internal/service"
+	storagePkg "github.com/Melikhov-p/url-minimise/internal/storage"
+	"go.uber.org/zap"
+)
+
+const (
+	// oidcLoginCookie cookie с одноразовыми значениями входа через SSO до возврата от провайдера.
+	oidcLoginCookie = "OIDCLogin"
+	// oidcCookiePath путь cookie входа: она нужна только обработчику обратного вызова.
+	oidcCookiePath = "/api/user/oidc"
+	// oidcLoginMaxAge сколько пользователь может провести на странице входа провайдера.
+	oidcLoginMaxAge = 10 * time.Minute
+)
+
+// APIOIDCLogin начать вход через провайдера OpenID Connect: перенаправить пользователя на страницу
+// входа провайдера. state, nonce и секрет PKCE сохраняются в cookie до обратного вызова.
+func APIOIDCLogin(
+	w http.ResponseWriter,
+	r *http.Request,
+	cfg *config.Config,
+	_ repository.Storage,
+	logger *zap.Logger,
+) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if cfg.OIDC == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	login, err := auth.NewOIDCLogin()
+	if err != nil {
+		logger.Error("error creating oidc login", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	target, err := cfg.OIDC.AuthCodeURL(r.Context(), login)
+	if err != nil {
+		logger.Error("error discovering oidc provider", zap.Error(err))
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+
+	// SameSite Lax: провайдер возвращает пользователя переходом с другого сайта, и cookie должна прийти.
+	http.SetCookie(w, oidcCookieOptions(cfg).Cookie(oidcLoginCookie, login.String(), oidcLoginMaxAge))
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+// APIOIDCCallback обратный вызов провайдера OpenID Connect: проверить state, обменять код на ID-токен
+// и войти в аккаунт пользователя провайдера, создав его при первом входе. Ссылки анонимной сессии
+// переходят в аккаунт.
+func APIOIDCCallback(
+	w http.ResponseWriter,
+	r *http.Request,
+	cfg *config.Config,
+	storage repository.Storage,
+	logger *zap.Logger,
+) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if cfg.OIDC == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	ctx := r.Context()
+	current, ok := ctx.Value(contextkeys.ContextUserKey).(*models.User)
+	if !ok {
+		logger.Error(errGetContextUser.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// Значения входа одноразовые: cookie удаляется при любом исходе.
+	http.SetCookie(w, oidcCookieOptions(cfg).Expired(oidcLoginCookie))
+
+	query := r.URL.Query()
+	if providerErr := query.Get("error"); providerErr != "" {
+		logger.Debug("oidc provider denied login", zap.String("error", providerErr))
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	cookie, err := r.Cookie(oidcLoginCookie)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	login, ok := auth.ParseOIDCLogin(cookie.Value)
+	if !ok || !login.CheckState(query.Get("state")) || query.Get("code") == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	user, merged, err := service.OIDCLogin(ctx, storage, cfg, current, query.Get("code"), login)
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrOIDCRejected), errors.Is(err, service.ErrInvalidEmail):
+			logger.Debug("oidc login rejected", zap.Error(err))
+			w.WriteHeader(http.StatusUnauthorized)
+		case errors.Is(err, storagePkg.ErrAccountExist):
+			w.WriteHeader(http.StatusConflict)
+		case errors.Is(err, auth.ErrOIDCUnavailable):
+			logger.Error("oidc provider unavailable", zap.Error(err))
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			logger.Error("error signing in with oidc", zap.Error(err))
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	setSessionCookies(w, r, cfg, logger, user)
+
+	enc := json.NewEncoder(w)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	if err = enc.Encode(models.AccountResponse{Email: user.Email, UserID: user.ID, MergedURLs: merged}); err != nil {
+		logger.Error("error encoding account response", zap.Error(err))
+	}
+}
+
+// oidcCookieOptions атрибуты cookie входа через SSO: домен и Secure из конфига, SameSite всегда Lax.
+func oidcCookieOptions(cfg *config.Config) auth.CookieOptions {
+	options := cfg.Cookie.WithPath(oidcCookiePath)
+	options.SameSite = http.SameSiteLaxMode
+	return options
+}
@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/Melikhov-p/url-minimise/internal/auth"
+	"github.com/Melikhov-p/url-minimise/internal/config"
+	"github.com/Melikhov-p/url-minimise/internal/models"
+	"github.com/Melikhov-p/url-minimise/internal/repository"
+	"github.com/Melikhov-p/url-minimise/internal/service"
+	"go.uber.org/zap"
+)
+
+// refreshCookiePath путь cookie с токеном обновления: токен нужен только обработчикам сессии.
+const refreshCookiePath = "/api/user"
+
+// APIRefresh обменять токен обновления на новую пару токенов. Токен берётся из поля refresh_token
+// тела запроса, а без тела — из cookie. Новые токены отдаются в ответе и в cookie.
+func APIRefresh(
+	w http.ResponseWriter,
+	r *http.Request,
+	cfg *config.Config,
+	storage repository.Storage,
+	logger *zap.Logger,
+) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	refreshToken, err := readRefreshToken(r)
+	if err != nil {
+		logger.Debug("bad refresh request", zap.Error(err))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	user, err := service.RefreshTokens(r.Context(), storage, cfg, logger, refreshToken)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidRefreshToken) {
+			clearSessionCookies(w, cfg)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		logger.Error("error refreshing tokens", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	setSessionCookies(w, r, cfg, logger, user)
+
+	enc := json.NewEncoder(w)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	if err = enc.Encode(models.TokenResponse{
+		AccessToken:  user.Service.Token,
+		RefreshToken: user.Service.RefreshToken,
+		ExpiresIn:    int(cfg.JWTTokenLifeTime.Seconds()),
+	}); err != nil {
+		logger.Error("error encoding tokens response", zap.Error(err))
+	}
+}
+
+// APILogout завершить сессию: отозвать токен доступа из заголовка Authorization или cookie и токены
+// обновления сессии, удалить cookie.
+func APILogout(
+	w http.ResponseWriter,
+	r *http.Request,
+	cfg *config.Config,
+	storage repository.Storage,
+	logger *zap.Logger,
+) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	refreshToken, err := readRefreshToken(r)
+	if err != nil {
+		logger.Debug("bad logout request", zap.Error(err))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	accessToken := auth.AccessToken(r)
+	if err = service.Logout(r.Context(), storage, cfg, accessToken, refreshToken); err != nil {
+		logger.Error("error logging out", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	clearSessionCookies(w, cfg)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// readRefreshToken читает токен обновления из тела запроса, а если тела нет — из cookie.
+func readRefreshToken(r *http.Request) (string, error) {
+	var req models.RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		return "", fmt.Errorf("error decoding refresh request %w", err)
+	}
+	if req.RefreshToken != "" {
+		return req.RefreshToken, nil
+	}
+
+	if cookie, err := r.Cookie(auth.RefreshCookie); err == nil {
+		return cookie.Value, nil
+	}
+	return "", nil
+}
+
+// setSessionCookies отдаёт токены сессии в cookie с атрибутами из конфига. Cookie истекают вместе
+// с токенами. Токен обновления отдаётся, только если выдана новая пара токенов.
+func setSessionCookies(
+	w http.ResponseWriter,
+	r *http.Request,
+	cfg *config.Config,
+	logger *zap.Logger,
+	user *models.User,
+) {
+	http.SetCookie(w, cfg.Cookie.Cookie(auth.AccessCookie, user.Service.Token, cfg.JWTTokenLifeTime))
+	setCSRFCookie(w, r, cfg, logger)
+	if user.Service.RefreshToken == "" {
+		return
+	}
+	refresh := cfg.Cookie.WithPath(refreshCookiePath)
+	http.SetCookie(w, refresh.Cookie(auth.RefreshCookie, user.Service.RefreshToken, cfg.RefreshTokenLifeTime))
+}
+
+// setCSRFCookie отдаёт вместе с сессией доступный скриптам страницы токен CSRF, который клиент повторяет
+// в заголовке запросов, изменяющих данные. Токен живёт, пока жива сессия: без него не обновить истёкший
+// токен доступа. Токен из запроса сохраняется, чтобы запросы, отправленные страницей одновременно
+// с обновлением токенов, не отклонялись.
+func setCSRFCookie(w http.ResponseWriter, r *http.Request, cfg *config.Config, logger *zap.Logger) {
+	token := ""
+	if cookie, err := r.Cookie(auth.CSRFCookie); err == nil {
+		token = cookie.Value
+	}
+	if token == "" {
+		var err error
+		if token, err = auth.GenerateCSRFToken(); err != nil {
+			logger.Error("error generating csrf token", zap.Error(err))
+			return
+		}
+	}
+
+	http.SetCookie(w, csrfCookieOptions(cfg).Cookie(auth.CSRFCookie, token, cfg.RefreshTokenLifeTime))
+}
+
+// csrfCookieOptions атрибуты cookie с токеном CSRF: в отличие от токенов сессии, её читают скрипты страницы.
+func csrfCookieOptions(cfg *config.Config) auth.CookieOptions {
+	options := cfg.Cookie
+	options.HTTPOnly = false
+	return options
+}
+
+// clearSessionCookies удаляет cookie сессии.
+func clearSessionCookies(w http.ResponseWriter, cfg *config.Config) {
+	http.SetCookie(w, cfg.Cookie.Expired(auth.AccessCookie))
+	http.SetCookie(w, cfg.Cookie.WithPath(refreshCookiePath).Expired(auth.RefreshCookie))
+	http.SetCookie(w, csrfCookieOptions(cfg).Expired(auth.CSRFCookie))
+}
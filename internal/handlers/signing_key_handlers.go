@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Melikhov-p/url-minimise/internal/config"
+	"github.com/Melikhov-p/url-minimise/internal/models"
+	"github.com/Melikhov-p/url-minimise/internal/repository"
+	"github.com/Melikhov-p/url-minimise/internal/service"
+	storagePkg "github.com/Melikhov-p/url-minimise/internal/storage"
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+// jwksMaxAge сколько секунд другие сервисы могут кешировать открытые ключи. Новый ключ публикуется
+// при ротации и начинает подписывать токены сразу, поэтому кеш держится недолго.
+const jwksMaxAge = 300
+
+// GetJWKS отдать открытые ключи RS256 и EdDSA, которыми другие сервисы проверяют выданные токены.
+func GetJWKS(
+	w http.ResponseWriter,
+	r *http.Request,
+	cfg *config.Config,
+	_ repository.Storage,
+	logger *zap.Logger,
+) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	enc := json.NewEncoder(w)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", jwksMaxAge))
+	w.WriteHeader(http.StatusOK)
+
+	if err := enc.Encode(cfg.SigningKeys.JWKS()); err != nil {
+		logger.Error("error encoding jwks response", zap.Error(err))
+	}
+}
+
+// APIGetSigningKeys отдать ключи подписи токенов без секретов (только с адресов доверенной подсети).
+func APIGetSigningKeys(
+	w http.ResponseWriter,
+	r *http.Request,
+	cfg *config.Config,
+	storage repository.Storage,
+	logger *zap.Logger,
+) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if !fromTrustedPeer(w, r, cfg, logger) {
+		return
+	}
+
+	keys, err := service.GetSigningKeys(r.Context(), storage, cfg)
+	if err != nil {
+		logger.Error("error getting signing keys", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	enc := json.NewEncoder(w)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	if err = enc.Encode(keys); err != nil {
+		logger.Error("error encoding signing keys response", zap.Error(err))
+	}
+}
+
+// APIRotateSigningKey выпустить новый ключ подписи токенов (только с адресов доверенной подсети).
+// Токены, подписанные прежними ключами, продолжают приниматься.
+func APIRotateSigningKey(
+	w http.ResponseWriter,
+	r *http.Request,
+	cfg *config.Config,
+	storage repository.Storage,
+	logger *zap.Logger,
+) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if !fromTrustedPeer(w, r, cfg, logger) {
+		return
+	}
+
+	key, err := service.RotateSigningKey(r.Context(), storage, cfg)
+	if err != nil {
+		logger.Error("error rotating signing key", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	logger.Info("signing key rotated", zap.String("kid", key.ID))
+
+	enc := json.NewEncoder(w)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+
+	if err = enc.Encode(models.SigningKeyResponse{
+		CreatedAt: key.CreatedAt,
+		ID:        key.ID,
+		Algorithm: key.Algorithm,
+		Signing:   true,
+	}); err != nil {
+		logger.Error("error encoding signing key response", zap.Error(err))
+	}
+}
+
+// APIRetireSigningKey вывести ключ подписи из оборота (только с адресов доверенной подсети): подписанные им
+// токены доступа больше не принимаются. Если это ключ, которым подписываются токены, сначала выпускается новый.
+func APIRetireSigningKey(
+	w http.ResponseWriter,
+	r *http.Request,
+	cfg *config.Config,
+	storage repository.Storage,
+	logger *zap.Logger,
+) {
+	if r.Method != http.MethodDelete {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if !fromTrustedPeer(w, r, cfg, logger) {
+		return
+	}
+
+	kid := chi.URLParam(r, "kid")
+	if err := service.RetireSigningKey(r.Context(), storage, cfg, kid); err != nil {
+		if errors.Is(err, storagePkg.ErrNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		logger.Error("error retiring signing key", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	logger.Info("signing key retired", zap.String("kid", kid))
+
+	w.WriteHeader(http.StatusNoContent)
+}
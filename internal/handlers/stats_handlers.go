@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/Melikhov-p/url-minimise/internal/config"
+	"github.com/Melikhov-p/url-minimise/internal/contextkeys"
+	"github.com/Melikhov-p/url-minimise/internal/models"
+	"github.com/Melikhov-p/url-minimise/internal/repository"
+	"github.com/Melikhov-p/url-minimise/internal/service"
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+// APIGetLinkStats получить статистику переходов по URL владельцем.
+// Параметры: from и to в RFC 3339, bucket — hour или day, top — размер топов.
+func APIGetLinkStats(
+	w http.ResponseWriter,
+	r *http.Request,
+	_ *config.Config,
+	storage repository.Storage,
+	logger *zap.Logger,
+) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx := r.Context()
+	user, ok := ctx.Value(contextkeys.ContextUserKey).(*models.User)
+	if !ok {
+		logger.Error(errGetContextUser.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !user.Service.IsAuthenticated {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	query, err := statsQueryFromValues(r.URL.Query())
+	if err != nil {
+		logger.Debug("invalid stats query", zap.Error(err))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	stats, err := service.GetLinkStats(ctx, storage, chi.URLParam(r, "id"), user.ID, query)
+	if err != nil {
+		code := ownerErrorStatus(err)
+		if code == http.StatusInternalServerError {
+			logger.Error("error getting link stats", zap.Error(err))
+		}
+		w.WriteHeader(code)
+		return
+	}
+
+	enc := json.NewEncoder(w)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	if err = enc.Encode(stats); err != nil {
+		logger.Error("error encoding link stats response", zap.Error(err))
+	}
+}
+
+// statsQueryFromValues разбирает параметры выборки статистики из строки запроса.
+// Отсутствующие параметры остаются пустыми и заполняются значениями по умолчанию в сервисе.
+func statsQueryFromValues(values url.Values) (models.ClickStatsQuery, error) {
+	query := models.ClickStatsQuery{Bucket: models.StatsBucket(values.Get("bucket"))}
+
+	for name, dst := range map[string]*time.Time{"from": &query.From, "to": &query.To} {
+		raw := values.Get(name)
+		if raw == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return query, fmt.Errorf("error parsing %s %w", name, err)
+		}
+		*dst = parsed
+	}
+
+	if raw := values.Get("top"); raw != "" {
+		top, err := strconv.Atoi(raw)
+		if err != nil || top <= 0 {
+			return query, fmt.Errorf("invalid top %q", raw)
+		}
+		query.Top = top
+	}
+
+	return query, nil
+}
+
+// Metrics отдать метрики сервиса в формате Prometheus (только из доверенной подсети).
+func Metrics(
+	w http.ResponseWriter,
+	r *http.Request,
+	cfg *config.Config,
+	_ repository.Storage,
+	logger *zap.Logger,
+) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !fromTrustedSubnet(w, r, cfg, logger) {
+		return
+	}
+
+	cfg.Metrics.Handler().ServeHTTP(w, r)
+}
@@ -7,9 +7,13 @@ import (
 	"io"
 	"net"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/Melikhov-p/url-minimise/internal/config"
 	"github.com/Melikhov-p/url-minimise/internal/contextkeys"
+	"github.com/Melikhov-p/url-minimise/internal/metrics"
 	"github.com/Melikhov-p/url-minimise/internal/models"
 	"github.com/Melikhov-p/url-minimise/internal/repository"
 	"github.com/Melikhov-p/url-minimise/internal/service"
@@ -60,16 +64,17 @@ func CreateShortURL(
 			return
 		}
 	}
-	http.SetCookie(w, &http.Cookie{
-		Name:  "Token",
-		Value: user.Service.Token,
-	})
+	setSessionCookies(w, r, cfg, logger, user)
 
 	newURL, err := service.AddURL(ctx, storage, logger, string(originalURL), cfg, user.ID)
 	if err != nil {
-		if errors.Is(err, storagePkg.ErrOriginalURLExist) {
+		switch {
+		case errors.Is(err, storagePkg.ErrOriginalURLExist):
 			w.WriteHeader(http.StatusConflict)
-		} else {
+		case errors.Is(err, service.ErrURLBlocked):
+			w.WriteHeader(http.StatusForbidden)
+			return
+		default:
 			w.WriteHeader(http.StatusInternalServerError)
 			logger.Error("error adding new URL", zap.Error(err))
 			return
@@ -90,7 +95,7 @@ func CreateShortURL(
 		zap.String("OriginalURL", newURL.OriginalURL),
 		zap.String("ShortURL", newURL.ShortURL),
 		zap.Int("USER_ID", user.ID))
-	_, err = fmt.Fprintf(w, `%s%s`, cfg.ResultAddr+"/", newURL.ShortURL)
+	_, err = fmt.Fprint(w, service.BuildShortURL(cfg, newURL.ShortURL))
 
 	if err != nil {
 		logger.Error("error writing body", zap.Error(err))
@@ -103,18 +108,29 @@ func CreateShortURL(
 func GetFullURL(
 	w http.ResponseWriter,
 	r *http.Request,
-	_ *config.Config,
+	cfg *config.Config,
 	storage repository.Storage,
 	logger *zap.Logger) {
-	if r.Method != http.MethodGet {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
 	}
 	ctx := r.Context()
 
+	result := metrics.RedirectMiss
+	defer func() {
+		cfg.Metrics.CountRedirect(result)
+	}()
+
 	id := chi.URLParam(r, "id")
+	if strings.Contains(id, "@") {
+		// Ссылки других доменов доступны только через свой домен.
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	key := service.LinkKeyForHost(ctx, storage, cfg, r.Host, id)
 
-	matchURL, err := storage.GetURL(ctx, id)
+	matchURL, err := storage.GetURL(ctx, key)
 	if err != nil {
 		logger.Info("not found full URL by short", zap.String("shortURL", id), zap.Error(err))
 		w.WriteHeader(http.StatusNotFound)
@@ -126,8 +142,92 @@ func GetFullURL(
 		return
 	}
 
-	w.Header().Set(`Location`, matchURL.OriginalURL)
-	w.WriteHeader(http.StatusTemporaryRedirect)
+	switch err = service.CheckActiveWindow(matchURL, time.Now()); {
+	case errors.Is(err, service.ErrLinkNotYetActive):
+		w.Header().Set(`Cache-Control`, "no-store")
+		w.Header().Set(`Retry-After`, matchURL.ActiveFrom.UTC().Format(http.TimeFormat))
+		w.Header().Set(`Content-Type`, "text/plain; charset=utf-8")
+		w.WriteHeader(cfg.NotYetActiveCode)
+		if r.Method == http.MethodGet {
+			_, _ = w.Write([]byte(cfg.NotYetActiveBody))
+		}
+		return
+	case errors.Is(err, service.ErrLinkExpired):
+		w.WriteHeader(http.StatusGone)
+		return
+	}
+
+	visit := visitFromRequest(r, cfg)
+	redirect := service.ResolveRedirect(matchURL, visit, cfg)
+
+	if service.IsQuarantined(cfg, matchURL, redirect.Location) {
+		writeQuarantinePage(w, r)
+		return
+	}
+
+	if redirect.Variant != "" {
+		variantCookie := cfg.Cookie.WithPath("/" + id)
+		http.SetCookie(w, variantCookie.Cookie(variantCookieName, redirect.Variant, variantCookieLifeTime))
+	}
+
+	// Запрос HEAD не переход: ни событие, ни показ варианта не записываются.
+	if r.Method == http.MethodGet {
+		service.RecordClick(cfg, key, visit, redirect.Variant)
+	}
+
+	result = metrics.RedirectHit
+	w.Header().Set(`Location`, redirect.Location)
+	w.Header().Set(`Cache-Control`, redirect.CacheControl)
+	if redirect.Vary != "" {
+		w.Header().Set(`Vary`, redirect.Vary)
+	}
+	w.WriteHeader(redirect.Code)
+}
+
+// quarantinePage страница предупреждения вместо редиректа по ссылке в карантине.
+// Адрес назначения не показывается, чтобы не давать на него переход.
+const quarantinePage = `<!DOCTYPE html>
+<html lang="en">
+<head><meta charset="utf-8"><title>Link blocked</title></head>
+<body>
+<h1>This link has been blocked</h1>
+<p>The destination of this short link is on a domain that is blocked by the service policy
+because it may be used for phishing or malware.</p>
+</body>
+</html>
+`
+
+// writeQuarantinePage отдаёт страницу предупреждения о ссылке в карантине.
+func writeQuarantinePage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set(`Cache-Control`, "no-store")
+	w.Header().Set(`Content-Type`, "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusForbidden)
+	if r.Method == http.MethodGet {
+		_, _ = w.Write([]byte(quarantinePage))
+	}
+}
+
+// Cookie, закрепляющая за посетителем показанный вариант адреса назначения.
+const (
+	variantCookieName     = "Variant"
+	variantCookieLifeTime = 30 * 24 * time.Hour
+)
+
+// visitFromRequest собирает данные посетителя для выбора адреса редиректа и записи перехода.
+func visitFromRequest(r *http.Request, cfg *config.Config) *models.Visit {
+	visit := &models.Visit{
+		Time:           time.Now(),
+		UserAgent:      r.UserAgent(),
+		AcceptLanguage: r.Header.Get("Accept-Language"),
+		Query:          r.URL.RawQuery,
+		Referrer:       r.Referer(),
+		IP:             service.VisitorIP(cfg, r.RemoteAddr, r.Header.Get("X-Real-IP")),
+	}
+	if cookie, err := r.Cookie(variantCookieName); err == nil {
+		visit.Variant = cookie.Value
+	}
+
+	return visit
 }
 
 // APICreateShortURL создание нового URL через json.
@@ -160,10 +260,7 @@ func APICreateShortURL(
 			return
 		}
 	}
-	http.SetCookie(w, &http.Cookie{
-		Name:  "Token",
-		Value: user.Service.Token,
-	})
+	setSessionCookies(w, r, cfg, logger, user)
 
 	logger.Debug("start decoding request")
 	var req models.Request
@@ -177,11 +274,18 @@ func APICreateShortURL(
 	enc := json.NewEncoder(w)
 	w.Header().Set("Content-Type", "application/json")
 
-	newURL, err := service.AddURL(ctx, storage, logger, req.URL, cfg, user.ID)
+	newURL, err := service.AddURLOnDomain(ctx, storage, logger, req.URL, req.Domain, cfg, user.ID)
 	if err != nil {
-		if errors.Is(err, storagePkg.ErrOriginalURLExist) {
+		switch {
+		case errors.Is(err, storagePkg.ErrOriginalURLExist):
 			w.WriteHeader(http.StatusConflict)
-		} else {
+		case errors.Is(err, service.ErrInvalidDomain):
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		case errors.Is(err, service.ErrDomainNotAllowed), errors.Is(err, service.ErrURLBlocked):
+			w.WriteHeader(http.StatusForbidden)
+			return
+		default:
 			w.WriteHeader(http.StatusInternalServerError)
 			logger.Error("error adding new URL", zap.Error(err))
 			return
@@ -197,7 +301,7 @@ func APICreateShortURL(
 	}
 
 	res := models.Response{
-		ResultURL: cfg.ResultAddr + "/" + newURL.ShortURL,
+		ResultURL: service.BuildShortURL(cfg, newURL.ShortURL),
 	}
 	w.WriteHeader(http.StatusCreated)
 	logger.Debug("add new URL from /api/shorten",
@@ -248,19 +352,21 @@ func APICreateBatchURLs(
 			return
 		}
 	}
-	http.SetCookie(w, &http.Cookie{
-		Name:  "Token",
-		Value: user.Service.Token,
-	})
+	setSessionCookies(w, r, cfg, logger, user)
 
 	originalURLs := make([]string, 0, len(req.BatchURLs))
 	for _, url := range req.BatchURLs {
 		originalURLs = append(originalURLs, url.OriginalURL)
 	}
 
-	newURLs, err := repository.NewStorageMultiURL(r.Context(), originalURLs, storage, cfg, user.ID)
+	newURLs, err := service.AddURLs(ctx, storage, originalURLs, cfg, user.ID)
 	if err != nil {
-		logger.Error("error getting new storage for multi urls", zap.Error(err))
+		if errors.Is(err, service.ErrURLBlocked) {
+			logger.Info("batch rejected by url policy", zap.Error(err))
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		logger.Error("error adding new urls", zap.Error(err))
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
@@ -268,17 +374,11 @@ func APICreateBatchURLs(
 	var res models.BatchResponse
 	for i, url := range newURLs {
 		res.BatchURLs = append(res.BatchURLs, models.BatchURLResponse{
-			ShortURL:      cfg.ResultAddr + "/" + url.ShortURL,
+			ShortURL:      service.BuildShortURL(cfg, url.ShortURL),
 			CorrelationID: req.BatchURLs[i].CorrelationID,
 		})
 	}
 
-	if err = storage.AddURLs(r.Context(), newURLs); err != nil {
-		logger.Error("error adding new urls to database", zap.Error(err))
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
-
 	enc := json.NewEncoder(w)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
@@ -291,6 +391,56 @@ func APICreateBatchURLs(
 	}
 }
 
+// APICreateBatchURLsStream потоковое создание пачки URL из NDJSON. Строки сохраняются частями,
+// результат каждой строки отдаётся потоком NDJSON. Параметр skip пропускает первые строки тела,
+// чтобы продолжить прерванную загрузку с номера последней полученной строки.
+func APICreateBatchURLsStream(
+	w http.ResponseWriter,
+	r *http.Request,
+	cfg *config.Config,
+	storage repository.Storage,
+	logger *zap.Logger,
+) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if contentType := r.Header.Get("Content-Type"); contentType != "" && importFormat(contentType) != formatNDJSON {
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		return
+	}
+
+	var skip int
+	if rawSkip := r.URL.Query().Get("skip"); rawSkip != "" {
+		var err error
+		if skip, err = strconv.Atoi(rawSkip); err != nil || skip < 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	ctx := r.Context()
+	user, ok := ctx.Value(contextkeys.ContextUserKey).(*models.User)
+	if !ok {
+		logger.Error(errGetContextUser.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	var err error
+	if !user.Service.IsAuthenticated {
+		user, err = service.AddNewUser(ctx, storage, cfg)
+		if err != nil {
+			logger.Error("error adding new user", zap.Error(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+	setSessionCookies(w, r, cfg, logger, user)
+
+	writeImportStream(w, r, cfg, storage, logger, user.ID, newNDJSONImportReader(r.Body, skip))
+}
+
 // APIMarkAsDeletedURLs пометить URL на удаление.
 func APIMarkAsDeletedURLs(
 	w http.ResponseWriter,
@@ -333,7 +483,7 @@ func APIMarkAsDeletedURLs(
 	w.WriteHeader(http.StatusAccepted)
 }
 
-// GetServiceStats получить статистику сервиса: количество юзеров и URL.
+// GetServiceStats получить статистику сервиса: ссылки, пользователи, переходы и самые популярные ссылки.
 func GetServiceStats(
 	w http.ResponseWriter,
 	r *http.Request,
@@ -343,66 +493,74 @@ func GetServiceStats(
 ) {
 	ctx := r.Context()
 
-	var (
-		usrIPHeader string
-		usrIP       net.IP
-		trustedNet  *net.IPNet
-		err         error
-		usersCount  int
-		urlsCount   int
-	)
-
-	if usrIPHeader = r.Header.Get("X-Real-IP"); usrIPHeader == "" {
-		logger.Error("empty X-Real-IP header in stats request")
-		w.WriteHeader(http.StatusForbidden)
+	if !fromTrustedSubnet(w, r, cfg, logger) {
 		return
 	}
 
-	usrIP = net.ParseIP(usrIPHeader)
-	if usrIP == nil {
-		logger.Error("error parsing IP from header", zap.String("IP header", usrIPHeader))
-		w.WriteHeader(http.StatusForbidden)
-		return
-	}
-
-	_, trustedNet, err = net.ParseCIDR(cfg.TrustedSubNet)
+	sr, err := service.GetServiceStats(ctx, cfg, storage)
 	if err != nil {
-		logger.Error("error parsing CIDR from config", zap.Error(err))
+		logger.Error("error getting service stats", zap.Error(err))
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	if !trustedNet.Contains(usrIP) {
-		w.WriteHeader(http.StatusForbidden)
-		return
+	enc := json.NewEncoder(w)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	if err = enc.Encode(sr); err != nil {
+		logger.Error("error encoding json to stats request", zap.Error(err))
 	}
+}
 
-	usersCount, err = storage.GetUsersCount(ctx)
-	if err != nil {
-		logger.Error("error getting users count", zap.Error(err))
-		w.WriteHeader(http.StatusInternalServerError)
-		return
+// fromTrustedSubnet проверяет, что запрос пришёл из доверенной подсети по заголовку X-Real-IP.
+// Если нет, пишет код ответа и возвращает false.
+func fromTrustedSubnet(w http.ResponseWriter, r *http.Request, cfg *config.Config, logger *zap.Logger) bool {
+	usrIPHeader := r.Header.Get("X-Real-IP")
+	if usrIPHeader == "" {
+		logger.Error("empty X-Real-IP header in internal request", zap.String("URI", r.RequestURI))
+		w.WriteHeader(http.StatusForbidden)
+		return false
 	}
-	urlsCount, err = storage.GetURLsCount(ctx)
+
+	return inTrustedSubnet(w, usrIPHeader, cfg, logger)
+}
+
+// fromTrustedPeer проверяет, что доверенной подсети принадлежит адрес самого соединения. Заголовок X-Real-IP
+// подделывается клиентом, поэтому им нельзя защищать управление ключами подписи.
+// Если адрес не доверенный, пишет код ответа и возвращает false.
+func fromTrustedPeer(w http.ResponseWriter, r *http.Request, cfg *config.Config, logger *zap.Logger) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
 	if err != nil {
-		logger.Error("error getting urls count", zap.Error(err))
-		w.WriteHeader(http.StatusInternalServerError)
-		return
+		logger.Error("error parsing remote address", zap.String("remote addr", r.RemoteAddr), zap.Error(err))
+		w.WriteHeader(http.StatusForbidden)
+		return false
 	}
 
-	sr := models.StatsResponse{
-		URLs:  urlsCount,
-		Users: usersCount,
+	return inTrustedSubnet(w, host, cfg, logger)
+}
+
+// inTrustedSubnet проверяет, что адрес ip входит в доверенную подсеть. Если нет, пишет код ответа и возвращает false.
+func inTrustedSubnet(w http.ResponseWriter, ip string, cfg *config.Config, logger *zap.Logger) bool {
+	usrIP := net.ParseIP(ip)
+	if usrIP == nil {
+		logger.Error("error parsing IP address", zap.String("IP", ip))
+		w.WriteHeader(http.StatusForbidden)
+		return false
 	}
 
-	enc := json.NewEncoder(w)
-	if err = enc.Encode(sr); err != nil {
-		logger.Error("error encoding json to stats request", zap.Error(err))
+	_, trustedNet, err := net.ParseCIDR(cfg.TrustedSubNet)
+	if err != nil {
+		logger.Error("error parsing CIDR from config", zap.Error(err))
 		w.WriteHeader(http.StatusInternalServerError)
-		return
+		return false
 	}
 
-	w.WriteHeader(http.StatusOK)
+	if !trustedNet.Contains(usrIP) {
+		w.WriteHeader(http.StatusForbidden)
+		return false
+	}
+	return true
 }
 
 // PingDatabase проверка соединения с базой данных.
@@ -3,23 +3,31 @@ package handlers
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
+	"encoding/json"
 	"fmt"
 	"log"
 	"math/rand"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/Melikhov-p/url-minimise/internal/auth"
+	"github.com/Melikhov-p/url-minimise/internal/clicks"
 	"github.com/Melikhov-p/url-minimise/internal/config"
 	loggerBuilder "github.com/Melikhov-p/url-minimise/internal/logger"
 	"github.com/Melikhov-p/url-minimise/internal/middlewares"
+	"github.com/Melikhov-p/url-minimise/internal/models"
+	"github.com/Melikhov-p/url-minimise/internal/policy"
 	"github.com/Melikhov-p/url-minimise/internal/repository"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-resty/resty/v2"
+	"github.com/golang-jwt/jwt/v4"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
@@ -29,6 +37,7 @@ func setupTest(t *testing.T) (*config.Config, *zap.Logger) {
 	logger, err := loggerBuilder.BuildLogger("DEBUG")
 	assert.NoError(t, err)
 	cfg := config.NewConfig(logger, true)
+	cfg.Storage.FileStorage.FilePath = filepath.Join(t.TempDir(), "storage.txt")
 
 	return cfg, logger
 }
@@ -481,7 +490,7 @@ func TestAPIMarkAsDeletedURLs(t *testing.T) {
 	}
 
 	var shortURLs []string
-	token, err := auth.BuildJWTString(999, cfg.SecretKey, 24*time.Hour)
+	token, err := auth.BuildJWTString(999, cfg.SigningKeys, 24*time.Hour)
 	assert.NoError(t, err)
 
 	logger.Debug("URLS", zap.Any("URLS", newURLsForDelete))
@@ -563,3 +572,295 @@ func createRandomURL() string {
 
 	return u.String()
 }
+
+func TestURLPolicy(t *testing.T) {
+	router := chi.NewRouter()
+
+	cfg, log := setupTest(t)
+	storage, err := repository.NewStorage(cfg, log)
+	require.NoError(t, err)
+	middleware := middlewares.Middleware{
+		Logger:  log,
+		Storage: storage,
+		Cfg:     cfg,
+	}
+	router.Use(middleware.WithAuth)
+
+	router.Post("/api/shorten", func(w http.ResponseWriter, r *http.Request) {
+		APICreateShortURL(w, r, cfg, storage, log)
+	})
+	router.Post("/api/shorten/batch", func(w http.ResponseWriter, r *http.Request) {
+		APICreateBatchURLs(w, r, cfg, storage, log)
+	})
+	router.Get("/{id}", func(w http.ResponseWriter, r *http.Request) {
+		GetFullURL(w, r, cfg, storage, log)
+	})
+	router.Head("/{id}", func(w http.ResponseWriter, r *http.Request) {
+		GetFullURL(w, r, cfg, storage, log)
+	})
+
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	var created models.Response
+	resp, err := resty.New().R().
+		SetBody(`{"url":"https://login.evil.com/account"}`).
+		SetResult(&created).
+		Post(srv.URL + "/api/shorten")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusCreated, resp.StatusCode())
+	short := created.ResultURL[len(cfg.ResultAddr)+1:]
+
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	require.NoError(t, os.WriteFile(path, []byte("*.evil.com\n"), 0600))
+	cfg.URLPolicy = policy.New(path, policy.ModeBlock)
+	_, err = cfg.URLPolicy.Reload()
+	require.NoError(t, err)
+
+	resp, err = resty.New().R().
+		SetBody(`{"url":"https://www.evil.com"}`).
+		Post(srv.URL + "/api/shorten")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode())
+
+	resp, err = resty.New().R().
+		SetBody(`[{"correlation_id":"1","original_url":"https://example.com"},` +
+			`{"correlation_id":"2","original_url":"https://cdn.evil.com"}]`).
+		Post(srv.URL + "/api/shorten/batch")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode())
+
+	client := resty.New().SetRedirectPolicy(resty.NoRedirectPolicy())
+
+	resp, _ = client.R().Get(srv.URL + "/" + short)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode())
+	assert.Equal(t, "no-store", resp.Header().Get("Cache-Control"))
+	assert.Contains(t, resp.Header().Get("Content-Type"), "text/html")
+	assert.Contains(t, string(resp.Body()), "This link has been blocked")
+	assert.NotContains(t, string(resp.Body()), "evil.com")
+	assert.Empty(t, resp.Header().Get("Location"))
+
+	resp, _ = client.R().Head(srv.URL + "/" + short)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode())
+
+	// После снятия блокировки ссылка снова ведёт на адрес назначения.
+	cfg.URLPolicy = policy.New("", policy.ModeBlock)
+	resp, _ = client.R().Get(srv.URL + "/" + short)
+	assert.Equal(t, http.StatusTemporaryRedirect, resp.StatusCode())
+	assert.Equal(t, "https://login.evil.com/account", resp.Header().Get("Location"))
+}
+
+func TestGetFullURL_RecordsClick(t *testing.T) {
+	cfg, logger := setupTest(t)
+	cfg.Clicks = clicks.NewBuffer(1)
+	storage, err := repository.NewStorage(cfg, logger)
+	require.NoError(t, err)
+
+	_, err = storage.AddURL(context.Background(), &models.StorageURL{ShortURL: "clicked", OriginalURL: createRandomURL()})
+	require.NoError(t, err)
+
+	router := chi.NewRouter()
+	router.HandleFunc("/{id}", func(w http.ResponseWriter, r *http.Request) {
+		GetFullURL(w, r, cfg, storage, logger)
+	})
+
+	request := httptest.NewRequest(http.MethodGet, "/clicked", http.NoBody)
+	request.Header.Set("Referer", "https://ref.example.com/post")
+	request.Header.Set("User-Agent", "test-agent")
+	request.Header.Set("X-Real-IP", "203.0.113.54")
+	request.RemoteAddr = "192.168.1.10:40000"
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, request)
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+
+	require.Equal(t, 1, cfg.Clicks.Len())
+	event := <-cfg.Clicks.Events()
+	assert.Equal(t, "clicked", event.ShortURL)
+	assert.Equal(t, "https://ref.example.com/post", event.Referrer)
+	assert.Equal(t, "test-agent", event.UserAgent)
+	assert.Equal(t, "203.0.113.0", event.IP)
+	assert.False(t, event.Time.IsZero())
+
+	// X-Real-IP от клиента не из доверенной подсети не подменяет адрес соединения.
+	spoofed := httptest.NewRequest(http.MethodGet, "/clicked", http.NoBody)
+	spoofed.Header.Set("X-Real-IP", "203.0.113.54")
+	spoofed.RemoteAddr = "198.51.100.7:40000"
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, spoofed)
+	require.Equal(t, 1, cfg.Clicks.Len())
+	event = <-cfg.Clicks.Events()
+	assert.Equal(t, "198.51.100.0", event.IP)
+
+	// HEAD не считается переходом.
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodHead, "/clicked", http.NoBody))
+	assert.Equal(t, 0, cfg.Clicks.Len())
+
+	// При заполненном буфере редирект не ждёт, событие учитывается как потерянное.
+	for range 2 {
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/clicked", http.NoBody))
+		assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	}
+	assert.Equal(t, int64(1), cfg.Clicks.Dropped())
+}
+
+func TestMetrics(t *testing.T) {
+	cfg, logger := setupTest(t)
+	storage, err := repository.NewStorage(cfg, logger)
+	require.NoError(t, err)
+
+	_, err = storage.AddURL(context.Background(), &models.StorageURL{
+		ShortURL:    "measured",
+		OriginalURL: createRandomURL(),
+	})
+	require.NoError(t, err)
+
+	middleware := middlewares.Middleware{Logger: logger, Storage: storage, Cfg: cfg}
+	router := chi.NewRouter()
+	router.Use(middleware.WithLogging)
+	router.Get("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		Metrics(w, r, cfg, storage, logger)
+	})
+	router.Get("/{id}", func(w http.ResponseWriter, r *http.Request) {
+		GetFullURL(w, r, cfg, storage, logger)
+	})
+
+	for _, short := range []string{"measured", "missing"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/"+short, http.NoBody))
+	}
+
+	tests := []struct {
+		name     string
+		realIP   string
+		wantCode int
+	}{
+		{name: "without X-Real-IP", realIP: "", wantCode: http.StatusForbidden},
+		{name: "untrusted subnet", realIP: "10.0.0.1", wantCode: http.StatusForbidden},
+		{name: "trusted subnet", realIP: "192.168.1.10", wantCode: http.StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "/metrics", http.NoBody)
+			if test.realIP != "" {
+				request.Header.Set("X-Real-IP", test.realIP)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, request)
+			assert.Equal(t, test.wantCode, w.Code)
+		})
+	}
+
+	request := httptest.NewRequest(http.MethodGet, "/metrics", http.NoBody)
+	request.Header.Set("X-Real-IP", "192.168.1.10")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, request)
+
+	body := w.Body.String()
+	assert.Contains(t, body, `shortener_redirects_total{result="hit"} 1`)
+	assert.Contains(t, body, `shortener_redirects_total{result="miss"} 1`)
+	assert.Contains(t, body, `shortener_http_requests_total{method="GET",route="/{id}",status="307"} 1`)
+	assert.Contains(t, body, `shortener_http_requests_total{method="GET",route="/{id}",status="404"} 1`)
+	assert.Contains(t, body, `shortener_http_requests_total{method="GET",route="/metrics",status="403"} 2`)
+	assert.Contains(t, body, `shortener_storage_operation_duration_seconds_count{backend="file",operation="get_url"} 2`)
+	assert.Contains(t, body, `shortener_storage_operation_errors_total{backend="file",operation="get_url"} 1`)
+}
+
+func TestAPISigningKeys(t *testing.T) {
+	cfg, logger := setupTest(t)
+	storage, err := repository.NewStorage(cfg, logger)
+	require.NoError(t, err)
+
+	router := chi.NewRouter()
+	router.Get("/api/internal/keys", func(w http.ResponseWriter, r *http.Request) {
+		APIGetSigningKeys(w, r, cfg, storage, logger)
+	})
+	router.Post("/api/internal/keys/rotate", func(w http.ResponseWriter, r *http.Request) {
+		APIRotateSigningKey(w, r, cfg, storage, logger)
+	})
+	router.Delete("/api/internal/keys/{kid}", func(w http.ResponseWriter, r *http.Request) {
+		APIRetireSigningKey(w, r, cfg, storage, logger)
+	})
+
+	serve := func(method, target, remoteIP string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, target, http.NoBody)
+		request.RemoteAddr = remoteIP + ":40000"
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, request)
+		return w
+	}
+
+	assert.Equal(t, http.StatusForbidden, serve(http.MethodPost, "/api/internal/keys/rotate", "10.0.0.1").Code)
+
+	// Доверенный адрес в заголовке X-Real-IP не даёт доступа: проверяется адрес соединения.
+	spoofed := httptest.NewRequest(http.MethodPost, "/api/internal/keys/rotate", http.NoBody)
+	spoofed.RemoteAddr = "10.0.0.1:40000"
+	spoofed.Header.Set("X-Real-IP", "192.168.1.10")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, spoofed)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	first, err := cfg.SigningKeys.Signing()
+	require.NoError(t, err)
+	token, err := auth.BuildJWTString(999, cfg.SigningKeys, time.Hour)
+	require.NoError(t, err)
+
+	w = serve(http.MethodPost, "/api/internal/keys/rotate", "192.168.1.10")
+	require.Equal(t, http.StatusCreated, w.Code)
+	var rotated models.SigningKeyResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&rotated))
+	assert.True(t, rotated.Signing)
+	assert.NotEqual(t, first.ID, rotated.ID)
+
+	w = serve(http.MethodGet, "/api/internal/keys", "192.168.1.10")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), first.Secret)
+	var keys []models.SigningKeyResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&keys))
+	require.Len(t, keys, 2)
+	assert.Equal(t, first.ID, keys[0].ID)
+	assert.Equal(t, rotated.ID, keys[1].ID)
+
+	_, err = auth.GetUserID(token, cfg.SigningKeys)
+	assert.NoError(t, err)
+
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodDelete, "/api/internal/keys/missing", "192.168.1.10").Code)
+	assert.Equal(t, http.StatusNoContent, serve(http.MethodDelete, "/api/internal/keys/"+first.ID, "192.168.1.10").Code)
+
+	_, err = auth.GetUserID(token, cfg.SigningKeys)
+	assert.ErrorIs(t, err, auth.ErrInvalidToken)
+}
+
+func TestGetJWKS(t *testing.T) {
+	cfg, logger := setupTest(t)
+	cfg.SigningAlgorithm = auth.AlgEdDSA
+	storage, err := repository.NewStorage(cfg, logger)
+	require.NoError(t, err)
+
+	signing, err := cfg.SigningKeys.Signing()
+	require.NoError(t, err)
+	assert.Equal(t, auth.AlgEdDSA, signing.Algorithm)
+	token, err := auth.BuildJWTString(42, cfg.SigningKeys, time.Hour)
+	require.NoError(t, err)
+
+	request := httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", http.NoBody)
+	w := httptest.NewRecorder()
+	GetJWKS(w, request, cfg, storage, logger)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.NotContains(t, w.Body.String(), "PRIVATE KEY")
+
+	// Другой сервис проверяет токен по опубликованному открытому ключу.
+	var set auth.JWKS
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&set))
+	jwk, ok := set.Key(signing.ID)
+	require.True(t, ok)
+	public, err := jwk.PublicKey()
+	require.NoError(t, err)
+	parsed, err := jwt.Parse(token, func(*jwt.Token) (any, error) {
+		return public, nil
+	}, jwt.WithValidMethods([]string{auth.AlgEdDSA}))
+	require.NoError(t, err)
+	assert.True(t, parsed.Valid)
+}
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 
 	"github.com/Melikhov-p/url-minimise/internal/config"
@@ -9,6 +10,8 @@ import (
 	"github.com/Melikhov-p/url-minimise/internal/models"
 	"github.com/Melikhov-p/url-minimise/internal/repository"
 	"github.com/Melikhov-p/url-minimise/internal/service"
+	storagePkg "github.com/Melikhov-p/url-minimise/internal/storage"
+	"github.com/go-chi/chi/v5"
 	"go.uber.org/zap"
 )
 
@@ -38,10 +41,7 @@ func GetUserURLs(
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
-		http.SetCookie(w, &http.Cookie{
-			Name:  "Token",
-			Value: user.Service.Token,
-		})
+		setSessionCookies(w, r, cfg, logger, user)
 		logger.Debug("unAuthorized user")
 		w.WriteHeader(http.StatusNoContent)
 		return
@@ -65,8 +65,10 @@ func GetUserURLs(
 	var res models.UserURLsResponse
 	for _, url := range urls {
 		res.UserURLs = append(res.UserURLs, &models.UserURL{
-			ShortURL:    cfg.ResultAddr + "/" + url.ShortURL,
+			ID:          url.ShortURL,
+			ShortURL:    service.BuildShortURL(cfg, url.ShortURL),
 			OriginalURL: url.OriginalURL,
+			Quarantined: url.Quarantined,
 		})
 	}
 	w.WriteHeader(http.StatusOK)
@@ -76,3 +78,194 @@ func GetUserURLs(
 		logger.Error("error encoding user's urls response", zap.Error(err))
 	}
 }
+
+// APIGetBrokenURLs получение ссылок пользователя, адрес назначения которых не отвечает.
+func APIGetBrokenURLs(
+	w http.ResponseWriter,
+	r *http.Request,
+	cfg *config.Config,
+	storage repository.Storage,
+	logger *zap.Logger,
+) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx := r.Context()
+	user, ok := ctx.Value(contextkeys.ContextUserKey).(*models.User)
+	if !ok {
+		logger.Error(errGetContextUser.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !user.Service.IsAuthenticated {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	broken, err := service.GetBrokenURLs(ctx, storage, cfg, user.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logger.Error("error getting broken urls", zap.Error(err))
+		return
+	}
+
+	if len(broken) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	enc := json.NewEncoder(w)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	if err = enc.Encode(broken); err != nil {
+		logger.Error("error encoding broken urls response", zap.Error(err))
+	}
+}
+
+// APIRestoreDeletedURLs восстановить удалённые URL пользователя в пределах срока хранения.
+func APIRestoreDeletedURLs(
+	w http.ResponseWriter,
+	r *http.Request,
+	cfg *config.Config,
+	storage repository.Storage,
+	logger *zap.Logger,
+) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx := r.Context()
+	user, ok := ctx.Value(contextkeys.ContextUserKey).(*models.User)
+	if !ok {
+		logger.Error(errGetContextUser.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !user.Service.IsAuthenticated {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var shortURLs []string
+	dec := json.NewDecoder(r.Body)
+	if err := dec.Decode(&shortURLs); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		logger.Error("error decoding restore request", zap.Error(err))
+		return
+	}
+
+	restored, err := service.RestoreURLs(ctx, shortURLs, user.ID, storage, cfg)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logger.Error("error restoring user's urls", zap.Error(err))
+		return
+	}
+
+	if len(restored) == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	enc := json.NewEncoder(w)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	if err = enc.Encode(restored); err != nil {
+		logger.Error("error encoding restore response", zap.Error(err))
+	}
+}
+
+// APIUpdateURLSettings изменить настройки URL владельцем.
+func APIUpdateURLSettings(
+	w http.ResponseWriter,
+	r *http.Request,
+	cfg *config.Config,
+	storage repository.Storage,
+	logger *zap.Logger,
+) {
+	if r.Method != http.MethodPatch {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx := r.Context()
+	user, ok := ctx.Value(contextkeys.ContextUserKey).(*models.User)
+	if !ok {
+		logger.Error(errGetContextUser.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !user.Service.IsAuthenticated {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var req models.URLSettingsRequest
+	dec := json.NewDecoder(r.Body)
+	if err := dec.Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		logger.Error("error decoding url settings request", zap.Error(err))
+		return
+	}
+
+	updated, err := service.UpdateURLSettings(ctx, storage, chi.URLParam(r, "id"), user.ID, &req)
+	if err != nil {
+		code := ownerErrorStatus(err)
+		if code == http.StatusInternalServerError {
+			logger.Error("error updating url settings", zap.Error(err))
+		}
+		w.WriteHeader(code)
+		return
+	}
+
+	if saver, ok := storage.(repository.StorageSaver); ok {
+		if err = saver.Save(updated); err != nil {
+			logger.Error("error saving updated URL", zap.Error(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	res := models.URLSettingsResponse{
+		ShortURL:         service.BuildShortURL(cfg, updated.ShortURL),
+		OriginalURL:      updated.OriginalURL,
+		RedirectCode:     service.RedirectCode(updated),
+		NoCache:          updated.NoCache,
+		QueryPassthrough: updated.QueryPassthrough,
+		UTM:              updated.UTM,
+		ActiveFrom:       updated.ActiveFrom,
+		ActiveUntil:      updated.ActiveUntil,
+		Quarantined:      updated.Quarantined,
+	}
+
+	enc := json.NewEncoder(w)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	if err = enc.Encode(res); err != nil {
+		logger.Error("error encoding url settings response", zap.Error(err))
+	}
+}
+
+// ownerErrorStatus HTTP-код ответа для ошибки операции владельца над своим URL.
+func ownerErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, storagePkg.ErrNotFound), errors.Is(err, service.ErrNotURLOwner):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrInvalidRedirectCode),
+		errors.Is(err, service.ErrInvalidRedirectRule),
+		errors.Is(err, service.ErrInvalidVariant),
+		errors.Is(err, service.ErrInvalidUTMTemplate),
+		errors.Is(err, service.ErrInvalidActiveWindow),
+		errors.Is(err, service.ErrInvalidStatsQuery):
+		return http.StatusBadRequest
+	case errors.Is(err, service.ErrURLBlocked):
+		return http.StatusForbidden
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -1,15 +1,29 @@
 package handlers
 
 import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/Melikhov-p/url-minimise/internal/auth"
+	"github.com/Melikhov-p/url-minimise/internal/auth/oidctest"
+	"github.com/Melikhov-p/url-minimise/internal/clicks"
 	"github.com/Melikhov-p/url-minimise/internal/middlewares"
+	"github.com/Melikhov-p/url-minimise/internal/models"
 	"github.com/Melikhov-p/url-minimise/internal/repository"
+	"github.com/Melikhov-p/url-minimise/internal/service"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-resty/resty/v2"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestGetUserURLs(t *testing.T) {
@@ -81,3 +95,1273 @@ func TestGetUserURLs(t *testing.T) {
 		})
 	}
 }
+
+func TestGetUserURLs_LinkKey(t *testing.T) {
+	router := chi.NewRouter()
+
+	cfg, log := setupTest(t)
+	storage, err := repository.NewStorage(cfg, log)
+	require.NoError(t, err)
+	middleware := middlewares.Middleware{
+		Logger:  log,
+		Storage: storage,
+		Cfg:     cfg,
+	}
+	router.Use(middleware.WithAuth)
+
+	router.Get("/api/user/urls",
+		func(w http.ResponseWriter, r *http.Request) {
+			GetUserURLs(w, r, cfg, storage, log)
+		})
+
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	_, err = storage.AddURL(context.Background(), &models.StorageURL{
+		ShortURL:    models.LinkKey("promo", "go.example.com"),
+		OriginalURL: "https://example.com/promo",
+		UserID:      999,
+	})
+	require.NoError(t, err)
+	token, err := auth.BuildJWTString(999, cfg.SigningKeys, time.Hour)
+	require.NoError(t, err)
+
+	var urls []*models.UserURL
+	resp, err := resty.New().R().
+		SetCookie(&http.Cookie{Name: "Token", Value: token}).
+		SetResult(&urls).
+		Get(srv.URL + "/api/user/urls")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode())
+
+	// Ссылку другого домена владелец находит по ключу хранилища, а не по коду из короткой ссылки.
+	require.Len(t, urls, 1)
+	assert.Equal(t, "promo@go.example.com", urls[0].ID)
+}
+
+func TestAPIRestoreDeletedURLs(t *testing.T) {
+	router := chi.NewRouter()
+
+	cfg, log := setupTest(t)
+	storage, err := repository.NewStorage(cfg, log)
+	assert.NoError(t, err)
+	middleware := middlewares.Middleware{
+		Logger:  log,
+		Storage: storage,
+		Cfg:     cfg,
+	}
+	router.Use(middleware.WithAuth)
+
+	router.Post("/api/user/urls/restore",
+		func(w http.ResponseWriter, r *http.Request) {
+			APIRestoreDeletedURLs(w, r, cfg, storage, log)
+		})
+
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	ctx := context.Background()
+	newURL, err := service.AddURL(ctx, storage, log, createRandomURL(), cfg, 999)
+	assert.NoError(t, err)
+	err = storage.MarkAsDeletedURL(ctx, []*models.DelTask{{URL: newURL.ShortURL, UserID: 999}})
+	assert.NoError(t, err)
+
+	token, err := auth.BuildJWTString(999, cfg.SigningKeys, time.Hour)
+	assert.NoError(t, err)
+
+	testCases := []struct {
+		name         string
+		token        string
+		body         string
+		expectedCode int
+	}{
+		{
+			name:         "Unauthorized",
+			body:         `["` + newURL.ShortURL + `"]`,
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name:         "Bad Request",
+			token:        token,
+			body:         `{"short":"url"}`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "Restored",
+			token:        token,
+			body:         `["` + newURL.ShortURL + `"]`,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "Nothing To Restore",
+			token:        token,
+			body:         `["` + newURL.ShortURL + `"]`,
+			expectedCode: http.StatusNotFound,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			request := resty.New().R()
+			request.URL = srv.URL + "/api/user/urls/restore"
+			request.Method = http.MethodPost
+			request.SetBody(testCase.body)
+			if testCase.token != "" {
+				request.SetCookie(&http.Cookie{Name: "Token", Value: testCase.token})
+			}
+
+			resp, err := request.Send()
+			assert.NoError(t, err)
+			assert.Equal(t, testCase.expectedCode, resp.StatusCode())
+		})
+	}
+}
+
+func TestAPIUpdateURLSettings(t *testing.T) {
+	router := chi.NewRouter()
+
+	cfg, log := setupTest(t)
+	storage, err := repository.NewStorage(cfg, log)
+	assert.NoError(t, err)
+	middleware := middlewares.Middleware{
+		Logger:  log,
+		Storage: storage,
+		Cfg:     cfg,
+	}
+	router.Use(middleware.WithAuth)
+
+	router.Patch("/api/user/urls/{id}",
+		func(w http.ResponseWriter, r *http.Request) {
+			APIUpdateURLSettings(w, r, cfg, storage, log)
+		})
+	router.MethodFunc(http.MethodHead, "/{id}", func(w http.ResponseWriter, r *http.Request) {
+		GetFullURL(w, r, cfg, storage, log)
+	})
+
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	newURL, err := service.AddURL(context.Background(), storage, log, createRandomURL(), cfg, 999)
+	assert.NoError(t, err)
+
+	token, err := auth.BuildJWTString(999, cfg.SigningKeys, time.Hour)
+	assert.NoError(t, err)
+	otherToken, err := auth.BuildJWTString(1000, cfg.SigningKeys, time.Hour)
+	assert.NoError(t, err)
+
+	testCases := []struct {
+		name         string
+		token        string
+		short        string
+		body         string
+		expectedCode int
+	}{
+		{
+			name:         "Unauthorized",
+			short:        newURL.ShortURL,
+			body:         `{"redirect_code":301}`,
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name:         "Not Owner",
+			token:        otherToken,
+			short:        newURL.ShortURL,
+			body:         `{"redirect_code":301}`,
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "Invalid Code",
+			token:        token,
+			short:        newURL.ShortURL,
+			body:         `{"redirect_code":200}`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "Invalid UTM",
+			token:        token,
+			short:        newURL.ShortURL,
+			body:         `{"utm":{"ref":"x"}}`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "Updated",
+			token:        token,
+			short:        newURL.ShortURL,
+			body:         `{"redirect_code":301}`,
+			expectedCode: http.StatusOK,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			request := resty.New().R()
+			request.URL = srv.URL + "/api/user/urls/" + testCase.short
+			request.Method = http.MethodPatch
+			request.SetBody(testCase.body)
+			if testCase.token != "" {
+				request.SetCookie(&http.Cookie{Name: "Token", Value: testCase.token})
+			}
+
+			resp, err := request.Send()
+			assert.NoError(t, err)
+			assert.Equal(t, testCase.expectedCode, resp.StatusCode())
+		})
+	}
+
+	t.Run("Head Redirect", func(t *testing.T) {
+		request := resty.New().SetRedirectPolicy(resty.NoRedirectPolicy()).R()
+		request.URL = srv.URL + "/" + newURL.ShortURL
+		request.Method = http.MethodHead
+
+		resp, _ := request.Send()
+		assert.Equal(t, http.StatusMovedPermanently, resp.StatusCode())
+		assert.Equal(t, newURL.OriginalURL, resp.Header().Get("Location"))
+		assert.Equal(t, "public, max-age=86400", resp.Header().Get("Cache-Control"))
+	})
+
+	t.Run("Query Passthrough", func(t *testing.T) {
+		resp, err := resty.New().R().
+			SetCookie(&http.Cookie{Name: "Token", Value: token}).
+			SetBody(`{"query_passthrough":true,"utm":{"utm_source":"{short}"}}`).
+			SetResult(&models.URLSettingsResponse{}).
+			Patch(srv.URL + "/api/user/urls/" + newURL.ShortURL)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode())
+
+		settings := resp.Result().(*models.URLSettingsResponse)
+		assert.True(t, settings.QueryPassthrough)
+		assert.Equal(t, map[string]string{"utm_source": "{short}"}, settings.UTM)
+
+		request := resty.New().SetRedirectPolicy(resty.NoRedirectPolicy()).R()
+		request.URL = srv.URL + "/" + newURL.ShortURL + "?ref=tg&q=a+b"
+		request.Method = http.MethodHead
+
+		resp, _ = request.Send()
+		assert.Equal(t,
+			newURL.OriginalURL+"?utm_source="+newURL.ShortURL+"&ref=tg&q=a+b",
+			resp.Header().Get("Location"),
+		)
+	})
+}
+
+func TestAPIRedirectRules(t *testing.T) {
+	router := chi.NewRouter()
+
+	cfg, log := setupTest(t)
+	storage, err := repository.NewStorage(cfg, log)
+	assert.NoError(t, err)
+	middleware := middlewares.Middleware{
+		Logger:  log,
+		Storage: storage,
+		Cfg:     cfg,
+	}
+	router.Use(middleware.WithAuth)
+
+	router.Put("/api/user/urls/{id}/rules",
+		func(w http.ResponseWriter, r *http.Request) {
+			APISetRedirectRules(w, r, cfg, storage, log)
+		})
+	router.Get("/api/user/urls/{id}/rules",
+		func(w http.ResponseWriter, r *http.Request) {
+			APIGetRedirectRules(w, r, cfg, storage, log)
+		})
+	router.Get("/{id}", func(w http.ResponseWriter, r *http.Request) {
+		GetFullURL(w, r, cfg, storage, log)
+	})
+
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	newURL, err := service.AddURL(context.Background(), storage, log, createRandomURL(), cfg, 999)
+	assert.NoError(t, err)
+
+	token, err := auth.BuildJWTString(999, cfg.SigningKeys, time.Hour)
+	assert.NoError(t, err)
+	otherToken, err := auth.BuildJWTString(1000, cfg.SigningKeys, time.Hour)
+	assert.NoError(t, err)
+
+	rules := `[{"device":"ios","destination":"https://apps.apple.com/app"}]`
+
+	testCases := []struct {
+		name         string
+		token        string
+		body         string
+		expectedCode int
+	}{
+		{
+			name:         "Unauthorized",
+			body:         rules,
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name:         "Not Owner",
+			token:        otherToken,
+			body:         rules,
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "Invalid Rule",
+			token:        token,
+			body:         `[{"device":"tv","destination":"https://example.com"}]`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "Updated",
+			token:        token,
+			body:         rules,
+			expectedCode: http.StatusNoContent,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			request := resty.New().R()
+			request.URL = srv.URL + "/api/user/urls/" + newURL.ShortURL + "/rules"
+			request.Method = http.MethodPut
+			request.SetBody(testCase.body)
+			if testCase.token != "" {
+				request.SetCookie(&http.Cookie{Name: "Token", Value: testCase.token})
+			}
+
+			resp, err := request.Send()
+			assert.NoError(t, err)
+			assert.Equal(t, testCase.expectedCode, resp.StatusCode())
+		})
+	}
+
+	t.Run("List", func(t *testing.T) {
+		resp, err := resty.New().R().
+			SetCookie(&http.Cookie{Name: "Token", Value: token}).
+			Get(srv.URL + "/api/user/urls/" + newURL.ShortURL + "/rules")
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode())
+		assert.JSONEq(t, rules, string(resp.Body()))
+	})
+
+	t.Run("Redirect", func(t *testing.T) {
+		client := resty.New().SetRedirectPolicy(resty.NoRedirectPolicy())
+
+		resp, _ := client.R().SetHeader("User-Agent", "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0)").
+			Get(srv.URL + "/" + newURL.ShortURL)
+		assert.Equal(t, "https://apps.apple.com/app", resp.Header().Get("Location"))
+
+		resp, _ = client.R().SetHeader("User-Agent", "Mozilla/5.0 (Windows NT 10.0)").
+			Get(srv.URL + "/" + newURL.ShortURL)
+		assert.Equal(t, newURL.OriginalURL, resp.Header().Get("Location"))
+	})
+}
+
+func TestAPIVariants(t *testing.T) {
+	router := chi.NewRouter()
+
+	cfg, log := setupTest(t)
+	cfg.Clicks = clicks.NewBuffer(10)
+	storage, err := repository.NewStorage(cfg, log)
+	assert.NoError(t, err)
+	middleware := middlewares.Middleware{
+		Logger:  log,
+		Storage: storage,
+		Cfg:     cfg,
+	}
+	router.Use(middleware.WithAuth)
+
+	router.Put("/api/user/urls/{id}/variants",
+		func(w http.ResponseWriter, r *http.Request) {
+			APISetVariants(w, r, cfg, storage, log)
+		})
+	router.Get("/api/user/urls/{id}/variants",
+		func(w http.ResponseWriter, r *http.Request) {
+			APIGetVariants(w, r, cfg, storage, log)
+		})
+	router.Get("/{id}", func(w http.ResponseWriter, r *http.Request) {
+		GetFullURL(w, r, cfg, storage, log)
+	})
+	router.Head("/{id}", func(w http.ResponseWriter, r *http.Request) {
+		GetFullURL(w, r, cfg, storage, log)
+	})
+
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	newURL, err := service.AddURL(context.Background(), storage, log, createRandomURL(), cfg, 999)
+	assert.NoError(t, err)
+
+	token, err := auth.BuildJWTString(999, cfg.SigningKeys, time.Hour)
+	assert.NoError(t, err)
+
+	resp, err := resty.New().R().
+		SetCookie(&http.Cookie{Name: "Token", Value: token}).
+		SetBody(`[{"name":"a","destination":"https://example.com/a","weight":1},` +
+			`{"name":"b","destination":"https://example.com/b","weight":1}]`).
+		Put(srv.URL + "/api/user/urls/" + newURL.ShortURL + "/variants")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode())
+
+	resp, err = resty.New().R().
+		SetCookie(&http.Cookie{Name: "Token", Value: token}).
+		SetBody(`[{"name":"a","destination":"https://example.com/a","weight":-1}]`).
+		Put(srv.URL + "/api/user/urls/" + newURL.ShortURL + "/variants")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode())
+
+	client := resty.New().SetRedirectPolicy(resty.NoRedirectPolicy())
+
+	// Первый переход выбирает вариант и закрепляет его cookie.
+	resp, _ = client.R().Get(srv.URL + "/" + newURL.ShortURL)
+	var variant *http.Cookie
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == variantCookieName {
+			variant = cookie
+		}
+	}
+	if !assert.NotNil(t, variant) {
+		return
+	}
+	location := resp.Header().Get("Location")
+	assert.Equal(t, "https://example.com/"+variant.Value, location)
+	// Атрибуты cookie берутся из конфига, путь ограничен ссылкой.
+	assert.Equal(t, "/"+newURL.ShortURL, variant.Path)
+	assert.True(t, variant.HttpOnly)
+	assert.Equal(t, cfg.Cookie.SameSite, variant.SameSite)
+
+	for range 5 {
+		resp, _ = client.R().SetCookie(&http.Cookie{Name: variantCookieName, Value: variant.Value}).
+			Get(srv.URL + "/" + newURL.ShortURL)
+		assert.Equal(t, location, resp.Header().Get("Location"))
+	}
+
+	// HEAD отдаёт тот же редирект, но не считается ни переходом, ни показом варианта.
+	resp, _ = client.R().SetCookie(&http.Cookie{Name: variantCookieName, Value: variant.Value}).
+		Head(srv.URL + "/" + newURL.ShortURL)
+	assert.Equal(t, location, resp.Header().Get("Location"))
+
+	// Показ варианта уходит вместе с событием перехода, счётчики обновляет воркер переходов.
+	require.Equal(t, 6, cfg.Clicks.Len())
+	for range 6 {
+		event := <-cfg.Clicks.Events()
+		assert.Equal(t, variant.Value, event.Variant)
+	}
+
+	resp, err = resty.New().R().
+		SetCookie(&http.Cookie{Name: "Token", Value: token}).
+		SetResult([]models.Variant{}).
+		Get(srv.URL + "/api/user/urls/" + newURL.ShortURL + "/variants")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode())
+
+	hits := make(map[string]int64)
+	for _, v := range *resp.Result().(*[]models.Variant) {
+		hits[v.Name] = v.Hits
+	}
+	assert.Equal(t, int64(0), hits[variant.Value])
+}
+
+func TestGetFullURL_ActiveWindow(t *testing.T) {
+	router := chi.NewRouter()
+
+	cfg, log := setupTest(t)
+	cfg.NotYetActiveCode = http.StatusForbidden
+	cfg.NotYetActiveBody = "coming soon"
+	storage, err := repository.NewStorage(cfg, log)
+	assert.NoError(t, err)
+
+	router.Get("/{id}", func(w http.ResponseWriter, r *http.Request) {
+		GetFullURL(w, r, cfg, storage, log)
+	})
+
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	ctx := context.Background()
+	future := time.Now().Add(time.Hour)
+	past := time.Now().Add(-time.Hour)
+
+	scheduled, err := service.AddURL(ctx, storage, log, createRandomURL(), cfg, 999)
+	assert.NoError(t, err)
+	_, err = service.UpdateURLSettings(ctx, storage, scheduled.ShortURL, 999, &models.URLSettingsRequest{
+		ActiveFrom: models.NullableTime{Time: &future, Set: true},
+	})
+	assert.NoError(t, err)
+
+	expired, err := service.AddURL(ctx, storage, log, createRandomURL(), cfg, 999)
+	assert.NoError(t, err)
+	_, err = service.UpdateURLSettings(ctx, storage, expired.ShortURL, 999, &models.URLSettingsRequest{
+		ActiveUntil: models.NullableTime{Time: &past, Set: true},
+	})
+	assert.NoError(t, err)
+
+	client := resty.New().SetRedirectPolicy(resty.NoRedirectPolicy())
+
+	resp, _ := client.R().Get(srv.URL + "/" + scheduled.ShortURL)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode())
+	assert.Equal(t, "coming soon", string(resp.Body()))
+	assert.Equal(t, "no-store", resp.Header().Get("Cache-Control"))
+	assert.NotEmpty(t, resp.Header().Get("Retry-After"))
+
+	resp, _ = client.R().Get(srv.URL + "/" + expired.ShortURL)
+	assert.Equal(t, http.StatusGone, resp.StatusCode())
+}
+
+// txtResolver отвечает TXT-записями из памяти, записей CNAME у него нет.
+type txtResolver map[string][]string
+
+func (r txtResolver) LookupTXT(_ context.Context, name string) ([]string, error) {
+	if records, ok := r[name]; ok {
+		return records, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+}
+
+func (r txtResolver) LookupCNAME(_ context.Context, host string) (string, error) {
+	return "", &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+}
+
+func TestShortDomains(t *testing.T) {
+	router := chi.NewRouter()
+
+	cfg, log := setupTest(t)
+	resolver := txtResolver{}
+	cfg.Resolver = resolver
+	storage, err := repository.NewStorage(cfg, log)
+	assert.NoError(t, err)
+	middleware := middlewares.Middleware{
+		Logger:  log,
+		Storage: storage,
+		Cfg:     cfg,
+	}
+	router.Use(middleware.WithAuth)
+
+	router.Post("/api/user/domains", func(w http.ResponseWriter, r *http.Request) {
+		APIRegisterDomain(w, r, cfg, storage, log)
+	})
+	router.Get("/api/user/domains", func(w http.ResponseWriter, r *http.Request) {
+		APIGetUserDomains(w, r, cfg, storage, log)
+	})
+	router.Post("/api/shorten", func(w http.ResponseWriter, r *http.Request) {
+		APICreateShortURL(w, r, cfg, storage, log)
+	})
+	router.Get("/{id}", func(w http.ResponseWriter, r *http.Request) {
+		GetFullURL(w, r, cfg, storage, log)
+	})
+
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	token, err := auth.BuildJWTString(999, cfg.SigningKeys, time.Hour)
+	assert.NoError(t, err)
+	otherToken, err := auth.BuildJWTString(998, cfg.SigningKeys, time.Hour)
+	assert.NoError(t, err)
+
+	// Без записи DNS домен не регистрируется, в ответе записи для подтверждения владения.
+	var verification models.DomainVerification
+	resp, err := resty.New().R().
+		SetCookie(&http.Cookie{Name: "Token", Value: token}).
+		SetBody(`{"domain":"Go.Acme.com"}`).
+		SetError(&verification).
+		Post(srv.URL + "/api/user/domains")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode())
+	assert.Equal(t, "go.acme.com", verification.Domain)
+	assert.Equal(t, "_url-minimise.go.acme.com", verification.Record)
+	require.NotEmpty(t, verification.TXT)
+	resolver[verification.Record] = []string{verification.TXT}
+
+	resp, err = resty.New().R().
+		SetCookie(&http.Cookie{Name: "Token", Value: token}).
+		SetBody(`{"domain":"Go.Acme.com"}`).
+		Post(srv.URL + "/api/user/domains")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode())
+	assert.JSONEq(t, `{"domain":"go.acme.com"}`, string(resp.Body()))
+
+	// Занятый домен не достаётся другому пользователю и с его собственной записью.
+	other, err := service.DomainVerification(cfg, "go.acme.com", 998)
+	require.NoError(t, err)
+	resolver[other.Record] = append(resolver[other.Record], other.TXT)
+	resp, err = resty.New().R().
+		SetCookie(&http.Cookie{Name: "Token", Value: otherToken}).
+		SetBody(`{"domain":"go.acme.com"}`).
+		Post(srv.URL + "/api/user/domains")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode())
+
+	resp, err = resty.New().R().
+		SetCookie(&http.Cookie{Name: "Token", Value: token}).
+		SetBody(`{"domain":"127.0.0.1"}`).
+		Post(srv.URL + "/api/user/domains")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode())
+
+	var domains models.UserDomainsResponse
+	resp, err = resty.New().R().
+		SetCookie(&http.Cookie{Name: "Token", Value: token}).
+		SetResult(&domains).
+		Get(srv.URL + "/api/user/domains")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode())
+	assert.Equal(t, []string{"go.acme.com"}, domains.Registered)
+
+	resp, err = resty.New().R().
+		SetCookie(&http.Cookie{Name: "Token", Value: otherToken}).
+		SetBody(`{"url":"https://acme.com/other","domain":"go.acme.com"}`).
+		Post(srv.URL + "/api/shorten")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode())
+
+	var created models.Response
+	resp, err = resty.New().R().
+		SetCookie(&http.Cookie{Name: "Token", Value: token}).
+		SetBody(`{"url":"https://acme.com/domain","domain":"go.acme.com"}`).
+		SetResult(&created).
+		Post(srv.URL + "/api/shorten")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode())
+	assert.Regexp(t, `^http://go\.acme\.com/\w+$`, created.ResultURL)
+
+	// Тот же код на основном домене ведёт на другую ссылку.
+	code := created.ResultURL[len("http://go.acme.com/"):]
+	_, err = storage.AddURL(context.Background(), &models.StorageURL{
+		ShortURL:    code,
+		OriginalURL: "https://acme.com/primary",
+		UserID:      999,
+	})
+	assert.NoError(t, err)
+
+	client := resty.New().SetRedirectPolicy(resty.NoRedirectPolicy())
+
+	resp, _ = client.R().SetHeader("Host", "go.acme.com").Get(srv.URL + "/" + code)
+	assert.Equal(t, http.StatusTemporaryRedirect, resp.StatusCode())
+	assert.Equal(t, "https://acme.com/domain", resp.Header().Get("Location"))
+
+	resp, _ = client.R().Get(srv.URL + "/" + code)
+	assert.Equal(t, http.StatusTemporaryRedirect, resp.StatusCode())
+	assert.Equal(t, "https://acme.com/primary", resp.Header().Get("Location"))
+
+	resp, _ = client.R().Get(srv.URL + "/" + code + "@go.acme.com")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode())
+}
+
+func TestAPIGetBrokenURLs(t *testing.T) {
+	router := chi.NewRouter()
+
+	cfg, log := setupTest(t)
+	storage, err := repository.NewStorage(cfg, log)
+	assert.NoError(t, err)
+	middleware := middlewares.Middleware{
+		Logger:  log,
+		Storage: storage,
+		Cfg:     cfg,
+	}
+	router.Use(middleware.WithAuth)
+	router.Get("/api/user/urls/broken", func(w http.ResponseWriter, r *http.Request) {
+		APIGetBrokenURLs(w, r, cfg, storage, log)
+	})
+
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	token, err := auth.BuildJWTString(999, cfg.SigningKeys, time.Hour)
+	assert.NoError(t, err)
+
+	resp, err := resty.New().R().Get(srv.URL + "/api/user/urls/broken")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode())
+
+	resp, err = resty.New().R().
+		SetCookie(&http.Cookie{Name: "Token", Value: token}).
+		Get(srv.URL + "/api/user/urls/broken")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode())
+
+	newURL, err := service.AddURL(context.Background(), storage, log, createRandomURL(), cfg, 999)
+	assert.NoError(t, err)
+	checkedAt := time.Now().UTC().Truncate(time.Second)
+	err = storage.SaveLinkHealth(context.Background(), []*models.LinkHealth{{
+		ShortURL:   newURL.ShortURL,
+		StatusCode: http.StatusNotFound,
+		Error:      "Not Found",
+		Latency:    42 * time.Millisecond,
+		Failures:   3,
+		Broken:     true,
+		CheckedAt:  checkedAt,
+	}})
+	assert.NoError(t, err)
+
+	var broken []models.BrokenURL
+	resp, err = resty.New().R().
+		SetCookie(&http.Cookie{Name: "Token", Value: token}).
+		SetResult(&broken).
+		Get(srv.URL + "/api/user/urls/broken")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode())
+	assert.Equal(t, []models.BrokenURL{{
+		ShortURL:    service.BuildShortURL(cfg, newURL.ShortURL),
+		OriginalURL: newURL.OriginalURL,
+		StatusCode:  http.StatusNotFound,
+		Error:       "Not Found",
+		LatencyMs:   42,
+		Failures:    3,
+		CheckedAt:   checkedAt,
+	}}, broken)
+}
+
+func TestAPIGetLinkStats(t *testing.T) {
+	router := chi.NewRouter()
+
+	cfg, log := setupTest(t)
+	storage, err := repository.NewStorage(cfg, log)
+	assert.NoError(t, err)
+	middleware := middlewares.Middleware{
+		Logger:  log,
+		Storage: storage,
+		Cfg:     cfg,
+	}
+	router.Use(middleware.WithAuth)
+	router.Get("/api/user/urls/{id}/stats", func(w http.ResponseWriter, r *http.Request) {
+		APIGetLinkStats(w, r, cfg, storage, log)
+	})
+
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	newURL, err := service.AddURL(context.Background(), storage, log, createRandomURL(), cfg, 999)
+	assert.NoError(t, err)
+	owner, err := auth.BuildJWTString(999, cfg.SigningKeys, time.Hour)
+	assert.NoError(t, err)
+	stranger, err := auth.BuildJWTString(1000, cfg.SigningKeys, time.Hour)
+	assert.NoError(t, err)
+
+	day := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, -1)
+	err = storage.AddClicks(context.Background(), []*models.ClickEvent{
+		{Time: day.Add(time.Hour), ShortURL: newURL.ShortURL, Referrer: "https://t.me/channel", Language: "ru", Visitor: 1 << 60},
+		{Time: day.Add(2 * time.Hour), ShortURL: newURL.ShortURL, Referrer: "https://t.me/", Language: "en", Visitor: 1 << 60},
+		{Time: day.Add(-47 * time.Hour), ShortURL: newURL.ShortURL, Language: "ru", Visitor: 1 << 62},
+	})
+	assert.NoError(t, err)
+
+	statsURL := srv.URL + "/api/user/urls/" + newURL.ShortURL + "/stats"
+
+	resp, err := resty.New().R().Get(statsURL)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode())
+
+	resp, err = resty.New().R().
+		SetCookie(&http.Cookie{Name: "Token", Value: stranger}).
+		Get(statsURL)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode())
+
+	for _, query := range []string{"?bucket=week", "?from=yesterday", "?top=0", "?bucket=hour&from=2020-01-01T00:00:00Z"} {
+		resp, err = resty.New().R().
+			SetCookie(&http.Cookie{Name: "Token", Value: owner}).
+			Get(statsURL + query)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode(), query)
+	}
+
+	var stats models.LinkStatsResponse
+	resp, err = resty.New().R().
+		SetCookie(&http.Cookie{Name: "Token", Value: owner}).
+		SetResult(&stats).
+		Get(statsURL)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode())
+	assert.Equal(t, models.StatsBucketDay, stats.Bucket)
+	assert.Len(t, stats.Series, 31)
+	assert.Equal(t, int64(2), stats.Series[29].Clicks)
+	assert.Equal(t, int64(1), stats.Series[27].Clicks)
+	assert.Equal(t, int64(3), stats.TotalClicks)
+	assert.Equal(t, int64(3), stats.RangeClicks)
+	assert.Equal(t, uint64(2), stats.UniqueVisitors)
+	assert.Equal(t, []models.ClickCount{{Value: "t.me", Clicks: 2}, {Value: "", Clicks: 1}}, stats.TopReferrers)
+	assert.Equal(t, []models.ClickCount{{Value: "ru", Clicks: 2}, {Value: "en", Clicks: 1}}, stats.Languages)
+
+	resp, err = resty.New().R().
+		SetCookie(&http.Cookie{Name: "Token", Value: owner}).
+		SetResult(&stats).
+		Get(statsURL + "?bucket=hour&top=1&from=" + day.Format(time.RFC3339) +
+			"&to=" + day.Add(3*time.Hour).Format(time.RFC3339))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode())
+	assert.Equal(t, []models.StatsPoint{
+		{Time: day, Clicks: 0},
+		{Time: day.Add(time.Hour), Clicks: 1},
+		{Time: day.Add(2 * time.Hour), Clicks: 1},
+	}, stats.Series)
+	assert.Equal(t, int64(2), stats.RangeClicks)
+	assert.Equal(t, uint64(1), stats.UniqueVisitors)
+	assert.Equal(t, []models.ClickCount{{Value: "t.me", Clicks: 2}}, stats.TopReferrers)
+}
+
+func TestAPILiveClicks(t *testing.T) {
+	router := chi.NewRouter()
+
+	cfg, log := setupTest(t)
+	cfg.ClickHub = clicks.NewHub(1, 4)
+	storage, err := repository.NewStorage(cfg, log)
+	assert.NoError(t, err)
+	middleware := middlewares.Middleware{
+		Logger:  log,
+		Storage: storage,
+		Cfg:     cfg,
+	}
+	router.Use(middleware.WithAuth)
+	router.Get("/api/user/urls/{id}/live", func(w http.ResponseWriter, r *http.Request) {
+		APILiveClicks(w, r, cfg, storage, log)
+	})
+
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	newURL, err := service.AddURL(context.Background(), storage, log, createRandomURL(), cfg, 999)
+	assert.NoError(t, err)
+	owner, err := auth.BuildJWTString(999, cfg.SigningKeys, time.Hour)
+	assert.NoError(t, err)
+	stranger, err := auth.BuildJWTString(1000, cfg.SigningKeys, time.Hour)
+	assert.NoError(t, err)
+
+	liveURL := srv.URL + "/api/user/urls/" + newURL.ShortURL + "/live"
+
+	resp, err := resty.New().R().Get(liveURL)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode())
+
+	resp, err = resty.New().R().
+		SetCookie(&http.Cookie{Name: "Token", Value: stranger}).
+		Get(liveURL)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, liveURL, http.NoBody)
+	require.NoError(t, err)
+	req.AddCookie(&http.Cookie{Name: "Token", Value: owner})
+	stream, err := srv.Client().Do(req)
+	require.NoError(t, err)
+	defer func() { _ = stream.Body.Close() }()
+	assert.Equal(t, http.StatusOK, stream.StatusCode)
+	assert.Equal(t, "text/event-stream", stream.Header.Get("Content-Type"))
+
+	// Второй поток превышает предел подписок.
+	resp, err = resty.New().R().
+		SetCookie(&http.Cookie{Name: "Token", Value: owner}).
+		Get(liveURL)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode())
+
+	service.RecordClick(cfg, newURL.ShortURL, &models.Visit{Referrer: "https://t.me/", UserAgent: "curl"}, "")
+
+	reader := bufio.NewReader(stream.Body)
+	event, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "event: click\n", event)
+	data, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	var click models.LiveClick
+	require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(data, "data: ")), &click))
+	assert.Equal(t, newURL.ShortURL, click.ShortURL)
+	assert.Equal(t, "https://t.me/", click.Referrer)
+	assert.Equal(t, "curl", click.UserAgent)
+
+	// Закрытие рассыльщика при остановке сервера завершает поток.
+	cfg.ClickHub.Close()
+	_, err = io.ReadAll(reader)
+	assert.NoError(t, err)
+}
+
+func TestAPIRegisterLogin(t *testing.T) {
+	router := chi.NewRouter()
+
+	cfg, log := setupTest(t)
+	storage, err := repository.NewStorage(cfg, log)
+	assert.NoError(t, err)
+	middleware := middlewares.Middleware{
+		Logger:  log,
+		Storage: storage,
+		Cfg:     cfg,
+	}
+	router.Use(middleware.WithAuth)
+	router.Post("/api/user/register", func(w http.ResponseWriter, r *http.Request) {
+		APIRegister(w, r, cfg, storage, log)
+	})
+	router.Post("/api/user/login", func(w http.ResponseWriter, r *http.Request) {
+		APILogin(w, r, cfg, storage, log)
+	})
+	router.Get("/api/user/urls", func(w http.ResponseWriter, r *http.Request) {
+		GetUserURLs(w, r, cfg, storage, log)
+	})
+
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	anonymous, err := service.AddNewUser(context.Background(), storage, cfg)
+	assert.NoError(t, err)
+	_, err = service.AddURL(context.Background(), storage, log, createRandomURL(), cfg, anonymous.ID)
+	assert.NoError(t, err)
+
+	email := strings.ToLower(randomString(10)) + "@example.com"
+
+	resp, err := resty.New().R().
+		SetBody(`{"email": "` + email + `", "password": "short"}`).
+		Post(srv.URL + "/api/user/register")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode())
+
+	var account models.AccountResponse
+	resp, err = resty.New().R().
+		SetCookie(&http.Cookie{Name: "Token", Value: anonymous.Service.Token}).
+		SetBody(models.AccountRequest{Email: email, Password: "password123"}).
+		SetResult(&account).
+		Post(srv.URL + "/api/user/register")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode())
+	assert.Equal(t, email, account.Email)
+	assert.Equal(t, 1, account.MergedURLs)
+
+	resp, err = resty.New().R().
+		SetBody(models.AccountRequest{Email: email, Password: "password123"}).
+		Post(srv.URL + "/api/user/register")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode())
+
+	resp, err = resty.New().R().
+		SetBody(models.AccountRequest{Email: email, Password: "wrong password"}).
+		Post(srv.URL + "/api/user/login")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode())
+
+	// Токен аккаунта из cookie входа открывает ссылки, перенесённые из анонимной сессии.
+	resp, err = resty.New().R().
+		SetBody(models.AccountRequest{Email: email, Password: "password123"}).
+		SetResult(&account).
+		Post(srv.URL + "/api/user/login")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode())
+	assert.Zero(t, account.MergedURLs)
+
+	var token string
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == "Token" {
+			token = cookie.Value
+		}
+	}
+	require.NotEmpty(t, token)
+
+	resp, err = resty.New().R().
+		SetCookie(&http.Cookie{Name: "Token", Value: token}).
+		Get(srv.URL + "/api/user/urls")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode())
+}
+
+func TestAPIOIDCLogin(t *testing.T) {
+	router := chi.NewRouter()
+
+	cfg, log := setupTest(t)
+	storage, err := repository.NewStorage(cfg, log)
+	require.NoError(t, err)
+	middleware := middlewares.Middleware{
+		Logger:  log,
+		Storage: storage,
+		Cfg:     cfg,
+	}
+	router.Use(middleware.WithAuth)
+	router.Get("/api/user/oidc/login", func(w http.ResponseWriter, r *http.Request) {
+		APIOIDCLogin(w, r, cfg, storage, log)
+	})
+	router.Get("/api/user/oidc/callback", func(w http.ResponseWriter, r *http.Request) {
+		APIOIDCCallback(w, r, cfg, storage, log)
+	})
+
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+	idp, err := oidctest.NewIdP()
+	require.NoError(t, err)
+	defer idp.Close()
+
+	// Браузер без автоматических переходов: перенаправления проверяются вручную.
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	get := func(target string, cookies ...*http.Cookie) *http.Response {
+		req, err := http.NewRequest(http.MethodGet, target, http.NoBody)
+		require.NoError(t, err)
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		res, err := client.Do(req)
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			_ = res.Body.Close()
+		})
+		return res
+	}
+
+	assert.Equal(t, http.StatusNotFound, get(srv.URL+"/api/user/oidc/login").StatusCode)
+	cfg.OIDC = auth.NewOIDCProvider(idp.Issuer(), oidctest.ClientID, "", srv.URL+"/api/user/oidc/callback")
+
+	anonymous, err := service.AddNewUser(context.Background(), storage, cfg)
+	require.NoError(t, err)
+	_, err = service.AddURL(context.Background(), storage, log, createRandomURL(), cfg, anonymous.ID)
+	require.NoError(t, err)
+	session := &http.Cookie{Name: "Token", Value: anonymous.Service.Token}
+
+	// Вход начинается перенаправлением к провайдеру, значения входа остаются в cookie.
+	res := get(srv.URL+"/api/user/oidc/login", session)
+	require.Equal(t, http.StatusFound, res.StatusCode)
+	loginCookie := findCookie(res, "OIDCLogin")
+	require.NotNil(t, loginCookie)
+	assert.True(t, loginCookie.HttpOnly)
+	authURL, err := url.Parse(res.Header.Get("Location"))
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(authURL.String(), idp.Issuer()+"/authorize"))
+	assert.Equal(t, "S256", authURL.Query().Get("code_challenge_method"))
+	state := authURL.Query().Get("state")
+
+	code, err := idp.Follow(context.Background(), authURL.String(), state)
+	require.NoError(t, err)
+	callback := srv.URL + "/api/user/oidc/callback?" + url.Values{"code": {code}, "state": {state}}.Encode()
+
+	assert.Equal(t, http.StatusBadRequest, get(callback, session).StatusCode)
+	forged := srv.URL + "/api/user/oidc/callback?" + url.Values{"code": {code}, "state": {"forged"}}.Encode()
+	assert.Equal(t, http.StatusBadRequest, get(forged, session, loginCookie).StatusCode)
+	denied := srv.URL + "/api/user/oidc/callback?error=access_denied&state=" + state
+	assert.Equal(t, http.StatusUnauthorized, get(denied, session, loginCookie).StatusCode)
+
+	// Обратный вызов входит в аккаунт, созданный при первом входе, и переносит ссылки анонимной сессии.
+	res = get(callback, session, loginCookie)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	var account models.AccountResponse
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&account))
+	assert.Equal(t, "user@example.com", account.Email)
+	assert.Equal(t, 1, account.MergedURLs)
+	assert.Equal(t, -1, findCookie(res, "OIDCLogin").MaxAge)
+	token := findCookie(res, "Token")
+	require.NotNil(t, token)
+
+	userID, err := auth.GetUserID(token.Value, cfg.SigningKeys)
+	require.NoError(t, err)
+	assert.Equal(t, account.UserID, userID)
+
+	// Код авторизации одноразовый.
+	assert.Equal(t, http.StatusUnauthorized, get(callback, session, loginCookie).StatusCode)
+}
+
+func TestAPIKeys(t *testing.T) {
+	router := chi.NewRouter()
+
+	cfg, log := setupTest(t)
+	storage, err := repository.NewStorage(cfg, log)
+	assert.NoError(t, err)
+	middleware := middlewares.Middleware{
+		Logger:  log,
+		Storage: storage,
+		Cfg:     cfg,
+	}
+	router.Use(middleware.WithAuth)
+	router.With(middlewares.RequireSession).Post("/api/user/keys", func(w http.ResponseWriter, r *http.Request) {
+		APICreateAPIKey(w, r, cfg, storage, log)
+	})
+	router.With(middlewares.RequireSession).Get("/api/user/keys", func(w http.ResponseWriter, r *http.Request) {
+		APIGetAPIKeys(w, r, cfg, storage, log)
+	})
+	router.With(middlewares.RequireSession).Delete("/api/user/keys/{id}", func(w http.ResponseWriter, r *http.Request) {
+		APIRevokeAPIKey(w, r, cfg, storage, log)
+	})
+	router.With(middlewares.RequireScope(models.ScopeRead)).Get("/api/user/urls",
+		func(w http.ResponseWriter, r *http.Request) {
+			GetUserURLs(w, r, cfg, storage, log)
+		})
+
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	owner, err := service.AddNewUser(context.Background(), storage, cfg)
+	assert.NoError(t, err)
+	other, err := service.AddNewUser(context.Background(), storage, cfg)
+	assert.NoError(t, err)
+	_, err = service.AddURL(context.Background(), storage, log, createRandomURL(), cfg, owner.ID)
+	assert.NoError(t, err)
+
+	resp, err := resty.New().R().
+		SetCookie(&http.Cookie{Name: "Token", Value: owner.Service.Token}).
+		SetBody(`{"name": "ci", "scopes": ["admin"]}`).
+		Post(srv.URL + "/api/user/keys")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode())
+
+	var created models.APIKeyResponse
+	resp, err = resty.New().R().
+		SetCookie(&http.Cookie{Name: "Token", Value: owner.Service.Token}).
+		SetBody(`{"name": "ci", "scopes": ["read"]}`).
+		SetResult(&created).
+		Post(srv.URL + "/api/user/keys")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode())
+	require.NotEmpty(t, created.Key)
+
+	// Ключ открывает ссылки владельца, но не управление ключами.
+	resp, err = resty.New().R().SetAuthToken(created.Key).Get(srv.URL + "/api/user/urls")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode())
+
+	resp, err = resty.New().R().SetAuthToken(created.Key).Get(srv.URL + "/api/user/keys")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode())
+
+	var keys []models.APIKeyResponse
+	resp, err = resty.New().R().
+		SetCookie(&http.Cookie{Name: "Token", Value: owner.Service.Token}).
+		SetResult(&keys).
+		Get(srv.URL + "/api/user/keys")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode())
+	require.Len(t, keys, 1)
+	assert.Equal(t, created.ID, keys[0].ID)
+	assert.Empty(t, keys[0].Key)
+
+	resp, err = resty.New().R().
+		SetCookie(&http.Cookie{Name: "Token", Value: other.Service.Token}).
+		Delete(srv.URL + "/api/user/keys/" + created.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode())
+
+	resp, err = resty.New().R().
+		SetCookie(&http.Cookie{Name: "Token", Value: owner.Service.Token}).
+		Delete(srv.URL + "/api/user/keys/" + created.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode())
+
+	resp, err = resty.New().R().SetAuthToken(created.Key).Get(srv.URL + "/api/user/urls")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode())
+}
+
+func TestAPIRefreshLogout(t *testing.T) {
+	router := chi.NewRouter()
+
+	cfg, log := setupTest(t)
+	cfg.Cookie.Secure = true
+	cfg.Cookie.SameSite = http.SameSiteStrictMode
+	storage, err := repository.NewStorage(cfg, log)
+	assert.NoError(t, err)
+	middleware := middlewares.Middleware{
+		Logger:  log,
+		Storage: storage,
+		Cfg:     cfg,
+	}
+	router.Post("/api/user/refresh", func(w http.ResponseWriter, r *http.Request) {
+		APIRefresh(w, r, cfg, storage, log)
+	})
+	router.Post("/api/user/logout", func(w http.ResponseWriter, r *http.Request) {
+		APILogout(w, r, cfg, storage, log)
+	})
+	router.Group(func(r chi.Router) {
+		r.Use(middleware.WithAuth)
+		r.Get("/api/user/urls", func(w http.ResponseWriter, r *http.Request) {
+			GetUserURLs(w, r, cfg, storage, log)
+		})
+	})
+
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	user, err := service.AddNewUser(context.Background(), storage, cfg)
+	require.NoError(t, err)
+
+	resp, err := resty.New().R().
+		SetBody(models.RefreshRequest{RefreshToken: "garbage"}).
+		Post(srv.URL + "/api/user/refresh")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode())
+
+	// Токен обновления из cookie меняется на новую пару токенов.
+	var tokens models.TokenResponse
+	resp, err = resty.New().R().
+		SetCookie(&http.Cookie{Name: "RefreshToken", Value: user.Service.RefreshToken}).
+		SetResult(&tokens).
+		Post(srv.URL + "/api/user/refresh")
+	assert.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode())
+	assert.NotEmpty(t, tokens.AccessToken)
+	assert.NotEqual(t, user.Service.RefreshToken, tokens.RefreshToken)
+	assert.Equal(t, int(cfg.JWTTokenLifeTime.Seconds()), tokens.ExpiresIn)
+
+	// Атрибуты cookie берутся из конфига, а срок совпадает со сроком токена.
+	access, refresh := findCookie(resp.RawResponse, "Token"), findCookie(resp.RawResponse, "RefreshToken")
+	require.NotNil(t, access)
+	require.NotNil(t, refresh)
+	for _, cookie := range []*http.Cookie{access, refresh} {
+		assert.True(t, cookie.HttpOnly)
+		assert.True(t, cookie.Secure)
+		assert.Equal(t, http.SameSiteStrictMode, cookie.SameSite)
+	}
+	assert.Equal(t, "/", access.Path)
+	assert.Equal(t, int(cfg.JWTTokenLifeTime.Seconds()), access.MaxAge)
+	assert.WithinDuration(t, time.Now().Add(cfg.JWTTokenLifeTime), access.Expires, time.Minute)
+	assert.Equal(t, "/api/user", refresh.Path)
+	assert.Equal(t, int(cfg.RefreshTokenLifeTime.Seconds()), refresh.MaxAge)
+
+	// Вместе с сессией выдаётся токен CSRF, доступный скриптам; при обновлении токенов он не меняется.
+	csrf := findCookie(resp.RawResponse, "CSRFToken")
+	require.NotNil(t, csrf)
+	assert.NotEmpty(t, csrf.Value)
+	assert.False(t, csrf.HttpOnly)
+	assert.Equal(t, int(cfg.RefreshTokenLifeTime.Seconds()), csrf.MaxAge)
+
+	// Следующий токен обновления передаётся в теле запроса.
+	resp, err = resty.New().R().
+		SetCookie(csrf).
+		SetBody(models.RefreshRequest{RefreshToken: tokens.RefreshToken}).
+		SetResult(&tokens).
+		Post(srv.URL + "/api/user/refresh")
+	assert.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode())
+	assert.Equal(t, csrf.Value, findCookie(resp.RawResponse, "CSRFToken").Value)
+
+	resp, err = resty.New().R().
+		SetCookie(&http.Cookie{Name: "Token", Value: tokens.AccessToken}).
+		Get(srv.URL + "/api/user/urls")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode())
+
+	// Токен доступа принимается и в заголовке Authorization.
+	resp, err = resty.New().R().
+		SetAuthToken(tokens.AccessToken).
+		Get(srv.URL + "/api/user/urls")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode())
+
+	resp, err = resty.New().R().
+		SetAuthToken(tokens.AccessToken).
+		SetBody(models.RefreshRequest{RefreshToken: tokens.RefreshToken}).
+		Post(srv.URL + "/api/user/logout")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode())
+	assert.Equal(t, -1, findCookie(resp.RawResponse, "Token").MaxAge)
+	assert.Equal(t, -1, findCookie(resp.RawResponse, "CSRFToken").MaxAge)
+
+	// После выхода токены сессии больше не действуют.
+	resp, err = resty.New().R().
+		SetCookie(&http.Cookie{Name: "Token", Value: tokens.AccessToken}).
+		Get(srv.URL + "/api/user/urls")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode())
+
+	resp, err = resty.New().R().
+		SetBody(models.RefreshRequest{RefreshToken: tokens.RefreshToken}).
+		Post(srv.URL + "/api/user/refresh")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode())
+}
+
+// findCookie cookie name из ответа или nil.
+func findCookie(res *http.Response, name string) *http.Cookie {
+	for _, cookie := range res.Cookies() {
+		if cookie.Name == name {
+			return cookie
+		}
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/Melikhov-p/url-minimise/internal/config"
+	"github.com/Melikhov-p/url-minimise/internal/contextkeys"
+	"github.com/Melikhov-p/url-minimise/internal/models"
+	"github.com/Melikhov-p/url-minimise/internal/repository"
+	"github.com/Melikhov-p/url-minimise/internal/service"
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+// APISetVariants заменить варианты адреса назначения URL для A/B разделения трафика владельцем.
+func APISetVariants(
+	w http.ResponseWriter,
+	r *http.Request,
+	cfg *config.Config,
+	storage repository.Storage,
+	logger *zap.Logger,
+) {
+	if r.Method != http.MethodPut {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx := r.Context()
+	user, ok := ctx.Value(contextkeys.ContextUserKey).(*models.User)
+	if !ok {
+		logger.Error(errGetContextUser.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !user.Service.IsAuthenticated {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var variants []models.Variant
+	dec := json.NewDecoder(r.Body)
+	if err := dec.Decode(&variants); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		logger.Error("error decoding variants request", zap.Error(err))
+		return
+	}
+
+	shortURL := chi.URLParam(r, "id")
+	if err := service.SetVariants(ctx, storage, cfg, shortURL, user.ID, variants); err != nil {
+		code := ownerErrorStatus(err)
+		if code == http.StatusInternalServerError {
+			logger.Error("error setting variants", zap.Error(err))
+		}
+		w.WriteHeader(code)
+		return
+	}
+
+	if saver, ok := storage.(repository.StorageSaver); ok {
+		updated, err := storage.GetURL(ctx, shortURL)
+		if err == nil {
+			err = saver.Save(updated)
+		}
+		if err != nil {
+			logger.Error("error saving URL with variants", zap.Error(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// APIGetVariants получить варианты адреса назначения URL со счётчиками показов владельцем.
+func APIGetVariants(
+	w http.ResponseWriter,
+	r *http.Request,
+	_ *config.Config,
+	storage repository.Storage,
+	logger *zap.Logger,
+) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx := r.Context()
+	user, ok := ctx.Value(contextkeys.ContextUserKey).(*models.User)
+	if !ok {
+		logger.Error(errGetContextUser.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !user.Service.IsAuthenticated {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	variants, err := service.GetVariants(ctx, storage, chi.URLParam(r, "id"), user.ID)
+	if err != nil {
+		code := ownerErrorStatus(err)
+		if code == http.StatusInternalServerError {
+			logger.Error("error getting variants", zap.Error(err))
+		}
+		w.WriteHeader(code)
+		return
+	}
+
+	enc := json.NewEncoder(w)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	if err = enc.Encode(variants); err != nil {
+		logger.Error("error encoding variants response", zap.Error(err))
+	}
+}
@@ -0,0 +1,180 @@
+// Package hll приближённый подсчёт уникальных значений с помощью HyperLogLog.
+//
+// Скетч занимает не больше 4 КБ независимо от количества значений, стандартная ошибка оценки
+// около 1,6%. Скетчи с одинаковой точностью объединяются без потерь, поэтому скетчи за разные
+// сутки или с разных инстансов сервиса можно сложить в один.
+package hll
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+	"math"
+	"math/bits"
+)
+
+// Precision количество бит хеша, выбирающих регистр.
+const Precision = 12
+
+const (
+	registers = 1 << Precision
+
+	// formatVersion версия бинарного представления скетча.
+	formatVersion = 1
+	// Способы хранения регистров: только ненулевые (индекс и значение) или все подряд.
+	encodingSparse = 0
+	encodingDense  = 1
+	// sparseEntrySize размер ненулевого регистра в разреженном представлении.
+	sparseEntrySize = 3
+	headerSize      = 3
+)
+
+// ErrInvalidSketch бинарное представление скетча повреждено или получено с другой точностью.
+var ErrInvalidSketch = errors.New("invalid hll sketch")
+
+// Sketch скетч HyperLogLog. Нулевое значение — пустой скетч.
+type Sketch struct {
+	registers []uint8
+}
+
+// New возвращает пустой скетч.
+func New() *Sketch {
+	return &Sketch{}
+}
+
+// Hash 64-битный хеш частей значения. Хеш не зависит от процесса, поэтому скетчи разных инстансов совместимы.
+func Hash(parts ...string) uint64 {
+	h := fnv.New64a()
+	for i, part := range parts {
+		if i > 0 {
+			_, _ = h.Write([]byte{0})
+		}
+		_, _ = h.Write([]byte(part))
+	}
+
+	// Перемешивание splitmix64: у FNV младшие и старшие биты распределены недостаточно равномерно.
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// Add учесть значение с хешем hash.
+func (s *Sketch) Add(hash uint64) {
+	s.init()
+
+	idx := hash >> (64 - Precision)
+	rank := uint8(bits.LeadingZeros64(hash<<Precision|1<<(Precision-1))) + 1
+	if rank > s.registers[idx] {
+		s.registers[idx] = rank
+	}
+}
+
+// Merge объединить скетч other с текущим.
+func (s *Sketch) Merge(other *Sketch) {
+	if other == nil || other.registers == nil {
+		return
+	}
+	s.init()
+
+	for i, rank := range other.registers {
+		if rank > s.registers[i] {
+			s.registers[i] = rank
+		}
+	}
+}
+
+// Estimate оценка количества уникальных значений.
+func (s *Sketch) Estimate() uint64 {
+	if s == nil || s.registers == nil {
+		return 0
+	}
+
+	var (
+		sum   float64
+		zeros int
+	)
+	for _, rank := range s.registers {
+		sum += math.Ldexp(1, -int(rank))
+		if rank == 0 {
+			zeros++
+		}
+	}
+
+	m := float64(registers)
+	estimate := 0.7213 / (1 + 1.079/m) * m * m / sum
+	// На малых количествах точнее линейный подсчёт по пустым регистрам.
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return uint64(math.Round(estimate))
+}
+
+// MarshalBinary бинарное представление скетча. Скетч с небольшим количеством значений
+// хранит только ненулевые регистры.
+func (s *Sketch) MarshalBinary() ([]byte, error) {
+	var nonZero int
+	for _, rank := range s.registers {
+		if rank != 0 {
+			nonZero++
+		}
+	}
+
+	if nonZero*sparseEntrySize >= registers {
+		data := make([]byte, headerSize, headerSize+registers)
+		data[0], data[1], data[2] = formatVersion, Precision, encodingDense
+		return append(data, s.registers...), nil
+	}
+
+	data := make([]byte, headerSize, headerSize+nonZero*sparseEntrySize)
+	data[0], data[1], data[2] = formatVersion, Precision, encodingSparse
+	for i, rank := range s.registers {
+		if rank != 0 {
+			data = binary.BigEndian.AppendUint16(data, uint16(i))
+			data = append(data, rank)
+		}
+	}
+	return data, nil
+}
+
+// UnmarshalBinary восстановить скетч из бинарного представления.
+func (s *Sketch) UnmarshalBinary(data []byte) error {
+	if len(data) < headerSize || data[0] != formatVersion || data[1] != Precision {
+		return ErrInvalidSketch
+	}
+
+	restored := make([]uint8, registers)
+	body := data[headerSize:]
+	switch data[2] {
+	case encodingDense:
+		if len(body) != registers {
+			return ErrInvalidSketch
+		}
+		copy(restored, body)
+	case encodingSparse:
+		if len(body)%sparseEntrySize != 0 {
+			return ErrInvalidSketch
+		}
+		for ; len(body) > 0; body = body[sparseEntrySize:] {
+			idx := binary.BigEndian.Uint16(body)
+			if int(idx) >= registers {
+				return ErrInvalidSketch
+			}
+			restored[idx] = body[2]
+		}
+	default:
+		return ErrInvalidSketch
+	}
+
+	s.registers = restored
+	return nil
+}
+
+func (s *Sketch) init() {
+	if s.registers == nil {
+		s.registers = make([]uint8, registers)
+	}
+}
@@ -0,0 +1,67 @@
+package hll
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSketch_Estimate(t *testing.T) {
+	for _, n := range []int{0, 1, 100, 10_000, 200_000} {
+		t.Run(strconv.Itoa(n), func(t *testing.T) {
+			sketch := New()
+			for i := range n {
+				// Повторы не меняют оценку.
+				sketch.Add(Hash("visitor", strconv.Itoa(i)))
+				sketch.Add(Hash("visitor", strconv.Itoa(i)))
+			}
+			assert.InEpsilon(t, float64(n)+1, float64(sketch.Estimate())+1, 0.05)
+		})
+	}
+}
+
+func TestSketch_Merge(t *testing.T) {
+	monday, tuesday, both := New(), New(), New()
+	for i := range 5000 {
+		monday.Add(Hash(strconv.Itoa(i)))
+		both.Add(Hash(strconv.Itoa(i)))
+	}
+	for i := 2500; i < 7500; i++ {
+		tuesday.Add(Hash(strconv.Itoa(i)))
+		both.Add(Hash(strconv.Itoa(i)))
+	}
+
+	merged := New()
+	merged.Merge(monday)
+	merged.Merge(tuesday)
+	merged.Merge(nil)
+	assert.Equal(t, both.Estimate(), merged.Estimate())
+	assert.InEpsilon(t, 7500, float64(merged.Estimate()), 0.05)
+}
+
+func TestSketch_MarshalBinary(t *testing.T) {
+	for _, n := range []int{0, 10, 50_000} {
+		t.Run(strconv.Itoa(n), func(t *testing.T) {
+			sketch := New()
+			for i := range n {
+				sketch.Add(Hash(strconv.Itoa(i)))
+			}
+
+			data, err := sketch.MarshalBinary()
+			require.NoError(t, err)
+			assert.LessOrEqual(t, len(data), headerSize+registers)
+
+			var restored Sketch
+			require.NoError(t, restored.UnmarshalBinary(data))
+			assert.Equal(t, sketch.Estimate(), restored.Estimate())
+		})
+	}
+
+	var sketch Sketch
+	assert.ErrorIs(t, sketch.UnmarshalBinary(nil), ErrInvalidSketch)
+	assert.ErrorIs(t, sketch.UnmarshalBinary([]byte{formatVersion, Precision + 1, encodingDense}), ErrInvalidSketch)
+	assert.ErrorIs(t, sketch.UnmarshalBinary([]byte{formatVersion, Precision, encodingSparse, 0xff, 0xff, 1}),
+		ErrInvalidSketch)
+}
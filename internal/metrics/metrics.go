@@ -0,0 +1,178 @@
+// Package metrics собирает метрики сервиса и отдаёт их в текстовом формате Prometheus.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "shortener"
+
+// Исходы перехода по короткой ссылке.
+const (
+	RedirectHit  = "hit"
+	RedirectMiss = "miss"
+)
+
+// UnmatchedRoute метка маршрута для запросов, не попавших ни в один маршрут.
+// Сырой путь в метку не попадает, чтобы не раздувать число рядов.
+const UnmatchedRoute = "unmatched"
+
+// Metrics метрики сервиса с собственным реестром. Нулевой указатель ничего не считает.
+type Metrics struct {
+	registry        *prometheus.Registry
+	httpRequests    *prometheus.CounterVec
+	httpDuration    *prometheus.HistogramVec
+	grpcRequests    *prometheus.CounterVec
+	grpcDuration    *prometheus.HistogramVec
+	storageDuration *prometheus.HistogramVec
+	storageErrors   *prometheus.CounterVec
+	redirects       *prometheus.CounterVec
+	deleteQueue     prometheus.Gauge
+	deletedTasks    prometheus.Counter
+}
+
+// New возвращает метрики сервиса вместе с метриками среды выполнения Go и процесса.
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests by method, route and status.",
+		}, []string{"method", "route", "status"}),
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "HTTP request latency by method, route and status.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		grpcRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "grpc_requests_total",
+			Help:      "gRPC calls by method and status code.",
+		}, []string{"method", "code"}),
+		grpcDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "grpc_request_duration_seconds",
+			Help:      "gRPC call latency by method and status code.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "code"}),
+		storageDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "storage_operation_duration_seconds",
+			Help:      "Storage operation latency by backend and operation.",
+			Buckets:   prometheus.ExponentialBuckets(0.0001, 4, 9),
+		}, []string{"backend", "operation"}),
+		storageErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "storage_operation_errors_total",
+			Help:      "Failed storage operations by backend and operation.",
+		}, []string{"backend", "operation"}),
+		redirects: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "redirects_total",
+			Help:      "Short link lookups by result: hit or miss.",
+		}, []string{"result"}),
+		deleteQueue: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "delete_queue_depth",
+			Help:      "Delete tasks waiting for the delete worker at its last poll.",
+		}),
+		deletedTasks: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "delete_tasks_processed_total",
+			Help:      "Delete tasks processed by the delete worker.",
+		}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.httpRequests,
+		m.httpDuration,
+		m.grpcRequests,
+		m.grpcDuration,
+		m.storageDuration,
+		m.storageErrors,
+		m.redirects,
+		m.deleteQueue,
+		m.deletedTasks,
+	)
+
+	return m
+}
+
+// Handler отдаёт метрики в текстовом формате Prometheus.
+func (m *Metrics) Handler() http.Handler {
+	if m == nil {
+		return http.NotFoundHandler()
+	}
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// ObserveHTTP учитывает HTTP запрос. Пустой route означает, что запрос не попал ни в один маршрут.
+func (m *Metrics) ObserveHTTP(method, route string, status int, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	if route == "" {
+		route = UnmatchedRoute
+	}
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	code := strconv.Itoa(status)
+	m.httpRequests.WithLabelValues(method, route, code).Inc()
+	m.httpDuration.WithLabelValues(method, route, code).Observe(duration.Seconds())
+}
+
+// ObserveGRPC учитывает вызов gRPC метода с кодом ответа code.
+func (m *Metrics) ObserveGRPC(method, code string, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	m.grpcRequests.WithLabelValues(method, code).Inc()
+	m.grpcDuration.WithLabelValues(method, code).Observe(duration.Seconds())
+}
+
+// ObserveStorage учитывает операцию хранилища backend, failed — операция завершилась ошибкой.
+func (m *Metrics) ObserveStorage(backend, operation string, duration time.Duration, failed bool) {
+	if m == nil {
+		return
+	}
+	m.storageDuration.WithLabelValues(backend, operation).Observe(duration.Seconds())
+	if failed {
+		m.storageErrors.WithLabelValues(backend, operation).Inc()
+	}
+}
+
+// CountRedirect учитывает переход по короткой ссылке с исходом RedirectHit или RedirectMiss.
+func (m *Metrics) CountRedirect(result string) {
+	if m == nil {
+		return
+	}
+	m.redirects.WithLabelValues(result).Inc()
+}
+
+// SetDeleteQueue запоминает число задач на удаление, найденных воркером.
+func (m *Metrics) SetDeleteQueue(depth int) {
+	if m == nil {
+		return
+	}
+	m.deleteQueue.Set(float64(depth))
+}
+
+// AddDeletedTasks учитывает обработанные воркером задачи на удаление.
+func (m *Metrics) AddDeletedTasks(count int) {
+	if m == nil {
+		return
+	}
+	m.deletedTasks.Add(float64(count))
+}
@@ -0,0 +1,72 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func scrape(t *testing.T, m *Metrics) (int, string) {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body, err := io.ReadAll(rec.Body)
+	require.NoError(t, err)
+	return rec.Code, string(body)
+}
+
+func TestMetrics(t *testing.T) {
+	m := New()
+
+	m.ObserveHTTP(http.MethodGet, "/{id}", http.StatusTemporaryRedirect, 10*time.Millisecond)
+	m.ObserveHTTP(http.MethodGet, "", 0, time.Millisecond)
+	m.ObserveGRPC("/proto.Shortener/GetFullURL", "NotFound", time.Millisecond)
+	m.ObserveStorage("memory", "get_url", time.Millisecond, false)
+	m.ObserveStorage("memory", "get_url", time.Millisecond, true)
+	m.CountRedirect(RedirectHit)
+	m.CountRedirect(RedirectMiss)
+	m.CountRedirect(RedirectMiss)
+	m.SetDeleteQueue(3)
+	m.AddDeletedTasks(2)
+
+	code, body := scrape(t, m)
+	assert.Equal(t, http.StatusOK, code)
+
+	for _, line := range []string{
+		`shortener_http_requests_total{method="GET",route="/{id}",status="307"} 1`,
+		`shortener_http_requests_total{method="GET",route="unmatched",status="200"} 1`,
+		`shortener_http_request_duration_seconds_count{method="GET",route="/{id}",status="307"} 1`,
+		`shortener_grpc_requests_total{code="NotFound",method="/proto.Shortener/GetFullURL"} 1`,
+		`shortener_storage_operation_duration_seconds_count{backend="memory",operation="get_url"} 2`,
+		`shortener_storage_operation_errors_total{backend="memory",operation="get_url"} 1`,
+		`shortener_redirects_total{result="hit"} 1`,
+		`shortener_redirects_total{result="miss"} 2`,
+		`shortener_delete_queue_depth 3`,
+		`shortener_delete_tasks_processed_total 2`,
+	} {
+		assert.Contains(t, body, line)
+	}
+	assert.Contains(t, body, "go_goroutines")
+}
+
+func TestMetrics_Nil(t *testing.T) {
+	var m *Metrics
+
+	assert.NotPanics(t, func() {
+		m.ObserveHTTP(http.MethodGet, "/", http.StatusOK, time.Millisecond)
+		m.ObserveGRPC("/proto.Shortener/GetFullURL", "OK", time.Millisecond)
+		m.ObserveStorage("memory", "get_url", time.Millisecond, false)
+		m.CountRedirect(RedirectHit)
+		m.SetDeleteQueue(1)
+		m.AddDeletedTasks(1)
+	})
+
+	code, _ := scrape(t, m)
+	assert.Equal(t, http.StatusNotFound, code)
+}
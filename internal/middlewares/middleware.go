@@ -5,15 +5,19 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/Melikhov-p/url-minimise/internal/auth"
 	compress "github.com/Melikhov-p/url-minimise/internal/compressor"
 	"github.com/Melikhov-p/url-minimise/internal/config"
 	"github.com/Melikhov-p/url-minimise/internal/contextkeys"
 	"github.com/Melikhov-p/url-minimise/internal/models"
 	"github.com/Melikhov-p/url-minimise/internal/repository"
 	"github.com/Melikhov-p/url-minimise/internal/service"
+	"github.com/Melikhov-p/url-minimise/internal/tracing"
+	"github.com/go-chi/chi/v5"
 	"go.uber.org/zap"
 )
 
@@ -54,12 +58,18 @@ func (m *Middleware) WithLogging(h http.Handler) http.Handler {
 
 		duration := time.Since(startTime)
 
+		var route string
+		if rctx := chi.RouteContext(r.Context()); rctx != nil {
+			route = rctx.RoutePattern()
+		}
+		m.Cfg.Metrics.ObserveHTTP(r.Method, route, responseData.status, duration)
+
 		user, ok := r.Context().Value("user").(*models.User)
 		if !ok {
 			user = repository.NewEmptyUser()
 		}
 
-		m.Logger.Info(
+		tracing.Logger(r.Context(), m.Logger).Info(
 			"",
 			zap.String("URI", r.RequestURI),
 			zap.String("METHOD", r.Method),
@@ -71,6 +81,46 @@ func (m *Middleware) WithLogging(h http.Handler) http.Handler {
 	})
 }
 
+// WithTracing мидлварь трассировки: продолжает трассировку из заголовка traceparent или начинает новую,
+// возвращает traceparent своего спана в ответе. Имя спана содержит маршрут, найденный роутером.
+func (m *Middleware) WithTracing(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var parent tracing.SpanContext
+		if header := r.Header.Get(tracing.TraceparentHeader); header != "" {
+			var err error
+			if parent, err = tracing.ParseTraceparent(header); err != nil {
+				m.Logger.Debug("ignoring traceparent header", zap.String("traceparent", header), zap.Error(err))
+			}
+		}
+
+		ctx, span := m.Cfg.Tracer.StartRemote(r.Context(), "HTTP "+r.Method, parent)
+		defer span.End()
+		if span != nil {
+			w.Header().Set(tracing.TraceparentHeader, span.Context().Traceparent())
+		}
+
+		lw := loggerResponseWriter{
+			ResponseWriter: w,
+			responseData:   &responseData{},
+		}
+		h.ServeHTTP(&lw, r.WithContext(ctx))
+
+		status := lw.responseData.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		if rctx := chi.RouteContext(ctx); rctx != nil && rctx.RoutePattern() != "" {
+			span.SetName("HTTP " + r.Method + " " + rctx.RoutePattern())
+			span.SetAttribute("http.route", rctx.RoutePattern())
+		}
+		span.SetAttribute("http.method", r.Method)
+		span.SetAttribute("http.status_code", strconv.Itoa(status))
+		if status >= http.StatusInternalServerError {
+			span.RecordError(fmt.Errorf("HTTP status %d", status))
+		}
+	})
+}
+
 // Write пишет.
 func (r *loggerResponseWriter) Write(b []byte) (int, error) {
 	size, err := r.ResponseWriter.Write(b)
@@ -87,9 +137,15 @@ func (r *loggerResponseWriter) WriteHeader(statusCode int) {
 	r.responseData.status = statusCode
 }
 
+// Unwrap возвращает исходный http.ResponseWriter для http.ResponseController.
+func (r *loggerResponseWriter) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
 // GzipMiddleware мидлварь компрессии.
 func (m *Middleware) GzipMiddleware(h http.Handler) http.Handler {
 	comp := func(w http.ResponseWriter, r *http.Request) {
+		logger := tracing.Logger(r.Context(), m.Logger)
 		ow := w
 
 		content := w.Header().Get("Content-Type")
@@ -101,7 +157,7 @@ func (m *Middleware) GzipMiddleware(h http.Handler) http.Handler {
 				ow = cw
 				defer func() {
 					if err := cw.Close(); err != nil {
-						m.Logger.Error("error closing compressWriter", zap.Error(err))
+						logger.Error("error closing compressWriter", zap.Error(err))
 					}
 				}()
 			}
@@ -112,14 +168,14 @@ func (m *Middleware) GzipMiddleware(h http.Handler) http.Handler {
 		if strings.Contains(contentEncoding, "gzip") {
 			cr, err := compress.NewCompressReader(r.Body)
 			if err != nil {
-				m.Logger.Error("error getting compress reader", zap.Error(err))
+				logger.Error("error getting compress reader", zap.Error(err))
 				w.WriteHeader(http.StatusInternalServerError)
 				return
 			}
 			r.Body = cr
 			defer func() {
 				if err = cr.Close(); err != nil {
-					m.Logger.Error("error closing compressReader", zap.Error(err))
+					logger.Error("error closing compressReader", zap.Error(err))
 				}
 			}()
 		}
@@ -130,30 +186,154 @@ func (m *Middleware) GzipMiddleware(h http.Handler) http.Handler {
 	return http.HandlerFunc(comp)
 }
 
-// WithAuth мидлварь аутентификации.
+// WithAuth мидлварь аутентификации: по ключу API или токену доступа из заголовка Authorization: Bearer,
+// а без заголовка — по токену из cookie. Неверный ключ API или токен отклоняется с 401, а не превращается
+// в анонимного пользователя.
 func (m *Middleware) WithAuth(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		tokenCookie, err := r.Cookie("Token")
-		if err != nil && !errors.Is(err, http.ErrNoCookie) {
-			w.WriteHeader(http.StatusBadRequest)
-			m.Logger.Error("can not read cookie from request", zap.Error(err))
+		logger := tracing.Logger(r.Context(), m.Logger)
+
+		bearer, found, ok := auth.BearerToken(r)
+		switch {
+		case found && !ok:
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		case found && strings.HasPrefix(bearer, auth.APIKeyPrefix):
+			m.withAPIKey(w, r, h, bearer, logger)
 			return
 		}
 
-		var user *models.User
-		if !errors.Is(err, http.ErrNoCookie) {
-			token := tokenCookie.Value
-			user, err = service.AuthUserByToken(token, m.Storage, m.Logger, m.Cfg)
+		token := auth.AccessToken(r)
+		user := repository.NewEmptyUser()
+		if token != "" {
+			var err error
+			user, err = service.AuthUserByToken(token, m.Storage, logger, m.Cfg)
 			if err != nil {
+				if rejectToken(w, err) {
+					return
+				}
 				w.WriteHeader(http.StatusInternalServerError)
-				m.Logger.Error("error authorizing user", zap.Error(err))
+				logger.Error("error authorizing user", zap.Error(err))
 				return
 			}
-		} else {
-			user = repository.NewEmptyUser()
 		}
 
 		ctxWithUser := context.WithValue(r.Context(), contextkeys.ContextUserKey, user)
 		h.ServeHTTP(w, r.WithContext(ctxWithUser))
 	})
 }
+
+// WithCSRF мидлварь защиты от CSRF для запросов, которые браузер аутентифицирует cookie сам.
+// Вместе с cookie сессии клиент получает cookie с токеном CSRF, доступную скриптам страницы. Запрос,
+// изменяющий данные, с cookie сессии проходит, только если повторяет этот токен в заголовке X-CSRF-Token:
+// чужой сайт не может прочитать cookie и подставить заголовок. Запросы с заголовком Authorization
+// и запросы без cookie сессии проверять не нужно: браузер не добавит им учётные данные сам.
+func (m *Middleware) WithCSRF(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isSafeMethod(r.Method) || !hasSessionCookie(r) || r.Header.Get("Authorization") != "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		var csrfToken string
+		if cookie, err := r.Cookie(auth.CSRFCookie); err == nil {
+			csrfToken = cookie.Value
+		}
+		if !auth.CheckCSRFToken(r.Header.Get(auth.CSRFHeader), csrfToken) {
+			http.Error(w, "missing or invalid "+auth.CSRFHeader+" header", http.StatusForbidden)
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+// isSafeMethod метод, который не изменяет данные.
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	default:
+		return false
+	}
+}
+
+// hasSessionCookie есть ли в запросе cookie с токеном доступа или токеном обновления.
+func hasSessionCookie(r *http.Request) bool {
+	for _, name := range []string{auth.AccessCookie, auth.RefreshCookie} {
+		if _, err := r.Cookie(name); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// refreshPath адрес обновления токенов, который подсказывается клиенту с истёкшим токеном доступа.
+const refreshPath = "/api/user/refresh"
+
+// rejectToken отвечает 401 на истёкший, отозванный или повреждённый токен доступа и возвращает true.
+// Ответ на истёкший токен подсказывает, где его обновить. Для остальных ошибок возвращает false.
+func rejectToken(w http.ResponseWriter, err error) bool {
+	switch {
+	case errors.Is(err, auth.ErrTokenExpired):
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token", error_description="access token expired"`)
+		http.Error(w, "access token expired, refresh it with POST "+refreshPath, http.StatusUnauthorized)
+	case errors.Is(err, auth.ErrInvalidToken), errors.Is(err, service.ErrTokenRevoked):
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		w.WriteHeader(http.StatusUnauthorized)
+	default:
+		return false
+	}
+	return true
+}
+
+// withAPIKey аутентифицирует запрос ключом API из заголовка Authorization.
+func (m *Middleware) withAPIKey(
+	w http.ResponseWriter,
+	r *http.Request,
+	h http.Handler,
+	key string,
+	logger *zap.Logger,
+) {
+	user, err := service.AuthUserByAPIKey(r.Context(), key, m.Storage, logger)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidAPIKey) {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		logger.Error("error authorizing api key", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	ctxWithUser := context.WithValue(r.Context(), contextkeys.ContextUserKey, user)
+	h.ServeHTTP(w, r.WithContext(ctxWithUser))
+}
+
+// RequireScope пропускает запрос с ключом API, только если у ключа есть право scope.
+// Запросы с токеном сессии проходят всегда.
+func RequireScope(scope models.APIScope) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if user, ok := r.Context().Value(contextkeys.ContextUserKey).(*models.User); ok && !user.Allows(scope) {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireSession пропускает только запросы с токеном сессии: ключом API нельзя
+// управлять ключами и входить в аккаунт.
+func RequireSession(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, ok := r.Context().Value(contextkeys.ContextUserKey).(*models.User); ok && user.APIKey != nil {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
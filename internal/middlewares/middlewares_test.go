@@ -1,24 +1,38 @@
 package middlewares
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/Melikhov-p/url-minimise/internal/auth"
 	"github.com/Melikhov-p/url-minimise/internal/config"
 	"github.com/Melikhov-p/url-minimise/internal/contextkeys"
 	"github.com/Melikhov-p/url-minimise/internal/logger"
 	"github.com/Melikhov-p/url-minimise/internal/models"
 	"github.com/Melikhov-p/url-minimise/internal/repository"
+	"github.com/Melikhov-p/url-minimise/internal/service"
+	"github.com/Melikhov-p/url-minimise/internal/tracing"
+	"github.com/Melikhov-p/url-minimise/protos/gen/proto"
+	"github.com/go-chi/chi/v5"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
 func TestWithLogging(t *testing.T) {
 	log, err := logger.BuildLogger("ERROR")
 	assert.NoError(t, err)
-	store, err := repository.NewStorage(config.NewConfig(log, true), log)
-	assert.NoError(t, err)
 	cfg := config.NewConfig(log, true)
+	cfg.Storage.FileStorage.FilePath = filepath.Join(t.TempDir(), "storage.txt")
+	store, err := repository.NewStorage(cfg, log)
+	assert.NoError(t, err)
 
 	middleware := Middleware{
 		Logger:  log,
@@ -43,9 +57,10 @@ func TestWithLogging(t *testing.T) {
 func TestWithAuth(t *testing.T) {
 	log, err := logger.BuildLogger("ERROR")
 	assert.NoError(t, err)
-	store, err := repository.NewStorage(config.NewConfig(log, true), log)
-	assert.NoError(t, err)
 	cfg := config.NewConfig(log, true)
+	cfg.Storage.FileStorage.FilePath = filepath.Join(t.TempDir(), "storage.txt")
+	store, err := repository.NewStorage(cfg, log)
+	assert.NoError(t, err)
 
 	middleware := Middleware{
 		Logger:  log,
@@ -68,5 +83,417 @@ func TestWithAuth(t *testing.T) {
 
 	middleware.WithAuth(handler).ServeHTTP(rr, req)
 
-	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	assert.Equal(t, `Bearer error="invalid_token"`, rr.Header().Get("WWW-Authenticate"))
+
+	// Истёкший токен отклоняется с подсказкой обновить его.
+	expired, err := auth.BuildJWTString(1, cfg.SigningKeys, -time.Minute)
+	require.NoError(t, err)
+	req = httptest.NewRequest("GET", "/test", nil)
+	req.AddCookie(&http.Cookie{Name: "Token", Value: expired})
+	rr = httptest.NewRecorder()
+
+	middleware.WithAuth(handler).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	assert.Contains(t, rr.Header().Get("WWW-Authenticate"), "access token expired")
+	assert.Contains(t, rr.Body.String(), "/api/user/refresh")
+
+	// Отозванный выходом из сессии токен отклоняется.
+	user, err := service.AddNewUser(context.Background(), store, cfg)
+	require.NoError(t, err)
+	require.NoError(t, service.Logout(context.Background(), store, cfg, user.Service.Token, user.Service.RefreshToken))
+	req = httptest.NewRequest("GET", "/test", nil)
+	req.AddCookie(&http.Cookie{Name: "Token", Value: user.Service.Token})
+	rr = httptest.NewRecorder()
+
+	middleware.WithAuth(handler).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	// Токен доступа принимается и в заголовке Authorization, который важнее cookie.
+	token, err := auth.BuildJWTString(1, cfg.SigningKeys, time.Minute)
+	require.NoError(t, err)
+	req = httptest.NewRequest("GET", "/test", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.AddCookie(&http.Cookie{Name: "Token", Value: "invalid token"})
+	rr = httptest.NewRecorder()
+
+	middleware.WithAuth(handler).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	req = httptest.NewRequest("GET", "/test", nil)
+	req.Header.Set("Authorization", "Bearer "+expired)
+	rr = httptest.NewRecorder()
+
+	middleware.WithAuth(handler).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	assert.Contains(t, rr.Header().Get("WWW-Authenticate"), "access token expired")
+}
+
+func TestWithCSRF(t *testing.T) {
+	log, err := logger.BuildLogger("ERROR")
+	require.NoError(t, err)
+	cfg := config.NewConfig(log, true)
+	middleware := Middleware{Logger: log, Cfg: cfg}
+	handler := middleware.WithCSRF(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// Токен CSRF выдаётся вместе с сессией, мидлварь только проверяет его и cookie не ставит:
+	// иначе Set-Cookie попал бы и в публичные кешируемые ответы, например редиректы.
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/abc", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Empty(t, rr.Result().Cookies())
+	csrf := &http.Cookie{Name: auth.CSRFCookie, Value: "csrf-token"}
+
+	tests := []struct {
+		name     string
+		method   string
+		cookies  []*http.Cookie
+		header   string
+		bearer   bool
+		wantCode int
+	}{
+		{
+			name:     "safe method",
+			method:   http.MethodGet,
+			cookies:  []*http.Cookie{{Name: "Token", Value: "t"}},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "session without token",
+			method:   http.MethodPost,
+			cookies:  []*http.Cookie{{Name: "Token", Value: "t"}, csrf},
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "wrong token",
+			method:   http.MethodDelete,
+			cookies:  []*http.Cookie{{Name: "Token", Value: "t"}, csrf},
+			header:   csrf.Value + "0",
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "header without cookie",
+			method:   http.MethodPost,
+			cookies:  []*http.Cookie{{Name: "Token", Value: "t"}},
+			header:   csrf.Value,
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "refresh cookie",
+			method:   http.MethodPost,
+			cookies:  []*http.Cookie{{Name: "RefreshToken", Value: "r"}},
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "matching token",
+			method:   http.MethodPost,
+			cookies:  []*http.Cookie{{Name: "Token", Value: "t"}, csrf},
+			header:   csrf.Value,
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "authorization header",
+			method:   http.MethodPost,
+			cookies:  []*http.Cookie{{Name: "Token", Value: "t"}},
+			bearer:   true,
+			wantCode: http.StatusOK,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(test.method, "/api/shorten", nil)
+			for _, cookie := range test.cookies {
+				req.AddCookie(cookie)
+			}
+			if test.header != "" {
+				req.Header.Set(auth.CSRFHeader, test.header)
+			}
+			if test.bearer {
+				req.Header.Set("Authorization", "Bearer token")
+			}
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			assert.Equal(t, test.wantCode, rr.Code)
+		})
+	}
+}
+
+func TestWithTracing(t *testing.T) {
+	log, err := logger.BuildLogger("ERROR")
+	require.NoError(t, err)
+	cfg := config.NewConfig(log, true)
+	cfg.Storage.FileStorage.FilePath = filepath.Join(t.TempDir(), "storage.txt")
+	exporter := tracing.NewMemoryExporter()
+	cfg.Tracer = tracing.NewTracer(exporter)
+	store, err := repository.NewStorage(cfg, log)
+	require.NoError(t, err)
+
+	middleware := Middleware{
+		Logger:  log,
+		Storage: store,
+		Cfg:     cfg,
+	}
+
+	router := chi.NewRouter()
+	router.Use(middleware.WithTracing)
+	router.Get("/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if _, err := store.GetURL(r.Context(), chi.URLParam(r, "id")); err != nil {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/missing", nil)
+	req.Header.Set(tracing.TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	spans := exporter.Spans()
+	require.Len(t, spans, 2)
+	storageSpan, requestSpan := spans[0], spans[1]
+
+	assert.Equal(t, "HTTP GET /{id}", requestSpan.Name)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", requestSpan.TraceID)
+	assert.Equal(t, "00f067aa0ba902b7", requestSpan.ParentID)
+	assert.Equal(t, "404", requestSpan.Attributes["http.status_code"])
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-"+requestSpan.SpanID+"-01",
+		rr.Header().Get(tracing.TraceparentHeader))
+
+	assert.Equal(t, "storage.get_url", storageSpan.Name)
+	assert.Equal(t, requestSpan.TraceID, storageSpan.TraceID)
+	assert.Equal(t, requestSpan.SpanID, storageSpan.ParentID)
+	assert.NotEmpty(t, storageSpan.Error)
+
+	// Неверный traceparent не ломает запрос: начинается новая трассировка.
+	exporter.Reset()
+	req = httptest.NewRequest(http.MethodGet, "/missing", nil)
+	req.Header.Set(tracing.TraceparentHeader, "garbage")
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	spans = exporter.Spans()
+	require.Len(t, spans, 2)
+	assert.NotEqual(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[1].TraceID)
+	assert.Empty(t, spans[1].ParentID)
+}
+
+func TestUnaryTracingInterceptor(t *testing.T) {
+	log, err := logger.BuildLogger("ERROR")
+	require.NoError(t, err)
+	cfg := config.NewConfig(log, true)
+	exporter := tracing.NewMemoryExporter()
+	cfg.Tracer = tracing.NewTracer(exporter)
+	interceptor := NewUnaryInterceptor(log, cfg, nil)
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+		tracing.TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+	))
+	info := &grpc.UnaryServerInfo{FullMethod: "/proto.Shortener/GetFullURL"}
+
+	var handlerSpan *tracing.Span
+	_, err = interceptor.UnaryTracingInterceptor(ctx, nil, info, func(ctx context.Context, _ any) (any, error) {
+		handlerSpan = tracing.SpanFromContext(ctx)
+		return nil, status.Error(codes.NotFound, "original url not found.")
+	})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	require.NotNil(t, handlerSpan)
+
+	spans := exporter.Spans()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "/proto.Shortener/GetFullURL", spans[0].Name)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[0].TraceID)
+	assert.Equal(t, "00f067aa0ba902b7", spans[0].ParentID)
+	assert.Equal(t, handlerSpan.Context().SpanID.String(), spans[0].SpanID)
+	assert.Equal(t, "NotFound", spans[0].Attributes["rpc.grpc.status_code"])
+	assert.NotEmpty(t, spans[0].Error)
+}
+
+func TestWithAuth_APIKey(t *testing.T) {
+	log, err := logger.BuildLogger("ERROR")
+	require.NoError(t, err)
+	cfg := config.NewConfig(log, true)
+	cfg.Storage.FileStorage.FilePath = filepath.Join(t.TempDir(), "storage.txt")
+	store, err := repository.NewStorage(cfg, log)
+	require.NoError(t, err)
+
+	_, rawKey, err := service.CreateAPIKey(context.Background(), store, 7, models.APIKeyRequest{
+		Name:   "ci",
+		Scopes: []models.APIScope{models.ScopeRead},
+	})
+	require.NoError(t, err)
+
+	middleware := Middleware{Logger: log, Storage: store, Cfg: cfg}
+	handler := func(scope models.APIScope) http.Handler {
+		return middleware.WithAuth(RequireScope(scope)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user := r.Context().Value(contextkeys.ContextUserKey).(*models.User)
+			assert.Equal(t, 7, user.ID)
+			w.WriteHeader(http.StatusOK)
+		})))
+	}
+
+	tests := []struct {
+		name       string
+		header     string
+		scope      models.APIScope
+		wantCode   int
+		wantHeader string
+	}{
+		{name: "valid key", header: "Bearer " + rawKey, scope: models.ScopeRead, wantCode: http.StatusOK},
+		{name: "missing scope", header: "Bearer " + rawKey, scope: models.ScopeDelete, wantCode: http.StatusForbidden},
+		{
+			name:       "invalid key",
+			header:     "Bearer " + rawKey + "0",
+			wantCode:   http.StatusUnauthorized,
+			wantHeader: `Bearer error="invalid_token"`,
+		},
+		{name: "not bearer", header: "Basic " + rawKey, wantCode: http.StatusUnauthorized, wantHeader: "Bearer"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.Header.Set("Authorization", test.header)
+			rr := httptest.NewRecorder()
+
+			handler(test.scope).ServeHTTP(rr, req)
+
+			assert.Equal(t, test.wantCode, rr.Code)
+			assert.Equal(t, test.wantHeader, rr.Header().Get("WWW-Authenticate"))
+		})
+	}
+
+	// Управлять ключами ключом API нельзя, а сессии это разрешено.
+	session := middleware.WithAuth(RequireSession(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})))
+	req := httptest.NewRequest(http.MethodGet, "/test", nil)
+	req.Header.Set("Authorization", "Bearer "+rawKey)
+	rr := httptest.NewRecorder()
+	session.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	rr = httptest.NewRecorder()
+	session.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/test", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
+
+func TestUnaryAuthInterceptor_APIKey(t *testing.T) {
+	log, err := logger.BuildLogger("ERROR")
+	require.NoError(t, err)
+	cfg := config.NewConfig(log, true)
+	cfg.Storage.FileStorage.FilePath = filepath.Join(t.TempDir(), "storage.txt")
+	store, err := repository.NewStorage(cfg, log)
+	require.NoError(t, err)
+	interceptor := NewUnaryInterceptor(log, cfg, store)
+
+	_, rawKey, err := service.CreateAPIKey(context.Background(), store, 7, models.APIKeyRequest{
+		Name:   "ci",
+		Scopes: []models.APIScope{models.ScopeRead},
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		method   string
+		key      string
+		wantCode codes.Code
+	}{
+		{name: "scope granted", method: proto.Shortener_GetUserURLs_FullMethodName, key: rawKey, wantCode: codes.OK},
+		{name: "open method", method: proto.Shortener_Ping_FullMethodName, key: rawKey, wantCode: codes.OK},
+		{
+			name:     "scope missing",
+			method:   proto.Shortener_CreateURL_FullMethodName,
+			key:      rawKey,
+			wantCode: codes.PermissionDenied,
+		},
+		{
+			name:     "key management",
+			method:   proto.Shortener_CreateAPIKey_FullMethodName,
+			key:      rawKey,
+			wantCode: codes.PermissionDenied,
+		},
+		{
+			name:     "invalid key",
+			method:   proto.Shortener_GetUserURLs_FullMethodName,
+			key:      rawKey + "0",
+			wantCode: codes.Unauthenticated,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+test.key))
+			info := &grpc.UnaryServerInfo{FullMethod: test.method}
+
+			_, err := interceptor.UnaryAuthInterceptor(ctx, nil, info, func(ctx context.Context, _ any) (any, error) {
+				user := ctx.Value(contextkeys.ContextUserKey).(*models.User)
+				assert.Equal(t, 7, user.ID)
+				return nil, nil
+			})
+			assert.Equal(t, test.wantCode, status.Code(err))
+		})
+	}
+}
+
+func TestUnaryAuthInterceptor_Token(t *testing.T) {
+	log, err := logger.BuildLogger("ERROR")
+	require.NoError(t, err)
+	cfg := config.NewConfig(log, true)
+	cfg.Storage.FileStorage.FilePath = filepath.Join(t.TempDir(), "storage.txt")
+	store, err := repository.NewStorage(cfg, log)
+	require.NoError(t, err)
+	interceptor := NewUnaryInterceptor(log, cfg, store)
+
+	valid, err := auth.BuildJWTString(7, cfg.SigningKeys, time.Minute)
+	require.NoError(t, err)
+	expired, err := auth.BuildJWTString(7, cfg.SigningKeys, -time.Minute)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		method   string
+		token    string
+		wantUser int
+		wantCode codes.Code
+	}{
+		{name: "valid", method: proto.Shortener_GetUserURLs_FullMethodName, token: valid, wantUser: 7},
+		{name: "bearer", method: proto.Shortener_GetUserURLs_FullMethodName, token: "Bearer " + valid, wantUser: 7},
+		{name: "anonymous", method: proto.Shortener_GetUserURLs_FullMethodName, wantUser: -1},
+		{
+			name:     "expired",
+			method:   proto.Shortener_GetUserURLs_FullMethodName,
+			token:    expired,
+			wantCode: codes.Unauthenticated,
+		},
+		{
+			name:     "invalid",
+			method:   proto.Shortener_GetUserURLs_FullMethodName,
+			token:    "token",
+			wantCode: codes.Unauthenticated,
+		},
+		{name: "refresh with expired token", method: proto.Shortener_Refresh_FullMethodName, token: expired, wantUser: -1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", test.token))
+			info := &grpc.UnaryServerInfo{FullMethod: test.method}
+
+			_, err := interceptor.UnaryAuthInterceptor(ctx, nil, info, func(ctx context.Context, _ any) (any, error) {
+				user := ctx.Value(contextkeys.ContextUserKey).(*models.User)
+				assert.Equal(t, test.wantUser, user.ID)
+				return nil, nil
+			})
+			assert.Equal(t, test.wantCode, status.Code(err))
+		})
+	}
 }
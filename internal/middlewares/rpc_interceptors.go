@@ -2,14 +2,23 @@ package middlewares
 
 import (
 	"context"
+	"errors"
+	"strings"
+	"time"
 
+	"github.com/Melikhov-p/url-minimise/internal/auth"
 	"github.com/Melikhov-p/url-minimise/internal/config"
 	"github.com/Melikhov-p/url-minimise/internal/contextkeys"
+	"github.com/Melikhov-p/url-minimise/internal/models"
 	"github.com/Melikhov-p/url-minimise/internal/repository"
 	"github.com/Melikhov-p/url-minimise/internal/service"
+	"github.com/Melikhov-p/url-minimise/internal/tracing"
+	"github.com/Melikhov-p/url-minimise/protos/gen/proto"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
 // UnaryInterceptor перехватчик запросов gRPC.
@@ -35,6 +44,153 @@ func (ui *UnaryInterceptor) UnaryAuthInterceptor(
 	info *grpc.UnaryServerInfo,
 	handler grpc.UnaryHandler,
 ) (resp any, err error) {
+	ctx, err = ui.withUser(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+
+	// Передаем управление следующему хендлеру
+	return handler(ctx, req)
+}
+
+// StreamAuthInterceptor - interceptor для авторизации в потоковых RPC запросах.
+func (ui *UnaryInterceptor) StreamAuthInterceptor(
+	srv any,
+	ss grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	ctx, err := ui.withUser(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(srv, &authServerStream{ServerStream: ss, ctx: ctx})
+}
+
+// UnaryMetricsInterceptor - interceptor для метрик unary RPC запросов.
+func (ui *UnaryInterceptor) UnaryMetricsInterceptor(
+	ctx context.Context,
+	req any,
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (resp any, err error) {
+	start := time.Now()
+	resp, err = handler(ctx, req)
+	ui.cfg.Metrics.ObserveGRPC(info.FullMethod, status.Code(err).String(), time.Since(start))
+	return resp, err
+}
+
+// StreamMetricsInterceptor - interceptor для метрик потоковых RPC запросов, время считается до закрытия потока.
+func (ui *UnaryInterceptor) StreamMetricsInterceptor(
+	srv any,
+	ss grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	start := time.Now()
+	err := handler(srv, ss)
+	ui.cfg.Metrics.ObserveGRPC(info.FullMethod, status.Code(err).String(), time.Since(start))
+	return err
+}
+
+// UnaryTracingInterceptor - interceptor трассировки unary RPC запросов: продолжает трассировку
+// из метаданных traceparent или начинает новую и возвращает traceparent своего спана в заголовке ответа.
+func (ui *UnaryInterceptor) UnaryTracingInterceptor(
+	ctx context.Context,
+	req any,
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (resp any, err error) {
+	ctx, span := ui.startSpan(ctx, info.FullMethod)
+	defer span.End()
+	if span != nil {
+		if err = grpc.SetHeader(ctx, metadata.Pairs(tracing.TraceparentHeader, span.Context().Traceparent())); err != nil {
+			ui.log.Debug("error setting traceparent header", zap.Error(err))
+		}
+	}
+
+	resp, err = handler(ctx, req)
+	finishSpan(span, err)
+	return resp, err
+}
+
+// StreamTracingInterceptor - interceptor трассировки потоковых RPC запросов, спан длится до закрытия потока.
+func (ui *UnaryInterceptor) StreamTracingInterceptor(
+	srv any,
+	ss grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	ctx, span := ui.startSpan(ss.Context(), info.FullMethod)
+	defer span.End()
+	if span != nil {
+		if err := ss.SetHeader(metadata.Pairs(tracing.TraceparentHeader, span.Context().Traceparent())); err != nil {
+			ui.log.Debug("error setting traceparent header", zap.Error(err))
+		}
+	}
+
+	err := handler(srv, &authServerStream{ServerStream: ss, ctx: ctx})
+	finishSpan(span, err)
+	return err
+}
+
+// startSpan начинает спан вызова method с родителем из метаданных traceparent.
+func (ui *UnaryInterceptor) startSpan(ctx context.Context, method string) (context.Context, *tracing.Span) {
+	var parent tracing.SpanContext
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(tracing.TraceparentHeader); len(values) > 0 {
+			var err error
+			if parent, err = tracing.ParseTraceparent(values[0]); err != nil {
+				ui.log.Debug("ignoring traceparent metadata", zap.String("traceparent", values[0]), zap.Error(err))
+			}
+		}
+	}
+
+	ctx, span := ui.cfg.Tracer.StartRemote(ctx, method, parent)
+	span.SetAttribute("rpc.method", method)
+	return ctx, span
+}
+
+// finishSpan записывает в спан код ответа gRPC и ошибку.
+func finishSpan(span *tracing.Span, err error) {
+	span.SetAttribute("rpc.grpc.status_code", status.Code(err).String())
+	span.RecordError(err)
+}
+
+// rpcScopes права ключа API, нужные для вызова метода. Пустое право — метод доступен любому ключу.
+// Методы, которых нет в списке (вход в аккаунт и управление ключами), ключом API вызвать нельзя.
+var rpcScopes = map[string]models.APIScope{
+	proto.Shortener_Ping_FullMethodName:                 "",
+	proto.Shortener_GetFullURL_FullMethodName:           "",
+	proto.Shortener_CreateURL_FullMethodName:            models.ScopeCreate,
+	proto.Shortener_CreateBatchURL_FullMethodName:       models.ScopeCreate,
+	proto.Shortener_CreateBatchURLStream_FullMethodName: models.ScopeCreate,
+	proto.Shortener_UpdateURLSettings_FullMethodName:    models.ScopeCreate,
+	proto.Shortener_SetRedirectRules_FullMethodName:     models.ScopeCreate,
+	proto.Shortener_SetVariants_FullMethodName:          models.ScopeCreate,
+	proto.Shortener_RegisterDomain_FullMethodName:       models.ScopeCreate,
+	proto.Shortener_GetUserURLs_FullMethodName:          models.ScopeRead,
+	proto.Shortener_GetRedirectRules_FullMethodName:     models.ScopeRead,
+	proto.Shortener_GetVariants_FullMethodName:          models.ScopeRead,
+	proto.Shortener_GetUserDomains_FullMethodName:       models.ScopeRead,
+	proto.Shortener_GetBrokenURLs_FullMethodName:        models.ScopeRead,
+	proto.Shortener_MarkAsDelete_FullMethodName:         models.ScopeDelete,
+	proto.Shortener_RestoreURLs_FullMethodName:          models.ScopeDelete,
+	proto.Shortener_GetServiceStats_FullMethodName:      models.ScopeStats,
+	proto.Shortener_GetLinkStats_FullMethodName:         models.ScopeStats,
+	proto.Shortener_WatchClicks_FullMethodName:          models.ScopeStats,
+}
+
+// withUser возвращает контекст с пользователем из метаданных запроса. Ключ API и токен доступа передаются
+// в метаданных authorization как Bearer <ключ> или без префикса, неверный ключ или ключ без нужного права
+// отклоняются.
+// Истёкший, отозванный или повреждённый токен доступа отклоняется с Unauthenticated.
+func (ui *UnaryInterceptor) withUser(ctx context.Context, method string) (context.Context, error) {
+	// Обновление и завершение сессии принимают истёкший токен доступа и сами разбирают токены.
+	if method == proto.Shortener_Refresh_FullMethodName || method == proto.Shortener_Logout_FullMethodName {
+		return context.WithValue(ctx, contextkeys.ContextUserKey, repository.NewEmptyUser()), nil
+	}
+
 	// Извлекаем метаданные из контекста
 	md, ok := metadata.FromIncomingContext(ctx)
 	if !ok {
@@ -43,23 +199,68 @@ func (ui *UnaryInterceptor) UnaryAuthInterceptor(
 
 	var accessToken string
 	if authHeader, exists := md["authorization"]; exists && len(authHeader) > 0 {
-		accessToken = authHeader[0]
+		accessToken = strings.TrimSpace(strings.TrimPrefix(authHeader[0], "Bearer "))
+	}
+
+	logger := tracing.Logger(ctx, ui.log)
+	if strings.HasPrefix(accessToken, auth.APIKeyPrefix) {
+		return ui.withAPIKey(ctx, method, accessToken, logger)
 	}
 
 	// Проверяем токен
-	user, err := service.AuthUserByToken(accessToken, ui.store, ui.log, ui.cfg)
+	user, err := service.AuthUserByToken(accessToken, ui.store, logger, ui.cfg)
 
-	if err != nil {
-		// Генерируем новый токен и пользователя
+	switch {
+	case err == nil:
+		logger.Info("Verified user")
+	case accessToken == "":
+		// Без токена пользователь анонимный, токен выдаст метод, которому он нужен
 		user = repository.NewEmptyUser()
-		ui.log.Info("new empty user")
-	} else {
-		ui.log.Info("Verified user")
+		logger.Info("new empty user")
+	case errors.Is(err, auth.ErrTokenExpired):
+		return nil, status.Error(codes.Unauthenticated, "access token expired, call Refresh with the refresh token")
+	case errors.Is(err, auth.ErrInvalidToken), errors.Is(err, service.ErrTokenRevoked):
+		return nil, status.Error(codes.Unauthenticated, "invalid access token")
+	default:
+		logger.Error("error authorizing user", zap.Error(err))
+		return nil, status.Error(codes.Internal, "")
 	}
 
 	// Передаем userID в контекст
-	ctxWithUser := context.WithValue(ctx, contextkeys.ContextUserKey, user)
+	return context.WithValue(ctx, contextkeys.ContextUserKey, user), nil
+}
 
-	// Передаем управление следующему хендлеру
-	return handler(ctxWithUser, req)
+// withAPIKey возвращает контекст с владельцем ключа API, если ключ действителен и у него есть право на метод.
+func (ui *UnaryInterceptor) withAPIKey(
+	ctx context.Context,
+	method string,
+	key string,
+	logger *zap.Logger,
+) (context.Context, error) {
+	user, err := service.AuthUserByAPIKey(ctx, key, ui.store, logger)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidAPIKey) {
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		}
+		logger.Error("error authorizing api key", zap.Error(err))
+		return nil, status.Error(codes.Internal, "")
+	}
+
+	scope, known := rpcScopes[method]
+	if !known || (scope != "" && !user.Allows(scope)) {
+		return nil, status.Error(codes.PermissionDenied, "api key has no access to this method")
+	}
+
+	return context.WithValue(ctx, contextkeys.ContextUserKey, user), nil
+}
+
+// authServerStream поток gRPC с контекстом, в который добавлен пользователь.
+type authServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context возвращает контекст потока с пользователем.
+func (s *authServerStream) Context() context.Context {
+	return s.ctx
 }
@@ -1,8 +1,15 @@
 package models
 
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
 // Request модель запроса
 type Request struct {
-	URL string `json:"url"`
+	URL    string `json:"url"`
+	Domain string `json:"domain,omitempty"`
 }
 
 // Response модель ответа
@@ -37,14 +44,195 @@ type UserURLsResponse struct {
 	UserURLs []*UserURL
 }
 
-// UserURL структура пользовательского URL
+// UserURL структура пользовательского URL. ID — ключ ссылки в хранилище (code или code@domain),
+// по которому к ссылке обращаются запросы владельца.
 type UserURL struct {
+	ID          string `json:"id"`
 	OriginalURL string `json:"original_url"`
 	ShortURL    string `json:"short_url"`
+	Quarantined bool   `json:"quarantined,omitempty"`
+}
+
+// ImportResult результат импорта одной строки файла ссылок.
+type ImportResult struct {
+	CorrelationID string `json:"correlation_id,omitempty"`
+	OriginalURL   string `json:"original_url,omitempty"`
+	ShortURL      string `json:"short_url,omitempty"`
+	Error         string `json:"error,omitempty"`
+	Line          int    `json:"line"`
+}
+
+// ExportURL ссылка пользователя в выгрузке. Пустые даты не выгружаются.
+type ExportURL struct {
+	DeletedAt   *time.Time `json:"deleted_at,omitempty"`
+	CreatedAt   *time.Time `json:"created_at,omitempty"`
+	ShortURL    string     `json:"short_url"`
+	OriginalURL string     `json:"original_url"`
+	DeletedFlag bool       `json:"is_deleted"`
 }
 
-// StatsResponse структура ответа на запрос статистики.
+// BrokenURL ссылка пользователя, адрес назначения которой не отвечает.
+type BrokenURL struct {
+	CheckedAt   time.Time `json:"checked_at"`
+	ShortURL    string    `json:"short_url"`
+	OriginalURL string    `json:"original_url"`
+	Error       string    `json:"error,omitempty"`
+	StatusCode  int       `json:"status_code,omitempty"`
+	LatencyMs   int64     `json:"latency_ms"`
+	Failures    int       `json:"failures"`
+}
+
+// StatsResponse структура ответа на запрос статистики. URLs — активные ссылки, DeletedURLs — помеченные
+// на удаление, но ещё не удалённые окончательно. UniqueVisitors — приближённая оценка количества
+// уникальных посетителей сервиса за всё время. Статистика кешируется, GeneratedAt — время её подсчёта.
 type StatsResponse struct {
-	URLs  int `json:"urls"`
-	Users int `json:"users"`
+	GeneratedAt        time.Time    `json:"generated_at"`
+	TopLinks           []LinkClicks `json:"top_links"`
+	URLs               int          `json:"urls"`
+	DeletedURLs        int          `json:"deleted_urls"`
+	CreatedLastHour    int          `json:"created_last_hour"`
+	CreatedLastDay     int          `json:"created_last_day"`
+	CreatedLastWeek    int          `json:"created_last_week"`
+	PendingDeleteTasks int          `json:"pending_delete_tasks"`
+	Users              int          `json:"users"`
+	PurgedURLs         int          `json:"purged_urls"`
+	TotalClicks        int64        `json:"total_clicks"`
+	DroppedClicks      int64        `json:"dropped_clicks"`
+	UniqueVisitors     uint64       `json:"unique_visitors"`
+}
+
+// LinkStatsResponse статистика переходов по ссылке за интервал [from, to).
+// Топы и уникальные посетители считаются по дням, поэтому интервал для них расширяется до границ суток в UTC.
+// UniqueVisitors — приближённая оценка.
+type LinkStatsResponse struct {
+	From           time.Time    `json:"from"`
+	To             time.Time    `json:"to"`
+	ShortURL       string       `json:"short_url"`
+	Bucket         StatsBucket  `json:"bucket"`
+	Series         []StatsPoint `json:"series"`
+	TopReferrers   []ClickCount `json:"top_referrers"`
+	TopUserAgents  []ClickCount `json:"top_user_agents"`
+	Languages      []ClickCount `json:"languages"`
+	TotalClicks    int64        `json:"total_clicks"`
+	RangeClicks    int64        `json:"range_clicks"`
+	UniqueVisitors uint64       `json:"unique_visitors"`
+}
+
+// URLSettingsRequest запрос изменения настроек URL владельцем, пустые поля не меняются.
+type URLSettingsRequest struct {
+	RedirectCode     *int              `json:"redirect_code,omitempty"`
+	NoCache          *bool             `json:"no_cache,omitempty"`
+	QueryPassthrough *bool             `json:"query_passthrough,omitempty"`
+	UTM              map[string]string `json:"utm,omitempty"`
+	ActiveFrom       NullableTime      `json:"active_from"`
+	ActiveUntil      NullableTime      `json:"active_until"`
+}
+
+// NullableTime время в запросе изменения настроек, Set отличает явный null от отсутствующего поля.
+type NullableTime struct {
+	Time *time.Time
+	Set  bool
+}
+
+// UnmarshalJSON вызывается только для поля, присутствующего в запросе.
+func (t *NullableTime) UnmarshalJSON(data []byte) error {
+	t.Set = true
+	if string(data) == "null" {
+		t.Time = nil
+		return nil
+	}
+
+	var value time.Time
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("error unmarshal time %w", err)
+	}
+	t.Time = &value
+
+	return nil
+}
+
+// URLSettingsResponse текущие настройки URL.
+type URLSettingsResponse struct {
+	ShortURL         string            `json:"short_url"`
+	OriginalURL      string            `json:"original_url"`
+	RedirectCode     int               `json:"redirect_code"`
+	NoCache          bool              `json:"no_cache"`
+	QueryPassthrough bool              `json:"query_passthrough"`
+	UTM              map[string]string `json:"utm,omitempty"`
+	ActiveFrom       *time.Time        `json:"active_from,omitempty"`
+	ActiveUntil      *time.Time        `json:"active_until,omitempty"`
+	Quarantined      bool              `json:"quarantined"`
+}
+
+// DomainRequest запрос регистрации дополнительного короткого домена.
+type DomainRequest struct {
+	Domain string `json:"domain"`
+}
+
+// DomainVerification записи DNS, любой из которых пользователь подтверждает владение доменом:
+// TXT-запись Record со значением TXT или CNAME-запись Record на адрес CNAME.
+type DomainVerification struct {
+	Domain string `json:"domain"`
+	Record string `json:"record"`
+	TXT    string `json:"txt"`
+	CNAME  string `json:"cname"`
+}
+
+// UserDomainsResponse домены, на которых пользователь может создавать ссылки.
+type UserDomainsResponse struct {
+	Primary    string   `json:"primary"`
+	Shared     []string `json:"shared"`
+	Registered []string `json:"registered"`
+}
+
+// AccountRequest запрос регистрации или входа в аккаунт.
+type AccountRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// AccountResponse аккаунт после регистрации или входа. MergedURLs — ссылки анонимной сессии,
+// перенесённые в аккаунт.
+type AccountResponse struct {
+	Email      string `json:"email"`
+	UserID     int    `json:"user_id"`
+	MergedURLs int    `json:"merged_urls"`
+}
+
+// RefreshRequest запрос обновления токенов. Без тела токен обновления берётся из cookie.
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// TokenResponse новая пара токенов. ExpiresIn — срок действия токена доступа в секундах.
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+// APIKeyRequest запрос создания ключа API. Без срока действия ключ действует до отзыва.
+type APIKeyRequest struct {
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Name      string     `json:"name"`
+	Scopes    []APIScope `json:"scopes"`
+}
+
+// APIKeyResponse ключ API. Сам ключ Key отдаётся только при создании.
+type APIKeyResponse struct {
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Key       string     `json:"key,omitempty"`
+	Scopes    []APIScope `json:"scopes"`
+}
+
+// SigningKeyResponse ключ подписи токенов без секрета. Signing — ключ, которым сейчас подписываются токены.
+type SigningKeyResponse struct {
+	CreatedAt time.Time  `json:"created_at"`
+	RetiredAt *time.Time `json:"retired_at,omitempty"`
+	ID        string     `json:"kid"`
+	Algorithm string     `json:"alg"`
+	Signing   bool       `json:"signing"`
 }
@@ -1,14 +1,200 @@
 package models
 
-import "sync"
+import (
+	"strings"
+	"sync"
+	"time"
+)
 
 // StorageURL структура хранимого в хранилище URL
 type StorageURL struct {
-	ShortURL    string `json:"short_url"`
-	OriginalURL string `json:"original_url"`
-	UUID        string `json:"uuid"`
-	UserID      int    `json:"user_id"`
-	DeletedFlag bool   `json:"is_deleted"`
+	ShortURL         string            `json:"short_url"`
+	OriginalURL      string            `json:"original_url"`
+	UUID             string            `json:"uuid"`
+	UserID           int               `json:"user_id"`
+	DeletedFlag      bool              `json:"is_deleted"`
+	DeletedAt        time.Time         `json:"deleted_at"`
+	CreatedAt        time.Time         `json:"created_at"`
+	RedirectCode     int               `json:"redirect_code"`
+	NoCache          bool              `json:"no_cache"`
+	QueryPassthrough bool              `json:"query_passthrough"`
+	UTM              map[string]string `json:"utm,omitempty"`
+	ActiveFrom       *time.Time        `json:"active_from,omitempty"`
+	ActiveUntil      *time.Time        `json:"active_until,omitempty"`
+	Rules            []RedirectRule    `json:"rules,omitempty"`
+	Variants         []Variant         `json:"variants,omitempty"`
+	Quarantined      bool              `json:"quarantined,omitempty"`
+}
+
+// LinkHealth результат проверки доступности адреса назначения ссылки.
+// Нулевое CheckedAt означает, что адрес ещё не проверялся.
+type LinkHealth struct {
+	CheckedAt   time.Time
+	ShortURL    string
+	OriginalURL string
+	Error       string
+	Latency     time.Duration
+	UserID      int
+	StatusCode  int
+	Failures    int
+	Broken      bool
+}
+
+// LinkKey ключ ссылки в хранилище. Ссылки основного домена хранятся под своим кодом,
+// ссылки дополнительных доменов — под ключом code@domain, поэтому код уникален в пределах домена.
+func LinkKey(code, domain string) string {
+	if domain == "" {
+		return code
+	}
+	return code + "@" + domain
+}
+
+// SplitLinkKey разбирает ключ ссылки на код и домен, для основного домена домен пустой.
+func SplitLinkKey(key string) (code, domain string) {
+	code, domain, _ = strings.Cut(key, "@")
+	return code, domain
+}
+
+// ShortDomain дополнительный короткий домен, зарегистрированный за пользователем UserID.
+type ShortDomain struct {
+	Name   string `json:"name"`
+	UserID int    `json:"user_id"`
+}
+
+// DeviceClass класс устройства посетителя, определяемый по User-Agent.
+type DeviceClass string
+
+// Классы устройств посетителей.
+const (
+	DeviceIOS     DeviceClass = "ios"
+	DeviceAndroid DeviceClass = "android"
+	DeviceDesktop DeviceClass = "desktop"
+)
+
+// RedirectRule правило условного редиректа, заданные условия должны выполниться все сразу.
+type RedirectRule struct {
+	NotBefore   *time.Time  `json:"not_before,omitempty"`
+	NotAfter    *time.Time  `json:"not_after,omitempty"`
+	Device      DeviceClass `json:"device,omitempty"`
+	Language    string      `json:"language,omitempty"`
+	Destination string      `json:"destination"`
+}
+
+// Variant вариант адреса назначения при A/B разделении трафика.
+type Variant struct {
+	Name        string `json:"name"`
+	Destination string `json:"destination"`
+	Weight      int    `json:"weight"`
+	Hits        int64  `json:"hits"`
+}
+
+// Visit данные посетителя, по которым выбирается адрес редиректа и записывается переход.
+type Visit struct {
+	Time           time.Time
+	UserAgent      string
+	AcceptLanguage string
+	Variant        string
+	Query          string
+	Referrer       string
+	IP             string
+}
+
+// ClickEvent переход по короткой ссылке. IP посетителя хранится обезличенным,
+// для подсчёта уникальных посетителей хранится только хеш Visitor.
+type ClickEvent struct {
+	Time      time.Time `json:"time"`
+	ShortURL  string    `json:"short_url"`
+	Referrer  string    `json:"referrer,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	Language  string    `json:"language,omitempty"`
+	IP        string    `json:"ip,omitempty"`
+	Visitor   uint64    `json:"visitor,omitempty"`
+	// Variant показанный вариант A/B. Воркер переходов прибавляет его к счётчику показов варианта,
+	// с самим событием вариант не сохраняется.
+	Variant string `json:"-"`
+}
+
+// LiveClick переход по ссылке, который отдаётся владельцу в реальном времени.
+type LiveClick struct {
+	Time      time.Time `json:"time"`
+	ShortURL  string    `json:"short_url"`
+	Referrer  string    `json:"referrer,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	Language  string    `json:"language,omitempty"`
+}
+
+// StatsBucket шаг временного ряда переходов.
+type StatsBucket string
+
+// Шаги временного ряда переходов.
+const (
+	StatsBucketHour StatsBucket = "hour"
+	StatsBucketDay  StatsBucket = "day"
+)
+
+// ClickDimension разрез агрегатов переходов.
+type ClickDimension string
+
+// Разрезы агрегатов переходов.
+const (
+	ClickDimensionReferrer  ClickDimension = "referrer"
+	ClickDimensionUserAgent ClickDimension = "user_agent"
+	ClickDimensionLanguage  ClickDimension = "language"
+)
+
+// ClickStatsQuery параметры выборки агрегатов переходов: полуинтервал [From, To), шаг ряда и размер топов.
+type ClickStatsQuery struct {
+	From   time.Time
+	To     time.Time
+	Bucket StatsBucket
+	Top    int
+}
+
+// ClickStats агрегаты переходов по ссылке. Ряд содержит только непустые интервалы.
+type ClickStats struct {
+	Series         []StatsPoint
+	Top            map[ClickDimension][]ClickCount
+	TotalCount     int64
+	UniqueVisitors uint64
+}
+
+// StatsPoint количество переходов за интервал, начинающийся в Time.
+type StatsPoint struct {
+	Time   time.Time `json:"time"`
+	Clicks int64     `json:"clicks"`
+}
+
+// ClickCount количество переходов со значением разреза Value.
+type ClickCount struct {
+	Value  string `json:"value"`
+	Clicks int64  `json:"clicks"`
+}
+
+// LinkClicks количество переходов по ссылке.
+type LinkClicks struct {
+	ShortURL string `json:"short_url"`
+	Clicks   int64  `json:"clicks"`
+}
+
+// ServiceStats агрегаты хранилища для статистики сервиса. Created* считаются от момента запроса.
+type ServiceStats struct {
+	TopLinks           []LinkClicks
+	ActiveURLs         int
+	DeletedURLs        int
+	CreatedLastHour    int
+	CreatedLastDay     int
+	CreatedLastWeek    int
+	PendingDeleteTasks int
+	TotalClicks        int64
+}
+
+// Redirect параметры ответа при переходе по короткой ссылке.
+type Redirect struct {
+	Location     string
+	CacheControl string
+	Vary         string
+	Variant      string
+	Code         int
 }
 
 // DelURLs адрес отмеченные на удаление
@@ -1,14 +1,133 @@
 package models
 
+import (
+	"slices"
+	"time"
+)
+
 // User user
 type User struct {
 	ID      int `json:"id"`
 	URLs    []*StorageURL
 	Service *UserService
+	Email   string `json:"email,omitempty"`
+	// APIKey ключ API, которым аутентифицирован запрос. Пустой для запросов с токеном сессии.
+	APIKey *APIKey `json:"-"`
+}
+
+// Registered сообщает, вошёл ли пользователь в зарегистрированный аккаунт, а не в анонимную сессию.
+func (u *User) Registered() bool {
+	return u.Email != ""
+}
+
+// Allows сообщает, разрешено ли запросу действие scope. Токен сессии разрешает всё,
+// ключ API — только действия из своих прав.
+func (u *User) Allows(scope APIScope) bool {
+	return u.APIKey == nil || u.APIKey.Allows(scope)
 }
 
 // UserService дополнительная информация по пользователю
 type UserService struct {
 	IsAuthenticated bool
 	Token           string
+	// RefreshToken токен обновления, выданный вместе с Token. Пустой, если новая сессия не выдавалась.
+	RefreshToken string
+}
+
+// Account зарегистрированный аккаунт: пользователь с почтой и хешем пароля bcrypt.
+type Account struct {
+	Email        string `json:"email"`
+	PasswordHash string `json:"password_hash"`
+	UserID       int    `json:"user_id"`
+}
+
+// OIDCIdentity пользователь subject провайдера OpenID Connect issuer, привязанный к аккаунту UserID.
+// Почта — почта этого аккаунта.
+type OIDCIdentity struct {
+	Issuer  string `json:"issuer"`
+	Subject string `json:"sub"`
+	Email   string `json:"email"`
+	UserID  int    `json:"user_id"`
+}
+
+// APIScope право ключа API.
+type APIScope string
+
+// Права ключей API.
+const (
+	// ScopeCreate создание ссылок и изменение их настроек, правил, вариантов и доменов.
+	ScopeCreate APIScope = "create"
+	// ScopeRead просмотр ссылок, их настроек и доменов.
+	ScopeRead APIScope = "read"
+	// ScopeDelete удаление и восстановление ссылок.
+	ScopeDelete APIScope = "delete"
+	// ScopeStats статистика переходов и сервиса.
+	ScopeStats APIScope = "stats"
+)
+
+// APIScopes все права ключей API в порядке, в котором они отдаются клиенту.
+var APIScopes = []APIScope{ScopeCreate, ScopeRead, ScopeDelete, ScopeStats}
+
+// APIKey ключ API пользователя. Сам ключ не хранится, только хеш его секретной части.
+type APIKey struct {
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Hash      string     `json:"hash"`
+	Scopes    []APIScope `json:"scopes"`
+	UserID    int        `json:"user_id"`
+}
+
+// Allows сообщает, входит ли scope в права ключа.
+func (k *APIKey) Allows(scope APIScope) bool {
+	return slices.Contains(k.Scopes, scope)
+}
+
+// Expired сообщает, истёк ли срок действия ключа к моменту now.
+func (k *APIKey) Expired(now time.Time) bool {
+	return k.ExpiresAt != nil && !now.Before(*k.ExpiresAt)
+}
+
+// RefreshToken токен обновления сессии. Сам токен не хранится, только хеш его секретной части.
+// Токены одной сессии образуют семейство Family: при обновлении токен заменяется следующим
+// (ReplacedBy), а повторное предъявление заменённого токена отзывает всё семейство.
+type RefreshToken struct {
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	ID         string     `json:"id"`
+	Family     string     `json:"family"`
+	Hash       string     `json:"hash"`
+	ReplacedBy string     `json:"replaced_by,omitempty"`
+	Email      string     `json:"email,omitempty"`
+	UserID     int        `json:"user_id"`
+}
+
+// Active сообщает, можно ли обменять токен на новую пару токенов в момент now.
+func (t *RefreshToken) Active(now time.Time) bool {
+	return t.RevokedAt == nil && t.ReplacedBy == "" && now.Before(t.ExpiresAt)
+}
+
+// RevokedToken отозванный токен доступа. Хранится, пока не истечёт срок самого токена.
+type RevokedToken struct {
+	ExpiresAt time.Time `json:"expires_at"`
+	ID        string    `json:"jti"`
+}
+
+// SigningKey ключ подписи токенов доступа, в заголовке токена указывается его идентификатор kid.
+// Новые токены подписывает самый новый действующий ключ, проверяет — любой действующий.
+// Выведенный из оборота ключ (RetiredAt) токены больше не принимает. Secret — секрет HS256
+// или закрытый ключ RS256 и EdDSA в PEM.
+type SigningKey struct {
+	CreatedAt time.Time  `json:"created_at"`
+	RetiredAt *time.Time `json:"retired_at,omitempty"`
+	ID        string     `json:"kid"`
+	Algorithm string     `json:"alg"`
+	Secret    string     `json:"-"`
+}
+
+// Retired сообщает, выведен ли ключ из оборота.
+func (k *SigningKey) Retired() bool {
+	return k.RetiredAt != nil
 }
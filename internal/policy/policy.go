@@ -0,0 +1,190 @@
+// Package policy проверяет адреса назначения по списку доменов из локального файла.
+//
+// Файл содержит по одному шаблону домена в строке, строки, начинающиеся с '#', пропускаются.
+// Шаблон "example.com" совпадает только с этим доменом, "*.example.com" — с любым его поддоменом.
+// В режиме блок-листа запрещены совпавшие домены, в режиме allow-листа — все остальные.
+package policy
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Mode режим применения списка доменов.
+type Mode string
+
+// Режимы применения списка доменов.
+const (
+	ModeBlock Mode = "block"
+	ModeAllow Mode = "allow"
+)
+
+// ErrInvalidMode неизвестный режим применения списка.
+var ErrInvalidMode = errors.New("invalid policy mode")
+
+// ParseMode разбирает режим применения списка.
+func ParseMode(value string) (Mode, error) {
+	switch mode := Mode(strings.ToLower(strings.TrimSpace(value))); mode {
+	case ModeBlock, ModeAllow:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("%w: %q", ErrInvalidMode, value)
+	}
+}
+
+// Policy список доменов, перечитываемый из файла при его изменении.
+// Нулевой Policy и Policy без файла разрешают любые адреса.
+type Policy struct {
+	path      string
+	mode      Mode
+	mu        sync.RWMutex
+	modTime   time.Time
+	size      int64
+	exact     map[string]struct{}
+	wildcards []string // суффиксы вида ".example.com"
+}
+
+// New возвращает политику с файлом path. Правила читаются методом Reload.
+func New(path string, mode Mode) *Policy {
+	return &Policy{
+		path:  path,
+		mode:  mode,
+		exact: map[string]struct{}{},
+	}
+}
+
+// Enabled политика задана файлом.
+func (p *Policy) Enabled() bool {
+	return p != nil && p.path != ""
+}
+
+// Reload перечитывает файл, если он изменился с прошлого чтения, и сообщает, были ли обновлены правила.
+// При ошибке чтения остаются прежние правила.
+func (p *Policy) Reload() (bool, error) {
+	if !p.Enabled() {
+		return false, nil
+	}
+
+	info, err := os.Stat(p.path)
+	if err != nil {
+		return false, fmt.Errorf("error getting policy file info %w", err)
+	}
+
+	p.mu.RLock()
+	unchanged := info.ModTime().Equal(p.modTime) && info.Size() == p.size
+	p.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	exact, wildcards, err := readPatterns(p.path)
+	if err != nil {
+		return false, err
+	}
+
+	p.mu.Lock()
+	p.exact, p.wildcards = exact, wildcards
+	p.modTime, p.size = info.ModTime(), info.Size()
+	p.mu.Unlock()
+
+	return true, nil
+}
+
+// Allowed проверяет, что адрес можно сокращать и открывать.
+func (p *Policy) Allowed(rawURL string) bool {
+	if !p.Enabled() {
+		return true
+	}
+
+	host := hostOf(rawURL)
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	matched := host != "" && p.match(host)
+	if p.mode == ModeAllow {
+		return matched
+	}
+	return !matched
+}
+
+func (p *Policy) match(host string) bool {
+	if _, ok := p.exact[host]; ok {
+		return true
+	}
+	for _, suffix := range p.wildcards {
+		if strings.HasSuffix(host, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// readPatterns читает шаблоны доменов из файла.
+func readPatterns(path string) (map[string]struct{}, []string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error opening policy file %w", err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	exact := map[string]struct{}{}
+	wildcards := make([]string, 0)
+
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		pattern := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if pattern == "" || strings.HasPrefix(pattern, "#") {
+			continue
+		}
+		pattern = strings.TrimSuffix(pattern, ".")
+
+		if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+			if suffix == "" || strings.Contains(suffix, "*") {
+				return nil, nil, fmt.Errorf("invalid policy pattern %q on line %d", pattern, line)
+			}
+			wildcards = append(wildcards, "."+suffix)
+			continue
+		}
+		if strings.Contains(pattern, "*") {
+			return nil, nil, fmt.Errorf("invalid policy pattern %q on line %d", pattern, line)
+		}
+		exact[pattern] = struct{}{}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("error reading policy file %w", err)
+	}
+
+	return exact, wildcards, nil
+}
+
+// hostOf домен адреса в нижнем регистре без порта и завершающей точки.
+func hostOf(rawURL string) string {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return ""
+	}
+
+	host := u.Hostname()
+	if host == "" && u.Scheme == "" {
+		// Адрес без схемы: "example.com/path".
+		if u, err = url.Parse("//" + strings.TrimSpace(rawURL)); err != nil {
+			return ""
+		}
+		host = u.Hostname()
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.String()
+	}
+
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
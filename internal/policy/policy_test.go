@@ -0,0 +1,100 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writePolicy(t *testing.T, path string, content string, modTime time.Time) {
+	t.Helper()
+
+	require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+}
+
+func TestParseMode(t *testing.T) {
+	mode, err := ParseMode(" Allow ")
+	assert.NoError(t, err)
+	assert.Equal(t, ModeAllow, mode)
+
+	_, err = ParseMode("deny")
+	assert.ErrorIs(t, err, ErrInvalidMode)
+}
+
+func TestPolicy_Block(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	writePolicy(t, path, "# phishing\nevil.com\n*.Bad.org.\n\n10.0.0.1\n", time.Now().Add(-time.Hour))
+
+	p := New(path, ModeBlock)
+	reloaded, err := p.Reload()
+	require.NoError(t, err)
+	assert.True(t, reloaded)
+
+	tests := map[string]bool{
+		"https://evil.com/login":        false,
+		"https://EVIL.com.:8443/":       false,
+		"https://www.evil.com/":         true,
+		"https://login.bad.org/x":       false,
+		"https://a.b.bad.org":           false,
+		"https://bad.org":               true,
+		"https://notbad.org":            true,
+		"http://10.0.0.1/admin":         false,
+		"evil.com/path":                 false,
+		"https://example.com/?evil.com": true,
+	}
+	for rawURL, want := range tests {
+		assert.Equal(t, want, p.Allowed(rawURL), rawURL)
+	}
+
+	reloaded, err = p.Reload()
+	require.NoError(t, err)
+	assert.False(t, reloaded, "file has not changed")
+
+	writePolicy(t, path, "*.evil.com\n", time.Now())
+	reloaded, err = p.Reload()
+	require.NoError(t, err)
+	assert.True(t, reloaded)
+	assert.True(t, p.Allowed("https://evil.com"))
+	assert.False(t, p.Allowed("https://www.evil.com"))
+	assert.True(t, p.Allowed("https://login.bad.org"))
+
+	// Ошибка в файле не сбрасывает прежние правила.
+	writePolicy(t, path, "ev*l.com\n", time.Now().Add(time.Minute))
+	_, err = p.Reload()
+	assert.Error(t, err)
+	assert.False(t, p.Allowed("https://www.evil.com"))
+}
+
+func TestPolicy_Allow(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "allowlist.txt")
+	writePolicy(t, path, "example.com\n*.example.com\n", time.Now())
+
+	p := New(path, ModeAllow)
+	_, err := p.Reload()
+	require.NoError(t, err)
+
+	assert.True(t, p.Allowed("https://example.com"))
+	assert.True(t, p.Allowed("https://docs.example.com/page"))
+	assert.False(t, p.Allowed("https://example.org"))
+	assert.False(t, p.Allowed("not a url"))
+}
+
+func TestPolicy_Disabled(t *testing.T) {
+	var p *Policy
+	assert.True(t, p.Allowed("https://evil.com"))
+
+	p = New("", ModeAllow)
+	reloaded, err := p.Reload()
+	assert.NoError(t, err)
+	assert.False(t, reloaded)
+	assert.True(t, p.Allowed("https://evil.com"))
+
+	p = New(filepath.Join(t.TempDir(), "missing.txt"), ModeBlock)
+	_, err = p.Reload()
+	assert.Error(t, err)
+}
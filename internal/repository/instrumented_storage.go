@@ -0,0 +1,481 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/Melikhov-p/url-minimise/internal/metrics"
+	"github.com/Melikhov-p/url-minimise/internal/models"
+	"github.com/Melikhov-p/url-minimise/internal/tracing"
+)
+
+// Имена хранилищ в метриках.
+const (
+	memoryBackend   = "memory"
+	fileBackend     = "file"
+	databaseBackend = "database"
+)
+
+// instrumentedStorage хранилище, которое замеряет время и ошибки каждой операции
+// и создаёт для неё спан, если запрос трассируется.
+type instrumentedStorage struct {
+	next    Storage
+	metrics *metrics.Metrics
+	backend string
+}
+
+// instrumentedSaver обёртка хранилища, которому нужен отдельный метод сохранения.
+type instrumentedSaver struct {
+	*instrumentedStorage
+	saver StorageSaver
+}
+
+// instrumentStorage оборачивает хранилище метриками и трассировкой.
+func instrumentStorage(store Storage, backend string, m *metrics.Metrics) Storage {
+	instrumented := &instrumentedStorage{next: store, metrics: m, backend: backend}
+	if saver, ok := store.(StorageSaver); ok {
+		return &instrumentedSaver{instrumentedStorage: instrumented, saver: saver}
+	}
+	return instrumented
+}
+
+// storageOperation начатая операция хранилища.
+type storageOperation struct {
+	start   time.Time
+	storage *instrumentedStorage
+	span    *tracing.Span
+	name    string
+}
+
+// begin начинает операцию name и возвращает контекст с её спаном.
+func (s *instrumentedStorage) begin(ctx context.Context, name string) (context.Context, *storageOperation) {
+	ctx, span := tracing.Start(ctx, "storage."+name)
+	span.SetAttribute("storage.backend", s.backend)
+	return ctx, &storageOperation{start: time.Now(), storage: s, span: span, name: name}
+}
+
+// done завершает операцию, failed — операция завершилась ошибкой.
+func (op *storageOperation) done(failed bool) {
+	op.span.End()
+	op.storage.metrics.ObserveStorage(op.storage.backend, op.name, time.Since(op.start), failed)
+}
+
+// end завершает операцию и возвращает её ошибку без изменений.
+func (op *storageOperation) end(err error) error {
+	op.span.RecordError(err)
+	op.done(err != nil)
+	return err
+}
+
+// Save сохраняет запись.
+func (s *instrumentedSaver) Save(record *models.StorageURL) error {
+	_, op := s.begin(context.Background(), "save")
+	err := s.saver.Save(record)
+	return op.end(err)
+}
+
+// AddURL добавляет URL.
+func (s *instrumentedStorage) AddURL(ctx context.Context, url *models.StorageURL) (string, error) {
+	ctx, op := s.begin(ctx, "add_url")
+	short, err := s.next.AddURL(ctx, url)
+	return short, op.end(err)
+}
+
+// AddURLs добавляет пачку URL.
+func (s *instrumentedStorage) AddURLs(ctx context.Context, urls []*models.StorageURL) error {
+	ctx, op := s.begin(ctx, "add_urls")
+	err := s.next.AddURLs(ctx, urls)
+	return op.end(err)
+}
+
+// GetDeleteTasksWStatus возвращает задачи на удаление со статусом.
+func (s *instrumentedStorage) GetDeleteTasksWStatus(
+	ctx context.Context,
+	status models.DelTaskStatus,
+) ([]*models.DelTask, error) {
+	ctx, op := s.begin(ctx, "get_delete_tasks")
+	tasks, err := s.next.GetDeleteTasksWStatus(ctx, status)
+	return tasks, op.end(err)
+}
+
+// MarkAsDeletedURL помечает URL из задач удалёнными.
+func (s *instrumentedStorage) MarkAsDeletedURL(ctx context.Context, tasks []*models.DelTask) error {
+	ctx, op := s.begin(ctx, "mark_as_deleted")
+	err := s.next.MarkAsDeletedURL(ctx, tasks)
+	return op.end(err)
+}
+
+// UpdateTasksStatus обновляет статус задач.
+func (s *instrumentedStorage) UpdateTasksStatus(
+	ctx context.Context,
+	tasks []*models.DelTask,
+	newStatus models.DelTaskStatus,
+) error {
+	ctx, op := s.begin(ctx, "update_tasks_status")
+	err := s.next.UpdateTasksStatus(ctx, tasks, newStatus)
+	return op.end(err)
+}
+
+// AddDeleteTask добавляет задачу на удаление.
+func (s *instrumentedStorage) AddDeleteTask(shortURL []string, userID int) error {
+	_, op := s.begin(context.Background(), "add_delete_task")
+	err := s.next.AddDeleteTask(shortURL, userID)
+	return op.end(err)
+}
+
+// RestoreURLs восстанавливает удалённые URL.
+func (s *instrumentedStorage) RestoreURLs(
+	ctx context.Context,
+	shortURLs []string,
+	userID int,
+	deletedAfter time.Time,
+) ([]string, error) {
+	ctx, op := s.begin(ctx, "restore_urls")
+	restored, err := s.next.RestoreURLs(ctx, shortURLs, userID, deletedAfter)
+	return restored, op.end(err)
+}
+
+// PurgeDeletedURLs окончательно удаляет URL.
+func (s *instrumentedStorage) PurgeDeletedURLs(ctx context.Context, deletedBefore time.Time) (int, error) {
+	ctx, op := s.begin(ctx, "purge_deleted_urls")
+	purged, err := s.next.PurgeDeletedURLs(ctx, deletedBefore)
+	return purged, op.end(err)
+}
+
+// GetPurgedURLsCount возвращает количество окончательно удалённых URL.
+func (s *instrumentedStorage) GetPurgedURLsCount(ctx context.Context) (int, error) {
+	ctx, op := s.begin(ctx, "get_purged_urls_count")
+	count, err := s.next.GetPurgedURLsCount(ctx)
+	return count, op.end(err)
+}
+
+// GetURL возвращает URL по ключу ссылки.
+func (s *instrumentedStorage) GetURL(ctx context.Context, short string) (*models.StorageURL, error) {
+	ctx, op := s.begin(ctx, "get_url")
+	url, err := s.next.GetURL(ctx, short)
+	return url, op.end(err)
+}
+
+// UpdateURL обновляет настройки URL.
+func (s *instrumentedStorage) UpdateURL(ctx context.Context, url *models.StorageURL) error {
+	ctx, op := s.begin(ctx, "update_url")
+	err := s.next.UpdateURL(ctx, url)
+	return op.end(err)
+}
+
+// SetRedirectRules задаёт правила условного редиректа.
+func (s *instrumentedStorage) SetRedirectRules(
+	ctx context.Context,
+	shortURL string,
+	userID int,
+	rules []models.RedirectRule,
+) error {
+	ctx, op := s.begin(ctx, "set_redirect_rules")
+	err := s.next.SetRedirectRules(ctx, shortURL, userID, rules)
+	return op.end(err)
+}
+
+// SetVariants задаёт варианты A/B разделения.
+func (s *instrumentedStorage) SetVariants(
+	ctx context.Context,
+	shortURL string,
+	userID int,
+	variants []models.Variant,
+) error {
+	ctx, op := s.begin(ctx, "set_variants")
+	err := s.next.SetVariants(ctx, shortURL, userID, variants)
+	return op.end(err)
+}
+
+// AddVariantHits увеличивает счётчик показов варианта.
+func (s *instrumentedStorage) AddVariantHits(ctx context.Context, shortURL string, variant string, hits int64) error {
+	ctx, op := s.begin(ctx, "add_variant_hits")
+	err := s.next.AddVariantHits(ctx, shortURL, variant, hits)
+	return op.end(err)
+}
+
+// AddDomain регистрирует домен пользователя.
+func (s *instrumentedStorage) AddDomain(ctx context.Context, domain string, userID int) error {
+	ctx, op := s.begin(ctx, "add_domain")
+	err := s.next.AddDomain(ctx, domain, userID)
+	return op.end(err)
+}
+
+// GetDomainOwner возвращает владельца домена.
+func (s *instrumentedStorage) GetDomainOwner(ctx context.Context, domain string) (int, error) {
+	ctx, op := s.begin(ctx, "get_domain_owner")
+	owner, err := s.next.GetDomainOwner(ctx, domain)
+	return owner, op.end(err)
+}
+
+// GetDomains возвращает все зарегистрированные домены.
+func (s *instrumentedStorage) GetDomains(ctx context.Context) (map[string]int, error) {
+	ctx, op := s.begin(ctx, "get_domains")
+	domains, err := s.next.GetDomains(ctx)
+	return domains, op.end(err)
+}
+
+// GetUserDomains возвращает домены пользователя.
+func (s *instrumentedStorage) GetUserDomains(ctx context.Context, userID int) ([]string, error) {
+	ctx, op := s.begin(ctx, "get_user_domains")
+	domains, err := s.next.GetUserDomains(ctx, userID)
+	return domains, op.end(err)
+}
+
+// UpdateQuarantine пересчитывает карантин ссылок.
+func (s *instrumentedStorage) UpdateQuarantine(
+	ctx context.Context,
+	blocked func(originalURL string) bool,
+) (int, int, error) {
+	ctx, op := s.begin(ctx, "update_quarantine")
+	quarantined, released, err := s.next.UpdateQuarantine(ctx, blocked)
+	return quarantined, released, op.end(err)
+}
+
+// GetLinksForHealthCheck возвращает ссылки для проверки доступности.
+func (s *instrumentedStorage) GetLinksForHealthCheck(
+	ctx context.Context,
+	checkedBefore time.Time,
+	limit int,
+) ([]*models.LinkHealth, error) {
+	ctx, op := s.begin(ctx, "get_links_for_health_check")
+	links, err := s.next.GetLinksForHealthCheck(ctx, checkedBefore, limit)
+	return links, op.end(err)
+}
+
+// SaveLinkHealth сохраняет результаты проверки доступности.
+func (s *instrumentedStorage) SaveLinkHealth(ctx context.Context, health []*models.LinkHealth) error {
+	ctx, op := s.begin(ctx, "save_link_health")
+	err := s.next.SaveLinkHealth(ctx, health)
+	return op.end(err)
+}
+
+// GetBrokenLinks возвращает сломанные ссылки пользователя.
+func (s *instrumentedStorage) GetBrokenLinks(ctx context.Context, userID int) ([]*models.LinkHealth, error) {
+	ctx, op := s.begin(ctx, "get_broken_links")
+	links, err := s.next.GetBrokenLinks(ctx, userID)
+	return links, op.end(err)
+}
+
+// AddClicks сохраняет пачку переходов.
+func (s *instrumentedStorage) AddClicks(ctx context.Context, events []*models.ClickEvent) error {
+	ctx, op := s.begin(ctx, "add_clicks")
+	err := s.next.AddClicks(ctx, events)
+	return op.end(err)
+}
+
+// GetClickStats возвращает агрегаты переходов по ссылке.
+func (s *instrumentedStorage) GetClickStats(
+	ctx context.Context,
+	shortURL string,
+	query models.ClickStatsQuery,
+) (*models.ClickStats, error) {
+	ctx, op := s.begin(ctx, "get_click_stats")
+	stats, err := s.next.GetClickStats(ctx, shortURL, query)
+	return stats, op.end(err)
+}
+
+// GetUniqueVisitors возвращает оценку уникальных посетителей сервиса.
+func (s *instrumentedStorage) GetUniqueVisitors(ctx context.Context) (uint64, error) {
+	ctx, op := s.begin(ctx, "get_unique_visitors")
+	visitors, err := s.next.GetUniqueVisitors(ctx)
+	return visitors, op.end(err)
+}
+
+// GetShortURL возвращает короткую ссылку по оригинальному URL.
+func (s *instrumentedStorage) GetShortURL(ctx context.Context, tx *sql.Tx, originalURL string) (string, error) {
+	ctx, op := s.begin(ctx, "get_short_url")
+	short, err := s.next.GetShortURL(ctx, tx, originalURL)
+	return short, op.end(err)
+}
+
+// GetShortURLs возвращает короткие ссылки по оригинальным URL.
+func (s *instrumentedStorage) GetShortURLs(ctx context.Context, originalURLs []string) (map[string]string, error) {
+	ctx, op := s.begin(ctx, "get_short_urls")
+	shortURLs, err := s.next.GetShortURLs(ctx, originalURLs)
+	return shortURLs, op.end(err)
+}
+
+// CheckShort проверяет, занят ли ключ ссылки.
+func (s *instrumentedStorage) CheckShort(ctx context.Context, short string) bool {
+	ctx, op := s.begin(ctx, "check_short")
+	exists := s.next.CheckShort(ctx, short)
+	op.done(false)
+	return exists
+}
+
+// Ping проверяет соединение с хранилищем.
+func (s *instrumentedStorage) Ping(ctx context.Context) error {
+	ctx, op := s.begin(ctx, "ping")
+	err := s.next.Ping(ctx)
+	return op.end(err)
+}
+
+// AddUser создаёт пользователя.
+func (s *instrumentedStorage) AddUser(ctx context.Context) (*models.User, error) {
+	ctx, op := s.begin(ctx, "add_user")
+	user, err := s.next.AddUser(ctx)
+	return user, op.end(err)
+}
+
+// AddAccount создаёт пользователя с аккаунтом.
+func (s *instrumentedStorage) AddAccount(ctx context.Context, account *models.Account) error {
+	ctx, op := s.begin(ctx, "add_account")
+	err := s.next.AddAccount(ctx, account)
+	return op.end(err)
+}
+
+// GetAccount возвращает аккаунт по почте.
+func (s *instrumentedStorage) GetAccount(ctx context.Context, email string) (*models.Account, error) {
+	ctx, op := s.begin(ctx, "get_account")
+	account, err := s.next.GetAccount(ctx, email)
+	return account, op.end(err)
+}
+
+// AddOIDCIdentity привязывает пользователя провайдера OpenID Connect к аккаунту.
+func (s *instrumentedStorage) AddOIDCIdentity(ctx context.Context, identity *models.OIDCIdentity) error {
+	ctx, op := s.begin(ctx, "add_oidc_identity")
+	err := s.next.AddOIDCIdentity(ctx, identity)
+	return op.end(err)
+}
+
+// GetOIDCIdentity возвращает привязку пользователя провайдера OpenID Connect.
+func (s *instrumentedStorage) GetOIDCIdentity(
+	ctx context.Context,
+	issuer, subject string,
+) (*models.OIDCIdentity, error) {
+	ctx, op := s.begin(ctx, "get_oidc_identity")
+	identity, err := s.next.GetOIDCIdentity(ctx, issuer, subject)
+	return identity, op.end(err)
+}
+
+// MergeUsers передаёт данные одного пользователя другому.
+func (s *instrumentedStorage) MergeUsers(ctx context.Context, fromUserID, toUserID int) (int, error) {
+	ctx, op := s.begin(ctx, "merge_users")
+	moved, err := s.next.MergeUsers(ctx, fromUserID, toUserID)
+	return moved, op.end(err)
+}
+
+// AddAPIKey сохраняет ключ API.
+func (s *instrumentedStorage) AddAPIKey(ctx context.Context, key *models.APIKey) error {
+	ctx, op := s.begin(ctx, "add_api_key")
+	err := s.next.AddAPIKey(ctx, key)
+	return op.end(err)
+}
+
+// GetAPIKey возвращает ключ API по идентификатору.
+func (s *instrumentedStorage) GetAPIKey(ctx context.Context, id string) (*models.APIKey, error) {
+	ctx, op := s.begin(ctx, "get_api_key")
+	key, err := s.next.GetAPIKey(ctx, id)
+	return key, op.end(err)
+}
+
+// GetUserAPIKeys возвращает ключи API пользователя.
+func (s *instrumentedStorage) GetUserAPIKeys(ctx context.Context, userID int) ([]*models.APIKey, error) {
+	ctx, op := s.begin(ctx, "get_user_api_keys")
+	keys, err := s.next.GetUserAPIKeys(ctx, userID)
+	return keys, op.end(err)
+}
+
+// DeleteAPIKey удаляет ключ API пользователя.
+func (s *instrumentedStorage) DeleteAPIKey(ctx context.Context, id string, userID int) error {
+	ctx, op := s.begin(ctx, "delete_api_key")
+	err := s.next.DeleteAPIKey(ctx, id, userID)
+	return op.end(err)
+}
+
+// AddRefreshToken сохраняет токен обновления.
+func (s *instrumentedStorage) AddRefreshToken(ctx context.Context, token *models.RefreshToken) error {
+	ctx, op := s.begin(ctx, "add_refresh_token")
+	err := s.next.AddRefreshToken(ctx, token)
+	return op.end(err)
+}
+
+// GetRefreshToken возвращает токен обновления по идентификатору.
+func (s *instrumentedStorage) GetRefreshToken(ctx context.Context, id string) (*models.RefreshToken, error) {
+	ctx, op := s.begin(ctx, "get_refresh_token")
+	token, err := s.next.GetRefreshToken(ctx, id)
+	return token, op.end(err)
+}
+
+// RotateRefreshToken заменяет токен обновления следующим.
+func (s *instrumentedStorage) RotateRefreshToken(ctx context.Context, id string, next *models.RefreshToken) error {
+	ctx, op := s.begin(ctx, "rotate_refresh_token")
+	err := s.next.RotateRefreshToken(ctx, id, next)
+	return op.end(err)
+}
+
+// RevokeRefreshTokens отзывает токены обновления семейства.
+func (s *instrumentedStorage) RevokeRefreshTokens(ctx context.Context, family string) error {
+	ctx, op := s.begin(ctx, "revoke_refresh_tokens")
+	err := s.next.RevokeRefreshTokens(ctx, family)
+	return op.end(err)
+}
+
+// RevokeToken отзывает токен доступа.
+func (s *instrumentedStorage) RevokeToken(ctx context.Context, token *models.RevokedToken) error {
+	ctx, op := s.begin(ctx, "revoke_token")
+	err := s.next.RevokeToken(ctx, token)
+	return op.end(err)
+}
+
+// IsTokenRevoked проверяет, отозван ли токен доступа.
+func (s *instrumentedStorage) IsTokenRevoked(ctx context.Context, id string) (bool, error) {
+	ctx, op := s.begin(ctx, "is_token_revoked")
+	revoked, err := s.next.IsTokenRevoked(ctx, id)
+	return revoked, op.end(err)
+}
+
+// AddSigningKey сохраняет ключ подписи токенов.
+func (s *instrumentedStorage) AddSigningKey(ctx context.Context, key *models.SigningKey) error {
+	ctx, op := s.begin(ctx, "add_signing_key")
+	err := s.next.AddSigningKey(ctx, key)
+	return op.end(err)
+}
+
+// GetSigningKeys возвращает ключи подписи токенов.
+func (s *instrumentedStorage) GetSigningKeys(ctx context.Context) ([]*models.SigningKey, error) {
+	ctx, op := s.begin(ctx, "get_signing_keys")
+	keys, err := s.next.GetSigningKeys(ctx)
+	return keys, op.end(err)
+}
+
+// RetireSigningKey выводит ключ подписи из оборота.
+func (s *instrumentedStorage) RetireSigningKey(ctx context.Context, id string) error {
+	ctx, op := s.begin(ctx, "retire_signing_key")
+	err := s.next.RetireSigningKey(ctx, id)
+	return op.end(err)
+}
+
+// GetURLsByUserID возвращает ссылки пользователя.
+func (s *instrumentedStorage) GetURLsByUserID(ctx context.Context, userID int) ([]*models.StorageURL, error) {
+	ctx, op := s.begin(ctx, "get_urls_by_user")
+	urls, err := s.next.GetURLsByUserID(ctx, userID)
+	return urls, op.end(err)
+}
+
+// Close закрывает хранилище.
+func (s *instrumentedStorage) Close() error {
+	_, op := s.begin(context.Background(), "close")
+	err := s.next.Close()
+	return op.end(err)
+}
+
+// GetServiceStats возвращает агрегаты хранилища для статистики сервиса.
+func (s *instrumentedStorage) GetServiceStats(
+	ctx context.Context,
+	now time.Time,
+	top int,
+) (*models.ServiceStats, error) {
+	ctx, op := s.begin(ctx, "get_service_stats")
+	stats, err := s.next.GetServiceStats(ctx, now, top)
+	return stats, op.end(err)
+}
+
+// GetUsersCount возвращает количество пользователей.
+func (s *instrumentedStorage) GetUsersCount(ctx context.Context) (int, error) {
+	ctx, op := s.begin(ctx, "get_users_count")
+	count, err := s.next.GetUsersCount(ctx)
+	return count, op.end(err)
+}
@@ -3,16 +3,23 @@ package repository
 import (
 	"context"
 	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/Melikhov-p/url-minimise/internal/auth"
 	"github.com/Melikhov-p/url-minimise/internal/config"
+	"github.com/Melikhov-p/url-minimise/internal/metrics"
 	"github.com/Melikhov-p/url-minimise/internal/models"
 	storageConfig "github.com/Melikhov-p/url-minimise/internal/repository/config"
 	fileConfig "github.com/Melikhov-p/url-minimise/internal/repository/file/config"
 	memoryConfig "github.com/Melikhov-p/url-minimise/internal/repository/memory/config"
 	storage2 "github.com/Melikhov-p/url-minimise/internal/storage"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
 )
 
@@ -28,6 +35,8 @@ func TestNewStorage(t *testing.T) {
 		assert.NoError(t, err)
 		assert.NotNil(t, storage)
 		assert.NotEmpty(t, cfg.SecretKey)
+		_, err = cfg.SigningKeys.Signing()
+		assert.NoError(t, err)
 	})
 
 	t.Run("FileStorage", func(t *testing.T) {
@@ -62,6 +71,8 @@ func TestNewStorage(t *testing.T) {
 		assert.NoError(t, err)
 		assert.NotNil(t, storage)
 		assert.NotEmpty(t, cfg.SecretKey)
+		_, err = cfg.SigningKeys.Signing()
+		assert.NoError(t, err)
 	})
 }
 
@@ -96,7 +107,406 @@ func TestRandomString(t *testing.T) {
 	}
 	storage, err := NewStorage(cfg, logger)
 	assert.NoError(t, err)
-	str, err := randomString(context.Background(), 10, storage)
+	str, err := randomString(context.Background(), 10, "", storage)
 	assert.NoError(t, err)
 	assert.Equal(t, 10, len(str))
+
+	str, err = randomString(context.Background(), 10, "go.example.com", storage)
+	assert.NoError(t, err)
+	code, domain := models.SplitLinkKey(str)
+	assert.Equal(t, 10, len(code))
+	assert.Equal(t, "go.example.com", domain)
+}
+
+func TestNewStorage_Instrumented(t *testing.T) {
+	logger := zap.NewNop()
+	cfg := &config.Config{
+		StorageMode: storage2.StorageFromFile,
+		Storage: storageConfig.Config{
+			FileStorage: &fileConfig.Config{
+				FilePath: filepath.Join(t.TempDir(), "storage.txt"),
+			},
+		},
+		Metrics: metrics.New(),
+	}
+
+	storage, err := NewStorage(cfg, logger)
+	require.NoError(t, err)
+	defer func() {
+		_ = storage.Close()
+	}()
+
+	// Обёртка с метриками сохраняет отдельный метод сохранения файлового хранилища.
+	_, ok := storage.(StorageSaver)
+	assert.True(t, ok)
+
+	_, err = storage.GetURL(context.Background(), "missing")
+	assert.Error(t, err)
+
+	rec := httptest.NewRecorder()
+	cfg.Metrics.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", http.NoBody))
+	assert.Contains(t, rec.Body.String(),
+		`shortener_storage_operation_errors_total{backend="file",operation="get_url"} 1`)
+
+	cfg.StorageMode = storage2.BaseStorage
+	storage, err = NewStorage(cfg, logger)
+	require.NoError(t, err)
+	_, ok = storage.(StorageSaver)
+	assert.False(t, ok)
+}
+
+func TestNewStorage_FileAccounts(t *testing.T) {
+	logger := zap.NewNop()
+	cfg := &config.Config{
+		StorageMode: storage2.StorageFromFile,
+		Storage: storageConfig.Config{
+			FileStorage: &fileConfig.Config{
+				FilePath: filepath.Join(t.TempDir(), "storage.txt"),
+			},
+		},
+	}
+	ctx := context.Background()
+
+	storage, err := NewStorage(cfg, logger)
+	require.NoError(t, err)
+
+	anonymous, err := storage.AddUser(ctx)
+	require.NoError(t, err)
+	url := &models.StorageURL{ShortURL: "short", OriginalURL: "https://example.com", UserID: anonymous.ID}
+	_, err = storage.AddURL(ctx, url)
+	require.NoError(t, err)
+	require.NoError(t, storage.(StorageSaver).Save(url))
+
+	account := &models.Account{Email: "user@example.com", PasswordHash: "hash"}
+	require.NoError(t, storage.AddAccount(ctx, account))
+	identity := &models.OIDCIdentity{Issuer: "https://idp", Subject: "42", Email: account.Email, UserID: account.UserID}
+	require.NoError(t, storage.AddOIDCIdentity(ctx, identity))
+	moved, err := storage.MergeUsers(ctx, anonymous.ID, account.UserID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, moved)
+	require.NoError(t, storage.Close())
+
+	// Аккаунты, привязки к провайдеру SSO и перенесённые в аккаунты ссылки переживают перезапуск.
+	storage, err = NewStorage(cfg, logger)
+	require.NoError(t, err)
+	defer func() {
+		_ = storage.Close()
+	}()
+
+	stored, err := storage.GetAccount(ctx, "user@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, account, stored)
+	linked, err := storage.GetOIDCIdentity(ctx, "https://idp", "42")
+	require.NoError(t, err)
+	assert.Equal(t, identity, linked)
+
+	urls, err := storage.GetURLsByUserID(ctx, account.UserID)
+	require.NoError(t, err)
+	require.Len(t, urls, 1)
+	assert.Equal(t, "short", urls[0].ShortURL)
+
+	// Новые пользователи не получают идентификатор аккаунта.
+	user, err := storage.AddUser(ctx)
+	require.NoError(t, err)
+	assert.Greater(t, user.ID, account.UserID)
+}
+
+func TestNewStorage_FileSecretKey(t *testing.T) {
+	logger := zap.NewNop()
+	path := filepath.Join(t.TempDir(), "storage.txt")
+	cfg := &config.Config{
+		StorageMode: storage2.StorageFromFile,
+		Storage:     storageConfig.Config{FileStorage: &fileConfig.Config{FilePath: path}},
+	}
+
+	storage, err := NewStorage(cfg, logger)
+	require.NoError(t, err)
+	require.NoError(t, storage.Close())
+	key := cfg.SecretKey
+	assert.NotEmpty(t, key)
+
+	info, err := os.Stat(path + secretKeyFileSuffix)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	// Ключ, которым хешируются посетители, не меняется после перезапуска.
+	storage, err = NewStorage(cfg, logger)
+	require.NoError(t, err)
+	require.NoError(t, storage.Close())
+	assert.Equal(t, key, cfg.SecretKey)
+}
+
+func TestNewStorage_FileAPIKeys(t *testing.T) {
+	logger := zap.NewNop()
+	cfg := &config.Config{
+		StorageMode: storage2.StorageFromFile,
+		Storage: storageConfig.Config{
+			FileStorage: &fileConfig.Config{
+				FilePath: filepath.Join(t.TempDir(), "storage.txt"),
+			},
+		},
+	}
+	ctx := context.Background()
+
+	storage, err := NewStorage(cfg, logger)
+	require.NoError(t, err)
+	require.NoError(t, storage.AddAPIKey(ctx, &models.APIKey{ID: "kept", UserID: 1, Scopes: []models.APIScope{"read"}}))
+	require.NoError(t, storage.AddAPIKey(ctx, &models.APIKey{ID: "revoked", UserID: 1}))
+	require.NoError(t, storage.DeleteAPIKey(ctx, "revoked", 1))
+	require.NoError(t, storage.Close())
+
+	// Отозванный ключ не возвращается после перезапуска.
+	storage, err = NewStorage(cfg, logger)
+	require.NoError(t, err)
+	defer func() {
+		_ = storage.Close()
+	}()
+
+	keys, err := storage.GetUserAPIKeys(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	assert.Equal(t, "kept", keys[0].ID)
+	assert.Equal(t, []models.APIScope{"read"}, keys[0].Scopes)
+}
+
+func TestNewStorage_FileDomains(t *testing.T) {
+	logger := zap.NewNop()
+	cfg := &config.Config{
+		StorageMode: storage2.StorageFromFile,
+		Storage: storageConfig.Config{
+			FileStorage: &fileConfig.Config{
+				FilePath: filepath.Join(t.TempDir(), "storage.txt"),
+			},
+		},
+	}
+	ctx := context.Background()
+
+	storage, err := NewStorage(cfg, logger)
+	require.NoError(t, err)
+	require.NoError(t, storage.AddDomain(ctx, "go.example.com", 1))
+	require.NoError(t, storage.AddDomain(ctx, "to.example.com", 2))
+	_, err = storage.MergeUsers(ctx, 2, 3)
+	require.NoError(t, err)
+	require.NoError(t, storage.Close())
+
+	// Домены без ссылок и переданные при слиянии пользователей переживают перезапуск.
+	storage, err = NewStorage(cfg, logger)
+	require.NoError(t, err)
+	defer func() {
+		_ = storage.Close()
+	}()
+
+	domains, err := storage.GetDomains(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"go.example.com": 1, "to.example.com": 3}, domains)
+	assert.ErrorIs(t, storage.AddDomain(ctx, "go.example.com", 3), storage2.ErrDomainExist)
+}
+
+func TestNewStorage_FileVariantHits(t *testing.T) {
+	logger := zap.NewNop()
+	cfg := &config.Config{
+		StorageMode: storage2.StorageFromFile,
+		Storage: storageConfig.Config{
+			FileStorage: &fileConfig.Config{
+				FilePath: filepath.Join(t.TempDir(), "storage.txt"),
+			},
+		},
+	}
+	ctx := context.Background()
+
+	storage, err := NewStorage(cfg, logger)
+	require.NoError(t, err)
+	saver, ok := storage.(StorageSaver)
+	require.True(t, ok)
+	url := &models.StorageURL{
+		ShortURL:    "split",
+		OriginalURL: "https://example.com/a",
+		UserID:      1,
+		Variants: []models.Variant{
+			{Name: "a", Destination: "https://example.com/a", Weight: 1},
+			{Name: "b", Destination: "https://example.com/b", Weight: 1},
+		},
+	}
+	_, err = storage.AddURL(ctx, url)
+	require.NoError(t, err)
+	require.NoError(t, saver.Save(url))
+	require.NoError(t, storage.AddVariantHits(ctx, "split", "a", 3))
+	require.NoError(t, storage.AddVariantHits(ctx, "split", "b", 1))
+	require.NoError(t, storage.AddVariantHits(ctx, "split", "a", 2))
+	require.NoError(t, storage.Close())
+
+	// Показы вариантов переживают перезапуск.
+	storage, err = NewStorage(cfg, logger)
+	require.NoError(t, err)
+	defer func() {
+		_ = storage.Close()
+	}()
+
+	stored, err := storage.GetURL(ctx, "split")
+	require.NoError(t, err)
+	require.Len(t, stored.Variants, 2)
+	assert.Equal(t, int64(5), stored.Variants[0].Hits)
+	assert.Equal(t, int64(1), stored.Variants[1].Hits)
+}
+
+func TestNewStorage_FileRestoreAndPurge(t *testing.T) {
+	logger := zap.NewNop()
+	cfg := &config.Config{
+		StorageMode: storage2.StorageFromFile,
+		Storage: storageConfig.Config{
+			FileStorage: &fileConfig.Config{
+				FilePath: filepath.Join(t.TempDir(), "storage.txt"),
+			},
+		},
+	}
+	ctx := context.Background()
+
+	storage, err := NewStorage(cfg, logger)
+	require.NoError(t, err)
+	saver, ok := storage.(StorageSaver)
+	require.True(t, ok)
+	for _, short := range []string{"restored", "purged", "pending"} {
+		url := &models.StorageURL{ShortURL: short, OriginalURL: "https://example.com/" + short, UserID: 1}
+		_, err = storage.AddURL(ctx, url)
+		require.NoError(t, err)
+		require.NoError(t, saver.Save(url))
+	}
+
+	require.NoError(t, storage.AddDeleteTask([]string{"restored", "purged"}, 1))
+	tasks, err := storage.GetDeleteTasksWStatus(ctx, models.Registered)
+	require.NoError(t, err)
+	require.NoError(t, storage.MarkAsDeletedURL(ctx, tasks))
+	require.NoError(t, storage.UpdateTasksStatus(ctx, tasks, models.Done))
+
+	// Восстановление отменяет задачу на удаление, которую воркер ещё не выполнил.
+	require.NoError(t, storage.AddDeleteTask([]string{"pending"}, 1))
+	restored, err := storage.RestoreURLs(ctx, []string{"restored", "pending"}, 1, time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"restored", "pending"}, restored)
+	tasks, err = storage.GetDeleteTasksWStatus(ctx, models.Registered)
+	require.NoError(t, err)
+	assert.Empty(t, tasks)
+
+	purged, err := storage.PurgeDeletedURLs(ctx, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 1, purged)
+	require.NoError(t, storage.Close())
+
+	// Восстановление и окончательное удаление переживают перезапуск.
+	storage, err = NewStorage(cfg, logger)
+	require.NoError(t, err)
+	defer func() {
+		_ = storage.Close()
+	}()
+
+	for _, short := range []string{"restored", "pending"} {
+		url, err := storage.GetURL(ctx, short)
+		require.NoError(t, err)
+		assert.False(t, url.DeletedFlag)
+	}
+	_, err = storage.GetURL(ctx, "purged")
+	assert.ErrorIs(t, err, storage2.ErrNotFound)
+}
+
+func TestNewStorage_FileRefreshTokens(t *testing.T) {
+	logger := zap.NewNop()
+	cfg := &config.Config{
+		StorageMode: storage2.StorageFromFile,
+		Storage: storageConfig.Config{
+			FileStorage: &fileConfig.Config{
+				FilePath: filepath.Join(t.TempDir(), "storage.txt"),
+			},
+		},
+	}
+	ctx := context.Background()
+	now := time.Now()
+
+	storage, err := NewStorage(cfg, logger)
+	require.NoError(t, err)
+	first := &models.RefreshToken{ID: "a", Family: "a", UserID: 1, ExpiresAt: now.Add(time.Hour)}
+	require.NoError(t, storage.AddRefreshToken(ctx, first))
+	require.NoError(t, storage.RotateRefreshToken(ctx, "a",
+		&models.RefreshToken{ID: "b", Family: "a", UserID: 1, ExpiresAt: now.Add(time.Hour)}))
+	require.NoError(t, storage.AddRefreshToken(ctx,
+		&models.RefreshToken{ID: "c", Family: "c", UserID: 2, ExpiresAt: now.Add(time.Hour)}))
+	require.NoError(t, storage.RevokeRefreshTokens(ctx, "c"))
+	require.NoError(t, storage.AddRefreshToken(ctx,
+		&models.RefreshToken{ID: "old", Family: "old", UserID: 3, ExpiresAt: now.Add(-time.Minute)}))
+	require.NoError(t, storage.Close())
+
+	// После перезапуска действует последнее состояние токенов, истёкшие токены не загружаются.
+	storage, err = NewStorage(cfg, logger)
+	require.NoError(t, err)
+	defer func() {
+		_ = storage.Close()
+	}()
+
+	token, err := storage.GetRefreshToken(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, "b", token.ReplacedBy)
+	token, err = storage.GetRefreshToken(ctx, "b")
+	require.NoError(t, err)
+	assert.True(t, token.Active(now))
+	token, err = storage.GetRefreshToken(ctx, "c")
+	require.NoError(t, err)
+	assert.NotNil(t, token.RevokedAt)
+	_, err = storage.GetRefreshToken(ctx, "old")
+	assert.ErrorIs(t, err, storage2.ErrNotFound)
+}
+
+func TestNewStorage_FileSigningKey(t *testing.T) {
+	logger := zap.NewNop()
+	dir := t.TempDir()
+	newConfig := func() *config.Config {
+		return &config.Config{
+			StorageMode:      storage2.StorageFromFile,
+			SigningAlgorithm: auth.AlgRS256,
+			SigningKeyFile:   filepath.Join(dir, "signing.pem"),
+			Storage: storageConfig.Config{
+				FileStorage: &fileConfig.Config{
+					FilePath: filepath.Join(dir, "storage.txt"),
+				},
+			},
+		}
+	}
+	ctx := context.Background()
+
+	// При первом запуске ключ создаётся и сохраняется в файл.
+	cfg := newConfig()
+	storage, err := NewStorage(cfg, logger)
+	require.NoError(t, err)
+	first, err := cfg.SigningKeys.Signing()
+	require.NoError(t, err)
+	assert.Equal(t, auth.AlgRS256, first.Algorithm)
+	info, err := os.Stat(cfg.SigningKeyFile)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	token, err := auth.BuildJWTString(1, cfg.SigningKeys, time.Hour)
+	require.NoError(t, err)
+	revoked, err := auth.BuildJWTString(2, cfg.SigningKeys, time.Hour)
+	require.NoError(t, err)
+	identity, err := auth.ParseToken(revoked, cfg.SigningKeys)
+	require.NoError(t, err)
+	require.NoError(t, storage.RevokeToken(ctx,
+		&models.RevokedToken{ID: identity.ID, ExpiresAt: identity.ExpiresAt}))
+	require.NoError(t, storage.Close())
+
+	// После перезапуска ключ читается из файла, и выданные токены и их отзыв остаются в силе.
+	cfg = newConfig()
+	storage, err = NewStorage(cfg, logger)
+	require.NoError(t, err)
+	defer func() {
+		_ = storage.Close()
+	}()
+
+	signing, err := cfg.SigningKeys.Signing()
+	require.NoError(t, err)
+	assert.Equal(t, first.ID, signing.ID)
+	userID, err := auth.GetUserID(token, cfg.SigningKeys)
+	require.NoError(t, err)
+	assert.Equal(t, 1, userID)
+	isRevoked, err := storage.IsTokenRevoked(ctx, identity.ID)
+	require.NoError(t, err)
+	assert.True(t, isRevoked)
 }
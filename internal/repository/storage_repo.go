@@ -5,8 +5,13 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/Melikhov-p/url-minimise/internal/auth"
 	"github.com/Melikhov-p/url-minimise/internal/config"
@@ -25,14 +30,51 @@ type Storage interface {
 	MarkAsDeletedURL(ctx context.Context, tasks []*models.DelTask) error
 	UpdateTasksStatus(ctx context.Context, tasks []*models.DelTask, newStatus models.DelTaskStatus) error
 	AddDeleteTask(shortURL []string, userID int) error
+	RestoreURLs(ctx context.Context, shortURLs []string, userID int, deletedAfter time.Time) ([]string, error)
+	PurgeDeletedURLs(ctx context.Context, deletedBefore time.Time) (int, error)
+	GetPurgedURLsCount(ctx context.Context) (int, error)
 	GetURL(context.Context, string) (*models.StorageURL, error)
+	UpdateURL(ctx context.Context, url *models.StorageURL) error
+	SetRedirectRules(ctx context.Context, shortURL string, userID int, rules []models.RedirectRule) error
+	SetVariants(ctx context.Context, shortURL string, userID int, variants []models.Variant) error
+	AddVariantHits(ctx context.Context, shortURL string, variant string, hits int64) error
+	AddDomain(ctx context.Context, domain string, userID int) error
+	GetDomainOwner(ctx context.Context, domain string) (int, error)
+	GetDomains(ctx context.Context) (map[string]int, error)
+	GetUserDomains(ctx context.Context, userID int) ([]string, error)
+	UpdateQuarantine(ctx context.Context, blocked func(originalURL string) bool) (int, int, error)
+	GetLinksForHealthCheck(ctx context.Context, checkedBefore time.Time, limit int) ([]*models.LinkHealth, error)
+	SaveLinkHealth(ctx context.Context, health []*models.LinkHealth) error
+	GetBrokenLinks(ctx context.Context, userID int) ([]*models.LinkHealth, error)
+	AddClicks(ctx context.Context, events []*models.ClickEvent) error
+	GetClickStats(ctx context.Context, shortURL string, query models.ClickStatsQuery) (*models.ClickStats, error)
+	GetUniqueVisitors(ctx context.Context) (uint64, error)
 	GetShortURL(context.Context, *sql.Tx, string) (string, error)
+	GetShortURLs(ctx context.Context, originalURLs []string) (map[string]string, error)
 	CheckShort(context.Context, string) bool
 	Ping(context.Context) error
 	AddUser(ctx context.Context) (*models.User, error)
+	AddAccount(ctx context.Context, account *models.Account) error
+	GetAccount(ctx context.Context, email string) (*models.Account, error)
+	AddOIDCIdentity(ctx context.Context, identity *models.OIDCIdentity) error
+	GetOIDCIdentity(ctx context.Context, issuer, subject string) (*models.OIDCIdentity, error)
+	MergeUsers(ctx context.Context, fromUserID, toUserID int) (int, error)
+	AddAPIKey(ctx context.Context, key *models.APIKey) error
+	GetAPIKey(ctx context.Context, id string) (*models.APIKey, error)
+	GetUserAPIKeys(ctx context.Context, userID int) ([]*models.APIKey, error)
+	DeleteAPIKey(ctx context.Context, id string, userID int) error
+	AddRefreshToken(ctx context.Context, token *models.RefreshToken) error
+	GetRefreshToken(ctx context.Context, id string) (*models.RefreshToken, error)
+	RotateRefreshToken(ctx context.Context, id string, next *models.RefreshToken) error
+	RevokeRefreshTokens(ctx context.Context, family string) error
+	RevokeToken(ctx context.Context, token *models.RevokedToken) error
+	IsTokenRevoked(ctx context.Context, id string) (bool, error)
+	AddSigningKey(ctx context.Context, key *models.SigningKey) error
+	GetSigningKeys(ctx context.Context) ([]*models.SigningKey, error)
+	RetireSigningKey(ctx context.Context, id string) error
 	GetURLsByUserID(ctx context.Context, userID int) ([]*models.StorageURL, error)
 	Close() error
-	GetURLsCount(ctx context.Context) (int, error)
+	GetServiceStats(ctx context.Context, now time.Time, top int) (*models.ServiceStats, error)
 	GetUsersCount(ctx context.Context) (int, error)
 }
 
@@ -51,7 +93,7 @@ func NewStorage(cfg *config.Config, _ *zap.Logger) (Storage, error) {
 			return nil, fmt.Errorf("error generating secret key for storage %w", err)
 		}
 		cfg.SecretKey = key
-		return storage.NewMemoryStorage(), nil
+		return withSigningKeys(instrumentStorage(storage.NewMemoryStorage(), memoryBackend, cfg.Metrics), cfg)
 	case storage.StorageFromFile:
 		file, err := os.OpenFile(cfg.Storage.FileStorage.FilePath, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o666)
 		if err != nil {
@@ -61,13 +103,13 @@ func NewStorage(cfg *config.Config, _ *zap.Logger) (Storage, error) {
 		scan := bufio.NewScanner(file)
 
 		store := &storage.FileStorage{
-			MemoryStorage: *storage.NewMemoryStorage(),
+			MemoryStorage: storage.NewMemoryStorage(),
 			File:          file,
 			Encoder:       json.NewEncoder(file),
 		}
 
-		var element models.StorageURL
 		for scan.Scan() {
+			var element models.StorageURL
 			err = json.Unmarshal(scan.Bytes(), &element)
 			if err != nil {
 				return nil, fmt.Errorf("error unmarshal url from model %w", err)
@@ -75,12 +117,36 @@ func NewStorage(cfg *config.Config, _ *zap.Logger) (Storage, error) {
 			store.SetInMemory(element.ShortURL, &element)
 		}
 
-		key, err := auth.GenerateAuthKey()
+		if err = openClickFile(store, cfg.Storage.FileStorage.FilePath+clickFileSuffix); err != nil {
+			return nil, err
+		}
+		if err = openAccountFile(store, cfg.Storage.FileStorage.FilePath+accountFileSuffix); err != nil {
+			return nil, err
+		}
+		if err = openAPIKeyFile(store, cfg.Storage.FileStorage.FilePath+apiKeyFileSuffix); err != nil {
+			return nil, err
+		}
+		if err = openIdentityFile(store, cfg.Storage.FileStorage.FilePath+identityFileSuffix); err != nil {
+			return nil, err
+		}
+		if err = openDomainFile(store, cfg.Storage.FileStorage.FilePath+domainFileSuffix); err != nil {
+			return nil, err
+		}
+		if err = openRefreshFile(store, cfg.Storage.FileStorage.FilePath+refreshFileSuffix); err != nil {
+			return nil, err
+		}
+		if err = openRevokedFile(store, cfg.Storage.FileStorage.FilePath+revokedFileSuffix); err != nil {
+			return nil, err
+		}
+
+		// Ключ хранится рядом с файлом: хеши посетителей в сохранённых переходах должны совпадать
+		// с хешами после перезапуска, иначе уникальные посетители будут посчитаны дважды.
+		key, err := loadSecretKeyFile(cfg.Storage.FileStorage.FilePath + secretKeyFileSuffix)
 		if err != nil {
-			return nil, fmt.Errorf("error generating secret key for storage %w", err)
+			return nil, err
 		}
 		cfg.SecretKey = key
-		return store, nil
+		return withSigningKeys(instrumentStorage(store, fileBackend, cfg.Metrics), cfg)
 	case storage.StorageInDatabase:
 		db, err := sql.Open("pgx", cfg.Storage.Database.DSN)
 
@@ -107,12 +173,349 @@ func NewStorage(cfg *config.Config, _ *zap.Logger) (Storage, error) {
 		}
 		cfg.SecretKey = key
 
-		return store, nil
+		return withSigningKeys(instrumentStorage(store, databaseBackend, cfg.Metrics), cfg)
 	}
 
 	return nil, fmt.Errorf("unknow type of store %d", cfg.StorageMode)
 }
 
+// signingKeysLoadTimeout сколько ждать хранилище, когда ключи перечитываются из-за токена с неизвестным kid.
+const signingKeysLoadTimeout = 5 * time.Second
+
+// withSigningKeys загружает ключи подписи токенов из хранилища в cfg.SigningKeys. Ключ из файла
+// cfg.SigningKeyFile добавляется в хранилище при первом запуске с ним и начинает подписывать токены.
+// Если действующих ключей нет или самый новый ключ другого алгоритма, выпускается новый.
+// В памяти и в файловом режиме выпущенные ключи не сохраняются между запусками, сохраняется только
+// ключ из файла PEM.
+func withSigningKeys(store Storage, cfg *config.Config) (Storage, error) {
+	ctx := context.Background()
+	if cfg.SigningKeys == nil {
+		cfg.SigningKeys = auth.NewKeyring()
+	}
+	if cfg.SigningAlgorithm == "" {
+		cfg.SigningAlgorithm = auth.AlgHS256
+	}
+
+	keys, err := store.GetSigningKeys(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error getting signing keys %w", err)
+	}
+
+	if cfg.SigningKeyFile != "" {
+		var key *models.SigningKey
+		if key, err = loadSigningKeyFile(cfg.SigningKeyFile, cfg.SigningAlgorithm); err != nil {
+			return nil, err
+		}
+		cfg.SigningAlgorithm = key.Algorithm
+		if !slices.ContainsFunc(keys, func(stored *models.SigningKey) bool { return stored.ID == key.ID }) {
+			if err = store.AddSigningKey(ctx, key); err != nil {
+				return nil, fmt.Errorf("error saving signing key %w", err)
+			}
+			keys = append(keys, key)
+		}
+	}
+
+	if err = cfg.SigningKeys.Set(keys); err != nil {
+		return nil, fmt.Errorf("error loading signing keys %w", err)
+	}
+	cfg.SigningKeys.SetLoader(func() ([]*models.SigningKey, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), signingKeysLoadTimeout)
+		defer cancel()
+		keys, err := store.GetSigningKeys(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error getting signing keys %w", err)
+		}
+		return keys, nil
+	})
+	if signing, err := cfg.SigningKeys.Signing(); err == nil && signing.Algorithm == cfg.SigningAlgorithm {
+		return store, nil
+	}
+
+	key, err := auth.NewSigningKey(cfg.SigningAlgorithm)
+	if err != nil {
+		return nil, fmt.Errorf("error generating signing key %w", err)
+	}
+	if err = store.AddSigningKey(ctx, key); err != nil {
+		return nil, fmt.Errorf("error saving signing key %w", err)
+	}
+	if err = cfg.SigningKeys.Set(append(keys, key)); err != nil {
+		return nil, fmt.Errorf("error loading signing keys %w", err)
+	}
+	return store, nil
+}
+
+// loadSigningKeyFile читает закрытый ключ подписи RS256 или EdDSA из файла PEM. Если файла нет,
+// создаёт ключ алгоритма alg и сохраняет его в файл, чтобы после перезапуска выданные токены
+// и опубликованные открытые ключи остались прежними.
+func loadSigningKeyFile(path string, alg string) (*models.SigningKey, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		data, err = createSigningKeyFile(path, alg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading signing key file %w", err)
+	}
+
+	key, err := auth.SigningKeyFromPEM(data)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing signing key file %w", err)
+	}
+	return key, nil
+}
+
+// createSigningKeyFile создаёт ключ алгоритма alg и записывает его в новый файл path.
+func createSigningKeyFile(path string, alg string) ([]byte, error) {
+	if alg == auth.AlgHS256 {
+		return nil, fmt.Errorf("signing key file needs %s or %s algorithm", auth.AlgRS256, auth.AlgEdDSA)
+	}
+	key, err := auth.NewSigningKey(alg)
+	if err != nil {
+		return nil, fmt.Errorf("error generating signing key %w", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("error creating signing key file %w", err)
+	}
+	if _, err = file.WriteString(key.Secret); err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("error writing signing key file %w", err)
+	}
+	if err = file.Close(); err != nil {
+		return nil, fmt.Errorf("error closing signing key file %w", err)
+	}
+	return []byte(key.Secret), nil
+}
+
+// secretKeyFileSuffix суффикс файла секретного ключа рядом с файлом хранилища.
+const secretKeyFileSuffix = ".secret"
+
+// loadSecretKeyFile читает секретный ключ из файла path. Если файла нет, создаёт ключ и сохраняет его в файл.
+func loadSecretKeyFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		data, err = createSecretKeyFile(path)
+	}
+	if err != nil {
+		return "", fmt.Errorf("error reading secret key file %w", err)
+	}
+
+	key := strings.TrimSpace(string(data))
+	if key == "" {
+		return "", fmt.Errorf("secret key file %s is empty", path)
+	}
+	return key, nil
+}
+
+// createSecretKeyFile создаёт секретный ключ и записывает его в новый файл path.
+func createSecretKeyFile(path string) ([]byte, error) {
+	key, err := auth.GenerateAuthKey()
+	if err != nil {
+		return nil, fmt.Errorf("error generating secret key for storage %w", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("error creating secret key file %w", err)
+	}
+	if _, err = file.WriteString(key); err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("error writing secret key file %w", err)
+	}
+	if err = file.Close(); err != nil {
+		return nil, fmt.Errorf("error closing secret key file %w", err)
+	}
+	return []byte(key), nil
+}
+
+// clickFileSuffix суффикс файла событий переходов рядом с файлом хранилища.
+const clickFileSuffix = ".clicks"
+
+// openClickFile открыть файл событий переходов и загрузить сохранённые события.
+func openClickFile(store *storage.FileStorage, path string) error {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o666)
+	if err != nil {
+		return fmt.Errorf("error opening click events file %w", err)
+	}
+
+	var events []*models.ClickEvent
+	scan := bufio.NewScanner(file)
+	for scan.Scan() {
+		var event models.ClickEvent
+		if err = json.Unmarshal(scan.Bytes(), &event); err != nil {
+			return fmt.Errorf("error unmarshal click event %w", err)
+		}
+		events = append(events, &event)
+	}
+	if err = scan.Err(); err != nil {
+		return fmt.Errorf("error reading click events file %w", err)
+	}
+
+	store.SetClicksInMemory(events)
+	store.ClickFile = file
+	store.ClickEncoder = json.NewEncoder(file)
+	return nil
+}
+
+// accountFileSuffix суффикс файла аккаунтов рядом с файлом хранилища.
+const accountFileSuffix = ".accounts"
+
+// openAccountFile открыть файл аккаунтов и загрузить сохранённые аккаунты.
+func openAccountFile(store *storage.FileStorage, path string) error {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("error opening accounts file %w", err)
+	}
+
+	scan := bufio.NewScanner(file)
+	for scan.Scan() {
+		var account models.Account
+		if err = json.Unmarshal(scan.Bytes(), &account); err != nil {
+			return fmt.Errorf("error unmarshal account %w", err)
+		}
+		store.SetAccountInMemory(&account)
+	}
+	if err = scan.Err(); err != nil {
+		return fmt.Errorf("error reading accounts file %w", err)
+	}
+
+	store.AccountFile = file
+	store.AccountEncoder = json.NewEncoder(file)
+	return nil
+}
+
+// identityFileSuffix суффикс файла пользователей провайдера OpenID Connect рядом с файлом хранилища.
+const identityFileSuffix = ".identities"
+
+// openIdentityFile открыть файл пользователей провайдера OpenID Connect и загрузить сохранённые привязки.
+func openIdentityFile(store *storage.FileStorage, path string) error {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("error opening oidc identities file %w", err)
+	}
+
+	scan := bufio.NewScanner(file)
+	for scan.Scan() {
+		var identity models.OIDCIdentity
+		if err = json.Unmarshal(scan.Bytes(), &identity); err != nil {
+			return fmt.Errorf("error unmarshal oidc identity %w", err)
+		}
+		store.SetOIDCIdentityInMemory(&identity)
+	}
+	if err = scan.Err(); err != nil {
+		return fmt.Errorf("error reading oidc identities file %w", err)
+	}
+
+	store.IdentityFile = file
+	store.IdentityEncoder = json.NewEncoder(file)
+	return nil
+}
+
+// apiKeyFileSuffix суффикс файла ключей API рядом с файлом хранилища.
+const apiKeyFileSuffix = ".apikeys"
+
+// openAPIKeyFile открыть файл ключей API и загрузить сохранённые ключи.
+func openAPIKeyFile(store *storage.FileStorage, path string) error {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("error opening api keys file %w", err)
+	}
+
+	scan := bufio.NewScanner(file)
+	for scan.Scan() {
+		var key models.APIKey
+		if err = json.Unmarshal(scan.Bytes(), &key); err != nil {
+			return fmt.Errorf("error unmarshal api key %w", err)
+		}
+		store.SetAPIKeyInMemory(&key)
+	}
+	if err = scan.Err(); err != nil {
+		return fmt.Errorf("error reading api keys file %w", err)
+	}
+
+	store.APIKeyFile = file
+	return nil
+}
+
+// domainFileSuffix суффикс файла дополнительных доменов рядом с файлом хранилища.
+const domainFileSuffix = ".domains"
+
+// openDomainFile открыть файл дополнительных доменов и загрузить зарегистрированные домены.
+func openDomainFile(store *storage.FileStorage, path string) error {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("error opening domains file %w", err)
+	}
+
+	scan := bufio.NewScanner(file)
+	for scan.Scan() {
+		var domain models.ShortDomain
+		if err = json.Unmarshal(scan.Bytes(), &domain); err != nil {
+			return fmt.Errorf("error unmarshal domain %w", err)
+		}
+		store.SetDomainInMemory(&domain)
+	}
+	if err = scan.Err(); err != nil {
+		return fmt.Errorf("error reading domains file %w", err)
+	}
+
+	store.DomainFile = file
+	return nil
+}
+
+// refreshFileSuffix суффикс файла токенов обновления рядом с файлом хранилища.
+const refreshFileSuffix = ".sessions"
+
+// openRefreshFile открыть файл токенов обновления, загрузить сохранённые токены
+// и перезаписать файл без истёкших токенов.
+func openRefreshFile(store *storage.FileStorage, path string) error {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("error opening refresh tokens file %w", err)
+	}
+
+	scan := bufio.NewScanner(file)
+	for scan.Scan() {
+		var token models.RefreshToken
+		if err = json.Unmarshal(scan.Bytes(), &token); err != nil {
+			return fmt.Errorf("error unmarshal refresh token %w", err)
+		}
+		store.SetRefreshTokenInMemory(&token)
+	}
+	if err = scan.Err(); err != nil {
+		return fmt.Errorf("error reading refresh tokens file %w", err)
+	}
+
+	store.RefreshFile = file
+	return store.CompactRefreshTokens(time.Now())
+}
+
+// revokedFileSuffix суффикс файла отозванных токенов доступа рядом с файлом хранилища.
+const revokedFileSuffix = ".revoked"
+
+// openRevokedFile открыть файл отозванных токенов доступа и загрузить записи, срок которых не истёк.
+func openRevokedFile(store *storage.FileStorage, path string) error {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("error opening revoked tokens file %w", err)
+	}
+
+	scan := bufio.NewScanner(file)
+	for scan.Scan() {
+		var token models.RevokedToken
+		if err = json.Unmarshal(scan.Bytes(), &token); err != nil {
+			return fmt.Errorf("error unmarshal revoked token %w", err)
+		}
+		store.SetRevokedTokenInMemory(&token)
+	}
+	if err = scan.Err(); err != nil {
+		return fmt.Errorf("error reading revoked tokens file %w", err)
+	}
+
+	store.RevokedFile = file
+	return store.CompactRevokedTokens(time.Now())
+}
+
 func makeMigrations(cfg *config.Config, db *sql.DB) error {
 	var err error
 
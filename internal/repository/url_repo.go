@@ -16,7 +16,15 @@ func NewStorageURL(ctx context.Context,
 	fullURL string, s Storage,
 	cfg *config.Config,
 	userID int) (*models.StorageURL, error) {
-	short, err := randomString(ctx, cfg.ShortURLSize, s)
+	return NewStorageURLOnDomain(ctx, fullURL, "", s, cfg, userID)
+}
+
+// NewStorageURLOnDomain новый адрес для хранилища на заданном домене, пустой домен — основной.
+func NewStorageURLOnDomain(ctx context.Context,
+	fullURL string, domain string, s Storage,
+	cfg *config.Config,
+	userID int) (*models.StorageURL, error) {
+	short, err := randomString(ctx, cfg.ShortURLSize, domain, s)
 
 	if err == nil {
 		return &models.StorageURL{
@@ -24,6 +32,7 @@ func NewStorageURL(ctx context.Context,
 			OriginalURL: fullURL,
 			UserID:      userID,
 			DeletedFlag: false,
+			CreatedAt:   time.Now(),
 		}, nil
 	}
 	return nil, err
@@ -39,7 +48,7 @@ func NewStorageMultiURL(
 	newURLs := make([]*models.StorageURL, 0, len(fullURLs))
 
 	for _, url := range fullURLs {
-		short, err := randomString(ctx, cfg.ShortURLSize, s)
+		short, err := randomString(ctx, cfg.ShortURLSize, "", s)
 		if err != nil {
 			return nil, fmt.Errorf("error creating random string %w", err)
 		}
@@ -47,14 +56,15 @@ func NewStorageMultiURL(
 			ShortURL:    short,
 			OriginalURL: url,
 			UserID:      userID,
+			CreatedAt:   time.Now(),
 		})
 	}
 
 	return newURLs, nil
 }
 
-// Создает рандомную строку заданного размера.
-func randomString(ctx context.Context, size int, s Storage) (string, error) {
+// Создает рандомную строку заданного размера, уникальную в пределах домена, и возвращает ключ ссылки.
+func randomString(ctx context.Context, size int, domain string, s Storage) (string, error) {
 	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
 	tries := 5 // количество попыток создать уникальную строку
 
@@ -67,7 +77,7 @@ func randomString(ctx context.Context, size int, s Storage) (string, error) {
 		for i := range b {
 			b[i] = chars[rnd.Intn(len(chars))]
 		}
-		str := string(b)
+		str := models.LinkKey(string(b), domain)
 		time.Sleep(1 * time.Nanosecond) // Иначе в batch есть шанс два одинаковых сгенерить
 		if ok := s.CheckShort(ctx, str); !ok {
 			return str, nil
@@ -0,0 +1,165 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Melikhov-p/url-minimise/internal/config"
+	"github.com/Melikhov-p/url-minimise/internal/models"
+	"github.com/Melikhov-p/url-minimise/internal/repository"
+	storagePkg "github.com/Melikhov-p/url-minimise/internal/storage"
+	"github.com/Melikhov-p/url-minimise/internal/tracing"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrInvalidEmail почта аккаунта заполнена неверно.
+var ErrInvalidEmail = errors.New("invalid email")
+
+// ErrWeakPassword пароль короче minPasswordLength символов или длиннее maxPasswordBytes байт.
+var ErrWeakPassword = errors.New("password must be at least 8 characters and at most 72 bytes")
+
+// ErrInvalidCredentials почта или пароль не подходят. Не уточняется, что именно,
+// чтобы по ответу нельзя было узнать, зарегистрирована ли почта.
+var ErrInvalidCredentials = errors.New("invalid email or password")
+
+const (
+	// minPasswordLength минимальная длина пароля в символах.
+	minPasswordLength = 8
+	// maxPasswordBytes bcrypt не принимает пароли длиннее 72 байт.
+	maxPasswordBytes = 72
+	// maxEmailLength ограничение длины адреса из RFC 5321 и колонки email.
+	maxEmailLength = 254
+	// missingAccountHash хеш bcrypt, с которым сравнивается пароль при входе в незарегистрированную почту,
+	// чтобы ответ занимал столько же времени, сколько при неверном пароле.
+	missingAccountHash = "$2a$10$xYmXQBYRspq3Ps6bvNA3Su5cDsG9kHzIPyujPY3C490t5u5XpqkrG"
+)
+
+// SignInFunc регистрация или вход в аккаунт: общая сигнатура Register и Login.
+type SignInFunc func(
+	ctx context.Context,
+	storage repository.Storage,
+	cfg *config.Config,
+	current *models.User,
+	email string,
+	password string,
+) (*models.User, int, error)
+
+// Register зарегистрировать аккаунт с почтой email и паролем password. Если запрос пришёл
+// из анонимной сессии current, её адреса и домены переходят в аккаунт.
+// Возвращает пользователя аккаунта с новым токеном и количество перенесённых адресов.
+func Register(
+	ctx context.Context,
+	storage repository.Storage,
+	cfg *config.Config,
+	current *models.User,
+	email string,
+	password string,
+) (*models.User, int, error) {
+	ctx, span := tracing.Start(ctx, "service.Register")
+	defer span.End()
+
+	email, err := normalizeEmail(email)
+	if err != nil {
+		return nil, 0, err
+	}
+	if utf8.RuneCountInString(password) < minPasswordLength || len(password) > maxPasswordBytes {
+		return nil, 0, ErrWeakPassword
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error hashing password %w", err)
+	}
+
+	account := &models.Account{Email: email, PasswordHash: string(hash)}
+	if err = storage.AddAccount(ctx, account); err != nil {
+		return nil, 0, fmt.Errorf("error adding account %w", err)
+	}
+
+	return signIn(ctx, storage, cfg, current, account)
+}
+
+// Login войти в аккаунт с почтой email. Если запрос пришёл из анонимной сессии current,
+// её адреса и домены переходят в аккаунт.
+// Возвращает пользователя аккаунта с новым токеном и количество перенесённых адресов.
+func Login(
+	ctx context.Context,
+	storage repository.Storage,
+	cfg *config.Config,
+	current *models.User,
+	email string,
+	password string,
+) (*models.User, int, error) {
+	ctx, span := tracing.Start(ctx, "service.Login")
+	defer span.End()
+
+	email, err := normalizeEmail(email)
+	if err != nil {
+		return nil, 0, ErrInvalidCredentials
+	}
+
+	account, err := storage.GetAccount(ctx, email)
+	if errors.Is(err, storagePkg.ErrNotFound) {
+		_ = bcrypt.CompareHashAndPassword([]byte(missingAccountHash), []byte(password))
+		return nil, 0, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("error getting account %w", err)
+	}
+	if account.PasswordHash == "" {
+		// Аккаунт создан входом через SSO и пароля не имеет.
+		_ = bcrypt.CompareHashAndPassword([]byte(missingAccountHash), []byte(password))
+		return nil, 0, ErrInvalidCredentials
+	}
+	if bcrypt.CompareHashAndPassword([]byte(account.PasswordHash), []byte(password)) != nil {
+		return nil, 0, ErrInvalidCredentials
+	}
+
+	return signIn(ctx, storage, cfg, current, account)
+}
+
+// signIn переносит в аккаунт данные анонимной сессии и начинает сессию аккаунта.
+func signIn(
+	ctx context.Context,
+	storage repository.Storage,
+	cfg *config.Config,
+	current *models.User,
+	account *models.Account,
+) (*models.User, int, error) {
+	var merged int
+	if current != nil && current.Service.IsAuthenticated && !current.Registered() && current.ID != account.UserID {
+		var err error
+		merged, err = storage.MergeUsers(ctx, current.ID, account.UserID)
+		if err != nil {
+			return nil, 0, fmt.Errorf("error merging anonymous session into account %w", err)
+		}
+	}
+
+	user := repository.NewEmptyUser()
+	user.ID = account.UserID
+	user.Email = account.Email
+
+	if err := IssueTokens(ctx, storage, cfg, user); err != nil {
+		return nil, 0, fmt.Errorf("error creating tokens for account %w", err)
+	}
+
+	return user, merged, nil
+}
+
+// normalizeEmail проверяет почту и приводит её к нижнему регистру, чтобы одна почта не давала двух аккаунтов.
+func normalizeEmail(raw string) (string, error) {
+	email := strings.ToLower(strings.TrimSpace(raw))
+	if email == "" || len(email) > maxEmailLength {
+		return "", ErrInvalidEmail
+	}
+
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email || addr.Name != "" {
+		return "", ErrInvalidEmail
+	}
+	return email, nil
+}
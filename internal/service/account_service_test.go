@@ -0,0 +1,79 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Melikhov-p/url-minimise/internal/config"
+	"github.com/Melikhov-p/url-minimise/internal/logger"
+	"github.com/Melikhov-p/url-minimise/internal/repository"
+	storagePkg "github.com/Melikhov-p/url-minimise/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegisterLogin(t *testing.T) {
+	log, err := logger.BuildLogger("ERROR")
+	require.NoError(t, err)
+	cfg := config.NewConfig(log, true)
+	cfg.StorageMode = storagePkg.BaseStorage
+	store, err := repository.NewStorage(cfg, log)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	anonymous, err := AddNewUser(ctx, store, cfg)
+	require.NoError(t, err)
+	_, err = AddURL(ctx, store, log, "https://example.com/anonymous", cfg, anonymous.ID)
+	require.NoError(t, err)
+
+	_, _, err = Register(ctx, store, cfg, anonymous, "not an email", "password123")
+	assert.ErrorIs(t, err, ErrInvalidEmail)
+	_, _, err = Register(ctx, store, cfg, anonymous, "User <user@example.com>", "password123")
+	assert.ErrorIs(t, err, ErrInvalidEmail)
+	_, _, err = Register(ctx, store, cfg, anonymous, "user@example.com", "short")
+	assert.ErrorIs(t, err, ErrWeakPassword)
+
+	// Регистрация из анонимной сессии переносит её ссылки в аккаунт.
+	user, merged, err := Register(ctx, store, cfg, anonymous, " User@Example.com ", "password123")
+	require.NoError(t, err)
+	assert.Equal(t, 1, merged)
+	assert.Equal(t, "user@example.com", user.Email)
+	assert.True(t, user.Registered())
+
+	authorized, err := AuthUserByToken(user.Service.Token, store, log, cfg)
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, authorized.ID)
+	assert.Equal(t, "user@example.com", authorized.Email)
+	assert.Len(t, authorized.URLs, 1)
+
+	_, _, err = Register(ctx, store, cfg, nil, "user@example.com", "password456")
+	assert.ErrorIs(t, err, storagePkg.ErrAccountExist)
+
+	_, _, err = Login(ctx, store, cfg, nil, "user@example.com", "wrong password")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	_, _, err = Login(ctx, store, cfg, nil, "missing@example.com", "password123")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+
+	// Вход из другой анонимной сессии тоже переносит её ссылки.
+	other, err := AddNewUser(ctx, store, cfg)
+	require.NoError(t, err)
+	_, err = AddURL(ctx, store, log, "https://example.com/other", cfg, other.ID)
+	require.NoError(t, err)
+
+	loggedIn, merged, err := Login(ctx, store, cfg, other, "USER@example.com", "password123")
+	require.NoError(t, err)
+	assert.Equal(t, 1, merged)
+	assert.Equal(t, user.ID, loggedIn.ID)
+	urls, err := store.GetURLsByUserID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Len(t, urls, 2)
+
+	// Сессия другого аккаунта не сливается.
+	second, _, err := Register(ctx, store, cfg, nil, "second@example.com", "password123")
+	require.NoError(t, err)
+	_, err = AddURL(ctx, store, log, "https://example.com/second", cfg, second.ID)
+	require.NoError(t, err)
+	_, merged, err = Login(ctx, store, cfg, second, "user@example.com", "password123")
+	require.NoError(t, err)
+	assert.Zero(t, merged)
+}
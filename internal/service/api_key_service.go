@@ -0,0 +1,161 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Melikhov-p/url-minimise/internal/auth"
+	"github.com/Melikhov-p/url-minimise/internal/models"
+	"github.com/Melikhov-p/url-minimise/internal/repository"
+	storagePkg "github.com/Melikhov-p/url-minimise/internal/storage"
+	"github.com/Melikhov-p/url-minimise/internal/tracing"
+	"go.uber.org/zap"
+)
+
+// ErrInvalidScope права ключа API не заданы или среди них есть неизвестные.
+var ErrInvalidScope = errors.New("invalid api key scopes")
+
+// ErrInvalidAPIKeyRequest имя ключа API слишком длинное или срок действия уже прошёл.
+var ErrInvalidAPIKeyRequest = errors.New("invalid api key request")
+
+// ErrInvalidAPIKey ключ API не существует, отозван, истёк или не совпадает с сохранённым.
+var ErrInvalidAPIKey = errors.New("invalid api key")
+
+// maxAPIKeyNameLength ограничение длины имени ключа, как у колонки name.
+const maxAPIKeyNameLength = 200
+
+// CreateAPIKey создать ключ API пользователя. Возвращает сохранённый ключ и сам ключ,
+// который больше нигде не хранится и отдаётся пользователю один раз.
+func CreateAPIKey(
+	ctx context.Context,
+	storage repository.Storage,
+	userID int,
+	req models.APIKeyRequest,
+) (*models.APIKey, string, error) {
+	ctx, span := tracing.Start(ctx, "service.CreateAPIKey")
+	defer span.End()
+
+	scopes, err := normalizeScopes(req.Scopes)
+	if err != nil {
+		return nil, "", err
+	}
+	now := time.Now().UTC()
+	if utf8.RuneCountInString(req.Name) > maxAPIKeyNameLength || (req.ExpiresAt != nil && !req.ExpiresAt.After(now)) {
+		return nil, "", ErrInvalidAPIKeyRequest
+	}
+
+	id, rawKey, hash, err := auth.GenerateAPIKey()
+	if err != nil {
+		return nil, "", fmt.Errorf("error generating api key %w", err)
+	}
+
+	key := &models.APIKey{
+		CreatedAt: now,
+		ExpiresAt: req.ExpiresAt,
+		ID:        id,
+		Name:      req.Name,
+		Hash:      hash,
+		Scopes:    scopes,
+		UserID:    userID,
+	}
+	if err = storage.AddAPIKey(ctx, key); err != nil {
+		return nil, "", fmt.Errorf("error saving api key %w", err)
+	}
+
+	return key, rawKey, nil
+}
+
+// GetUserAPIKeys получить ключи API пользователя.
+func GetUserAPIKeys(ctx context.Context, storage repository.Storage, userID int) ([]*models.APIKey, error) {
+	ctx, span := tracing.Start(ctx, "service.GetUserAPIKeys")
+	defer span.End()
+
+	keys, err := storage.GetUserAPIKeys(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting user api keys %w", err)
+	}
+	return keys, nil
+}
+
+// RevokeAPIKey отозвать ключ API пользователя. Запросы с отозванным ключом сразу перестают проходить.
+func RevokeAPIKey(ctx context.Context, storage repository.Storage, userID int, id string) error {
+	ctx, span := tracing.Start(ctx, "service.RevokeAPIKey")
+	defer span.End()
+
+	if err := storage.DeleteAPIKey(ctx, id, userID); err != nil {
+		return fmt.Errorf("error revoking api key %w", err)
+	}
+	return nil
+}
+
+// AuthUserByAPIKey аутентификация по ключу API. Права ключа передаются в пользователе.
+func AuthUserByAPIKey(
+	ctx context.Context,
+	rawKey string,
+	storage repository.Storage,
+	logger *zap.Logger,
+) (*models.User, error) {
+	user := repository.NewEmptyUser()
+
+	id, secret, ok := auth.ParseAPIKey(rawKey)
+	if !ok {
+		return user, ErrInvalidAPIKey
+	}
+
+	key, err := storage.GetAPIKey(ctx, id)
+	if errors.Is(err, storagePkg.ErrNotFound) {
+		return user, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return user, fmt.Errorf("error getting api key %w", err)
+	}
+	if !auth.CheckSecret(secret, key.Hash) || key.Expired(time.Now()) {
+		return user, ErrInvalidAPIKey
+	}
+
+	urls, err := storage.GetURLsByUserID(ctx, key.UserID)
+	if err != nil {
+		logger.Error("error getting urls by user id", zap.Error(err))
+	}
+
+	user.URLs = urls
+	user.ID = key.UserID
+	user.APIKey = key
+	user.Service.IsAuthenticated = true
+	return user, nil
+}
+
+// APIKeyResponse ключ API для ответа клиенту, без хеша.
+func APIKeyResponse(key *models.APIKey) models.APIKeyResponse {
+	return models.APIKeyResponse{
+		CreatedAt: key.CreatedAt,
+		ExpiresAt: key.ExpiresAt,
+		ID:        key.ID,
+		Name:      key.Name,
+		Scopes:    key.Scopes,
+	}
+}
+
+// normalizeScopes проверяет права и возвращает их без повторов в порядке models.APIScopes.
+func normalizeScopes(scopes []models.APIScope) ([]models.APIScope, error) {
+	if len(scopes) == 0 {
+		return nil, ErrInvalidScope
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(models.APIScopes, scope) {
+			return nil, fmt.Errorf("unknown scope %q %w", scope, ErrInvalidScope)
+		}
+	}
+
+	normalized := make([]models.APIScope, 0, len(scopes))
+	for _, scope := range models.APIScopes {
+		if slices.Contains(scopes, scope) {
+			normalized = append(normalized, scope)
+		}
+	}
+	return normalized, nil
+}
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Melikhov-p/url-minimise/internal/config"
+	"github.com/Melikhov-p/url-minimise/internal/logger"
+	"github.com/Melikhov-p/url-minimise/internal/models"
+	"github.com/Melikhov-p/url-minimise/internal/repository"
+	storagePkg "github.com/Melikhov-p/url-minimise/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIKeys(t *testing.T) {
+	log, err := logger.BuildLogger("ERROR")
+	require.NoError(t, err)
+	cfg := config.NewConfig(log, true)
+	cfg.StorageMode = storagePkg.BaseStorage
+	store, err := repository.NewStorage(cfg, log)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	past := time.Now().Add(-time.Minute)
+	for _, req := range []models.APIKeyRequest{
+		{Name: "no scopes"},
+		{Name: "unknown scope", Scopes: []models.APIScope{"admin"}},
+	} {
+		_, _, err = CreateAPIKey(ctx, store, 1, req)
+		assert.ErrorIs(t, err, ErrInvalidScope, req.Name)
+	}
+	_, _, err = CreateAPIKey(ctx, store, 1, models.APIKeyRequest{Scopes: []models.APIScope{"read"}, ExpiresAt: &past})
+	assert.ErrorIs(t, err, ErrInvalidAPIKeyRequest)
+
+	key, rawKey, err := CreateAPIKey(ctx, store, 1, models.APIKeyRequest{
+		Name:   "ci",
+		Scopes: []models.APIScope{models.ScopeStats, models.ScopeRead, models.ScopeRead},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []models.APIScope{models.ScopeRead, models.ScopeStats}, key.Scopes)
+	assert.NotContains(t, key.Hash, rawKey)
+
+	user, err := AuthUserByAPIKey(ctx, rawKey, store, log)
+	require.NoError(t, err)
+	assert.Equal(t, 1, user.ID)
+	assert.True(t, user.Service.IsAuthenticated)
+	assert.True(t, user.Allows(models.ScopeRead))
+	assert.False(t, user.Allows(models.ScopeCreate))
+
+	_, err = AuthUserByAPIKey(ctx, rawKey[:len(rawKey)-1]+"0", store, log)
+	assert.ErrorIs(t, err, ErrInvalidAPIKey)
+	_, err = AuthUserByAPIKey(ctx, "token", store, log)
+	assert.ErrorIs(t, err, ErrInvalidAPIKey)
+
+	keys, err := GetUserAPIKeys(ctx, store, 1)
+	require.NoError(t, err)
+	assert.Len(t, keys, 1)
+
+	// Отозванный и истёкший ключи не проходят.
+	require.ErrorIs(t, RevokeAPIKey(ctx, store, 2, key.ID), storagePkg.ErrNotFound)
+	require.NoError(t, RevokeAPIKey(ctx, store, 1, key.ID))
+	_, err = AuthUserByAPIKey(ctx, rawKey, store, log)
+	assert.ErrorIs(t, err, ErrInvalidAPIKey)
+
+	soon := time.Now().Add(time.Hour)
+	key, rawKey, err = CreateAPIKey(ctx, store, 1, models.APIKeyRequest{
+		Scopes:    []models.APIScope{models.ScopeRead},
+		ExpiresAt: &soon,
+	})
+	require.NoError(t, err)
+	_, err = AuthUserByAPIKey(ctx, rawKey, store, log)
+	require.NoError(t, err)
+	key.ExpiresAt = &past
+	_, err = AuthUserByAPIKey(ctx, rawKey, store, log)
+	assert.ErrorIs(t, err, ErrInvalidAPIKey)
+}
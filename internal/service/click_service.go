@@ -0,0 +1,222 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/Melikhov-p/url-minimise/internal/clicks"
+	"github.com/Melikhov-p/url-minimise/internal/config"
+	"github.com/Melikhov-p/url-minimise/internal/models"
+	"github.com/Melikhov-p/url-minimise/internal/repository"
+	"github.com/Melikhov-p/url-minimise/internal/tracing"
+)
+
+// Ограничения выборки статистики переходов.
+const (
+	statsDefaultTop   = 10
+	statsMaxTop       = 100
+	statsMaxHourRange = 31 * 24 * time.Hour
+	statsMaxDayRange  = 366 * 24 * time.Hour
+)
+
+// ErrInvalidStatsQuery некорректные параметры выборки статистики переходов.
+var ErrInvalidStatsQuery = errors.New("invalid stats query")
+
+// VisitorIP адрес посетителя для записи перехода. Заголовок X-Real-IP realIP подделывается клиентом,
+// поэтому используется, только если соединение remoteAddr пришло от прокси из доверенной подсети,
+// иначе берётся адрес соединения.
+func VisitorIP(cfg *config.Config, remoteAddr, realIP string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	if realIP == "" {
+		return host
+	}
+
+	_, trustedNet, err := net.ParseCIDR(cfg.TrustedSubNet)
+	if ip := net.ParseIP(host); err == nil && ip != nil && trustedNet.Contains(ip) {
+		return realIP
+	}
+	return host
+}
+
+// RecordClick записать переход по ссылке в буфер событий без ожидания.
+// IP посетителя обезличивается до записи, для подсчёта уникальных посетителей сохраняется только хеш.
+// Показ варианта A/B variant учитывается вместе с событием, а не отдельной записью на каждый редирект.
+// Возвращает false, если событие отброшено.
+// Переход сразу рассылается подписчикам ссылки, даже если буфер сохранения заполнен.
+func RecordClick(cfg *config.Config, shortURL string, visit *models.Visit, variant string) bool {
+	event := &models.ClickEvent{
+		Time:      time.Now().UTC(),
+		ShortURL:  shortURL,
+		Referrer:  visit.Referrer,
+		UserAgent: visit.UserAgent,
+		IP:        clicks.AnonymizeIP(visit.IP),
+		Language:  PreferredLanguage(visit.AcceptLanguage),
+		Visitor:   clicks.VisitorHash(cfg.SecretKey, visit.IP, visit.UserAgent),
+		Variant:   variant,
+	}
+	cfg.ClickHub.Publish(event)
+	return cfg.Clicks.Record(event)
+}
+
+// SubscribeClicks подписать владельца ссылки на её переходы в реальном времени.
+// Подписку нужно закрыть, когда владелец отключится.
+func SubscribeClicks(
+	ctx context.Context,
+	cfg *config.Config,
+	storage repository.Storage,
+	shortURL string,
+	userID int,
+) (*clicks.Subscription, error) {
+	ctx, span := tracing.Start(ctx, "service.SubscribeClicks")
+	defer span.End()
+
+	stored, err := storage.GetURL(ctx, shortURL)
+	if err != nil {
+		return nil, fmt.Errorf("error getting url for live clicks %w", err)
+	}
+	if stored.UserID != userID {
+		return nil, ErrNotURLOwner
+	}
+
+	sub, err := cfg.ClickHub.Subscribe(shortURL)
+	if err != nil {
+		return nil, fmt.Errorf("error subscribing to clicks %w", err)
+	}
+	return sub, nil
+}
+
+// LiveClickFromEvent переход для владельца ссылки: без обезличенного IP и хеша посетителя.
+func LiveClickFromEvent(event *models.ClickEvent) models.LiveClick {
+	return models.LiveClick{
+		Time:      event.Time,
+		ShortURL:  event.ShortURL,
+		Referrer:  event.Referrer,
+		UserAgent: event.UserAgent,
+		Language:  event.Language,
+	}
+}
+
+// GetLinkStats получить статистику переходов по ссылке владельца из агрегатов.
+// Пустые параметры query заменяются значениями по умолчанию: шаг — сутки, интервал — последние
+// 30 суток для шага в сутки или 24 часа для шага в час. Ряд дополняется интервалами без переходов.
+func GetLinkStats(
+	ctx context.Context,
+	storage repository.Storage,
+	shortURL string,
+	userID int,
+	query models.ClickStatsQuery,
+) (*models.LinkStatsResponse, error) {
+	ctx, span := tracing.Start(ctx, "service.GetLinkStats")
+	defer span.End()
+
+	if err := normalizeStatsQuery(&query, time.Now()); err != nil {
+		return nil, err
+	}
+
+	stored, err := storage.GetURL(ctx, shortURL)
+	if err != nil {
+		return nil, fmt.Errorf("error getting url for stats %w", err)
+	}
+	if stored.UserID != userID {
+		return nil, ErrNotURLOwner
+	}
+
+	stats, err := storage.GetClickStats(ctx, shortURL, query)
+	if err != nil {
+		return nil, fmt.Errorf("error getting click stats %w", err)
+	}
+
+	res := &models.LinkStatsResponse{
+		From:           query.From,
+		To:             query.To,
+		ShortURL:       shortURL,
+		Bucket:         query.Bucket,
+		Series:         fillStatsSeries(stats.Series, query),
+		TopReferrers:   nonNilCounts(stats.Top[models.ClickDimensionReferrer]),
+		TopUserAgents:  nonNilCounts(stats.Top[models.ClickDimensionUserAgent]),
+		Languages:      nonNilCounts(stats.Top[models.ClickDimensionLanguage]),
+		TotalClicks:    stats.TotalCount,
+		UniqueVisitors: stats.UniqueVisitors,
+	}
+	for _, point := range res.Series {
+		res.RangeClicks += point.Clicks
+	}
+
+	return res, nil
+}
+
+// normalizeStatsQuery проверяет параметры выборки, подставляет значения по умолчанию
+// и выравнивает начало интервала по границе шага.
+func normalizeStatsQuery(query *models.ClickStatsQuery, now time.Time) error {
+	var step, maxRange time.Duration
+	switch query.Bucket {
+	case "", models.StatsBucketDay:
+		query.Bucket = models.StatsBucketDay
+		step, maxRange = 24*time.Hour, statsMaxDayRange
+	case models.StatsBucketHour:
+		step, maxRange = time.Hour, statsMaxHourRange
+	default:
+		return fmt.Errorf("%w: bucket must be hour or day", ErrInvalidStatsQuery)
+	}
+
+	switch {
+	case query.Top == 0:
+		query.Top = statsDefaultTop
+	case query.Top < 0 || query.Top > statsMaxTop:
+		return fmt.Errorf("%w: top must be between 1 and %d", ErrInvalidStatsQuery, statsMaxTop)
+	}
+
+	if query.To.IsZero() {
+		query.To = now
+	}
+	if query.From.IsZero() {
+		if query.Bucket == models.StatsBucketDay {
+			query.From = query.To.AddDate(0, 0, -30)
+		} else {
+			query.From = query.To.Add(-24 * time.Hour)
+		}
+	}
+	if !query.From.Before(query.To) {
+		return fmt.Errorf("%w: from must be before to", ErrInvalidStatsQuery)
+	}
+	query.From = query.From.UTC().Truncate(step)
+	query.To = query.To.UTC()
+
+	if query.To.Sub(query.From) > maxRange {
+		return fmt.Errorf("%w: range is too long for %s bucket", ErrInvalidStatsQuery, query.Bucket)
+	}
+	return nil
+}
+
+// fillStatsSeries дополняет ряд интервалами без переходов от начала до конца выборки.
+func fillStatsSeries(series []models.StatsPoint, query models.ClickStatsQuery) []models.StatsPoint {
+	step := time.Hour
+	if query.Bucket == models.StatsBucketDay {
+		step = 24 * time.Hour
+	}
+
+	clicks := make(map[time.Time]int64, len(series))
+	for _, point := range series {
+		clicks[point.Time.UTC()] = point.Clicks
+	}
+
+	filled := make([]models.StatsPoint, 0, int(query.To.Sub(query.From)/step)+1)
+	for bucket := query.From; bucket.Before(query.To); bucket = bucket.Add(step) {
+		filled = append(filled, models.StatsPoint{Time: bucket, Clicks: clicks[bucket]})
+	}
+	return filled
+}
+
+// nonNilCounts пустой топ вместо nil, чтобы в JSON был массив.
+func nonNilCounts(counts []models.ClickCount) []models.ClickCount {
+	if counts == nil {
+		return []models.ClickCount{}
+	}
+	return counts
+}
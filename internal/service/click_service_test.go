@@ -0,0 +1,164 @@
+package service
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Melikhov-p/url-minimise/internal/clicks"
+	"github.com/Melikhov-p/url-minimise/internal/config"
+	"github.com/Melikhov-p/url-minimise/internal/logger"
+	"github.com/Melikhov-p/url-minimise/internal/models"
+	"github.com/Melikhov-p/url-minimise/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordClick(t *testing.T) {
+	log, err := logger.BuildLogger("ERROR")
+	require.NoError(t, err)
+	cfg := config.NewConfig(log, true)
+	cfg.Clicks = clicks.NewBuffer(1)
+
+	visit := &models.Visit{
+		UserAgent:      "curl",
+		AcceptLanguage: "en-US,en;q=0.9",
+		Referrer:       "https://t.me/",
+		IP:             "203.0.113.7:5000",
+	}
+	assert.True(t, RecordClick(cfg, "short", visit, ""))
+	assert.False(t, RecordClick(cfg, "short", visit, ""))
+
+	event := <-cfg.Clicks.Events()
+	assert.Equal(t, "short", event.ShortURL)
+	assert.Equal(t, "203.0.113.0", event.IP)
+	assert.Equal(t, "en-us", event.Language)
+	assert.Equal(t, "https://t.me/", event.Referrer)
+	assert.Equal(t, clicks.VisitorHash(cfg.SecretKey, "203.0.113.7", "curl"), event.Visitor)
+}
+
+func TestVisitorIP(t *testing.T) {
+	log, err := logger.BuildLogger("ERROR")
+	require.NoError(t, err)
+	cfg := config.NewConfig(log, true)
+	cfg.TrustedSubNet = "192.168.1.0/24"
+
+	testCases := []struct {
+		name       string
+		remoteAddr string
+		realIP     string
+		want       string
+	}{
+		{name: "trusted proxy", remoteAddr: "192.168.1.10:40000", realIP: "203.0.113.7", want: "203.0.113.7"},
+		{name: "spoofed header", remoteAddr: "198.51.100.7:40000", realIP: "203.0.113.7", want: "198.51.100.7"},
+		{name: "no header", remoteAddr: "192.168.1.10:40000", want: "192.168.1.10"},
+		{name: "no port", remoteAddr: "198.51.100.7", realIP: "203.0.113.7", want: "198.51.100.7"},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.want, VisitorIP(cfg, test.remoteAddr, test.realIP))
+		})
+	}
+
+	// Без доверенной подсети заголовку не доверяют.
+	cfg.TrustedSubNet = ""
+	assert.Equal(t, "192.168.1.10", VisitorIP(cfg, "192.168.1.10:40000", "203.0.113.7"))
+}
+
+func TestSubscribeClicks(t *testing.T) {
+	log, err := logger.BuildLogger("ERROR")
+	require.NoError(t, err)
+	cfg := config.NewConfig(log, true)
+	cfg.Storage.FileStorage.FilePath = filepath.Join(t.TempDir(), "storage.txt")
+	store, err := repository.NewStorage(cfg, log)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	newURL, err := AddURL(ctx, store, log, "https://example.com/live", cfg, 1)
+	require.NoError(t, err)
+
+	_, err = SubscribeClicks(ctx, cfg, store, newURL.ShortURL, 2)
+	assert.ErrorIs(t, err, ErrNotURLOwner)
+	_, err = SubscribeClicks(ctx, cfg, store, "missing", 1)
+	assert.Error(t, err)
+
+	sub, err := SubscribeClicks(ctx, cfg, store, newURL.ShortURL, 1)
+	require.NoError(t, err)
+	defer sub.Close()
+
+	// Переход рассылается подписчикам, даже если буфер записи переходов переполнен.
+	cfg.Clicks = clicks.NewBuffer(1)
+	cfg.Clicks.Record(&models.ClickEvent{})
+	assert.False(t, RecordClick(cfg, newURL.ShortURL, &models.Visit{IP: "203.0.113.7:5000", UserAgent: "curl"}, ""))
+
+	click := LiveClickFromEvent(<-sub.Events())
+	assert.Equal(t, newURL.ShortURL, click.ShortURL)
+	assert.Equal(t, "curl", click.UserAgent)
+}
+
+func TestNormalizeStatsQuery(t *testing.T) {
+	now := time.Date(2026, 10, 19, 15, 30, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name    string
+		query   models.ClickStatsQuery
+		want    models.ClickStatsQuery
+		wantErr bool
+	}{
+		{
+			name: "Defaults",
+			want: models.ClickStatsQuery{
+				From:   time.Date(2026, 9, 19, 0, 0, 0, 0, time.UTC),
+				To:     now,
+				Bucket: models.StatsBucketDay,
+				Top:    statsDefaultTop,
+			},
+		},
+		{
+			name:  "HourDefaults",
+			query: models.ClickStatsQuery{Bucket: models.StatsBucketHour, Top: 3},
+			want: models.ClickStatsQuery{
+				From:   time.Date(2026, 10, 18, 15, 0, 0, 0, time.UTC),
+				To:     now,
+				Bucket: models.StatsBucketHour,
+				Top:    3,
+			},
+		},
+		{name: "UnknownBucket", query: models.ClickStatsQuery{Bucket: "week"}, wantErr: true},
+		{name: "TopTooLarge", query: models.ClickStatsQuery{Top: statsMaxTop + 1}, wantErr: true},
+		{name: "FromAfterTo", query: models.ClickStatsQuery{From: now.Add(time.Hour), To: now}, wantErr: true},
+		{
+			name:    "HourRangeTooLong",
+			query:   models.ClickStatsQuery{From: now.AddDate(0, -2, 0), Bucket: models.StatsBucketHour},
+			wantErr: true,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			query := test.query
+			err := normalizeStatsQuery(&query, now)
+			if test.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidStatsQuery)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.want, query)
+		})
+	}
+}
+
+func TestFillStatsSeries(t *testing.T) {
+	from := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	query := models.ClickStatsQuery{From: from, To: from.Add(3*time.Hour + time.Minute), Bucket: models.StatsBucketHour}
+
+	series := fillStatsSeries([]models.StatsPoint{{Time: from.Add(time.Hour), Clicks: 5}}, query)
+	assert.Equal(t, []models.StatsPoint{
+		{Time: from, Clicks: 0},
+		{Time: from.Add(time.Hour), Clicks: 5},
+		{Time: from.Add(2 * time.Hour), Clicks: 0},
+		{Time: from.Add(3 * time.Hour), Clicks: 0},
+	}, series)
+}
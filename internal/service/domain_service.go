@@ -0,0 +1,293 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Melikhov-p/url-minimise/internal/config"
+	"github.com/Melikhov-p/url-minimise/internal/models"
+	"github.com/Melikhov-p/url-minimise/internal/repository"
+	storagePkg "github.com/Melikhov-p/url-minimise/internal/storage"
+	"github.com/Melikhov-p/url-minimise/internal/tracing"
+)
+
+// ErrInvalidDomain имя домена заполнено неверно.
+var ErrInvalidDomain = errors.New("invalid domain name")
+
+// ErrDomainNotAllowed домен не настроен в сервисе и не зарегистрирован пользователем.
+var ErrDomainNotAllowed = errors.New("domain is not available to user")
+
+// ErrDomainNotVerified владение доменом не подтверждено записью DNS.
+var ErrDomainNotVerified = errors.New("domain ownership is not verified")
+
+const (
+	// maxDomainLength ограничивает длину домена, чтобы ключ code@domain помещался в колонку short_url.
+	maxDomainLength = 200
+	// domainVerifyPrefix поддомен, записью на котором подтверждается владение доменом.
+	domainVerifyPrefix = "_url-minimise."
+	// domainLookupTimeout время на проверку записей DNS при регистрации домена.
+	domainLookupTimeout = 5 * time.Second
+)
+
+// BuildShortURL собирает короткий адрес ссылки на её собственном домене.
+func BuildShortURL(cfg *config.Config, key string) string {
+	code, domain := models.SplitLinkKey(key)
+	if domain == "" {
+		return cfg.ResultAddr + "/" + code
+	}
+
+	scheme := "http"
+	if base, err := url.Parse(cfg.ResultAddr); err == nil && base.Scheme != "" {
+		scheme = base.Scheme
+	}
+	return scheme + "://" + domain + "/" + code
+}
+
+// LinkKeyForHost ключ ссылки с кодом code, запрошенной через заголовок Host.
+// Хосты, не являющиеся дополнительными доменами, обслуживаются как основной домен.
+func LinkKeyForHost(
+	ctx context.Context,
+	storage repository.Storage,
+	cfg *config.Config,
+	host string,
+	code string,
+) string {
+	ctx, span := tracing.Start(ctx, "service.LinkKeyForHost")
+	defer span.End()
+
+	domain := hostname(host)
+	if domain == "" || domain == primaryDomain(cfg) {
+		return code
+	}
+	if isSharedDomain(cfg, domain) {
+		return models.LinkKey(code, domain)
+	}
+	// Домены пользователей читаются из кеша, а не из хранилища на каждый переход.
+	// Ошибка хранилища не кешируется, ссылка в этом случае обслуживается как на основном домене.
+	domains, err := cfg.Domains.Get(ctx, storage.GetDomains)
+	if err != nil {
+		return code
+	}
+	if _, ok := domains[domain]; ok {
+		return models.LinkKey(code, domain)
+	}
+
+	return code
+}
+
+// RegisterDomain зарегистрировать дополнительный короткий домен за пользователем.
+// Владение доменом подтверждается записью DNS из DomainVerification, иначе возвращается ErrDomainNotVerified.
+func RegisterDomain(
+	ctx context.Context,
+	storage repository.Storage,
+	cfg *config.Config,
+	domain string,
+	userID int,
+) (string, error) {
+	ctx, span := tracing.Start(ctx, "service.RegisterDomain")
+	defer span.End()
+
+	domain, err := normalizeDomain(domain)
+	if err != nil {
+		return "", err
+	}
+	if domain == primaryDomain(cfg) || isSharedDomain(cfg, domain) {
+		return "", fmt.Errorf("domain %s is already served %w", domain, storagePkg.ErrDomainExist)
+	}
+	if err = verifyDomain(ctx, cfg, domain, userID); err != nil {
+		return "", err
+	}
+
+	if err = storage.AddDomain(ctx, domain, userID); err != nil {
+		return "", fmt.Errorf("error registering domain %w", err)
+	}
+	cfg.Domains.Invalidate()
+
+	return domain, nil
+}
+
+// DomainVerification записи DNS, которыми пользователь подтверждает владение доменом.
+// Значения привязаны к пользователю, поэтому чужая запись не подтверждает домен.
+func DomainVerification(cfg *config.Config, domain string, userID int) (*models.DomainVerification, error) {
+	domain, err := normalizeDomain(domain)
+	if err != nil {
+		return nil, err
+	}
+
+	token := domainToken(cfg, domain, userID)
+	return &models.DomainVerification{
+		Domain: domain,
+		Record: domainVerifyPrefix + domain,
+		TXT:    token,
+		CNAME:  token + "." + primaryDomain(cfg),
+	}, nil
+}
+
+// verifyDomain проверяет записи DNS, подтверждающие владение доменом пользователем.
+func verifyDomain(ctx context.Context, cfg *config.Config, domain string, userID int) error {
+	ctx, span := tracing.Start(ctx, "service.verifyDomain")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, domainLookupTimeout)
+	defer cancel()
+
+	verification, err := DomainVerification(cfg, domain, userID)
+	if err != nil {
+		return err
+	}
+
+	if records, err := cfg.Resolver.LookupTXT(ctx, verification.Record); err == nil {
+		if slices.Contains(records, verification.TXT) {
+			return nil
+		}
+	}
+	if target, err := cfg.Resolver.LookupCNAME(ctx, verification.Record); err == nil {
+		if hostname(target) == verification.CNAME {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: no TXT %q or CNAME %q at %s",
+		ErrDomainNotVerified, verification.TXT, verification.CNAME, verification.Record)
+}
+
+// domainToken значение записи подтверждения домена для пользователя.
+func domainToken(cfg *config.Config, domain string, userID int) string {
+	mac := hmac.New(sha256.New, []byte(cfg.SecretKey))
+	_, _ = fmt.Fprintf(mac, "%d@%s", userID, domain)
+	return hex.EncodeToString(mac.Sum(nil))[:32]
+}
+
+// GetUserDomains получить домены, на которых пользователь может создавать ссылки.
+func GetUserDomains(
+	ctx context.Context,
+	storage repository.Storage,
+	cfg *config.Config,
+	userID int,
+) (*models.UserDomainsResponse, error) {
+	ctx, span := tracing.Start(ctx, "service.GetUserDomains")
+	defer span.End()
+
+	registered, err := storage.GetUserDomains(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting user domains %w", err)
+	}
+
+	shared := make([]string, 0, len(cfg.ShortDomains))
+	for _, domain := range cfg.ShortDomains {
+		if normalized, err := normalizeDomain(domain); err == nil {
+			shared = append(shared, normalized)
+		}
+	}
+
+	return &models.UserDomainsResponse{
+		Primary:    primaryDomain(cfg),
+		Shared:     shared,
+		Registered: registered,
+	}, nil
+}
+
+// checkDomainAllowed проверяет, что пользователь может создать ссылку на домене.
+// Возвращает нормализованный домен, для основного домена — пустую строку.
+func checkDomainAllowed(
+	ctx context.Context,
+	storage repository.Storage,
+	cfg *config.Config,
+	domain string,
+	userID int,
+) (string, error) {
+	if domain == "" || hostname(domain) == primaryDomain(cfg) {
+		return "", nil
+	}
+
+	domain, err := normalizeDomain(domain)
+	if err != nil {
+		return "", err
+	}
+	if isSharedDomain(cfg, domain) {
+		return domain, nil
+	}
+
+	owner, err := storage.GetDomainOwner(ctx, domain)
+	if err != nil {
+		if errors.Is(err, storagePkg.ErrNotFound) {
+			return "", ErrDomainNotAllowed
+		}
+		return "", fmt.Errorf("error getting domain owner %w", err)
+	}
+	if owner != userID {
+		return "", ErrDomainNotAllowed
+	}
+
+	return domain, nil
+}
+
+// primaryDomain домен из базового адреса сервиса.
+func primaryDomain(cfg *config.Config) string {
+	base, err := url.Parse(cfg.ResultAddr)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(base.Hostname())
+}
+
+func isSharedDomain(cfg *config.Config, domain string) bool {
+	for _, shared := range cfg.ShortDomains {
+		if strings.EqualFold(strings.TrimSuffix(shared, "."), domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// hostname значение заголовка Host без порта.
+func hostname(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+// normalizeDomain приводит домен к нижнему регистру и проверяет, что это имя хоста, а не IP-адрес.
+func normalizeDomain(domain string) (string, error) {
+	domain = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+	if domain == "" || len(domain) > maxDomainLength {
+		return "", fmt.Errorf("%w: %q", ErrInvalidDomain, domain)
+	}
+
+	labels := strings.Split(domain, ".")
+	if len(labels) < 2 {
+		return "", fmt.Errorf("%w: %q is not a fully qualified name", ErrInvalidDomain, domain)
+	}
+	for _, label := range labels {
+		if !isValidLabel(label) {
+			return "", fmt.Errorf("%w: %q", ErrInvalidDomain, domain)
+		}
+	}
+	if tld := labels[len(labels)-1]; strings.Trim(tld, "abcdefghijklmnopqrstuvwxyz") != "" {
+		return "", fmt.Errorf("%w: %q has no alphabetic top-level domain", ErrInvalidDomain, domain)
+	}
+
+	return domain, nil
+}
+
+func isValidLabel(label string) bool {
+	if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+		return false
+	}
+	for _, r := range label {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '-' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,180 @@
+package service
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/Melikhov-p/url-minimise/internal/config"
+	"github.com/Melikhov-p/url-minimise/internal/logger"
+	"github.com/Melikhov-p/url-minimise/internal/models"
+	"github.com/Melikhov-p/url-minimise/internal/repository"
+	storagePkg "github.com/Melikhov-p/url-minimise/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeDomain(t *testing.T) {
+	valid := map[string]string{
+		"go.example.com":    "go.example.com",
+		"Go.Example.COM.":   "go.example.com",
+		" s.my-brand.io ":   "s.my-brand.io",
+		"xn--80ak6aa92e.ru": "xn--80ak6aa92e.ru",
+	}
+	for in, want := range valid {
+		got, err := normalizeDomain(in)
+		assert.NoError(t, err, in)
+		assert.Equal(t, want, got)
+	}
+
+	invalid := []string{"", "localhost", "127.0.0.1", "go.example.com:8080", "-bad.com", "a..com", "ex_ample.com"}
+	for _, in := range invalid {
+		_, err := normalizeDomain(in)
+		assert.ErrorIs(t, err, ErrInvalidDomain, in)
+	}
+}
+
+func TestBuildShortURL(t *testing.T) {
+	cfg := &config.Config{ResultAddr: "https://sho.rt"}
+
+	assert.Equal(t, "https://sho.rt/abc", BuildShortURL(cfg, "abc"))
+	assert.Equal(t, "https://go.example.com/abc", BuildShortURL(cfg, models.LinkKey("abc", "go.example.com")))
+}
+
+// fakeResolver отвечает записями DNS из памяти.
+type fakeResolver struct {
+	txt   map[string][]string
+	cname map[string]string
+}
+
+func (r *fakeResolver) LookupTXT(_ context.Context, name string) ([]string, error) {
+	if records, ok := r.txt[name]; ok {
+		return records, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+}
+
+func (r *fakeResolver) LookupCNAME(_ context.Context, host string) (string, error) {
+	if target, ok := r.cname[host]; ok {
+		return target, nil
+	}
+	return "", &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+}
+
+func TestRegisterDomain_Verification(t *testing.T) {
+	log, err := logger.BuildLogger("ERROR")
+	require.NoError(t, err)
+	cfg := config.NewConfig(log, true)
+	cfg.Storage.FileStorage.FilePath = filepath.Join(t.TempDir(), "storage.txt")
+	resolver := &fakeResolver{txt: map[string][]string{}, cname: map[string]string{}}
+	cfg.Resolver = resolver
+	store, err := repository.NewStorage(cfg, log)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	_, err = RegisterDomain(ctx, store, cfg, "go.acme.com", 1)
+	assert.ErrorIs(t, err, ErrDomainNotVerified)
+
+	// Запись другого пользователя не подтверждает домен.
+	other, err := DomainVerification(cfg, "go.acme.com", 2)
+	require.NoError(t, err)
+	resolver.txt[other.Record] = []string{"v=spf1 -all", other.TXT}
+	_, err = RegisterDomain(ctx, store, cfg, "go.acme.com", 1)
+	assert.ErrorIs(t, err, ErrDomainNotVerified)
+
+	own, err := DomainVerification(cfg, "Go.Acme.com", 1)
+	require.NoError(t, err)
+	assert.Equal(t, "_url-minimise.go.acme.com", own.Record)
+	assert.NotEqual(t, other.TXT, own.TXT)
+	resolver.txt[own.Record] = append(resolver.txt[own.Record], own.TXT)
+	domain, err := RegisterDomain(ctx, store, cfg, "go.acme.com", 1)
+	require.NoError(t, err)
+	assert.Equal(t, "go.acme.com", domain)
+
+	// CNAME на адрес из DomainVerification тоже подтверждает владение.
+	byCNAME, err := DomainVerification(cfg, "s.brand.io", 1)
+	require.NoError(t, err)
+	assert.Equal(t, byCNAME.TXT+".localhost", byCNAME.CNAME)
+	resolver.cname[byCNAME.Record] = byCNAME.CNAME + "."
+	_, err = RegisterDomain(ctx, store, cfg, "s.brand.io", 1)
+	assert.NoError(t, err)
+}
+
+func TestLinkKeyForHost_Cache(t *testing.T) {
+	log, err := logger.BuildLogger("ERROR")
+	require.NoError(t, err)
+	cfg := config.NewConfig(log, true)
+	cfg.Storage.FileStorage.FilePath = filepath.Join(t.TempDir(), "storage.txt")
+	store, err := repository.NewStorage(cfg, log)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	assert.Equal(t, "abc", LinkKeyForHost(ctx, store, cfg, "go.acme.com", "abc"))
+
+	// Домен, добавленный в хранилище в обход сервиса, не виден до истечения кеша.
+	require.NoError(t, store.AddDomain(ctx, "go.acme.com", 1))
+	assert.Equal(t, "abc", LinkKeyForHost(ctx, store, cfg, "go.acme.com", "abc"))
+
+	cfg.Domains.Invalidate()
+	assert.Equal(t, models.LinkKey("abc", "go.acme.com"), LinkKeyForHost(ctx, store, cfg, "go.acme.com", "abc"))
+}
+
+func TestDomains(t *testing.T) {
+	log, err := logger.BuildLogger("ERROR")
+	require.NoError(t, err)
+	cfg := config.NewConfig(log, true)
+	cfg.Storage.FileStorage.FilePath = filepath.Join(t.TempDir(), "storage.txt")
+	cfg.ShortDomains = []string{"shared.example.com"}
+	store, err := repository.NewStorage(cfg, log)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	resolver := &fakeResolver{txt: map[string][]string{}}
+	cfg.Resolver = resolver
+	for _, userID := range []int{1, 2} {
+		verification, err := DomainVerification(cfg, "go.acme.com", userID)
+		require.NoError(t, err)
+		resolver.txt[verification.Record] = append(resolver.txt[verification.Record], verification.TXT)
+	}
+
+	_, err = RegisterDomain(ctx, store, cfg, "localhost.localdomain:80", 1)
+	assert.ErrorIs(t, err, ErrInvalidDomain)
+	_, err = RegisterDomain(ctx, store, cfg, "shared.example.com", 1)
+	assert.ErrorIs(t, err, storagePkg.ErrDomainExist)
+
+	domain, err := RegisterDomain(ctx, store, cfg, "Go.Acme.com", 1)
+	require.NoError(t, err)
+	assert.Equal(t, "go.acme.com", domain)
+	_, err = RegisterDomain(ctx, store, cfg, "go.acme.com", 2)
+	assert.ErrorIs(t, err, storagePkg.ErrDomainExist)
+
+	domains, err := GetUserDomains(ctx, store, cfg, 1)
+	require.NoError(t, err)
+	assert.Equal(t, &models.UserDomainsResponse{
+		Primary:    "localhost",
+		Shared:     []string{"shared.example.com"},
+		Registered: []string{"go.acme.com"},
+	}, domains)
+
+	_, err = AddURLOnDomain(ctx, store, log, "https://acme.com/other", "go.acme.com", cfg, 2)
+	assert.ErrorIs(t, err, ErrDomainNotAllowed)
+
+	owned, err := AddURLOnDomain(ctx, store, log, "https://acme.com/owned", "go.acme.com", cfg, 1)
+	require.NoError(t, err)
+	code, linkDomain := models.SplitLinkKey(owned.ShortURL)
+	assert.Equal(t, "go.acme.com", linkDomain)
+
+	shared, err := AddURLOnDomain(ctx, store, log, "https://acme.com/shared", "shared.example.com", cfg, 2)
+	require.NoError(t, err)
+
+	primary, err := AddURLOnDomain(ctx, store, log, "https://acme.com/primary", "localhost", cfg, 2)
+	require.NoError(t, err)
+	assert.NotContains(t, primary.ShortURL, "@")
+
+	assert.Equal(t, owned.ShortURL, LinkKeyForHost(ctx, store, cfg, "go.acme.com:8080", code))
+	sharedCode, _ := models.SplitLinkKey(shared.ShortURL)
+	assert.Equal(t, shared.ShortURL, LinkKeyForHost(ctx, store, cfg, "SHARED.example.com", sharedCode))
+	assert.Equal(t, code, LinkKeyForHost(ctx, store, cfg, "localhost:8080", code))
+	assert.Equal(t, code, LinkKeyForHost(ctx, store, cfg, "unknown.example.com", code))
+}
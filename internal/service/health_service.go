@@ -0,0 +1,337 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/Melikhov-p/url-minimise/internal/config"
+	"github.com/Melikhov-p/url-minimise/internal/models"
+	"github.com/Melikhov-p/url-minimise/internal/repository"
+	"github.com/Melikhov-p/url-minimise/internal/tracing"
+)
+
+// healthCheckUserAgent представляется проверяющим клиентом, чтобы владельцы сайтов могли отличить проверки.
+const healthCheckUserAgent = "url-minimise-health-checker/1.0"
+
+// healthCheckBodyLimit сколько байт тела ответа на GET дочитывается, чтобы переиспользовать соединение.
+const healthCheckBodyLimit = 4 << 10
+
+// healthCheckMaxRedirects сколько перенаправлений проходит проверка.
+const healthCheckMaxRedirects = 5
+
+// ErrPrivateDestination адрес назначения ведёт во внутреннюю сеть. Проверка туда не ходит,
+// иначе ссылка на внутренний адрес позволила бы опрашивать внутренние сервисы через сокращатель.
+var ErrPrivateDestination = errors.New("destination is not a public address")
+
+// nonPublicPrefixes специальные диапазоны, которые net/netip не относит к частным или локальным.
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("2001:db8::/32"),
+}
+
+// HealthChecker проверяет доступность адресов назначения ссылок.
+// Одновременно выполняется не больше Concurrency запросов, а запросы к одному хосту
+// отправляются не чаще одного за HostInterval. Без AllowPrivate запросы идут только на публичные адреса.
+type HealthChecker struct {
+	Client       *http.Client
+	nextSlot     map[string]time.Time // [host]время, раньше которого к хосту не обращаться
+	Concurrency  int
+	HostInterval time.Duration
+	BrokenAfter  int
+	AllowPrivate bool
+	mu           sync.Mutex
+}
+
+// NewHealthChecker возвращает проверку адресов назначения с настройками из конфига.
+func NewHealthChecker(cfg *config.Config) *HealthChecker {
+	c := &HealthChecker{
+		Concurrency:  cfg.HealthCheckConcurrency,
+		HostInterval: cfg.HealthCheckHostInterval,
+		BrokenAfter:  cfg.HealthBrokenAfter,
+		AllowPrivate: cfg.HealthCheckAllowPrivate,
+		nextSlot:     map[string]time.Time{},
+	}
+
+	// Адрес проверяется при подключении, уже после разрешения имени, поэтому запись DNS,
+	// указывающая во внутреннюю сеть, тоже отклоняется. Прокси не используется: иначе проверялся бы адрес прокси.
+	dialer := &net.Dialer{Timeout: cfg.HealthCheckTimeout}
+	if !c.AllowPrivate {
+		dialer.Control = rejectPrivateAddress
+	}
+	transport := &http.Transport{
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   cfg.HealthCheckTimeout,
+		ResponseHeaderTimeout: cfg.HealthCheckTimeout,
+		MaxIdleConnsPerHost:   1,
+		IdleConnTimeout:       time.Minute,
+	}
+	c.Client = &http.Client{Timeout: cfg.HealthCheckTimeout, Transport: transport, CheckRedirect: c.checkRedirect}
+	return c
+}
+
+// CheckLinks проверяет адреса назначения links и обновляет результат проверки в каждом из них.
+// Адрес помечается недоступным после BrokenAfter неудачных проверок подряд.
+func (c *HealthChecker) CheckLinks(ctx context.Context, links []*models.LinkHealth) {
+	c.forgetPastSlots()
+
+	sem := make(chan struct{}, max(c.Concurrency, 1))
+	var wg sync.WaitGroup
+
+	for _, link := range links {
+		wg.Add(1)
+		go func(link *models.LinkHealth) {
+			defer wg.Done()
+			c.check(ctx, link, sem)
+		}(link)
+	}
+
+	wg.Wait()
+}
+
+// check проверяет один адрес назначения. Очередь к хосту ожидается до того, как занять место
+// в sem, чтобы ожидание не отнимало места у запросов к другим хостам.
+func (c *HealthChecker) check(ctx context.Context, link *models.LinkHealth, sem chan struct{}) {
+	target, err := url.Parse(link.OriginalURL)
+	if err == nil {
+		err = c.checkDestination(target)
+	}
+	if err != nil {
+		c.record(link, 0, 0, fmt.Errorf("unsupported destination %q %w", link.OriginalURL, err))
+		return
+	}
+	if err = c.waitHost(ctx, target.Host); err != nil {
+		return
+	}
+
+	select {
+	case <-ctx.Done():
+		return
+	case sem <- struct{}{}:
+	}
+	defer func() {
+		<-sem
+	}()
+
+	start := time.Now()
+	code, err := c.probe(ctx, target.String())
+	if ctx.Err() != nil {
+		// Проверка прервана остановкой воркера, а не недоступностью адреса.
+		return
+	}
+	c.record(link, code, time.Since(start), err)
+}
+
+// probe отправляет HEAD, а если сервер не поддерживает HEAD — GET, и возвращает код ответа.
+func (c *HealthChecker) probe(ctx context.Context, target string) (int, error) {
+	code, err := c.do(ctx, http.MethodHead, target)
+	if err == nil && (code == http.StatusMethodNotAllowed || code == http.StatusNotImplemented) {
+		return c.do(ctx, http.MethodGet, target)
+	}
+	return code, err
+}
+
+func (c *HealthChecker) do(ctx context.Context, method, target string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, method, target, http.NoBody)
+	if err != nil {
+		return 0, fmt.Errorf("error building health check request %w", err)
+	}
+	req.Header.Set("User-Agent", healthCheckUserAgent)
+
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("error requesting destination %w", err)
+	}
+	defer func() {
+		_, _ = io.CopyN(io.Discard, resp.Body, healthCheckBodyLimit)
+		_ = resp.Body.Close()
+	}()
+
+	return resp.StatusCode, nil
+}
+
+// checkRedirect пропускает перенаправление по тем же правилам, что и исходный адрес.
+func (c *HealthChecker) checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= healthCheckMaxRedirects {
+		return fmt.Errorf("stopped after %d redirects", len(via))
+	}
+	return c.checkDestination(req.URL)
+}
+
+// checkDestination проверяет схему адреса и, если хост задан IP-адресом, что адрес публичный.
+// Адреса хостов, заданных именем, проверяются при подключении.
+func (c *HealthChecker) checkDestination(target *url.URL) error {
+	if (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return errors.New("only http and https destinations are checked")
+	}
+	if c.AllowPrivate {
+		return nil
+	}
+	if addr, err := netip.ParseAddr(target.Hostname()); err == nil && !isPublicAddr(addr) {
+		return ErrPrivateDestination
+	}
+	return nil
+}
+
+// rejectPrivateAddress запрещает подключение к адресу, который не является публичным.
+func rejectPrivateAddress(_ string, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("error parsing dialed address %w", err)
+	}
+	if !isPublicAddr(addrPort.Addr()) {
+		return ErrPrivateDestination
+	}
+	return nil
+}
+
+// isPublicAddr публичный ли адрес: не loopback, не частная сеть, не link-local (в том числе
+// 169.254.169.254 облачных метаданных) и не специальный диапазон.
+func isPublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return false
+	}
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// record записывает результат проверки в link.
+func (c *HealthChecker) record(link *models.LinkHealth, code int, latency time.Duration, err error) {
+	link.CheckedAt = time.Now()
+	link.StatusCode = code
+	link.Latency = latency
+	link.Error = ""
+
+	switch {
+	case err != nil:
+		link.Error = err.Error()
+	case code >= http.StatusBadRequest:
+		link.Error = http.StatusText(code)
+	default:
+		link.Failures = 0
+		link.Broken = false
+		return
+	}
+
+	link.Failures++
+	link.Broken = link.Failures >= c.BrokenAfter
+}
+
+// waitHost ждёт своей очереди на запрос к хосту с учётом HostInterval.
+func (c *HealthChecker) waitHost(ctx context.Context, host string) error {
+	c.mu.Lock()
+	slot := time.Now()
+	if next, ok := c.nextSlot[host]; ok && next.After(slot) {
+		slot = next
+	}
+	c.nextSlot[host] = slot.Add(c.HostInterval)
+	c.mu.Unlock()
+
+	timer := time.NewTimer(time.Until(slot))
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("health check canceled %w", ctx.Err())
+	case <-timer.C:
+		return nil
+	}
+}
+
+// forgetPastSlots удаляет хосты, к которым уже можно обращаться, чтобы таблица не росла.
+func (c *HealthChecker) forgetPastSlots() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for host, next := range c.nextSlot {
+		if !next.After(now) {
+			delete(c.nextSlot, host)
+		}
+	}
+}
+
+// RunHealthCheck проверяет до limit ссылок, не проверявшихся дольше interval, и сохраняет результаты.
+// Возвращает количество проверенных ссылок.
+func RunHealthCheck(
+	ctx context.Context,
+	storage repository.Storage,
+	checker *HealthChecker,
+	interval time.Duration,
+	limit int,
+) (int, error) {
+	links, err := storage.GetLinksForHealthCheck(ctx, time.Now().Add(-interval), limit)
+	if err != nil {
+		return 0, fmt.Errorf("error getting links for health check %w", err)
+	}
+	if len(links) == 0 {
+		return 0, nil
+	}
+
+	start := time.Now()
+	checker.CheckLinks(ctx, links)
+
+	// Ссылки, проверка которых прервана остановкой, остаются со старым результатом.
+	checked := make([]*models.LinkHealth, 0, len(links))
+	for _, link := range links {
+		if !link.CheckedAt.Before(start) {
+			checked = append(checked, link)
+		}
+	}
+	if len(checked) == 0 {
+		return 0, nil
+	}
+	if err = storage.SaveLinkHealth(context.WithoutCancel(ctx), checked); err != nil {
+		return 0, fmt.Errorf("error saving link health %w", err)
+	}
+
+	return len(checked), nil
+}
+
+// GetBrokenURLs получить ссылки пользователя, адрес назначения которых помечен недоступным.
+func GetBrokenURLs(
+	ctx context.Context,
+	storage repository.Storage,
+	cfg *config.Config,
+	userID int,
+) ([]models.BrokenURL, error) {
+	ctx, span := tracing.Start(ctx, "service.GetBrokenURLs")
+	defer span.End()
+
+	links, err := storage.GetBrokenLinks(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting broken links %w", err)
+	}
+
+	broken := make([]models.BrokenURL, 0, len(links))
+	for _, link := range links {
+		broken = append(broken, models.BrokenURL{
+			ShortURL:    BuildShortURL(cfg, link.ShortURL),
+			OriginalURL: link.OriginalURL,
+			StatusCode:  link.StatusCode,
+			Error:       link.Error,
+			LatencyMs:   link.Latency.Milliseconds(),
+			Failures:    link.Failures,
+			CheckedAt:   link.CheckedAt,
+		})
+	}
+	return broken, nil
+}
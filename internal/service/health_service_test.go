@@ -0,0 +1,251 @@
+package service
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Melikhov-p/url-minimise/internal/config"
+	"github.com/Melikhov-p/url-minimise/internal/logger"
+	"github.com/Melikhov-p/url-minimise/internal/models"
+	"github.com/Melikhov-p/url-minimise/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestChecker(concurrency int, hostInterval time.Duration) *HealthChecker {
+	cfg := &config.Config{
+		HealthCheckTimeout:      time.Second,
+		HealthCheckConcurrency:  concurrency,
+		HealthCheckHostInterval: hostInterval,
+		HealthBrokenAfter:       2,
+		// Тестовые серверы слушают loopback.
+		HealthCheckAllowPrivate: true,
+	}
+	return NewHealthChecker(cfg)
+}
+
+func TestHealthChecker_CheckLinks(t *testing.T) {
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodHead, r.Method)
+		assert.Equal(t, healthCheckUserAgent, r.UserAgent())
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ok.Close()
+
+	noHead := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		_, _ = w.Write([]byte("hello"))
+	}))
+	defer noHead.Close()
+
+	var failing atomic.Bool
+	failing.Store(true)
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if failing.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer flaky.Close()
+
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	links := map[string]*models.LinkHealth{
+		"ok":     {ShortURL: "ok", OriginalURL: ok.URL + "/page"},
+		"noHead": {ShortURL: "noHead", OriginalURL: noHead.URL},
+		"flaky":  {ShortURL: "flaky", OriginalURL: flaky.URL},
+		"closed": {ShortURL: "closed", OriginalURL: closed.URL},
+		"ftp":    {ShortURL: "ftp", OriginalURL: "ftp://example.com/file"},
+	}
+	batch := make([]*models.LinkHealth, 0, len(links))
+	for _, link := range links {
+		batch = append(batch, link)
+	}
+
+	checker := newTestChecker(3, 0)
+	checker.CheckLinks(context.Background(), batch)
+
+	assert.Equal(t, http.StatusOK, links["ok"].StatusCode)
+	assert.Equal(t, http.StatusOK, links["noHead"].StatusCode)
+	assert.Equal(t, http.StatusInternalServerError, links["flaky"].StatusCode)
+	assert.Zero(t, links["closed"].StatusCode)
+	assert.NotEmpty(t, links["closed"].Error)
+	assert.NotEmpty(t, links["ftp"].Error)
+	for name, link := range links {
+		assert.False(t, link.CheckedAt.IsZero(), name)
+		assert.False(t, link.Broken, "%s is broken after the first failure", name)
+	}
+
+	checker.CheckLinks(context.Background(), batch)
+	assert.False(t, links["ok"].Broken)
+	assert.False(t, links["noHead"].Broken)
+	assert.True(t, links["flaky"].Broken)
+	assert.Equal(t, 2, links["flaky"].Failures)
+	assert.True(t, links["closed"].Broken)
+
+	failing.Store(false)
+	checker.CheckLinks(context.Background(), batch)
+	assert.False(t, links["flaky"].Broken)
+	assert.Zero(t, links["flaky"].Failures)
+	assert.Empty(t, links["flaky"].Error)
+}
+
+func TestHealthChecker_Limits(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		inFlight int
+		maxIn    int
+		times    []time.Time
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		mu.Lock()
+		inFlight++
+		maxIn = max(maxIn, inFlight)
+		times = append(times, time.Now())
+		mu.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	batch := make([]*models.LinkHealth, 0, 6)
+	for range 6 {
+		batch = append(batch, &models.LinkHealth{OriginalURL: srv.URL})
+	}
+
+	// Без ограничения по хосту одновременно идёт не больше Concurrency запросов.
+	newTestChecker(2, 0).CheckLinks(context.Background(), batch)
+	assert.Equal(t, 2, maxIn)
+
+	// Запросы к одному хосту разнесены на HostInterval независимо от Concurrency.
+	times = nil
+	newTestChecker(6, 50*time.Millisecond).CheckLinks(context.Background(), batch[:3])
+	require.Len(t, times, 3)
+	first, last := times[0], times[0]
+	for _, ts := range times {
+		if ts.Before(first) {
+			first = ts
+		}
+		if ts.After(last) {
+			last = ts
+		}
+	}
+	assert.GreaterOrEqual(t, last.Sub(first), 90*time.Millisecond)
+
+	// Отмена контекста прерывает ожидание очереди к хосту без записи результата.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	waiting := &models.LinkHealth{OriginalURL: srv.URL}
+	checker := newTestChecker(1, time.Hour)
+	checker.nextSlot[srv.Listener.Addr().String()] = time.Now().Add(time.Hour)
+	checker.CheckLinks(ctx, []*models.LinkHealth{waiting})
+	assert.True(t, waiting.CheckedAt.IsZero())
+}
+
+func TestHealthChecker_PrivateDestinations(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		hits.Add(1)
+	}))
+	defer srv.Close()
+	_, port, err := net.SplitHostPort(srv.Listener.Addr().String())
+	require.NoError(t, err)
+
+	checker := NewHealthChecker(&config.Config{HealthCheckTimeout: time.Second, HealthCheckConcurrency: 2})
+	links := []*models.LinkHealth{
+		{OriginalURL: srv.URL},
+		// Имя проверяется после разрешения: localhost ведёт на loopback.
+		{OriginalURL: "http://localhost:" + port},
+		{OriginalURL: "http://169.254.169.254/latest/meta-data/"},
+		{OriginalURL: "http://[::1]:" + port},
+	}
+	checker.CheckLinks(context.Background(), links)
+
+	assert.Zero(t, hits.Load())
+	for _, link := range links {
+		assert.Contains(t, link.Error, ErrPrivateDestination.Error(), link.OriginalURL)
+		assert.Zero(t, link.StatusCode)
+	}
+
+	// Перенаправление проверяется по тем же правилам.
+	redirect := httptest.NewRequest(http.MethodGet, "http://10.0.0.1/admin", http.NoBody)
+	assert.ErrorIs(t, checker.checkRedirect(redirect, nil), ErrPrivateDestination)
+	redirect = httptest.NewRequest(http.MethodGet, "http://93.184.216.34/", http.NoBody)
+	assert.NoError(t, checker.checkRedirect(redirect, nil))
+	assert.Error(t, checker.checkRedirect(redirect, make([]*http.Request, healthCheckMaxRedirects)))
+
+	for addr, public := range map[string]bool{
+		"93.184.216.34":   true,
+		"2606:4700::1111": true,
+		"127.0.0.1":       false,
+		"10.1.2.3":        false,
+		"172.16.0.1":      false,
+		"192.168.1.1":     false,
+		"169.254.169.254": false,
+		"100.64.0.1":      false,
+		"0.0.0.0":         false,
+		"::1":             false,
+		"fe80::1":         false,
+		"fd00::1":         false,
+		"::ffff:10.0.0.1": false,
+	} {
+		assert.Equal(t, public, isPublicAddr(netip.MustParseAddr(addr)), addr)
+	}
+}
+
+func TestRunHealthCheck(t *testing.T) {
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer down.Close()
+
+	log, err := logger.BuildLogger("ERROR")
+	require.NoError(t, err)
+	cfg := config.NewConfig(log, true)
+	cfg.Storage.FileStorage.FilePath = filepath.Join(t.TempDir(), "storage.txt")
+	store, err := repository.NewStorage(cfg, log)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	broken, err := AddURL(ctx, store, log, down.URL+"/gone", cfg, 1)
+	require.NoError(t, err)
+	_, err = AddURL(ctx, store, log, down.URL+"/other-user", cfg, 2)
+	require.NoError(t, err)
+
+	checker := newTestChecker(2, 0)
+	for range 2 {
+		checked, err := RunHealthCheck(ctx, store, checker, 0, 10)
+		require.NoError(t, err)
+		assert.Equal(t, 2, checked)
+	}
+
+	// Ссылки, проверенные позже now-interval, не проверяются повторно.
+	checked, err := RunHealthCheck(ctx, store, checker, time.Hour, 10)
+	require.NoError(t, err)
+	assert.Zero(t, checked)
+
+	urls, err := GetBrokenURLs(ctx, store, cfg, 1)
+	require.NoError(t, err)
+	require.Len(t, urls, 1)
+	assert.Equal(t, BuildShortURL(cfg, broken.ShortURL), urls[0].ShortURL)
+	assert.Equal(t, down.URL+"/gone", urls[0].OriginalURL)
+	assert.Equal(t, http.StatusNotFound, urls[0].StatusCode)
+	assert.Equal(t, 2, urls[0].Failures)
+}
@@ -0,0 +1,192 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/Melikhov-p/url-minimise/internal/config"
+	"github.com/Melikhov-p/url-minimise/internal/models"
+	"github.com/Melikhov-p/url-minimise/internal/repository"
+	"github.com/Melikhov-p/url-minimise/internal/tracing"
+)
+
+// ImportChunkSize количество строк потокового импорта, которые сохраняются одной пачкой.
+const ImportChunkSize = 500
+
+// Ошибки строк импорта, которые возвращаются клиенту в результате строки.
+var (
+	ErrImportEmptyURL   = errors.New("original_url is empty")
+	ErrImportURLExist   = errors.New("original url already exist")
+	ErrImportURLBlocked = errors.New("original url is blocked by url policy")
+)
+
+// ImportURLs создать ссылки для строк импорта. Результаты заполняются на месте:
+// строки с ошибкой разбора пропускаются, для существующих адресов возвращается уже созданная ссылка.
+// Существующие адреса ищутся одним запросом на все строки.
+func ImportURLs(
+	ctx context.Context,
+	storage repository.Storage,
+	cfg *config.Config,
+	userID int,
+	rows []*models.ImportResult,
+) error {
+	ctx, span := tracing.Start(ctx, "service.ImportURLs")
+	defer span.End()
+
+	var (
+		pending = make([]*models.ImportResult, 0, len(rows))
+		lookup  = make([]string, 0, len(rows))
+		seen    = make(map[string]*models.ImportResult, len(rows))
+	)
+
+	for _, row := range rows {
+		if row.Error != "" {
+			continue
+		}
+		if row.OriginalURL == "" {
+			row.Error = ErrImportEmptyURL.Error()
+			continue
+		}
+		if err := CheckURLPolicy(cfg, row.OriginalURL); err != nil {
+			row.Error = ErrImportURLBlocked.Error()
+			continue
+		}
+
+		if _, ok := seen[row.OriginalURL]; ok {
+			row.Error = ErrImportURLExist.Error()
+			pending = append(pending, row)
+			continue
+		}
+
+		seen[row.OriginalURL] = row
+		lookup = append(lookup, row.OriginalURL)
+	}
+
+	if len(lookup) == 0 {
+		return nil
+	}
+
+	existing, err := storage.GetShortURLs(ctx, lookup)
+	if err != nil {
+		return fmt.Errorf("error checking existing urls %w", err)
+	}
+
+	originalURLs := make([]string, 0, len(lookup))
+	for _, originalURL := range lookup {
+		if short, ok := existing[originalURL]; ok {
+			row := seen[originalURL]
+			row.Error = ErrImportURLExist.Error()
+			row.ShortURL = BuildShortURL(cfg, short)
+			continue
+		}
+		originalURLs = append(originalURLs, originalURL)
+	}
+
+	if len(originalURLs) > 0 {
+		newURLs, err := AddURLs(ctx, storage, originalURLs, cfg, userID)
+		if err != nil {
+			return err
+		}
+		for _, url := range newURLs {
+			seen[url.OriginalURL].ShortURL = BuildShortURL(cfg, url.ShortURL)
+		}
+	}
+
+	// Повторы внутри пачки получают ссылку, созданную для первого вхождения адреса.
+	for _, row := range pending {
+		row.ShortURL = seen[row.OriginalURL].ShortURL
+	}
+
+	return nil
+}
+
+// ImportStream создать ссылки для строк, которые возвращает next, частями по ImportChunkSize.
+// Часть сохраняется целиком до передачи её результатов в emit, поэтому номер последней переданной строки
+// служит точкой продолжения: он возвращается вместе с ошибкой, и поток можно продолжить со следующей строки.
+// В памяти держится только текущая часть, поэтому размер потока не ограничен.
+func ImportStream(
+	ctx context.Context,
+	storage repository.Storage,
+	cfg *config.Config,
+	userID int,
+	next func() (*models.ImportResult, error),
+	emit func([]*models.ImportResult) error,
+) (int, error) {
+	ctx, span := tracing.Start(ctx, "service.ImportStream")
+	defer span.End()
+
+	var (
+		checkpoint int
+		readErr    error
+		chunk      = make([]*models.ImportResult, 0, ImportChunkSize)
+	)
+
+	for readErr == nil {
+		if err := ctx.Err(); err != nil {
+			return checkpoint, fmt.Errorf("import stream interrupted %w", err)
+		}
+
+		chunk = chunk[:0]
+		for len(chunk) < ImportChunkSize {
+			var row *models.ImportResult
+			if row, readErr = next(); readErr != nil {
+				break
+			}
+			chunk = append(chunk, row)
+		}
+		if len(chunk) == 0 {
+			break
+		}
+
+		if err := ImportURLs(ctx, storage, cfg, userID, chunk); err != nil {
+			return checkpoint, err
+		}
+		if err := emit(chunk); err != nil {
+			return checkpoint, fmt.Errorf("error emitting import results %w", err)
+		}
+		checkpoint = chunk[len(chunk)-1].Line
+	}
+
+	if !errors.Is(readErr, io.EOF) {
+		return checkpoint, readErr
+	}
+	return checkpoint, nil
+}
+
+// ExportURLs получить все ссылки пользователя для выгрузки, включая удалённые.
+func ExportURLs(
+	ctx context.Context,
+	storage repository.Storage,
+	cfg *config.Config,
+	userID int,
+) ([]models.ExportURL, error) {
+	ctx, span := tracing.Start(ctx, "service.ExportURLs")
+	defer span.End()
+
+	urls, err := storage.GetURLsByUserID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting user urls %w", err)
+	}
+
+	res := make([]models.ExportURL, 0, len(urls))
+	for _, url := range urls {
+		exported := models.ExportURL{
+			ShortURL:    BuildShortURL(cfg, url.ShortURL),
+			OriginalURL: url.OriginalURL,
+			DeletedFlag: url.DeletedFlag,
+		}
+		if !url.CreatedAt.IsZero() {
+			createdAt := url.CreatedAt
+			exported.CreatedAt = &createdAt
+		}
+		if !url.DeletedAt.IsZero() {
+			deletedAt := url.DeletedAt
+			exported.DeletedAt = &deletedAt
+		}
+		res = append(res, exported)
+	}
+
+	return res, nil
+}
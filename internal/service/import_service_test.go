@@ -0,0 +1,140 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Melikhov-p/url-minimise/internal/config"
+	"github.com/Melikhov-p/url-minimise/internal/logger"
+	"github.com/Melikhov-p/url-minimise/internal/models"
+	"github.com/Melikhov-p/url-minimise/internal/policy"
+	"github.com/Melikhov-p/url-minimise/internal/repository"
+	"github.com/Melikhov-p/url-minimise/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImportURLs(t *testing.T) {
+	log, err := logger.BuildLogger("ERROR")
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	require.NoError(t, os.WriteFile(path, []byte("evil.com\n"), 0600))
+
+	cfg := config.NewConfig(log, true)
+	cfg.StorageMode = storage.BaseStorage
+	cfg.URLPolicy = policy.New(path, policy.ModeBlock)
+	_, err = cfg.URLPolicy.Reload()
+	require.NoError(t, err)
+	store, err := repository.NewStorage(cfg, log)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	existing, err := AddURL(ctx, store, log, "https://existing.example.com", cfg, 1)
+	require.NoError(t, err)
+
+	rows := []*models.ImportResult{
+		{Line: 1, CorrelationID: "a", OriginalURL: "https://new.example.com"},
+		{Line: 2, OriginalURL: "https://existing.example.com"},
+		{Line: 3, OriginalURL: ""},
+		{Line: 4, OriginalURL: "https://evil.com/login"},
+		{Line: 5, Error: "invalid json"},
+		{Line: 6, OriginalURL: "https://new.example.com"},
+	}
+	require.NoError(t, ImportURLs(ctx, store, cfg, 1, rows))
+
+	assert.Empty(t, rows[0].Error)
+	assert.NotEmpty(t, rows[0].ShortURL)
+	assert.Equal(t, ErrImportURLExist.Error(), rows[1].Error)
+	assert.Equal(t, BuildShortURL(cfg, existing.ShortURL), rows[1].ShortURL)
+	assert.Equal(t, ErrImportEmptyURL.Error(), rows[2].Error)
+	assert.Equal(t, ErrImportURLBlocked.Error(), rows[3].Error)
+	assert.Empty(t, rows[3].ShortURL)
+	assert.Equal(t, "invalid json", rows[4].Error)
+	assert.Equal(t, ErrImportURLExist.Error(), rows[5].Error)
+	assert.Equal(t, rows[0].ShortURL, rows[5].ShortURL)
+
+	// Повторный импорт не создаёт новых ссылок.
+	again := []*models.ImportResult{{Line: 1, OriginalURL: "https://new.example.com"}}
+	require.NoError(t, ImportURLs(ctx, store, cfg, 1, again))
+	assert.Equal(t, rows[0].ShortURL, again[0].ShortURL)
+
+	exported, err := ExportURLs(ctx, store, cfg, 1)
+	require.NoError(t, err)
+	assert.Len(t, exported, 2)
+	for _, url := range exported {
+		assert.NotNil(t, url.CreatedAt)
+		assert.Nil(t, url.DeletedAt)
+	}
+}
+
+// lookupCountingStorage считает запросы существующих ссылок при импорте.
+type lookupCountingStorage struct {
+	repository.Storage
+	lookups int
+}
+
+func (s *lookupCountingStorage) GetShortURLs(ctx context.Context, originalURLs []string) (map[string]string, error) {
+	s.lookups++
+	return s.Storage.GetShortURLs(ctx, originalURLs)
+}
+
+func TestImportStream(t *testing.T) {
+	log, err := logger.BuildLogger("ERROR")
+	require.NoError(t, err)
+	cfg := config.NewConfig(log, true)
+	cfg.StorageMode = storage.BaseStorage
+	base, err := repository.NewStorage(cfg, log)
+	require.NoError(t, err)
+	store := &lookupCountingStorage{Storage: base}
+	ctx := context.Background()
+
+	total := ImportChunkSize*2 + 10
+	rows := func(failAt int) func() (*models.ImportResult, error) {
+		line := 0
+		return func() (*models.ImportResult, error) {
+			if line == total {
+				return nil, io.EOF
+			}
+			line++
+			if line == failAt {
+				return nil, errors.New("connection reset")
+			}
+			return &models.ImportResult{Line: line, OriginalURL: fmt.Sprintf("https://example.com/%d", line)}, nil
+		}
+	}
+
+	var chunks, emitted int
+	checkpoint, err := ImportStream(ctx, store, cfg, 1, rows(0), func(chunk []*models.ImportResult) error {
+		chunks++
+		emitted += len(chunk)
+		for _, row := range chunk {
+			assert.Empty(t, row.Error)
+			assert.NotEmpty(t, row.ShortURL)
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, total, checkpoint)
+	assert.Equal(t, 3, chunks)
+	assert.Equal(t, total, emitted)
+	// Существующие ссылки ищутся одним запросом на часть, а не на каждую строку.
+	assert.Equal(t, 3, store.lookups)
+
+	// Точка продолжения указывает на последнюю сохранённую часть.
+	emitted = 0
+	checkpoint, err = ImportStream(ctx, store, cfg, 1, rows(ImportChunkSize+5), func(chunk []*models.ImportResult) error {
+		emitted += len(chunk)
+		for _, row := range chunk {
+			assert.Equal(t, ErrImportURLExist.Error(), row.Error)
+		}
+		return nil
+	})
+	require.Error(t, err)
+	assert.Equal(t, ImportChunkSize+4, checkpoint)
+	assert.Equal(t, ImportChunkSize+4, emitted)
+}
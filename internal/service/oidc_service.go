@@ -0,0 +1,140 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Melikhov-p/url-minimise/internal/auth"
+	"github.com/Melikhov-p/url-minimise/internal/config"
+	"github.com/Melikhov-p/url-minimise/internal/models"
+	"github.com/Melikhov-p/url-minimise/internal/repository"
+	storagePkg "github.com/Melikhov-p/url-minimise/internal/storage"
+	"github.com/Melikhov-p/url-minimise/internal/tracing"
+)
+
+// ErrOIDCDisabled вход через провайдера OpenID Connect не настроен.
+var ErrOIDCDisabled = errors.New("oidc login is not configured")
+
+// OIDCLogin завершить вход через провайдера OpenID Connect: обменять код авторизации на ID-токен
+// и войти в аккаунт, к которому привязан пользователь провайдера (sub). При первом входе аккаунт
+// создаётся с почтой из ID-токена. Если аккаунт с этой почтой уже зарегистрирован паролем, пользователь
+// провайдера привязывается к нему, только когда вход выполняется из сессии этого аккаунта.
+// Неподтверждённая провайдером почта не используется: пользователь провайдера привязывается только по sub.
+// Как и при входе по паролю, данные анонимной сессии current переходят в аккаунт.
+// Возвращает пользователя аккаунта с новым токеном и количество перенесённых адресов.
+func OIDCLogin(
+	ctx context.Context,
+	storage repository.Storage,
+	cfg *config.Config,
+	current *models.User,
+	code string,
+	login *auth.OIDCLogin,
+) (*models.User, int, error) {
+	ctx, span := tracing.Start(ctx, "service.OIDCLogin")
+	defer span.End()
+
+	if cfg.OIDC == nil {
+		return nil, 0, ErrOIDCDisabled
+	}
+
+	claims, err := cfg.OIDC.Exchange(ctx, code, login)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error exchanging oidc code %w", err)
+	}
+
+	identity, err := storage.GetOIDCIdentity(ctx, cfg.OIDC.Issuer, claims.Subject)
+	if errors.Is(err, storagePkg.ErrNotFound) {
+		identity, err = linkOIDCIdentity(ctx, storage, cfg.OIDC.Issuer, current, claims)
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("error getting oidc identity %w", err)
+	}
+
+	return signIn(ctx, storage, cfg, current, &models.Account{Email: identity.Email, UserID: identity.UserID})
+}
+
+// linkOIDCIdentity привязывает пользователя провайдера к аккаунту с его почтой, создавая аккаунт
+// без пароля, если его нет. К существующему аккаунту пользователь провайдера привязывается, только если
+// current — сессия этого аккаунта: подтверждённая провайдером почта не доказывает, что вход выполняет
+// владелец аккаунта, ведь провайдер может выдать её и другому человеку.
+func linkOIDCIdentity(
+	ctx context.Context,
+	storage repository.Storage,
+	issuer string,
+	current *models.User,
+	claims *auth.OIDCClaims,
+) (*models.OIDCIdentity, error) {
+	if !claims.EmailVerified {
+		return linkOIDCSubject(ctx, storage, issuer, current, claims)
+	}
+
+	email, err := normalizeEmail(claims.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	account, err := storage.GetAccount(ctx, email)
+	switch {
+	case err == nil && (current == nil || !current.Service.IsAuthenticated || current.ID != account.UserID):
+		return nil, fmt.Errorf("account %s must be signed in to link oidc identity %w", email, storagePkg.ErrAccountExist)
+	case errors.Is(err, storagePkg.ErrNotFound):
+		account = &models.Account{Email: email}
+		if err = storage.AddAccount(ctx, account); err != nil {
+			return nil, fmt.Errorf("error adding account %w", err)
+		}
+	case err != nil:
+		return nil, fmt.Errorf("error getting account %w", err)
+	}
+
+	return addOIDCIdentity(ctx, storage, &models.OIDCIdentity{
+		Issuer:  issuer,
+		Subject: claims.Subject,
+		Email:   email,
+		UserID:  account.UserID,
+	})
+}
+
+// linkOIDCSubject привязывает пользователя провайдера с неподтверждённой почтой только по sub: к текущей
+// сессии или к новому пользователю без почты. Аккаунт с этой почтой не создаётся и не привязывается,
+// иначе любой мог бы занять чужую почту и владелец не смог бы зарегистрироваться.
+func linkOIDCSubject(
+	ctx context.Context,
+	storage repository.Storage,
+	issuer string,
+	current *models.User,
+	claims *auth.OIDCClaims,
+) (*models.OIDCIdentity, error) {
+	identity := &models.OIDCIdentity{Issuer: issuer, Subject: claims.Subject}
+	if current != nil && current.Service.IsAuthenticated {
+		identity.UserID, identity.Email = current.ID, current.Email
+	} else {
+		user, err := storage.AddUser(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error adding user %w", err)
+		}
+		identity.UserID = user.ID
+	}
+
+	return addOIDCIdentity(ctx, storage, identity)
+}
+
+// addOIDCIdentity сохраняет привязку пользователя провайдера и возвращает действующую привязку.
+func addOIDCIdentity(
+	ctx context.Context,
+	storage repository.Storage,
+	identity *models.OIDCIdentity,
+) (*models.OIDCIdentity, error) {
+	err := storage.AddOIDCIdentity(ctx, identity)
+	if errors.Is(err, storagePkg.ErrIdentityExist) {
+		// Первый вход того же пользователя в другом запросе успел привязать его раньше.
+		if identity, err = storage.GetOIDCIdentity(ctx, identity.Issuer, identity.Subject); err != nil {
+			return nil, fmt.Errorf("error getting oidc identity %w", err)
+		}
+		return identity, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error linking oidc identity %w", err)
+	}
+	return identity, nil
+}
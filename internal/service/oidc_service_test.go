@@ -0,0 +1,142 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Melikhov-p/url-minimise/internal/auth"
+	"github.com/Melikhov-p/url-minimise/internal/auth/oidctest"
+	"github.com/Melikhov-p/url-minimise/internal/config"
+	"github.com/Melikhov-p/url-minimise/internal/logger"
+	"github.com/Melikhov-p/url-minimise/internal/models"
+	"github.com/Melikhov-p/url-minimise/internal/repository"
+	storagePkg "github.com/Melikhov-p/url-minimise/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOIDCLogin(t *testing.T) {
+	log, err := logger.BuildLogger("ERROR")
+	require.NoError(t, err)
+	cfg := config.NewConfig(log, true)
+	cfg.StorageMode = storagePkg.BaseStorage
+	store, err := repository.NewStorage(cfg, log)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	idp, err := oidctest.NewIdP()
+	require.NoError(t, err)
+	defer idp.Close()
+
+	// oidcLogin входит у провайдера пользователем user и завершает вход в сервисе.
+	oidcLogin := func(current *models.User, user oidctest.User) (*models.User, int, error) {
+		login, err := auth.NewOIDCLogin()
+		require.NoError(t, err)
+		idp.Login(user)
+		code, err := idp.Authorize(ctx, cfg.OIDC, login)
+		require.NoError(t, err)
+		return OIDCLogin(ctx, store, cfg, current, code, login)
+	}
+
+	_, _, err = OIDCLogin(ctx, store, cfg, nil, "code", &auth.OIDCLogin{})
+	assert.ErrorIs(t, err, ErrOIDCDisabled)
+	cfg.OIDC = auth.NewOIDCProvider(idp.Issuer(), oidctest.ClientID, "", "http://localhost/api/user/oidc/callback")
+
+	anonymous, err := AddNewUser(ctx, store, cfg)
+	require.NoError(t, err)
+	_, err = AddURL(ctx, store, log, "https://example.com/anonymous", cfg, anonymous.ID)
+	require.NoError(t, err)
+
+	// Первый вход создаёт аккаунт и переносит в него ссылки анонимной сессии.
+	alice := oidctest.User{Subject: "alice", Email: "Alice@Example.com", EmailVerified: true}
+	user, merged, err := oidcLogin(anonymous, alice)
+	require.NoError(t, err)
+	assert.Equal(t, 1, merged)
+	assert.Equal(t, "alice@example.com", user.Email)
+	assert.True(t, user.Registered())
+	assert.NotEmpty(t, user.Service.RefreshToken)
+
+	// Повторный вход по тому же sub попадает в тот же аккаунт, даже если почта у провайдера сменилась.
+	alice.Email = "alice.new@example.com"
+	again, _, err := oidcLogin(nil, alice)
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, again.ID)
+	assert.Equal(t, "alice@example.com", again.Email)
+
+	// У аккаунта, созданного через SSO, нет пароля.
+	_, _, err = Login(ctx, store, cfg, nil, "alice@example.com", "")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+
+	// К аккаунту с паролем пользователь провайдера привязывается только из сессии этого аккаунта,
+	// подтверждённой провайдером почты недостаточно.
+	registered, _, err := Register(ctx, store, cfg, nil, "bob@example.com", "password123")
+	require.NoError(t, err)
+	bobIdP := oidctest.User{Subject: "bob", Email: "bob@example.com", EmailVerified: true}
+	_, _, err = oidcLogin(nil, bobIdP)
+	assert.ErrorIs(t, err, storagePkg.ErrAccountExist)
+	_, _, err = oidcLogin(anonymous, bobIdP)
+	assert.ErrorIs(t, err, storagePkg.ErrAccountExist)
+	_, _, err = oidcLogin(user, bobIdP)
+	assert.ErrorIs(t, err, storagePkg.ErrAccountExist)
+
+	bob, _, err := oidcLogin(registered, bobIdP)
+	require.NoError(t, err)
+	assert.Equal(t, registered.ID, bob.ID)
+
+	// После привязки вход через провайдера работает и без сессии.
+	bob, _, err = oidcLogin(nil, bobIdP)
+	require.NoError(t, err)
+	assert.Equal(t, registered.ID, bob.ID)
+
+	_, _, err = oidcLogin(nil, oidctest.User{Subject: "nobody", EmailVerified: true})
+	assert.ErrorIs(t, err, ErrInvalidEmail)
+}
+
+func TestOIDCLogin_UnverifiedEmail(t *testing.T) {
+	log, err := logger.BuildLogger("ERROR")
+	require.NoError(t, err)
+	cfg := config.NewConfig(log, true)
+	cfg.StorageMode = storagePkg.BaseStorage
+	store, err := repository.NewStorage(cfg, log)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	idp, err := oidctest.NewIdP()
+	require.NoError(t, err)
+	defer idp.Close()
+	cfg.OIDC = auth.NewOIDCProvider(idp.Issuer(), oidctest.ClientID, "", "http://localhost/api/user/oidc/callback")
+
+	oidcLogin := func(current *models.User, user oidctest.User) (*models.User, int, error) {
+		login, err := auth.NewOIDCLogin()
+		require.NoError(t, err)
+		idp.Login(user)
+		code, err := idp.Authorize(ctx, cfg.OIDC, login)
+		require.NoError(t, err)
+		return OIDCLogin(ctx, store, cfg, current, code, login)
+	}
+
+	// Неподтверждённая почта не создаёт аккаунт: пользователь привязан только по sub.
+	mallory := oidctest.User{Subject: "mallory", Email: "victim@example.com", EmailVerified: false}
+	user, _, err := oidcLogin(nil, mallory)
+	require.NoError(t, err)
+	assert.False(t, user.Registered())
+	_, err = store.GetAccount(ctx, "victim@example.com")
+	assert.ErrorIs(t, err, storagePkg.ErrNotFound)
+
+	again, _, err := oidcLogin(nil, mallory)
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, again.ID)
+
+	// Владелец почты по-прежнему может зарегистрироваться.
+	victim, _, err := Register(ctx, store, cfg, nil, "victim@example.com", "password123")
+	require.NoError(t, err)
+	assert.NotEqual(t, user.ID, victim.ID)
+
+	// К аккаунту с этой почтой неподтверждённый пользователь провайдера не привязывается,
+	// а из сессии аккаунта привязывается к нему по sub.
+	other := oidctest.User{Subject: "other", Email: "victim@example.com", EmailVerified: false}
+	linked, _, err := oidcLogin(victim, other)
+	require.NoError(t, err)
+	assert.Equal(t, victim.ID, linked.ID)
+	assert.Equal(t, "victim@example.com", linked.Email)
+}
@@ -0,0 +1,43 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Melikhov-p/url-minimise/internal/config"
+	"github.com/Melikhov-p/url-minimise/internal/models"
+	"github.com/Melikhov-p/url-minimise/internal/repository"
+)
+
+// ErrURLBlocked домен оригинального URL запрещён политикой адресов.
+var ErrURLBlocked = errors.New("original URL is blocked by url policy")
+
+// CheckURLPolicy проверяет, что политика адресов разрешает сокращать все originalURLs.
+func CheckURLPolicy(cfg *config.Config, originalURLs ...string) error {
+	for _, originalURL := range originalURLs {
+		if !cfg.URLPolicy.Allowed(originalURL) {
+			return fmt.Errorf("%w: %s", ErrURLBlocked, originalURL)
+		}
+	}
+	return nil
+}
+
+// IsQuarantined ссылка находится в карантине или политика запрещает её адрес назначения location.
+// Проверка при переходе закрывает ссылки на домены, заблокированные после последнего обновления карантина.
+func IsQuarantined(cfg *config.Config, url *models.StorageURL, location string) bool {
+	return url.Quarantined || !cfg.URLPolicy.Allowed(url.OriginalURL) || !cfg.URLPolicy.Allowed(location)
+}
+
+// ApplyURLPolicy помещает в карантин ссылки, запрещённые текущей политикой адресов,
+// и снимает карантин с разрешённых. Возвращает количество помещённых в карантин и освобождённых ссылок.
+func ApplyURLPolicy(ctx context.Context, storage repository.Storage, cfg *config.Config) (int, int, error) {
+	quarantined, released, err := storage.UpdateQuarantine(ctx, func(originalURL string) bool {
+		return !cfg.URLPolicy.Allowed(originalURL)
+	})
+	if err != nil {
+		return 0, 0, fmt.Errorf("error updating quarantine %w", err)
+	}
+
+	return quarantined, released, nil
+}
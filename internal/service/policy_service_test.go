@@ -0,0 +1,74 @@
+package service
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Melikhov-p/url-minimise/internal/config"
+	"github.com/Melikhov-p/url-minimise/internal/logger"
+	"github.com/Melikhov-p/url-minimise/internal/models"
+	"github.com/Melikhov-p/url-minimise/internal/policy"
+	"github.com/Melikhov-p/url-minimise/internal/repository"
+	"github.com/Melikhov-p/url-minimise/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestURLPolicy(t *testing.T) {
+	log, err := logger.BuildLogger("ERROR")
+	require.NoError(t, err)
+	cfg := config.NewConfig(log, true)
+	cfg.StorageMode = storage.BaseStorage
+	store, err := repository.NewStorage(cfg, log)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	existing, err := AddURL(ctx, store, log, "https://shop.evil.com/login", cfg, 1)
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	require.NoError(t, os.WriteFile(path, []byte("*.evil.com\n"), 0600))
+	cfg.URLPolicy = policy.New(path, policy.ModeBlock)
+	_, err = cfg.URLPolicy.Reload()
+	require.NoError(t, err)
+
+	assert.NoError(t, CheckURLPolicy(cfg, "https://example.com", "https://evil.com"))
+	assert.ErrorIs(t, CheckURLPolicy(cfg, "https://example.com", "https://www.evil.com"), ErrURLBlocked)
+
+	_, err = AddURL(ctx, store, log, "https://www.evil.com", cfg, 1)
+	assert.ErrorIs(t, err, ErrURLBlocked)
+
+	// Адреса назначения правил и вариантов проверяются так же, как оригинальный URL.
+	rules := []models.RedirectRule{{Language: "en", Destination: "https://www.evil.com/en"}}
+	assert.ErrorIs(t, SetRedirectRules(ctx, store, cfg, existing.ShortURL, 1, rules), ErrURLBlocked)
+	variants := []models.Variant{
+		{Name: "a", Destination: "https://example.com/a", Weight: 1},
+		{Name: "b", Destination: "https://cdn.evil.com/b", Weight: 1},
+	}
+	assert.ErrorIs(t, SetVariants(ctx, store, cfg, existing.ShortURL, 1, variants), ErrURLBlocked)
+
+	// Ссылка, созданная до блокировки, закрыта при переходе ещё до обновления карантина.
+	assert.False(t, existing.Quarantined)
+	assert.True(t, IsQuarantined(cfg, existing, existing.OriginalURL))
+
+	quarantined, released, err := ApplyURLPolicy(ctx, store, cfg)
+	require.NoError(t, err)
+	assert.Equal(t, 1, quarantined)
+	assert.Zero(t, released)
+	stored, err := store.GetURL(ctx, existing.ShortURL)
+	require.NoError(t, err)
+	assert.True(t, stored.Quarantined)
+
+	safe := &models.StorageURL{OriginalURL: "https://example.com"}
+	assert.False(t, IsQuarantined(cfg, safe, "https://example.com/a"))
+	assert.True(t, IsQuarantined(cfg, safe, "https://cdn.evil.com/a"), "variant or rule destination is blocked")
+
+	cfg.URLPolicy = policy.New("", policy.ModeBlock)
+	quarantined, released, err = ApplyURLPolicy(ctx, store, cfg)
+	require.NoError(t, err)
+	assert.Zero(t, quarantined)
+	assert.Equal(t, 1, released)
+	assert.False(t, IsQuarantined(cfg, existing, existing.OriginalURL))
+}
@@ -0,0 +1,163 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/Melikhov-p/url-minimise/internal/models"
+)
+
+// ErrInvalidUTMTemplate шаблон UTM-меток заполнен неверно.
+var ErrInvalidUTMTemplate = errors.New("invalid utm template")
+
+// utmParams параметры, которые можно задать в шаблоне UTM-меток.
+var utmParams = map[string]struct{}{
+	"utm_source":   {},
+	"utm_medium":   {},
+	"utm_campaign": {},
+	"utm_term":     {},
+	"utm_content":  {},
+	"utm_id":       {},
+}
+
+// queryParam параметр строки запроса, порядок параметров сохраняется.
+type queryParam struct {
+	key   string
+	value string
+}
+
+// applyQuery дополняет адрес назначения UTM-метками ссылки и параметрами входящего запроса.
+// При совпадении имён параметры входящего запроса важнее UTM-меток, а UTM-метки важнее
+// параметров, уже записанных в адресе назначения. Прочие параметры адреса назначения
+// остаются на своих местах в исходном кодировании.
+func applyQuery(location string, u *models.StorageURL, visit *models.Visit, redirect *models.Redirect) string {
+	layers := make([][]queryParam, 0, 2)
+
+	if len(u.UTM) > 0 {
+		code, _ := models.SplitLinkKey(u.ShortURL)
+		replacer := strings.NewReplacer(
+			"{short}", code,
+			"{variant}", redirect.Variant,
+			"{device}", string(DetectDevice(visit.UserAgent)),
+		)
+
+		keys := make([]string, 0, len(u.UTM))
+		for key := range u.UTM {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		utm := make([]queryParam, 0, len(keys))
+		for _, key := range keys {
+			utm = append(utm, queryParam{key: key, value: replacer.Replace(u.UTM[key])})
+		}
+		layers = append(layers, utm)
+	}
+
+	if u.QueryPassthrough && visit.Query != "" {
+		if incoming := parseRawQuery(visit.Query); len(incoming) > 0 {
+			layers = append(layers, incoming)
+		}
+	}
+
+	if len(layers) == 0 {
+		return location
+	}
+	return mergeQuery(location, layers...)
+}
+
+// mergeQuery накладывает слои параметров на строку запроса адреса по порядку: параметры
+// очередного слоя заменяют все одноимённые параметры, добавленные раньше.
+func mergeQuery(location string, layers ...[]queryParam) string {
+	dest, err := url.Parse(location)
+	if err != nil {
+		return location
+	}
+
+	// Сегменты исходной строки запроса храним как есть, чтобы не менять их кодирование.
+	type segment struct {
+		key string
+		raw string
+	}
+	segments := make([]segment, 0)
+	for _, raw := range strings.Split(dest.RawQuery, "&") {
+		if raw == "" {
+			continue
+		}
+		rawKey, _, _ := strings.Cut(raw, "=")
+		key, err := url.QueryUnescape(rawKey)
+		if err != nil {
+			key = rawKey
+		}
+		segments = append(segments, segment{key: key, raw: raw})
+	}
+
+	for _, layer := range layers {
+		override := make(map[string]struct{}, len(layer))
+		for _, param := range layer {
+			override[param.key] = struct{}{}
+		}
+
+		kept := segments[:0]
+		for _, seg := range segments {
+			if _, ok := override[seg.key]; !ok {
+				kept = append(kept, seg)
+			}
+		}
+		segments = kept
+
+		for _, param := range layer {
+			segments = append(segments, segment{
+				key: param.key,
+				raw: url.QueryEscape(param.key) + "=" + url.QueryEscape(param.value),
+			})
+		}
+	}
+
+	raws := make([]string, 0, len(segments))
+	for _, seg := range segments {
+		raws = append(raws, seg.raw)
+	}
+	dest.RawQuery = strings.Join(raws, "&")
+
+	return dest.String()
+}
+
+// parseRawQuery разбирает строку запроса с сохранением порядка, пропуская неверно закодированные пары.
+func parseRawQuery(rawQuery string) []queryParam {
+	params := make([]queryParam, 0)
+	for _, raw := range strings.Split(rawQuery, "&") {
+		if raw == "" || strings.Contains(raw, ";") {
+			continue
+		}
+		rawKey, rawValue, _ := strings.Cut(raw, "=")
+
+		key, err := url.QueryUnescape(rawKey)
+		if err != nil || key == "" {
+			continue
+		}
+		value, err := url.QueryUnescape(rawValue)
+		if err != nil {
+			continue
+		}
+		params = append(params, queryParam{key: key, value: value})
+	}
+
+	return params
+}
+
+func validateUTM(utm map[string]string) error {
+	for key, value := range utm {
+		if _, ok := utmParams[key]; !ok {
+			return fmt.Errorf("%w: unknown parameter %q", ErrInvalidUTMTemplate, key)
+		}
+		if value == "" {
+			return fmt.Errorf("%w: empty value for %q", ErrInvalidUTMTemplate, key)
+		}
+	}
+
+	return nil
+}
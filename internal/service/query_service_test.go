@@ -0,0 +1,125 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/Melikhov-p/url-minimise/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyQuery(t *testing.T) {
+	testCases := []struct {
+		name        string
+		destination string
+		passthrough bool
+		utm         map[string]string
+		query       string
+		want        string
+	}{
+		{
+			name:        "Nothing To Apply",
+			destination: "https://example.com/p?path=%2Fa%2Fb&empty&x=a+b",
+			query:       "a=1",
+			want:        "https://example.com/p?path=%2Fa%2Fb&empty&x=a+b",
+		},
+		{
+			name:        "Passthrough Appends",
+			destination: "https://example.com/p?a=1",
+			passthrough: true,
+			query:       "b=2",
+			want:        "https://example.com/p?a=1&b=2",
+		},
+		{
+			name:        "Passthrough Without Destination Query",
+			destination: "https://example.com",
+			passthrough: true,
+			query:       "b=2",
+			want:        "https://example.com?b=2",
+		},
+		{
+			name:        "Incoming Overrides Destination",
+			destination: "https://example.com/?a=1&b=2",
+			passthrough: true,
+			query:       "a=9",
+			want:        "https://example.com/?b=2&a=9",
+		},
+		{
+			name:        "Multiple Values Replace All",
+			destination: "https://example.com/?a=0&a=00&b=1",
+			passthrough: true,
+			query:       "a=1&a=2",
+			want:        "https://example.com/?b=1&a=1&a=2",
+		},
+		{
+			name:        "Destination Encoding Preserved",
+			destination: "https://example.com/a%2Fb?path=%2Fx%2Fy&flag&sp=a+b",
+			passthrough: true,
+			query:       "c=3",
+			want:        "https://example.com/a%2Fb?path=%2Fx%2Fy&flag&sp=a+b&c=3",
+		},
+		{
+			name:        "Incoming Encoding Normalized",
+			destination: "https://example.com/",
+			passthrough: true,
+			query:       "q=hello+world&amp=a%26b&name=%D0%9F%D1%80%D0%B8%D0%B2%D0%B5%D1%82&sp=a%20b",
+			want:        "https://example.com/?q=hello+world&amp=a%26b&name=%D0%9F%D1%80%D0%B8%D0%B2%D0%B5%D1%82&sp=a+b",
+		},
+		{
+			name:        "Invalid Incoming Pairs Skipped",
+			destination: "https://example.com/",
+			passthrough: true,
+			query:       "bad=%zz&ok=1&semi=1;x=2&=novalue&&",
+			want:        "https://example.com/?ok=1",
+		},
+		{
+			name:        "Fragment Kept",
+			destination: "https://example.com/p?a=1#top",
+			passthrough: true,
+			query:       "b=2",
+			want:        "https://example.com/p?a=1&b=2#top",
+		},
+		{
+			name:        "Passthrough Disabled",
+			destination: "https://example.com/p",
+			query:       "b=2",
+			utm:         map[string]string{"utm_source": "short"},
+			want:        "https://example.com/p?utm_source=short",
+		},
+		{
+			name:        "UTM Overrides Destination",
+			destination: "https://example.com/?utm_source=old&x=1",
+			utm:         map[string]string{"utm_source": "new", "utm_medium": "email"},
+			want:        "https://example.com/?x=1&utm_medium=email&utm_source=new",
+		},
+		{
+			name:        "Incoming Overrides UTM",
+			destination: "https://example.com/",
+			passthrough: true,
+			utm:         map[string]string{"utm_campaign": "default", "utm_source": "short"},
+			query:       "utm_campaign=visitor",
+			want:        "https://example.com/?utm_source=short&utm_campaign=visitor",
+		},
+		{
+			name:        "UTM Template Placeholders",
+			destination: "https://example.com/",
+			utm:         map[string]string{"utm_campaign": "spring sale/{device}", "utm_content": "{short}"},
+			want:        "https://example.com/?utm_campaign=spring+sale%2Fdesktop&utm_content=abc",
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			u := &models.StorageURL{ShortURL: "abc", QueryPassthrough: test.passthrough, UTM: test.utm}
+			visit := &models.Visit{Query: test.query}
+
+			assert.Equal(t, test.want, applyQuery(test.destination, u, visit, &models.Redirect{}))
+		})
+	}
+}
+
+func TestValidateUTM(t *testing.T) {
+	assert.NoError(t, validateUTM(nil))
+	assert.NoError(t, validateUTM(map[string]string{"utm_source": "newsletter", "utm_id": "{short}"}))
+	assert.ErrorIs(t, validateUTM(map[string]string{"ref": "x"}), ErrInvalidUTMTemplate)
+	assert.ErrorIs(t, validateUTM(map[string]string{"utm_term": ""}), ErrInvalidUTMTemplate)
+}
@@ -0,0 +1,187 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	"github.com/Melikhov-p/url-minimise/internal/config"
+	"github.com/Melikhov-p/url-minimise/internal/models"
+	"github.com/Melikhov-p/url-minimise/internal/repository"
+	"github.com/Melikhov-p/url-minimise/internal/tracing"
+)
+
+// ErrInvalidRedirectCode недопустимый код редиректа.
+var ErrInvalidRedirectCode = errors.New("redirect code must be one of 301, 302, 307, 308")
+
+// ErrNotURLOwner адрес не принадлежит пользователю.
+var ErrNotURLOwner = errors.New("url does not belong to user")
+
+// ErrInvalidActiveWindow окно активности ссылки закрывается раньше, чем открывается.
+var ErrInvalidActiveWindow = errors.New("active_until must be after active_from")
+
+// ErrLinkNotYetActive окно активности ссылки ещё не открылось.
+var ErrLinkNotYetActive = errors.New("link is not yet active")
+
+// ErrLinkExpired окно активности ссылки уже закрылось.
+var ErrLinkExpired = errors.New("link is expired")
+
+// DefaultRedirectCode код ответа для ссылок без явно выбранного кода.
+const DefaultRedirectCode = http.StatusTemporaryRedirect
+
+// rulesVary заголовки запроса, от которых зависит адрес ссылки с правилами перенаправления.
+const rulesVary = "User-Agent, Accept-Language"
+
+// ResolveRedirect определяет адрес, код ответа и политику кеширования для перехода по ссылке.
+func ResolveRedirect(url *models.StorageURL, visit *models.Visit, cfg *config.Config) *models.Redirect {
+	redirect := &models.Redirect{
+		Location: url.OriginalURL,
+		Code:     RedirectCode(url),
+	}
+	if rule, ok := matchRule(url.Rules, visit); ok {
+		redirect.Location = rule.Destination
+	} else if variant, ok := pickVariant(url.Variants, visit.Variant, rand.IntN); ok {
+		redirect.Location = variant.Destination
+		redirect.Variant = variant.Name
+	}
+	redirect.Location = applyQuery(redirect.Location, url, visit, redirect)
+
+	switch {
+	case url.NoCache:
+		redirect.CacheControl = "no-store"
+	case len(url.Rules) > 0:
+		// Адрес зависит от устройства и языка посетителя, поэтому ответ кешируется только браузером,
+		// и не дольше, чем до ближайшей границы окна времени правила.
+		redirect.Vary = rulesVary
+		redirect.CacheControl = rulesCacheControl(url.Rules, visit.Time, redirectMaxAge(redirect.Code, cfg))
+	case isPermanentRedirect(redirect.Code) && redirect.Variant == "":
+		redirect.CacheControl = fmt.Sprintf("public, max-age=%d", int(cfg.PermanentRedirectMaxAge.Seconds()))
+	case isPermanentRedirect(redirect.Code):
+		// Вариант закреплён за посетителем, общие кеши не должны раздавать его остальным.
+		redirect.CacheControl = fmt.Sprintf("private, max-age=%d", int(cfg.PermanentRedirectMaxAge.Seconds()))
+	default:
+		redirect.CacheControl = fmt.Sprintf("private, max-age=%d", int(cfg.TemporaryRedirectMaxAge.Seconds()))
+	}
+
+	return redirect
+}
+
+// redirectMaxAge сколько браузер может хранить редирект с кодом code.
+func redirectMaxAge(code int, cfg *config.Config) time.Duration {
+	if isPermanentRedirect(code) {
+		return cfg.PermanentRedirectMaxAge
+	}
+	return cfg.TemporaryRedirectMaxAge
+}
+
+// rulesCacheControl политика кеширования ссылки с правилами: срок maxAge сокращается до ближайшей
+// после now границы окна времени какого-либо правила, когда может смениться адрес. Если граница
+// ближе секунды, ответ не кешируется.
+func rulesCacheControl(rules []models.RedirectRule, now time.Time, maxAge time.Duration) string {
+	for i := range rules {
+		for _, bound := range []*time.Time{rules[i].NotBefore, rules[i].NotAfter} {
+			if bound != nil && bound.After(now) && bound.Sub(now) < maxAge {
+				maxAge = bound.Sub(now)
+			}
+		}
+	}
+
+	if maxAge < time.Second {
+		return "no-store"
+	}
+	return fmt.Sprintf("private, max-age=%d", int(maxAge.Seconds()))
+}
+
+// CheckActiveWindow проверяет, что ссылка активна в момент now. Граница active_until не входит в окно.
+func CheckActiveWindow(url *models.StorageURL, now time.Time) error {
+	if url.ActiveFrom != nil && now.Before(*url.ActiveFrom) {
+		return ErrLinkNotYetActive
+	}
+	if url.ActiveUntil != nil && !now.Before(*url.ActiveUntil) {
+		return ErrLinkExpired
+	}
+
+	return nil
+}
+
+// RedirectCode код ответа, с которым ссылка отдаёт редирект.
+func RedirectCode(url *models.StorageURL) int {
+	if url.RedirectCode == 0 {
+		return DefaultRedirectCode
+	}
+	return url.RedirectCode
+}
+
+// UpdateURLSettings изменить настройки адреса владельцем.
+func UpdateURLSettings(
+	ctx context.Context,
+	storage repository.Storage,
+	shortURL string,
+	userID int,
+	settings *models.URLSettingsRequest,
+) (*models.StorageURL, error) {
+	ctx, span := tracing.Start(ctx, "service.UpdateURLSettings")
+	defer span.End()
+
+	stored, err := storage.GetURL(ctx, shortURL)
+	if err != nil {
+		return nil, fmt.Errorf("error getting url for update %w", err)
+	}
+	if stored.UserID != userID {
+		return nil, ErrNotURLOwner
+	}
+
+	updated := *stored
+	if settings.RedirectCode != nil {
+		if !isValidRedirectCode(*settings.RedirectCode) {
+			return nil, ErrInvalidRedirectCode
+		}
+		updated.RedirectCode = *settings.RedirectCode
+	}
+	if settings.NoCache != nil {
+		updated.NoCache = *settings.NoCache
+	}
+	if settings.QueryPassthrough != nil {
+		updated.QueryPassthrough = *settings.QueryPassthrough
+	}
+	if settings.ActiveFrom.Set {
+		updated.ActiveFrom = settings.ActiveFrom.Time
+	}
+	if settings.ActiveUntil.Set {
+		updated.ActiveUntil = settings.ActiveUntil.Time
+	}
+	if updated.ActiveFrom != nil && updated.ActiveUntil != nil && !updated.ActiveFrom.Before(*updated.ActiveUntil) {
+		return nil, ErrInvalidActiveWindow
+	}
+	if settings.UTM != nil {
+		if err = validateUTM(settings.UTM); err != nil {
+			return nil, err
+		}
+		updated.UTM = settings.UTM
+		if len(updated.UTM) == 0 {
+			updated.UTM = nil
+		}
+	}
+
+	if err = storage.UpdateURL(ctx, &updated); err != nil {
+		return nil, fmt.Errorf("error updating url settings %w", err)
+	}
+
+	return &updated, nil
+}
+
+func isValidRedirectCode(code int) bool {
+	switch code {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	default:
+		return false
+	}
+}
+
+func isPermanentRedirect(code int) bool {
+	return code == http.StatusMovedPermanently || code == http.StatusPermanentRedirect
+}
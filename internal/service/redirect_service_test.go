@@ -0,0 +1,154 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Melikhov-p/url-minimise/internal/config"
+	"github.com/Melikhov-p/url-minimise/internal/logger"
+	"github.com/Melikhov-p/url-minimise/internal/models"
+	"github.com/Melikhov-p/url-minimise/internal/repository"
+	storagePkg "github.com/Melikhov-p/url-minimise/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveRedirect(t *testing.T) {
+	log, err := logger.BuildLogger("ERROR")
+	require.NoError(t, err)
+	cfg := config.NewConfig(log, true)
+	cfg.PermanentRedirectMaxAge = time.Hour
+	cfg.TemporaryRedirectMaxAge = time.Minute
+
+	testCases := []struct {
+		name             string
+		url              *models.StorageURL
+		wantCode         int
+		wantCacheControl string
+	}{
+		{
+			name:             "Default",
+			url:              &models.StorageURL{OriginalURL: "https://example.com"},
+			wantCode:         http.StatusTemporaryRedirect,
+			wantCacheControl: "private, max-age=60",
+		},
+		{
+			name:             "Permanent",
+			url:              &models.StorageURL{OriginalURL: "https://example.com", RedirectCode: 301},
+			wantCode:         http.StatusMovedPermanently,
+			wantCacheControl: "public, max-age=3600",
+		},
+		{
+			name:             "PermanentRedirect",
+			url:              &models.StorageURL{OriginalURL: "https://example.com", RedirectCode: 308},
+			wantCode:         http.StatusPermanentRedirect,
+			wantCacheControl: "public, max-age=3600",
+		},
+		{
+			name:             "Found",
+			url:              &models.StorageURL{OriginalURL: "https://example.com", RedirectCode: 302},
+			wantCode:         http.StatusFound,
+			wantCacheControl: "private, max-age=60",
+		},
+		{
+			name:             "Tracked",
+			url:              &models.StorageURL{OriginalURL: "https://example.com", RedirectCode: 301, NoCache: true},
+			wantCode:         http.StatusMovedPermanently,
+			wantCacheControl: "no-store",
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			redirect := ResolveRedirect(test.url, &models.Visit{}, cfg)
+			assert.Equal(t, test.url.OriginalURL, redirect.Location)
+			assert.Equal(t, test.wantCode, redirect.Code)
+			assert.Equal(t, test.wantCacheControl, redirect.CacheControl)
+		})
+	}
+}
+
+func TestUpdateURLSettings(t *testing.T) {
+	log, err := logger.BuildLogger("ERROR")
+	require.NoError(t, err)
+	cfg := config.NewConfig(log, true)
+	cfg.Storage.FileStorage.FilePath = filepath.Join(t.TempDir(), "storage.txt")
+	store, err := repository.NewStorage(cfg, log)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	newURL, err := AddURL(ctx, store, log, "settings/original", cfg, 1)
+	require.NoError(t, err)
+
+	permanent, invalid, noCache := 301, 200, true
+
+	_, err = UpdateURLSettings(ctx, store, "unknown", 1, &models.URLSettingsRequest{RedirectCode: &permanent})
+	assert.ErrorIs(t, err, storagePkg.ErrNotFound)
+
+	_, err = UpdateURLSettings(ctx, store, newURL.ShortURL, 2, &models.URLSettingsRequest{RedirectCode: &permanent})
+	assert.ErrorIs(t, err, ErrNotURLOwner)
+
+	_, err = UpdateURLSettings(ctx, store, newURL.ShortURL, 1, &models.URLSettingsRequest{RedirectCode: &invalid})
+	assert.ErrorIs(t, err, ErrInvalidRedirectCode)
+
+	updated, err := UpdateURLSettings(ctx, store, newURL.ShortURL, 1, &models.URLSettingsRequest{
+		RedirectCode: &permanent,
+		NoCache:      &noCache,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, permanent, updated.RedirectCode)
+	assert.True(t, updated.NoCache)
+
+	stored, err := store.GetURL(ctx, newURL.ShortURL)
+	require.NoError(t, err)
+	assert.Equal(t, permanent, stored.RedirectCode)
+}
+
+func TestCheckActiveWindow(t *testing.T) {
+	from := time.Date(2026, 11, 1, 9, 0, 0, 0, time.UTC)
+	until := from.Add(7 * 24 * time.Hour)
+	url := &models.StorageURL{ActiveFrom: &from, ActiveUntil: &until}
+
+	assert.ErrorIs(t, CheckActiveWindow(url, from.Add(-time.Second)), ErrLinkNotYetActive)
+	assert.NoError(t, CheckActiveWindow(url, from))
+	assert.NoError(t, CheckActiveWindow(url, until.Add(-time.Second)))
+	assert.ErrorIs(t, CheckActiveWindow(url, until), ErrLinkExpired)
+	assert.NoError(t, CheckActiveWindow(&models.StorageURL{}, from))
+}
+
+func TestUpdateURLSettings_ActiveWindow(t *testing.T) {
+	log, err := logger.BuildLogger("ERROR")
+	require.NoError(t, err)
+	cfg := config.NewConfig(log, true)
+	cfg.Storage.FileStorage.FilePath = filepath.Join(t.TempDir(), "storage.txt")
+	store, err := repository.NewStorage(cfg, log)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	newURL, err := AddURL(ctx, store, log, "window/original", cfg, 1)
+	require.NoError(t, err)
+
+	update := func(body string) (*models.StorageURL, error) {
+		var req models.URLSettingsRequest
+		require.NoError(t, json.Unmarshal([]byte(body), &req))
+		return UpdateURLSettings(ctx, store, newURL.ShortURL, 1, &req)
+	}
+
+	updated, err := update(`{"active_from":"2026-11-01T09:00:00Z","active_until":"2026-11-08T09:00:00Z"}`)
+	require.NoError(t, err)
+	require.NotNil(t, updated.ActiveFrom)
+	require.NotNil(t, updated.ActiveUntil)
+
+	// Отсутствующее поле не меняется, null снимает ограничение.
+	updated, err = update(`{"active_until":null}`)
+	require.NoError(t, err)
+	assert.NotNil(t, updated.ActiveFrom)
+	assert.Nil(t, updated.ActiveUntil)
+
+	_, err = update(`{"active_until":"2026-10-01T00:00:00Z"}`)
+	assert.ErrorIs(t, err, ErrInvalidActiveWindow)
+}
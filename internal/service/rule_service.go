@@ -0,0 +1,198 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Melikhov-p/url-minimise/internal/config"
+	"github.com/Melikhov-p/url-minimise/internal/models"
+	"github.com/Melikhov-p/url-minimise/internal/repository"
+	"github.com/Melikhov-p/url-minimise/internal/tracing"
+)
+
+// ErrInvalidRedirectRule правило редиректа заполнено неверно.
+var ErrInvalidRedirectRule = errors.New("invalid redirect rule")
+
+// maxRedirectRules максимальное количество правил у одной ссылки.
+const maxRedirectRules = 20
+
+// SetRedirectRules заменить правила условного редиректа ссылки владельцем.
+func SetRedirectRules(
+	ctx context.Context,
+	storage repository.Storage,
+	cfg *config.Config,
+	shortURL string,
+	userID int,
+	rules []models.RedirectRule,
+) error {
+	ctx, span := tracing.Start(ctx, "service.SetRedirectRules")
+	defer span.End()
+
+	if err := validateRedirectRules(rules); err != nil {
+		return err
+	}
+	destinations := make([]string, 0, len(rules))
+	for i := range rules {
+		destinations = append(destinations, rules[i].Destination)
+	}
+	if err := CheckURLPolicy(cfg, destinations...); err != nil {
+		return err
+	}
+
+	stored, err := storage.GetURL(ctx, shortURL)
+	if err != nil {
+		return fmt.Errorf("error getting url for rules %w", err)
+	}
+	if stored.UserID != userID {
+		return ErrNotURLOwner
+	}
+
+	if err = storage.SetRedirectRules(ctx, shortURL, userID, rules); err != nil {
+		return fmt.Errorf("error setting redirect rules %w", err)
+	}
+
+	return nil
+}
+
+// GetRedirectRules получить правила условного редиректа ссылки владельцем.
+func GetRedirectRules(
+	ctx context.Context,
+	storage repository.Storage,
+	shortURL string,
+	userID int,
+) ([]models.RedirectRule, error) {
+	ctx, span := tracing.Start(ctx, "service.GetRedirectRules")
+	defer span.End()
+
+	stored, err := storage.GetURL(ctx, shortURL)
+	if err != nil {
+		return nil, fmt.Errorf("error getting url for rules %w", err)
+	}
+	if stored.UserID != userID {
+		return nil, ErrNotURLOwner
+	}
+
+	if stored.Rules == nil {
+		return []models.RedirectRule{}, nil
+	}
+	return stored.Rules, nil
+}
+
+// DetectDevice определяет класс устройства по User-Agent.
+func DetectDevice(userAgent string) models.DeviceClass {
+	switch {
+	case strings.Contains(userAgent, "iPhone"),
+		strings.Contains(userAgent, "iPad"),
+		strings.Contains(userAgent, "iPod"):
+		return models.DeviceIOS
+	case strings.Contains(userAgent, "Android"):
+		return models.DeviceAndroid
+	default:
+		return models.DeviceDesktop
+	}
+}
+
+// PreferredLanguage возвращает язык с наибольшим весом из заголовка Accept-Language.
+func PreferredLanguage(acceptLanguage string) string {
+	type weightedLang struct {
+		tag    string
+		weight float64
+	}
+
+	langs := make([]weightedLang, 0)
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if tag == "" || tag == "*" {
+			continue
+		}
+
+		weight := 1.0
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(q, 64)
+			if err != nil {
+				continue
+			}
+			weight = parsed
+		}
+		if weight <= 0 {
+			continue
+		}
+		langs = append(langs, weightedLang{tag: strings.ToLower(tag), weight: weight})
+	}
+
+	if len(langs) == 0 {
+		return ""
+	}
+	sort.SliceStable(langs, func(i, j int) bool { return langs[i].weight > langs[j].weight })
+
+	return langs[0].tag
+}
+
+// matchRule возвращает первое подходящее посетителю правило.
+func matchRule(rules []models.RedirectRule, visit *models.Visit) (*models.RedirectRule, bool) {
+	if len(rules) == 0 {
+		return nil, false
+	}
+
+	device := DetectDevice(visit.UserAgent)
+	lang := PreferredLanguage(visit.AcceptLanguage)
+
+	for i := range rules {
+		rule := &rules[i]
+		if rule.Device != "" && rule.Device != device {
+			continue
+		}
+		if rule.Language != "" && !languageMatches(rule.Language, lang) {
+			continue
+		}
+		if rule.NotBefore != nil && visit.Time.Before(*rule.NotBefore) {
+			continue
+		}
+		if rule.NotAfter != nil && !visit.Time.Before(*rule.NotAfter) {
+			continue
+		}
+		return rule, true
+	}
+
+	return nil, false
+}
+
+// languageMatches язык посетителя совпадает с языком правила или уточняет его ("en" подходит для "en-us").
+func languageMatches(ruleLang, visitorLang string) bool {
+	ruleLang = strings.ToLower(ruleLang)
+	return visitorLang == ruleLang || strings.HasPrefix(visitorLang, ruleLang+"-")
+}
+
+func validateRedirectRules(rules []models.RedirectRule) error {
+	if len(rules) > maxRedirectRules {
+		return fmt.Errorf("%w: no more than %d rules per link", ErrInvalidRedirectRule, maxRedirectRules)
+	}
+
+	for i := range rules {
+		rule := &rules[i]
+		switch rule.Device {
+		case "", models.DeviceIOS, models.DeviceAndroid, models.DeviceDesktop:
+		default:
+			return fmt.Errorf("%w: unknown device %q", ErrInvalidRedirectRule, rule.Device)
+		}
+
+		if rule.Device == "" && rule.Language == "" && rule.NotBefore == nil && rule.NotAfter == nil {
+			return fmt.Errorf("%w: rule %d has no conditions", ErrInvalidRedirectRule, i)
+		}
+		if rule.NotBefore != nil && rule.NotAfter != nil && !rule.NotBefore.Before(*rule.NotAfter) {
+			return fmt.Errorf("%w: rule %d has empty time window", ErrInvalidRedirectRule, i)
+		}
+
+		destination, err := url.Parse(rule.Destination)
+		if err != nil || destination.Scheme == "" || destination.Host == "" {
+			return fmt.Errorf("%w: rule %d has invalid destination", ErrInvalidRedirectRule, i)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,172 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Melikhov-p/url-minimise/internal/config"
+	"github.com/Melikhov-p/url-minimise/internal/logger"
+	"github.com/Melikhov-p/url-minimise/internal/models"
+	"github.com/Melikhov-p/url-minimise/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	iPhoneUA  = "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 Mobile/15E148"
+	androidUA = "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 Chrome/120.0 Mobile Safari/537.36"
+	desktopUA = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 Chrome/120.0 Safari/537.36"
+)
+
+func TestDetectDevice(t *testing.T) {
+	assert.Equal(t, models.DeviceIOS, DetectDevice(iPhoneUA))
+	assert.Equal(t, models.DeviceAndroid, DetectDevice(androidUA))
+	assert.Equal(t, models.DeviceDesktop, DetectDevice(desktopUA))
+	assert.Equal(t, models.DeviceDesktop, DetectDevice(""))
+}
+
+func TestPreferredLanguage(t *testing.T) {
+	testCases := []struct {
+		header string
+		want   string
+	}{
+		{header: "", want: ""},
+		{header: "ru", want: "ru"},
+		{header: "en-US,en;q=0.9,ru;q=0.8", want: "en-us"},
+		{header: "de;q=0.5, fr;q=0.7", want: "fr"},
+		{header: "*;q=1, es;q=0.3", want: "es"},
+		{header: "it;q=0, pt", want: "pt"},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.header, func(t *testing.T) {
+			assert.Equal(t, test.want, PreferredLanguage(test.header))
+		})
+	}
+}
+
+func TestResolveRedirect_Rules(t *testing.T) {
+	log, err := logger.BuildLogger("ERROR")
+	require.NoError(t, err)
+	cfg := config.NewConfig(log, true)
+
+	launch := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	url := &models.StorageURL{
+		OriginalURL: "https://example.com",
+		Rules: []models.RedirectRule{
+			{Device: models.DeviceIOS, Destination: "https://apps.apple.com/app"},
+			{Device: models.DeviceAndroid, Destination: "https://play.google.com/app"},
+			{Language: "ru", NotBefore: &launch, Destination: "https://example.ru/launch"},
+			{Language: "ru", Destination: "https://example.ru"},
+		},
+	}
+
+	testCases := []struct {
+		name  string
+		visit *models.Visit
+		want  string
+	}{
+		{
+			name:  "iOS",
+			visit: &models.Visit{UserAgent: iPhoneUA, AcceptLanguage: "ru", Time: launch},
+			want:  "https://apps.apple.com/app",
+		},
+		{
+			name:  "Android",
+			visit: &models.Visit{UserAgent: androidUA},
+			want:  "https://play.google.com/app",
+		},
+		{
+			name:  "Language After Launch",
+			visit: &models.Visit{UserAgent: desktopUA, AcceptLanguage: "ru-RU,en;q=0.5", Time: launch},
+			want:  "https://example.ru/launch",
+		},
+		{
+			name:  "Language Before Launch",
+			visit: &models.Visit{UserAgent: desktopUA, AcceptLanguage: "ru", Time: launch.Add(-time.Second)},
+			want:  "https://example.ru",
+		},
+		{
+			name:  "Default",
+			visit: &models.Visit{UserAgent: desktopUA, AcceptLanguage: "en"},
+			want:  "https://example.com",
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.want, ResolveRedirect(url, test.visit, cfg).Location)
+		})
+	}
+}
+
+func TestResolveRedirect_RulesCache(t *testing.T) {
+	cfg := &config.Config{PermanentRedirectMaxAge: time.Hour, TemporaryRedirectMaxAge: time.Minute}
+	now := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	launch := now.Add(10 * time.Minute)
+	url := &models.StorageURL{
+		OriginalURL:  "https://example.com",
+		RedirectCode: http.StatusMovedPermanently,
+		Rules:        []models.RedirectRule{{Device: models.DeviceIOS, Destination: "https://apps.apple.com/app"}},
+	}
+
+	// Постоянный редирект с правилами не попадает в общие кеши и зависит от заголовков посетителя.
+	redirect := ResolveRedirect(url, &models.Visit{UserAgent: iPhoneUA, Time: now}, cfg)
+	assert.Equal(t, "private, max-age=3600", redirect.CacheControl)
+	assert.Equal(t, "User-Agent, Accept-Language", redirect.Vary)
+
+	// Кеш живёт не дольше, чем до открытия окна правила.
+	url.Rules = append(url.Rules,
+		models.RedirectRule{Language: "ru", NotBefore: &launch, Destination: "https://example.ru"})
+	redirect = ResolveRedirect(url, &models.Visit{UserAgent: desktopUA, AcceptLanguage: "ru", Time: now}, cfg)
+	assert.Equal(t, "https://example.com", redirect.Location)
+	assert.Equal(t, "private, max-age=600", redirect.CacheControl)
+
+	redirect = ResolveRedirect(url, &models.Visit{AcceptLanguage: "ru", Time: launch.Add(-time.Millisecond)}, cfg)
+	assert.Equal(t, "no-store", redirect.CacheControl)
+
+	// Прошедшие границы окна срок не сокращают.
+	redirect = ResolveRedirect(url, &models.Visit{AcceptLanguage: "ru", Time: launch}, cfg)
+	assert.Equal(t, "https://example.ru", redirect.Location)
+	assert.Equal(t, "private, max-age=3600", redirect.CacheControl)
+}
+
+func TestSetRedirectRules(t *testing.T) {
+	log, err := logger.BuildLogger("ERROR")
+	require.NoError(t, err)
+	cfg := config.NewConfig(log, true)
+	cfg.Storage.FileStorage.FilePath = filepath.Join(t.TempDir(), "storage.txt")
+	store, err := repository.NewStorage(cfg, log)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	newURL, err := AddURL(ctx, store, log, "https://example.com/app", cfg, 1)
+	require.NoError(t, err)
+
+	from := time.Now()
+	until := from.Add(-time.Hour)
+
+	invalid := [][]models.RedirectRule{
+		{{Device: "tv", Destination: "https://example.com"}},
+		{{Destination: "https://example.com"}},
+		{{NotBefore: &from, NotAfter: &until, Destination: "https://example.com"}},
+		{{Language: "en", Destination: "/relative"}},
+	}
+	for _, rules := range invalid {
+		assert.ErrorIs(t, SetRedirectRules(ctx, store, cfg, newURL.ShortURL, 1, rules), ErrInvalidRedirectRule)
+	}
+
+	rules := []models.RedirectRule{{Device: models.DeviceIOS, Destination: "https://apps.apple.com/app"}}
+	assert.ErrorIs(t, SetRedirectRules(ctx, store, cfg, newURL.ShortURL, 2, rules), ErrNotURLOwner)
+	require.NoError(t, SetRedirectRules(ctx, store, cfg, newURL.ShortURL, 1, rules))
+
+	stored, err := GetRedirectRules(ctx, store, newURL.ShortURL, 1)
+	require.NoError(t, err)
+	assert.Equal(t, rules, stored)
+
+	_, err = GetRedirectRules(ctx, store, newURL.ShortURL, 2)
+	assert.ErrorIs(t, err, ErrNotURLOwner)
+}
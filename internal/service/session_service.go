@@ -0,0 +1,181 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Melikhov-p/url-minimise/internal/auth"
+	"github.com/Melikhov-p/url-minimise/internal/config"
+	"github.com/Melikhov-p/url-minimise/internal/models"
+	"github.com/Melikhov-p/url-minimise/internal/repository"
+	storagePkg "github.com/Melikhov-p/url-minimise/internal/storage"
+	"github.com/Melikhov-p/url-minimise/internal/tracing"
+	"go.uber.org/zap"
+)
+
+// ErrInvalidRefreshToken токен обновления не существует, истёк, отозван или уже использован.
+var ErrInvalidRefreshToken = errors.New("invalid refresh token")
+
+// ErrTokenRevoked токен доступа отозван выходом из сессии.
+var ErrTokenRevoked = errors.New("token revoked")
+
+// IssueTokens начать новую сессию пользователя: выдать токен доступа и токен обновления.
+func IssueTokens(ctx context.Context, storage repository.Storage, cfg *config.Config, user *models.User) error {
+	token, refresh, err := newRefreshToken(cfg, user, "")
+	if err != nil {
+		return err
+	}
+	if err = storage.AddRefreshToken(ctx, token); err != nil {
+		return fmt.Errorf("error saving refresh token %w", err)
+	}
+
+	return setTokens(cfg, user, refresh)
+}
+
+// RefreshTokens обменять токен обновления на новую пару токенов той же сессии. Предъявленный токен
+// заменяется следующим и больше не действует. Повторное предъявление заменённого токена значит,
+// что токен скопирован, поэтому отзывается вся сессия.
+func RefreshTokens(
+	ctx context.Context,
+	storage repository.Storage,
+	cfg *config.Config,
+	logger *zap.Logger,
+	rawToken string,
+) (*models.User, error) {
+	ctx, span := tracing.Start(ctx, "service.RefreshTokens")
+	defer span.End()
+
+	token, err := findRefreshToken(ctx, storage, rawToken)
+	if err != nil {
+		return nil, err
+	}
+	if token.ReplacedBy != "" {
+		logger.Warn("refresh token reused, revoking session", zap.Int("user_id", token.UserID))
+		return nil, revokeSession(ctx, storage, token.Family)
+	}
+	if !token.Active(time.Now()) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	user := repository.NewEmptyUser()
+	user.ID = token.UserID
+	user.Email = token.Email
+
+	next, refresh, err := newRefreshToken(cfg, user, token.Family)
+	if err != nil {
+		return nil, err
+	}
+	err = storage.RotateRefreshToken(ctx, token.ID, next)
+	if errors.Is(err, storagePkg.ErrRefreshTokenUsed) {
+		logger.Warn("refresh token used concurrently, revoking session", zap.Int("user_id", token.UserID))
+		return nil, revokeSession(ctx, storage, token.Family)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error rotating refresh token %w", err)
+	}
+
+	if err = setTokens(cfg, user, refresh); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// Logout завершить сессию: отозвать токен доступа до истечения его срока и все токены обновления сессии.
+// Недействительные и пустые токены пропускаются.
+func Logout(
+	ctx context.Context,
+	storage repository.Storage,
+	cfg *config.Config,
+	accessToken string,
+	refreshToken string,
+) error {
+	ctx, span := tracing.Start(ctx, "service.Logout")
+	defer span.End()
+
+	if identity, err := auth.ParseToken(accessToken, cfg.SigningKeys); err == nil && identity.ID != "" {
+		err = storage.RevokeToken(ctx, &models.RevokedToken{ExpiresAt: identity.ExpiresAt, ID: identity.ID})
+		if err != nil {
+			return fmt.Errorf("error revoking access token %w", err)
+		}
+	}
+
+	token, err := findRefreshToken(ctx, storage, refreshToken)
+	if errors.Is(err, ErrInvalidRefreshToken) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err = storage.RevokeRefreshTokens(ctx, token.Family); err != nil {
+		return fmt.Errorf("error revoking refresh tokens %w", err)
+	}
+
+	return nil
+}
+
+// findRefreshToken находит сохранённый токен обновления и сверяет его секрет.
+func findRefreshToken(ctx context.Context, storage repository.Storage, rawToken string) (*models.RefreshToken, error) {
+	id, secret, ok := auth.ParseRefreshToken(rawToken)
+	if !ok {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	token, err := storage.GetRefreshToken(ctx, id)
+	if errors.Is(err, storagePkg.ErrNotFound) {
+		return nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting refresh token %w", err)
+	}
+	if !auth.CheckSecret(secret, token.Hash) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	return token, nil
+}
+
+// revokeSession отзывает токены обновления сессии и возвращает ErrInvalidRefreshToken.
+func revokeSession(ctx context.Context, storage repository.Storage, family string) error {
+	if err := storage.RevokeRefreshTokens(ctx, family); err != nil {
+		return fmt.Errorf("error revoking refresh tokens %w", err)
+	}
+	return ErrInvalidRefreshToken
+}
+
+// newRefreshToken создаёт токен обновления пользователя в сессии family, пустая family — новая сессия.
+// Возвращает токен для хранения и сам токен для клиента.
+func newRefreshToken(cfg *config.Config, user *models.User, family string) (*models.RefreshToken, string, error) {
+	id, refresh, hash, err := auth.GenerateRefreshToken()
+	if err != nil {
+		return nil, "", fmt.Errorf("error generating refresh token %w", err)
+	}
+	if family == "" {
+		family = id
+	}
+
+	now := time.Now()
+	return &models.RefreshToken{
+		CreatedAt: now,
+		ExpiresAt: now.Add(cfg.RefreshTokenLifeTime),
+		ID:        id,
+		Family:    family,
+		Hash:      hash,
+		Email:     user.Email,
+		UserID:    user.ID,
+	}, refresh, nil
+}
+
+// setTokens записывает пользователю новый токен доступа и токен обновления refresh.
+func setTokens(cfg *config.Config, user *models.User, refresh string) error {
+	token, err := auth.BuildAccountJWTString(user.ID, user.Email, cfg.SigningKeys, cfg.JWTTokenLifeTime)
+	if err != nil {
+		return fmt.Errorf("error creating access token %w", err)
+	}
+
+	user.Service.Token = token
+	user.Service.RefreshToken = refresh
+	user.Service.IsAuthenticated = true
+	return nil
+}
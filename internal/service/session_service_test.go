@@ -0,0 +1,75 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Melikhov-p/url-minimise/internal/auth"
+	"github.com/Melikhov-p/url-minimise/internal/config"
+	"github.com/Melikhov-p/url-minimise/internal/logger"
+	"github.com/Melikhov-p/url-minimise/internal/repository"
+	storagePkg "github.com/Melikhov-p/url-minimise/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRefreshTokens(t *testing.T) {
+	log, err := logger.BuildLogger("ERROR")
+	require.NoError(t, err)
+	cfg := config.NewConfig(log, true)
+	cfg.StorageMode = storagePkg.BaseStorage
+	store, err := repository.NewStorage(cfg, log)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	user, err := AddNewUser(ctx, store, cfg)
+	require.NoError(t, err)
+	require.NotEmpty(t, user.Service.RefreshToken)
+
+	_, err = RefreshTokens(ctx, store, cfg, log, "garbage")
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+
+	rotated, err := RefreshTokens(ctx, store, cfg, log, user.Service.RefreshToken)
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, rotated.ID)
+	assert.NotEqual(t, user.Service.RefreshToken, rotated.Service.RefreshToken)
+
+	authorized, err := AuthUserByToken(rotated.Service.Token, store, log, cfg)
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, authorized.ID)
+
+	// Повторное предъявление заменённого токена отзывает всю сессию, включая выданный взамен токен.
+	_, err = RefreshTokens(ctx, store, cfg, log, user.Service.RefreshToken)
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+	_, err = RefreshTokens(ctx, store, cfg, log, rotated.Service.RefreshToken)
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+}
+
+func TestLogout(t *testing.T) {
+	log, err := logger.BuildLogger("ERROR")
+	require.NoError(t, err)
+	cfg := config.NewConfig(log, true)
+	cfg.StorageMode = storagePkg.BaseStorage
+	store, err := repository.NewStorage(cfg, log)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	user, err := AddNewUser(ctx, store, cfg)
+	require.NoError(t, err)
+
+	require.NoError(t, Logout(ctx, store, cfg, user.Service.Token, user.Service.RefreshToken))
+
+	_, err = AuthUserByToken(user.Service.Token, store, log, cfg)
+	assert.ErrorIs(t, err, ErrTokenRevoked)
+	_, err = RefreshTokens(ctx, store, cfg, log, user.Service.RefreshToken)
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+
+	// Недействительные токены при выходе пропускаются.
+	assert.NoError(t, Logout(ctx, store, cfg, "garbage", "garbage"))
+
+	expired, err := auth.BuildAccountJWTString(user.ID, "", cfg.SigningKeys, -time.Minute)
+	require.NoError(t, err)
+	_, err = AuthUserByToken(expired, store, log, cfg)
+	assert.ErrorIs(t, err, auth.ErrTokenExpired)
+}
@@ -0,0 +1,153 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Melikhov-p/url-minimise/internal/auth"
+	"github.com/Melikhov-p/url-minimise/internal/config"
+	"github.com/Melikhov-p/url-minimise/internal/models"
+	"github.com/Melikhov-p/url-minimise/internal/repository"
+)
+
+// GetSigningKeys получить ключи подписи токенов без самих секретов. Ключ, которым сейчас
+// подписываются токены, отмечен полем signing.
+func GetSigningKeys(
+	ctx context.Context,
+	storage repository.Storage,
+	cfg *config.Config,
+) ([]models.SigningKeyResponse, error) {
+	keys, err := ReloadSigningKeys(ctx, storage, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var signingID string
+	if signing, err := cfg.SigningKeys.Signing(); err == nil {
+		signingID = signing.ID
+	}
+
+	res := make([]models.SigningKeyResponse, 0, len(keys))
+	for _, key := range keys {
+		res = append(res, models.SigningKeyResponse{
+			CreatedAt: key.CreatedAt,
+			RetiredAt: key.RetiredAt,
+			ID:        key.ID,
+			Algorithm: key.Algorithm,
+			Signing:   key.ID == signingID,
+		})
+	}
+	return res, nil
+}
+
+// RotateSigningKey выпустить новый ключ подписи алгоритма cfg.SigningAlgorithm. Новые токены подписываются им,
+// а токены, подписанные прежними ключами, принимаются, пока эти ключи не выведены из оборота.
+func RotateSigningKey(ctx context.Context, storage repository.Storage, cfg *config.Config) (*models.SigningKey, error) {
+	key, err := auth.NewSigningKey(cfg.SigningAlgorithm)
+	if err != nil {
+		return nil, fmt.Errorf("error generating signing key %w", err)
+	}
+	if err = storage.AddSigningKey(ctx, key); err != nil {
+		return nil, fmt.Errorf("error saving signing key %w", err)
+	}
+
+	if _, err = ReloadSigningKeys(ctx, storage, cfg); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// RetireSigningKey вывести ключ подписи из оборота, например, после утечки. Подписанные им токены
+// доступа перестают приниматься, и клиенты получают новые по токену обновления, поэтому сессии
+// не завершаются. Если выводится ключ, которым сейчас подписываются токены, сначала выпускается новый.
+func RetireSigningKey(ctx context.Context, storage repository.Storage, cfg *config.Config, kid string) error {
+	if _, err := ReloadSigningKeys(ctx, storage, cfg); err != nil {
+		return err
+	}
+	if signing, err := cfg.SigningKeys.Signing(); err == nil && signing.ID == kid {
+		if _, err = RotateSigningKey(ctx, storage, cfg); err != nil {
+			return err
+		}
+	}
+
+	if err := storage.RetireSigningKey(ctx, kid); err != nil {
+		return fmt.Errorf("error retiring signing key %w", err)
+	}
+
+	_, err := ReloadSigningKeys(ctx, storage, cfg)
+	return err
+}
+
+// ReloadSigningKeys перечитать ключи подписи из хранилища, чтобы подхватить ротацию,
+// сделанную другим инстансом сервиса.
+func ReloadSigningKeys(
+	ctx context.Context,
+	storage repository.Storage,
+	cfg *config.Config,
+) ([]*models.SigningKey, error) {
+	keys, err := storage.GetSigningKeys(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error getting signing keys %w", err)
+	}
+
+	if err = cfg.SigningKeys.Set(keys); err != nil {
+		return nil, fmt.Errorf("error loading signing keys %w", err)
+	}
+	return keys, nil
+}
+
+// MaintainSigningKeys ротация ключей подписи по расписанию. Если ключ, которым подписываются токены,
+// старше cfg.SigningKeyRotation или другого алгоритма, чем cfg.SigningAlgorithm, выпускается новый.
+// Ключ, заменённый более новым, выводится из оборота, когда истекли все подписанные им токены доступа,
+// то есть через cfg.JWTTokenLifeTime после замены.
+// Возвращает, выпущен ли новый ключ, и число выведенных ключей.
+func MaintainSigningKeys(
+	ctx context.Context,
+	storage repository.Storage,
+	cfg *config.Config,
+) (bool, int, error) {
+	now := time.Now()
+	keys, err := ReloadSigningKeys(ctx, storage, cfg)
+	if err != nil {
+		return false, 0, err
+	}
+
+	var rotated bool
+	signing, err := cfg.SigningKeys.Signing()
+	if err != nil || signing.Algorithm != cfg.SigningAlgorithm ||
+		(cfg.SigningKeyRotation > 0 && now.Sub(signing.CreatedAt) >= cfg.SigningKeyRotation) {
+		var key *models.SigningKey
+		if key, err = RotateSigningKey(ctx, storage, cfg); err != nil {
+			return false, 0, err
+		}
+		keys = append(keys, key)
+		rotated = true
+	}
+
+	active := make([]*models.SigningKey, 0, len(keys))
+	for _, key := range keys {
+		if !key.Retired() {
+			active = append(active, key)
+		}
+	}
+
+	var retired int
+	for i := 0; i+1 < len(active); i++ {
+		replacedAt := active[i+1].CreatedAt
+		if now.Before(replacedAt.Add(cfg.JWTTokenLifeTime)) {
+			continue
+		}
+		if err = storage.RetireSigningKey(ctx, active[i].ID); err != nil {
+			return rotated, retired, fmt.Errorf("error retiring signing key %w", err)
+		}
+		retired++
+	}
+	if retired > 0 {
+		if _, err = ReloadSigningKeys(ctx, storage, cfg); err != nil {
+			return rotated, retired, err
+		}
+	}
+
+	return rotated, retired, nil
+}
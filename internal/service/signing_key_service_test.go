@@ -0,0 +1,108 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Melikhov-p/url-minimise/internal/auth"
+	"github.com/Melikhov-p/url-minimise/internal/config"
+	"github.com/Melikhov-p/url-minimise/internal/logger"
+	"github.com/Melikhov-p/url-minimise/internal/models"
+	"github.com/Melikhov-p/url-minimise/internal/repository"
+	storagePkg "github.com/Melikhov-p/url-minimise/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRotateRetireSigningKey(t *testing.T) {
+	log, err := logger.BuildLogger("ERROR")
+	require.NoError(t, err)
+	cfg := config.NewConfig(log, true)
+	cfg.StorageMode = storagePkg.BaseStorage
+	store, err := repository.NewStorage(cfg, log)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	user, err := AddNewUser(ctx, store, cfg)
+	require.NoError(t, err)
+	first, err := cfg.SigningKeys.Signing()
+	require.NoError(t, err)
+
+	// После ротации токены прежнего ключа по-прежнему принимаются.
+	next, err := RotateSigningKey(ctx, store, cfg)
+	require.NoError(t, err)
+	signing, err := cfg.SigningKeys.Signing()
+	require.NoError(t, err)
+	assert.Equal(t, next.ID, signing.ID)
+	_, err = AuthUserByToken(user.Service.Token, store, log, cfg)
+	assert.NoError(t, err)
+
+	keys, err := GetSigningKeys(ctx, store, cfg)
+	require.NoError(t, err)
+	require.Len(t, keys, 2)
+	assert.Equal(t, first.ID, keys[0].ID)
+	assert.False(t, keys[0].Signing)
+	assert.True(t, keys[1].Signing)
+
+	// Выведенный ключ больше не принимается, но сессия продолжается по токену обновления.
+	require.NoError(t, RetireSigningKey(ctx, store, cfg, first.ID))
+	_, err = AuthUserByToken(user.Service.Token, store, log, cfg)
+	assert.ErrorIs(t, err, auth.ErrInvalidToken)
+	refreshed, err := RefreshTokens(ctx, store, cfg, log, user.Service.RefreshToken)
+	require.NoError(t, err)
+	_, err = AuthUserByToken(refreshed.Service.Token, store, log, cfg)
+	assert.NoError(t, err)
+
+	// Вывод ключа, которым подписываются токены, сначала выпускает новый.
+	require.NoError(t, RetireSigningKey(ctx, store, cfg, next.ID))
+	signing, err = cfg.SigningKeys.Signing()
+	require.NoError(t, err)
+	assert.NotEqual(t, next.ID, signing.ID)
+
+	assert.ErrorIs(t, RetireSigningKey(ctx, store, cfg, "missing"), storagePkg.ErrNotFound)
+}
+
+func TestMaintainSigningKeys(t *testing.T) {
+	log, err := logger.BuildLogger("ERROR")
+	require.NoError(t, err)
+	cfg := config.NewConfig(log, true)
+	cfg.StorageMode = storagePkg.BaseStorage
+	cfg.SigningKeyRotation = 24 * time.Hour
+	store, err := repository.NewStorage(cfg, log)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	rotated, retired, err := MaintainSigningKeys(ctx, store, cfg)
+	require.NoError(t, err)
+	assert.False(t, rotated)
+	assert.Zero(t, retired)
+
+	// Ключ старше срока ротации заменяется новым и остаётся действующим, пока не истекут его токены.
+	now := time.Now()
+	stale := &models.SigningKey{CreatedAt: now.Add(-48 * time.Hour), ID: "stale", Secret: "stale"}
+	require.NoError(t, store.AddSigningKey(ctx, stale))
+	first, err := cfg.SigningKeys.Signing()
+	require.NoError(t, err)
+	require.NoError(t, store.RetireSigningKey(ctx, first.ID))
+
+	rotated, retired, err = MaintainSigningKeys(ctx, store, cfg)
+	require.NoError(t, err)
+	assert.True(t, rotated)
+	assert.Zero(t, retired)
+	_, ok := cfg.SigningKeys.Verifying("stale")
+	assert.True(t, ok)
+
+	// Ключ, заменённый раньше срока жизни токена доступа, выводится из оборота.
+	replaced := &models.SigningKey{CreatedAt: now.Add(-47 * time.Hour), ID: "replaced", Secret: "replaced"}
+	require.NoError(t, store.AddSigningKey(ctx, replaced))
+
+	rotated, retired, err = MaintainSigningKeys(ctx, store, cfg)
+	require.NoError(t, err)
+	assert.False(t, rotated)
+	assert.Equal(t, 1, retired)
+	_, ok = cfg.SigningKeys.Verifying("stale")
+	assert.False(t, ok)
+	_, ok = cfg.SigningKeys.Verifying("replaced")
+	assert.True(t, ok)
+}
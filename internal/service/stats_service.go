@@ -0,0 +1,83 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Melikhov-p/url-minimise/internal/config"
+	"github.com/Melikhov-p/url-minimise/internal/models"
+	"github.com/Melikhov-p/url-minimise/internal/repository"
+	"github.com/Melikhov-p/url-minimise/internal/tracing"
+)
+
+// GetServiceStats получить статистику сервиса. Агрегаты хранилища пересчитываются не чаще раза
+// в cfg.StatsCacheTTL, количество отброшенных событий переходов всегда актуальное.
+func GetServiceStats(
+	ctx context.Context,
+	cfg *config.Config,
+	storage repository.Storage,
+) (*models.StatsResponse, error) {
+	ctx, span := tracing.Start(ctx, "service.GetServiceStats")
+	defer span.End()
+
+	cached, err := cfg.StatsCache.Get(ctx, func(ctx context.Context) (*models.StatsResponse, error) {
+		return loadServiceStats(ctx, cfg, storage)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res := *cached
+	res.DroppedClicks = cfg.Clicks.Dropped()
+	return &res, nil
+}
+
+// loadServiceStats собрать статистику сервиса из хранилища.
+func loadServiceStats(
+	ctx context.Context,
+	cfg *config.Config,
+	storage repository.Storage,
+) (*models.StatsResponse, error) {
+	now := time.Now()
+
+	stats, err := storage.GetServiceStats(ctx, now, cfg.StatsTopLinks)
+	if err != nil {
+		return nil, fmt.Errorf("error getting service stats %w", err)
+	}
+	users, err := storage.GetUsersCount(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error getting users count %w", err)
+	}
+	purged, err := storage.GetPurgedURLsCount(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error getting purged urls count %w", err)
+	}
+	visitors, err := storage.GetUniqueVisitors(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error getting unique visitors %w", err)
+	}
+
+	res := &models.StatsResponse{
+		GeneratedAt:        now.UTC(),
+		TopLinks:           make([]models.LinkClicks, 0, len(stats.TopLinks)),
+		URLs:               stats.ActiveURLs,
+		DeletedURLs:        stats.DeletedURLs,
+		CreatedLastHour:    stats.CreatedLastHour,
+		CreatedLastDay:     stats.CreatedLastDay,
+		CreatedLastWeek:    stats.CreatedLastWeek,
+		PendingDeleteTasks: stats.PendingDeleteTasks,
+		Users:              users,
+		PurgedURLs:         purged,
+		TotalClicks:        stats.TotalClicks,
+		UniqueVisitors:     visitors,
+	}
+	for _, link := range stats.TopLinks {
+		res.TopLinks = append(res.TopLinks, models.LinkClicks{
+			ShortURL: BuildShortURL(cfg, link.ShortURL),
+			Clicks:   link.Clicks,
+		})
+	}
+
+	return res, nil
+}
@@ -0,0 +1,65 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Melikhov-p/url-minimise/internal/cache"
+	"github.com/Melikhov-p/url-minimise/internal/clicks"
+	"github.com/Melikhov-p/url-minimise/internal/config"
+	"github.com/Melikhov-p/url-minimise/internal/logger"
+	"github.com/Melikhov-p/url-minimise/internal/models"
+	"github.com/Melikhov-p/url-minimise/internal/repository"
+	"github.com/Melikhov-p/url-minimise/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetServiceStats(t *testing.T) {
+	log, err := logger.BuildLogger("ERROR")
+	require.NoError(t, err)
+	cfg := config.NewConfig(log, true)
+	cfg.StorageMode = storage.BaseStorage
+	cfg.StatsCache = cache.NewValue[*models.StatsResponse](time.Hour)
+	cfg.Clicks = clicks.NewBuffer(1)
+	store, err := repository.NewStorage(cfg, log)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	popular, err := AddURL(ctx, store, log, "https://popular.example.com", cfg, 1)
+	require.NoError(t, err)
+	_, err = AddURL(ctx, store, log, "https://other.example.com", cfg, 2)
+	require.NoError(t, err)
+	require.NoError(t, store.AddClicks(ctx, []*models.ClickEvent{
+		{Time: time.Now(), ShortURL: popular.ShortURL, Visitor: 1},
+		{Time: time.Now(), ShortURL: popular.ShortURL, Visitor: 1},
+	}))
+
+	stats, err := GetServiceStats(ctx, cfg, store)
+	require.NoError(t, err)
+	assert.Equal(t, 2, stats.URLs)
+	assert.Equal(t, 2, stats.Users)
+	assert.Equal(t, 2, stats.CreatedLastHour)
+	assert.Equal(t, int64(2), stats.TotalClicks)
+	assert.Equal(t, uint64(1), stats.UniqueVisitors)
+	assert.Equal(t, []models.LinkClicks{{ShortURL: BuildShortURL(cfg, popular.ShortURL), Clicks: 2}}, stats.TopLinks)
+
+	// Агрегаты хранилища берутся из кеша, отброшенные события переходов — актуальные.
+	_, err = AddURL(ctx, store, log, "https://new.example.com", cfg, 3)
+	require.NoError(t, err)
+	cfg.Clicks.Record(&models.ClickEvent{})
+	cfg.Clicks.Record(&models.ClickEvent{})
+
+	cached, err := GetServiceStats(ctx, cfg, store)
+	require.NoError(t, err)
+	assert.Equal(t, 2, cached.URLs)
+	assert.Equal(t, stats.GeneratedAt, cached.GeneratedAt)
+	assert.Equal(t, int64(1), cached.DroppedClicks)
+	assert.Zero(t, stats.DroppedClicks)
+
+	cfg.StatsCache.Invalidate()
+	fresh, err := GetServiceStats(ctx, cfg, store)
+	require.NoError(t, err)
+	assert.Equal(t, 3, fresh.URLs)
+}
@@ -3,6 +3,7 @@ package service
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/Melikhov-p/url-minimise/internal/models"
 	"github.com/Melikhov-p/url-minimise/internal/repository"
@@ -35,3 +36,17 @@ func UpdateTasksStatus(
 
 	return nil
 }
+
+// PurgeDeletedURLs окончательно удалить адреса, срок хранения которых после удаления истёк.
+func PurgeDeletedURLs(
+	ctx context.Context,
+	retention time.Duration,
+	storage repository.Storage,
+) (int, error) {
+	purged, err := storage.PurgeDeletedURLs(ctx, time.Now().Add(-retention))
+	if err != nil {
+		return 0, fmt.Errorf("error purging deleted URLs %w", err)
+	}
+
+	return purged, nil
+}
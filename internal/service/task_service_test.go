@@ -2,7 +2,9 @@ package service
 
 import (
 	"context"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/Melikhov-p/url-minimise/internal/config"
 	"github.com/Melikhov-p/url-minimise/internal/logger"
@@ -15,6 +17,7 @@ func TestGetDeleteTasksWStatus(t *testing.T) {
 	log, err := logger.BuildLogger("ERROR")
 	assert.NoError(t, err)
 	cfg := config.NewConfig(log, true)
+	cfg.Storage.FileStorage.FilePath = filepath.Join(t.TempDir(), "storage.txt")
 	store, err := repository.NewStorage(cfg, log)
 	assert.NoError(t, err)
 
@@ -29,6 +32,7 @@ func TestUpdateTasksStatus(t *testing.T) {
 	log, err := logger.BuildLogger("ERROR")
 	assert.NoError(t, err)
 	cfg := config.NewConfig(log, true)
+	cfg.Storage.FileStorage.FilePath = filepath.Join(t.TempDir(), "storage.txt")
 	store, err := repository.NewStorage(cfg, log)
 	assert.NoError(t, err)
 
@@ -43,3 +47,25 @@ func TestUpdateTasksStatus(t *testing.T) {
 	err = UpdateTasksStatus(context.Background(), taskList, models.Done, store)
 	assert.NoError(t, err)
 }
+
+func TestPurgeDeletedURLs(t *testing.T) {
+	log, err := logger.BuildLogger("ERROR")
+	assert.NoError(t, err)
+	cfg := config.NewConfig(log, true)
+	cfg.Storage.FileStorage.FilePath = filepath.Join(t.TempDir(), "storage.txt")
+	store, err := repository.NewStorage(cfg, log)
+	assert.NoError(t, err)
+
+	short, err := AddURL(context.Background(), store, log, "purge/original", cfg, 1)
+	assert.NoError(t, err)
+	err = MarkAsDeleted(context.Background(), []*models.DelTask{{URL: short.ShortURL, UserID: 1}}, store)
+	assert.NoError(t, err)
+
+	purged, err := PurgeDeletedURLs(context.Background(), time.Hour, store)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, purged)
+
+	purged, err = PurgeDeletedURLs(context.Background(), -time.Hour, store)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, purged)
+}
@@ -4,11 +4,13 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/Melikhov-p/url-minimise/internal/config"
 	"github.com/Melikhov-p/url-minimise/internal/models"
 	"github.com/Melikhov-p/url-minimise/internal/repository"
 	storagePkg "github.com/Melikhov-p/url-minimise/internal/storage"
+	"github.com/Melikhov-p/url-minimise/internal/tracing"
 	"go.uber.org/zap"
 )
 
@@ -21,7 +23,31 @@ func AddURL(
 	cfg *config.Config,
 	userID int,
 ) (*models.StorageURL, error) {
-	newURL, err := repository.NewStorageURL(ctx, originalURL, storage, cfg, userID)
+	return AddURLOnDomain(ctx, storage, logger, originalURL, "", cfg, userID)
+}
+
+// AddURLOnDomain добавить новый адрес на выбранном домене, пустой домен — основной.
+func AddURLOnDomain(
+	ctx context.Context,
+	storage repository.Storage,
+	logger *zap.Logger,
+	originalURL string,
+	domain string,
+	cfg *config.Config,
+	userID int,
+) (*models.StorageURL, error) {
+	ctx, span := tracing.Start(ctx, "service.AddURLOnDomain")
+	defer span.End()
+
+	if err := CheckURLPolicy(cfg, originalURL); err != nil {
+		return nil, err
+	}
+	domain, err := checkDomainAllowed(ctx, storage, cfg, domain, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	newURL, err := repository.NewStorageURLOnDomain(ctx, originalURL, domain, storage, cfg, userID)
 	if err != nil {
 		logger.Error("error creating short URL", zap.Error(err))
 		return nil, fmt.Errorf("error creating short URL model %w", err)
@@ -40,6 +66,41 @@ func AddURL(
 	return newURL, nil
 }
 
+// AddURLs добавить пачку новых адресов основного домена.
+func AddURLs(
+	ctx context.Context,
+	storage repository.Storage,
+	originalURLs []string,
+	cfg *config.Config,
+	userID int,
+) ([]*models.StorageURL, error) {
+	ctx, span := tracing.Start(ctx, "service.AddURLs")
+	defer span.End()
+
+	if err := CheckURLPolicy(cfg, originalURLs...); err != nil {
+		return nil, err
+	}
+
+	newURLs, err := repository.NewStorageMultiURL(ctx, originalURLs, storage, cfg, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error creating short URLs %w", err)
+	}
+
+	if err = storage.AddURLs(ctx, newURLs); err != nil {
+		return nil, fmt.Errorf("error adding new URLs %w", err)
+	}
+
+	if saver, ok := storage.(repository.StorageSaver); ok {
+		for _, url := range newURLs {
+			if err = saver.Save(url); err != nil {
+				return nil, fmt.Errorf("error saving new URL %w", err)
+			}
+		}
+	}
+
+	return newURLs, nil
+}
+
 // MarkAsDeleted пометить адрес на удаление.
 func MarkAsDeleted(
 	ctx context.Context,
@@ -53,3 +114,22 @@ func MarkAsDeleted(
 
 	return nil
 }
+
+// RestoreURLs восстановить удалённые адреса пользователя, если не истёк срок хранения.
+func RestoreURLs(
+	ctx context.Context,
+	shortURLs []string,
+	userID int,
+	storage repository.Storage,
+	cfg *config.Config,
+) ([]string, error) {
+	ctx, span := tracing.Start(ctx, "service.RestoreURLs")
+	defer span.End()
+
+	restored, err := storage.RestoreURLs(ctx, shortURLs, userID, time.Now().Add(-cfg.URLRetention))
+	if err != nil {
+		return nil, fmt.Errorf("error restoring URLs %w", err)
+	}
+
+	return restored, nil
+}
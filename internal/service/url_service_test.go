@@ -2,6 +2,7 @@ package service
 
 import (
 	"context"
+	"path/filepath"
 	"testing"
 
 	"github.com/Melikhov-p/url-minimise/internal/config"
@@ -15,6 +16,7 @@ func TestAddURL(t *testing.T) {
 	log, err := logger.BuildLogger("ERROR")
 	assert.NoError(t, err)
 	cfg := config.NewConfig(log, true)
+	cfg.Storage.FileStorage.FilePath = filepath.Join(t.TempDir(), "storage.txt")
 	store, err := repository.NewStorage(cfg, log)
 	assert.NoError(t, err)
 
@@ -26,6 +28,7 @@ func TestMarkAsDeleted(t *testing.T) {
 	log, err := logger.BuildLogger("ERROR")
 	assert.NoError(t, err)
 	cfg := config.NewConfig(log, true)
+	cfg.Storage.FileStorage.FilePath = filepath.Join(t.TempDir(), "storage.txt")
 	store, err := repository.NewStorage(cfg, log)
 	assert.NoError(t, err)
 
@@ -42,3 +45,25 @@ func TestMarkAsDeleted(t *testing.T) {
 	err = MarkAsDeleted(context.Background(), taskList, store)
 	assert.NoError(t, err)
 }
+
+func TestRestoreURLs(t *testing.T) {
+	log, err := logger.BuildLogger("ERROR")
+	assert.NoError(t, err)
+	cfg := config.NewConfig(log, true)
+	cfg.Storage.FileStorage.FilePath = filepath.Join(t.TempDir(), "storage.txt")
+	store, err := repository.NewStorage(cfg, log)
+	assert.NoError(t, err)
+
+	short, err := AddURL(context.Background(), store, log, "restore/original", cfg, 1)
+	assert.NoError(t, err)
+	err = MarkAsDeleted(context.Background(), []*models.DelTask{{URL: short.ShortURL, UserID: 1}}, store)
+	assert.NoError(t, err)
+
+	restored, err := RestoreURLs(context.Background(), []string{short.ShortURL}, 1, store, cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{short.ShortURL}, restored)
+
+	stored, err := store.GetURL(context.Background(), short.ShortURL)
+	assert.NoError(t, err)
+	assert.False(t, stored.DeletedFlag)
+}
@@ -8,54 +8,69 @@ import (
 	"github.com/Melikhov-p/url-minimise/internal/config"
 	"github.com/Melikhov-p/url-minimise/internal/models"
 	"github.com/Melikhov-p/url-minimise/internal/repository"
+	"github.com/Melikhov-p/url-minimise/internal/tracing"
 	"go.uber.org/zap"
 )
 
-// AuthUserByToken аутентификация по токену.
+// AuthUserByToken аутентификация по токену. Истёкший токен отклоняется с auth.ErrTokenExpired,
+// отозванный — с ErrTokenRevoked.
 func AuthUserByToken(tokenString string,
 	s repository.Storage,
 	logger *zap.Logger,
 	cfg *config.Config,
 ) (*models.User, error) {
 	emptyUser := repository.NewEmptyUser()
-	userID, err := auth.GetUserID(tokenString, cfg.SecretKey)
+	identity, err := auth.ParseToken(tokenString, cfg.SigningKeys)
 	if err != nil {
 		return emptyUser, fmt.Errorf("error getting user ID from token %w", err)
 	}
 
+	// Токены без jti выданы до появления отзыва и действуют до истечения своего срока.
+	if identity.ID != "" {
+		revoked, err := s.IsTokenRevoked(context.Background(), identity.ID)
+		if err != nil {
+			return emptyUser, fmt.Errorf("error checking token revocation %w", err)
+		}
+		if revoked {
+			return emptyUser, ErrTokenRevoked
+		}
+	}
+
 	var urls []*models.StorageURL
-	urls, err = s.GetURLsByUserID(context.Background(), userID)
+	urls, err = s.GetURLsByUserID(context.Background(), identity.UserID)
 	if err != nil {
 		logger.Error("error getting urls by user id", zap.Error(err))
 	}
 
 	emptyUser.URLs = urls
-	emptyUser.ID = userID
+	emptyUser.ID = identity.UserID
+	emptyUser.Email = identity.Email
 	emptyUser.Service.IsAuthenticated = true
 	emptyUser.Service.Token = tokenString
 	return emptyUser, nil
 }
 
-// AddNewUser добавить пользователя.
+// AddNewUser добавить пользователя и начать его сессию.
 func AddNewUser(ctx context.Context, s repository.Storage, cfg *config.Config) (*models.User, error) {
+	ctx, span := tracing.Start(ctx, "service.AddNewUser")
+	defer span.End()
+
 	user, err := s.AddUser(ctx)
 	if err != nil {
 		return repository.NewEmptyUser(), fmt.Errorf("error creating new user in storage %w", err)
 	}
 
-	user.Service.Token, err = BuildUserToken(user.ID, cfg)
-	if err != nil {
-		return user, fmt.Errorf("error creating token for new user %w", err)
+	if err = IssueTokens(ctx, s, cfg, user); err != nil {
+		return user, fmt.Errorf("error creating tokens for new user %w", err)
 	}
 
-	user.Service.IsAuthenticated = true
 	return user, nil
 }
 
 // BuildUserToken создать токен для пользователя.
 func BuildUserToken(userID int, cfg *config.Config) (string, error) {
 	// BuildUserToken return token string for userID int
-	token, err := auth.BuildJWTString(userID, cfg.SecretKey, cfg.JWTTokenLifeTime)
+	token, err := auth.BuildJWTString(userID, cfg.SigningKeys, cfg.JWTTokenLifeTime)
 	if err != nil {
 		return "", fmt.Errorf("error creating token for user %w", err)
 	}
@@ -2,6 +2,7 @@ package service
 
 import (
 	"context"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -16,13 +17,14 @@ func BenchmarkServices(b *testing.B) {
 	if err != nil {
 		panic(err.Error())
 	}
-	store, err := repository.NewStorage(config.NewConfig(log, true), log)
+	cfg := config.NewConfig(log, true)
+	cfg.Storage.FileStorage.FilePath = filepath.Join(b.TempDir(), "storage.txt")
+	store, err := repository.NewStorage(cfg, log)
 	if err != nil {
 		panic(err.Error())
 	}
 	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
 	defer cancel()
-	cfg := config.NewConfig(log, true)
 	userID := 999
 	var userToken string
 	originalURL := "original.url/1"
@@ -47,6 +49,7 @@ func TestAddNewUser(t *testing.T) {
 	log, err := logger.BuildLogger("ERROR")
 	assert.NoError(t, err)
 	cfg := config.NewConfig(log, true)
+	cfg.Storage.FileStorage.FilePath = filepath.Join(t.TempDir(), "storage.txt")
 	store, err := repository.NewStorage(cfg, log)
 	assert.NoError(t, err)
 	_, err = AddNewUser(context.Background(), store, cfg)
@@ -57,6 +60,9 @@ func TestBuildUserToken(t *testing.T) {
 	log, err := logger.BuildLogger("ERROR")
 	assert.NoError(t, err)
 	cfg := config.NewConfig(log, true)
+	cfg.Storage.FileStorage.FilePath = filepath.Join(t.TempDir(), "storage.txt")
+	_, err = repository.NewStorage(cfg, log)
+	assert.NoError(t, err)
 	_, err = BuildUserToken(1, cfg)
 	assert.NoError(t, err)
 }
@@ -65,6 +71,7 @@ func TestAuthUserByToken(t *testing.T) {
 	log, err := logger.BuildLogger("ERROR")
 	assert.NoError(t, err)
 	cfg := config.NewConfig(log, true)
+	cfg.Storage.FileStorage.FilePath = filepath.Join(t.TempDir(), "storage.txt")
 	store, err := repository.NewStorage(cfg, log)
 	assert.NoError(t, err)
 
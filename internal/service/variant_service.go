@@ -0,0 +1,142 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/Melikhov-p/url-minimise/internal/config"
+	"github.com/Melikhov-p/url-minimise/internal/models"
+	"github.com/Melikhov-p/url-minimise/internal/repository"
+	"github.com/Melikhov-p/url-minimise/internal/tracing"
+)
+
+// ErrInvalidVariant вариант адреса назначения заполнен неверно.
+var ErrInvalidVariant = errors.New("invalid destination variant")
+
+const (
+	maxVariants      = 10
+	maxVariantWeight = 1000
+)
+
+// SetVariants заменить варианты адреса назначения ссылки владельцем.
+// Счётчики показов сохраняются у вариантов с прежним именем.
+func SetVariants(
+	ctx context.Context,
+	storage repository.Storage,
+	cfg *config.Config,
+	shortURL string,
+	userID int,
+	variants []models.Variant,
+) error {
+	ctx, span := tracing.Start(ctx, "service.SetVariants")
+	defer span.End()
+
+	if err := validateVariants(variants); err != nil {
+		return err
+	}
+	destinations := make([]string, 0, len(variants))
+	for i := range variants {
+		destinations = append(destinations, variants[i].Destination)
+	}
+	if err := CheckURLPolicy(cfg, destinations...); err != nil {
+		return err
+	}
+
+	stored, err := storage.GetURL(ctx, shortURL)
+	if err != nil {
+		return fmt.Errorf("error getting url for variants %w", err)
+	}
+	if stored.UserID != userID {
+		return ErrNotURLOwner
+	}
+
+	if err = storage.SetVariants(ctx, shortURL, userID, variants); err != nil {
+		return fmt.Errorf("error setting variants %w", err)
+	}
+
+	return nil
+}
+
+// GetVariants получить варианты адреса назначения ссылки со счётчиками показов владельцем.
+func GetVariants(
+	ctx context.Context,
+	storage repository.Storage,
+	shortURL string,
+	userID int,
+) ([]models.Variant, error) {
+	ctx, span := tracing.Start(ctx, "service.GetVariants")
+	defer span.End()
+
+	stored, err := storage.GetURL(ctx, shortURL)
+	if err != nil {
+		return nil, fmt.Errorf("error getting url for variants %w", err)
+	}
+	if stored.UserID != userID {
+		return nil, ErrNotURLOwner
+	}
+
+	if stored.Variants == nil {
+		return []models.Variant{}, nil
+	}
+	return stored.Variants, nil
+}
+
+// pickVariant выбирает вариант для посетителя: закреплённый за ним, если он ещё существует,
+// иначе случайный с учётом весов. roll возвращает число в полуинтервале [0, n).
+func pickVariant(variants []models.Variant, sticky string, roll func(n int) int) (*models.Variant, bool) {
+	if len(variants) == 0 {
+		return nil, false
+	}
+
+	total := 0
+	for i := range variants {
+		if sticky != "" && variants[i].Name == sticky {
+			return &variants[i], true
+		}
+		total += variants[i].Weight
+	}
+	if total <= 0 {
+		return nil, false
+	}
+
+	point := roll(total)
+	for i := range variants {
+		point -= variants[i].Weight
+		if point < 0 {
+			return &variants[i], true
+		}
+	}
+
+	return &variants[len(variants)-1], true
+}
+
+func validateVariants(variants []models.Variant) error {
+	if len(variants) > maxVariants {
+		return fmt.Errorf("%w: no more than %d variants per link", ErrInvalidVariant, maxVariants)
+	}
+
+	names := make(map[string]struct{}, len(variants))
+	for i := range variants {
+		variant := &variants[i]
+		if variant.Name == "" {
+			return fmt.Errorf("%w: variant %d has no name", ErrInvalidVariant, i)
+		}
+		if _, ok := names[variant.Name]; ok {
+			return fmt.Errorf("%w: duplicate variant name %q", ErrInvalidVariant, variant.Name)
+		}
+		names[variant.Name] = struct{}{}
+
+		if variant.Weight <= 0 || variant.Weight > maxVariantWeight {
+			return fmt.Errorf("%w: variant %q weight must be in 1..%d", ErrInvalidVariant, variant.Name, maxVariantWeight)
+		}
+
+		destination, err := url.Parse(variant.Destination)
+		if err != nil || destination.Scheme == "" || destination.Host == "" {
+			return fmt.Errorf("%w: variant %q has invalid destination", ErrInvalidVariant, variant.Name)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/Melikhov-p/url-minimise/internal/config"
+	"github.com/Melikhov-p/url-minimise/internal/logger"
+	"github.com/Melikhov-p/url-minimise/internal/models"
+	"github.com/Melikhov-p/url-minimise/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPickVariant(t *testing.T) {
+	variants := []models.Variant{
+		{Name: "a", Destination: "https://example.com/a", Weight: 70},
+		{Name: "b", Destination: "https://example.com/b", Weight: 20},
+		{Name: "c", Destination: "https://example.com/c", Weight: 10},
+	}
+
+	testCases := []struct {
+		name   string
+		sticky string
+		roll   int
+		want   string
+	}{
+		{name: "First Bucket Start", roll: 0, want: "a"},
+		{name: "First Bucket End", roll: 69, want: "a"},
+		{name: "Second Bucket", roll: 70, want: "b"},
+		{name: "Last Bucket", roll: 99, want: "c"},
+		{name: "Sticky", sticky: "c", roll: 0, want: "c"},
+		{name: "Stale Sticky", sticky: "removed", roll: 75, want: "b"},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			variant, ok := pickVariant(variants, test.sticky, func(n int) int {
+				assert.Equal(t, 100, n)
+				return test.roll
+			})
+			require.True(t, ok)
+			assert.Equal(t, test.want, variant.Name)
+		})
+	}
+
+	_, ok := pickVariant(nil, "", func(int) int { return 0 })
+	assert.False(t, ok)
+}
+
+func TestResolveRedirect_Variants(t *testing.T) {
+	log, err := logger.BuildLogger("ERROR")
+	require.NoError(t, err)
+	cfg := config.NewConfig(log, true)
+
+	url := &models.StorageURL{
+		OriginalURL:  "https://example.com",
+		RedirectCode: 301,
+		Rules:        []models.RedirectRule{{Device: models.DeviceIOS, Destination: "https://apps.apple.com/app"}},
+		Variants: []models.Variant{
+			{Name: "a", Destination: "https://example.com/a", Weight: 1},
+			{Name: "b", Destination: "https://example.com/b", Weight: 1},
+		},
+	}
+
+	redirect := ResolveRedirect(url, &models.Visit{Variant: "b"}, cfg)
+	assert.Equal(t, "https://example.com/b", redirect.Location)
+	assert.Equal(t, "b", redirect.Variant)
+	assert.Contains(t, redirect.CacheControl, "private")
+
+	// Правило важнее разделения трафика.
+	redirect = ResolveRedirect(url, &models.Visit{UserAgent: iPhoneUA, Variant: "b"}, cfg)
+	assert.Equal(t, "https://apps.apple.com/app", redirect.Location)
+	assert.Empty(t, redirect.Variant)
+}
+
+func TestSetVariants(t *testing.T) {
+	log, err := logger.BuildLogger("ERROR")
+	require.NoError(t, err)
+	cfg := config.NewConfig(log, true)
+	cfg.Storage.FileStorage.FilePath = filepath.Join(t.TempDir(), "storage.txt")
+	store, err := repository.NewStorage(cfg, log)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	newURL, err := AddURL(ctx, store, log, "https://example.com/split", cfg, 1)
+	require.NoError(t, err)
+
+	invalid := [][]models.Variant{
+		{{Destination: "https://example.com/a", Weight: 1}},
+		{{Name: "a", Destination: "https://example.com/a", Weight: 0}},
+		{{Name: "a", Destination: "example.com/a", Weight: 1}},
+		{
+			{Name: "a", Destination: "https://example.com/a", Weight: 1},
+			{Name: "a", Destination: "https://example.com/b", Weight: 1},
+		},
+	}
+	for _, variants := range invalid {
+		assert.ErrorIs(t, SetVariants(ctx, store, cfg, newURL.ShortURL, 1, variants), ErrInvalidVariant)
+	}
+
+	variants := []models.Variant{{Name: "a", Destination: "https://example.com/a", Weight: 1}}
+	assert.ErrorIs(t, SetVariants(ctx, store, cfg, newURL.ShortURL, 2, variants), ErrNotURLOwner)
+	require.NoError(t, SetVariants(ctx, store, cfg, newURL.ShortURL, 1, variants))
+
+	stored, err := GetVariants(ctx, store, newURL.ShortURL, 1)
+	require.NoError(t, err)
+	assert.Equal(t, variants, stored)
+}
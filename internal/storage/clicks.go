@@ -0,0 +1,222 @@
+package storage
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Melikhov-p/url-minimise/internal/hll"
+	"github.com/Melikhov-p/url-minimise/internal/models"
+)
+
+// clickUserAgentMaxLen максимальная длина User-Agent в агрегатах переходов.
+const clickUserAgentMaxLen = 256
+
+// serviceVisitorsKey ключ скетчей уникальных посетителей всего сервиса вместо кода ссылки.
+const serviceVisitorsKey = ""
+
+// clickDimensionKey значение разреза переходов за сутки.
+type clickDimensionKey struct {
+	Day       time.Time
+	Dimension models.ClickDimension
+	Value     string
+}
+
+// dailyVisitors скетчи уникальных посетителей по суткам.
+type dailyVisitors map[time.Time]*hll.Sketch
+
+// add учесть посетителя перехода. Переходы без хеша посетителя не учитываются.
+func (dv dailyVisitors) add(event *models.ClickEvent) {
+	if event.Visitor == 0 {
+		return
+	}
+
+	day := truncateDay(event.Time)
+	sketch, ok := dv[day]
+	if !ok {
+		sketch = hll.New()
+		dv[day] = sketch
+	}
+	sketch.Add(event.Visitor)
+}
+
+// estimate оценка уникальных посетителей за сутки, пересекающиеся с полуинтервалом [from, to).
+// Нулевое from означает всё время.
+func (dv dailyVisitors) estimate(from, to time.Time) uint64 {
+	fromDay := truncateDay(from)
+	merged := hll.New()
+	for day, sketch := range dv {
+		if !from.IsZero() && (day.Before(fromDay) || !day.Before(to)) {
+			continue
+		}
+		merged.Merge(sketch)
+	}
+	return merged.Estimate()
+}
+
+// linkClicks агрегаты переходов по одной ссылке: всего, по часам, по значениям разрезов
+// и уникальным посетителям за сутки.
+type linkClicks struct {
+	hours      map[time.Time]int64
+	dimensions map[clickDimensionKey]int64
+	visitors   dailyVisitors
+	total      int64
+}
+
+func newLinkClicks() *linkClicks {
+	return &linkClicks{
+		hours:      map[time.Time]int64{},
+		dimensions: map[clickDimensionKey]int64{},
+		visitors:   dailyVisitors{},
+	}
+}
+
+// add учесть переход в агрегатах.
+func (lc *linkClicks) add(event *models.ClickEvent) {
+	hour := event.Time.UTC().Truncate(time.Hour)
+	day := truncateDay(event.Time)
+
+	lc.total++
+	lc.hours[hour]++
+	for dimension, value := range clickDimensionValues(event) {
+		lc.dimensions[clickDimensionKey{Day: day, Dimension: dimension, Value: value}]++
+	}
+	lc.visitors.add(event)
+}
+
+// stats выбрать агрегаты за интервал запроса.
+func (lc *linkClicks) stats(query models.ClickStatsQuery) *models.ClickStats {
+	stats := &models.ClickStats{
+		Top:            map[models.ClickDimension][]models.ClickCount{},
+		TotalCount:     lc.total,
+		UniqueVisitors: lc.visitors.estimate(query.From, query.To),
+	}
+
+	buckets := map[time.Time]int64{}
+	for hour, clicks := range lc.hours {
+		if hour.Before(query.From) || !hour.Before(query.To) {
+			continue
+		}
+		if query.Bucket == models.StatsBucketDay {
+			hour = truncateDay(hour)
+		}
+		buckets[hour] += clicks
+	}
+	for bucket, clicks := range buckets {
+		stats.Series = append(stats.Series, models.StatsPoint{Time: bucket, Clicks: clicks})
+	}
+	sort.Slice(stats.Series, func(i, j int) bool {
+		return stats.Series[i].Time.Before(stats.Series[j].Time)
+	})
+
+	fromDay := truncateDay(query.From)
+	counts := map[models.ClickDimension]map[string]int64{}
+	for key, clicks := range lc.dimensions {
+		if key.Day.Before(fromDay) || !key.Day.Before(query.To) {
+			continue
+		}
+		if counts[key.Dimension] == nil {
+			counts[key.Dimension] = map[string]int64{}
+		}
+		counts[key.Dimension][key.Value] += clicks
+	}
+	for dimension, values := range counts {
+		stats.Top[dimension] = topClickCounts(values, query.Top)
+	}
+
+	return stats
+}
+
+// hourRows строки почасовых агрегатов ссылки shortURL в порядке времени.
+func (lc *linkClicks) hourRows(shortURL string) [][]interface{} {
+	hours := make([]time.Time, 0, len(lc.hours))
+	for hour := range lc.hours {
+		hours = append(hours, hour)
+	}
+	sort.Slice(hours, func(i, j int) bool { return hours[i].Before(hours[j]) })
+
+	rows := make([][]interface{}, 0, len(hours))
+	for _, hour := range hours {
+		rows = append(rows, []interface{}{shortURL, hour, lc.hours[hour]})
+	}
+	return rows
+}
+
+// dimensionRows строки агрегатов по разрезам ссылки shortURL в порядке суток, разреза и значения.
+func (lc *linkClicks) dimensionRows(shortURL string) [][]interface{} {
+	keys := make([]clickDimensionKey, 0, len(lc.dimensions))
+	for key := range lc.dimensions {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if !keys[i].Day.Equal(keys[j].Day) {
+			return keys[i].Day.Before(keys[j].Day)
+		}
+		if keys[i].Dimension != keys[j].Dimension {
+			return keys[i].Dimension < keys[j].Dimension
+		}
+		return keys[i].Value < keys[j].Value
+	})
+
+	rows := make([][]interface{}, 0, len(keys))
+	for _, key := range keys {
+		rows = append(rows, []interface{}{
+			shortURL, key.Day.Format(time.DateOnly), string(key.Dimension), key.Value, lc.dimensions[key],
+		})
+	}
+	return rows
+}
+
+// topClickCounts первые top значений по убыванию количества переходов.
+func topClickCounts(values map[string]int64, top int) []models.ClickCount {
+	counts := make([]models.ClickCount, 0, len(values))
+	for value, clicks := range values {
+		counts = append(counts, models.ClickCount{Value: value, Clicks: clicks})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Clicks != counts[j].Clicks {
+			return counts[i].Clicks > counts[j].Clicks
+		}
+		return counts[i].Value < counts[j].Value
+	})
+
+	if top > 0 && len(counts) > top {
+		counts = counts[:top]
+	}
+	return counts
+}
+
+// clickDimensionValues значения разрезов перехода. Источник перехода сводится к хосту,
+// пустое значение означает прямой переход или неизвестный разрез.
+func clickDimensionValues(event *models.ClickEvent) map[models.ClickDimension]string {
+	userAgent := event.UserAgent
+	if len(userAgent) > clickUserAgentMaxLen {
+		userAgent = userAgent[:clickUserAgentMaxLen]
+	}
+
+	return map[models.ClickDimension]string{
+		models.ClickDimensionReferrer:  referrerHost(event.Referrer),
+		models.ClickDimensionUserAgent: userAgent,
+		models.ClickDimensionLanguage:  event.Language,
+	}
+}
+
+// referrerHost хост источника перехода без www.
+func referrerHost(referrer string) string {
+	if referrer == "" {
+		return ""
+	}
+
+	u, err := url.Parse(referrer)
+	if err != nil || u.Hostname() == "" {
+		return ""
+	}
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+}
+
+// truncateDay начало суток момента t в UTC.
+func truncateDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
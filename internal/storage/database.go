@@ -3,22 +3,98 @@ package storage
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/Melikhov-p/url-minimise/internal/auth"
+	"github.com/Melikhov-p/url-minimise/internal/hll"
 	"github.com/Melikhov-p/url-minimise/internal/models"
 )
 
 // DatabaseStorage хранилище в базе данных.
 type DatabaseStorage struct {
-	DB *sql.DB
+	DB              *sql.DB
+	clickPartitions sync.Map // [имя партиции]struct{} — партиции click_event, созданные с момента запуска.
 }
 
 const dbTimeout = 15 * time.Second
 
+// clickInsertChunk количество событий переходов в одном INSERT.
+const clickInsertChunk = 1000
+
+// urlColumns колонки таблицы url, которые читаются в models.StorageURL функцией scanURL.
+// Правила редиректа и варианты адреса назначения собираются из дочерних таблиц в JSON-массивы.
+const urlColumns = `short_url, original_url, user_id, uuid, is_deleted, deleted_at, created_at, redirect_code, no_cache,
+	query_passthrough, utm, active_from, active_until, quarantined,
+	COALESCE((
+		SELECT json_agg(json_build_object(
+			'device', r.device, 'language', r.language,
+			'not_before', r.not_before, 'not_after', r.not_after,
+			'destination', r.destination
+		) ORDER BY r.position)
+		FROM redirect_rule r WHERE r.short_url = url.short_url
+	), '[]') AS rules,
+	COALESCE((
+		SELECT json_agg(json_build_object(
+			'name', v.name, 'destination', v.destination, 'weight', v.weight, 'hits', v.hits
+		) ORDER BY v.position)
+		FROM url_variant v WHERE v.short_url = url.short_url
+	), '[]') AS variants`
+
+// rowScanner общий интерфейс *sql.Row и *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanURL читает строку с колонками urlColumns в модель адреса.
+func scanURL(row rowScanner) (*models.StorageURL, error) {
+	var (
+		u           models.StorageURL
+		deletedAt   sql.NullTime
+		activeFrom  sql.NullTime
+		activeUntil sql.NullTime
+		utm         []byte
+		rules       []byte
+		variants    []byte
+	)
+
+	err := row.Scan(
+		&u.ShortURL, &u.OriginalURL, &u.UserID, &u.UUID, &u.DeletedFlag, &deletedAt, &u.CreatedAt,
+		&u.RedirectCode, &u.NoCache,
+		&u.QueryPassthrough, &utm, &activeFrom, &activeUntil, &u.Quarantined, &rules, &variants,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error scanning url row %w", err)
+	}
+	u.DeletedAt = deletedAt.Time
+	if activeFrom.Valid {
+		u.ActiveFrom = &activeFrom.Time
+	}
+	if activeUntil.Valid {
+		u.ActiveUntil = &activeUntil.Time
+	}
+
+	if err = json.Unmarshal(utm, &u.UTM); err != nil {
+		return nil, fmt.Errorf("error unmarshal utm template %w", err)
+	}
+	if len(u.UTM) == 0 {
+		u.UTM = nil
+	}
+	if err = json.Unmarshal(rules, &u.Rules); err != nil {
+		return nil, fmt.Errorf("error unmarshal redirect rules %w", err)
+	}
+	if err = json.Unmarshal(variants, &u.Variants); err != nil {
+		return nil, fmt.Errorf("error unmarshal variants %w", err)
+	}
+
+	return &u, nil
+}
+
 // Close connection.
 func (db *DatabaseStorage) Close() error {
 	err := db.DB.Close()
@@ -190,7 +266,7 @@ func (db *DatabaseStorage) MarkAsDeletedURL(ctx context.Context, tasks []*models
 	defer cancel()
 
 	// Прохожу по таскам в цикле, а не отправляю батчем, потому что в теории у тасок может быть разный user_id
-	query := `UPDATE url SET is_deleted=true WHERE short_url=$1 AND user_id=$2`
+	query := `UPDATE url SET is_deleted=true, deleted_at=NOW() WHERE short_url=$1 AND user_id=$2`
 
 	tx, err := db.DB.Begin()
 	if err != nil {
@@ -219,6 +295,142 @@ func (db *DatabaseStorage) MarkAsDeletedURL(ctx context.Context, tasks []*models
 	return nil
 }
 
+// RestoreURLs снять отметку удаления с адресов пользователя, удалённых не раньше deletedAfter.
+// Ещё не выполненная задача на удаление адреса отменяется, такой адрес тоже считается восстановленным.
+func (db *DatabaseStorage) RestoreURLs(
+	ctx context.Context,
+	shortURLs []string,
+	userID int,
+	deletedAfter time.Time,
+) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	query := `
+		UPDATE url SET is_deleted=false, deleted_at=NULL
+		WHERE short_url=$1 AND user_id=$2 AND is_deleted=true AND deleted_at >= $3`
+	// Задача отменяется только у неудалённого адреса, иначе воркер удаления отметит его удалённым снова.
+	cancelQuery := `
+		DELETE FROM delete_task
+		WHERE short_url=$1 AND user_id=$2 AND status=$3
+			AND EXISTS (SELECT 1 FROM url WHERE short_url=$1 AND is_deleted=false)`
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction for restore %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("error prepare context for restore query %w", err)
+	}
+	defer func() {
+		_ = stmt.Close()
+	}()
+
+	cancelStmt, err := tx.PrepareContext(ctx, cancelQuery)
+	if err != nil {
+		return nil, fmt.Errorf("error prepare context for cancel delete task query %w", err)
+	}
+	defer func() {
+		_ = cancelStmt.Close()
+	}()
+
+	restored := make([]string, 0, len(shortURLs))
+	for _, short := range shortURLs {
+		res, err := stmt.ExecContext(ctx, short, userID, deletedAfter)
+		if err != nil {
+			return nil, fmt.Errorf("error restoring url %w", err)
+		}
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return nil, fmt.Errorf("error getting restored rows count %w", err)
+		}
+
+		res, err = cancelStmt.ExecContext(ctx, short, userID, models.Registered)
+		if err != nil {
+			return nil, fmt.Errorf("error cancelling delete task %w", err)
+		}
+		cancelled, err := res.RowsAffected()
+		if err != nil {
+			return nil, fmt.Errorf("error getting cancelled tasks count %w", err)
+		}
+
+		if affected > 0 || cancelled > 0 {
+			restored = append(restored, short)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error commiting restore transaction %w", err)
+	}
+	return restored, nil
+}
+
+// PurgeDeletedURLs окончательно удалить адреса, помеченные на удаление раньше deletedBefore, и их задачи.
+func (db *DatabaseStorage) PurgeDeletedURLs(ctx context.Context, deletedBefore time.Time) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	query := `
+		WITH purged AS (
+			DELETE FROM url WHERE is_deleted=true AND deleted_at < $1 RETURNING short_url
+		), purged_tasks AS (
+			DELETE FROM delete_task WHERE short_url IN (SELECT short_url FROM purged)
+		), purged_totals AS (
+			DELETE FROM click_total WHERE short_url IN (SELECT short_url FROM purged)
+		), purged_hours AS (
+			DELETE FROM click_rollup_hour WHERE short_url IN (SELECT short_url FROM purged)
+		), purged_dims AS (
+			DELETE FROM click_rollup_dim WHERE short_url IN (SELECT short_url FROM purged)
+		), purged_visitors AS (
+			DELETE FROM click_visitors WHERE short_url IN (SELECT short_url FROM purged)
+		)
+		SELECT COUNT(*) FROM purged`
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("error starting transaction for purge %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	var purged int
+	if err = tx.QueryRowContext(ctx, query, deletedBefore).Scan(&purged); err != nil {
+		return 0, fmt.Errorf("error purging deleted urls %w", err)
+	}
+
+	if purged > 0 {
+		_, err = tx.ExecContext(ctx, `INSERT INTO purge_log (urls_count) VALUES ($1)`, purged)
+		if err != nil {
+			return 0, fmt.Errorf("error writing purge log %w", err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("error commiting purge transaction %w", err)
+	}
+	return purged, nil
+}
+
+// GetPurgedURLsCount получить количество окончательно удалённых адресов.
+func (db *DatabaseStorage) GetPurgedURLsCount(ctx context.Context) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	var count int
+	row := db.DB.QueryRowContext(ctx, `SELECT COALESCE(SUM(urls_count), 0) FROM purge_log`)
+	if err := row.Scan(&count); err != nil {
+		return -1, fmt.Errorf("error scanning purged URLs count %w", err)
+	}
+
+	return count, nil
+}
+
 // UpdateTasksStatus обновить статус задачи на удаление.
 func (db *DatabaseStorage) UpdateTasksStatus(
 	ctx context.Context,
@@ -259,26 +471,67 @@ func (db *DatabaseStorage) UpdateTasksStatus(
 
 // GetURL получить полный адрес
 func (db *DatabaseStorage) GetURL(ctx context.Context, shortURL string) (*models.StorageURL, error) {
-	query := `
-                SELECT original_url, user_id, uuid, is_deleted  FROM url WHERE short_url = $1
-        `
+	query := `SELECT ` + urlColumns + ` FROM url WHERE short_url = $1`
 
 	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
 	defer cancel()
 
-	var u models.StorageURL
-	u.ShortURL = shortURL
-	if err := db.DB.QueryRowContext(ctx, query, shortURL).
-		Scan(&u.OriginalURL, &u.UserID, &u.UUID, &u.DeletedFlag); err != nil {
+	u, err := scanURL(db.DB.QueryRowContext(ctx, query, shortURL))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("can not find original url for short %w", ErrNotFound)
+		}
 		return nil, fmt.Errorf("error scanning query row full url %w", err)
 	}
 
-	return &u, nil
+	return u, nil
+}
+
+// UpdateURL обновить настройки адреса владельца.
+func (db *DatabaseStorage) UpdateURL(ctx context.Context, url *models.StorageURL) error {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	utm := []byte("{}")
+	if len(url.UTM) > 0 {
+		var err error
+		if utm, err = json.Marshal(url.UTM); err != nil {
+			return fmt.Errorf("error marshal utm template %w", err)
+		}
+	}
+
+	query := `
+		UPDATE url SET redirect_code=$1, no_cache=$2, query_passthrough=$3, utm=$4, active_from=$5, active_until=$6
+		WHERE short_url=$7 AND user_id=$8`
+
+	res, err := db.DB.ExecContext(ctx, query,
+		url.RedirectCode, url.NoCache, url.QueryPassthrough, utm, url.ActiveFrom, url.ActiveUntil,
+		url.ShortURL, url.UserID)
+	if err != nil {
+		return fmt.Errorf("error updating url settings %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error getting updated rows count %w", err)
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
 }
 
-// GetShortURL получить короткий адрес
+// GetShortURL получить короткий адрес, при tx == nil запрос выполняется вне транзакции.
 func (db *DatabaseStorage) GetShortURL(ctx context.Context, tx *sql.Tx, fullURL string) (string, error) {
-	preparedSelect, err := tx.PrepareContext(ctx, `SELECT short_url FROM url WHERE original_url = $1`)
+	var preparer interface {
+		PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+	} = db.DB
+	if tx != nil {
+		preparer = tx
+	}
+
+	preparedSelect, err := preparer.PrepareContext(ctx, `SELECT short_url FROM url WHERE original_url = $1`)
 	if err != nil {
 		return "", fmt.Errorf("error prepare select query %w", err)
 	}
@@ -297,163 +550,1152 @@ func (db *DatabaseStorage) GetShortURL(ctx context.Context, tx *sql.Tx, fullURL
 	return shortURL, nil
 }
 
-// CheckShort проверить наличие короткого адреса.
-func (db *DatabaseStorage) CheckShort(ctx context.Context, shortURL string) bool {
-	if _, err := db.GetURL(ctx, shortURL); err != nil {
-		return false
+// GetShortURLs получить короткие адреса для оригинальных адресов одним запросом.
+// Адреса без ссылок в результат не попадают.
+func (db *DatabaseStorage) GetShortURLs(ctx context.Context, originalURLs []string) (map[string]string, error) {
+	shortURLs := make(map[string]string, len(originalURLs))
+	if len(originalURLs) == 0 {
+		return shortURLs, nil
 	}
 
-	return true
-}
-
-// Ping пингануть
-func (db *DatabaseStorage) Ping(ctx context.Context) error {
 	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
 	defer cancel()
 
-	if err := db.DB.PingContext(ctx); err != nil {
-		return fmt.Errorf("error ping context %w", err)
+	placeholders := make([]string, len(originalURLs))
+	values := make([]interface{}, len(originalURLs))
+	for i, originalURL := range originalURLs {
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+		values[i] = originalURL
 	}
 
-	return nil
+	rows, err := db.DB.QueryContext(ctx, fmt.Sprintf(
+		`SELECT original_url, short_url FROM url WHERE original_url IN (%s)`,
+		strings.Join(placeholders, ", ")), values...)
+	if err != nil {
+		return nil, fmt.Errorf("error getting short urls %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	for rows.Next() {
+		var originalURL, shortURL string
+		if err = rows.Scan(&originalURL, &shortURL); err != nil {
+			return nil, fmt.Errorf("error scanning short url %w", err)
+		}
+		shortURLs[originalURL] = shortURL
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading short urls %w", err)
+	}
+
+	return shortURLs, nil
 }
 
-// AddUser добавить пользователя
-func (db *DatabaseStorage) AddUser(ctx context.Context) (*models.User, error) {
+// SetRedirectRules заменить правила условного редиректа адреса владельца.
+func (db *DatabaseStorage) SetRedirectRules(
+	ctx context.Context,
+	shortURL string,
+	userID int,
+	rules []models.RedirectRule,
+) error {
 	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
 	defer cancel()
 
 	tx, err := db.DB.Begin()
 	if err != nil {
-		return nil, fmt.Errorf("error starting transaction %w", err)
+		return fmt.Errorf("error starting transaction for redirect rules %w", err)
 	}
 	defer func() {
 		_ = tx.Rollback()
 	}()
 
-	query := `INSERT INTO "user" DEFAULT VALUES RETURNING id`
-
-	var id int
-	row := tx.QueryRowContext(ctx, query)
-	if err = row.Scan(&id); err != nil {
-		return nil, fmt.Errorf("error insert new user in db %w", err)
+	var owner int
+	err = tx.QueryRowContext(ctx, `SELECT user_id FROM url WHERE short_url = $1 FOR UPDATE`, shortURL).Scan(&owner)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+		return fmt.Errorf("error getting url owner %w", err)
 	}
-
-	user := &models.User{
-		ID:   id,
-		URLs: make([]*models.StorageURL, 0),
-		Service: &models.UserService{
-			IsAuthenticated: false,
-			Token:           "",
-		},
+	if owner != userID {
+		return ErrNotFound
 	}
 
-	_ = tx.Commit()
-	return user, nil
-}
-
-// GetURLsByUserID получить адреса пользователя
-func (db *DatabaseStorage) GetURLsByUserID(ctx context.Context, userID int) ([]*models.StorageURL, error) {
-	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
-	defer cancel()
-
-	query := `
-                                SELECT short_url, original_url, uuid
-                                FROM url WHERE user_id = $1;`
+	if _, err = tx.ExecContext(ctx, `DELETE FROM redirect_rule WHERE short_url = $1`, shortURL); err != nil {
+		return fmt.Errorf("error deleting old redirect rules %w", err)
+	}
 
-	rows, err := db.DB.QueryContext(ctx, query, userID)
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO redirect_rule (short_url, position, device, language, not_before, not_after, destination)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`)
 	if err != nil {
-		return []*models.StorageURL{}, fmt.Errorf("error getting url rows from db %w", err)
+		return fmt.Errorf("error prepare context for redirect rules %w", err)
 	}
 	defer func() {
-		_ = rows.Close()
+		_ = stmt.Close()
 	}()
 
-	urls := make([]*models.StorageURL, 0)
-	for rows.Next() {
-		var url models.StorageURL
-		if err = rows.Scan(&url.ShortURL, &url.OriginalURL, &url.UUID); err != nil {
-			return []*models.StorageURL{}, fmt.Errorf("error scanning url from db response %w", err)
+	for i, rule := range rules {
+		_, err = stmt.ExecContext(ctx,
+			shortURL, i, string(rule.Device), rule.Language, rule.NotBefore, rule.NotAfter, rule.Destination)
+		if err != nil {
+			return fmt.Errorf("error inserting redirect rule %w", err)
 		}
-		urls = append(urls, &url)
 	}
 
-	if err = rows.Err(); err != nil {
-		return []*models.StorageURL{}, fmt.Errorf("error iterating for rows of urls %w", err)
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("error commiting redirect rules %w", err)
 	}
-
-	return urls, nil
+	return nil
 }
 
-// GetSecretKey получить секретный ключ
-func (db *DatabaseStorage) GetSecretKey(ctx context.Context) (string, error) {
+// SetVariants заменить варианты адреса назначения владельца, сохраняя счётчики показов по имени варианта.
+func (db *DatabaseStorage) SetVariants(
+	ctx context.Context,
+	shortURL string,
+	userID int,
+	variants []models.Variant,
+) error {
 	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
 	defer cancel()
 
 	tx, err := db.DB.Begin()
 	if err != nil {
-		return "", fmt.Errorf("error starting transaction for secret kay %w", err)
+		return fmt.Errorf("error starting transaction for variants %w", err)
 	}
 	defer func() {
 		_ = tx.Rollback()
 	}()
 
-	query := `SELECT key FROM secret_key`
+	var owner int
+	err = tx.QueryRowContext(ctx, `SELECT user_id FROM url WHERE short_url = $1 FOR UPDATE`, shortURL).Scan(&owner)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+		return fmt.Errorf("error getting url owner %w", err)
+	}
+	if owner != userID {
+		return ErrNotFound
+	}
 
-	row := tx.QueryRowContext(ctx, query)
+	hits, err := db.getVariantHits(ctx, tx, shortURL)
+	if err != nil {
+		return err
+	}
 
-	var key string
-	if err = row.Scan(&key); err != nil && !errors.Is(err, sql.ErrNoRows) {
-		return "", fmt.Errorf("error scanning secret key row from db %w", err)
+	if _, err = tx.ExecContext(ctx, `DELETE FROM url_variant WHERE short_url = $1`, shortURL); err != nil {
+		return fmt.Errorf("error deleting old variants %w", err)
 	}
 
-	if errors.Is(err, sql.ErrNoRows) {
-		key, err = auth.GenerateAuthKey()
-		if err != nil {
-			return "", fmt.Errorf("error generating new secret key %w", err)
-		}
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO url_variant (short_url, position, name, destination, weight, hits)
+		VALUES ($1, $2, $3, $4, $5, $6)`)
+	if err != nil {
+		return fmt.Errorf("error prepare context for variants %w", err)
+	}
+	defer func() {
+		_ = stmt.Close()
+	}()
 
-		insertQuery := `INSERT INTO secret_key (key) VALUES ($1)`
-		_, err = tx.ExecContext(ctx, insertQuery, key)
+	for i, variant := range variants {
+		_, err = stmt.ExecContext(ctx,
+			shortURL, i, variant.Name, variant.Destination, variant.Weight, hits[variant.Name])
 		if err != nil {
-			return "", fmt.Errorf("error exec context %w", err)
+			return fmt.Errorf("error inserting variant %w", err)
 		}
 	}
 
 	if err = tx.Commit(); err != nil {
-		return "", fmt.Errorf("error commiting %w", err)
+		return fmt.Errorf("error commiting variants %w", err)
 	}
-	return key, nil
+	return nil
 }
 
-// GetURLsCount получить количество URL.
-func (db *DatabaseStorage) GetURLsCount(ctx context.Context) (int, error) {
+func (db *DatabaseStorage) getVariantHits(ctx context.Context, tx *sql.Tx, shortURL string) (map[string]int64, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT name, hits FROM url_variant WHERE short_url = $1`, shortURL)
+	if err != nil {
+		return nil, fmt.Errorf("error getting variant hits %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	hits := make(map[string]int64)
+	for rows.Next() {
+		var (
+			name  string
+			count int64
+		)
+		if err = rows.Scan(&name, &count); err != nil {
+			return nil, fmt.Errorf("error scanning variant hits %w", err)
+		}
+		hits[name] = count
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading variant hits %w", err)
+	}
+
+	return hits, nil
+}
+
+// AddVariantHits учесть hits показов варианта адреса назначения.
+func (db *DatabaseStorage) AddVariantHits(ctx context.Context, shortURL string, variant string, hits int64) error {
 	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
 	defer cancel()
 
-	var (
-		count int
-		err   error
-	)
-
-	row := db.DB.QueryRowContext(ctx, `SELECT COUNT(original_url) from url`)
+	res, err := db.DB.ExecContext(ctx,
+		`UPDATE url_variant SET hits = hits + $3 WHERE short_url = $1 AND name = $2`, shortURL, variant, hits)
+	if err != nil {
+		return fmt.Errorf("error adding variant hits %w", err)
+	}
 
-	if err = row.Scan(&count); err != nil {
-		return -1, fmt.Errorf("error scanning URLs count %w", err)
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error getting affected rows %w", err)
+	}
+	if affected == 0 {
+		return ErrNotFound
 	}
 
-	return count, nil
+	return nil
 }
 
-// GetUsersCount получить количество пользователей.
-func (db *DatabaseStorage) GetUsersCount(ctx context.Context) (int, error) {
+// AddDomain зарегистрировать домен за пользователем.
+func (db *DatabaseStorage) AddDomain(ctx context.Context, domain string, userID int) error {
 	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
 	defer cancel()
 
-	var (
-		count int
-		err   error
-	)
+	res, err := db.DB.ExecContext(ctx, `
+		INSERT INTO short_domain (name, user_id) VALUES ($1, $2)
+		ON CONFLICT (name) DO NOTHING`, domain, userID)
+	if err != nil {
+		return fmt.Errorf("error inserting domain %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error getting affected rows %w", err)
+	}
+	if affected == 0 {
+		return ErrDomainExist
+	}
+
+	return nil
+}
+
+// GetDomainOwner получить владельца зарегистрированного домена.
+func (db *DatabaseStorage) GetDomainOwner(ctx context.Context, domain string) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	var userID int
+	err := db.DB.QueryRowContext(ctx, `SELECT user_id FROM short_domain WHERE name = $1`, domain).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, fmt.Errorf("domain %s is not registered %w", domain, ErrNotFound)
+		}
+		return 0, fmt.Errorf("error getting domain owner %w", err)
+	}
+
+	return userID, nil
+}
+
+// GetDomains получить все зарегистрированные домены с их владельцами.
+func (db *DatabaseStorage) GetDomains(ctx context.Context) (map[string]int, error) {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	rows, err := db.DB.QueryContext(ctx, `SELECT name, user_id FROM short_domain`)
+	if err != nil {
+		return nil, fmt.Errorf("error getting domains %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	domains := make(map[string]int)
+	for rows.Next() {
+		var (
+			domain string
+			userID int
+		)
+		if err = rows.Scan(&domain, &userID); err != nil {
+			return nil, fmt.Errorf("error scanning domain %w", err)
+		}
+		domains[domain] = userID
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading domains %w", err)
+	}
+
+	return domains, nil
+}
+
+// GetUserDomains получить домены, зарегистрированные пользователем.
+func (db *DatabaseStorage) GetUserDomains(ctx context.Context, userID int) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	rows, err := db.DB.QueryContext(ctx, `SELECT name FROM short_domain WHERE user_id = $1 ORDER BY name`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting user domains %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	domains := make([]string, 0)
+	for rows.Next() {
+		var domain string
+		if err = rows.Scan(&domain); err != nil {
+			return nil, fmt.Errorf("error scanning user domain %w", err)
+		}
+		domains = append(domains, domain)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading user domains %w", err)
+	}
+
+	return domains, nil
+}
+
+// UpdateQuarantine поместить в карантин неудалённые адреса, оригинал которых запрещён blocked,
+// и снять карантин с остальных. Возвращает количество помещённых в карантин и освобождённых адресов.
+func (db *DatabaseStorage) UpdateQuarantine(
+	ctx context.Context,
+	blocked func(originalURL string) bool,
+) (int, int, error) {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	rows, err := db.DB.QueryContext(ctx, `SELECT short_url, original_url, quarantined FROM url WHERE NOT is_deleted`)
+	if err != nil {
+		return 0, 0, fmt.Errorf("error getting urls for quarantine %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	changed := make(map[string]bool)
+	for rows.Next() {
+		var (
+			short, original string
+			quarantined     bool
+		)
+		if err = rows.Scan(&short, &original, &quarantined); err != nil {
+			return 0, 0, fmt.Errorf("error scanning url for quarantine %w", err)
+		}
+		if isBlocked := blocked(original); isBlocked != quarantined {
+			changed[short] = isBlocked
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return 0, 0, fmt.Errorf("error reading urls for quarantine %w", err)
+	}
+	if len(changed) == 0 {
+		return 0, 0, nil
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return 0, 0, fmt.Errorf("error starting transaction for quarantine %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	stmt, err := tx.PrepareContext(ctx, `UPDATE url SET quarantined = $1 WHERE short_url = $2`)
+	if err != nil {
+		return 0, 0, fmt.Errorf("error prepare context for quarantine query %w", err)
+	}
+	defer func() {
+		_ = stmt.Close()
+	}()
+
+	var quarantined, released int
+	for short, isBlocked := range changed {
+		if _, err = stmt.ExecContext(ctx, isBlocked, short); err != nil {
+			return 0, 0, fmt.Errorf("error updating url quarantine %w", err)
+		}
+		if isBlocked {
+			quarantined++
+		} else {
+			released++
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, 0, fmt.Errorf("error commiting quarantine transaction %w", err)
+	}
+	return quarantined, released, nil
+}
+
+// GetLinksForHealthCheck получить до limit активных адресов, не проверявшихся с checkedBefore,
+// начиная с давно проверенных.
+func (db *DatabaseStorage) GetLinksForHealthCheck(
+	ctx context.Context,
+	checkedBefore time.Time,
+	limit int,
+) ([]*models.LinkHealth, error) {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	query := `
+		SELECT url.short_url, url.original_url, url.user_id,
+			COALESCE(h.status_code, 0), COALESCE(h.latency_ms, 0), COALESCE(h.error, ''),
+			COALESCE(h.failures, 0), COALESCE(h.broken, false), h.checked_at
+		FROM url LEFT JOIN link_health h ON h.short_url = url.short_url
+		WHERE NOT url.is_deleted AND NOT url.quarantined
+			AND (url.active_from IS NULL OR url.active_from <= NOW())
+			AND (url.active_until IS NULL OR url.active_until > NOW())
+			AND (h.checked_at IS NULL OR h.checked_at < $1)
+		ORDER BY h.checked_at NULLS FIRST
+		LIMIT $2`
+
+	rows, err := db.DB.QueryContext(ctx, query, checkedBefore, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error getting links for health check %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	return scanLinkHealth(rows)
+}
+
+// SaveLinkHealth сохранить результаты проверки адресов назначения.
+func (db *DatabaseStorage) SaveLinkHealth(ctx context.Context, health []*models.LinkHealth) error {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	query := `
+		INSERT INTO link_health (short_url, status_code, latency_ms, error, failures, broken, checked_at)
+		SELECT $1, $2, $3, $4, $5, $6, $7 WHERE EXISTS (SELECT 1 FROM url WHERE short_url = $1)
+		ON CONFLICT (short_url) DO UPDATE SET
+			status_code = EXCLUDED.status_code, latency_ms = EXCLUDED.latency_ms, error = EXCLUDED.error,
+			failures = EXCLUDED.failures, broken = EXCLUDED.broken, checked_at = EXCLUDED.checked_at`
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction for link health %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return fmt.Errorf("error prepare context for link health query %w", err)
+	}
+	defer func() {
+		_ = stmt.Close()
+	}()
+
+	for _, link := range health {
+		_, err = stmt.ExecContext(ctx, link.ShortURL, link.StatusCode, link.Latency.Milliseconds(),
+			link.Error, link.Failures, link.Broken, link.CheckedAt)
+		if err != nil {
+			return fmt.Errorf("error saving link health %w", err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("error commiting link health transaction %w", err)
+	}
+	return nil
+}
+
+// GetBrokenLinks получить неудалённые адреса пользователя, адрес назначения которых помечен недоступным.
+func (db *DatabaseStorage) GetBrokenLinks(ctx context.Context, userID int) ([]*models.LinkHealth, error) {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	query := `
+		SELECT url.short_url, url.original_url, url.user_id,
+			h.status_code, h.latency_ms, h.error, h.failures, h.broken, h.checked_at
+		FROM link_health h JOIN url ON url.short_url = h.short_url
+		WHERE url.user_id = $1 AND h.broken AND NOT url.is_deleted
+		ORDER BY h.checked_at DESC`
+
+	rows, err := db.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting broken links %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	return scanLinkHealth(rows)
+}
+
+// scanLinkHealth читает строки результатов проверки адресов назначения.
+func scanLinkHealth(rows *sql.Rows) ([]*models.LinkHealth, error) {
+	links := make([]*models.LinkHealth, 0)
+	for rows.Next() {
+		var (
+			link      models.LinkHealth
+			latencyMs int64
+			checkedAt sql.NullTime
+		)
+		err := rows.Scan(&link.ShortURL, &link.OriginalURL, &link.UserID,
+			&link.StatusCode, &latencyMs, &link.Error, &link.Failures, &link.Broken, &checkedAt)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning link health %w", err)
+		}
+		link.Latency = time.Duration(latencyMs) * time.Millisecond
+		link.CheckedAt = checkedAt.Time
+		links = append(links, &link)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading link health %w", err)
+	}
+
+	return links, nil
+}
+
+// CheckShort проверить наличие короткого адреса.
+func (db *DatabaseStorage) CheckShort(ctx context.Context, shortURL string) bool {
+	if _, err := db.GetURL(ctx, shortURL); err != nil {
+		return false
+	}
+
+	return true
+}
+
+// Ping пингануть
+func (db *DatabaseStorage) Ping(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	if err := db.DB.PingContext(ctx); err != nil {
+		return fmt.Errorf("error ping context %w", err)
+	}
+
+	return nil
+}
+
+// AddUser добавить пользователя
+func (db *DatabaseStorage) AddUser(ctx context.Context) (*models.User, error) {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	query := `INSERT INTO "user" DEFAULT VALUES RETURNING id`
+
+	var id int
+	row := tx.QueryRowContext(ctx, query)
+	if err = row.Scan(&id); err != nil {
+		return nil, fmt.Errorf("error insert new user in db %w", err)
+	}
+
+	user := &models.User{
+		ID:   id,
+		URLs: make([]*models.StorageURL, 0),
+		Service: &models.UserService{
+			IsAuthenticated: false,
+			Token:           "",
+		},
+	}
+
+	_ = tx.Commit()
+	return user, nil
+}
+
+// AddAccount создать пользователя с аккаунтом и записать его идентификатор в account.UserID.
+func (db *DatabaseStorage) AddAccount(ctx context.Context, account *models.Account) error {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	err := db.DB.QueryRowContext(ctx, `
+		INSERT INTO "user" (email, password_hash, registered_at) VALUES ($1, $2, NOW())
+		ON CONFLICT (email) DO NOTHING RETURNING id`, account.Email, account.PasswordHash).Scan(&account.UserID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrAccountExist
+		}
+		return fmt.Errorf("error inserting account %w", err)
+	}
+
+	return nil
+}
+
+// GetAccount получить аккаунт по почте.
+func (db *DatabaseStorage) GetAccount(ctx context.Context, email string) (*models.Account, error) {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	account := &models.Account{Email: email}
+	err := db.DB.QueryRowContext(ctx, `SELECT id, password_hash FROM "user" WHERE email = $1`, email).
+		Scan(&account.UserID, &account.PasswordHash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("account %s is not registered %w", email, ErrNotFound)
+		}
+		return nil, fmt.Errorf("error getting account %w", err)
+	}
+
+	return account, nil
+}
+
+// AddOIDCIdentity привязать пользователя провайдера OpenID Connect к аккаунту identity.UserID.
+func (db *DatabaseStorage) AddOIDCIdentity(ctx context.Context, identity *models.OIDCIdentity) error {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	res, err := db.DB.ExecContext(ctx, `
+		INSERT INTO oidc_identity (issuer, subject, user_id) VALUES ($1, $2, $3)
+		ON CONFLICT (issuer, subject) DO NOTHING`, identity.Issuer, identity.Subject, identity.UserID)
+	if err != nil {
+		return fmt.Errorf("error inserting oidc identity %w", err)
+	}
+	linked, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error getting rows affected %w", err)
+	}
+	if linked == 0 {
+		return ErrIdentityExist
+	}
+
+	return nil
+}
+
+// GetOIDCIdentity получить аккаунт, к которому привязан пользователь subject провайдера issuer.
+func (db *DatabaseStorage) GetOIDCIdentity(
+	ctx context.Context,
+	issuer, subject string,
+) (*models.OIDCIdentity, error) {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	identity := &models.OIDCIdentity{Issuer: issuer, Subject: subject}
+	err := db.DB.QueryRowContext(ctx, `
+		SELECT u.id, COALESCE(u.email, '') FROM oidc_identity i JOIN "user" u ON u.id = i.user_id
+		WHERE i.issuer = $1 AND i.subject = $2`, issuer, subject).
+		Scan(&identity.UserID, &identity.Email)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("oidc identity %s is not linked %w", subject, ErrNotFound)
+		}
+		return nil, fmt.Errorf("error getting oidc identity %w", err)
+	}
+
+	return identity, nil
+}
+
+// MergeUsers передать адреса, домены, задачи на удаление и ключи API пользователя fromUserID
+// пользователю toUserID. Возвращает количество переданных адресов.
+func (db *DatabaseStorage) MergeUsers(ctx context.Context, fromUserID, toUserID int) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("error starting transaction for merging users %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	res, err := tx.ExecContext(ctx, `UPDATE url SET user_id = $2 WHERE user_id = $1`, fromUserID, toUserID)
+	if err != nil {
+		return 0, fmt.Errorf("error merging user urls %w", err)
+	}
+	moved, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error getting affected rows %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE short_domain SET user_id = $2 WHERE user_id = $1`, fromUserID, toUserID)
+	if err != nil {
+		return 0, fmt.Errorf("error merging user domains %w", err)
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE delete_task SET user_id = $2 WHERE user_id = $1`, fromUserID, toUserID)
+	if err != nil {
+		return 0, fmt.Errorf("error merging user delete tasks %w", err)
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE api_key SET user_id = $2 WHERE user_id = $1`, fromUserID, toUserID)
+	if err != nil {
+		return 0, fmt.Errorf("error merging user api keys %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("error committing merged users %w", err)
+	}
+	return int(moved), nil
+}
+
+// AddAPIKey сохранить ключ API.
+func (db *DatabaseStorage) AddAPIKey(ctx context.Context, key *models.APIKey) error {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	scopes, err := json.Marshal(key.Scopes)
+	if err != nil {
+		return fmt.Errorf("error marshal api key scopes %w", err)
+	}
+
+	_, err = db.DB.ExecContext(ctx, `
+		INSERT INTO api_key (id, user_id, name, hash, scopes, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		key.ID, key.UserID, key.Name, key.Hash, scopes, key.CreatedAt, key.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("error inserting api key %w", err)
+	}
+
+	return nil
+}
+
+// GetAPIKey получить ключ API по идентификатору.
+func (db *DatabaseStorage) GetAPIKey(ctx context.Context, id string) (*models.APIKey, error) {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	row := db.DB.QueryRowContext(ctx, `
+		SELECT id, user_id, name, hash, scopes, created_at, expires_at FROM api_key WHERE id = $1`, id)
+	key, err := scanAPIKey(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("api key %s %w", id, ErrNotFound)
+		}
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// GetUserAPIKeys получить ключи API пользователя в порядке создания.
+func (db *DatabaseStorage) GetUserAPIKeys(ctx context.Context, userID int) ([]*models.APIKey, error) {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	rows, err := db.DB.QueryContext(ctx, `
+		SELECT id, user_id, name, hash, scopes, created_at, expires_at FROM api_key
+		WHERE user_id = $1 ORDER BY created_at, id`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting user api keys %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	keys := make([]*models.APIKey, 0)
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating user api keys %w", err)
+	}
+
+	return keys, nil
+}
+
+// DeleteAPIKey удалить ключ API пользователя. Чужой ключ не удаляется и считается ненайденным.
+func (db *DatabaseStorage) DeleteAPIKey(ctx context.Context, id string, userID int) error {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	res, err := db.DB.ExecContext(ctx, `DELETE FROM api_key WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return fmt.Errorf("error deleting api key %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error getting affected rows %w", err)
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// scanAPIKey читает ключ API из строки запроса.
+func scanAPIKey(row rowScanner) (*models.APIKey, error) {
+	var (
+		key       models.APIKey
+		scopes    []byte
+		expiresAt sql.NullTime
+	)
+
+	err := row.Scan(&key.ID, &key.UserID, &key.Name, &key.Hash, &scopes, &key.CreatedAt, &expiresAt)
+	if err != nil {
+		return nil, fmt.Errorf("error scanning api key row %w", err)
+	}
+	if expiresAt.Valid {
+		key.ExpiresAt = &expiresAt.Time
+	}
+	if err = json.Unmarshal(scopes, &key.Scopes); err != nil {
+		return nil, fmt.Errorf("error unmarshal api key scopes %w", err)
+	}
+
+	return &key, nil
+}
+
+// AddRefreshToken сохранить токен обновления.
+func (db *DatabaseStorage) AddRefreshToken(ctx context.Context, token *models.RefreshToken) error {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	_, err := db.DB.ExecContext(ctx, `
+		INSERT INTO refresh_token (id, family, user_id, email, hash, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		token.ID, token.Family, token.UserID, token.Email, token.Hash, token.CreatedAt, token.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("error inserting refresh token %w", err)
+	}
+
+	return nil
+}
+
+// GetRefreshToken получить токен обновления по идентификатору.
+func (db *DatabaseStorage) GetRefreshToken(ctx context.Context, id string) (*models.RefreshToken, error) {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	var (
+		token     models.RefreshToken
+		revokedAt sql.NullTime
+	)
+	err := db.DB.QueryRowContext(ctx, `
+		SELECT id, family, user_id, email, hash, replaced_by, created_at, expires_at, revoked_at
+		FROM refresh_token WHERE id = $1`, id).
+		Scan(&token.ID, &token.Family, &token.UserID, &token.Email, &token.Hash, &token.ReplacedBy,
+			&token.CreatedAt, &token.ExpiresAt, &revokedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("refresh token %s %w", id, ErrNotFound)
+		}
+		return nil, fmt.Errorf("error getting refresh token %w", err)
+	}
+	if revokedAt.Valid {
+		token.RevokedAt = &revokedAt.Time
+	}
+
+	return &token, nil
+}
+
+// RotateRefreshToken заменить токен обновления id следующим токеном next. Токен заменяется условным
+// обновлением, поэтому из двух одновременных обновлений одним токеном успешно только одно,
+// второе получает ErrRefreshTokenUsed. Заодно удаляются истёкшие токены.
+func (db *DatabaseStorage) RotateRefreshToken(ctx context.Context, id string, next *models.RefreshToken) error {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction for refresh token %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	res, err := tx.ExecContext(ctx, `
+		UPDATE refresh_token SET replaced_by = $2
+		WHERE id = $1 AND replaced_by = '' AND revoked_at IS NULL`, id, next.ID)
+	if err != nil {
+		return fmt.Errorf("error replacing refresh token %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error getting affected rows %w", err)
+	}
+	if affected == 0 {
+		return ErrRefreshTokenUsed
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO refresh_token (id, family, user_id, email, hash, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		next.ID, next.Family, next.UserID, next.Email, next.Hash, next.CreatedAt, next.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("error inserting refresh token %w", err)
+	}
+	if _, err = tx.ExecContext(ctx, `DELETE FROM refresh_token WHERE expires_at <= NOW()`); err != nil {
+		return fmt.Errorf("error deleting expired refresh tokens %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("error committing refresh token rotation %w", err)
+	}
+	return nil
+}
+
+// RevokeRefreshTokens отозвать все токены обновления семейства family.
+func (db *DatabaseStorage) RevokeRefreshTokens(ctx context.Context, family string) error {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	_, err := db.DB.ExecContext(ctx, `
+		UPDATE refresh_token SET revoked_at = NOW() WHERE family = $1 AND revoked_at IS NULL`, family)
+	if err != nil {
+		return fmt.Errorf("error revoking refresh tokens %w", err)
+	}
+
+	return nil
+}
+
+// RevokeToken отозвать токен доступа до истечения его срока. Заодно удаляются отозванные токены,
+// срок которых уже истёк.
+func (db *DatabaseStorage) RevokeToken(ctx context.Context, token *models.RevokedToken) error {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	if _, err := db.DB.ExecContext(ctx, `DELETE FROM revoked_token WHERE expires_at <= NOW()`); err != nil {
+		return fmt.Errorf("error deleting expired revoked tokens %w", err)
+	}
+	_, err := db.DB.ExecContext(ctx, `
+		INSERT INTO revoked_token (jti, expires_at) VALUES ($1, $2) ON CONFLICT (jti) DO NOTHING`,
+		token.ID, token.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("error inserting revoked token %w", err)
+	}
+
+	return nil
+}
+
+// IsTokenRevoked сообщает, отозван ли токен доступа с идентификатором id.
+func (db *DatabaseStorage) IsTokenRevoked(ctx context.Context, id string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	var revoked bool
+	err := db.DB.QueryRowContext(ctx, `
+		SELECT EXISTS(SELECT 1 FROM revoked_token WHERE jti = $1 AND expires_at > NOW())`, id).Scan(&revoked)
+	if err != nil {
+		return false, fmt.Errorf("error checking revoked token %w", err)
+	}
+
+	return revoked, nil
+}
+
+// AddSigningKey сохранить ключ подписи токенов.
+func (db *DatabaseStorage) AddSigningKey(ctx context.Context, key *models.SigningKey) error {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	_, err := db.DB.ExecContext(ctx, `INSERT INTO signing_key (kid, alg, secret, created_at) VALUES ($1, $2, $3, $4)`,
+		key.ID, key.Algorithm, key.Secret, key.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("error inserting signing key %w", err)
+	}
+
+	return nil
+}
+
+// GetSigningKeys получить все ключи подписи, включая выведенные из оборота, от старых к новым.
+func (db *DatabaseStorage) GetSigningKeys(ctx context.Context) ([]*models.SigningKey, error) {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	rows, err := db.DB.QueryContext(ctx, `
+		SELECT kid, alg, secret, created_at, retired_at FROM signing_key ORDER BY created_at, kid`)
+	if err != nil {
+		return nil, fmt.Errorf("error getting signing keys %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	keys := make([]*models.SigningKey, 0)
+	for rows.Next() {
+		var (
+			key       models.SigningKey
+			retiredAt sql.NullTime
+		)
+		if err = rows.Scan(&key.ID, &key.Algorithm, &key.Secret, &key.CreatedAt, &retiredAt); err != nil {
+			return nil, fmt.Errorf("error scanning signing key %w", err)
+		}
+		if retiredAt.Valid {
+			key.RetiredAt = &retiredAt.Time
+		}
+		keys = append(keys, &key)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating signing keys %w", err)
+	}
+
+	return keys, nil
+}
+
+// RetireSigningKey вывести ключ подписи из оборота. Уже выведенный ключ не меняется.
+func (db *DatabaseStorage) RetireSigningKey(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	res, err := db.DB.ExecContext(ctx, `
+		UPDATE signing_key SET retired_at = COALESCE(retired_at, NOW()) WHERE kid = $1`, id)
+	if err != nil {
+		return fmt.Errorf("error retiring signing key %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error getting retired signing keys %w", err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("signing key %s %w", id, ErrNotFound)
+	}
+
+	return nil
+}
+
+// GetURLsByUserID получить адреса пользователя
+func (db *DatabaseStorage) GetURLsByUserID(ctx context.Context, userID int) ([]*models.StorageURL, error) {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	query := `
+                                SELECT short_url, original_url, uuid, quarantined, is_deleted, deleted_at, created_at
+                                FROM url WHERE user_id = $1 ORDER BY created_at, short_url;`
+
+	rows, err := db.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return []*models.StorageURL{}, fmt.Errorf("error getting url rows from db %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	urls := make([]*models.StorageURL, 0)
+	for rows.Next() {
+		var (
+			url       models.StorageURL
+			deletedAt sql.NullTime
+		)
+		err = rows.Scan(&url.ShortURL, &url.OriginalURL, &url.UUID, &url.Quarantined,
+			&url.DeletedFlag, &deletedAt, &url.CreatedAt)
+		if err != nil {
+			return []*models.StorageURL{}, fmt.Errorf("error scanning url from db response %w", err)
+		}
+		url.UserID = userID
+		url.DeletedAt = deletedAt.Time
+		urls = append(urls, &url)
+	}
+
+	if err = rows.Err(); err != nil {
+		return []*models.StorageURL{}, fmt.Errorf("error iterating for rows of urls %w", err)
+	}
+
+	return urls, nil
+}
+
+// GetSecretKey получить секретный ключ
+func (db *DatabaseStorage) GetSecretKey(ctx context.Context) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return "", fmt.Errorf("error starting transaction for secret kay %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	query := `SELECT key FROM secret_key`
+
+	row := tx.QueryRowContext(ctx, query)
+
+	var key string
+	if err = row.Scan(&key); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return "", fmt.Errorf("error scanning secret key row from db %w", err)
+	}
+
+	if errors.Is(err, sql.ErrNoRows) {
+		key, err = auth.GenerateAuthKey()
+		if err != nil {
+			return "", fmt.Errorf("error generating new secret key %w", err)
+		}
+
+		insertQuery := `INSERT INTO secret_key (key) VALUES ($1)`
+		_, err = tx.ExecContext(ctx, insertQuery, key)
+		if err != nil {
+			return "", fmt.Errorf("error exec context %w", err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return "", fmt.Errorf("error commiting %w", err)
+	}
+	return key, nil
+}
+
+// GetServiceStats получить агрегаты ссылок, задач на удаление и переходов для статистики сервиса.
+func (db *DatabaseStorage) GetServiceStats(ctx context.Context, now time.Time, top int) (*models.ServiceStats, error) {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	stats := &models.ServiceStats{TopLinks: make([]models.LinkClicks, 0)}
+
+	row := db.DB.QueryRowContext(ctx, `
+		SELECT
+			COUNT(*) FILTER (WHERE NOT is_deleted),
+			COUNT(*) FILTER (WHERE is_deleted),
+			COUNT(*) FILTER (WHERE created_at > $1),
+			COUNT(*) FILTER (WHERE created_at > $2),
+			COUNT(*) FILTER (WHERE created_at > $3),
+			(SELECT COUNT(*) FROM delete_task WHERE status = $4),
+			(SELECT COALESCE(SUM(clicks), 0) FROM click_total)
+		FROM url`,
+		now.Add(-time.Hour), now.Add(-24*time.Hour), now.Add(-7*24*time.Hour), models.Registered)
+	err := row.Scan(
+		&stats.ActiveURLs, &stats.DeletedURLs,
+		&stats.CreatedLastHour, &stats.CreatedLastDay, &stats.CreatedLastWeek,
+		&stats.PendingDeleteTasks, &stats.TotalClicks,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error scanning service stats %w", err)
+	}
+
+	rows, err := db.DB.QueryContext(ctx, `
+		SELECT t.short_url, t.clicks
+		FROM click_total t JOIN url u ON u.short_url = t.short_url
+		WHERE NOT u.is_deleted
+		ORDER BY t.clicks DESC, t.short_url
+		LIMIT $1`, top)
+	if err != nil {
+		return nil, fmt.Errorf("error getting top links %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	for rows.Next() {
+		var link models.LinkClicks
+		if err = rows.Scan(&link.ShortURL, &link.Clicks); err != nil {
+			return nil, fmt.Errorf("error scanning top link %w", err)
+		}
+		stats.TopLinks = append(stats.TopLinks, link)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading top links %w", err)
+	}
+
+	return stats, nil
+}
+
+// GetUsersCount получить количество пользователей.
+func (db *DatabaseStorage) GetUsersCount(ctx context.Context) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	var (
+		count int
+		err   error
+	)
 
 	row := db.DB.QueryRowContext(ctx, `SELECT COUNT(id) from "user"`)
 
@@ -463,3 +1705,331 @@ func (db *DatabaseStorage) GetUsersCount(ctx context.Context) (int, error) {
 
 	return count, nil
 }
+
+// AddClicks сохранить события переходов и обновить агрегаты по ссылкам в одной транзакции.
+// Месячные партиции таблицы click_event создаются по мере необходимости.
+func (db *DatabaseStorage) AddClicks(ctx context.Context, events []*models.ClickEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	for _, event := range events {
+		if err := db.ensureClickPartition(ctx, event.Time); err != nil {
+			return err
+		}
+	}
+
+	var (
+		shortURLs []string
+		rollups   = map[string]*linkClicks{}
+		visitors  = dailyVisitors{}
+		rawRows   = make([][]interface{}, 0, len(events))
+	)
+	for _, event := range events {
+		rawRows = append(rawRows, []interface{}{
+			event.ShortURL, event.Time, event.Referrer, event.UserAgent, event.IP, event.Language,
+		})
+
+		rollup, ok := rollups[event.ShortURL]
+		if !ok {
+			rollup = newLinkClicks()
+			rollups[event.ShortURL] = rollup
+			shortURLs = append(shortURLs, event.ShortURL)
+		}
+		rollup.add(event)
+		visitors.add(event)
+	}
+
+	var totalRows, hourRows, dimensionRows [][]interface{}
+	for _, short := range shortURLs {
+		totalRows = append(totalRows, []interface{}{short, rollups[short].total})
+		hourRows = append(hourRows, rollups[short].hourRows(short)...)
+		dimensionRows = append(dimensionRows, rollups[short].dimensionRows(short)...)
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction for click events %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	inserts := []struct {
+		query    string
+		conflict string
+		rows     [][]interface{}
+	}{
+		{
+			query: `INSERT INTO click_event (short_url, clicked_at, referrer, user_agent, ip, language) VALUES `,
+			rows:  rawRows,
+		},
+		{
+			query:    `INSERT INTO click_total (short_url, clicks) VALUES `,
+			conflict: ` ON CONFLICT (short_url) DO UPDATE SET clicks = click_total.clicks + EXCLUDED.clicks`,
+			rows:     totalRows,
+		},
+		{
+			query: `INSERT INTO click_rollup_hour (short_url, bucket, clicks) VALUES `,
+			conflict: ` ON CONFLICT (short_url, bucket)
+				DO UPDATE SET clicks = click_rollup_hour.clicks + EXCLUDED.clicks`,
+			rows: hourRows,
+		},
+		{
+			query: `INSERT INTO click_rollup_dim (short_url, day, dimension, value, clicks) VALUES `,
+			conflict: ` ON CONFLICT (short_url, day, dimension, value)
+				DO UPDATE SET clicks = click_rollup_dim.clicks + EXCLUDED.clicks`,
+			rows: dimensionRows,
+		},
+	}
+	for _, insert := range inserts {
+		if err = insertRows(ctx, tx, insert.query, insert.conflict, insert.rows); err != nil {
+			return err
+		}
+	}
+
+	sketches := map[string]dailyVisitors{serviceVisitorsKey: visitors}
+	for _, short := range shortURLs {
+		sketches[short] = rollups[short].visitors
+	}
+	if err = mergeVisitorSketches(ctx, tx, sketches); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("error commiting click events transaction %w", err)
+	}
+	return nil
+}
+
+// insertRows вставить строки многострочными INSERT по clickInsertChunk строк.
+func insertRows(ctx context.Context, tx *sql.Tx, query string, conflict string, rows [][]interface{}) error {
+	for start := 0; start < len(rows); start += clickInsertChunk {
+		chunk := rows[start:min(start+clickInsertChunk, len(rows))]
+
+		placeholders := make([]string, len(chunk))
+		values := make([]interface{}, 0, len(chunk)*len(chunk[0]))
+		for i, row := range chunk {
+			params := make([]string, len(row))
+			for j := range row {
+				params[j] = fmt.Sprintf("$%d", len(values)+j+1)
+			}
+			placeholders[i] = "(" + strings.Join(params, ", ") + ")"
+			values = append(values, row...)
+		}
+
+		if _, err := tx.ExecContext(ctx, query+strings.Join(placeholders, ", ")+conflict, values...); err != nil {
+			return fmt.Errorf("error inserting click rows %w", err)
+		}
+	}
+	return nil
+}
+
+// mergeVisitorSketches объединить скетчи уникальных посетителей с сохранёнными.
+// Строки блокируются в порядке ключа и суток, чтобы параллельные транзакции не взаимоблокировались.
+func mergeVisitorSketches(ctx context.Context, tx *sql.Tx, sketches map[string]dailyVisitors) error {
+	type sketchKey struct {
+		day      time.Time
+		shortURL string
+	}
+
+	keys := make([]sketchKey, 0, len(sketches))
+	for short, days := range sketches {
+		for day := range days {
+			keys = append(keys, sketchKey{shortURL: short, day: day})
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].shortURL != keys[j].shortURL {
+			return keys[i].shortURL < keys[j].shortURL
+		}
+		return keys[i].day.Before(keys[j].day)
+	})
+
+	for _, key := range keys {
+		sketch := sketches[key.shortURL][key.day]
+		day := key.day.Format(time.DateOnly)
+
+		data, err := sketch.MarshalBinary()
+		if err != nil {
+			return fmt.Errorf("error encoding visitors sketch %w", err)
+		}
+		res, err := tx.ExecContext(ctx, `
+			INSERT INTO click_visitors (short_url, day, sketch) VALUES ($1, $2, $3)
+			ON CONFLICT (short_url, day) DO NOTHING`, key.shortURL, day, data)
+		if err != nil {
+			return fmt.Errorf("error inserting visitors sketch %w", err)
+		}
+		if inserted, _ := res.RowsAffected(); inserted > 0 {
+			continue
+		}
+
+		var stored []byte
+		row := tx.QueryRowContext(ctx,
+			`SELECT sketch FROM click_visitors WHERE short_url = $1 AND day = $2 FOR UPDATE`, key.shortURL, day)
+		if err = row.Scan(&stored); err != nil {
+			return fmt.Errorf("error locking visitors sketch %w", err)
+		}
+		merged := hll.New()
+		if err = merged.UnmarshalBinary(stored); err != nil {
+			return fmt.Errorf("error decoding visitors sketch %w", err)
+		}
+		merged.Merge(sketch)
+		if data, err = merged.MarshalBinary(); err != nil {
+			return fmt.Errorf("error encoding visitors sketch %w", err)
+		}
+
+		_, err = tx.ExecContext(ctx,
+			`UPDATE click_visitors SET sketch = $3 WHERE short_url = $1 AND day = $2`, key.shortURL, day, data)
+		if err != nil {
+			return fmt.Errorf("error updating visitors sketch %w", err)
+		}
+	}
+	return nil
+}
+
+// GetClickStats получить статистику переходов по ссылке за интервал запроса из агрегатов.
+func (db *DatabaseStorage) GetClickStats(
+	ctx context.Context,
+	shortURL string,
+	query models.ClickStatsQuery,
+) (*models.ClickStats, error) {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	stats := &models.ClickStats{Top: map[models.ClickDimension][]models.ClickCount{}}
+
+	row := db.DB.QueryRowContext(ctx,
+		`SELECT COALESCE((SELECT clicks FROM click_total WHERE short_url = $1), 0)`, shortURL)
+	if err := row.Scan(&stats.TotalCount); err != nil {
+		return nil, fmt.Errorf("error scanning total clicks %w", err)
+	}
+
+	rows, err := db.DB.QueryContext(ctx, `
+		SELECT date_trunc($4, bucket, 'UTC') AS point, SUM(clicks)
+		FROM click_rollup_hour
+		WHERE short_url = $1 AND bucket >= $2 AND bucket < $3
+		GROUP BY point ORDER BY point`,
+		shortURL, query.From, query.To, string(query.Bucket))
+	if err != nil {
+		return nil, fmt.Errorf("error getting clicks series %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	for rows.Next() {
+		var point models.StatsPoint
+		if err = rows.Scan(&point.Time, &point.Clicks); err != nil {
+			return nil, fmt.Errorf("error scanning clicks series %w", err)
+		}
+		point.Time = point.Time.UTC()
+		stats.Series = append(stats.Series, point)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading clicks series %w", err)
+	}
+
+	dimRows, err := db.DB.QueryContext(ctx, `
+		SELECT dimension, value, clicks FROM (
+			SELECT dimension, value, SUM(clicks) AS clicks,
+				ROW_NUMBER() OVER (PARTITION BY dimension ORDER BY SUM(clicks) DESC, value) AS position
+			FROM click_rollup_dim
+			WHERE short_url = $1 AND day >= $2::date AND day < ($3 AT TIME ZONE 'UTC')
+			GROUP BY dimension, value
+		) top
+		WHERE $4 = 0 OR position <= $4
+		ORDER BY dimension, position`,
+		shortURL, truncateDay(query.From).Format(time.DateOnly), query.To, query.Top)
+	if err != nil {
+		return nil, fmt.Errorf("error getting clicks dimensions %w", err)
+	}
+	defer func() {
+		_ = dimRows.Close()
+	}()
+
+	for dimRows.Next() {
+		var (
+			dimension string
+			count     models.ClickCount
+		)
+		if err = dimRows.Scan(&dimension, &count.Value, &count.Clicks); err != nil {
+			return nil, fmt.Errorf("error scanning clicks dimension %w", err)
+		}
+		stats.Top[models.ClickDimension(dimension)] = append(stats.Top[models.ClickDimension(dimension)], count)
+	}
+	if err = dimRows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading clicks dimensions %w", err)
+	}
+
+	stats.UniqueVisitors, err = db.estimateVisitors(ctx, `
+		SELECT sketch FROM click_visitors
+		WHERE short_url = $1 AND day >= $2::date AND day < ($3 AT TIME ZONE 'UTC')`,
+		shortURL, truncateDay(query.From).Format(time.DateOnly), query.To)
+	if err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// GetUniqueVisitors получить оценку уникальных посетителей сервиса за всё время.
+func (db *DatabaseStorage) GetUniqueVisitors(ctx context.Context) (uint64, error) {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	return db.estimateVisitors(ctx, `SELECT sketch FROM click_visitors WHERE short_url = $1`, serviceVisitorsKey)
+}
+
+// estimateVisitors объединить скетчи уникальных посетителей, выбранные запросом, и оценить их количество.
+func (db *DatabaseStorage) estimateVisitors(ctx context.Context, query string, args ...interface{}) (uint64, error) {
+	rows, err := db.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("error getting visitors sketches %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	merged := hll.New()
+	for rows.Next() {
+		var data []byte
+		if err = rows.Scan(&data); err != nil {
+			return 0, fmt.Errorf("error scanning visitors sketch %w", err)
+		}
+
+		var sketch hll.Sketch
+		if err = sketch.UnmarshalBinary(data); err != nil {
+			return 0, fmt.Errorf("error decoding visitors sketch %w", err)
+		}
+		merged.Merge(&sketch)
+	}
+	if err = rows.Err(); err != nil {
+		return 0, fmt.Errorf("error reading visitors sketches %w", err)
+	}
+
+	return merged.Estimate(), nil
+}
+
+// ensureClickPartition создать месячную партицию click_event для момента t, если она ещё не создана.
+func (db *DatabaseStorage) ensureClickPartition(ctx context.Context, t time.Time) error {
+	from := time.Date(t.UTC().Year(), t.UTC().Month(), 1, 0, 0, 0, 0, time.UTC)
+	name := "click_event_" + from.Format("200601")
+	if _, ok := db.clickPartitions.Load(name); ok {
+		return nil
+	}
+
+	_, err := db.DB.ExecContext(ctx, fmt.Sprintf(
+		`CREATE TABLE IF NOT EXISTS %s PARTITION OF click_event FOR VALUES FROM ('%s') TO ('%s')`,
+		name, from.Format(time.RFC3339), from.AddDate(0, 1, 0).Format(time.RFC3339),
+	))
+	if err != nil {
+		return fmt.Errorf("error creating click event partition %s %w", name, err)
+	}
+
+	db.clickPartitions.Store(name, struct{}{})
+	return nil
+}
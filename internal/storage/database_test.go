@@ -3,14 +3,31 @@ package storage
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/Melikhov-p/url-minimise/internal/hll"
 	"github.com/Melikhov-p/url-minimise/internal/models"
 	"github.com/stretchr/testify/assert"
 )
 
+// urlColumnNames колонки, которые читает scanURL.
+var urlColumnNames = []string{
+	"short_url", "original_url", "user_id", "uuid", "is_deleted", "deleted_at", "created_at", "redirect_code", "no_cache",
+	"query_passthrough", "utm", "active_from", "active_until", "quarantined", "rules", "variants",
+}
+
+// urlRow строка таблицы url со значениями по умолчанию для urlColumnNames.
+func urlRow(short, original string, userID int) []driver.Value {
+	return []driver.Value{
+		short, original, userID, "uuid", false, nil, time.Time{}, 307, false,
+		false, []byte("{}"), nil, nil, false, []byte("[]"), []byte("[]"),
+	}
+}
+
 func TestDatabaseStorage_GetURL(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	if err != nil {
@@ -36,7 +53,7 @@ func TestDatabaseStorage_GetURL(t *testing.T) {
 			shortURL: "notexist.com",
 			mockBehavior: func(s sqlmock.Sqlmock, short string) {
 				mock.ExpectQuery(
-					"SELECT original_url, user_id, uuid, is_deleted  FROM url WHERE short_url = ?",
+					"SELECT (.+) FROM url WHERE short_url = ?",
 				).WithArgs(short)
 			},
 			wantFound: false,
@@ -46,10 +63,9 @@ func TestDatabaseStorage_GetURL(t *testing.T) {
 			name:     "Found",
 			shortURL: "exist.com",
 			mockBehavior: func(s sqlmock.Sqlmock, short string) {
-				rows := sqlmock.NewRows([]string{"original_url", "user_id", "uuid", "is_deleted"}).
-					AddRow("full", 1, "12", false)
+				rows := sqlmock.NewRows(urlColumnNames).AddRow(urlRow(short, "full", 1)...)
 				mock.ExpectQuery(
-					"SELECT original_url, user_id, uuid, is_deleted  FROM url WHERE short_url = ?",
+					"SELECT (.+) FROM url WHERE short_url = ?",
 				).WithArgs(short).WillReturnRows(rows)
 			},
 			wantFound: true,
@@ -496,9 +512,8 @@ func TestDatabaseStorage_CheckShort(t *testing.T) {
 			exist: true,
 			mockBehavior: func(s sqlmock.Sqlmock, short string) {
 
-				rows := mock.NewRows([]string{"original_url", "user_id", "uuid", "is_deleted"}).
-					AddRow("original", 1, "1", false)
-				mock.ExpectQuery(`SELECT original_url, user_id, uuid, is_deleted  FROM url WHERE short_url = ?`).
+				rows := mock.NewRows(urlColumnNames).AddRow(urlRow(short, "original", 1)...)
+				mock.ExpectQuery(`SELECT (.+) FROM url WHERE short_url = ?`).
 					WithArgs(short).WillReturnRows(rows)
 
 			},
@@ -508,7 +523,7 @@ func TestDatabaseStorage_CheckShort(t *testing.T) {
 			short: "short",
 			exist: false,
 			mockBehavior: func(s sqlmock.Sqlmock, short string) {
-				mock.ExpectQuery(`SELECT original_url, user_id, uuid, is_deleted  FROM url WHERE short_url = ?`).
+				mock.ExpectQuery(`SELECT (.+) FROM url WHERE short_url = ?`).
 					WithArgs(short).WillReturnError(sql.ErrNoRows)
 			},
 		},
@@ -605,6 +620,38 @@ func TestDatabaseStorage_GetShortURL(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestDatabaseStorage_GetShortURLs(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+
+	storage := DatabaseStorage{
+		DB: db,
+	}
+
+	shortURLs, err := storage.GetShortURLs(context.Background(), nil)
+	assert.NoError(t, err)
+	assert.Empty(t, shortURLs)
+
+	mock.ExpectQuery(`SELECT original_url, short_url FROM url WHERE original_url IN \(\$1, \$2\)`).
+		WithArgs("https://a.example.com", "https://b.example.com").
+		WillReturnRows(sqlmock.NewRows([]string{"original_url", "short_url"}).AddRow("https://a.example.com", "a"))
+	shortURLs, err = storage.GetShortURLs(context.Background(), []string{"https://a.example.com", "https://b.example.com"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"https://a.example.com": "a"}, shortURLs)
+
+	mock.ExpectQuery(`SELECT original_url, short_url FROM url`).WillReturnError(sql.ErrConnDone)
+	_, err = storage.GetShortURLs(context.Background(), []string{"https://a.example.com"})
+	assert.ErrorIs(t, err, sql.ErrConnDone)
+
+	err = mock.ExpectationsWereMet()
+	assert.NoError(t, err)
+}
+
 func TestDatabaseStorage_GetDeleteTasksWStatus(t *testing.T) {
 	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
 	if err != nil {
@@ -685,3 +732,870 @@ func TestDatabaseStorage_Close(t *testing.T) {
 	err = mock.ExpectationsWereMet()
 	assert.NoError(t, err)
 }
+
+func TestDatabaseStorage_PurgeDeletedURLs(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+
+	storage := DatabaseStorage{
+		DB: db,
+	}
+	deletedBefore := time.Now()
+
+	testCases := []struct {
+		name         string
+		mockBehavior func(sqlmock.Sqlmock)
+		wantPurged   int
+		wantErr      bool
+	}{
+		{
+			name: "Purged",
+			mockBehavior: func(s sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`WITH purged AS`).WithArgs(deletedBefore).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+				mock.ExpectExec(`INSERT INTO purge_log`).WithArgs(3).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+			},
+			wantPurged: 3,
+			wantErr:    false,
+		},
+		{
+			name: "NothingToPurge",
+			mockBehavior: func(s sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`WITH purged AS`).WithArgs(deletedBefore).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+				mock.ExpectCommit()
+			},
+			wantPurged: 0,
+			wantErr:    false,
+		},
+		{
+			name: "Fail",
+			mockBehavior: func(s sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`WITH purged AS`).WithArgs(deletedBefore).
+					WillReturnError(errors.New("db error"))
+				mock.ExpectRollback()
+			},
+			wantPurged: 0,
+			wantErr:    true,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			test.mockBehavior(mock)
+
+			purged, err := storage.PurgeDeletedURLs(context.Background(), deletedBefore)
+			if test.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, test.wantPurged, purged)
+
+			err = mock.ExpectationsWereMet()
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestDatabaseStorage_RestoreURLs(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+
+	storage := DatabaseStorage{
+		DB: db,
+	}
+	deletedAfter := time.Now()
+
+	mock.ExpectBegin()
+	prepared := mock.ExpectPrepare(`UPDATE url SET is_deleted=false`)
+	cancelled := mock.ExpectPrepare(`DELETE FROM delete_task`)
+	// Адрес pending ещё не удалён воркером: отменяется его задача на удаление.
+	prepared.ExpectExec().WithArgs("short1", 1, deletedAfter).WillReturnResult(sqlmock.NewResult(0, 1))
+	cancelled.ExpectExec().WithArgs("short1", 1, models.Registered).WillReturnResult(sqlmock.NewResult(0, 0))
+	prepared.ExpectExec().WithArgs("short2", 1, deletedAfter).WillReturnResult(sqlmock.NewResult(0, 0))
+	cancelled.ExpectExec().WithArgs("short2", 1, models.Registered).WillReturnResult(sqlmock.NewResult(0, 0))
+	prepared.ExpectExec().WithArgs("pending", 1, deletedAfter).WillReturnResult(sqlmock.NewResult(0, 0))
+	cancelled.ExpectExec().WithArgs("pending", 1, models.Registered).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	restored, err := storage.RestoreURLs(
+		context.Background(), []string{"short1", "short2", "pending"}, 1, deletedAfter,
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"short1", "pending"}, restored)
+
+	err = mock.ExpectationsWereMet()
+	assert.NoError(t, err)
+}
+
+func TestDatabaseStorage_UpdateURL(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+
+	storage := DatabaseStorage{
+		DB: db,
+	}
+	url := &models.StorageURL{ShortURL: "short", UserID: 1, RedirectCode: 301, NoCache: true}
+
+	mock.ExpectExec(`UPDATE url SET redirect_code`).WithArgs(301, true, false, []byte("{}"), nil, nil, "short", 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.NoError(t, storage.UpdateURL(context.Background(), url))
+
+	launch := time.Date(2026, 11, 1, 9, 0, 0, 0, time.UTC)
+	url.QueryPassthrough = true
+	url.UTM = map[string]string{"utm_source": "short"}
+	url.ActiveFrom = &launch
+	mock.ExpectExec(`UPDATE url SET redirect_code`).
+		WithArgs(301, true, true, []byte(`{"utm_source":"short"}`), launch, nil, "short", 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.NoError(t, storage.UpdateURL(context.Background(), url))
+
+	mock.ExpectExec(`UPDATE url SET redirect_code`).WithArgs(301, true, true, sqlmock.AnyArg(), launch, nil, "short", 1).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	assert.ErrorIs(t, storage.UpdateURL(context.Background(), url), ErrNotFound)
+
+	err = mock.ExpectationsWereMet()
+	assert.NoError(t, err)
+}
+
+func TestDatabaseStorage_SetRedirectRules(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+
+	storage := DatabaseStorage{
+		DB: db,
+	}
+	rules := []models.RedirectRule{
+		{Device: models.DeviceIOS, Destination: "https://apps.apple.com/app"},
+		{Language: "ru", Destination: "https://example.ru"},
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT user_id FROM url WHERE short_url = \$1 FOR UPDATE`).WithArgs("short").
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(1))
+	mock.ExpectExec(`DELETE FROM redirect_rule`).WithArgs("short").WillReturnResult(sqlmock.NewResult(0, 1))
+	prep := mock.ExpectPrepare(`INSERT INTO redirect_rule`)
+	prep.ExpectExec().WithArgs("short", 0, "ios", "", nil, nil, "https://apps.apple.com/app").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	prep.ExpectExec().WithArgs("short", 1, "", "ru", nil, nil, "https://example.ru").
+		WillReturnResult(sqlmock.NewResult(2, 1))
+	mock.ExpectCommit()
+	assert.NoError(t, storage.SetRedirectRules(context.Background(), "short", 1, rules))
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT user_id FROM url WHERE short_url = \$1 FOR UPDATE`).WithArgs("short").
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(2))
+	mock.ExpectRollback()
+	assert.ErrorIs(t, storage.SetRedirectRules(context.Background(), "short", 1, rules), ErrNotFound)
+
+	err = mock.ExpectationsWereMet()
+	assert.NoError(t, err)
+}
+
+func TestDatabaseStorage_SetVariants(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+
+	storage := DatabaseStorage{
+		DB: db,
+	}
+	variants := []models.Variant{
+		{Name: "a", Destination: "https://example.com/a", Weight: 70},
+		{Name: "b", Destination: "https://example.com/b", Weight: 30},
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT user_id FROM url WHERE short_url = \$1 FOR UPDATE`).WithArgs("short").
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(1))
+	mock.ExpectQuery(`SELECT name, hits FROM url_variant`).WithArgs("short").
+		WillReturnRows(sqlmock.NewRows([]string{"name", "hits"}).AddRow("a", 12).AddRow("old", 5))
+	mock.ExpectExec(`DELETE FROM url_variant`).WithArgs("short").WillReturnResult(sqlmock.NewResult(0, 2))
+	prep := mock.ExpectPrepare(`INSERT INTO url_variant`)
+	prep.ExpectExec().WithArgs("short", 0, "a", "https://example.com/a", 70, int64(12)).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	prep.ExpectExec().WithArgs("short", 1, "b", "https://example.com/b", 30, int64(0)).
+		WillReturnResult(sqlmock.NewResult(2, 1))
+	mock.ExpectCommit()
+	assert.NoError(t, storage.SetVariants(context.Background(), "short", 1, variants))
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT user_id FROM url WHERE short_url = \$1 FOR UPDATE`).WithArgs("short").
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+	assert.ErrorIs(t, storage.SetVariants(context.Background(), "short", 1, variants), ErrNotFound)
+
+	err = mock.ExpectationsWereMet()
+	assert.NoError(t, err)
+}
+
+func TestDatabaseStorage_AddVariantHits(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+
+	storage := DatabaseStorage{
+		DB: db,
+	}
+
+	mock.ExpectExec(`UPDATE url_variant SET hits = hits \+ \$3`).WithArgs("short", "a", int64(3)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.NoError(t, storage.AddVariantHits(context.Background(), "short", "a", 3))
+
+	mock.ExpectExec(`UPDATE url_variant SET hits = hits \+ \$3`).WithArgs("short", "gone", int64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	assert.ErrorIs(t, storage.AddVariantHits(context.Background(), "short", "gone", 1), ErrNotFound)
+
+	err = mock.ExpectationsWereMet()
+	assert.NoError(t, err)
+}
+
+func TestDatabaseStorage_Domains(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+
+	storage := DatabaseStorage{
+		DB: db,
+	}
+
+	mock.ExpectExec(`INSERT INTO short_domain`).WithArgs("go.example.com", 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.NoError(t, storage.AddDomain(context.Background(), "go.example.com", 1))
+
+	mock.ExpectExec(`INSERT INTO short_domain`).WithArgs("go.example.com", 2).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	assert.ErrorIs(t, storage.AddDomain(context.Background(), "go.example.com", 2), ErrDomainExist)
+
+	mock.ExpectQuery(`SELECT user_id FROM short_domain`).WithArgs("go.example.com").
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(1))
+	owner, err := storage.GetDomainOwner(context.Background(), "go.example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, owner)
+
+	mock.ExpectQuery(`SELECT user_id FROM short_domain`).WithArgs("unknown.example.com").
+		WillReturnError(sql.ErrNoRows)
+	_, err = storage.GetDomainOwner(context.Background(), "unknown.example.com")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	mock.ExpectQuery(`SELECT name FROM short_domain`).WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("go.example.com"))
+	domains, err := storage.GetUserDomains(context.Background(), 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"go.example.com"}, domains)
+
+	mock.ExpectQuery(`SELECT name, user_id FROM short_domain`).
+		WillReturnRows(sqlmock.NewRows([]string{"name", "user_id"}).AddRow("go.example.com", 1).AddRow("s.acme.io", 2))
+	all, err := storage.GetDomains(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"go.example.com": 1, "s.acme.io": 2}, all)
+
+	err = mock.ExpectationsWereMet()
+	assert.NoError(t, err)
+}
+
+func TestDatabaseStorage_Accounts(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+
+	storage := DatabaseStorage{
+		DB: db,
+	}
+
+	mock.ExpectQuery(`INSERT INTO "user"`).WithArgs("user@example.com", "hash").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5))
+	account := &models.Account{Email: "user@example.com", PasswordHash: "hash"}
+	assert.NoError(t, storage.AddAccount(context.Background(), account))
+	assert.Equal(t, 5, account.UserID)
+
+	mock.ExpectQuery(`INSERT INTO "user"`).WithArgs("user@example.com", "hash").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	assert.ErrorIs(t, storage.AddAccount(context.Background(), account), ErrAccountExist)
+
+	mock.ExpectQuery(`SELECT id, password_hash FROM "user"`).WithArgs("user@example.com").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "password_hash"}).AddRow(5, "hash"))
+	stored, err := storage.GetAccount(context.Background(), "user@example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, account, stored)
+
+	mock.ExpectQuery(`SELECT id, password_hash FROM "user"`).WithArgs("other@example.com").
+		WillReturnError(sql.ErrNoRows)
+	_, err = storage.GetAccount(context.Background(), "other@example.com")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE url SET user_id`).WithArgs(3, 5).WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(`UPDATE short_domain SET user_id`).WithArgs(3, 5).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE delete_task SET user_id`).WithArgs(3, 5).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`UPDATE api_key SET user_id`).WithArgs(3, 5).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	moved, err := storage.MergeUsers(context.Background(), 3, 5)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, moved)
+
+	err = mock.ExpectationsWereMet()
+	assert.NoError(t, err)
+}
+
+func TestDatabaseStorage_OIDCIdentities(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+
+	storage := DatabaseStorage{
+		DB: db,
+	}
+
+	identity := &models.OIDCIdentity{Issuer: "https://idp", Subject: "42", Email: "user@example.com", UserID: 5}
+	mock.ExpectExec(`INSERT INTO oidc_identity`).WithArgs("https://idp", "42", 5).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.NoError(t, storage.AddOIDCIdentity(context.Background(), identity))
+
+	mock.ExpectExec(`INSERT INTO oidc_identity`).WithArgs("https://idp", "42", 5).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	assert.ErrorIs(t, storage.AddOIDCIdentity(context.Background(), identity), ErrIdentityExist)
+
+	mock.ExpectQuery(`SELECT u.id, COALESCE\(u.email, ''\) FROM oidc_identity`).WithArgs("https://idp", "42").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email"}).AddRow(5, "user@example.com"))
+	stored, err := storage.GetOIDCIdentity(context.Background(), "https://idp", "42")
+	assert.NoError(t, err)
+	assert.Equal(t, identity, stored)
+
+	mock.ExpectQuery(`SELECT u.id, COALESCE\(u.email, ''\) FROM oidc_identity`).WithArgs("https://idp", "43").
+		WillReturnError(sql.ErrNoRows)
+	_, err = storage.GetOIDCIdentity(context.Background(), "https://idp", "43")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDatabaseStorage_APIKeys(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+
+	storage := DatabaseStorage{
+		DB: db,
+	}
+
+	created := time.Date(2026, 10, 20, 10, 0, 0, 0, time.UTC)
+	key := &models.APIKey{
+		CreatedAt: created,
+		ID:        "0123456789abcdef",
+		Name:      "ci",
+		Hash:      "hash",
+		Scopes:    []models.APIScope{models.ScopeCreate, models.ScopeRead},
+		UserID:    5,
+	}
+	columns := []string{"id", "user_id", "name", "hash", "scopes", "created_at", "expires_at"}
+
+	mock.ExpectExec(`INSERT INTO api_key`).
+		WithArgs(key.ID, 5, "ci", "hash", []byte(`["create","read"]`), created, nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.NoError(t, storage.AddAPIKey(context.Background(), key))
+
+	mock.ExpectQuery(`SELECT id, user_id, name, hash, scopes, created_at, expires_at FROM api_key`).WithArgs(key.ID).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(key.ID, 5, "ci", "hash", []byte(`["create","read"]`), created, nil))
+	stored, err := storage.GetAPIKey(context.Background(), key.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, key, stored)
+
+	mock.ExpectQuery(`SELECT id, user_id, name, hash, scopes, created_at, expires_at FROM api_key`).WithArgs("missing").
+		WillReturnError(sql.ErrNoRows)
+	_, err = storage.GetAPIKey(context.Background(), "missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	mock.ExpectQuery(`SELECT id, user_id, name, hash, scopes, created_at, expires_at FROM api_key`).WithArgs(5).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(key.ID, 5, "ci", "hash", []byte(`["create","read"]`), created, created))
+	keys, err := storage.GetUserAPIKeys(context.Background(), 5)
+	assert.NoError(t, err)
+	assert.Len(t, keys, 1)
+	assert.Equal(t, &created, keys[0].ExpiresAt)
+
+	mock.ExpectExec(`DELETE FROM api_key`).WithArgs(key.ID, 5).WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.NoError(t, storage.DeleteAPIKey(context.Background(), key.ID, 5))
+	mock.ExpectExec(`DELETE FROM api_key`).WithArgs(key.ID, 6).WillReturnResult(sqlmock.NewResult(0, 0))
+	assert.ErrorIs(t, storage.DeleteAPIKey(context.Background(), key.ID, 6), ErrNotFound)
+
+	err = mock.ExpectationsWereMet()
+	assert.NoError(t, err)
+}
+
+func TestDatabaseStorage_RefreshTokens(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+
+	storage := DatabaseStorage{
+		DB: db,
+	}
+
+	created := time.Date(2026, 10, 20, 10, 0, 0, 0, time.UTC)
+	expires := created.Add(time.Hour)
+	token := &models.RefreshToken{
+		CreatedAt: created,
+		ExpiresAt: expires,
+		ID:        "0123456789abcdef",
+		Family:    "0123456789abcdef",
+		Hash:      "hash",
+		Email:     "user@example.com",
+		UserID:    5,
+	}
+	next := &models.RefreshToken{
+		CreatedAt: created,
+		ExpiresAt: expires,
+		ID:        "fedcba9876543210",
+		Family:    token.Family,
+		Hash:      "next",
+		UserID:    5,
+	}
+	columns := []string{
+		"id", "family", "user_id", "email", "hash", "replaced_by", "created_at", "expires_at", "revoked_at",
+	}
+
+	mock.ExpectExec(`INSERT INTO refresh_token`).
+		WithArgs(token.ID, token.Family, 5, token.Email, "hash", created, expires).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.NoError(t, storage.AddRefreshToken(context.Background(), token))
+
+	mock.ExpectQuery(`SELECT (.+) FROM refresh_token WHERE id = \$1`).WithArgs(token.ID).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(token.ID, token.Family, 5, token.Email, "hash", "", created, expires, nil))
+	stored, err := storage.GetRefreshToken(context.Background(), token.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, token, stored)
+
+	mock.ExpectQuery(`SELECT (.+) FROM refresh_token WHERE id = \$1`).WithArgs("missing").
+		WillReturnError(sql.ErrNoRows)
+	_, err = storage.GetRefreshToken(context.Background(), "missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE refresh_token SET replaced_by`).WithArgs(token.ID, next.ID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO refresh_token`).
+		WithArgs(next.ID, next.Family, 5, "", "next", created, expires).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`DELETE FROM refresh_token WHERE expires_at`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	assert.NoError(t, storage.RotateRefreshToken(context.Background(), token.ID, next))
+
+	// Второе обновление тем же токеном не проходит.
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE refresh_token SET replaced_by`).WithArgs(token.ID, "other").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+	err = storage.RotateRefreshToken(context.Background(), token.ID, &models.RefreshToken{ID: "other"})
+	assert.ErrorIs(t, err, ErrRefreshTokenUsed)
+
+	mock.ExpectExec(`UPDATE refresh_token SET revoked_at`).WithArgs(token.Family).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	assert.NoError(t, storage.RevokeRefreshTokens(context.Background(), token.Family))
+
+	mock.ExpectExec(`DELETE FROM revoked_token`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`INSERT INTO revoked_token`).WithArgs("jti", expires).WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.NoError(t, storage.RevokeToken(context.Background(), &models.RevokedToken{ID: "jti", ExpiresAt: expires}))
+
+	mock.ExpectQuery(`SELECT EXISTS`).WithArgs("jti").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	revoked, err := storage.IsTokenRevoked(context.Background(), "jti")
+	assert.NoError(t, err)
+	assert.True(t, revoked)
+
+	err = mock.ExpectationsWereMet()
+	assert.NoError(t, err)
+}
+
+func TestDatabaseStorage_UpdateQuarantine(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+
+	storage := DatabaseStorage{
+		DB: db,
+	}
+
+	mock.ExpectQuery(`SELECT short_url, original_url, quarantined FROM url WHERE NOT is_deleted`).
+		WillReturnRows(sqlmock.NewRows([]string{"short_url", "original_url", "quarantined"}).
+			AddRow("evil", "https://evil.com", false).
+			AddRow("fixed", "https://good.com", true).
+			AddRow("good", "https://good.com/page", false))
+	mock.ExpectBegin()
+	prep := mock.ExpectPrepare(`UPDATE url SET quarantined = \$1 WHERE short_url = \$2`)
+	prep.ExpectExec().WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+	prep.ExpectExec().WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	quarantined, released, err := storage.UpdateQuarantine(context.Background(), func(originalURL string) bool {
+		return originalURL == "https://evil.com"
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, quarantined)
+	assert.Equal(t, 1, released)
+
+	mock.ExpectQuery(`SELECT short_url, original_url, quarantined FROM url WHERE NOT is_deleted`).
+		WillReturnRows(sqlmock.NewRows([]string{"short_url", "original_url", "quarantined"}).
+			AddRow("good", "https://good.com/page", false))
+
+	quarantined, released, err = storage.UpdateQuarantine(context.Background(), func(string) bool { return false })
+	assert.NoError(t, err)
+	assert.Zero(t, quarantined)
+	assert.Zero(t, released)
+
+	err = mock.ExpectationsWereMet()
+	assert.NoError(t, err)
+}
+
+func TestDatabaseStorage_LinkHealth(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+
+	storage := DatabaseStorage{
+		DB: db,
+	}
+	checkedAt := time.Now().Add(-2 * time.Hour).UTC()
+	columns := []string{
+		"short_url", "original_url", "user_id", "status_code", "latency_ms", "error", "failures", "broken", "checked_at",
+	}
+
+	mock.ExpectQuery(`SELECT (.+) FROM url LEFT JOIN link_health`).WithArgs(sqlmock.AnyArg(), 100).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow("new", "https://a.com", 1, 0, 0, "", 0, false, nil).
+			AddRow("old", "https://b.com", 1, 503, 120, "Service Unavailable", 1, false, checkedAt))
+	links, err := storage.GetLinksForHealthCheck(context.Background(), time.Now().Add(-time.Hour), 100)
+	assert.NoError(t, err)
+	if assert.Len(t, links, 2) {
+		assert.True(t, links[0].CheckedAt.IsZero())
+		assert.Equal(t, 120*time.Millisecond, links[1].Latency)
+		assert.Equal(t, checkedAt, links[1].CheckedAt)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectPrepare(`INSERT INTO link_health`).ExpectExec().
+		WithArgs("old", 503, int64(120), "Service Unavailable", 2, true, checkedAt).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	links[1].Failures, links[1].Broken = 2, true
+	assert.NoError(t, storage.SaveLinkHealth(context.Background(), links[1:]))
+
+	mock.ExpectQuery(`SELECT (.+) FROM link_health h JOIN url`).WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow("old", "https://b.com", 1, 503, 120, "Service Unavailable", 2, true, checkedAt))
+	broken, err := storage.GetBrokenLinks(context.Background(), 1)
+	assert.NoError(t, err)
+	if assert.Len(t, broken, 1) {
+		assert.True(t, broken[0].Broken)
+	}
+
+	err = mock.ExpectationsWereMet()
+	assert.NoError(t, err)
+}
+
+func TestDatabaseStorage_AddClicks(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+
+	storage := DatabaseStorage{
+		DB: db,
+	}
+	october := time.Date(2026, time.October, 19, 12, 0, 0, 0, time.UTC)
+	november := time.Date(2026, time.November, 1, 0, 0, 1, 0, time.UTC)
+	events := []*models.ClickEvent{
+		{Time: october, ShortURL: "a", Referrer: "https://ref.example.com", UserAgent: "curl", IP: "203.0.113.0"},
+		{Time: november, ShortURL: "b"},
+	}
+
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS click_event_202610 PARTITION OF click_event ` +
+		`FOR VALUES FROM \('2026-10-01T00:00:00Z'\) TO \('2026-11-01T00:00:00Z'\)`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS click_event_202611 PARTITION OF click_event`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO click_event`).
+		WithArgs("a", october, "https://ref.example.com", "curl", "203.0.113.0", "",
+			"b", november, "", "", "", "").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(`INSERT INTO click_total \(short_url, clicks\) VALUES \(\$1, \$2\), \(\$3, \$4\) ON CONFLICT`).
+		WithArgs("a", int64(1), "b", int64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(`INSERT INTO click_rollup_hour`).
+		WithArgs("a", october, int64(1), "b", november.Truncate(time.Hour), int64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(`INSERT INTO click_rollup_dim`).
+		WithArgs(
+			"a", "2026-10-19", "language", "", int64(1),
+			"a", "2026-10-19", "referrer", "ref.example.com", int64(1),
+			"a", "2026-10-19", "user_agent", "curl", int64(1),
+			"b", "2026-11-01", "language", "", int64(1),
+			"b", "2026-11-01", "referrer", "", int64(1),
+			"b", "2026-11-01", "user_agent", "", int64(1),
+		).
+		WillReturnResult(sqlmock.NewResult(0, 6))
+	mock.ExpectCommit()
+	assert.NoError(t, storage.AddClicks(context.Background(), events))
+
+	// Созданные партиции не создаются повторно.
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO click_event`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO click_total`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO click_rollup_hour`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO click_rollup_dim`).WillReturnError(errors.New("deadlock detected"))
+	mock.ExpectRollback()
+	assert.Error(t, storage.AddClicks(context.Background(), events[:1]))
+
+	assert.NoError(t, storage.AddClicks(context.Background(), nil))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDatabaseStorage_GetClickStats(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+
+	storage := DatabaseStorage{
+		DB: db,
+	}
+	from := time.Date(2026, time.October, 1, 12, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 0, 7)
+	query := models.ClickStatsQuery{From: from, To: to, Bucket: models.StatsBucketDay, Top: 2}
+
+	mock.ExpectQuery(`SELECT COALESCE\(\(SELECT clicks FROM click_total`).WithArgs("short").
+		WillReturnRows(sqlmock.NewRows([]string{"clicks"}).AddRow(42))
+	mock.ExpectQuery(`FROM click_rollup_hour`).WithArgs("short", from, to, "day").
+		WillReturnRows(sqlmock.NewRows([]string{"point", "sum"}).
+			AddRow(time.Date(2026, time.October, 2, 0, 0, 0, 0, time.UTC), 5).
+			AddRow(time.Date(2026, time.October, 3, 0, 0, 0, 0, time.UTC), 3))
+	mock.ExpectQuery(`FROM click_rollup_dim`).WithArgs("short", "2026-10-01", to, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"dimension", "value", "clicks"}).
+			AddRow("language", "ru", 6).
+			AddRow("referrer", "google.com", 4).
+			AddRow("referrer", "", 2))
+	sketch := hll.New()
+	sketch.Add(hll.Hash("visitor"))
+	data, err := sketch.MarshalBinary()
+	assert.NoError(t, err)
+	mock.ExpectQuery(`FROM click_visitors`).WithArgs("short", "2026-10-01", to).
+		WillReturnRows(sqlmock.NewRows([]string{"sketch"}).AddRow(data).AddRow(data))
+
+	stats, err := storage.GetClickStats(context.Background(), "short", query)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(42), stats.TotalCount)
+	assert.Len(t, stats.Series, 2)
+	assert.Equal(t, int64(5), stats.Series[0].Clicks)
+	assert.Equal(t, []models.ClickCount{{Value: "google.com", Clicks: 4}, {Value: "", Clicks: 2}},
+		stats.Top[models.ClickDimensionReferrer])
+	assert.Equal(t, []models.ClickCount{{Value: "ru", Clicks: 6}}, stats.Top[models.ClickDimensionLanguage])
+	assert.Equal(t, uint64(1), stats.UniqueVisitors)
+
+	mock.ExpectQuery(`SELECT COALESCE`).WillReturnError(sql.ErrConnDone)
+	_, err = storage.GetClickStats(context.Background(), "short", query)
+	assert.Error(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDatabaseStorage_AddClicksVisitors(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+
+	storage := DatabaseStorage{
+		DB: db,
+	}
+	clickedAt := time.Date(2026, time.October, 19, 12, 0, 0, 0, time.UTC)
+	events := []*models.ClickEvent{{Time: clickedAt, ShortURL: "a", Visitor: hll.Hash("new")}}
+
+	// Сохранённый скетч ссылки уже содержит другого посетителя.
+	stored := hll.New()
+	stored.Add(hll.Hash("old"))
+	storedData, err := stored.MarshalBinary()
+	assert.NoError(t, err)
+
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS click_event_202610`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO click_event`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO click_total`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO click_rollup_hour`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO click_rollup_dim`).WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectExec(`INSERT INTO click_visitors`).WithArgs("", "2026-10-19", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO click_visitors`).WithArgs("a", "2026-10-19", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT sketch FROM click_visitors WHERE short_url = \$1 AND day = \$2 FOR UPDATE`).
+		WithArgs("a", "2026-10-19").
+		WillReturnRows(sqlmock.NewRows([]string{"sketch"}).AddRow(storedData))
+	mock.ExpectExec(`UPDATE click_visitors SET sketch`).WithArgs("a", "2026-10-19", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	assert.NoError(t, storage.AddClicks(context.Background(), events))
+
+	mock.ExpectQuery(`SELECT sketch FROM click_visitors WHERE short_url = \$1`).WithArgs("").
+		WillReturnRows(sqlmock.NewRows([]string{"sketch"}).AddRow(storedData).AddRow([]byte("broken")))
+	_, err = storage.GetUniqueVisitors(context.Background())
+	assert.ErrorIs(t, err, hll.ErrInvalidSketch)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDatabaseStorage_GetServiceStats(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+
+	storage := DatabaseStorage{
+		DB: db,
+	}
+	now := time.Date(2026, time.October, 19, 12, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery(`COUNT\(\*\) FILTER \(WHERE NOT is_deleted\)`).
+		WithArgs(now.Add(-time.Hour), now.Add(-24*time.Hour), now.Add(-7*24*time.Hour), models.Registered).
+		WillReturnRows(sqlmock.NewRows([]string{"active", "deleted", "hour", "day", "week", "tasks", "clicks"}).
+			AddRow(10, 2, 1, 3, 7, 1, 42))
+	mock.ExpectQuery(`FROM click_total t JOIN url u`).WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"short_url", "clicks"}).AddRow("a", 30).AddRow("b", 12))
+
+	stats, err := storage.GetServiceStats(context.Background(), now, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, &models.ServiceStats{
+		TopLinks:           []models.LinkClicks{{ShortURL: "a", Clicks: 30}, {ShortURL: "b", Clicks: 12}},
+		ActiveURLs:         10,
+		DeletedURLs:        2,
+		CreatedLastHour:    1,
+		CreatedLastDay:     3,
+		CreatedLastWeek:    7,
+		PendingDeleteTasks: 1,
+		TotalClicks:        42,
+	}, stats)
+
+	mock.ExpectQuery(`FILTER`).WillReturnError(sql.ErrConnDone)
+	_, err = storage.GetServiceStats(context.Background(), now, 2)
+	assert.Error(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDatabaseStorage_SigningKeys(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+
+	storage := DatabaseStorage{
+		DB: db,
+	}
+
+	created := time.Date(2026, 10, 20, 10, 0, 0, 0, time.UTC)
+	retired := created.Add(time.Hour)
+	key := &models.SigningKey{CreatedAt: created, ID: "0123456789abcdef", Algorithm: "HS256", Secret: "secret"}
+
+	mock.ExpectExec(`INSERT INTO signing_key`).
+		WithArgs(key.ID, key.Algorithm, key.Secret, created).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.NoError(t, storage.AddSigningKey(context.Background(), key))
+
+	mock.ExpectQuery(`SELECT kid, alg, secret, created_at, retired_at FROM signing_key`).
+		WillReturnRows(sqlmock.NewRows([]string{"kid", "alg", "secret", "created_at", "retired_at"}).
+			AddRow("legacy", "HS256", "old", created.Add(-time.Hour), retired).
+			AddRow(key.ID, key.Algorithm, key.Secret, created, nil))
+	keys, err := storage.GetSigningKeys(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, keys, 2)
+	assert.Equal(t, "legacy", keys[0].ID)
+	assert.Equal(t, retired, *keys[0].RetiredAt)
+	assert.Equal(t, key, keys[1])
+
+	mock.ExpectExec(`UPDATE signing_key SET retired_at`).
+		WithArgs(key.ID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.NoError(t, storage.RetireSigningKey(context.Background(), key.ID))
+
+	mock.ExpectExec(`UPDATE signing_key SET retired_at`).
+		WithArgs("missing").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	assert.ErrorIs(t, storage.RetireSigningKey(context.Background(), "missing"), ErrNotFound)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -2,28 +2,453 @@ package storage
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/Melikhov-p/url-minimise/internal/models"
 )
 
 // FileStorage хранилище в файле
 type FileStorage struct {
-	MemoryStorage
-	File    *os.File
-	Encoder *json.Encoder
-	Scanner *bufio.Scanner
+	*MemoryStorage
+	File            *os.File
+	Encoder         *json.Encoder
+	Scanner         *bufio.Scanner
+	ClickFile       *os.File
+	ClickEncoder    *json.Encoder
+	AccountFile     *os.File
+	AccountEncoder  *json.Encoder
+	IdentityFile    *os.File
+	IdentityEncoder *json.Encoder
+	APIKeyFile      *os.File
+	DomainFile      *os.File
+	RefreshFile     *os.File
+	RevokedFile     *os.File
 }
 
 // SetInMemory Жесткая установка связки в in-memory хранилище при загрузке данных из файла.
+// Домены ссылок восстанавливаются за их владельцами для файлов, записанных до появления файла доменов;
+// записи файла доменов загружаются после адресов и заменяют их.
 func (s *FileStorage) SetInMemory(shortURL string, newURL *models.StorageURL) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	s.urls[shortURL] = newURL
+	s.lastUserID = max(s.lastUserID, newURL.UserID)
+
+	if _, domain := models.SplitLinkKey(shortURL); domain != "" {
+		if _, ok := s.domains[domain]; !ok {
+			s.domains[domain] = newURL.UserID
+		}
+	}
+}
+
+// UpdateQuarantine обновить отметку карантина адресов и дописать изменённые адреса в файл.
+func (s *FileStorage) UpdateQuarantine(_ context.Context, blocked func(originalURL string) bool) (int, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	changed := s.updateQuarantine(blocked)
+	for _, url := range changed {
+		if err := s.save(url); err != nil {
+			return 0, 0, fmt.Errorf("error saving quarantined url %w", err)
+		}
+	}
+
+	quarantined, released := countQuarantine(changed)
+	return quarantined, released, nil
+}
+
+// MarkAsDeletedURL отметить адреса на удаление и дописать их в файл, чтобы удаление и его время
+// пережили перезапуск: от времени удаления отсчитывается срок хранения.
+func (s *FileStorage) MarkAsDeletedURL(_ context.Context, tasks []*models.DelTask) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deleted, err := s.markAsDeletedURL(tasks)
+	for _, url := range deleted {
+		if saveErr := s.save(url); saveErr != nil {
+			return fmt.Errorf("error saving deleted url %w", saveErr)
+		}
+	}
+	return err
+}
+
+// RestoreURLs восстановить удалённые адреса пользователя и дописать восстановленные адреса в файл.
+func (s *FileStorage) RestoreURLs(
+	_ context.Context,
+	shortURLs []string,
+	userID int,
+	deletedAfter time.Time,
+) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	restored := s.restoreURLs(shortURLs, userID, deletedAfter)
+	keys := make([]string, 0, len(restored))
+	for _, url := range restored {
+		if err := s.save(url); err != nil {
+			return nil, fmt.Errorf("error saving restored url %w", err)
+		}
+		keys = append(keys, url.ShortURL)
+	}
+	return keys, nil
+}
+
+// PurgeDeletedURLs окончательно удалить адреса и перезаписать файл оставшимися адресами.
+// Файл только дописывается, поэтому без перезаписи удалённые адреса вернулись бы после перезапуска.
+func (s *FileStorage) PurgeDeletedURLs(_ context.Context, deletedBefore time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	purged := s.purgeDeletedURLs(deletedBefore)
+	if purged == 0 {
+		return 0, nil
+	}
+
+	if err := s.File.Truncate(0); err != nil {
+		return 0, fmt.Errorf("error truncating storage file %w", err)
+	}
+	for _, url := range s.urls {
+		if err := s.save(url); err != nil {
+			return 0, fmt.Errorf("error saving url after purge %w", err)
+		}
+	}
+	return purged, nil
+}
+
+// AddVariantHits учесть показы варианта и дописать адрес в файл, чтобы счётчики пережили перезапуск.
+func (s *FileStorage) AddVariantHits(_ context.Context, shortURL string, variant string, hits int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, err := s.addVariantHits(shortURL, variant, hits)
+	if err != nil {
+		return err
+	}
+	if err = s.save(stored); err != nil {
+		return fmt.Errorf("error saving variant hits %w", err)
+	}
+	return nil
+}
+
+// SetClicksInMemory восстановить агрегаты переходов из событий файла.
+func (s *FileStorage) SetClicksInMemory(events []*models.ClickEvent) {
+	_ = s.MemoryStorage.AddClicks(context.Background(), events)
+}
+
+// AddClicks сохранить события переходов и дописать их в файл событий.
+func (s *FileStorage) AddClicks(_ context.Context, events []*models.ClickEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, event := range events {
+		if err := s.ClickEncoder.Encode(event); err != nil {
+			return fmt.Errorf("error encoding click event %w", err)
+		}
+	}
+	s.addClicks(events)
+	return nil
+}
+
+// SetAccountInMemory восстановить аккаунт из файла аккаунтов. Новые пользователи получают
+// идентификаторы после уже выданных, чтобы не занять идентификатор аккаунта.
+func (s *FileStorage) SetAccountInMemory(account *models.Account) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.accounts[account.Email] = account
+	s.users[account.UserID] = &models.User{
+		ID:      account.UserID,
+		URLs:    make([]*models.StorageURL, 0),
+		Service: &models.UserService{},
+		Email:   account.Email,
+	}
+	s.lastUserID = max(s.lastUserID, account.UserID)
+}
+
+// AddAccount создать аккаунт и дописать его в файл аккаунтов.
+func (s *FileStorage) AddAccount(_ context.Context, account *models.Account) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.addAccount(account); err != nil {
+		return err
+	}
+	if err := s.AccountEncoder.Encode(account); err != nil {
+		return fmt.Errorf("error encoding account %w", err)
+	}
+	return nil
+}
+
+// SetOIDCIdentityInMemory восстановить привязку пользователя провайдера OpenID Connect из файла.
+func (s *FileStorage) SetOIDCIdentityInMemory(identity *models.OIDCIdentity) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.identities[oidcSubject{issuer: identity.Issuer, subject: identity.Subject}] = identity
+}
+
+// AddOIDCIdentity привязать пользователя провайдера OpenID Connect к аккаунту и дописать привязку в файл.
+func (s *FileStorage) AddOIDCIdentity(_ context.Context, identity *models.OIDCIdentity) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.addOIDCIdentity(identity); err != nil {
+		return err
+	}
+	if err := s.IdentityEncoder.Encode(identity); err != nil {
+		return fmt.Errorf("error encoding oidc identity %w", err)
+	}
+	return nil
+}
+
+// MergeUsers передать данные пользователя, дописать переданные адреса в файл и перезаписать файл ключей API.
+func (s *FileStorage) MergeUsers(_ context.Context, fromUserID, toUserID int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	moved := s.mergeUsers(fromUserID, toUserID)
+	for _, url := range moved {
+		if err := s.save(url); err != nil {
+			return 0, fmt.Errorf("error saving merged url %w", err)
+		}
+	}
+	if err := s.writeAPIKeys(); err != nil {
+		return 0, err
+	}
+	if err := s.writeDomains(); err != nil {
+		return 0, err
+	}
+	return len(moved), nil
+}
+
+// SetDomainInMemory восстановить домен из файла доменов.
+func (s *FileStorage) SetDomainInMemory(domain *models.ShortDomain) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.domains[domain.Name] = domain.UserID
+}
+
+// AddDomain зарегистрировать домен за пользователем и дописать его в файл доменов.
+func (s *FileStorage) AddDomain(_ context.Context, domain string, userID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.addDomain(domain, userID); err != nil {
+		return err
+	}
+	if err := json.NewEncoder(s.DomainFile).Encode(&models.ShortDomain{Name: domain, UserID: userID}); err != nil {
+		return fmt.Errorf("error encoding domain %w", err)
+	}
+	return nil
+}
+
+// writeDomains перезаписывает файл доменов текущими доменами.
+func (s *FileStorage) writeDomains() error {
+	if s.DomainFile == nil {
+		return nil
+	}
+	if err := s.DomainFile.Truncate(0); err != nil {
+		return fmt.Errorf("error truncating domains file %w", err)
+	}
+
+	enc := json.NewEncoder(s.DomainFile)
+	for name, userID := range s.domains {
+		if err := enc.Encode(&models.ShortDomain{Name: name, UserID: userID}); err != nil {
+			return fmt.Errorf("error encoding domain %w", err)
+		}
+	}
+	return nil
+}
+
+// SetAPIKeyInMemory восстановить ключ API из файла ключей.
+func (s *FileStorage) SetAPIKeyInMemory(key *models.APIKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.apiKeys[key.ID] = key
+}
+
+// AddAPIKey сохранить ключ API и дописать его в файл ключей.
+func (s *FileStorage) AddAPIKey(_ context.Context, key *models.APIKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.apiKeys[key.ID] = key
+	if err := json.NewEncoder(s.APIKeyFile).Encode(key); err != nil {
+		return fmt.Errorf("error encoding api key %w", err)
+	}
+	return nil
+}
+
+// DeleteAPIKey удалить ключ API и перезаписать файл ключей, чтобы отозванный ключ не вернулся после перезапуска.
+func (s *FileStorage) DeleteAPIKey(_ context.Context, id string, userID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.deleteAPIKey(id, userID); err != nil {
+		return err
+	}
+	return s.writeAPIKeys()
+}
+
+// writeAPIKeys перезаписывает файл ключей API текущими ключами.
+func (s *FileStorage) writeAPIKeys() error {
+	if s.APIKeyFile == nil {
+		return nil
+	}
+	if err := s.APIKeyFile.Truncate(0); err != nil {
+		return fmt.Errorf("error truncating api keys file %w", err)
+	}
+
+	enc := json.NewEncoder(s.APIKeyFile)
+	for _, key := range s.apiKeys {
+		if err := enc.Encode(key); err != nil {
+			return fmt.Errorf("error encoding api key %w", err)
+		}
+	}
+	return nil
+}
+
+// SetRefreshTokenInMemory восстановить токен обновления из файла сессий. Файл дописывается
+// при каждом изменении токена, поэтому более поздняя запись заменяет более раннюю.
+func (s *FileStorage) SetRefreshTokenInMemory(token *models.RefreshToken) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.refresh[token.ID] = token
+}
+
+// CompactRefreshTokens удалить истёкшие токены обновления и перезаписать файл сессий
+// только действующими записями.
+func (s *FileStorage) CompactRefreshTokens(now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.compactRefreshTokens(now)
+	if s.RefreshFile == nil {
+		return nil
+	}
+	if err := s.RefreshFile.Truncate(0); err != nil {
+		return fmt.Errorf("error truncating refresh tokens file %w", err)
+	}
+	tokens := make([]*models.RefreshToken, 0, len(s.refresh))
+	for _, token := range s.refresh {
+		tokens = append(tokens, token)
+	}
+	return s.saveRefreshTokens(tokens...)
+}
+
+// AddRefreshToken сохранить токен обновления и дописать его в файл сессий.
+func (s *FileStorage) AddRefreshToken(_ context.Context, token *models.RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.refresh[token.ID] = token
+	return s.saveRefreshTokens(token)
+}
+
+// RotateRefreshToken заменить токен обновления и дописать в файл сессий оба токена.
+func (s *FileStorage) RotateRefreshToken(_ context.Context, id string, next *models.RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, err := s.rotateRefreshToken(id, next)
+	if err != nil {
+		return err
+	}
+	return s.saveRefreshTokens(token, next)
+}
+
+// RevokeRefreshTokens отозвать токены семейства и дописать отозванные токены в файл сессий.
+func (s *FileStorage) RevokeRefreshTokens(_ context.Context, family string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.saveRefreshTokens(s.revokeRefreshTokens(family)...)
+}
+
+// saveRefreshTokens дописывает токены обновления в файл сессий.
+func (s *FileStorage) saveRefreshTokens(tokens ...*models.RefreshToken) error {
+	if s.RefreshFile == nil {
+		return nil
+	}
+
+	enc := json.NewEncoder(s.RefreshFile)
+	for _, token := range tokens {
+		if err := enc.Encode(token); err != nil {
+			return fmt.Errorf("error encoding refresh token %w", err)
+		}
+	}
+	return nil
+}
+
+// SetRevokedTokenInMemory восстановить отозванный токен доступа из файла отзыва.
+func (s *FileStorage) SetRevokedTokenInMemory(token *models.RevokedToken) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.revoked[token.ID] = token.ExpiresAt
+}
+
+// CompactRevokedTokens удалить отозванные токены, срок которых истёк, и перезаписать файл отзыва
+// только действующими записями.
+func (s *FileStorage) CompactRevokedTokens(now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for jti, expiresAt := range s.revoked {
+		if !now.Before(expiresAt) {
+			delete(s.revoked, jti)
+		}
+	}
+
+	if s.RevokedFile == nil {
+		return nil
+	}
+	if err := s.RevokedFile.Truncate(0); err != nil {
+		return fmt.Errorf("error truncating revoked tokens file %w", err)
+	}
+	enc := json.NewEncoder(s.RevokedFile)
+	for jti, expiresAt := range s.revoked {
+		if err := enc.Encode(&models.RevokedToken{ExpiresAt: expiresAt, ID: jti}); err != nil {
+			return fmt.Errorf("error encoding revoked token %w", err)
+		}
+	}
+	return nil
+}
+
+// RevokeToken отозвать токен доступа и дописать его в файл отзыва. Ключ подписи из файла PEM
+// переживает перезапуск, поэтому и отзыв должен его пережить.
+func (s *FileStorage) RevokeToken(_ context.Context, token *models.RevokedToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.revokeToken(token)
+	if s.RevokedFile == nil {
+		return nil
+	}
+	if err := json.NewEncoder(s.RevokedFile).Encode(token); err != nil {
+		return fmt.Errorf("error encoding revoked token %w", err)
+	}
+	return nil
 }
 
 // Save сохранение
 func (s *FileStorage) Save(record *models.StorageURL) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.save(record)
+}
+
+// save дописывает адрес в файл.
+func (s *FileStorage) save(record *models.StorageURL) error {
 	if err := s.Encoder.Encode(record); err != nil {
 		return fmt.Errorf("error encoding json to model %w", err)
 	}
@@ -36,6 +461,41 @@ func (s *FileStorage) Close() error {
 	if err != nil {
 		return fmt.Errorf("error closing file %w", err)
 	}
+	if s.ClickFile != nil {
+		if err = s.ClickFile.Close(); err != nil {
+			return fmt.Errorf("error closing click events file %w", err)
+		}
+	}
+	if s.AccountFile != nil {
+		if err = s.AccountFile.Close(); err != nil {
+			return fmt.Errorf("error closing accounts file %w", err)
+		}
+	}
+	if s.IdentityFile != nil {
+		if err = s.IdentityFile.Close(); err != nil {
+			return fmt.Errorf("error closing oidc identities file %w", err)
+		}
+	}
+	if s.APIKeyFile != nil {
+		if err = s.APIKeyFile.Close(); err != nil {
+			return fmt.Errorf("error closing api keys file %w", err)
+		}
+	}
+	if s.DomainFile != nil {
+		if err = s.DomainFile.Close(); err != nil {
+			return fmt.Errorf("error closing domains file %w", err)
+		}
+	}
+	if s.RefreshFile != nil {
+		if err = s.RefreshFile.Close(); err != nil {
+			return fmt.Errorf("error closing refresh tokens file %w", err)
+		}
+	}
+	if s.RevokedFile != nil {
+		if err = s.RevokedFile.Close(); err != nil {
+			return fmt.Errorf("error closing revoked tokens file %w", err)
+		}
+	}
 
 	return nil
 }
@@ -2,6 +2,7 @@ package storage
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
 	"os"
 	"testing"
@@ -19,7 +20,7 @@ func TestSetInMemory(t *testing.T) {
 	}()
 
 	storage := &FileStorage{
-		MemoryStorage: *NewMemoryStorage(),
+		MemoryStorage: NewMemoryStorage(),
 		File:          file,
 		Encoder:       json.NewEncoder(file),
 		Scanner:       bufio.NewScanner(file),
@@ -37,6 +38,12 @@ func TestSetInMemory(t *testing.T) {
 	// Проверка, что URL добавлен в in-memory хранилище
 	storedURL := storage.urls["short"]
 	assert.Equal(t, newURL, storedURL)
+
+	// Домен ссылки восстанавливается за её владельцем
+	storage.SetInMemory("code@go.example.com", &models.StorageURL{ShortURL: "code@go.example.com", UserID: 7})
+	owner, err := storage.GetDomainOwner(context.Background(), "go.example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, 7, owner)
 }
 
 func TestSave(t *testing.T) {
@@ -48,7 +55,7 @@ func TestSave(t *testing.T) {
 	}()
 
 	storage := &FileStorage{
-		MemoryStorage: *NewMemoryStorage(),
+		MemoryStorage: NewMemoryStorage(),
 		File:          file,
 		Encoder:       json.NewEncoder(file),
 		Scanner:       bufio.NewScanner(file),
@@ -83,7 +90,7 @@ func TestFileStorage_Close(t *testing.T) {
 	}()
 
 	storage := &FileStorage{
-		MemoryStorage: *NewMemoryStorage(),
+		MemoryStorage: NewMemoryStorage(),
 		File:          file,
 		Encoder:       json.NewEncoder(file),
 		Scanner:       bufio.NewScanner(file),
@@ -93,3 +100,39 @@ func TestFileStorage_Close(t *testing.T) {
 
 	assert.NoError(t, err)
 }
+
+func TestFileStorage_AddClicks(t *testing.T) {
+	file, err := os.CreateTemp("", "testfile.txt")
+	assert.NoError(t, err)
+	defer func() {
+		_ = os.Remove(file.Name())
+	}()
+	clickFile, err := os.CreateTemp("", "testfile.txt.clicks")
+	assert.NoError(t, err)
+	defer func() {
+		_ = os.Remove(clickFile.Name())
+	}()
+
+	storage := &FileStorage{
+		MemoryStorage: NewMemoryStorage(),
+		File:          file,
+		Encoder:       json.NewEncoder(file),
+		ClickFile:     clickFile,
+		ClickEncoder:  json.NewEncoder(clickFile),
+	}
+	storage.SetClicksInMemory([]*models.ClickEvent{{ShortURL: "restored"}})
+
+	event := &models.ClickEvent{ShortURL: "short", UserAgent: "curl"}
+	assert.NoError(t, storage.AddClicks(context.Background(), []*models.ClickEvent{event}))
+	assert.Len(t, storage.clicks, 2)
+	assert.Equal(t, int64(1), storage.clicks["restored"].total)
+
+	// Событие дописано в файл событий.
+	_, err = clickFile.Seek(0, 0)
+	assert.NoError(t, err)
+	var saved models.ClickEvent
+	assert.NoError(t, json.NewDecoder(clickFile).Decode(&saved))
+	assert.Equal(t, *event, saved)
+
+	assert.NoError(t, storage.Close())
+}
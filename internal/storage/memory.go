@@ -4,6 +4,11 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"sync"
+	"time"
 
 	"github.com/Melikhov-p/url-minimise/internal/models"
 )
@@ -12,8 +17,22 @@ import (
 type MemoryStorage struct {
 	urls        map[string]*models.StorageURL
 	users       map[int]*models.User
-	deleteTasks map[string]*models.DelTask // [shortURL]*models.DelTask
+	accounts    map[string]*models.Account           // [email]*models.Account
+	identities  map[oidcSubject]*models.OIDCIdentity // [issuer, sub]*models.OIDCIdentity
+	apiKeys     map[string]*models.APIKey            // [id]*models.APIKey
+	refresh     map[string]*models.RefreshToken      // [id]*models.RefreshToken
+	revoked     map[string]time.Time                 // [jti]срок действия отозванного токена
+	signingKeys map[string]*models.SigningKey        // [kid]*models.SigningKey
+	deleteTasks map[string]*models.DelTask           // [shortURL]*models.DelTask
+	domains     map[string]int                       // [domain]userID
+	health      map[string]*models.LinkHealth
+	clicks      map[string]*linkClicks // [shortURL]*linkClicks
+	visitors    dailyVisitors          // уникальные посетители всего сервиса
 	lastUserID  int
+	purgedURLs  int
+	// refreshCompactedAt когда из памяти последний раз удалялись истёкшие токены обновления.
+	refreshCompactedAt time.Time
+	mu                 sync.RWMutex // защищает все поля: хранилище читают и меняют обработчики и фоновые воркеры
 }
 
 // NewMemoryStorage создать новое хранилище в памяти.
@@ -21,7 +40,17 @@ func NewMemoryStorage() *MemoryStorage {
 	return &MemoryStorage{
 		urls:        map[string]*models.StorageURL{},
 		users:       map[int]*models.User{},
+		accounts:    map[string]*models.Account{},
+		identities:  map[oidcSubject]*models.OIDCIdentity{},
+		apiKeys:     map[string]*models.APIKey{},
+		refresh:     map[string]*models.RefreshToken{},
+		revoked:     map[string]time.Time{},
+		signingKeys: map[string]*models.SigningKey{},
 		deleteTasks: map[string]*models.DelTask{},
+		domains:     map[string]int{},
+		health:      map[string]*models.LinkHealth{},
+		clicks:      map[string]*linkClicks{},
+		visitors:    dailyVisitors{},
 		lastUserID:  0,
 	}
 }
@@ -33,17 +62,23 @@ func (s *MemoryStorage) Close() error {
 
 // AddURL добавить адрес.
 func (s *MemoryStorage) AddURL(ctx context.Context, newURL *models.StorageURL) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	if short, ok := s.checkFull(ctx, newURL.OriginalURL); ok {
 		return short, ErrOriginalURLExist
 	}
-	s.urls[newURL.ShortURL] = newURL
+	s.urls[newURL.ShortURL] = cloneURL(newURL)
 	return newURL.ShortURL, nil
 }
 
 // AddURLs добавить несколько адресов.
 func (s *MemoryStorage) AddURLs(_ context.Context, newURLs []*models.StorageURL) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	for _, url := range newURLs {
-		s.urls[url.ShortURL] = url
+		s.urls[url.ShortURL] = cloneURL(url)
 	}
 
 	return nil
@@ -51,6 +86,9 @@ func (s *MemoryStorage) AddURLs(_ context.Context, newURLs []*models.StorageURL)
 
 // AddDeleteTask добавить задачу на удаление.
 func (s *MemoryStorage) AddDeleteTask(shortURL []string, userID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	for _, url := range shortURL {
 		s.deleteTasks[url] = &models.DelTask{
 			URL:    url,
@@ -67,6 +105,9 @@ func (s *MemoryStorage) GetDeleteTasksWStatus(
 	_ context.Context,
 	status models.DelTaskStatus,
 ) ([]*models.DelTask, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	outTasks := make([]*models.DelTask, 0)
 	for _, task := range s.deleteTasks {
 		if task.Status == status {
@@ -79,18 +120,116 @@ func (s *MemoryStorage) GetDeleteTasksWStatus(
 
 // MarkAsDeletedURL отметить адрес на удаление.
 func (s *MemoryStorage) MarkAsDeletedURL(_ context.Context, tasks []*models.DelTask) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.markAsDeletedURL(tasks)
+	return err
+}
+
+// markAsDeletedURL отмечает адреса задач удалёнными и возвращает отмеченные адреса.
+func (s *MemoryStorage) markAsDeletedURL(tasks []*models.DelTask) ([]*models.StorageURL, error) {
+	deleted := make([]*models.StorageURL, 0, len(tasks))
 	for _, task := range tasks {
-		if s.urls[task.URL] == nil {
-			return ErrNotFound
+		url := s.urls[task.URL]
+		if url == nil {
+			return deleted, ErrNotFound
 		}
-		if s.urls[task.URL].UserID != task.UserID {
-			return fmt.Errorf("not owner of %s", task.URL)
+		if url.UserID != task.UserID {
+			return deleted, fmt.Errorf("not owner of %s", task.URL)
 		}
 
-		s.urls[task.URL].DeletedFlag = true
+		url.DeletedFlag = true
+		url.DeletedAt = time.Now()
+		deleted = append(deleted, url)
 	}
 
-	return nil
+	return deleted, nil
+}
+
+// RestoreURLs снять отметку удаления с адресов пользователя, удалённых не раньше deletedAfter.
+// Ещё не выполненная задача на удаление адреса отменяется, такой адрес тоже считается восстановленным.
+func (s *MemoryStorage) RestoreURLs(
+	_ context.Context,
+	shortURLs []string,
+	userID int,
+	deletedAfter time.Time,
+) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	restored := s.restoreURLs(shortURLs, userID, deletedAfter)
+	keys := make([]string, 0, len(restored))
+	for _, url := range restored {
+		keys = append(keys, url.ShortURL)
+	}
+
+	return keys, nil
+}
+
+// restoreURLs снимает отметку удаления, отменяет задачи на удаление и возвращает восстановленные адреса.
+func (s *MemoryStorage) restoreURLs(shortURLs []string, userID int, deletedAfter time.Time) []*models.StorageURL {
+	restored := make([]*models.StorageURL, 0, len(shortURLs))
+	for _, short := range shortURLs {
+		url := s.urls[short]
+		if url == nil || url.UserID != userID {
+			continue
+		}
+
+		undeleted := url.DeletedFlag && !url.DeletedAt.Before(deletedAfter)
+		if undeleted {
+			url.DeletedFlag = false
+			url.DeletedAt = time.Time{}
+		}
+		// Иначе воркер удаления отметит адрес удалённым уже после восстановления.
+		cancelled := false
+		if task, ok := s.deleteTasks[short]; ok && !url.DeletedFlag &&
+			task.UserID == userID && task.Status == models.Registered {
+			delete(s.deleteTasks, short)
+			cancelled = true
+		}
+
+		if undeleted || cancelled {
+			restored = append(restored, url)
+		}
+	}
+
+	return restored
+}
+
+// PurgeDeletedURLs окончательно удалить адреса, помеченные на удаление раньше deletedBefore, и их задачи.
+func (s *MemoryStorage) PurgeDeletedURLs(_ context.Context, deletedBefore time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.purgeDeletedURLs(deletedBefore), nil
+}
+
+// purgeDeletedURLs удаляет адреса, помеченные на удаление раньше deletedBefore, и возвращает их количество.
+func (s *MemoryStorage) purgeDeletedURLs(deletedBefore time.Time) int {
+	var purged int
+	for short, url := range s.urls {
+		if !url.DeletedFlag || !url.DeletedAt.Before(deletedBefore) {
+			continue
+		}
+
+		delete(s.urls, short)
+		delete(s.deleteTasks, short)
+		delete(s.health, short)
+		delete(s.clicks, short)
+		purged++
+	}
+	s.purgedURLs += purged
+
+	return purged
+}
+
+// GetPurgedURLsCount получить количество окончательно удалённых адресов.
+func (s *MemoryStorage) GetPurgedURLsCount(_ context.Context) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.purgedURLs, nil
 }
 
 // UpdateTasksStatus обновить статус задачи на удаление.
@@ -99,6 +238,9 @@ func (s *MemoryStorage) UpdateTasksStatus(
 	tasks []*models.DelTask,
 	newStatus models.DelTaskStatus,
 ) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	for _, task := range tasks {
 		if _, ok := s.deleteTasks[task.URL]; ok {
 			s.deleteTasks[task.URL].Status = newStatus
@@ -110,6 +252,9 @@ func (s *MemoryStorage) UpdateTasksStatus(
 
 // GetShortURL получить короткий адрес.
 func (s *MemoryStorage) GetShortURL(_ context.Context, _ *sql.Tx, fullURL string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	var short string
 
 	for _, url := range s.urls {
@@ -122,17 +267,324 @@ func (s *MemoryStorage) GetShortURL(_ context.Context, _ *sql.Tx, fullURL string
 	return "", fmt.Errorf("can not wantFound short url for original %w", ErrNotFound)
 }
 
-// GetURL получить полный адрес.
+// GetShortURLs получить короткие адреса для оригинальных адресов.
+// Адреса без ссылок в результат не попадают.
+func (s *MemoryStorage) GetShortURLs(_ context.Context, originalURLs []string) (map[string]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	wanted := make(map[string]struct{}, len(originalURLs))
+	for _, originalURL := range originalURLs {
+		wanted[originalURL] = struct{}{}
+	}
+
+	shortURLs := make(map[string]string, len(originalURLs))
+	for _, url := range s.urls {
+		if _, ok := wanted[url.OriginalURL]; !ok {
+			continue
+		}
+		if _, ok := shortURLs[url.OriginalURL]; !ok {
+			shortURLs[url.OriginalURL] = url.ShortURL
+		}
+	}
+
+	return shortURLs, nil
+}
+
+// GetURL получить полный адрес. Возвращается копия: счётчики показов, правила и отметку удаления
+// хранимого адреса меняют под блокировкой, а копию читают без неё.
 func (s *MemoryStorage) GetURL(_ context.Context, shortURL string) (*models.StorageURL, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	searchedElem := s.urls[shortURL]
 	if searchedElem != nil {
-		return searchedElem, nil
+		return cloneURL(searchedElem), nil
 	}
 	return nil, fmt.Errorf("can not wantFound original url for short %w", ErrNotFound)
 }
 
+// cloneURL копия адреса вместе с правилами, вариантами и UTM-метками, которые хранятся по ссылке.
+func cloneURL(url *models.StorageURL) *models.StorageURL {
+	clone := *url
+	clone.UTM = maps.Clone(url.UTM)
+	clone.Rules = slices.Clone(url.Rules)
+	clone.Variants = slices.Clone(url.Variants)
+	return &clone
+}
+
+// UpdateURL обновить настройки адреса владельца.
+func (s *MemoryStorage) UpdateURL(_ context.Context, url *models.StorageURL) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := s.urls[url.ShortURL]
+	if stored == nil || stored.UserID != url.UserID {
+		return ErrNotFound
+	}
+
+	s.urls[url.ShortURL] = cloneURL(url)
+	return nil
+}
+
+// SetRedirectRules заменить правила условного редиректа адреса владельца.
+func (s *MemoryStorage) SetRedirectRules(
+	_ context.Context,
+	shortURL string,
+	userID int,
+	rules []models.RedirectRule,
+) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := s.urls[shortURL]
+	if stored == nil || stored.UserID != userID {
+		return ErrNotFound
+	}
+
+	stored.Rules = slices.Clone(rules)
+	return nil
+}
+
+// SetVariants заменить варианты адреса назначения владельца, сохраняя счётчики показов по имени варианта.
+func (s *MemoryStorage) SetVariants(
+	_ context.Context,
+	shortURL string,
+	userID int,
+	variants []models.Variant,
+) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := s.urls[shortURL]
+	if stored == nil || stored.UserID != userID {
+		return ErrNotFound
+	}
+
+	hits := make(map[string]int64, len(stored.Variants))
+	for _, variant := range stored.Variants {
+		hits[variant.Name] = variant.Hits
+	}
+
+	updated := make([]models.Variant, 0, len(variants))
+	for _, variant := range variants {
+		variant.Hits = hits[variant.Name]
+		updated = append(updated, variant)
+	}
+
+	stored.Variants = updated
+	return nil
+}
+
+// AddVariantHits учесть hits показов варианта адреса назначения.
+func (s *MemoryStorage) AddVariantHits(_ context.Context, shortURL string, variant string, hits int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.addVariantHits(shortURL, variant, hits)
+	return err
+}
+
+// addVariantHits учитывает показы варианта без блокировки и возвращает изменённый адрес,
+// вызывающий держит s.mu.
+func (s *MemoryStorage) addVariantHits(shortURL string, variant string, hits int64) (*models.StorageURL, error) {
+	stored := s.urls[shortURL]
+	if stored == nil {
+		return nil, ErrNotFound
+	}
+
+	for i := range stored.Variants {
+		if stored.Variants[i].Name == variant {
+			stored.Variants[i].Hits += hits
+			return stored, nil
+		}
+	}
+
+	return nil, ErrNotFound
+}
+
+// AddDomain зарегистрировать домен за пользователем.
+func (s *MemoryStorage) AddDomain(_ context.Context, domain string, userID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.addDomain(domain, userID)
+}
+
+// addDomain регистрирует домен без блокировки, вызывающий держит s.mu.
+func (s *MemoryStorage) addDomain(domain string, userID int) error {
+	if _, ok := s.domains[domain]; ok {
+		return ErrDomainExist
+	}
+
+	s.domains[domain] = userID
+	return nil
+}
+
+// GetDomainOwner получить владельца зарегистрированного домена.
+func (s *MemoryStorage) GetDomainOwner(_ context.Context, domain string) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	userID, ok := s.domains[domain]
+	if !ok {
+		return 0, fmt.Errorf("domain %s is not registered %w", domain, ErrNotFound)
+	}
+
+	return userID, nil
+}
+
+// GetDomains получить все зарегистрированные домены с их владельцами.
+func (s *MemoryStorage) GetDomains(_ context.Context) (map[string]int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return maps.Clone(s.domains), nil
+}
+
+// GetUserDomains получить домены, зарегистрированные пользователем.
+func (s *MemoryStorage) GetUserDomains(_ context.Context, userID int) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	domains := make([]string, 0)
+	for domain, owner := range s.domains {
+		if owner == userID {
+			domains = append(domains, domain)
+		}
+	}
+	sort.Strings(domains)
+
+	return domains, nil
+}
+
+// UpdateQuarantine поместить в карантин неудалённые адреса, оригинал которых запрещён blocked,
+// и снять карантин с остальных. Возвращает количество помещённых в карантин и освобождённых адресов.
+func (s *MemoryStorage) UpdateQuarantine(_ context.Context, blocked func(originalURL string) bool) (int, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	quarantined, released := countQuarantine(s.updateQuarantine(blocked))
+	return quarantined, released, nil
+}
+
+// updateQuarantine обновляет отметку карантина и возвращает изменённые адреса.
+func (s *MemoryStorage) updateQuarantine(blocked func(originalURL string) bool) []*models.StorageURL {
+	changed := make([]*models.StorageURL, 0)
+	for _, url := range s.urls {
+		if url.DeletedFlag {
+			continue
+		}
+		if isBlocked := blocked(url.OriginalURL); isBlocked != url.Quarantined {
+			url.Quarantined = isBlocked
+			changed = append(changed, url)
+		}
+	}
+
+	return changed
+}
+
+// countQuarantine считает среди изменённых адресов помещённые в карантин и освобождённые.
+func countQuarantine(changed []*models.StorageURL) (quarantined int, released int) {
+	for _, url := range changed {
+		if url.Quarantined {
+			quarantined++
+		} else {
+			released++
+		}
+	}
+	return quarantined, released
+}
+
+// GetLinksForHealthCheck получить до limit активных адресов, не проверявшихся с checkedBefore,
+// начиная с давно проверенных.
+func (s *MemoryStorage) GetLinksForHealthCheck(
+	_ context.Context,
+	checkedBefore time.Time,
+	limit int,
+) ([]*models.LinkHealth, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now()
+	links := make([]*models.LinkHealth, 0)
+	for short, url := range s.urls {
+		if url.DeletedFlag || url.Quarantined ||
+			(url.ActiveFrom != nil && url.ActiveFrom.After(now)) ||
+			(url.ActiveUntil != nil && !url.ActiveUntil.After(now)) {
+			continue
+		}
+
+		link := models.LinkHealth{ShortURL: short}
+		if health := s.health[short]; health != nil {
+			link = *health
+		}
+		if !link.CheckedAt.Before(checkedBefore) {
+			continue
+		}
+		link.OriginalURL = url.OriginalURL
+		link.UserID = url.UserID
+		links = append(links, &link)
+	}
+
+	sort.Slice(links, func(i, j int) bool {
+		return links[i].CheckedAt.Before(links[j].CheckedAt)
+	})
+	if len(links) > limit {
+		links = links[:limit]
+	}
+
+	return links, nil
+}
+
+// SaveLinkHealth сохранить результаты проверки адресов назначения.
+func (s *MemoryStorage) SaveLinkHealth(_ context.Context, health []*models.LinkHealth) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, link := range health {
+		if s.urls[link.ShortURL] == nil {
+			continue
+		}
+		saved := *link
+		s.health[link.ShortURL] = &saved
+	}
+
+	return nil
+}
+
+// GetBrokenLinks получить неудалённые адреса пользователя, адрес назначения которых помечен недоступным.
+func (s *MemoryStorage) GetBrokenLinks(_ context.Context, userID int) ([]*models.LinkHealth, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	links := make([]*models.LinkHealth, 0)
+	for short, health := range s.health {
+		url := s.urls[short]
+		if !health.Broken || url == nil || url.DeletedFlag || url.UserID != userID {
+			continue
+		}
+
+		link := *health
+		link.OriginalURL = url.OriginalURL
+		link.UserID = url.UserID
+		links = append(links, &link)
+	}
+
+	sort.Slice(links, func(i, j int) bool {
+		return links[i].CheckedAt.After(links[j].CheckedAt)
+	})
+
+	return links, nil
+}
+
 // CheckShort проверить короткий адрес.
-func (s *MemoryStorage) CheckShort(_ context.Context, short string) bool { return s.urls[short] != nil }
+func (s *MemoryStorage) CheckShort(_ context.Context, short string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.urls[short] != nil
+}
 
 // Если оригинальный URL есть в базе - true.
 func (s *MemoryStorage) checkFull(_ context.Context, fullURL string) (string, bool) {
@@ -150,6 +602,14 @@ func (s *MemoryStorage) Ping(_ context.Context) error { return nil }
 
 // AddUser добавить пользователя
 func (s *MemoryStorage) AddUser(_ context.Context) (*models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.addUser(), nil
+}
+
+// addUser создаёт пользователя со следующим идентификатором.
+func (s *MemoryStorage) addUser() *models.User {
 	s.lastUserID++
 	s.users[s.lastUserID] = &models.User{
 		ID:   s.lastUserID,
@@ -160,27 +620,472 @@ func (s *MemoryStorage) AddUser(_ context.Context) (*models.User, error) {
 		},
 	}
 
-	return s.users[s.lastUserID], nil
+	return s.users[s.lastUserID]
+}
+
+// AddAccount создать пользователя с аккаунтом и записать его идентификатор в account.UserID.
+func (s *MemoryStorage) AddAccount(_ context.Context, account *models.Account) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.addAccount(account)
+}
+
+// addAccount создаёт пользователя с аккаунтом.
+func (s *MemoryStorage) addAccount(account *models.Account) error {
+	if _, ok := s.accounts[account.Email]; ok {
+		return ErrAccountExist
+	}
+
+	user := s.addUser()
+	user.Email = account.Email
+	account.UserID = user.ID
+	s.accounts[account.Email] = account
+
+	return nil
+}
+
+// GetAccount получить аккаунт по почте.
+func (s *MemoryStorage) GetAccount(_ context.Context, email string) (*models.Account, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	account, ok := s.accounts[email]
+	if !ok {
+		return nil, fmt.Errorf("account %s is not registered %w", email, ErrNotFound)
+	}
+
+	return account, nil
+}
+
+// oidcSubject ключ пользователя провайдера OpenID Connect: subject уникален только у одного провайдера.
+type oidcSubject struct {
+	issuer  string
+	subject string
+}
+
+// AddOIDCIdentity привязать пользователя провайдера OpenID Connect к аккаунту identity.UserID.
+func (s *MemoryStorage) AddOIDCIdentity(_ context.Context, identity *models.OIDCIdentity) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.addOIDCIdentity(identity)
+}
+
+// addOIDCIdentity привязывает пользователя провайдера, если он ещё не привязан.
+func (s *MemoryStorage) addOIDCIdentity(identity *models.OIDCIdentity) error {
+	key := oidcSubject{issuer: identity.Issuer, subject: identity.Subject}
+	if _, ok := s.identities[key]; ok {
+		return ErrIdentityExist
+	}
+
+	s.identities[key] = identity
+	return nil
+}
+
+// GetOIDCIdentity получить аккаунт, к которому привязан пользователь subject провайдера issuer.
+func (s *MemoryStorage) GetOIDCIdentity(_ context.Context, issuer, subject string) (*models.OIDCIdentity, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	identity, ok := s.identities[oidcSubject{issuer: issuer, subject: subject}]
+	if !ok {
+		return nil, fmt.Errorf("oidc identity %s is not linked %w", subject, ErrNotFound)
+	}
+
+	return identity, nil
+}
+
+// MergeUsers передать адреса, домены, задачи на удаление и ключи API пользователя fromUserID
+// пользователю toUserID. Возвращает количество переданных адресов.
+func (s *MemoryStorage) MergeUsers(_ context.Context, fromUserID, toUserID int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.mergeUsers(fromUserID, toUserID)), nil
+}
+
+// mergeUsers передаёт данные пользователя и возвращает переданные адреса.
+func (s *MemoryStorage) mergeUsers(fromUserID, toUserID int) []*models.StorageURL {
+	moved := make([]*models.StorageURL, 0)
+	for _, url := range s.urls {
+		if url.UserID == fromUserID {
+			url.UserID = toUserID
+			moved = append(moved, url)
+		}
+	}
+	for domain, owner := range s.domains {
+		if owner == fromUserID {
+			s.domains[domain] = toUserID
+		}
+	}
+	for _, task := range s.deleteTasks {
+		if task.UserID == fromUserID {
+			task.UserID = toUserID
+		}
+	}
+	for _, key := range s.apiKeys {
+		if key.UserID == fromUserID {
+			key.UserID = toUserID
+		}
+	}
+
+	return moved
+}
+
+// AddAPIKey сохранить ключ API.
+func (s *MemoryStorage) AddAPIKey(_ context.Context, key *models.APIKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.apiKeys[key.ID] = key
+	return nil
+}
+
+// GetAPIKey получить ключ API по идентификатору.
+func (s *MemoryStorage) GetAPIKey(_ context.Context, id string) (*models.APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	key, ok := s.apiKeys[id]
+	if !ok {
+		return nil, fmt.Errorf("api key %s %w", id, ErrNotFound)
+	}
+
+	return key, nil
+}
+
+// GetUserAPIKeys получить ключи API пользователя в порядке создания.
+func (s *MemoryStorage) GetUserAPIKeys(_ context.Context, userID int) ([]*models.APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys := make([]*models.APIKey, 0)
+	for _, key := range s.apiKeys {
+		if key.UserID == userID {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if !keys[i].CreatedAt.Equal(keys[j].CreatedAt) {
+			return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+		}
+		return keys[i].ID < keys[j].ID
+	})
+
+	return keys, nil
+}
+
+// DeleteAPIKey удалить ключ API пользователя. Чужой ключ не удаляется и считается ненайденным.
+func (s *MemoryStorage) DeleteAPIKey(_ context.Context, id string, userID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.deleteAPIKey(id, userID)
+}
+
+// deleteAPIKey удаляет ключ API пользователя.
+func (s *MemoryStorage) deleteAPIKey(id string, userID int) error {
+	key, ok := s.apiKeys[id]
+	if !ok || key.UserID != userID {
+		return ErrNotFound
+	}
+
+	delete(s.apiKeys, id)
+	return nil
+}
+
+// AddRefreshToken сохранить токен обновления.
+func (s *MemoryStorage) AddRefreshToken(_ context.Context, token *models.RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.refresh[token.ID] = token
+	return nil
+}
+
+// GetRefreshToken получить токен обновления по идентификатору.
+func (s *MemoryStorage) GetRefreshToken(_ context.Context, id string) (*models.RefreshToken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	token, ok := s.refresh[id]
+	if !ok {
+		return nil, fmt.Errorf("refresh token %s %w", id, ErrNotFound)
+	}
+
+	return token, nil
+}
+
+// RotateRefreshToken заменить токен обновления id следующим токеном next. Если токен уже заменён
+// или отозван, возвращается ErrRefreshTokenUsed. Не чаще раза в refreshCompactInterval
+// заодно удаляются истёкшие токены.
+func (s *MemoryStorage) RotateRefreshToken(_ context.Context, id string, next *models.RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.rotateRefreshToken(id, next)
+	return err
+}
+
+// rotateRefreshToken заменяет токен и возвращает заменённый токен. Проверка и замена атомарны,
+// только пока вызывающий держит s.mu: иначе два обновления одним токеном могут пройти оба.
+func (s *MemoryStorage) rotateRefreshToken(id string, next *models.RefreshToken) (*models.RefreshToken, error) {
+	token, ok := s.refresh[id]
+	if !ok {
+		return nil, fmt.Errorf("refresh token %s %w", id, ErrNotFound)
+	}
+	if token.RevokedAt != nil || token.ReplacedBy != "" {
+		return nil, ErrRefreshTokenUsed
+	}
+
+	token.ReplacedBy = next.ID
+	s.refresh[next.ID] = next
+
+	if now := time.Now(); now.Sub(s.refreshCompactedAt) >= refreshCompactInterval {
+		s.compactRefreshTokens(now)
+	}
+
+	return token, nil
+}
+
+// refreshCompactInterval как часто обновление токенов удаляет из памяти истёкшие токены.
+const refreshCompactInterval = time.Hour
+
+// compactRefreshTokens удаляет истёкшие токены обновления.
+func (s *MemoryStorage) compactRefreshTokens(now time.Time) {
+	for id, token := range s.refresh {
+		if !now.Before(token.ExpiresAt) {
+			delete(s.refresh, id)
+		}
+	}
+	s.refreshCompactedAt = now
+}
+
+// RevokeRefreshTokens отозвать все токены обновления семейства family.
+func (s *MemoryStorage) RevokeRefreshTokens(_ context.Context, family string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.revokeRefreshTokens(family)
+	return nil
+}
+
+// revokeRefreshTokens отзывает токены семейства и возвращает отозванные токены.
+func (s *MemoryStorage) revokeRefreshTokens(family string) []*models.RefreshToken {
+	now := time.Now()
+	revoked := make([]*models.RefreshToken, 0)
+	for _, token := range s.refresh {
+		if token.Family == family && token.RevokedAt == nil {
+			token.RevokedAt = &now
+			revoked = append(revoked, token)
+		}
+	}
+
+	return revoked
+}
+
+// RevokeToken отозвать токен доступа до истечения его срока. Заодно удаляются отозванные токены,
+// срок которых уже истёк.
+func (s *MemoryStorage) RevokeToken(_ context.Context, token *models.RevokedToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.revokeToken(token)
+	return nil
+}
+
+// revokeToken добавляет токен в список отзыва и удаляет из списка истёкшие токены.
+func (s *MemoryStorage) revokeToken(token *models.RevokedToken) {
+	now := time.Now()
+	for jti, expiresAt := range s.revoked {
+		if !now.Before(expiresAt) {
+			delete(s.revoked, jti)
+		}
+	}
+	s.revoked[token.ID] = token.ExpiresAt
+}
+
+// IsTokenRevoked сообщает, отозван ли токен доступа с идентификатором id.
+func (s *MemoryStorage) IsTokenRevoked(_ context.Context, id string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	expiresAt, ok := s.revoked[id]
+	return ok && time.Now().Before(expiresAt), nil
+}
+
+// AddSigningKey сохранить ключ подписи токенов.
+func (s *MemoryStorage) AddSigningKey(_ context.Context, key *models.SigningKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.signingKeys[key.ID] = key
+	return nil
+}
+
+// GetSigningKeys получить все ключи подписи, включая выведенные из оборота, от старых к новым.
+func (s *MemoryStorage) GetSigningKeys(_ context.Context) ([]*models.SigningKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys := make([]*models.SigningKey, 0, len(s.signingKeys))
+	for _, key := range s.signingKeys {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if !keys[i].CreatedAt.Equal(keys[j].CreatedAt) {
+			return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+		}
+		return keys[i].ID < keys[j].ID
+	})
+
+	return keys, nil
+}
+
+// RetireSigningKey вывести ключ подписи из оборота. Ключ заменяется копией, потому что
+// прежний ключ может читаться из набора действующих ключей.
+func (s *MemoryStorage) RetireSigningKey(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.signingKeys[id]
+	if !ok {
+		return fmt.Errorf("signing key %s %w", id, ErrNotFound)
+	}
+	if key.Retired() {
+		return nil
+	}
+
+	retired := *key
+	now := time.Now()
+	retired.RetiredAt = &now
+	s.signingKeys[id] = &retired
+	return nil
 }
 
 // GetURLsByUserID получить адреса пользователя.
 func (s *MemoryStorage) GetURLsByUserID(_ context.Context, userID int) ([]*models.StorageURL, error) {
-	user := s.users[userID]
-	if user != nil {
-		urls := user.URLs
-		if urls != nil {
-			return urls, nil
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	urls := make([]*models.StorageURL, 0)
+	for _, url := range s.urls {
+		if url.UserID == userID {
+			urls = append(urls, cloneURL(url))
 		}
 	}
-	return []*models.StorageURL{}, nil
+	sort.Slice(urls, func(i, j int) bool {
+		if !urls[i].CreatedAt.Equal(urls[j].CreatedAt) {
+			return urls[i].CreatedAt.Before(urls[j].CreatedAt)
+		}
+		return urls[i].ShortURL < urls[j].ShortURL
+	})
+
+	return urls, nil
 }
 
-// GetURLsCount получить количество URL.
-func (s *MemoryStorage) GetURLsCount(_ context.Context) (int, error) {
-	return len(s.urls), nil
+// GetServiceStats получить агрегаты ссылок, задач на удаление и переходов для статистики сервиса.
+func (s *MemoryStorage) GetServiceStats(_ context.Context, now time.Time, top int) (*models.ServiceStats, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stats := &models.ServiceStats{TopLinks: make([]models.LinkClicks, 0)}
+
+	for _, url := range s.urls {
+		if url.DeletedFlag {
+			stats.DeletedURLs++
+		} else {
+			stats.ActiveURLs++
+		}
+
+		age := now.Sub(url.CreatedAt)
+		if age < time.Hour {
+			stats.CreatedLastHour++
+		}
+		if age < 24*time.Hour {
+			stats.CreatedLastDay++
+		}
+		if age < 7*24*time.Hour {
+			stats.CreatedLastWeek++
+		}
+	}
+
+	for _, task := range s.deleteTasks {
+		if task.Status == models.Registered {
+			stats.PendingDeleteTasks++
+		}
+	}
+
+	clicks := map[string]int64{}
+	for short, rollup := range s.clicks {
+		stats.TotalClicks += rollup.total
+		if url := s.urls[short]; url != nil && !url.DeletedFlag {
+			clicks[short] = rollup.total
+		}
+	}
+	for _, count := range topClickCounts(clicks, top) {
+		stats.TopLinks = append(stats.TopLinks, models.LinkClicks{ShortURL: count.Value, Clicks: count.Clicks})
+	}
+
+	return stats, nil
 }
 
-// GetUsersCount получить количество пользователей.
+// GetUsersCount получить количество пользователей, у которых есть сохранённые адреса.
+// Анонимные пользователи без адресов в хранилище не попадают и не учитываются.
 func (s *MemoryStorage) GetUsersCount(_ context.Context) (int, error) {
-	return len(s.users), nil
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	owners := map[int]struct{}{}
+	for _, url := range s.urls {
+		owners[url.UserID] = struct{}{}
+	}
+	return len(owners), nil
+}
+
+// AddClicks учесть события переходов в агрегатах по ссылкам.
+func (s *MemoryStorage) AddClicks(_ context.Context, events []*models.ClickEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.addClicks(events)
+	return nil
+}
+
+// addClicks добавляет события переходов в агрегаты.
+func (s *MemoryStorage) addClicks(events []*models.ClickEvent) {
+	for _, event := range events {
+		rollup, ok := s.clicks[event.ShortURL]
+		if !ok {
+			rollup = newLinkClicks()
+			s.clicks[event.ShortURL] = rollup
+		}
+		rollup.add(event)
+		s.visitors.add(event)
+	}
+}
+
+// GetClickStats получить статистику переходов по ссылке за интервал запроса.
+func (s *MemoryStorage) GetClickStats(
+	_ context.Context,
+	shortURL string,
+	query models.ClickStatsQuery,
+) (*models.ClickStats, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rollup, ok := s.clicks[shortURL]
+	if !ok {
+		rollup = newLinkClicks()
+	}
+	return rollup.stats(query), nil
+}
+
+// GetUniqueVisitors получить оценку уникальных посетителей сервиса за всё время.
+func (s *MemoryStorage) GetUniqueVisitors(_ context.Context) (uint64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.visitors.estimate(time.Time{}, time.Time{}), nil
 }
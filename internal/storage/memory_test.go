@@ -2,10 +2,16 @@ package storage
 
 import (
 	"context"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/Melikhov-p/url-minimise/internal/hll"
 	"github.com/Melikhov-p/url-minimise/internal/models"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestAddURL(t *testing.T) {
@@ -136,6 +142,10 @@ func TestGetShortURL(t *testing.T) {
 	shortURL, err := storage.GetShortURL(context.Background(), nil, "original")
 	assert.NoError(t, err)
 	assert.Equal(t, "short", shortURL)
+
+	shortURLs, err := storage.GetShortURLs(context.Background(), []string{"original", "missing"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"original": "short"}, shortURLs)
 }
 
 func TestGetURL(t *testing.T) {
@@ -194,8 +204,27 @@ func TestMemoryStorage_GetURLsByUserID(t *testing.T) {
 	user, err := storage.AddUser(context.Background())
 	assert.NoError(t, err)
 
-	_, err = storage.GetURLsByUserID(context.Background(), user.ID)
+	urls, err := storage.GetURLsByUserID(context.Background(), user.ID)
+	assert.NoError(t, err)
+	assert.Empty(t, urls)
+
+	createdAt := time.Now()
+	err = storage.AddURLs(context.Background(), []*models.StorageURL{
+		{ShortURL: "second", OriginalURL: "second/original", UserID: user.ID, CreatedAt: createdAt.Add(time.Second)},
+		{ShortURL: "first", OriginalURL: "first/original", UserID: user.ID, CreatedAt: createdAt},
+		{ShortURL: "other", OriginalURL: "other/original", UserID: user.ID + 1, CreatedAt: createdAt},
+	})
+	assert.NoError(t, err)
+	err = storage.MarkAsDeletedURL(context.Background(), []*models.DelTask{{URL: "second", UserID: user.ID}})
+	assert.NoError(t, err)
+
+	urls, err = storage.GetURLsByUserID(context.Background(), user.ID)
 	assert.NoError(t, err)
+	if assert.Len(t, urls, 2) {
+		assert.Equal(t, "first", urls[0].ShortURL)
+		assert.Equal(t, "second", urls[1].ShortURL)
+		assert.True(t, urls[1].DeletedFlag)
+	}
 }
 
 func TestMemoryStorage_Ping(t *testing.T) {
@@ -220,13 +249,42 @@ func TestMemoryStorage_Close(t *testing.T) {
 	assert.NoError(t, err)
 }
 
-func TestMemoryStorage_GetURLsCount(t *testing.T) {
+func TestMemoryStorage_GetServiceStats(t *testing.T) {
 	storage := NewMemoryStorage()
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+
+	stats, err := storage.GetServiceStats(context.Background(), now, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, &models.ServiceStats{TopLinks: []models.LinkClicks{}}, stats)
 
-	count, err := storage.GetURLsCount(context.Background())
+	storage.urls = map[string]*models.StorageURL{
+		"fresh":   {ShortURL: "fresh", CreatedAt: now.Add(-time.Minute)},
+		"today":   {ShortURL: "today", CreatedAt: now.Add(-2 * time.Hour)},
+		"old":     {ShortURL: "old", CreatedAt: now.AddDate(0, -1, 0)},
+		"deleted": {ShortURL: "deleted", CreatedAt: now.Add(-72 * time.Hour), DeletedFlag: true},
+	}
+	storage.deleteTasks = map[string]*models.DelTask{
+		"deleted": {URL: "deleted", Status: models.Done},
+		"old":     {URL: "old", Status: models.Registered},
+	}
+	for short, clicks := range map[string]int{"old": 3, "today": 1, "deleted": 5} {
+		for range clicks {
+			assert.NoError(t, storage.AddClicks(context.Background(), []*models.ClickEvent{{Time: now, ShortURL: short}}))
+		}
+	}
 
+	stats, err = storage.GetServiceStats(context.Background(), now, 1)
 	assert.NoError(t, err)
-	assert.Equal(t, 0, count)
+	assert.Equal(t, &models.ServiceStats{
+		TopLinks:           []models.LinkClicks{{ShortURL: "old", Clicks: 3}},
+		ActiveURLs:         3,
+		DeletedURLs:        1,
+		CreatedLastHour:    1,
+		CreatedLastDay:     2,
+		CreatedLastWeek:    3,
+		PendingDeleteTasks: 1,
+		TotalClicks:        9,
+	}, stats)
 }
 
 func TestMemoryStorage_GetUsersCount(t *testing.T) {
@@ -236,4 +294,587 @@ func TestMemoryStorage_GetUsersCount(t *testing.T) {
 
 	assert.NoError(t, err)
 	assert.Equal(t, 0, count)
+
+	// Анонимные пользователи без адресов не учитываются.
+	_, err = storage.AddUser(context.Background())
+	assert.NoError(t, err)
+	storage.urls["a"] = &models.StorageURL{ShortURL: "a", UserID: 7}
+	storage.urls["b"] = &models.StorageURL{ShortURL: "b", UserID: 7}
+	storage.urls["c"] = &models.StorageURL{ShortURL: "c", UserID: 8}
+
+	count, err = storage.GetUsersCount(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+}
+
+func TestMemoryStorage_RestoreURLs(t *testing.T) {
+	storage := NewMemoryStorage()
+
+	_, err := storage.AddURL(context.Background(), &models.StorageURL{ShortURL: "short", OriginalURL: "original", UserID: 1})
+	assert.NoError(t, err)
+	_, err = storage.AddURL(context.Background(), &models.StorageURL{ShortURL: "old", OriginalURL: "old", UserID: 1})
+	assert.NoError(t, err)
+
+	err = storage.MarkAsDeletedURL(context.Background(), []*models.DelTask{
+		{URL: "short", UserID: 1},
+		{URL: "old", UserID: 1},
+	})
+	assert.NoError(t, err)
+	storage.urls["old"].DeletedAt = time.Now().Add(-48 * time.Hour)
+
+	restored, err := storage.RestoreURLs(context.Background(), []string{"short"}, 2, time.Now().Add(-time.Hour))
+	assert.NoError(t, err)
+	assert.Empty(t, restored)
+
+	restored, err = storage.RestoreURLs(
+		context.Background(), []string{"short", "old", "unknown"}, 1, time.Now().Add(-time.Hour),
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"short"}, restored)
+	assert.False(t, storage.urls["short"].DeletedFlag)
+	assert.True(t, storage.urls["old"].DeletedFlag)
+
+	// Задача на удаление, которую воркер ещё не выполнил, отменяется.
+	assert.NoError(t, storage.AddDeleteTask([]string{"short", "old"}, 1))
+	restored, err = storage.RestoreURLs(context.Background(), []string{"short", "old"}, 1, time.Now().Add(-time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"short"}, restored)
+	assert.NotContains(t, storage.deleteTasks, "short")
+	assert.Contains(t, storage.deleteTasks, "old")
+}
+
+func TestMemoryStorage_PurgeDeletedURLs(t *testing.T) {
+	storage := NewMemoryStorage()
+
+	_, err := storage.AddURL(context.Background(), &models.StorageURL{ShortURL: "fresh", OriginalURL: "fresh", UserID: 1})
+	assert.NoError(t, err)
+	_, err = storage.AddURL(context.Background(), &models.StorageURL{ShortURL: "old", OriginalURL: "old", UserID: 1})
+	assert.NoError(t, err)
+	_, err = storage.AddURL(context.Background(), &models.StorageURL{ShortURL: "alive", OriginalURL: "alive", UserID: 1})
+	assert.NoError(t, err)
+
+	err = storage.AddDeleteTask([]string{"fresh", "old"}, 1)
+	assert.NoError(t, err)
+	tasks, err := storage.GetDeleteTasksWStatus(context.Background(), models.Registered)
+	assert.NoError(t, err)
+	err = storage.MarkAsDeletedURL(context.Background(), tasks)
+	assert.NoError(t, err)
+	storage.urls["old"].DeletedAt = time.Now().Add(-48 * time.Hour)
+
+	purged, err := storage.PurgeDeletedURLs(context.Background(), time.Now().Add(-time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, purged)
+
+	_, err = storage.GetURL(context.Background(), "old")
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.NotContains(t, storage.deleteTasks, "old")
+	assert.Contains(t, storage.urls, "fresh")
+	assert.Contains(t, storage.urls, "alive")
+
+	count, err := storage.GetPurgedURLsCount(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
+
+func TestMemoryStorage_SetRedirectRules(t *testing.T) {
+	storage := NewMemoryStorage()
+
+	_, err := storage.AddURL(context.Background(), &models.StorageURL{ShortURL: "short", OriginalURL: "original", UserID: 1})
+	assert.NoError(t, err)
+
+	rules := []models.RedirectRule{{Device: models.DeviceAndroid, Destination: "https://play.google.com/app"}}
+
+	err = storage.SetRedirectRules(context.Background(), "short", 2, rules)
+	assert.ErrorIs(t, err, ErrNotFound)
+	err = storage.SetRedirectRules(context.Background(), "unknown", 1, rules)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	err = storage.SetRedirectRules(context.Background(), "short", 1, rules)
+	assert.NoError(t, err)
+	assert.Equal(t, rules, storage.urls["short"].Rules)
+}
+
+func TestMemoryStorage_Variants(t *testing.T) {
+	storage := NewMemoryStorage()
+
+	_, err := storage.AddURL(context.Background(), &models.StorageURL{ShortURL: "short", OriginalURL: "original", UserID: 1})
+	assert.NoError(t, err)
+
+	variants := []models.Variant{
+		{Name: "a", Destination: "https://example.com/a", Weight: 1},
+		{Name: "b", Destination: "https://example.com/b", Weight: 1},
+	}
+	assert.ErrorIs(t, storage.SetVariants(context.Background(), "short", 2, variants), ErrNotFound)
+	assert.NoError(t, storage.SetVariants(context.Background(), "short", 1, variants))
+
+	assert.NoError(t, storage.AddVariantHits(context.Background(), "short", "a", 1))
+	assert.NoError(t, storage.AddVariantHits(context.Background(), "short", "a", 1))
+	assert.ErrorIs(t, storage.AddVariantHits(context.Background(), "short", "c", 1), ErrNotFound)
+
+	// Счётчик сохраняется у варианта с тем же именем.
+	err = storage.SetVariants(context.Background(), "short", 1, []models.Variant{
+		{Name: "a", Destination: "https://example.com/new", Weight: 3},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []models.Variant{
+		{Name: "a", Destination: "https://example.com/new", Weight: 3, Hits: 2},
+	}, storage.urls["short"].Variants)
+}
+
+func TestMemoryStorage_Domains(t *testing.T) {
+	storage := NewMemoryStorage()
+
+	assert.NoError(t, storage.AddDomain(context.Background(), "b.example.com", 1))
+	assert.NoError(t, storage.AddDomain(context.Background(), "a.example.com", 1))
+	assert.NoError(t, storage.AddDomain(context.Background(), "other.example.com", 2))
+	assert.ErrorIs(t, storage.AddDomain(context.Background(), "a.example.com", 2), ErrDomainExist)
+
+	owner, err := storage.GetDomainOwner(context.Background(), "a.example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, owner)
+	_, err = storage.GetDomainOwner(context.Background(), "unknown.example.com")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	domains, err := storage.GetUserDomains(context.Background(), 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a.example.com", "b.example.com"}, domains)
+
+	all, err := storage.GetDomains(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"a.example.com": 1, "b.example.com": 1, "other.example.com": 2}, all)
+}
+
+func TestMemoryStorage_Accounts(t *testing.T) {
+	storage := NewMemoryStorage()
+	ctx := context.Background()
+
+	anonymous, err := storage.AddUser(ctx)
+	assert.NoError(t, err)
+	storage.urls["a"] = &models.StorageURL{ShortURL: "a", UserID: anonymous.ID}
+	storage.urls["b"] = &models.StorageURL{ShortURL: "b", UserID: 99}
+	assert.NoError(t, storage.AddDomain(ctx, "go.example.com", anonymous.ID))
+	assert.NoError(t, storage.AddDeleteTask([]string{"a"}, anonymous.ID))
+
+	account := &models.Account{Email: "user@example.com", PasswordHash: "hash"}
+	assert.NoError(t, storage.AddAccount(ctx, account))
+	assert.Equal(t, 2, account.UserID)
+	assert.Equal(t, "user@example.com", storage.users[2].Email)
+	assert.ErrorIs(t, storage.AddAccount(ctx, &models.Account{Email: "user@example.com"}), ErrAccountExist)
+
+	stored, err := storage.GetAccount(ctx, "user@example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, account, stored)
+	_, err = storage.GetAccount(ctx, "other@example.com")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	moved, err := storage.MergeUsers(ctx, anonymous.ID, account.UserID)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, moved)
+	assert.Equal(t, account.UserID, storage.urls["a"].UserID)
+	assert.Equal(t, 99, storage.urls["b"].UserID)
+	assert.Equal(t, account.UserID, storage.domains["go.example.com"])
+	assert.Equal(t, account.UserID, storage.deleteTasks["a"].UserID)
+}
+
+func TestMemoryStorage_OIDCIdentities(t *testing.T) {
+	storage := NewMemoryStorage()
+	ctx := context.Background()
+
+	identity := &models.OIDCIdentity{Issuer: "https://idp", Subject: "42", Email: "user@example.com", UserID: 1}
+	assert.NoError(t, storage.AddOIDCIdentity(ctx, identity))
+	assert.ErrorIs(t, storage.AddOIDCIdentity(ctx, &models.OIDCIdentity{Issuer: "https://idp", Subject: "42"}),
+		ErrIdentityExist)
+	// subject уникален только у своего провайдера.
+	assert.NoError(t, storage.AddOIDCIdentity(ctx, &models.OIDCIdentity{Issuer: "https://other", Subject: "42"}))
+
+	stored, err := storage.GetOIDCIdentity(ctx, "https://idp", "42")
+	assert.NoError(t, err)
+	assert.Equal(t, identity, stored)
+	_, err = storage.GetOIDCIdentity(ctx, "https://idp", "43")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestMemoryStorage_APIKeys(t *testing.T) {
+	storage := NewMemoryStorage()
+	ctx := context.Background()
+	now := time.Now()
+
+	assert.NoError(t, storage.AddAPIKey(ctx, &models.APIKey{ID: "b", UserID: 1, CreatedAt: now.Add(time.Minute)}))
+	assert.NoError(t, storage.AddAPIKey(ctx, &models.APIKey{ID: "a", UserID: 1, CreatedAt: now}))
+	assert.NoError(t, storage.AddAPIKey(ctx, &models.APIKey{ID: "c", UserID: 2, CreatedAt: now}))
+
+	key, err := storage.GetAPIKey(ctx, "c")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, key.UserID)
+	_, err = storage.GetAPIKey(ctx, "missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	keys, err := storage.GetUserAPIKeys(ctx, 1)
+	assert.NoError(t, err)
+	assert.Len(t, keys, 2)
+	assert.Equal(t, "a", keys[0].ID)
+
+	// Чужой ключ не отзывается.
+	assert.ErrorIs(t, storage.DeleteAPIKey(ctx, "c", 1), ErrNotFound)
+	assert.NoError(t, storage.DeleteAPIKey(ctx, "c", 2))
+	_, err = storage.GetAPIKey(ctx, "c")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	_, err = storage.MergeUsers(ctx, 1, 3)
+	assert.NoError(t, err)
+	keys, err = storage.GetUserAPIKeys(ctx, 3)
+	assert.NoError(t, err)
+	assert.Len(t, keys, 2)
+}
+
+func TestMemoryStorage_RefreshTokens(t *testing.T) {
+	storage := NewMemoryStorage()
+	ctx := context.Background()
+	now := time.Now()
+
+	first := &models.RefreshToken{ID: "a", Family: "a", UserID: 1, ExpiresAt: now.Add(time.Hour)}
+	stale := &models.RefreshToken{ID: "old", Family: "old", UserID: 2, ExpiresAt: now.Add(-time.Minute)}
+	assert.NoError(t, storage.AddRefreshToken(ctx, first))
+	assert.NoError(t, storage.AddRefreshToken(ctx, stale))
+	_, err := storage.GetRefreshToken(ctx, "missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// Заменённый токен второй раз не заменяется, истёкшие токены удаляются.
+	next := &models.RefreshToken{ID: "b", Family: "a", UserID: 1, ExpiresAt: now.Add(time.Hour)}
+	assert.NoError(t, storage.RotateRefreshToken(ctx, "a", next))
+	assert.Equal(t, "b", first.ReplacedBy)
+	assert.ErrorIs(t, storage.RotateRefreshToken(ctx, "a", &models.RefreshToken{ID: "c"}), ErrRefreshTokenUsed)
+	_, err = storage.GetRefreshToken(ctx, "old")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	assert.NoError(t, storage.RevokeRefreshTokens(ctx, "a"))
+	token, err := storage.GetRefreshToken(ctx, "b")
+	assert.NoError(t, err)
+	assert.NotNil(t, token.RevokedAt)
+	assert.False(t, token.Active(now))
+	assert.ErrorIs(t, storage.RotateRefreshToken(ctx, "b", &models.RefreshToken{ID: "c"}), ErrRefreshTokenUsed)
+
+	assert.NoError(t, storage.RevokeToken(ctx, &models.RevokedToken{ID: "jti", ExpiresAt: now.Add(time.Hour)}))
+	assert.NoError(t, storage.RevokeToken(ctx, &models.RevokedToken{ID: "expired", ExpiresAt: now.Add(-time.Hour)}))
+	revoked, err := storage.IsTokenRevoked(ctx, "jti")
+	assert.NoError(t, err)
+	assert.True(t, revoked)
+	revoked, err = storage.IsTokenRevoked(ctx, "expired")
+	assert.NoError(t, err)
+	assert.False(t, revoked)
+	revoked, err = storage.IsTokenRevoked(ctx, "other")
+	assert.NoError(t, err)
+	assert.False(t, revoked)
+}
+
+func TestMemoryStorage_RotateRefreshTokenOnce(t *testing.T) {
+	storage := NewMemoryStorage()
+	ctx := context.Background()
+	expiresAt := time.Now().Add(time.Hour)
+	assert.NoError(t, storage.AddRefreshToken(ctx, &models.RefreshToken{ID: "a", Family: "a", ExpiresAt: expiresAt}))
+
+	// Из одновременных обновлений одним токеном проходит только одно, остальные видят повторное использование.
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		rotated int
+	)
+	for i := range 16 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			next := &models.RefreshToken{ID: "next-" + strconv.Itoa(i), Family: "a", ExpiresAt: expiresAt}
+			err := storage.RotateRefreshToken(ctx, "a", next)
+			if err == nil {
+				mu.Lock()
+				rotated++
+				mu.Unlock()
+				return
+			}
+			assert.ErrorIs(t, err, ErrRefreshTokenUsed)
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 1, rotated)
+}
+
+func TestMemoryStorage_UpdateQuarantine(t *testing.T) {
+	storage := NewMemoryStorage()
+	storage.urls["evil"] = &models.StorageURL{ShortURL: "evil", OriginalURL: "https://evil.com"}
+	storage.urls["fixed"] = &models.StorageURL{ShortURL: "fixed", OriginalURL: "https://good.com", Quarantined: true}
+	storage.urls["deleted"] = &models.StorageURL{ShortURL: "deleted", OriginalURL: "https://evil.com/x", DeletedFlag: true}
+
+	blocked := func(originalURL string) bool { return strings.HasPrefix(originalURL, "https://evil.com") }
+
+	quarantined, released, err := storage.UpdateQuarantine(context.Background(), blocked)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, quarantined)
+	assert.Equal(t, 1, released)
+	assert.True(t, storage.urls["evil"].Quarantined)
+	assert.False(t, storage.urls["fixed"].Quarantined)
+	assert.False(t, storage.urls["deleted"].Quarantined)
+
+	quarantined, released, err = storage.UpdateQuarantine(context.Background(), blocked)
+	assert.NoError(t, err)
+	assert.Zero(t, quarantined)
+	assert.Zero(t, released)
+}
+
+func TestMemoryStorage_LinkHealth(t *testing.T) {
+	storage := NewMemoryStorage()
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+	storage.urls["checked"] = &models.StorageURL{ShortURL: "checked", OriginalURL: "https://a.com", UserID: 1}
+	storage.urls["new"] = &models.StorageURL{ShortURL: "new", OriginalURL: "https://b.com", UserID: 1}
+	storage.urls["fresh"] = &models.StorageURL{ShortURL: "fresh", OriginalURL: "https://c.com", UserID: 1}
+	storage.urls["deleted"] = &models.StorageURL{ShortURL: "deleted", DeletedFlag: true}
+	storage.urls["quarantined"] = &models.StorageURL{ShortURL: "quarantined", Quarantined: true}
+	storage.urls["scheduled"] = &models.StorageURL{ShortURL: "scheduled", ActiveFrom: &future}
+	storage.urls["expired"] = &models.StorageURL{ShortURL: "expired", ActiveUntil: &past}
+
+	err := storage.SaveLinkHealth(context.Background(), []*models.LinkHealth{
+		{ShortURL: "checked", CheckedAt: past, StatusCode: 500, Failures: 3, Broken: true},
+		{ShortURL: "fresh", CheckedAt: time.Now(), StatusCode: 200},
+		{ShortURL: "missing", CheckedAt: past},
+	})
+	assert.NoError(t, err)
+	assert.NotContains(t, storage.health, "missing")
+
+	links, err := storage.GetLinksForHealthCheck(context.Background(), time.Now().Add(-time.Minute), 10)
+	assert.NoError(t, err)
+	if assert.Len(t, links, 2) {
+		assert.Equal(t, "new", links[0].ShortURL)
+		assert.Equal(t, "https://b.com", links[0].OriginalURL)
+		assert.Equal(t, "checked", links[1].ShortURL)
+		assert.Equal(t, 3, links[1].Failures)
+	}
+
+	links, err = storage.GetLinksForHealthCheck(context.Background(), time.Now().Add(-time.Minute), 1)
+	assert.NoError(t, err)
+	assert.Len(t, links, 1)
+
+	broken, err := storage.GetBrokenLinks(context.Background(), 1)
+	assert.NoError(t, err)
+	if assert.Len(t, broken, 1) {
+		assert.Equal(t, "checked", broken[0].ShortURL)
+		assert.Equal(t, "https://a.com", broken[0].OriginalURL)
+	}
+
+	broken, err = storage.GetBrokenLinks(context.Background(), 2)
+	assert.NoError(t, err)
+	assert.Empty(t, broken)
+}
+
+func TestMemoryStorage_AddClicks(t *testing.T) {
+	storage := NewMemoryStorage()
+
+	event := &models.ClickEvent{Time: time.Now(), ShortURL: "short", IP: "203.0.113.0"}
+	assert.NoError(t, storage.AddClicks(context.Background(), []*models.ClickEvent{event}))
+	assert.NoError(t, storage.AddClicks(context.Background(), nil))
+
+	if assert.Len(t, storage.clicks, 1) {
+		assert.Equal(t, int64(1), storage.clicks["short"].total)
+	}
+}
+
+func TestMemoryStorage_Concurrent(t *testing.T) {
+	storage := NewMemoryStorage()
+	ctx := context.Background()
+	now := time.Now()
+
+	// Воркер переходов пишет агрегаты, пока обработчики читают статистику и создают ссылки.
+	var wg sync.WaitGroup
+	for i := range 4 {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			for j := range 100 {
+				event := &models.ClickEvent{Time: now, ShortURL: "short", IP: "203.0.113." + strconv.Itoa(j)}
+				assert.NoError(t, storage.AddClicks(ctx, []*models.ClickEvent{event}))
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for range 100 {
+				_, err := storage.GetServiceStats(ctx, now, 10)
+				assert.NoError(t, err)
+				_, err = storage.GetClickStats(ctx, "short", models.ClickStatsQuery{To: now.Add(time.Hour)})
+				assert.NoError(t, err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := range 100 {
+				short := strconv.Itoa(i) + "-" + strconv.Itoa(j)
+				_, err := storage.AddURL(ctx, &models.StorageURL{ShortURL: short, OriginalURL: short, CreatedAt: now})
+				assert.NoError(t, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	stats, err := storage.GetServiceStats(ctx, now, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 400, stats.ActiveURLs)
+	assert.Equal(t, int64(400), stats.TotalClicks)
+}
+
+func TestMemoryStorage_ConcurrentURLReads(t *testing.T) {
+	storage := NewMemoryStorage()
+	ctx := context.Background()
+
+	for i := range 10 {
+		short := "v" + strconv.Itoa(i)
+		_, err := storage.AddURL(ctx, &models.StorageURL{ShortURL: short, OriginalURL: short, UserID: 1})
+		require.NoError(t, err)
+		require.NoError(t, storage.SetVariants(ctx, short, 1, []models.Variant{{Name: "a", Weight: 1}}))
+	}
+
+	// Переход читает варианты, правила и отметку удаления, пока воркеры пишут показы и удаления.
+	var wg sync.WaitGroup
+	wg.Add(4)
+	go func() {
+		defer wg.Done()
+		for range 100 {
+			assert.NoError(t, storage.AddVariantHits(ctx, "v0", "a", 1))
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := range 10 {
+			short := "v" + strconv.Itoa(i)
+			assert.NoError(t, storage.MarkAsDeletedURL(ctx, []*models.DelTask{{URL: short, UserID: 1}}))
+			assert.NoError(t, storage.SetRedirectRules(ctx, short, 1, []models.RedirectRule{{Language: "en"}}))
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for range 100 {
+			url, err := storage.GetURL(ctx, "v0")
+			assert.NoError(t, err)
+			_ = url.DeletedFlag
+			_ = len(url.Rules)
+			for _, variant := range url.Variants {
+				_ = variant.Hits
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for range 100 {
+			urls, err := storage.GetURLsByUserID(ctx, 1)
+			assert.NoError(t, err)
+			for _, url := range urls {
+				_ = url.DeletedFlag
+				_ = len(url.Rules)
+				for _, variant := range url.Variants {
+					_ = variant.Hits
+				}
+			}
+		}
+	}()
+	wg.Wait()
+
+	url, err := storage.GetURL(ctx, "v0")
+	require.NoError(t, err)
+	assert.Equal(t, int64(100), url.Variants[0].Hits)
+	assert.True(t, url.DeletedFlag)
+
+	// Изменение копии не меняет хранимый адрес.
+	url.Variants[0].Hits = 0
+	stored, err := storage.GetURL(ctx, "v0")
+	require.NoError(t, err)
+	assert.Equal(t, int64(100), stored.Variants[0].Hits)
+}
+
+func TestMemoryStorage_GetClickStats(t *testing.T) {
+	storage := NewMemoryStorage()
+	day := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	events := []*models.ClickEvent{
+		{
+			Time: day.Add(time.Hour), ShortURL: "short", Referrer: "https://www.Google.com/search", Language: "ru",
+			Visitor: hll.Hash("1"),
+		},
+		{
+			Time: day.Add(time.Hour + time.Minute), ShortURL: "short", Referrer: "https://google.com/", Language: "en",
+			Visitor: hll.Hash("1"),
+		},
+		{Time: day.Add(26 * time.Hour), ShortURL: "short", Language: "ru", UserAgent: "curl", Visitor: hll.Hash("2")},
+		{Time: day.Add(-time.Hour), ShortURL: "short", Referrer: "https://t.me/", Visitor: hll.Hash("3")},
+		{Time: day, ShortURL: "other", Visitor: hll.Hash("4")},
+	}
+	assert.NoError(t, storage.AddClicks(context.Background(), events))
+
+	query := models.ClickStatsQuery{
+		From:   day,
+		To:     day.Add(48 * time.Hour),
+		Bucket: models.StatsBucketHour,
+		Top:    1,
+	}
+	stats, err := storage.GetClickStats(context.Background(), "short", query)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), stats.TotalCount)
+	assert.Equal(t, uint64(2), stats.UniqueVisitors)
+	assert.Equal(t, []models.StatsPoint{
+		{Time: day.Add(time.Hour), Clicks: 2},
+		{Time: day.Add(26 * time.Hour), Clicks: 1},
+	}, stats.Series)
+	assert.Equal(t, []models.ClickCount{{Value: "google.com", Clicks: 2}}, stats.Top[models.ClickDimensionReferrer])
+	assert.Equal(t, []models.ClickCount{{Value: "ru", Clicks: 2}}, stats.Top[models.ClickDimensionLanguage])
+
+	query.Bucket = models.StatsBucketDay
+	query.Top = 0
+	stats, err = storage.GetClickStats(context.Background(), "short", query)
+	assert.NoError(t, err)
+	assert.Equal(t, []models.StatsPoint{
+		{Time: day, Clicks: 2},
+		{Time: day.Add(24 * time.Hour), Clicks: 1},
+	}, stats.Series)
+	assert.Len(t, stats.Top[models.ClickDimensionReferrer], 2)
+
+	visitors, err := storage.GetUniqueVisitors(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(4), visitors)
+
+	// Агрегаты удаляются вместе со ссылкой.
+	storage.urls["short"] = &models.StorageURL{ShortURL: "short", DeletedFlag: true, DeletedAt: day}
+	_, err = storage.PurgeDeletedURLs(context.Background(), day.Add(time.Hour))
+	assert.NoError(t, err)
+	stats, err = storage.GetClickStats(context.Background(), "short", query)
+	assert.NoError(t, err)
+	assert.Zero(t, stats.TotalCount)
+	assert.Empty(t, stats.Series)
+}
+
+func TestMemoryStorage_SigningKeys(t *testing.T) {
+	storage := NewMemoryStorage()
+	ctx := context.Background()
+	now := time.Now()
+
+	newer := &models.SigningKey{CreatedAt: now, ID: "b", Secret: "second"}
+	older := &models.SigningKey{CreatedAt: now.Add(-time.Hour), ID: "a", Secret: "first"}
+	assert.NoError(t, storage.AddSigningKey(ctx, newer))
+	assert.NoError(t, storage.AddSigningKey(ctx, older))
+
+	keys, err := storage.GetSigningKeys(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []*models.SigningKey{older, newer}, keys)
+
+	assert.NoError(t, storage.RetireSigningKey(ctx, "a"))
+	assert.ErrorIs(t, storage.RetireSigningKey(ctx, "missing"), ErrNotFound)
+	// Ранее отданный ключ не меняется, выведенный ключ хранится копией.
+	assert.False(t, older.Retired())
+
+	keys, err = storage.GetSigningKeys(ctx)
+	assert.NoError(t, err)
+	assert.True(t, keys[0].Retired())
+	assert.False(t, keys[1].Retired())
+	retiredAt := *keys[0].RetiredAt
+
+	assert.NoError(t, storage.RetireSigningKey(ctx, "a"))
+	keys, err = storage.GetSigningKeys(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, retiredAt, *keys[0].RetiredAt)
 }
@@ -0,0 +1,10 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE url ADD COLUMN deleted_at TIMESTAMP;
+UPDATE url SET deleted_at = NOW() WHERE is_deleted = true;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE url DROP COLUMN deleted_at;
+-- +goose StatementEnd
@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS purge_log(
+    id SERIAL PRIMARY KEY,
+    purged_at TIMESTAMP DEFAULT NOW(),
+    urls_count INTEGER NOT NULL
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS purge_log;
+-- +goose StatementEnd
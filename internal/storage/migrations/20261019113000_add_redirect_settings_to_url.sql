@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE url
+    ADD COLUMN redirect_code INTEGER NOT NULL DEFAULT 307,
+    ADD COLUMN no_cache BOOLEAN NOT NULL DEFAULT FALSE;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE url
+    DROP COLUMN redirect_code,
+    DROP COLUMN no_cache;
+-- +goose StatementEnd
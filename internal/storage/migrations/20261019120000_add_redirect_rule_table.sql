@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS redirect_rule(
+    id SERIAL PRIMARY KEY,
+    short_url VARCHAR(255) NOT NULL REFERENCES url (short_url) ON DELETE CASCADE,
+    position INTEGER NOT NULL,
+    device VARCHAR(20) NOT NULL DEFAULT '',
+    language VARCHAR(35) NOT NULL DEFAULT '',
+    not_before TIMESTAMPTZ,
+    not_after TIMESTAMPTZ,
+    destination TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS redirect_rule_short_url_idx ON redirect_rule (short_url);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS redirect_rule;
+-- +goose StatementEnd
@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS url_variant(
+    id SERIAL PRIMARY KEY,
+    short_url VARCHAR(255) NOT NULL REFERENCES url (short_url) ON DELETE CASCADE,
+    position INTEGER NOT NULL,
+    name VARCHAR(64) NOT NULL,
+    destination TEXT NOT NULL,
+    weight INTEGER NOT NULL,
+    hits BIGINT NOT NULL DEFAULT 0,
+    UNIQUE (short_url, name)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS url_variant;
+-- +goose StatementEnd
@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE url
+    ADD COLUMN query_passthrough BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN utm JSONB NOT NULL DEFAULT '{}';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE url
+    DROP COLUMN query_passthrough,
+    DROP COLUMN utm;
+-- +goose StatementEnd
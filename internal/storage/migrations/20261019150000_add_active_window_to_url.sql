@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE url
+    ADD COLUMN active_from TIMESTAMPTZ,
+    ADD COLUMN active_until TIMESTAMPTZ;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE url
+    DROP COLUMN active_from,
+    DROP COLUMN active_until;
+-- +goose StatementEnd
@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE url
+    ADD COLUMN quarantined BOOL NOT NULL DEFAULT FALSE;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE url
+    DROP COLUMN quarantined;
+-- +goose StatementEnd
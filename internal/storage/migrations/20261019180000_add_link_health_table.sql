@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS link_health(
+    short_url VARCHAR(255) PRIMARY KEY REFERENCES url (short_url) ON DELETE CASCADE,
+    status_code INTEGER NOT NULL DEFAULT 0,
+    latency_ms BIGINT NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT '',
+    failures INTEGER NOT NULL DEFAULT 0,
+    broken BOOL NOT NULL DEFAULT FALSE,
+    checked_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS link_health_checked_at_idx ON link_health (checked_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS link_health;
+-- +goose StatementEnd
@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE url
+    ADD COLUMN created_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE url
+    DROP COLUMN created_at;
+-- +goose StatementEnd
@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS click_event(
+    short_url VARCHAR(255) NOT NULL,
+    clicked_at TIMESTAMPTZ NOT NULL,
+    referrer TEXT NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    ip VARCHAR(64) NOT NULL DEFAULT ''
+) PARTITION BY RANGE (clicked_at);
+CREATE INDEX IF NOT EXISTS click_event_short_url_idx ON click_event (short_url, clicked_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS click_event;
+-- +goose StatementEnd
@@ -0,0 +1,30 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE click_event ADD COLUMN IF NOT EXISTS language VARCHAR(35) NOT NULL DEFAULT '';
+CREATE TABLE IF NOT EXISTS click_total(
+    short_url VARCHAR(255) PRIMARY KEY,
+    clicks BIGINT NOT NULL DEFAULT 0
+);
+CREATE TABLE IF NOT EXISTS click_rollup_hour(
+    short_url VARCHAR(255) NOT NULL,
+    bucket TIMESTAMPTZ NOT NULL,
+    clicks BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (short_url, bucket)
+);
+CREATE TABLE IF NOT EXISTS click_rollup_dim(
+    short_url VARCHAR(255) NOT NULL,
+    day DATE NOT NULL,
+    dimension VARCHAR(32) NOT NULL,
+    value TEXT NOT NULL,
+    clicks BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (short_url, day, dimension, value)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS click_rollup_dim;
+DROP TABLE IF EXISTS click_rollup_hour;
+DROP TABLE IF EXISTS click_total;
+ALTER TABLE click_event DROP COLUMN IF EXISTS language;
+-- +goose StatementEnd
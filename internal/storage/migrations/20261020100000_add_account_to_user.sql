@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE "user"
+    ADD COLUMN email VARCHAR(254) UNIQUE,
+    ADD COLUMN password_hash TEXT,
+    ADD COLUMN registered_at TIMESTAMPTZ;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE "user"
+    DROP COLUMN registered_at,
+    DROP COLUMN password_hash,
+    DROP COLUMN email;
+-- +goose StatementEnd
@@ -0,0 +1,27 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS refresh_token(
+    id VARCHAR(32) PRIMARY KEY,
+    family VARCHAR(32) NOT NULL,
+    user_id INTEGER NOT NULL REFERENCES "user" (id) ON DELETE CASCADE,
+    email VARCHAR(254) NOT NULL DEFAULT '',
+    hash CHAR(64) NOT NULL,
+    replaced_by VARCHAR(32) NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    revoked_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS refresh_token_family_idx ON refresh_token (family);
+CREATE INDEX IF NOT EXISTS refresh_token_expires_at_idx ON refresh_token (expires_at);
+
+CREATE TABLE IF NOT EXISTS revoked_token(
+    jti VARCHAR(32) PRIMARY KEY,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS revoked_token;
+DROP TABLE IF EXISTS refresh_token;
+-- +goose StatementEnd
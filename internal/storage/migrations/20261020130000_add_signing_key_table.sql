@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS signing_key(
+    kid VARCHAR(32) PRIMARY KEY,
+    secret VARCHAR(255) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    retired_at TIMESTAMPTZ
+);
+
+-- Прежний единственный ключ проверяет токены без kid, пока его не выведут из оборота.
+INSERT INTO signing_key (kid, secret)
+SELECT 'legacy', key FROM secret_key WHERE key IS NOT NULL ORDER BY id LIMIT 1
+ON CONFLICT (kid) DO NOTHING;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS signing_key;
+-- +goose StatementEnd
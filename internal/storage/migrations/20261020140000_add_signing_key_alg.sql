@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Ключи RS256 и EdDSA хранят закрытый ключ в PEM, который не помещается в VARCHAR(255).
+ALTER TABLE signing_key ADD COLUMN IF NOT EXISTS alg VARCHAR(16) NOT NULL DEFAULT 'HS256';
+ALTER TABLE signing_key ALTER COLUMN secret TYPE TEXT;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM signing_key WHERE alg <> 'HS256';
+ALTER TABLE signing_key ALTER COLUMN secret TYPE VARCHAR(255);
+ALTER TABLE signing_key DROP COLUMN IF EXISTS alg;
+-- +goose StatementEnd
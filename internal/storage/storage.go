@@ -30,3 +30,15 @@ var ErrNotFound error = errors.New("not wantFound full url")
 
 // ErrOriginalURLExist полный адрес уже существует в хранилище.
 var ErrOriginalURLExist error = errors.New("original url already exist in storage")
+
+// ErrDomainExist домен уже зарегистрирован.
+var ErrDomainExist error = errors.New("domain already registered")
+
+// ErrAccountExist аккаунт с такой почтой уже зарегистрирован.
+var ErrAccountExist error = errors.New("account already registered")
+
+// ErrIdentityExist пользователь провайдера OpenID Connect уже привязан к аккаунту.
+var ErrIdentityExist error = errors.New("oidc identity already linked")
+
+// ErrRefreshTokenUsed токен обновления уже заменён следующим или отозван.
+var ErrRefreshTokenUsed error = errors.New("refresh token already used")
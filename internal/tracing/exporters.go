@@ -0,0 +1,81 @@
+package tracing
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// Имена экспортёров в конфигурации.
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+)
+
+// ErrUnknownExporter неизвестное имя экспортёра.
+var ErrUnknownExporter = errors.New("unknown trace exporter")
+
+// NewTracerFor возвращает трассировщик с экспортёром по имени из конфигурации: none (пустое имя) или stdout.
+func NewTracerFor(exporter string) (*Tracer, error) {
+	switch exporter {
+	case "", ExporterNone:
+		return NewTracer(nil), nil
+	case ExporterStdout:
+		return NewTracer(NewJSONExporter(os.Stdout)), nil
+	}
+	return nil, fmt.Errorf("%w %q", ErrUnknownExporter, exporter)
+}
+
+// JSONExporter пишет каждый спан отдельной строкой JSON. Ошибки записи игнорируются:
+// трассировка не должна ломать обработку запросов.
+type JSONExporter struct {
+	enc *json.Encoder
+	mu  sync.Mutex
+}
+
+// NewJSONExporter возвращает экспортёр, который пишет спаны в w.
+func NewJSONExporter(w io.Writer) *JSONExporter {
+	return &JSONExporter{enc: json.NewEncoder(w)}
+}
+
+// Export пишет спан.
+func (e *JSONExporter) Export(span SpanData) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_ = e.enc.Encode(span)
+}
+
+// MemoryExporter хранит спаны в памяти, нужен для тестов.
+type MemoryExporter struct {
+	spans []SpanData
+	mu    sync.Mutex
+}
+
+// NewMemoryExporter возвращает пустой экспортёр в память.
+func NewMemoryExporter() *MemoryExporter {
+	return &MemoryExporter{}
+}
+
+// Export сохраняет спан.
+func (e *MemoryExporter) Export(span SpanData) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, span)
+}
+
+// Spans возвращает копию сохранённых спанов в порядке завершения.
+func (e *MemoryExporter) Spans() []SpanData {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]SpanData(nil), e.spans...)
+}
+
+// Reset удаляет сохранённые спаны.
+func (e *MemoryExporter) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = nil
+}
@@ -0,0 +1,303 @@
+// Package tracing трассировка запросов в формате W3C Trace Context.
+// Спаны передаются через контекст, завершённые спаны отдаются экспортёру.
+package tracing
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// TraceparentHeader имя заголовка HTTP и ключа метаданных gRPC с контекстом трассировки.
+const TraceparentHeader = "traceparent"
+
+const (
+	traceparentVersion = "00"
+	traceparentLen     = 55
+	flagSampled        = 0x01
+)
+
+// ErrInvalidTraceparent заголовок traceparent не соответствует формату W3C Trace Context.
+var ErrInvalidTraceparent = errors.New("invalid traceparent")
+
+// TraceID идентификатор трассировки.
+type TraceID [16]byte
+
+// String возвращает идентификатор в шестнадцатеричном виде.
+func (id TraceID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// SpanID идентификатор спана.
+type SpanID [8]byte
+
+// String возвращает идентификатор в шестнадцатеричном виде.
+func (id SpanID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// SpanContext данные спана, которые передаются между сервисами.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+// IsValid сообщает, заданы ли оба идентификатора.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != TraceID{} && sc.SpanID != SpanID{}
+}
+
+// Traceparent возвращает значение заголовка traceparent.
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return traceparentVersion + "-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + flags
+}
+
+// ParseTraceparent разбирает заголовок traceparent. Заголовки следующих версий формата
+// принимаются, если их начало совпадает с версией 00.
+func ParseTraceparent(value string) (SpanContext, error) {
+	var sc SpanContext
+
+	value = strings.TrimSpace(value)
+	if len(value) < traceparentLen || (len(value) > traceparentLen && value[traceparentLen] != '-') {
+		return sc, ErrInvalidTraceparent
+	}
+	parts := strings.Split(value[:traceparentLen], "-")
+	if len(parts) != 4 || len(parts[0]) != 2 || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc, ErrInvalidTraceparent
+	}
+	if parts[0] == "ff" || (parts[0] == traceparentVersion && len(value) != traceparentLen) {
+		return sc, ErrInvalidTraceparent
+	}
+	for _, part := range parts {
+		if strings.ToLower(part) != part {
+			return sc, ErrInvalidTraceparent
+		}
+	}
+
+	var flags [1]byte
+	if _, err := hex.Decode(flags[:], []byte(parts[3])); err != nil {
+		return sc, ErrInvalidTraceparent
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return sc, ErrInvalidTraceparent
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return sc, ErrInvalidTraceparent
+	}
+	if !sc.IsValid() {
+		return sc, ErrInvalidTraceparent
+	}
+	sc.Sampled = flags[0]&flagSampled != 0
+
+	return sc, nil
+}
+
+// SpanData завершённый спан, который получает экспортёр.
+type SpanData struct {
+	Start      time.Time         `json:"start"`
+	End        time.Time         `json:"end"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Name       string            `json:"name"`
+	TraceID    string            `json:"trace_id"`
+	SpanID     string            `json:"span_id"`
+	ParentID   string            `json:"parent_id,omitempty"`
+	Error      string            `json:"error,omitempty"`
+}
+
+// Exporter получатель завершённых спанов. Export вызывается конкурентно.
+type Exporter interface {
+	Export(span SpanData)
+}
+
+// Tracer начинает трассировку входящих запросов. Без экспортёра спаны создаются,
+// чтобы идентификаторы попадали в логи и ответы, но никуда не отправляются.
+type Tracer struct {
+	exporter Exporter
+}
+
+// NewTracer возвращает трассировщик, который отдаёт спаны экспортёру exporter.
+func NewTracer(exporter Exporter) *Tracer {
+	return &Tracer{exporter: exporter}
+}
+
+// StartRemote начинает спан входящего запроса. Если parent задан, спан продолжает трассировку
+// вызывающей стороны, иначе начинается новая трассировка. Нулевой трассировщик спан не создаёт.
+func (t *Tracer) StartRemote(ctx context.Context, name string, parent SpanContext) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+
+	sc := SpanContext{SpanID: newSpanID(), Sampled: true}
+	var parentID string
+	if parent.IsValid() {
+		sc.TraceID = parent.TraceID
+		sc.Sampled = parent.Sampled
+		parentID = parent.SpanID.String()
+	} else {
+		sc.TraceID = newTraceID()
+	}
+
+	span := newSpan(t, name, sc, parentID)
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// Start начинает дочерний спан спана из контекста. Если в контексте нет спана,
+// запрос не трассируется: возвращается исходный контекст и нулевой спан.
+func Start(ctx context.Context, name string) (context.Context, *Span) {
+	parent := SpanFromContext(ctx)
+	if parent == nil {
+		return ctx, nil
+	}
+
+	sc := SpanContext{TraceID: parent.sc.TraceID, SpanID: newSpanID(), Sampled: parent.sc.Sampled}
+	span := newSpan(parent.tracer, name, sc, parent.sc.SpanID.String())
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// spanKey ключ спана в контексте.
+type spanKey struct{}
+
+// SpanFromContext возвращает текущий спан из контекста или nil.
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// LogFields поля лога с идентификаторами трассировки и текущего спана.
+func LogFields(ctx context.Context) []zap.Field {
+	span := SpanFromContext(ctx)
+	if span == nil {
+		return nil
+	}
+	return []zap.Field{
+		zap.String("trace_id", span.sc.TraceID.String()),
+		zap.String("span_id", span.sc.SpanID.String()),
+	}
+}
+
+// Logger возвращает логгер, который добавляет к каждой записи идентификаторы трассировки из контекста.
+func Logger(ctx context.Context, logger *zap.Logger) *zap.Logger {
+	fields := LogFields(ctx)
+	if fields == nil {
+		return logger
+	}
+	return logger.With(fields...)
+}
+
+// Span операция внутри трассировки. Методы нулевого спана ничего не делают.
+type Span struct {
+	tracer *Tracer
+	data   SpanData
+	sc     SpanContext
+	mu     sync.Mutex
+	ended  bool
+}
+
+func newSpan(tracer *Tracer, name string, sc SpanContext, parentID string) *Span {
+	return &Span{
+		tracer: tracer,
+		sc:     sc,
+		data: SpanData{
+			Start:    time.Now(),
+			Name:     name,
+			TraceID:  sc.TraceID.String(),
+			SpanID:   sc.SpanID.String(),
+			ParentID: parentID,
+		},
+	}
+}
+
+// Context возвращает данные спана для передачи дальше.
+func (s *Span) Context() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.sc
+}
+
+// SetName меняет имя спана, например, когда маршрут запроса известен только после его обработки.
+func (s *Span) SetName(name string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Name = name
+}
+
+// SetAttribute задаёт атрибут спана, после End атрибуты не меняются.
+func (s *Span) SetAttribute(key, value string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ended {
+		return
+	}
+	if s.data.Attributes == nil {
+		s.data.Attributes = make(map[string]string)
+	}
+	s.data.Attributes[key] = value
+}
+
+// RecordError отмечает спан ошибкой, nil игнорируется.
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Error = err.Error()
+}
+
+// End завершает спан и отдаёт его экспортёру, если трассировка записывается.
+// Повторные вызовы ничего не делают.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	data := s.data
+	s.mu.Unlock()
+
+	if s.sc.Sampled && s.tracer.exporter != nil {
+		s.tracer.exporter.Export(data)
+	}
+}
+
+func newTraceID() TraceID {
+	var id TraceID
+	for id == (TraceID{}) {
+		binary.BigEndian.PutUint64(id[:8], rand.Uint64())
+		binary.BigEndian.PutUint64(id[8:], rand.Uint64())
+	}
+	return id
+}
+
+func newSpanID() SpanID {
+	var id SpanID
+	for id == (SpanID{}) {
+		binary.BigEndian.PutUint64(id[:], rand.Uint64())
+	}
+	return id
+}
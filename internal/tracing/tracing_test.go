@@ -0,0 +1,201 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		name        string
+		value       string
+		wantTrace   string
+		wantSpan    string
+		wantSampled bool
+		wantErr     bool
+	}{
+		{
+			name:        "sampled",
+			value:       "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			wantTrace:   "4bf92f3577b34da6a3ce929d0e0e4736",
+			wantSpan:    "00f067aa0ba902b7",
+			wantSampled: true,
+		},
+		{
+			name:      "not sampled",
+			value:     "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00",
+			wantTrace: "4bf92f3577b34da6a3ce929d0e0e4736",
+			wantSpan:  "00f067aa0ba902b7",
+		},
+		{
+			name:        "future version with extra fields",
+			value:       "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+			wantTrace:   "4bf92f3577b34da6a3ce929d0e0e4736",
+			wantSpan:    "00f067aa0ba902b7",
+			wantSampled: true,
+		},
+		{
+			name:    "version 00 with extra fields",
+			value:   "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-x",
+			wantErr: true,
+		},
+		{name: "forbidden version", value: "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", wantErr: true},
+		{name: "uppercase", value: "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", wantErr: true},
+		{name: "zero trace id", value: "00-00000000000000000000000000000000-00f067aa0ba902b7-01", wantErr: true},
+		{name: "zero span id", value: "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", wantErr: true},
+		{name: "not hex", value: "00-4bf92f3577b34da6a3ce929d0e0e473z-00f067aa0ba902b7-01", wantErr: true},
+		{name: "short", value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7", wantErr: true},
+		{name: "empty", value: "", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sc, err := ParseTraceparent(test.value)
+			if test.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidTraceparent)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.wantTrace, sc.TraceID.String())
+			assert.Equal(t, test.wantSpan, sc.SpanID.String())
+			assert.Equal(t, test.wantSampled, sc.Sampled)
+		})
+	}
+
+	sc, err := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	require.NoError(t, err)
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", sc.Traceparent())
+}
+
+func TestTracer(t *testing.T) {
+	exporter := NewMemoryExporter()
+	tracer := NewTracer(exporter)
+
+	parent, err := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	require.NoError(t, err)
+
+	ctx, root := tracer.StartRemote(context.Background(), "HTTP GET", parent)
+	require.NotNil(t, root)
+	assert.Equal(t, parent.TraceID, root.Context().TraceID)
+	assert.NotEqual(t, parent.SpanID, root.Context().SpanID)
+	assert.Same(t, root, SpanFromContext(ctx))
+
+	childCtx, child := Start(ctx, "storage.get_url")
+	child.SetAttribute("storage.backend", "memory")
+	child.RecordError(errors.New("not found"))
+	child.End()
+	child.End()
+	assert.Same(t, child, SpanFromContext(childCtx))
+
+	root.SetName("HTTP GET /{id}")
+	root.End()
+
+	spans := exporter.Spans()
+	require.Len(t, spans, 2)
+	assert.Equal(t, "storage.get_url", spans[0].Name)
+	assert.Equal(t, root.Context().SpanID.String(), spans[0].ParentID)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[0].TraceID)
+	assert.Equal(t, map[string]string{"storage.backend": "memory"}, spans[0].Attributes)
+	assert.Equal(t, "not found", spans[0].Error)
+	assert.Equal(t, "HTTP GET /{id}", spans[1].Name)
+	assert.Equal(t, "00f067aa0ba902b7", spans[1].ParentID)
+	assert.False(t, spans[1].End.Before(spans[1].Start))
+
+	exporter.Reset()
+	assert.Empty(t, exporter.Spans())
+}
+
+func TestTracer_NewTrace(t *testing.T) {
+	exporter := NewMemoryExporter()
+	tracer := NewTracer(exporter)
+
+	_, first := tracer.StartRemote(context.Background(), "first", SpanContext{})
+	_, second := tracer.StartRemote(context.Background(), "second", SpanContext{})
+	assert.True(t, first.Context().IsValid())
+	assert.True(t, first.Context().Sampled)
+	assert.NotEqual(t, first.Context().TraceID, second.Context().TraceID)
+	first.End()
+	second.End()
+	assert.Len(t, exporter.Spans(), 2)
+
+	// Вызывающая сторона не записывает трассировку: спаны создаются, но не экспортируются.
+	exporter.Reset()
+	parent := first.Context()
+	parent.Sampled = false
+	ctx, span := tracer.StartRemote(context.Background(), "unsampled", parent)
+	_, child := Start(ctx, "child")
+	child.End()
+	span.End()
+	assert.Empty(t, exporter.Spans())
+}
+
+func TestTracer_Nil(t *testing.T) {
+	var tracer *Tracer
+
+	ctx, span := tracer.StartRemote(context.Background(), "request", SpanContext{})
+	assert.Nil(t, span)
+	assert.Nil(t, SpanFromContext(ctx))
+
+	// Без спана в контексте дочерние спаны не создаются, а методы нулевого спана безопасны.
+	_, child := Start(ctx, "child")
+	assert.Nil(t, child)
+	assert.NotPanics(t, func() {
+		child.SetName("child")
+		child.SetAttribute("key", "value")
+		child.RecordError(errors.New("error"))
+		child.End()
+	})
+	assert.False(t, child.Context().IsValid())
+	assert.Nil(t, LogFields(ctx))
+}
+
+func TestLogger(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	logger := zap.New(core)
+
+	ctx, span := NewTracer(nil).StartRemote(context.Background(), "request", SpanContext{})
+	Logger(ctx, logger).Info("traced")
+	Logger(context.Background(), logger).Info("untraced")
+
+	entries := logs.All()
+	require.Len(t, entries, 2)
+	assert.Equal(t, map[string]any{
+		"trace_id": span.Context().TraceID.String(),
+		"span_id":  span.Context().SpanID.String(),
+	}, entries[0].ContextMap())
+	assert.Empty(t, entries[1].ContextMap())
+}
+
+func TestJSONExporter(t *testing.T) {
+	var buf bytes.Buffer
+	tracer := NewTracer(NewJSONExporter(&buf))
+
+	_, span := tracer.StartRemote(context.Background(), "request", SpanContext{})
+	span.End()
+
+	var data SpanData
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &data))
+	assert.Equal(t, "request", data.Name)
+	assert.Equal(t, span.Context().TraceID.String(), data.TraceID)
+	assert.Equal(t, span.Context().SpanID.String(), data.SpanID)
+}
+
+func TestNewTracerFor(t *testing.T) {
+	for _, name := range []string{"", ExporterNone, ExporterStdout} {
+		tracer, err := NewTracerFor(name)
+		assert.NoError(t, err)
+		assert.NotNil(t, tracer)
+	}
+
+	_, err := NewTracerFor("jaeger")
+	assert.ErrorIs(t, err, ErrUnknownExporter)
+}
@@ -0,0 +1,149 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	"github.com/Melikhov-p/url-minimise/internal/clicks"
+	"github.com/Melikhov-p/url-minimise/internal/models"
+	"github.com/Melikhov-p/url-minimise/internal/repository"
+	"go.uber.org/zap"
+)
+
+// clickFlushTimeout время на сохранение одной пачки событий переходов.
+const clickFlushTimeout = 30 * time.Second
+
+// ClickWorker воркер, который пачками сохраняет события переходов из буфера.
+type ClickWorker struct {
+	FlushInterval time.Duration
+	BatchSize     int
+	Buffer        *clicks.Buffer
+	Logger        *zap.Logger
+	Storage       repository.Storage
+	batch         []*models.ClickEvent
+	dropped       int64
+	stop          chan bool
+}
+
+// NewClickWorker возвращает воркера, который сохраняет накопленные события при заполнении пачки
+// из batchSize событий или раз в flushInterval.
+func NewClickWorker(
+	flushInterval time.Duration,
+	batchSize int,
+	buffer *clicks.Buffer,
+	logger *zap.Logger,
+	storage repository.Storage,
+) *ClickWorker {
+	batchSize = max(batchSize, 1)
+
+	return &ClickWorker{
+		FlushInterval: flushInterval,
+		BatchSize:     batchSize,
+		Buffer:        buffer,
+		Logger:        logger,
+		Storage:       storage,
+		batch:         make([]*models.ClickEvent, 0, batchSize),
+		stop:          make(chan bool, 1),
+	}
+}
+
+// LookUp основной луп воркера. При остановке сохраняет события, оставшиеся в буфере.
+func (cw *ClickWorker) LookUp() {
+	cw.Logger.Info("worker: starting look up for click events")
+
+	ticker := time.NewTicker(cw.FlushInterval)
+	defer ticker.Stop()
+
+loop:
+	for {
+		select {
+		case <-cw.stop:
+			break loop
+		case event := <-cw.Buffer.Events():
+			cw.add(event)
+		case <-ticker.C:
+			cw.flush()
+		}
+	}
+
+	// Сохраняем события, успевшие попасть в буфер до остановки.
+	for drained := false; !drained; {
+		select {
+		case event := <-cw.Buffer.Events():
+			cw.add(event)
+		default:
+			drained = true
+		}
+	}
+	cw.flush()
+
+	cw.Logger.Debug("click worker stopped")
+}
+
+// add добавляет событие в пачку и сохраняет заполненную пачку.
+func (cw *ClickWorker) add(event *models.ClickEvent) {
+	cw.batch = append(cw.batch, event)
+	if len(cw.batch) >= cw.BatchSize {
+		cw.flush()
+	}
+}
+
+// flush сохраняет накопленную пачку событий. Пачка, которую не удалось сохранить, отбрасывается,
+// чтобы недоступность хранилища не останавливала приём новых событий.
+func (cw *ClickWorker) flush() {
+	if dropped := cw.Buffer.Dropped(); dropped > cw.dropped {
+		cw.Logger.Warn("worker: click events dropped on buffer overflow",
+			zap.Int64("dropped", dropped-cw.dropped), zap.Int64("total", dropped))
+		cw.dropped = dropped
+	}
+
+	if len(cw.batch) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), clickFlushTimeout)
+	defer cancel()
+
+	if err := cw.Storage.AddClicks(ctx, cw.batch); err != nil {
+		cw.Logger.Error("worker: error saving click events", zap.Int("count", len(cw.batch)), zap.Error(err))
+	} else {
+		cw.Logger.Debug("worker: saved click events", zap.Int("count", len(cw.batch)))
+	}
+	cw.saveVariantHits(ctx)
+
+	clear(cw.batch)
+	cw.batch = cw.batch[:0]
+}
+
+// variantHit вариант ссылки, показы которого собираются из пачки.
+type variantHit struct {
+	shortURL string
+	variant  string
+}
+
+// saveVariantHits прибавляет показы вариантов A/B из пачки событий к счётчикам, одной записью на вариант.
+func (cw *ClickWorker) saveVariantHits(ctx context.Context) {
+	hits := make(map[variantHit]int64)
+	for _, event := range cw.batch {
+		if event.Variant != "" {
+			hits[variantHit{shortURL: event.ShortURL, variant: event.Variant}]++
+		}
+	}
+
+	for hit, count := range hits {
+		if err := cw.Storage.AddVariantHits(ctx, hit.shortURL, hit.variant, count); err != nil {
+			cw.Logger.Error("worker: error saving variant hits",
+				zap.String("shortURL", hit.shortURL), zap.String("variant", hit.variant), zap.Error(err))
+		}
+	}
+}
+
+// Stop worker.
+func (cw *ClickWorker) Stop() {
+	defer func() {
+		close(cw.stop)
+	}()
+
+	cw.Logger.Debug("click worker got signal for stopping")
+	cw.stop <- true
+}
@@ -0,0 +1,98 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	"github.com/Melikhov-p/url-minimise/internal/repository"
+	taskService "github.com/Melikhov-p/url-minimise/internal/service"
+	"go.uber.org/zap"
+)
+
+// healthCheckBatchSize сколько ссылок проверяется за один проход воркера.
+const healthCheckBatchSize = 500
+
+// HealthWorker воркер, который проверяет доступность адресов назначения активных ссылок.
+type HealthWorker struct {
+	PingPoint     time.Time
+	PingInterval  time.Duration
+	CheckInterval time.Duration
+	Checker       *taskService.HealthChecker
+	Logger        *zap.Logger
+	Storage       repository.Storage
+	ctx           context.Context
+	cancel        context.CancelFunc
+	stop          chan bool
+}
+
+// NewHealthWorker возвращает воркера, который раз в pingInterval проверяет ссылки,
+// не проверявшиеся дольше checkInterval.
+func NewHealthWorker(
+	pingInterval time.Duration,
+	checkInterval time.Duration,
+	checker *taskService.HealthChecker,
+	logger *zap.Logger,
+	storage repository.Storage,
+) *HealthWorker {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &HealthWorker{
+		PingPoint:     time.Now(),
+		PingInterval:  pingInterval,
+		CheckInterval: checkInterval,
+		Checker:       checker,
+		Logger:        logger,
+		Storage:       storage,
+		ctx:           ctx,
+		cancel:        cancel,
+		stop:          make(chan bool, 1),
+	}
+}
+
+// LookUp основной луп воркера
+func (hw *HealthWorker) LookUp() {
+	hw.Logger.Info("worker: starting look up for link destinations health")
+
+loop:
+	for {
+		select {
+		case <-hw.stop:
+			break loop
+		case <-time.After(time.Until(hw.PingPoint)):
+			hw.check()
+			hw.pingAfterInterval()
+		}
+	}
+
+	hw.Logger.Debug("health worker stopped")
+}
+
+// check проверяет очередную пачку ссылок.
+func (hw *HealthWorker) check() {
+	checked, err := taskService.RunHealthCheck(
+		hw.ctx, hw.Storage, hw.Checker, hw.CheckInterval, healthCheckBatchSize,
+	)
+	if err != nil {
+		hw.Logger.Error("worker: error checking link destinations", zap.Error(err))
+		return
+	}
+	if checked > 0 {
+		hw.Logger.Debug("worker: checked link destinations", zap.Int("count", checked))
+	}
+}
+
+// pingAfterInterval ping links after interval.
+func (hw *HealthWorker) pingAfterInterval() {
+	hw.PingPoint = time.Now().Add(hw.PingInterval)
+}
+
+// Stop worker. Прерывает текущие проверки, чтобы не задерживать остановку сервиса.
+func (hw *HealthWorker) Stop() {
+	defer func() {
+		close(hw.stop)
+	}()
+
+	hw.Logger.Debug("health worker got signal for stopping")
+	hw.cancel()
+	hw.stop <- true
+}
@@ -0,0 +1,86 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	"github.com/Melikhov-p/url-minimise/internal/config"
+	"github.com/Melikhov-p/url-minimise/internal/repository"
+	taskService "github.com/Melikhov-p/url-minimise/internal/service"
+	"go.uber.org/zap"
+)
+
+// KeyWorker воркер, который перечитывает ключи подписи токенов, выпускает новый ключ по расписанию
+// и выводит из оборота ключи, все токены которых уже истекли.
+type KeyWorker struct {
+	PingPoint    time.Time
+	PingInterval time.Duration
+	Cfg          *config.Config
+	Logger       *zap.Logger
+	Storage      repository.Storage
+	stop         chan bool
+}
+
+// NewKeyWorker возвращает воркера ротации ключей подписи токенов.
+func NewKeyWorker(
+	pingInterval time.Duration,
+	cfg *config.Config,
+	logger *zap.Logger,
+	storage repository.Storage,
+) *KeyWorker {
+	return &KeyWorker{
+		PingPoint:    time.Now(),
+		PingInterval: pingInterval,
+		Cfg:          cfg,
+		Logger:       logger,
+		Storage:      storage,
+		stop:         make(chan bool, 1),
+	}
+}
+
+// LookUp основной луп воркера
+func (kw *KeyWorker) LookUp() {
+	kw.Logger.Info("worker: starting look up for signing keys rotation")
+
+loop:
+	for {
+		select {
+		case <-kw.stop:
+			break loop
+		case <-time.After(time.Until(kw.PingPoint)):
+			kw.maintain()
+			kw.pingAfterInterval()
+		}
+	}
+
+	kw.Logger.Debug("key worker stopped")
+}
+
+// maintain выпускает и выводит из оборота ключи подписи по расписанию.
+func (kw *KeyWorker) maintain() {
+	rotated, retired, err := taskService.MaintainSigningKeys(context.Background(), kw.Storage, kw.Cfg)
+	if err != nil {
+		kw.Logger.Error("worker: error maintaining signing keys", zap.Error(err))
+		return
+	}
+	if rotated || retired > 0 {
+		kw.Logger.Info("worker: signing keys rotated",
+			zap.Bool("rotated", rotated),
+			zap.Int("retired", retired))
+	}
+}
+
+// pingAfterInterval ping signing keys after interval.
+func (kw *KeyWorker) pingAfterInterval() {
+	kw.PingPoint = time.Now().Add(kw.PingInterval)
+}
+
+// Stop worker.
+func (kw *KeyWorker) Stop() {
+	defer func() {
+		close(kw.stop)
+	}()
+
+	kw.Logger.Debug("key worker got signal for stopping")
+	kw.stop <- true
+}
@@ -0,0 +1,100 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	"github.com/Melikhov-p/url-minimise/internal/config"
+	"github.com/Melikhov-p/url-minimise/internal/repository"
+	taskService "github.com/Melikhov-p/url-minimise/internal/service"
+	"go.uber.org/zap"
+)
+
+// PolicyWorker воркер, который перечитывает файл политики адресов при его изменении
+// и обновляет карантин ссылок по новым правилам.
+type PolicyWorker struct {
+	PingPoint    time.Time
+	PingInterval time.Duration
+	Cfg          *config.Config
+	Logger       *zap.Logger
+	Storage      repository.Storage
+	applied      bool
+	stop         chan bool
+}
+
+// NewPolicyWorker возвращает воркера, который перечитывает файл политики адресов при его изменении.
+func NewPolicyWorker(
+	pingInterval time.Duration,
+	cfg *config.Config,
+	logger *zap.Logger,
+	storage repository.Storage,
+) *PolicyWorker {
+	return &PolicyWorker{
+		PingPoint:    time.Now(),
+		PingInterval: pingInterval,
+		Cfg:          cfg,
+		Logger:       logger,
+		Storage:      storage,
+		stop:         make(chan bool, 1),
+	}
+}
+
+// LookUp основной луп воркера
+func (pw *PolicyWorker) LookUp() {
+	pw.Logger.Info("worker: starting look up for url policy changes")
+
+loop:
+	for {
+		select {
+		case <-pw.stop:
+			break loop
+		case <-time.After(time.Until(pw.PingPoint)):
+			pw.reload()
+			pw.pingAfterInterval()
+		}
+	}
+
+	pw.Logger.Debug("policy worker stopped")
+}
+
+// reload перечитывает политику и обновляет карантин. При первом запуске карантин обновляется всегда,
+// чтобы учесть изменения файла, сделанные пока сервис был остановлен. Если файл прочитать не удалось,
+// карантин не трогается: иначе правила, которые так и не загрузились, сняли бы его со всех ссылок.
+func (pw *PolicyWorker) reload() {
+	reloaded, err := pw.Cfg.URLPolicy.Reload()
+	if err != nil {
+		pw.Logger.Error("worker: error reloading url policy", zap.Error(err))
+		return
+	}
+	if !reloaded && pw.applied {
+		return
+	}
+
+	quarantined, released, err := taskService.ApplyURLPolicy(context.Background(), pw.Storage, pw.Cfg)
+	if err != nil {
+		pw.Logger.Error("worker: error applying url policy", zap.Error(err))
+		return
+	}
+	pw.applied = true
+
+	if quarantined > 0 || released > 0 {
+		pw.Logger.Info("worker: url policy applied",
+			zap.Int("quarantined", quarantined),
+			zap.Int("released", released))
+	}
+}
+
+// pingAfterInterval ping policy file after interval.
+func (pw *PolicyWorker) pingAfterInterval() {
+	pw.PingPoint = time.Now().Add(pw.PingInterval)
+}
+
+// Stop worker.
+func (pw *PolicyWorker) Stop() {
+	defer func() {
+		close(pw.stop)
+	}()
+
+	pw.Logger.Debug("policy worker got signal for stopping")
+	pw.stop <- true
+}
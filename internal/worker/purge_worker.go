@@ -0,0 +1,82 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	"github.com/Melikhov-p/url-minimise/internal/repository"
+	taskService "github.com/Melikhov-p/url-minimise/internal/service"
+	"go.uber.org/zap"
+)
+
+// PurgeWorker воркер, который окончательно удаляет адреса после истечения срока хранения.
+type PurgeWorker struct {
+	PingPoint    time.Time
+	PingInterval time.Duration
+	Retention    time.Duration
+	Logger       *zap.Logger
+	Storage      repository.Storage
+	stop         chan bool
+}
+
+// NewPurgeWorker возвращает воркера, который окончательно удаляет адреса после истечения срока хранения.
+func NewPurgeWorker(
+	pingInterval time.Duration,
+	retention time.Duration,
+	logger *zap.Logger,
+	storage repository.Storage,
+) *PurgeWorker {
+	return &PurgeWorker{
+		PingPoint:    time.Now(),
+		PingInterval: pingInterval,
+		Retention:    retention,
+		Logger:       logger,
+		Storage:      storage,
+		stop:         make(chan bool, 1),
+	}
+}
+
+// LookUp основной луп воркера
+func (pw *PurgeWorker) LookUp() {
+	pw.Logger.Info("worker: starting look up for expired deleted URLs")
+
+loop:
+	for {
+		select {
+		case <-pw.stop:
+			break loop
+		case <-time.After(time.Until(pw.PingPoint)):
+			pw.purge()
+			pw.pingAfterInterval()
+		}
+	}
+
+	pw.Logger.Debug("purge worker stopped")
+}
+
+// purge окончательно удаляет адреса с истёкшим сроком хранения.
+func (pw *PurgeWorker) purge() {
+	purged, err := taskService.PurgeDeletedURLs(context.Background(), pw.Retention, pw.Storage)
+	if err != nil {
+		pw.Logger.Error("worker: error purging deleted URLs", zap.Error(err))
+		return
+	}
+	if purged > 0 {
+		pw.Logger.Info("worker: purged deleted URLs", zap.Int("count", purged))
+	}
+}
+
+// pingAfterInterval ping storage after interval.
+func (pw *PurgeWorker) pingAfterInterval() {
+	pw.PingPoint = time.Now().Add(pw.PingInterval)
+}
+
+// Stop worker.
+func (pw *PurgeWorker) Stop() {
+	defer func() {
+		close(pw.stop)
+	}()
+
+	pw.Logger.Debug("purge worker got signal for stopping")
+	pw.stop <- true
+}
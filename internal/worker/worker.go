@@ -4,6 +4,7 @@ import (
 	"context"
 	"time"
 
+	"github.com/Melikhov-p/url-minimise/internal/metrics"
 	"github.com/Melikhov-p/url-minimise/internal/models"
 	"github.com/Melikhov-p/url-minimise/internal/repository"
 	taskService "github.com/Melikhov-p/url-minimise/internal/service"
@@ -21,6 +22,7 @@ type DelWorker struct {
 	PingInterval time.Duration
 	Logger       *zap.Logger
 	Storage      repository.Storage
+	Metrics      *metrics.Metrics
 	stop         chan bool
 }
 
@@ -55,6 +57,7 @@ loop:
 					dw.pingAfterInterval()
 					continue
 				}
+				dw.Metrics.SetDeleteQueue(len(tasks))
 				if len(tasks) == 0 {
 					dw.pingAfterInterval()
 					continue
@@ -76,6 +79,7 @@ loop:
 					continue
 				}
 				dw.Logger.Debug("worker: update done task statuses")
+				dw.Metrics.AddDeletedTasks(len(tasks))
 
 				dw.pingAfterInterval()
 			}
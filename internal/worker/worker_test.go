@@ -1,12 +1,23 @@
 package worker
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/Melikhov-p/url-minimise/internal/clicks"
 	"github.com/Melikhov-p/url-minimise/internal/config"
 	"github.com/Melikhov-p/url-minimise/internal/logger"
+	"github.com/Melikhov-p/url-minimise/internal/models"
+	"github.com/Melikhov-p/url-minimise/internal/policy"
 	"github.com/Melikhov-p/url-minimise/internal/repository"
+	taskService "github.com/Melikhov-p/url-minimise/internal/service"
+	"github.com/Melikhov-p/url-minimise/internal/storage"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -15,7 +26,9 @@ func BenchmarkWorker(b *testing.B) {
 	if err != nil {
 		panic(err.Error())
 	}
-	store, err := repository.NewStorage(config.NewConfig(log, true), log)
+	cfg := config.NewConfig(log, true)
+	cfg.Storage.FileStorage.FilePath = filepath.Join(b.TempDir(), "storage.txt")
+	store, err := repository.NewStorage(cfg, log)
 	if err != nil {
 		panic(err.Error())
 	}
@@ -32,7 +45,9 @@ func TestNewDelWorker(t *testing.T) {
 	if err != nil {
 		panic(err.Error())
 	}
-	store, err := repository.NewStorage(config.NewConfig(log, true), log)
+	cfg := config.NewConfig(log, true)
+	cfg.Storage.FileStorage.FilePath = filepath.Join(t.TempDir(), "storage.txt")
+	store, err := repository.NewStorage(cfg, log)
 	if err != nil {
 		panic(err.Error())
 	}
@@ -47,7 +62,9 @@ func TestDelWorker_Stop(t *testing.T) {
 	if err != nil {
 		panic(err.Error())
 	}
-	store, err := repository.NewStorage(config.NewConfig(log, true), log)
+	cfg := config.NewConfig(log, true)
+	cfg.Storage.FileStorage.FilePath = filepath.Join(t.TempDir(), "storage.txt")
+	store, err := repository.NewStorage(cfg, log)
 	if err != nil {
 		panic(err.Error())
 	}
@@ -70,7 +87,9 @@ func TestPingAfterInterval(t *testing.T) {
 	if err != nil {
 		panic(err.Error())
 	}
-	store, err := repository.NewStorage(config.NewConfig(log, true), log)
+	cfg := config.NewConfig(log, true)
+	cfg.Storage.FileStorage.FilePath = filepath.Join(t.TempDir(), "storage.txt")
+	store, err := repository.NewStorage(cfg, log)
 	if err != nil {
 		panic(err.Error())
 	}
@@ -80,3 +99,257 @@ func TestPingAfterInterval(t *testing.T) {
 
 	assert.True(t, true, time.Now().Before(dw.PingPoint))
 }
+
+func TestPurgeWorker_LookUp(t *testing.T) {
+	log, err := logger.BuildLogger("ERROR")
+	if err != nil {
+		panic(err.Error())
+	}
+	cfg := config.NewConfig(log, true)
+	cfg.StorageMode = storage.BaseStorage
+	store, err := repository.NewStorage(cfg, log)
+	if err != nil {
+		panic(err.Error())
+	}
+	ctx := context.Background()
+
+	_, err = store.AddURL(ctx, &models.StorageURL{ShortURL: "short", OriginalURL: "original", UserID: 1})
+	assert.NoError(t, err)
+	err = store.MarkAsDeletedURL(ctx, []*models.DelTask{{URL: "short", UserID: 1}})
+	assert.NoError(t, err)
+
+	pw := NewPurgeWorker(time.Hour, -time.Minute, log, store)
+	go pw.LookUp()
+
+	assert.Eventually(t, func() bool {
+		return !store.CheckShort(ctx, "short")
+	}, time.Second, 10*time.Millisecond)
+
+	pw.Stop()
+}
+
+func TestPolicyWorker_LookUp(t *testing.T) {
+	log, err := logger.BuildLogger("ERROR")
+	if err != nil {
+		panic(err.Error())
+	}
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	assert.NoError(t, os.WriteFile(path, []byte("*.evil.com\n"), 0600))
+
+	cfg := config.NewConfig(log, true)
+	cfg.StorageMode = storage.BaseStorage
+	cfg.URLPolicy = policy.New(path, policy.ModeBlock)
+	store, err := repository.NewStorage(cfg, log)
+	if err != nil {
+		panic(err.Error())
+	}
+	ctx := context.Background()
+
+	_, err = store.AddURL(ctx, &models.StorageURL{ShortURL: "phish", OriginalURL: "https://login.evil.com"})
+	assert.NoError(t, err)
+	_, err = store.AddURL(ctx, &models.StorageURL{ShortURL: "later", OriginalURL: "https://later.example.com"})
+	assert.NoError(t, err)
+
+	pw := NewPolicyWorker(10*time.Millisecond, cfg, log, store)
+	go pw.LookUp()
+	defer pw.Stop()
+
+	quarantined := func(short string) func() bool {
+		return func() bool {
+			url, err := store.GetURL(ctx, short)
+			return err == nil && url.Quarantined
+		}
+	}
+	assert.Eventually(t, quarantined("phish"), time.Second, 10*time.Millisecond)
+
+	// Домен, добавленный в файл позже, попадает в карантин после перечитывания файла.
+	modTime := time.Now().Add(time.Minute)
+	assert.NoError(t, os.WriteFile(path, []byte("*.evil.com\nlater.example.com\n"), 0600))
+	assert.NoError(t, os.Chtimes(path, modTime, modTime))
+	assert.Eventually(t, quarantined("later"), time.Second, 10*time.Millisecond)
+}
+
+func TestPolicyWorker_ReloadError(t *testing.T) {
+	log, err := logger.BuildLogger("ERROR")
+	if err != nil {
+		panic(err.Error())
+	}
+
+	cfg := config.NewConfig(log, true)
+	cfg.StorageMode = storage.BaseStorage
+	cfg.URLPolicy = policy.New(filepath.Join(t.TempDir(), "missing.txt"), policy.ModeBlock)
+	store, err := repository.NewStorage(cfg, log)
+	if err != nil {
+		panic(err.Error())
+	}
+	ctx := context.Background()
+
+	_, err = store.AddURL(ctx, &models.StorageURL{ShortURL: "phish", OriginalURL: "https://login.evil.com"})
+	assert.NoError(t, err)
+	_, _, err = store.UpdateQuarantine(ctx, func(string) bool { return true })
+	assert.NoError(t, err)
+
+	// Непрочитанный файл политики не снимает карантин.
+	pw := NewPolicyWorker(time.Minute, cfg, log, store)
+	pw.reload()
+	url, err := store.GetURL(ctx, "phish")
+	assert.NoError(t, err)
+	assert.True(t, url.Quarantined)
+	assert.False(t, pw.applied)
+}
+
+func TestHealthWorker_LookUp(t *testing.T) {
+	log, err := logger.BuildLogger("ERROR")
+	if err != nil {
+		panic(err.Error())
+	}
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer down.Close()
+
+	cfg := config.NewConfig(log, true)
+	cfg.StorageMode = storage.BaseStorage
+	cfg.HealthBrokenAfter = 2
+	cfg.HealthCheckHostInterval = 0
+	cfg.HealthCheckAllowPrivate = true
+	store, err := repository.NewStorage(cfg, log)
+	if err != nil {
+		panic(err.Error())
+	}
+	ctx := context.Background()
+
+	_, err = store.AddURL(ctx, &models.StorageURL{ShortURL: "down", OriginalURL: down.URL, UserID: 1})
+	assert.NoError(t, err)
+
+	hw := NewHealthWorker(10*time.Millisecond, 0, taskService.NewHealthChecker(cfg), log, store)
+	go hw.LookUp()
+	defer hw.Stop()
+
+	assert.Eventually(t, func() bool {
+		broken, err := store.GetBrokenLinks(ctx, 1)
+		return err == nil && len(broken) == 1 && broken[0].StatusCode == http.StatusBadGateway
+	}, time.Second, 10*time.Millisecond)
+}
+
+// clickSpyStorage запоминает сохранённые пачки событий переходов.
+type clickSpyStorage struct {
+	repository.Storage
+	mu      sync.Mutex
+	batches [][]*models.ClickEvent
+	hits    map[string]int64
+	writes  int
+}
+
+func (s *clickSpyStorage) AddClicks(_ context.Context, events []*models.ClickEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.batches = append(s.batches, append([]*models.ClickEvent(nil), events...))
+	return nil
+}
+
+func (s *clickSpyStorage) AddVariantHits(_ context.Context, shortURL string, variant string, hits int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.hits == nil {
+		s.hits = make(map[string]int64)
+	}
+	s.hits[shortURL+"/"+variant] += hits
+	s.writes++
+	return nil
+}
+
+func (s *clickSpyStorage) saved() (batches, events int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, batch := range s.batches {
+		events += len(batch)
+	}
+	return len(s.batches), events
+}
+
+func TestClickWorker_LookUp(t *testing.T) {
+	log, err := logger.BuildLogger("ERROR")
+	if err != nil {
+		panic(err.Error())
+	}
+	buffer := clicks.NewBuffer(100)
+	store := &clickSpyStorage{}
+
+	cw := NewClickWorker(time.Hour, 3, buffer, log, store)
+	done := make(chan struct{})
+	go func() {
+		cw.LookUp()
+		close(done)
+	}()
+
+	// Заполненная пачка сохраняется, не дожидаясь интервала.
+	for range 4 {
+		assert.True(t, buffer.Record(&models.ClickEvent{ShortURL: "short"}))
+	}
+	assert.Eventually(t, func() bool {
+		batches, events := store.saved()
+		return batches == 1 && events == 3
+	}, time.Second, 10*time.Millisecond)
+
+	// Остаток сохраняется при остановке.
+	cw.Stop()
+	<-done
+	batches, events := store.saved()
+	assert.Equal(t, 2, batches)
+	assert.Equal(t, 4, events)
+}
+
+func TestClickWorker_VariantHits(t *testing.T) {
+	log, err := logger.BuildLogger("ERROR")
+	if err != nil {
+		panic(err.Error())
+	}
+	buffer := clicks.NewBuffer(100)
+	store := &clickSpyStorage{}
+
+	cw := NewClickWorker(time.Hour, 100, buffer, log, store)
+	done := make(chan struct{})
+	go func() {
+		cw.LookUp()
+		close(done)
+	}()
+
+	for _, variant := range []string{"a", "b", "a", "", "a"} {
+		assert.True(t, buffer.Record(&models.ClickEvent{ShortURL: "short", Variant: variant}))
+	}
+	cw.Stop()
+	<-done
+
+	// Показы одного варианта из пачки складываются в одну запись.
+	assert.Equal(t, map[string]int64{"short/a": 3, "short/b": 1}, store.hits)
+	assert.Equal(t, 2, store.writes)
+}
+
+func TestKeyWorker_LookUp(t *testing.T) {
+	log, err := logger.BuildLogger("ERROR")
+	if err != nil {
+		panic(err.Error())
+	}
+	cfg := config.NewConfig(log, true)
+	cfg.StorageMode = storage.BaseStorage
+	store, err := repository.NewStorage(cfg, log)
+	if err != nil {
+		panic(err.Error())
+	}
+	first, err := cfg.SigningKeys.Signing()
+	assert.NoError(t, err)
+
+	cfg.SigningKeyRotation = time.Millisecond
+	kw := NewKeyWorker(10*time.Millisecond, cfg, log, store)
+	go kw.LookUp()
+	defer kw.Stop()
+
+	// Ключ старше срока ротации заменяется новым, а прежний ещё проверяет выпущенные им токены.
+	assert.Eventually(t, func() bool {
+		signing, err := cfg.SigningKeys.Signing()
+		return err == nil && signing.ID != first.ID
+	}, time.Second, 10*time.Millisecond)
+	_, ok := cfg.SigningKeys.Verifying(first.ID)
+	assert.True(t, ok)
+}
@@ -21,13 +21,32 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	Shortener_CreateURL_FullMethodName       = "/shortener.Shortener/CreateURL"
-	Shortener_GetFullURL_FullMethodName      = "/shortener.Shortener/GetFullURL"
-	Shortener_CreateBatchURL_FullMethodName  = "/shortener.Shortener/CreateBatchURL"
-	Shortener_GetServiceStats_FullMethodName = "/shortener.Shortener/GetServiceStats"
-	Shortener_GetUserURLs_FullMethodName     = "/shortener.Shortener/GetUserURLs"
-	Shortener_Ping_FullMethodName            = "/shortener.Shortener/Ping"
-	Shortener_MarkAsDelete_FullMethodName    = "/shortener.Shortener/MarkAsDelete"
+	Shortener_CreateURL_FullMethodName            = "/shortener.Shortener/CreateURL"
+	Shortener_GetFullURL_FullMethodName           = "/shortener.Shortener/GetFullURL"
+	Shortener_CreateBatchURL_FullMethodName       = "/shortener.Shortener/CreateBatchURL"
+	Shortener_CreateBatchURLStream_FullMethodName = "/shortener.Shortener/CreateBatchURLStream"
+	Shortener_GetServiceStats_FullMethodName      = "/shortener.Shortener/GetServiceStats"
+	Shortener_GetUserURLs_FullMethodName          = "/shortener.Shortener/GetUserURLs"
+	Shortener_Ping_FullMethodName                 = "/shortener.Shortener/Ping"
+	Shortener_MarkAsDelete_FullMethodName         = "/shortener.Shortener/MarkAsDelete"
+	Shortener_RestoreURLs_FullMethodName          = "/shortener.Shortener/RestoreURLs"
+	Shortener_UpdateURLSettings_FullMethodName    = "/shortener.Shortener/UpdateURLSettings"
+	Shortener_SetRedirectRules_FullMethodName     = "/shortener.Shortener/SetRedirectRules"
+	Shortener_GetRedirectRules_FullMethodName     = "/shortener.Shortener/GetRedirectRules"
+	Shortener_SetVariants_FullMethodName          = "/shortener.Shortener/SetVariants"
+	Shortener_GetVariants_FullMethodName          = "/shortener.Shortener/GetVariants"
+	Shortener_RegisterDomain_FullMethodName       = "/shortener.Shortener/RegisterDomain"
+	Shortener_GetUserDomains_FullMethodName       = "/shortener.Shortener/GetUserDomains"
+	Shortener_GetBrokenURLs_FullMethodName        = "/shortener.Shortener/GetBrokenURLs"
+	Shortener_GetLinkStats_FullMethodName         = "/shortener.Shortener/GetLinkStats"
+	Shortener_WatchClicks_FullMethodName          = "/shortener.Shortener/WatchClicks"
+	Shortener_Register_FullMethodName             = "/shortener.Shortener/Register"
+	Shortener_Login_FullMethodName                = "/shortener.Shortener/Login"
+	Shortener_CreateAPIKey_FullMethodName         = "/shortener.Shortener/CreateAPIKey"
+	Shortener_ListAPIKeys_FullMethodName          = "/shortener.Shortener/ListAPIKeys"
+	Shortener_RevokeAPIKey_FullMethodName         = "/shortener.Shortener/RevokeAPIKey"
+	Shortener_Refresh_FullMethodName              = "/shortener.Shortener/Refresh"
+	Shortener_Logout_FullMethodName               = "/shortener.Shortener/Logout"
 )
 
 // ShortenerClient is the client API for Shortener service.
@@ -37,10 +56,29 @@ type ShortenerClient interface {
 	CreateURL(ctx context.Context, in *CreateURLRequest, opts ...grpc.CallOption) (*CreateURLResponse, error)
 	GetFullURL(ctx context.Context, in *GetFullURLRequest, opts ...grpc.CallOption) (*GetFullURLResponse, error)
 	CreateBatchURL(ctx context.Context, in *CreateBatchURLRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	CreateBatchURLStream(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[BatchURL, CreateBatchURLStreamResponse], error)
 	GetServiceStats(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*GetServiceStatsResponse, error)
 	GetUserURLs(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*GetUserURLsResponse, error)
 	Ping(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*emptypb.Empty, error)
 	MarkAsDelete(ctx context.Context, in *MarkDeletedURLs, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	RestoreURLs(ctx context.Context, in *RestoreURLsRequest, opts ...grpc.CallOption) (*RestoreURLsResponse, error)
+	UpdateURLSettings(ctx context.Context, in *UpdateURLSettingsRequest, opts ...grpc.CallOption) (*URLSettings, error)
+	SetRedirectRules(ctx context.Context, in *SetRedirectRulesRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	GetRedirectRules(ctx context.Context, in *GetRedirectRulesRequest, opts ...grpc.CallOption) (*RedirectRules, error)
+	SetVariants(ctx context.Context, in *SetVariantsRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	GetVariants(ctx context.Context, in *GetVariantsRequest, opts ...grpc.CallOption) (*Variants, error)
+	RegisterDomain(ctx context.Context, in *RegisterDomainRequest, opts ...grpc.CallOption) (*RegisterDomainResponse, error)
+	GetUserDomains(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*UserDomains, error)
+	GetBrokenURLs(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*BrokenURLs, error)
+	GetLinkStats(ctx context.Context, in *GetLinkStatsRequest, opts ...grpc.CallOption) (*LinkStats, error)
+	WatchClicks(ctx context.Context, in *WatchClicksRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[LiveClick], error)
+	Register(ctx context.Context, in *AccountRequest, opts ...grpc.CallOption) (*AccountResponse, error)
+	Login(ctx context.Context, in *AccountRequest, opts ...grpc.CallOption) (*AccountResponse, error)
+	CreateAPIKey(ctx context.Context, in *CreateAPIKeyRequest, opts ...grpc.CallOption) (*APIKey, error)
+	ListAPIKeys(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*APIKeys, error)
+	RevokeAPIKey(ctx context.Context, in *RevokeAPIKeyRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	Refresh(ctx context.Context, in *RefreshRequest, opts ...grpc.CallOption) (*Tokens, error)
+	Logout(ctx context.Context, in *RefreshRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
 }
 
 type shortenerClient struct {
@@ -81,6 +119,19 @@ func (c *shortenerClient) CreateBatchURL(ctx context.Context, in *CreateBatchURL
 	return out, nil
 }
 
+func (c *shortenerClient) CreateBatchURLStream(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[BatchURL, CreateBatchURLStreamResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Shortener_ServiceDesc.Streams[0], Shortener_CreateBatchURLStream_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[BatchURL, CreateBatchURLStreamResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Shortener_CreateBatchURLStreamClient = grpc.ClientStreamingClient[BatchURL, CreateBatchURLStreamResponse]
+
 func (c *shortenerClient) GetServiceStats(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*GetServiceStatsResponse, error) {
 	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
 	out := new(GetServiceStatsResponse)
@@ -121,6 +172,195 @@ func (c *shortenerClient) MarkAsDelete(ctx context.Context, in *MarkDeletedURLs,
 	return out, nil
 }
 
+func (c *shortenerClient) RestoreURLs(ctx context.Context, in *RestoreURLsRequest, opts ...grpc.CallOption) (*RestoreURLsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RestoreURLsResponse)
+	err := c.cc.Invoke(ctx, Shortener_RestoreURLs_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shortenerClient) UpdateURLSettings(ctx context.Context, in *UpdateURLSettingsRequest, opts ...grpc.CallOption) (*URLSettings, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(URLSettings)
+	err := c.cc.Invoke(ctx, Shortener_UpdateURLSettings_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shortenerClient) SetRedirectRules(ctx context.Context, in *SetRedirectRulesRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, Shortener_SetRedirectRules_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shortenerClient) GetRedirectRules(ctx context.Context, in *GetRedirectRulesRequest, opts ...grpc.CallOption) (*RedirectRules, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RedirectRules)
+	err := c.cc.Invoke(ctx, Shortener_GetRedirectRules_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shortenerClient) SetVariants(ctx context.Context, in *SetVariantsRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, Shortener_SetVariants_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shortenerClient) GetVariants(ctx context.Context, in *GetVariantsRequest, opts ...grpc.CallOption) (*Variants, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Variants)
+	err := c.cc.Invoke(ctx, Shortener_GetVariants_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shortenerClient) RegisterDomain(ctx context.Context, in *RegisterDomainRequest, opts ...grpc.CallOption) (*RegisterDomainResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RegisterDomainResponse)
+	err := c.cc.Invoke(ctx, Shortener_RegisterDomain_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shortenerClient) GetUserDomains(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*UserDomains, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(UserDomains)
+	err := c.cc.Invoke(ctx, Shortener_GetUserDomains_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shortenerClient) GetBrokenURLs(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*BrokenURLs, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(BrokenURLs)
+	err := c.cc.Invoke(ctx, Shortener_GetBrokenURLs_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shortenerClient) GetLinkStats(ctx context.Context, in *GetLinkStatsRequest, opts ...grpc.CallOption) (*LinkStats, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(LinkStats)
+	err := c.cc.Invoke(ctx, Shortener_GetLinkStats_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shortenerClient) WatchClicks(ctx context.Context, in *WatchClicksRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[LiveClick], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Shortener_ServiceDesc.Streams[1], Shortener_WatchClicks_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchClicksRequest, LiveClick]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Shortener_WatchClicksClient = grpc.ServerStreamingClient[LiveClick]
+
+func (c *shortenerClient) Register(ctx context.Context, in *AccountRequest, opts ...grpc.CallOption) (*AccountResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(AccountResponse)
+	err := c.cc.Invoke(ctx, Shortener_Register_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shortenerClient) Login(ctx context.Context, in *AccountRequest, opts ...grpc.CallOption) (*AccountResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(AccountResponse)
+	err := c.cc.Invoke(ctx, Shortener_Login_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shortenerClient) CreateAPIKey(ctx context.Context, in *CreateAPIKeyRequest, opts ...grpc.CallOption) (*APIKey, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(APIKey)
+	err := c.cc.Invoke(ctx, Shortener_CreateAPIKey_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shortenerClient) ListAPIKeys(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*APIKeys, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(APIKeys)
+	err := c.cc.Invoke(ctx, Shortener_ListAPIKeys_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shortenerClient) RevokeAPIKey(ctx context.Context, in *RevokeAPIKeyRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, Shortener_RevokeAPIKey_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shortenerClient) Refresh(ctx context.Context, in *RefreshRequest, opts ...grpc.CallOption) (*Tokens, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Tokens)
+	err := c.cc.Invoke(ctx, Shortener_Refresh_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shortenerClient) Logout(ctx context.Context, in *RefreshRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, Shortener_Logout_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // ShortenerServer is the server API for Shortener service.
 // All implementations must embed UnimplementedShortenerServer
 // for forward compatibility.
@@ -128,10 +368,29 @@ type ShortenerServer interface {
 	CreateURL(context.Context, *CreateURLRequest) (*CreateURLResponse, error)
 	GetFullURL(context.Context, *GetFullURLRequest) (*GetFullURLResponse, error)
 	CreateBatchURL(context.Context, *CreateBatchURLRequest) (*emptypb.Empty, error)
+	CreateBatchURLStream(grpc.ClientStreamingServer[BatchURL, CreateBatchURLStreamResponse]) error
 	GetServiceStats(context.Context, *emptypb.Empty) (*GetServiceStatsResponse, error)
 	GetUserURLs(context.Context, *emptypb.Empty) (*GetUserURLsResponse, error)
 	Ping(context.Context, *emptypb.Empty) (*emptypb.Empty, error)
 	MarkAsDelete(context.Context, *MarkDeletedURLs) (*emptypb.Empty, error)
+	RestoreURLs(context.Context, *RestoreURLsRequest) (*RestoreURLsResponse, error)
+	UpdateURLSettings(context.Context, *UpdateURLSettingsRequest) (*URLSettings, error)
+	SetRedirectRules(context.Context, *SetRedirectRulesRequest) (*emptypb.Empty, error)
+	GetRedirectRules(context.Context, *GetRedirectRulesRequest) (*RedirectRules, error)
+	SetVariants(context.Context, *SetVariantsRequest) (*emptypb.Empty, error)
+	GetVariants(context.Context, *GetVariantsRequest) (*Variants, error)
+	RegisterDomain(context.Context, *RegisterDomainRequest) (*RegisterDomainResponse, error)
+	GetUserDomains(context.Context, *emptypb.Empty) (*UserDomains, error)
+	GetBrokenURLs(context.Context, *emptypb.Empty) (*BrokenURLs, error)
+	GetLinkStats(context.Context, *GetLinkStatsRequest) (*LinkStats, error)
+	WatchClicks(*WatchClicksRequest, grpc.ServerStreamingServer[LiveClick]) error
+	Register(context.Context, *AccountRequest) (*AccountResponse, error)
+	Login(context.Context, *AccountRequest) (*AccountResponse, error)
+	CreateAPIKey(context.Context, *CreateAPIKeyRequest) (*APIKey, error)
+	ListAPIKeys(context.Context, *emptypb.Empty) (*APIKeys, error)
+	RevokeAPIKey(context.Context, *RevokeAPIKeyRequest) (*emptypb.Empty, error)
+	Refresh(context.Context, *RefreshRequest) (*Tokens, error)
+	Logout(context.Context, *RefreshRequest) (*emptypb.Empty, error)
 	mustEmbedUnimplementedShortenerServer()
 }
 
@@ -151,6 +410,9 @@ func (UnimplementedShortenerServer) GetFullURL(context.Context, *GetFullURLReque
 func (UnimplementedShortenerServer) CreateBatchURL(context.Context, *CreateBatchURLRequest) (*emptypb.Empty, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method CreateBatchURL not implemented")
 }
+func (UnimplementedShortenerServer) CreateBatchURLStream(grpc.ClientStreamingServer[BatchURL, CreateBatchURLStreamResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method CreateBatchURLStream not implemented")
+}
 func (UnimplementedShortenerServer) GetServiceStats(context.Context, *emptypb.Empty) (*GetServiceStatsResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetServiceStats not implemented")
 }
@@ -163,6 +425,60 @@ func (UnimplementedShortenerServer) Ping(context.Context, *emptypb.Empty) (*empt
 func (UnimplementedShortenerServer) MarkAsDelete(context.Context, *MarkDeletedURLs) (*emptypb.Empty, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method MarkAsDelete not implemented")
 }
+func (UnimplementedShortenerServer) RestoreURLs(context.Context, *RestoreURLsRequest) (*RestoreURLsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RestoreURLs not implemented")
+}
+func (UnimplementedShortenerServer) UpdateURLSettings(context.Context, *UpdateURLSettingsRequest) (*URLSettings, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateURLSettings not implemented")
+}
+func (UnimplementedShortenerServer) SetRedirectRules(context.Context, *SetRedirectRulesRequest) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetRedirectRules not implemented")
+}
+func (UnimplementedShortenerServer) GetRedirectRules(context.Context, *GetRedirectRulesRequest) (*RedirectRules, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetRedirectRules not implemented")
+}
+func (UnimplementedShortenerServer) SetVariants(context.Context, *SetVariantsRequest) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetVariants not implemented")
+}
+func (UnimplementedShortenerServer) GetVariants(context.Context, *GetVariantsRequest) (*Variants, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetVariants not implemented")
+}
+func (UnimplementedShortenerServer) RegisterDomain(context.Context, *RegisterDomainRequest) (*RegisterDomainResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RegisterDomain not implemented")
+}
+func (UnimplementedShortenerServer) GetUserDomains(context.Context, *emptypb.Empty) (*UserDomains, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetUserDomains not implemented")
+}
+func (UnimplementedShortenerServer) GetBrokenURLs(context.Context, *emptypb.Empty) (*BrokenURLs, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetBrokenURLs not implemented")
+}
+func (UnimplementedShortenerServer) GetLinkStats(context.Context, *GetLinkStatsRequest) (*LinkStats, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetLinkStats not implemented")
+}
+func (UnimplementedShortenerServer) WatchClicks(*WatchClicksRequest, grpc.ServerStreamingServer[LiveClick]) error {
+	return status.Errorf(codes.Unimplemented, "method WatchClicks not implemented")
+}
+func (UnimplementedShortenerServer) Register(context.Context, *AccountRequest) (*AccountResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Register not implemented")
+}
+func (UnimplementedShortenerServer) Login(context.Context, *AccountRequest) (*AccountResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Login not implemented")
+}
+func (UnimplementedShortenerServer) CreateAPIKey(context.Context, *CreateAPIKeyRequest) (*APIKey, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateAPIKey not implemented")
+}
+func (UnimplementedShortenerServer) ListAPIKeys(context.Context, *emptypb.Empty) (*APIKeys, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListAPIKeys not implemented")
+}
+func (UnimplementedShortenerServer) RevokeAPIKey(context.Context, *RevokeAPIKeyRequest) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RevokeAPIKey not implemented")
+}
+func (UnimplementedShortenerServer) Refresh(context.Context, *RefreshRequest) (*Tokens, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Refresh not implemented")
+}
+func (UnimplementedShortenerServer) Logout(context.Context, *RefreshRequest) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Logout not implemented")
+}
 func (UnimplementedShortenerServer) mustEmbedUnimplementedShortenerServer() {}
 func (UnimplementedShortenerServer) testEmbeddedByValue()                   {}
 
@@ -238,6 +554,13 @@ func _Shortener_CreateBatchURL_Handler(srv interface{}, ctx context.Context, dec
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Shortener_CreateBatchURLStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(ShortenerServer).CreateBatchURLStream(&grpc.GenericServerStream[BatchURL, CreateBatchURLStreamResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Shortener_CreateBatchURLStreamServer = grpc.ClientStreamingServer[BatchURL, CreateBatchURLStreamResponse]
+
 func _Shortener_GetServiceStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(emptypb.Empty)
 	if err := dec(in); err != nil {
@@ -310,6 +633,323 @@ func _Shortener_MarkAsDelete_Handler(srv interface{}, ctx context.Context, dec f
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Shortener_RestoreURLs_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RestoreURLsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortenerServer).RestoreURLs(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Shortener_RestoreURLs_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortenerServer).RestoreURLs(ctx, req.(*RestoreURLsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Shortener_UpdateURLSettings_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateURLSettingsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortenerServer).UpdateURLSettings(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Shortener_UpdateURLSettings_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortenerServer).UpdateURLSettings(ctx, req.(*UpdateURLSettingsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Shortener_SetRedirectRules_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetRedirectRulesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortenerServer).SetRedirectRules(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Shortener_SetRedirectRules_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortenerServer).SetRedirectRules(ctx, req.(*SetRedirectRulesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Shortener_GetRedirectRules_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetRedirectRulesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortenerServer).GetRedirectRules(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Shortener_GetRedirectRules_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortenerServer).GetRedirectRules(ctx, req.(*GetRedirectRulesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Shortener_SetVariants_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetVariantsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortenerServer).SetVariants(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Shortener_SetVariants_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortenerServer).SetVariants(ctx, req.(*SetVariantsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Shortener_GetVariants_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetVariantsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortenerServer).GetVariants(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Shortener_GetVariants_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortenerServer).GetVariants(ctx, req.(*GetVariantsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Shortener_RegisterDomain_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RegisterDomainRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortenerServer).RegisterDomain(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Shortener_RegisterDomain_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortenerServer).RegisterDomain(ctx, req.(*RegisterDomainRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Shortener_GetUserDomains_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortenerServer).GetUserDomains(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Shortener_GetUserDomains_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortenerServer).GetUserDomains(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Shortener_GetBrokenURLs_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortenerServer).GetBrokenURLs(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Shortener_GetBrokenURLs_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortenerServer).GetBrokenURLs(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Shortener_GetLinkStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetLinkStatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortenerServer).GetLinkStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Shortener_GetLinkStats_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortenerServer).GetLinkStats(ctx, req.(*GetLinkStatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Shortener_WatchClicks_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchClicksRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ShortenerServer).WatchClicks(m, &grpc.GenericServerStream[WatchClicksRequest, LiveClick]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Shortener_WatchClicksServer = grpc.ServerStreamingServer[LiveClick]
+
+func _Shortener_Register_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AccountRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortenerServer).Register(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Shortener_Register_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortenerServer).Register(ctx, req.(*AccountRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Shortener_Login_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AccountRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortenerServer).Login(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Shortener_Login_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortenerServer).Login(ctx, req.(*AccountRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Shortener_CreateAPIKey_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateAPIKeyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortenerServer).CreateAPIKey(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Shortener_CreateAPIKey_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortenerServer).CreateAPIKey(ctx, req.(*CreateAPIKeyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Shortener_ListAPIKeys_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortenerServer).ListAPIKeys(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Shortener_ListAPIKeys_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortenerServer).ListAPIKeys(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Shortener_RevokeAPIKey_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RevokeAPIKeyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortenerServer).RevokeAPIKey(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Shortener_RevokeAPIKey_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortenerServer).RevokeAPIKey(ctx, req.(*RevokeAPIKeyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Shortener_Refresh_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RefreshRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortenerServer).Refresh(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Shortener_Refresh_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortenerServer).Refresh(ctx, req.(*RefreshRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Shortener_Logout_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RefreshRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortenerServer).Logout(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Shortener_Logout_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortenerServer).Logout(ctx, req.(*RefreshRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // Shortener_ServiceDesc is the grpc.ServiceDesc for Shortener service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -345,7 +985,86 @@ var Shortener_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "MarkAsDelete",
 			Handler:    _Shortener_MarkAsDelete_Handler,
 		},
+		{
+			MethodName: "RestoreURLs",
+			Handler:    _Shortener_RestoreURLs_Handler,
+		},
+		{
+			MethodName: "UpdateURLSettings",
+			Handler:    _Shortener_UpdateURLSettings_Handler,
+		},
+		{
+			MethodName: "SetRedirectRules",
+			Handler:    _Shortener_SetRedirectRules_Handler,
+		},
+		{
+			MethodName: "GetRedirectRules",
+			Handler:    _Shortener_GetRedirectRules_Handler,
+		},
+		{
+			MethodName: "SetVariants",
+			Handler:    _Shortener_SetVariants_Handler,
+		},
+		{
+			MethodName: "GetVariants",
+			Handler:    _Shortener_GetVariants_Handler,
+		},
+		{
+			MethodName: "RegisterDomain",
+			Handler:    _Shortener_RegisterDomain_Handler,
+		},
+		{
+			MethodName: "GetUserDomains",
+			Handler:    _Shortener_GetUserDomains_Handler,
+		},
+		{
+			MethodName: "GetBrokenURLs",
+			Handler:    _Shortener_GetBrokenURLs_Handler,
+		},
+		{
+			MethodName: "GetLinkStats",
+			Handler:    _Shortener_GetLinkStats_Handler,
+		},
+		{
+			MethodName: "Register",
+			Handler:    _Shortener_Register_Handler,
+		},
+		{
+			MethodName: "Login",
+			Handler:    _Shortener_Login_Handler,
+		},
+		{
+			MethodName: "CreateAPIKey",
+			Handler:    _Shortener_CreateAPIKey_Handler,
+		},
+		{
+			MethodName: "ListAPIKeys",
+			Handler:    _Shortener_ListAPIKeys_Handler,
+		},
+		{
+			MethodName: "RevokeAPIKey",
+			Handler:    _Shortener_RevokeAPIKey_Handler,
+		},
+		{
+			MethodName: "Refresh",
+			Handler:    _Shortener_Refresh_Handler,
+		},
+		{
+			MethodName: "Logout",
+			Handler:    _Shortener_Logout_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "CreateBatchURLStream",
+			Handler:       _Shortener_CreateBatchURLStream_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "WatchClicks",
+			Handler:       _Shortener_WatchClicks_Handler,
+			ServerStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "protos/proto/shortener.proto",
 }